@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 func clusterStatusCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   "cluster status",
+		Use:   "status",
 		Short: "Show cluster status",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
@@ -22,3 +26,58 @@ func clusterStatusCmd() *cobra.Command {
 		},
 	}
 }
+
+func clusterDumpCmd() *cobra.Command {
+	var format, output string
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Dump full cluster state (jobs, shard summaries, workers, pending nodes) as JSON or YAML",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			client := cliClient()
+			dump, err := client.DumpClusterState(ctx)
+			if err != nil {
+				return err
+			}
+
+			var out []byte
+			switch format {
+			case "json":
+				out, err = json.MarshalIndent(dump, "", "  ")
+				if err != nil {
+					return err
+				}
+				out = append(out, '\n')
+			case "yaml", "yml":
+				// Round-trip through JSON so YAML keys match the JSON field names.
+				raw, err := json.Marshal(dump)
+				if err != nil {
+					return err
+				}
+				var generic interface{}
+				if err := json.Unmarshal(raw, &generic); err != nil {
+					return err
+				}
+				out, err = yaml.Marshal(generic)
+				if err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unsupported format %q (want json or yaml)", format)
+			}
+
+			if output == "" || output == "-" {
+				_, err = os.Stdout.Write(out)
+				return err
+			}
+			if err := os.WriteFile(output, out, 0600); err != nil {
+				return err
+			}
+			fmt.Printf("Cluster state written to %s\n", output)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "json", "Output format: json or yaml")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write dump to file instead of stdout")
+	return cmd
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func completionCmd(root *cobra.Command) *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion [bash|zsh|fish|powershell]",
+		Short: "Generate shell completion scripts",
+		Long: `Writes a completion script for the given shell (default bash) to stdout.
+
+  bash:       source <(certslurpctl completion bash)
+  zsh:        certslurpctl completion zsh > "${fpath[1]}/_certslurpctl"
+  fish:       certslurpctl completion fish > ~/.config/fish/completions/certslurpctl.fish
+  powershell: certslurpctl completion powershell | Out-String | Invoke-Expression`,
+		Args:        cobra.MaximumNArgs(1),
+		ValidArgs:   []string{"bash", "zsh", "fish", "powershell"},
+		Annotations: map[string]string{noAPICreds: "1"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			shell := "bash"
+			if len(args) == 1 {
+				shell = args[0]
+			}
+			return genCompletion(root, shell, os.Stdout)
+		},
+	}
+}
+
+// genCompletion writes root's completion script for shell to w.
+func genCompletion(root *cobra.Command, shell string, w io.Writer) error {
+	switch shell {
+	case "bash":
+		return root.GenBashCompletion(w)
+	case "zsh":
+		return root.GenZshCompletion(w)
+	case "fish":
+		return root.GenFishCompletion(w, true)
+	case "powershell":
+		return root.GenPowerShellCompletionWithDesc(w)
+	}
+	return fmt.Errorf("unsupported shell %q (want bash, zsh, fish or powershell)", shell)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenCompletion(t *testing.T) {
+	root := &cobra.Command{Use: "certslurpctl"}
+	root.AddCommand(&cobra.Command{Use: "job", Run: func(*cobra.Command, []string) {}})
+	root.AddCommand(completionCmd(root))
+
+	for shell, marker := range map[string]string{
+		"bash":       "bash completion for certslurpctl",
+		"zsh":        "#compdef certslurpctl",
+		"fish":       "complete -c certslurpctl",
+		"powershell": "Register-ArgumentCompleter",
+	} {
+		t.Run(shell, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, genCompletion(root, shell, &buf))
+			require.NotEmpty(t, buf.String())
+			require.Contains(t, buf.String(), marker)
+		})
+	}
+
+	require.ErrorContains(t, genCompletion(root, "tcsh", &bytes.Buffer{}), "unsupported shell")
+}
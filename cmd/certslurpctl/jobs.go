@@ -5,9 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/chtzvt/certslurp/internal/api"
+	"github.com/chtzvt/certslurp/internal/cluster"
 	"github.com/chtzvt/certslurp/internal/job"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
@@ -119,15 +122,21 @@ func jobSubmitCmd() *cobra.Command {
 	var (
 		dryRun      bool
 		file        string
+		overlays    []string
 		interactive bool
+		expandEnv   bool
+		strictEnv   bool
+		strict      bool
 		// JobSpec fields
-		version string
-		note    string
-		logURI  string
+		version  string
+		note     string
+		logURI   string
+		priority int
 		// FetchConfig
 		indexStart   int64
 		indexEnd     int64
 		shardSize    int
+		shardAlign   int
 		fetchSize    int
 		fetchWorkers int
 		// MatchConfig
@@ -135,8 +144,22 @@ func jobSubmitCmd() *cobra.Command {
 		issuerRegex      string
 		serial           string
 		sctTimestamp     uint64
-		domainInclude    string
-		domainExclude    string
+		logTSFrom        string
+		logTSTo          string
+		notBeforeAfter   string
+		notBeforeBefore  string
+		notAfterAfter    string
+		notAfterBefore   string
+		minKeyBits       int
+		maxKeyBits       int
+		keyAlgorithm     string
+		excludeExpired   bool
+		excludeNotYet    bool
+		validAt          string
+		wildcardOnly     bool
+		hasIPSAN         bool
+		domainIncludes   []string
+		domainExcludes   []string
 		parseErrors      string
 		validationErrors bool
 		skipPrecerts     bool
@@ -157,7 +180,10 @@ func jobSubmitCmd() *cobra.Command {
 		Use:   "submit",
 		Short: "Submit a new job (via YAML or CLI flags)",
 		Long: `You can submit a job by:
-  - providing a YAML/JSON spec with --file,
+  - providing a YAML/JSON spec with --file, optionally layering
+    --overlay files on top (mappings are merged, other values replaced);
+    a file of several "---" separated specs submits them all at once,
+    with the overlays applied to each,
   - using flags,
   - or interactively (--interactive).
 To generate a template: certslurpctl job template`,
@@ -166,23 +192,52 @@ To generate a template: certslurpctl job template`,
 			client := cliClient()
 			var spec job.JobSpec
 
+			if len(overlays) > 0 && file == "" {
+				return fmt.Errorf("--overlay requires --file")
+			}
+
+			var batch []*job.JobSpec
 			switch {
 			case file != "":
-				// YAML/JSON file
-				f, err := os.Open(file)
+				// YAML/JSON file, plus any overlays merged on top of it. A
+				// file of several "---" separated specs submits them all.
+				var docs [][]byte
+				for _, path := range append([]string{file}, overlays...) {
+					data, err := os.ReadFile(path)
+					if err != nil {
+						return err
+					}
+					docs = append(docs, data)
+				}
+				bases, err := job.SplitDocuments(docs[0])
 				if err != nil {
-					return err
+					return fmt.Errorf("read spec %s: %w", file, err)
 				}
-				defer f.Close()
-				dec := yaml.NewDecoder(f)
-				if err := dec.Decode(&spec); err != nil {
-					// Try JSON fallback
-					f.Seek(0, io.SeekStart)
-					jdec := json.NewDecoder(f)
-					if jerr := jdec.Decode(&spec); jerr != nil {
-						return fmt.Errorf("decode spec %s: YAML error: %v; JSON error: %v", file, err, jerr)
+				if len(bases) == 0 {
+					return fmt.Errorf("spec %s is empty", file)
+				}
+				// Dry runs are for checking specs, so reject unknown fields unless told otherwise
+				if dryRun && !cmd.Flags().Changed("strict") {
+					strict = true
+				}
+				for i, data := range bases {
+					if len(overlays) > 0 {
+						if data, err = job.Merge(data, docs[1:]...); err != nil {
+							return fmt.Errorf("merge spec %s: %w", specName(file, i, len(bases)), err)
+						}
+					}
+					decoded, err := job.Decode(data, strict)
+					if err != nil {
+						return fmt.Errorf("decode spec %s: %w", specName(file, i, len(bases)), err)
 					}
+					if expandEnv || strictEnv {
+						if err := decoded.ExpandEnv(strictEnv); err != nil {
+							return fmt.Errorf("expand spec %s: %w", specName(file, i, len(bases)), err)
+						}
+					}
+					batch = append(batch, decoded)
 				}
+				spec = *batch[0]
 			case interactive:
 				spec = job.JobSpec{}
 				if err := promptForJobSpec(&spec); err != nil {
@@ -196,6 +251,7 @@ To generate a template: certslurpctl job template`,
 				spec.Options.Fetch.IndexStart = indexStart
 				spec.Options.Fetch.IndexEnd = indexEnd
 				spec.Options.Fetch.ShardSize = shardSize
+				spec.Options.Fetch.ShardAlignment = shardAlign
 				spec.Options.Fetch.FetchSize = fetchSize
 				spec.Options.Fetch.FetchWorkers = fetchWorkers
 
@@ -203,8 +259,36 @@ To generate a template: certslurpctl job template`,
 				spec.Options.Match.IssuerRegex = issuerRegex
 				spec.Options.Match.Serial = serial
 				spec.Options.Match.SCTTimestamp = sctTimestamp
-				spec.Options.Match.DomainInclude = domainInclude
-				spec.Options.Match.DomainExclude = domainInclude
+				for _, ts := range []struct {
+					flag, value string
+					dst         *time.Time
+				}{
+					{"log-timestamp-from", logTSFrom, &spec.Options.Match.LogTimestampFrom},
+					{"log-timestamp-to", logTSTo, &spec.Options.Match.LogTimestampTo},
+					{"not-before-after", notBeforeAfter, &spec.Options.Match.NotBeforeAfter},
+					{"not-before-before", notBeforeBefore, &spec.Options.Match.NotBeforeBefore},
+					{"not-after-after", notAfterAfter, &spec.Options.Match.NotAfterAfter},
+					{"not-after-before", notAfterBefore, &spec.Options.Match.NotAfterBefore},
+					{"valid-at", validAt, &spec.Options.Match.ValidAt},
+				} {
+					if ts.value == "" {
+						continue
+					}
+					t, err := time.Parse(time.RFC3339, ts.value)
+					if err != nil {
+						return fmt.Errorf("%s invalid (%q): %w", ts.flag, ts.value, err)
+					}
+					*ts.dst = t
+				}
+				spec.Options.Match.MinKeyBits = minKeyBits
+				spec.Options.Match.MaxKeyBits = maxKeyBits
+				spec.Options.Match.KeyAlgorithm = keyAlgorithm
+				spec.Options.Match.ExcludeExpired = excludeExpired
+				spec.Options.Match.ExcludeNotYetValid = excludeNotYet
+				spec.Options.Match.WildcardOnly = wildcardOnly
+				spec.Options.Match.HasIPSAN = hasIPSAN
+				spec.Options.Match.DomainIncludes = domainIncludes
+				spec.Options.Match.DomainExcludes = domainExcludes
 				spec.Options.Match.ParseErrors = parseErrors
 				spec.Options.Match.ValidationErrors = validationErrors
 				spec.Options.Match.SkipPrecerts = skipPrecerts
@@ -237,6 +321,19 @@ To generate a template: certslurpctl job template`,
 				spec.Options.Output.SinkOptions = sinkOpts
 			}
 
+			// --priority applies however the spec was given
+			if cmd.Flags().Changed("priority") {
+				spec.Priority = priority
+			}
+			if len(batch) > 1 {
+				for _, s := range batch {
+					if cmd.Flags().Changed("priority") {
+						s.Priority = priority
+					}
+				}
+				return submitJobBatch(ctx, client, file, batch, dryRun)
+			}
+
 			if err := spec.Validate(); err != nil {
 				return fmt.Errorf("job spec validation failed: %w", err)
 			}
@@ -265,7 +362,11 @@ To generate a template: certslurpctl job template`,
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Validate and print job spec without submitting")
 
 	// YAML/JSON input file
-	cmd.Flags().StringVar(&file, "file", "", "Job spec YAML/JSON file")
+	cmd.Flags().StringVar(&file, "file", "", "Job spec YAML/JSON file; several \"---\" separated YAML specs are submitted together")
+	cmd.Flags().StringArrayVar(&overlays, "overlay", nil, "YAML/JSON file merged over --file; repeatable, later overlays win")
+	cmd.Flags().BoolVar(&expandEnv, "expand-env", false, "Expand ${VAR} references in --file from the environment")
+	cmd.Flags().BoolVar(&strictEnv, "strict-env", false, "Like --expand-env, but fail on undefined variables")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Reject unknown fields in --file (default true with --dry-run)")
 
 	// Interactive
 	cmd.Flags().BoolVar(&interactive, "interactive", false, "Prompt for job fields interactively")
@@ -274,11 +375,13 @@ To generate a template: certslurpctl job template`,
 	cmd.Flags().StringVar(&version, "version", "1.0.0", "Job spec version")
 	cmd.Flags().StringVar(&note, "note", "", "Job note")
 	cmd.Flags().StringVar(&logURI, "log-uri", "", "CT log URI")
+	cmd.Flags().IntVar(&priority, "priority", 0, "Job priority; workers claim shards of higher priority jobs first")
 
 	// FetchConfig
 	cmd.Flags().Int64Var(&indexStart, "start", 0, "Index start")
 	cmd.Flags().Int64Var(&indexEnd, "end", 0, "Index end (0=auto)")
 	cmd.Flags().IntVar(&shardSize, "shard-size", 0, "Shard size (0=auto)")
+	cmd.Flags().IntVar(&shardAlign, "shard-alignment", 0, "Align shard boundaries to this log page size (0=none)")
 	cmd.Flags().IntVar(&fetchSize, "fetch-size", 10, "Batch fetch size")
 	cmd.Flags().IntVar(&fetchWorkers, "fetch-workers", 1, "Fetch workers per shard")
 
@@ -287,8 +390,22 @@ To generate a template: certslurpctl job template`,
 	cmd.Flags().StringVar(&issuerRegex, "issuer-regex", "", "Issuer regex")
 	cmd.Flags().StringVar(&serial, "serial", "", "Serial number filter")
 	cmd.Flags().Uint64Var(&sctTimestamp, "sct-timestamp", 0, "SCT timestamp")
-	cmd.Flags().StringVar(&domainInclude, "domain-include", "", "Positive match DNS name")
-	cmd.Flags().StringVar(&domainExclude, "domain-exclude", "", "Negative match DNS name")
+	cmd.Flags().StringVar(&logTSFrom, "log-timestamp-from", "", "Match entries logged at or after this RFC3339 time")
+	cmd.Flags().StringVar(&logTSTo, "log-timestamp-to", "", "Match entries logged before this RFC3339 time")
+	cmd.Flags().StringVar(&notBeforeAfter, "not-before-after", "", "Match certs valid from this RFC3339 time or later")
+	cmd.Flags().StringVar(&notBeforeBefore, "not-before-before", "", "Match certs valid from before this RFC3339 time")
+	cmd.Flags().StringVar(&notAfterAfter, "not-after-after", "", "Match certs expiring at or after this RFC3339 time")
+	cmd.Flags().StringVar(&notAfterBefore, "not-after-before", "", "Match certs expiring before this RFC3339 time")
+	cmd.Flags().IntVar(&minKeyBits, "min-key-bits", 0, "Match certs whose public key is at least this many bits")
+	cmd.Flags().IntVar(&maxKeyBits, "max-key-bits", 0, "Match certs whose public key is at most this many bits, e.g. 1024 for weak RSA")
+	cmd.Flags().StringVar(&keyAlgorithm, "key-algorithm", "", "Match certs with this public key algorithm ("+strings.Join(job.KeyAlgorithms, ", ")+")")
+	cmd.Flags().BoolVar(&excludeExpired, "exclude-expired", false, "Skip certs that have expired when fetched (or at --valid-at)")
+	cmd.Flags().BoolVar(&excludeNotYet, "exclude-not-yet-valid", false, "Skip certs not yet valid when fetched (or at --valid-at)")
+	cmd.Flags().StringVar(&validAt, "valid-at", "", "RFC3339 time to judge --exclude-expired/--exclude-not-yet-valid against, instead of fetch time")
+	cmd.Flags().BoolVar(&wildcardOnly, "wildcard-only", false, "Match only certs with a wildcard (*.) DNS name")
+	cmd.Flags().BoolVar(&hasIPSAN, "has-ip-san", false, "Match only certs with an IP address SAN")
+	cmd.Flags().StringSliceVar(&domainIncludes, "domain-include", nil, "Regex a DNS name must match; repeatable or comma-separated, any may match (quote patterns containing commas)")
+	cmd.Flags().StringSliceVar(&domainExcludes, "domain-exclude", nil, "Regex no DNS name may match; repeatable or comma-separated")
 	cmd.Flags().StringVar(&parseErrors, "parse-errors", "", "Parse errors (all/nonfatal)")
 	cmd.Flags().BoolVar(&validationErrors, "validation-errors", false, "Match only certs with validation errors")
 	cmd.Flags().BoolVar(&skipPrecerts, "skip-precerts", false, "Skip precerts")
@@ -308,25 +425,97 @@ To generate a template: certslurpctl job template`,
 	return cmd
 }
 
+// specName names the i'th of n specs read from file in errors.
+func specName(file string, i, n int) string {
+	if n == 1 {
+		return file
+	}
+	return fmt.Sprintf("%s (document %d)", file, i+1)
+}
+
+// submitJobBatch validates every spec read from file and, unless dryRun,
+// submits them together, reporting each one's job ID or error.
+func submitJobBatch(ctx context.Context, client *api.Client, file string, specs []*job.JobSpec, dryRun bool) error {
+	for i, spec := range specs {
+		if err := spec.Validate(); err != nil {
+			return fmt.Errorf("job spec %s validation failed: %w", specName(file, i, len(specs)), err)
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("# %d JobSpecs (YAML preview, not submitted):\n", len(specs))
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		for _, spec := range specs {
+			if err := enc.Encode(spec); err != nil {
+				return fmt.Errorf("error encoding YAML: %w", err)
+			}
+		}
+		return enc.Close()
+	}
+
+	results, err := client.SubmitJobs(ctx, specs)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for i, r := range results {
+		if r.Error != "" {
+			failed++
+			fmt.Fprintf(os.Stderr, "Job %s not submitted: %s\n", specName(file, i, len(specs)), r.Error)
+			continue
+		}
+		fmt.Printf("Job submitted: %s\n", r.JobID)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs not submitted", failed, len(specs))
+	}
+	return nil
+}
+
 func jobListCmd() *cobra.Command {
-	return &cobra.Command{
+	var (
+		status, cursor string
+		limit          int
+	)
+	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all jobs",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
 			client := cliClient()
-			jobs, err := client.ListJobs(ctx)
+			if status == "" && cursor == "" && limit == 0 {
+				jobs, err := client.ListJobs(ctx)
+				if err != nil {
+					return err
+				}
+				outResult(jobs, printJobsTable)
+				return nil
+			}
+			page, err := client.ListJobsFiltered(ctx, cluster.JobListOptions{
+				Limit:  limit,
+				Cursor: cursor,
+				Status: cluster.JobState(status),
+			})
 			if err != nil {
 				return err
 			}
-			outResult(jobs, printJobsTable)
+			outResult(page.Jobs, printJobsTable)
+			if page.NextCursor != "" {
+				fmt.Fprintf(os.Stderr, "more jobs: rerun with --cursor %s\n", page.NextCursor)
+			}
 			return nil
 		},
 	}
+	cmd.Flags().StringVar(&status, "status", "", "Only list jobs in this status (pending, running, paused, completed, cancelled, failed)")
+	cmd.Flags().IntVar(&limit, "limit", 0, "List at most this many jobs (0 = all)")
+	cmd.Flags().StringVar(&cursor, "cursor", "", "List jobs after this job ID, as printed by a previous --limit listing")
+	return cmd
 }
 
 func jobStatusCmd() *cobra.Command {
-	return &cobra.Command{
+	var follow bool
+	cmd := &cobra.Command{
 		Use:   "status <jobID>",
 		Short: "Show job status",
 		Args:  cobra.ExactArgs(1),
@@ -337,7 +526,87 @@ func jobStatusCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			outResult(info, printJobStatusTable)
+			status := jobStatus{JobInfo: info}
+			if status.Progress, err = client.GetJobProgress(ctx, args[0]); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: job progress unavailable: %v\n", err)
+			}
+			outResult(status, printJobStatusTable)
+			if follow {
+				return followJob(ctx, client, args[0])
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep printing job and shard changes until the job finishes")
+	return cmd
+}
+
+// followJob prints changes to the job as they happen, until it finishes.
+// Shard progress checkpoints are left out of the table output, as busy
+// jobs write them constantly.
+func followJob(ctx context.Context, client *api.Client, jobID string) error {
+	events, err := client.WatchJob(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	var last cluster.JobState
+	for ev := range events {
+		if outputJSON {
+			b, _ := json.Marshal(ev)
+			fmt.Println(string(b))
+		} else {
+			printJobEvent(ev)
+		}
+		if ev.Field == "status" && ev.ShardID == nil && !ev.Deleted {
+			last = ev.Status
+		}
+	}
+	if !last.Terminal() {
+		return fmt.Errorf("event stream for job %s ended before the job finished", jobID)
+	}
+	return nil
+}
+
+func printJobEvent(ev cluster.JobEvent) {
+	if ev.Field == "progress" || ev.Field == "in_progress" {
+		return
+	}
+	change := ev.Field
+	switch {
+	case ev.Deleted:
+		change += " cleared"
+	case ev.Field == "status":
+		change += " " + string(ev.Status)
+	}
+	ts := time.Now().Format("15:04:05")
+	if ev.ShardID != nil {
+		fmt.Printf("%s  shard %d: %s\n", ts, *ev.ShardID, change)
+	} else {
+		fmt.Printf("%s  job: %s\n", ts, change)
+	}
+}
+
+func jobDiffCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff <jobID1> <jobID2>",
+		Short: "Show field-level differences between two job specs",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			client := cliClient()
+			a, err := client.GetJob(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("job %s: %w", args[0], err)
+			}
+			b, err := client.GetJob(ctx, args[1])
+			if err != nil {
+				return fmt.Errorf("job %s: %w", args[1], err)
+			}
+			diffs, err := job.Diff(a.Spec, b.Spec)
+			if err != nil {
+				return err
+			}
+			outResult(diffs, printJobDiffTable)
 			return nil
 		},
 	}
@@ -356,6 +625,87 @@ func jobCancelCmd() *cobra.Command {
 	}
 }
 
+func jobPauseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "pause <jobID>",
+		Short: "Stop workers claiming a job's shards until it's resumed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			client := cliClient()
+			return client.PauseJob(ctx, args[0])
+		},
+	}
+}
+
+func jobResumeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "resume <jobID>",
+		Short: "Resume a paused job",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			client := cliClient()
+			return client.ResumeJob(ctx, args[0])
+		},
+	}
+}
+
+func jobPurgeCmd() *cobra.Command {
+	var olderThan time.Duration
+	cmd := &cobra.Command{
+		Use:   "purge [jobID]",
+		Short: "Delete a finished job and its shards from the cluster",
+		Long: `Deletes a completed, cancelled or failed job and all of its shard state.
+Output already written to sinks is left alone.
+
+With --older-than, every job completed or cancelled longer ago than the given
+duration is purged instead.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			client := cliClient()
+			if len(args) == 1 {
+				if olderThan > 0 {
+					return fmt.Errorf("give a job ID or --older-than, not both")
+				}
+				if err := client.PurgeJob(ctx, args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("Purged job %s\n", args[0])
+				return nil
+			}
+			if olderThan <= 0 {
+				return fmt.Errorf("a job ID or --older-than is required")
+			}
+			jobs, err := client.ListJobs(ctx)
+			if err != nil {
+				return err
+			}
+			cutoff := time.Now().Add(-olderThan)
+			var failed int
+			for _, j := range jobs {
+				finished := j.FinishedAt()
+				if finished.IsZero() || !finished.Before(cutoff) {
+					continue
+				}
+				if err := client.PurgeJob(ctx, j.ID); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to purge job %s: %v\n", j.ID, err)
+					failed++
+					continue
+				}
+				fmt.Printf("Purged job %s (%s %s)\n", j.ID, j.Status, finished.Format(time.RFC3339))
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d jobs could not be purged", failed)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&olderThan, "older-than", 0, "Purge every job completed or cancelled longer ago than this (e.g. 720h)")
+	return cmd
+}
+
 func jobStartCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "start <jobID>",
@@ -439,6 +789,8 @@ func shardCmd() *cobra.Command {
 	cmd.AddCommand(
 		shardStatusCmd(),
 		shardResetCmd(),
+		shardSkipCmd(),
+		shardPreferCmd(),
 	)
 	return cmd
 }
@@ -489,3 +841,74 @@ func shardResetCmd() *cobra.Command {
 		},
 	}
 }
+
+func shardSkipCmd() *cobra.Command {
+	var reason string
+	cmd := &cobra.Command{
+		Use:   "skip <jobID> <shardID>",
+		Short: "Exclude a shard from its job without processing it",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := cliClient()
+			ctx := context.Background()
+			jobID := args[0]
+			var shardID int
+			_, err := fmt.Sscanf(args[1], "%d", &shardID)
+			if err != nil {
+				return fmt.Errorf("invalid shardID: %w", err)
+			}
+			if err := client.SkipShard(ctx, jobID, shardID, reason); err != nil {
+				return err
+			}
+			fmt.Printf("Skipped shard %d for job %s\n", shardID, jobID)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&reason, "reason", "", "Why the shard is being skipped (recorded with the shard)")
+	return cmd
+}
+
+func shardPreferCmd() *cobra.Command {
+	var (
+		grace time.Duration
+		clear bool
+	)
+	cmd := &cobra.Command{
+		Use:   "prefer <jobID> <shardID> [workerID]",
+		Short: "Hint that a worker should claim a shard, e.g. one holding its raw data",
+		Long: `Other workers leave the shard to the preferred worker until the grace
+period has passed, after which any worker may claim it. --clear removes the hint.`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := cliClient()
+			ctx := context.Background()
+			jobID := args[0]
+			var shardID int
+			_, err := fmt.Sscanf(args[1], "%d", &shardID)
+			if err != nil {
+				return fmt.Errorf("invalid shardID: %w", err)
+			}
+			var workerID string
+			switch {
+			case clear && len(args) == 3:
+				return fmt.Errorf("--clear takes no workerID")
+			case !clear && len(args) < 3:
+				return fmt.Errorf("workerID is required unless --clear is given")
+			case !clear:
+				workerID = args[2]
+			}
+			if err := client.SetShardPreferredWorker(ctx, jobID, shardID, workerID, grace); err != nil {
+				return err
+			}
+			if clear {
+				fmt.Printf("Cleared preferred worker of shard %d for job %s\n", shardID, jobID)
+			} else {
+				fmt.Printf("Shard %d for job %s prefers worker %s for %s\n", shardID, jobID, workerID, grace)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&grace, "grace", 10*time.Minute, "How long other workers leave the shard to the preferred one")
+	cmd.Flags().BoolVar(&clear, "clear", false, "Remove the shard's preferred worker hint")
+	return cmd
+}
@@ -48,8 +48,12 @@ func main() {
 		jobTemplateCmd(),
 		jobListCmd(),
 		jobStatusCmd(),
+		jobDiffCmd(),
 		jobStartCmd(),
 		jobCancelCmd(),
+		jobPauseCmd(),
+		jobResumeCmd(),
+		jobPurgeCmd(),
 		jobCompleteCmd(),
 		jobShardsCmd(),
 		jobResetFailedCmd(),
@@ -58,14 +62,27 @@ func main() {
 
 	root.AddCommand(shardCmd())
 
-	// Cluster status
-	root.AddCommand(clusterStatusCmd())
+	// Cluster; bare "cluster" still shows the status, as it did before it had
+	// subcommands
+	clusterStatus := clusterStatusCmd()
+	clusterCmd := &cobra.Command{
+		Use:   "cluster",
+		Short: "Cluster state (status if no subcommand is given)",
+		Args:  cobra.NoArgs,
+		RunE:  clusterStatus.RunE,
+	}
+	clusterCmd.AddCommand(
+		clusterStatus,
+		clusterDumpCmd(),
+	)
+	root.AddCommand(clusterCmd)
 
 	// Workers
 	workers := &cobra.Command{Use: "worker", Short: "Worker nodes"}
 	workers.AddCommand(
 		workerListCmd(),
 		workerMetricsCmd(),
+		workerLogsCmd(),
 	)
 	root.AddCommand(workers)
 
@@ -81,29 +98,21 @@ func main() {
 		gen,
 		secretsPendingCmd(),
 		secretsApprovalCmd(),
+		secretsDenyCmd(),
+		secretsRevokeCmd(),
 		secretsListCmd(),
 		secretsAddCmd(),
 		secretsRemoveCmd(),
 		secretsGetCmd(),
+		secretsHistoryCmd(),
+		secretsRollbackCmd(),
+		secretsRotateCmd(),
+		secretsAuditCmd(),
 	)
 	root.AddCommand(secrets)
 
 	// Completion
-	completion := &cobra.Command{
-		Use:   "completion",
-		Short: "Generate shell completion scripts",
-		Run: func(cmd *cobra.Command, args []string) {
-			root.GenBashCompletion(os.Stdout)
-		},
-	}
-
-	if completion.Annotations == nil {
-		completion.Annotations = map[string]string{}
-	}
-
-	completion.Annotations[noAPICreds] = "1"
-
-	root.AddCommand(completion)
+	root.AddCommand(completionCmd(root))
 
 	_ = root.Execute()
 }
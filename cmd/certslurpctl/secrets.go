@@ -7,7 +7,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/api"
 	"github.com/chtzvt/certslurp/internal/secrets"
@@ -120,6 +122,41 @@ func secretsApprovalCmd() *cobra.Command {
 	return approveCmd
 }
 
+func secretsDenyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "deny <node-id>",
+		Short: "Reject a node's pending registration",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := cliClient()
+			if err := client.DenyNode(context.Background(), args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Registration of node %s denied\n", args[0])
+			return nil
+		},
+	}
+}
+
+func secretsRevokeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke <node-id>",
+		Short: "Revoke an approved node's access to the secret store",
+		Long: `Remove an approved node's sealed cluster key. When it restarts, the node
+registers again and waits for approval. A node that's running still holds
+the cluster key in memory; rotate the key (secrets rotate) to lock it out.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := cliClient()
+			if err := client.RevokeNode(context.Background(), args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Node %s revoked\n", args[0])
+			return nil
+		},
+	}
+}
+
 func secretsListCmd() *cobra.Command {
 	var prefix string
 	cmd := &cobra.Command{
@@ -194,6 +231,7 @@ func secretsRemoveCmd() *cobra.Command {
 }
 
 func secretsGetCmd() *cobra.Command {
+	var version int
 	getCmd := &cobra.Command{
 		Use:   "get <key>",
 		Short: "Get (decrypted) secret value",
@@ -210,7 +248,12 @@ func secretsGetCmd() *cobra.Command {
 
 			client := cliClient()
 			ctx := context.Background()
-			ciphertext, err := client.GetSecret(ctx, args[0])
+			var ciphertext []byte
+			if version > 0 {
+				ciphertext, err = client.GetSecretVersion(ctx, args[0], version)
+			} else {
+				ciphertext, err = client.GetSecret(ctx, args[0])
+			}
 			if err != nil {
 				return err
 			}
@@ -227,6 +270,129 @@ func secretsGetCmd() *cobra.Command {
 			return nil
 		},
 	}
+	getCmd.Flags().IntVar(&version, "version", 0, "Get this version from the secret's history instead of the current value")
 
 	return getCmd
 }
+
+func secretsHistoryCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "history <key>",
+		Short: "List a secret's versions",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := cliClient()
+			versions, err := client.ListSecretVersions(context.Background(), args[0])
+			if err != nil {
+				return err
+			}
+			outResult(versions, printSecretVersionsTable)
+			return nil
+		},
+	}
+}
+
+func secretsRollbackCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rollback <key> <version>",
+		Short: "Make an earlier version of a secret current",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid version %q", args[1])
+			}
+			client := cliClient()
+			if err := client.RollbackSecret(context.Background(), args[0], version); err != nil {
+				return err
+			}
+			fmt.Printf("Secret %q rolled back to version %d\n", args[0], version)
+			return nil
+		},
+	}
+}
+
+func secretsRotateCmd() *cobra.Command {
+	var newKeyFile string
+	cmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Rotate the cluster key, re-encrypting all secrets",
+		Long: `Replace the cluster key. The head node re-encrypts every secret under the
+new key and seals it for each approved node.
+
+The new key is read from --new-key-file if it exists. Otherwise a new key is
+generated and written there, or printed if no file is given. Afterwards,
+update the cluster key in the head node's configuration and restart the
+workers so they load the new key.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var newKey [32]byte
+			if _, err := os.Stat(newKeyFile); newKeyFile != "" && err == nil {
+				if newKey, err = loadClusterKey(newKeyFile, ""); err != nil {
+					return fmt.Errorf("failed to load new cluster key: %w", err)
+				}
+			} else {
+				if newKey, err = secrets.GenerateClusterKey(); err != nil {
+					return fmt.Errorf("failed to generate key: %w", err)
+				}
+				encodedKey := base64.StdEncoding.EncodeToString(newKey[:])
+				if newKeyFile == "" {
+					fmt.Printf("New cluster key: %s\n", encodedKey)
+				} else {
+					// Written before rotating so the key can't be lost
+					if err := os.MkdirAll(filepath.Dir(newKeyFile), 0o700); err != nil {
+						return fmt.Errorf("failed to create key directory: %w", err)
+					}
+					if err := os.WriteFile(newKeyFile, []byte(encodedKey+"\n"), 0o600); err != nil {
+						return fmt.Errorf("failed to write key file: %w", err)
+					}
+					fmt.Printf("New cluster key written to %s\n", newKeyFile)
+				}
+			}
+
+			client := cliClient()
+			result, err := client.RotateClusterKey(context.Background(), newKey)
+			if err != nil {
+				return err
+			}
+			outResult(result, func(any) {
+				fmt.Printf("Re-encrypted %d secrets; resealed the cluster key for %d nodes\n", result.Secrets, len(result.Resealed))
+				for _, nodeID := range result.Dropped {
+					fmt.Printf("Node %s has no public key on record and must register again\n", nodeID)
+				}
+			})
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&newKeyFile, "new-key-file", "", "File to read the new cluster key from, or write a generated one to")
+	return cmd
+}
+
+func secretsAuditCmd() *cobra.Command {
+	var key, since string
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Show the secret store's audit log",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var sinceTime time.Time
+			if since != "" {
+				t, err := time.Parse(time.RFC3339, since)
+				if err != nil {
+					return fmt.Errorf("invalid --since: %w", err)
+				}
+				sinceTime = t
+			}
+			client := cliClient()
+			entries, err := client.ListSecretAudit(context.Background(), key, sinceTime, limit)
+			if err != nil {
+				return err
+			}
+			outResult(entries, printSecretAuditTable)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&key, "key", "", "Only show operations on this secret (or node, for approvals)")
+	cmd.Flags().StringVar(&since, "since", "", "Only show operations at or after this RFC3339 time")
+	cmd.Flags().IntVar(&limit, "limit", 0, "Show at most this many operations, oldest first (default: the server's, 1000)")
+	return cmd
+}
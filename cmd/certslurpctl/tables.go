@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/api"
 	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/job"
 	"github.com/chtzvt/certslurp/internal/secrets"
 	"github.com/olekukonko/tablewriter"
 )
@@ -38,13 +41,22 @@ func printJobsTable(data any) {
 	table.Render()
 }
 
+// jobStatus is what `job status` shows: the job and its shards' progress.
+type jobStatus struct {
+	*cluster.JobInfo
+	Progress *cluster.JobProgress `json:"progress,omitempty"`
+}
+
 func printJobStatusTable(data any) {
 	var job cluster.JobInfo
+	var progress *cluster.JobProgress
 	switch jt := data.(type) {
 	case cluster.JobInfo:
 		job = jt
 	case *cluster.JobInfo:
 		job = *jt
+	case jobStatus:
+		job, progress = *jt.JobInfo, jt.Progress
 	default:
 		fmt.Println("No job info")
 		return
@@ -58,7 +70,42 @@ func printJobStatusTable(data any) {
 	table.Append([]string{"Started", valOrDash(job.Started)})
 	table.Append([]string{"Completed", valOrDash(job.Completed)})
 	table.Append([]string{"Cancelled", valOrDash(job.Cancelled)})
+	table.Append([]string{"Priority", fmt.Sprintf("%d", job.Spec.Priority)})
 	table.Append([]string{"Note", job.Spec.Note})
+	if p := progress; p != nil {
+		table.Append([]string{"Progress", fmt.Sprintf("%.1f%% (%d of %d entries)", p.Percent(), p.IndexProcessed, p.IndexTotal)})
+		table.Append([]string{"Shard States", fmt.Sprintf("%d total: %d done, %d assigned, %d pending, %d in backoff, %d failed, %d skipped",
+			p.Shards, p.Done, p.Assigned, p.Pending, p.Backoff, p.Failed, p.Skipped)})
+	}
+	if sum := job.Summary; sum != nil {
+		table.Append([]string{"Shards", fmt.Sprintf("%d (%d done, %d failed, %d skipped)", sum.Shards, sum.ShardsDone, sum.ShardsFailed, sum.ShardsSkipped)})
+		table.Append([]string{"Records", fmt.Sprintf("%d", sum.Records)})
+		table.Append([]string{"Bytes", fmt.Sprintf("%d", sum.Bytes)})
+		table.Append([]string{"Chunks", fmt.Sprintf("%d", sum.Chunks)})
+		table.Append([]string{"Dead Lettered", fmt.Sprintf("%d", sum.DeadLettered)})
+		table.Append([]string{"Duration", time.Duration(sum.DurationNs).Round(time.Second).String()})
+		table.Append([]string{"Shard Time", time.Duration(sum.ProcessingTimeNs).Round(time.Second).String()})
+	}
+	table.Render()
+}
+
+func printJobDiffTable(data any) {
+	diffs, ok := data.([]job.FieldDiff)
+	if !ok || len(diffs) == 0 {
+		fmt.Println("Job specs are identical")
+		return
+	}
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Field", "Job 1", "Job 2"})
+	for _, d := range diffs {
+		table.Append([]string{d.Path, orDash(d.A), orDash(d.B)})
+	}
 	table.Render()
 }
 
@@ -75,7 +122,7 @@ func printWorkersTable(data any) {
 
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{
-		"ID", "Host", "Last Seen", "Shards Processed", "Shards Failed", "Processing Time (s)", "Last Updated",
+		"ID", "Host", "Last Seen", "Shards Processed", "Shards Failed", "Processing Time (s)", "Last Updated", "Current Shards",
 	})
 	for _, w := range workers {
 		procTimeSec := float64(w.ProcessingTimeNs) / 1e9
@@ -87,11 +134,35 @@ func printWorkersTable(data any) {
 			fmt.Sprintf("%d", w.ShardsFailed),
 			fmt.Sprintf("%.2f", procTimeSec),
 			w.LastUpdated.Format("2006-01-02 15:04:05"),
+			formatWorkerActivity(w.Activity),
 		})
 	}
 	table.Render()
 }
 
+// formatWorkerActivity renders each shard as job/shard followed by entries
+// processed out of the shard's index range.
+func formatWorkerActivity(activity []cluster.ShardActivity) string {
+	if len(activity) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(activity))
+	for i, a := range activity {
+		parts[i] = fmt.Sprintf("%s/%d (%d/%d)", a.JobID, a.ShardID, a.Processed, a.IndexTo-a.IndexFrom)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// formatShardProgress renders how far through its index range a shard's
+// worker has reported getting, or "-" if it hasn't reported any progress.
+func formatShardProgress(from, to int64, last *int64) string {
+	if last == nil || to <= from {
+		return "-"
+	}
+	pct := float64(*last+1-from) / float64(to-from) * 100
+	return fmt.Sprintf("%.1f%%", max(0, min(pct, 100)))
+}
+
 func printWorkerMetricsTable(data any) {
 	m, ok := data.(*cluster.WorkerMetricsView)
 	if !ok || m == nil {
@@ -99,12 +170,13 @@ func printWorkerMetricsTable(data any) {
 		return
 	}
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Worker ID", "Shards Processed", "Shards Failed", "Processing Time (s)", "Last Updated"})
+	table.SetHeader([]string{"Worker ID", "Shards Processed", "Shards Failed", "Processing Time (s)", "Active Uploads", "Last Updated"})
 	table.Append([]string{
 		m.WorkerID,
 		fmt.Sprintf("%d", m.ShardsProcessed),
 		fmt.Sprintf("%d", m.ShardsFailed),
 		fmt.Sprintf("%.2f", float64(m.ProcessingTimeNs)/1e9),
+		fmt.Sprintf("%d", m.ActiveUploads),
 		m.LastUpdated.Format("2006-01-02 15:04:05"),
 	})
 	table.Render()
@@ -124,7 +196,7 @@ func printShardsTable(data any) {
 	sort.Ints(ids)
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{
-		"Shard ID", "Worker ID", "Assigned", "Done", "Failed", "Lease Expiry", "Retries", "Backoff", "Idx From", "Idx To",
+		"Shard ID", "Worker ID", "Assigned", "Done", "Failed", "Skipped", "Lease Expiry", "Retries", "Backoff", "Idx From", "Idx To", "Progress",
 	})
 	for _, id := range ids {
 		s := shards[id]
@@ -134,11 +206,13 @@ func printShardsTable(data any) {
 			fmt.Sprintf("%v", s.Assigned),
 			fmt.Sprintf("%v", s.Done),
 			fmt.Sprintf("%v", s.Failed),
+			fmt.Sprintf("%v", s.Skipped),
 			valOrDash(s.LeaseExpiry),
 			fmt.Sprintf("%d", s.Retries),
 			valOrDash(s.BackoffUntil),
 			fmt.Sprintf("%d", s.IndexFrom),
 			fmt.Sprintf("%d", s.IndexTo),
+			formatShardProgress(s.IndexFrom, s.IndexTo, s.LastIndex),
 		})
 	}
 	table.Render()
@@ -156,11 +230,16 @@ func printShardStatusTable(data any) {
 	table.Append([]string{"Assigned", fmt.Sprintf("%v", status.Assigned)})
 	table.Append([]string{"Done", fmt.Sprintf("%v", status.Done)})
 	table.Append([]string{"Failed", fmt.Sprintf("%v", status.Failed)})
+	table.Append([]string{"Skipped", fmt.Sprintf("%v", status.Skipped)})
+	if status.Skipped && status.SkipReason != "" {
+		table.Append([]string{"Skip Reason", status.SkipReason})
+	}
 	table.Append([]string{"Lease Expiry", valOrDash(status.LeaseExpiry)})
 	table.Append([]string{"Retries", fmt.Sprintf("%d", status.Retries)})
 	table.Append([]string{"Backoff", valOrDash(status.BackoffUntil)})
 	table.Append([]string{"Index From", fmt.Sprintf("%d", status.IndexFrom)})
 	table.Append([]string{"Index To", fmt.Sprintf("%d", status.IndexTo)})
+	table.Append([]string{"Progress", formatShardProgress(status.IndexFrom, status.IndexTo, status.LastIndex)})
 	table.Render()
 }
 
@@ -178,6 +257,42 @@ func printSecretsTable(data any) {
 	table.Render()
 }
 
+func printSecretVersionsTable(data any) {
+	versions, ok := data.([]secrets.SecretVersion)
+	if !ok || len(versions) == 0 {
+		fmt.Println("No versions found")
+		return
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Version", "Current"})
+	for _, v := range versions {
+		current := ""
+		if v.Current {
+			current = "*"
+		}
+		table.Append([]string{fmt.Sprintf("%d", v.Version), current})
+	}
+	table.Render()
+}
+
+func printSecretAuditTable(data any) {
+	entries, ok := data.([]secrets.AuditEntry)
+	if !ok || len(entries) == 0 {
+		fmt.Println("No audit entries found")
+		return
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Time", "Operation", "Key", "Version", "Token", "Remote", "Error"})
+	for _, e := range entries {
+		version := "-"
+		if e.Version > 0 {
+			version = fmt.Sprintf("%d", e.Version)
+		}
+		table.Append([]string{valOrDash(e.Time), e.Operation, e.Key, version, e.TokenID, e.Remote, e.Error})
+	}
+	table.Render()
+}
+
 func printClusterStatusTable(data any) {
 	status, ok := data.(*cluster.ClusterStatus)
 	if !ok || status == nil {
@@ -2,7 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
 
+	"github.com/chtzvt/certslurp/internal/worker"
 	"github.com/spf13/cobra"
 )
 
@@ -40,3 +46,82 @@ func workerMetricsCmd() *cobra.Command {
 		},
 	}
 }
+
+func workerLogsCmd() *cobra.Command {
+	var lines int
+	cmd := &cobra.Command{
+		Use:   "logs <workerID>",
+		Short: "Show recent log lines from a worker (requires worker.logs.enabled)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			client := cliClient()
+			workers, err := client.ListWorkers(ctx)
+			if err != nil {
+				return err
+			}
+			var endpoint string
+			found := false
+			for _, w := range workers {
+				if w.ID == args[0] {
+					endpoint, found = w.LogEndpoint, true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("worker %s not found", args[0])
+			}
+			if endpoint == "" {
+				return fmt.Errorf("worker %s does not expose a log endpoint", args[0])
+			}
+			logLines, err := fetchWorkerLogs(ctx, endpoint, lines)
+			if err != nil {
+				return err
+			}
+			outResult(logLines, printWorkerLogs)
+			return nil
+		},
+	}
+	cmd.Flags().IntVarP(&lines, "lines", "n", 100, "Number of recent lines to show (0 for all buffered)")
+	return cmd
+}
+
+func fetchWorkerLogs(ctx context.Context, endpoint string, n int) ([]worker.LogLine, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log endpoint %q: %w", endpoint, err)
+	}
+	q := u.Query()
+	q.Set("n", strconv.Itoa(n))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("log endpoint returned %s", resp.Status)
+	}
+	var lines []worker.LogLine
+	if err := json.NewDecoder(resp.Body).Decode(&lines); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func printWorkerLogs(data any) {
+	lines, ok := data.([]worker.LogLine)
+	if !ok || len(lines) == 0 {
+		fmt.Println("No log lines buffered")
+		return
+	}
+	for _, l := range lines {
+		fmt.Println(l.Line)
+	}
+}
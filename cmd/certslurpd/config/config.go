@@ -11,9 +11,41 @@ type NodeConfig struct {
 }
 
 type WorkerConfig struct {
-	Parallelism int           `mapstructure:"parallelism"`
-	BatchSize   int           `mapstructure:"batch_size"`
-	PollPeriod  time.Duration `mapstructure:"poll_period"`
+	Parallelism          int              `mapstructure:"parallelism"`
+	BatchSize            int              `mapstructure:"batch_size"`
+	PollPeriod           time.Duration    `mapstructure:"poll_period"`
+	ShutdownTimeout      time.Duration    `mapstructure:"shutdown_timeout"`
+	MaxConcurrentUploads int              `mapstructure:"max_concurrent_uploads"` // across all shards; 0 is unlimited
+	Logs                 WorkerLogsConfig `mapstructure:"logs"`
+}
+
+// WorkerLogsConfig controls the optional endpoint serving a worker's recent
+// log lines. It is off by default since logs may reveal job details.
+type WorkerLogsConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	ListenAddr string `mapstructure:"listen_addr"`
+	// AdvertiseURL is the base URL registered in the cluster for
+	// `certslurpctl worker logs`. Derived from ListenAddr when empty.
+	AdvertiseURL string `mapstructure:"advertise_url"`
+	BufferLines  int    `mapstructure:"buffer_lines"`
+}
+
+// HeadConfig holds settings that only apply to head nodes.
+type HeadConfig struct {
+	// JobRetention is how long completed and cancelled jobs are kept in the
+	// cluster before the head purges them. 0 keeps them forever.
+	JobRetention time.Duration `mapstructure:"job_retention"`
+}
+
+const (
+	BackendEtcd   = "etcd"
+	BackendMemory = "memory"
+)
+
+type BackendConfig struct {
+	// Backend selects the cluster implementation: "etcd" (default) or
+	// "memory" for a single-process dev cluster held in memory, with no etcd.
+	Backend string `mapstructure:"backend"`
 }
 
 type EtcdConfig struct {
@@ -21,16 +53,24 @@ type EtcdConfig struct {
 	Username  string   `mapstructure:"username"`
 	Password  string   `mapstructure:"password"`
 	Prefix    string   `mapstructure:"prefix"`
+	// MetricsEncoding stores worker records and metrics as "json" (default)
+	// or compact "cbor".
+	MetricsEncoding string `mapstructure:"metrics_encoding"`
 }
 
 type SecretsConfig struct {
 	KeychainFile string `mapstructure:"keychain_file"`
 	ClusterKey   string `mapstructure:"cluster_key"`
+	// AuditRetention is how long the secret store's audit entries are kept
+	// (default 90 days); a negative value keeps them for good.
+	AuditRetention time.Duration `mapstructure:"audit_retention"`
 }
 
 type ClusterConfig struct {
 	Node    NodeConfig    `mapstructure:"node"`
 	Worker  WorkerConfig  `mapstructure:worker`
+	Head    HeadConfig    `mapstructure:"head"`
+	Cluster BackendConfig `mapstructure:"cluster"`
 	Api     api.Config    `mapstructure:"api"`
 	Etcd    EtcdConfig    `mapstructure:"etcd"`
 	Secrets SecretsConfig `mapstructure:"secrets"`
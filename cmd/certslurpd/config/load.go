@@ -7,6 +7,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/chtzvt/certslurp/internal/api"
+	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/secrets"
 	"github.com/spf13/viper"
 
 	"github.com/moby/moby/pkg/namesgenerator"
@@ -29,22 +32,53 @@ func LoadConfig(cfgFile string) (*ClusterConfig, error) {
 	viper.SetDefault("worker.parallelism", 4)
 	viper.SetDefault("worker.batch_size", 8)
 	viper.SetDefault("worker.poll_period", 5*time.Second)
+	viper.SetDefault("worker.shutdown_timeout", 2*time.Minute)
+	viper.SetDefault("worker.max_concurrent_uploads", 0)
+	viper.SetDefault("worker.logs.enabled", false)
+	viper.SetDefault("worker.logs.listen_addr", "127.0.0.1:8990")
+	viper.SetDefault("worker.logs.buffer_lines", 500)
+	viper.SetDefault("head.job_retention", 0)
+	viper.SetDefault("cluster.backend", BackendEtcd)
 	viper.SetDefault("etcd.prefix", "/certslurp")
+	viper.SetDefault("etcd.metrics_encoding", cluster.MetricsEncodingJSON)
 	viper.SetDefault("api.listen_addr", ":8989")
+	viper.SetDefault("api.output_reads.enabled", false)
+	viper.SetDefault("api.output_reads.max_bytes", api.DefaultOutputReadMaxBytes)
+	viper.SetDefault("api.request_timeout", api.DefaultRequestTimeout)
 	viper.SetDefault("secrets.keychain_file", "")
+	viper.SetDefault("secrets.audit_retention", secrets.DefaultAuditRetention)
 
 	viper.BindEnv("node.id")
 	viper.BindEnv("worker.parallelism")
 	viper.BindEnv("worker.batch_size")
 	viper.BindEnv("worker.poll_period")
+	viper.BindEnv("worker.shutdown_timeout")
+	viper.BindEnv("worker.max_concurrent_uploads")
+	viper.BindEnv("worker.logs.enabled")
+	viper.BindEnv("worker.logs.listen_addr")
+	viper.BindEnv("worker.logs.advertise_url")
+	viper.BindEnv("worker.logs.buffer_lines")
+	viper.BindEnv("head.job_retention")
+	viper.BindEnv("cluster.backend")
 	viper.BindEnv("etcd.endpoints")
 	viper.BindEnv("etcd.username")
 	viper.BindEnv("etcd.password")
 	viper.BindEnv("etcd.prefix")
+	viper.BindEnv("etcd.metrics_encoding")
 	viper.BindEnv("secrets.keychain_file")
 	viper.BindEnv("secrets.cluster_key")
+	viper.BindEnv("secrets.audit_retention")
 	viper.BindEnv("api.listen_addr")
 	viper.BindEnv("api.auth_tokens")
+	viper.BindEnv("api.output_reads.enabled")
+	viper.BindEnv("api.output_reads.tokens")
+	viper.BindEnv("api.output_reads.max_bytes")
+	viper.BindEnv("api.request_timeout")
+	viper.BindEnv("api.access_log.enabled")
+	viper.BindEnv("api.access_log.skip_paths")
+	viper.BindEnv("api.rate_limit.enabled")
+	viper.BindEnv("api.rate_limit.rate")
+	viper.BindEnv("api.rate_limit.burst")
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -62,6 +96,15 @@ func LoadConfig(cfgFile string) (*ClusterConfig, error) {
 		return nil, fmt.Errorf("genrate name: %w", err)
 	}
 
+	switch cfg.Cluster.Backend {
+	case "", BackendEtcd, BackendMemory:
+	default:
+		return nil, fmt.Errorf("unknown cluster backend %q", cfg.Cluster.Backend)
+	}
+	if err := cluster.ValidateMetricsEncoding(cfg.Etcd.MetricsEncoding); err != nil {
+		return nil, err
+	}
+
 	if cfg.Node.ID == "" {
 		cfg.Node.ID = fmt.Sprintf("%s%03d", namesgenerator.GetRandomName(0), discriminator)
 	}
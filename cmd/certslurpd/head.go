@@ -10,6 +10,7 @@ import (
 	"github.com/chtzvt/certslurp/cmd/certslurpd/config"
 	"github.com/chtzvt/certslurp/internal/api"
 	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/worker"
 	"github.com/spf13/cobra"
 )
 
@@ -47,14 +48,51 @@ func runHead(cfg *config.ClusterConfig) error {
 	}
 
 	go headMonitorLoop(ctx, cl, 30*time.Second, logger)
+	if cfg.Head.JobRetention > 0 {
+		go jobReaperLoop(ctx, cl, cfg.Head.JobRetention, time.Hour, logger)
+	}
+
+	if cfg.Cluster.Backend == config.BackendMemory {
+		// Nothing outside this process can reach a memory cluster, so
+		// run a worker alongside the head.
+		w := worker.NewWorker(cl, cfg.Node.ID+"-worker", log.New(os.Stdout, "[worker] ", log.LstdFlags))
+		w.MaxParallel = cfg.Worker.Parallelism
+		w.BatchSize = cfg.Worker.BatchSize
+		w.PollPeriod = cfg.Worker.PollPeriod
+		w.ShutdownTimeout = cfg.Worker.ShutdownTimeout
+		go func() {
+			if err := w.Run(ctx); err != nil && err != context.Canceled {
+				logger.Printf("in-process worker exited: %v", err)
+			}
+		}()
+	}
 
 	logger.Printf("Starting API server on %s", cfg.Api.ListenAddr)
 	return apiServer.Start(ctx)
 }
 
+// jobReaperLoop purges jobs that were completed or cancelled more than
+// retention ago, checking every interval.
+func jobReaperLoop(ctx context.Context, cl cluster.Cluster, retention, interval time.Duration, logger *log.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval + jitterDuration()):
+			purged, err := cluster.PurgeFinishedJobs(ctx, cl, time.Now().Add(-retention))
+			for _, id := range purged {
+				logger.Printf("Purged job %s, finished more than %s ago", id, retention)
+			}
+			if err != nil {
+				logger.Printf("Error purging old jobs: %v", err)
+			}
+		}
+	}
+}
+
 func isShardEffectivelyDone(shard cluster.ShardAssignmentStatus) bool {
 	// A shard is considered "done" if:
-	//   - It's marked Done,
+	//   - It's marked Done (which includes skipped shards),
 	//   - Or, it's permanently failed
 	return shard.Done || shard.Failed
 }
@@ -88,6 +126,7 @@ func headMonitorLoop(ctx context.Context, cl cluster.Cluster, pollInterval time.
 					continue
 				}
 
+				maxRetries, _ := cluster.ShardRetryPolicy(job.Spec)
 				allDone := true
 				hasPermanentFailure := false
 				hasAssignedShard := false
@@ -101,7 +140,7 @@ func headMonitorLoop(ctx context.Context, cl cluster.Cluster, pollInterval time.
 						allDone = false
 						incompleteShards++
 					}
-					if !shard.Failed && shard.Retries >= cluster.MaxShardRetries {
+					if !shard.Failed && shard.Retries >= maxRetries {
 						hasPermanentFailure = true
 					}
 				}
@@ -125,6 +164,9 @@ func headMonitorLoop(ctx context.Context, cl cluster.Cluster, pollInterval time.
 						}
 					}
 					continue
+				case cluster.JobStatePaused:
+					// Left as is until resumed, even once its shards are done
+					continue
 				case cluster.JobStatePending:
 					if hasAssignedShard {
 						logger.Printf("Job %s is pending but active assigned shards; marking as running", job.ID)
@@ -137,6 +179,11 @@ func headMonitorLoop(ctx context.Context, cl cluster.Cluster, pollInterval time.
 
 				if allDone {
 					maybeSleep()
+					// Write the manifest first, so that a failure is retried on the next pass
+					if err := worker.FinalizeJob(ctx, cl, job.ID); err != nil {
+						logger.Printf("Failed to write manifest for job %s: %v", job.ID, err)
+						continue
+					}
 					if err := cl.MarkJobCompleted(ctx, job.ID); err != nil {
 						logger.Printf("Failed to mark job %s completed: %v", job.ID, err)
 					} else {
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chtzvt/certslurp/cmd/certslurpd/config"
+	"github.com/chtzvt/certslurp/internal/compression"
+	"github.com/chtzvt/certslurp/internal/etl"
+	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+var redriveCmd = &cobra.Command{
+	Use:   "redrive",
+	Short: "Reprocess dead-lettered entries through a job's pipeline",
+	Long: `Reads dead-lettered raw log entries and runs them back through the
+job's extractor, transformer and sink. Use after fixing whatever made the
+entries fail; entries that fail again are dead-lettered anew.
+
+--source is a dead-letter file, or a directory whose *.deadletter* files are
+all redriven. The job spec comes from the cluster (--job) or a local file
+(--job-file).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source, _ := cmd.Flags().GetString("source")
+		jobID, _ := cmd.Flags().GetString("job")
+		jobFile, _ := cmd.Flags().GetString("job-file")
+		comp, _ := cmd.Flags().GetString("compression")
+		if (jobID == "") == (jobFile == "") {
+			return fmt.Errorf("exactly one of --job or --job-file is required")
+		}
+
+		cfg, err := config.LoadConfig(cfgFile)
+		if err != nil {
+			return fmt.Errorf("config error: %w", err)
+		}
+		return runRedrive(cfg, source, jobID, jobFile, comp)
+	},
+}
+
+func init() {
+	redriveCmd.Flags().String("source", "", "Dead-letter file or directory of dead-letter files")
+	redriveCmd.Flags().String("job", "", "ID of the job whose pipeline to use")
+	redriveCmd.Flags().String("job-file", "", "Job spec file whose pipeline to use")
+	redriveCmd.Flags().String("compression", "", "Compression of the dead-letter files (default: inferred from extension)")
+	redriveCmd.MarkFlagRequired("source")
+	workerCmd.AddCommand(redriveCmd)
+}
+
+func runRedrive(cfg *config.ClusterConfig, source, jobID, jobFile, comp string) error {
+	ctx := cmdContext()
+	logger := log.New(os.Stdout, "[redrive] ", log.LstdFlags)
+
+	files, err := deadLetterFiles(source)
+	if err != nil {
+		return err
+	}
+
+	var spec *job.JobSpec
+	if jobFile != "" {
+		if spec, err = job.LoadFromFile(jobFile); err != nil {
+			return fmt.Errorf("load job spec: %w", err)
+		}
+	}
+
+	// The cluster is only needed for a job ID or for sink credentials
+	var store *secrets.Store
+	if jobID != "" || len(spec.Options.Output.SinkSecretNames()) > 0 {
+		cl, err := newCluster(cfg)
+		if err != nil {
+			return fmt.Errorf("boot failure: %w", err)
+		}
+		defer cl.Close()
+		if err := awaitClusterKey(ctx, cl, cfg, logger); err != nil {
+			return err
+		}
+		store = cl.Secrets()
+		if jobID != "" {
+			info, err := cl.GetJob(ctx, jobID)
+			if err != nil {
+				return fmt.Errorf("get job %s: %w", jobID, err)
+			}
+			spec = info.Spec
+		}
+	}
+
+	var total int
+	for _, path := range files {
+		n, err := redriveFile(ctx, spec, store, path, comp)
+		total += n
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		logger.Printf("Redrove %d entries from %s", n, path)
+	}
+	logger.Printf("Redrove %d entries from %d files", total, len(files))
+	return nil
+}
+
+// deadLetterFiles resolves source to the dead-letter files to redrive.
+func deadLetterFiles(source string) ([]string, error) {
+	fi, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{source}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(source, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.Contains(d.Name(), ".deadletter") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no dead-letter files found in %s", source)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// redriveFile runs one dead-letter file through a fresh pipeline. Output goes
+// to the job's sink under the file's name with ".deadletter" replaced by
+// ".redrive", so it doesn't overwrite the shard's original chunks.
+func redriveFile(ctx context.Context, spec *job.JobSpec, store *secrets.Store, path, comp string) (int, error) {
+	if comp == "" {
+		comp = compression.CodecForName(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r, err := compression.NewReader(f, comp)
+	if err != nil {
+		return 0, err
+	}
+	if rc, ok := r.(io.Closer); ok {
+		defer rc.Close()
+	}
+
+	base := filepath.Base(path)
+	if i := strings.Index(base, ".deadletter"); i >= 0 {
+		base = base[:i]
+	}
+	pipeline, err := etl.NewPipeline(spec, store, base+".redrive")
+	if err != nil {
+		return 0, fmt.Errorf("etl pipeline init failed: %w", err)
+	}
+	return etl.Redrive(ctx, pipeline, r)
+}
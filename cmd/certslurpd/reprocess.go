@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chtzvt/certslurp/cmd/certslurpd/config"
+	"github.com/chtzvt/certslurp/internal/compression"
+	"github.com/chtzvt/certslurp/internal/etl"
+	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+var reprocessCmd = &cobra.Command{
+	Use:   "reprocess",
+	Short: "Run a prior job's raw output through a new pipeline without refetching",
+	Long: `Reads the output of a job that saved whole log entries (extractor
+"raw_entry", transformer "jsonl") and runs the entries through another job's
+extractor, transformer and sink, bypassing the CT log entirely. Use it to
+re-extract already-fetched data with updated logic.
+
+--source is an output chunk, or a directory whose chunks are all
+reprocessed; compression is inferred from each file's extension. The job
+spec comes from the cluster (--job) or a local file (--job-file). Its fetch
+options are ignored.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source, _ := cmd.Flags().GetString("source")
+		jobID, _ := cmd.Flags().GetString("job")
+		jobFile, _ := cmd.Flags().GetString("job-file")
+		if (jobID == "") == (jobFile == "") {
+			return fmt.Errorf("exactly one of --job or --job-file is required")
+		}
+
+		cfg, err := config.LoadConfig(cfgFile)
+		if err != nil {
+			return fmt.Errorf("config error: %w", err)
+		}
+		return runReprocess(cfg, source, jobID, jobFile)
+	},
+}
+
+func init() {
+	reprocessCmd.Flags().String("source", "", "Raw entry output file or directory of output files")
+	reprocessCmd.Flags().String("job", "", "ID of the job whose pipeline to use")
+	reprocessCmd.Flags().String("job-file", "", "Job spec file whose pipeline to use")
+	reprocessCmd.MarkFlagRequired("source")
+	workerCmd.AddCommand(reprocessCmd)
+}
+
+func runReprocess(cfg *config.ClusterConfig, source, jobID, jobFile string) error {
+	ctx := cmdContext()
+	logger := log.New(os.Stdout, "[reprocess] ", log.LstdFlags)
+
+	files, err := rawEntryFiles(source)
+	if err != nil {
+		return err
+	}
+
+	var spec *job.JobSpec
+	if jobFile != "" {
+		if spec, err = job.LoadFromFile(jobFile); err != nil {
+			return fmt.Errorf("load job spec: %w", err)
+		}
+	}
+
+	// The cluster is only needed for a job ID or for sink credentials
+	var store *secrets.Store
+	if jobID != "" || len(spec.Options.Output.SinkSecretNames()) > 0 {
+		cl, err := newCluster(cfg)
+		if err != nil {
+			return fmt.Errorf("boot failure: %w", err)
+		}
+		defer cl.Close()
+		if err := awaitClusterKey(ctx, cl, cfg, logger); err != nil {
+			return err
+		}
+		store = cl.Secrets()
+		if jobID != "" {
+			info, err := cl.GetJob(ctx, jobID)
+			if err != nil {
+				return fmt.Errorf("get job %s: %w", jobID, err)
+			}
+			spec = info.Spec
+		}
+	}
+
+	var total int
+	for _, path := range files {
+		n, err := reprocessFile(ctx, spec, store, path)
+		total += n
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		logger.Printf("Reprocessed %d entries from %s", n, path)
+	}
+	logger.Printf("Reprocessed %d entries from %d files", total, len(files))
+	return nil
+}
+
+// rawEntryFiles resolves source to the output chunks to reprocess, leaving
+// out manifests, signatures and dead letters.
+func rawEntryFiles(source string) ([]string, error) {
+	fi, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{source}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(source, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() || strings.HasPrefix(name, "MANIFEST.json") || strings.HasSuffix(name, ".sig") || strings.Contains(name, ".deadletter") {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no output files found in %s", source)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// reprocessFile runs one output chunk through a fresh pipeline. Output goes
+// to the job's sink under the chunk's name, without its compression
+// extension, followed by ".reprocess".
+func reprocessFile(ctx context.Context, spec *job.JobSpec, store *secrets.Store, path string) (int, error) {
+	comp := compression.CodecForName(path)
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r, err := compression.NewReader(f, comp)
+	if err != nil {
+		return 0, err
+	}
+	if rc, ok := r.(io.Closer); ok {
+		defer rc.Close()
+	}
+
+	base := strings.TrimSuffix(filepath.Base(path), compression.Extension(comp))
+	pipeline, err := etl.NewPipeline(spec, store, base+".reprocess")
+	if err != nil {
+		return 0, fmt.Errorf("etl pipeline init failed: %w", err)
+	}
+	return etl.Reprocess(ctx, pipeline, r)
+}
@@ -19,6 +19,18 @@ func newCluster(cfg *config.ClusterConfig) (cluster.Cluster, error) {
 		cfg.Node.ID = hostname
 	}
 
+	if cfg.Cluster.Backend == config.BackendMemory {
+		cl, err := cluster.NewMemoryCluster(cluster.MemoryConfig{
+			Prefix:       cfg.Etcd.Prefix,
+			KeychainFile: cfg.Secrets.KeychainFile,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to start memory cluster: %w", err)
+		}
+		cl.Secrets().AuditRetention = cfg.Secrets.AuditRetention
+		return cl, nil
+	}
+
 	// Create a unique temporary path, but remove the file so the secrets package
 	// can create and initialize it later.
 	keychainFile := cfg.Secrets.KeychainFile
@@ -47,6 +59,8 @@ func newCluster(cfg *config.ClusterConfig) (cluster.Cluster, error) {
 		Prefix:       etcdPrefix,
 		DialTimeout:  5 * time.Second,
 		KeychainFile: keychainFile,
+
+		MetricsEncoding: cfg.Etcd.MetricsEncoding,
 	}
 
 	maybeSleep()
@@ -56,6 +70,7 @@ func newCluster(cfg *config.ClusterConfig) (cluster.Cluster, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to etcd: %w", err)
 	}
+	cl.Secrets().AuditRetention = cfg.Secrets.AuditRetention
 
 	return cl, nil
 }
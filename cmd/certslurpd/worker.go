@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"strings"
 
 	"github.com/chtzvt/certslurp/cmd/certslurpd/config"
+	"github.com/chtzvt/certslurp/internal/cluster"
 	"github.com/chtzvt/certslurp/internal/worker"
 	"github.com/spf13/cobra"
 )
@@ -26,6 +32,10 @@ var workerCmd = &cobra.Command{
 func runWorker(cfg *config.ClusterConfig) error {
 	ctx := cmdContext()
 
+	if cfg.Cluster.Backend == config.BackendMemory {
+		return fmt.Errorf("the memory cluster backend runs its worker inside the head node; start certslurpd in head mode instead")
+	}
+
 	fmt.Printf("Starting worker node: %s\n", cfg.Node.ID)
 	cl, err := newCluster(cfg)
 	if err != nil {
@@ -33,18 +43,16 @@ func runWorker(cfg *config.ClusterConfig) error {
 	}
 	defer cl.Close()
 
-	logger := log.New(os.Stdout, "[worker] ", log.LstdFlags)
+	var logBuf *worker.LogBuffer
+	var logOut io.Writer = os.Stdout
+	if cfg.Worker.Logs.Enabled {
+		logBuf = worker.NewLogBuffer(cfg.Worker.Logs.BufferLines)
+		logOut = io.MultiWriter(os.Stdout, logBuf)
+	}
+	logger := log.New(logOut, "[worker] ", log.LstdFlags)
 
-	if cfg.Secrets.ClusterKey != "" {
-		err = selfBootstrap(ctx, cl, cfg, logger)
-		if err != nil {
-			return err
-		}
-	} else {
-		maybeSleep()
-		logger.Println("Registering worker and waiting for admin to approve secrets...")
-		cl.Secrets().RegisterAndWaitForClusterKey(ctx)
-		logger.Println("Registration complete. Starting...")
+	if err := awaitClusterKey(ctx, cl, cfg, logger); err != nil {
+		return err
 	}
 
 	w := worker.NewWorker(cl, cfg.Node.ID, logger)
@@ -52,6 +60,63 @@ func runWorker(cfg *config.ClusterConfig) error {
 	w.MaxParallel = cfg.Worker.Parallelism
 	w.BatchSize = cfg.Worker.BatchSize
 	w.PollPeriod = cfg.Worker.PollPeriod
+	w.ShutdownTimeout = cfg.Worker.ShutdownTimeout
+	w.MaxConcurrentUploads = cfg.Worker.MaxConcurrentUploads
+
+	if logBuf != nil {
+		endpoint, err := serveWorkerLogs(cfg.Worker.Logs, logBuf, logger)
+		if err != nil {
+			return fmt.Errorf("worker log endpoint: %w", err)
+		}
+		w.LogEndpoint = endpoint
+	}
 
 	return w.Run(cmdContext())
 }
+
+// awaitClusterKey obtains the cluster key for the secrets store, either by
+// self-bootstrapping with the configured key or by registering and waiting
+// for an admin to approve this node.
+func awaitClusterKey(ctx context.Context, cl cluster.Cluster, cfg *config.ClusterConfig, logger *log.Logger) error {
+	if cfg.Secrets.ClusterKey != "" {
+		return selfBootstrap(ctx, cl, cfg, logger)
+	}
+	maybeSleep()
+	logger.Println("Registering worker and waiting for admin to approve secrets...")
+	if err := cl.Secrets().RegisterAndWaitForClusterKey(ctx); err != nil {
+		return fmt.Errorf("secrets registration: %w", err)
+	}
+	logger.Println("Registration complete. Starting...")
+	return nil
+}
+
+// serveWorkerLogs exposes the recent-log ring buffer over HTTP and returns the
+// URL to advertise in the cluster.
+func serveWorkerLogs(cfg config.WorkerLogsConfig, buf *worker.LogBuffer, logger *log.Logger) (string, error) {
+	ln, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		return "", err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/logs", buf.Handler())
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			logger.Printf("worker log endpoint stopped: %v", err)
+		}
+	}()
+	logger.Printf("Serving recent logs on %s", ln.Addr())
+
+	if cfg.AdvertiseURL != "" {
+		return strings.TrimSuffix(cfg.AdvertiseURL, "/") + "/logs", nil
+	}
+	host, port, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		if h, err := os.Hostname(); err == nil {
+			host = h
+		}
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/logs", nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ValidityBucket is the number of certificates whose validity period falls in a bucket.
+type ValidityBucket struct {
+	Bucket string `json:"bucket"`
+	Count  int64  `json:"count"`
+}
+
+// ValidityHistogram buckets certificates with not_before in [from, to) by validity period.
+func ValidityHistogram(db *sql.DB, from, to time.Time) ([]ValidityBucket, error) {
+	rows, err := db.Query(`SELECT bucket, cert_count FROM cert_validity_histogram($1, $2)`, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("cert_validity_histogram: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []ValidityBucket
+	for rows.Next() {
+		var b ValidityBucket
+		if err := rows.Scan(&b.Bucket, &b.Count); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
+
+// parseTimeArg accepts either a date (2006-01-02) or an RFC 3339 timestamp.
+func parseTimeArg(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -12,14 +12,22 @@ import (
 )
 
 type DatabaseConfig struct {
-	MaxConns     int    `mapstructure:"max_conns"`
-	BatchSize    int    `mapstructure:"batch_size"`
-	Host         string `mapstructure:"host"`
-	Port         int    `mapstructure:"port"`
-	Username     string `mapstructure:"username"`
-	Password     string `mapstructure:"password,omitempty"`
-	DatabaseName string `mapstructure:"database"`
-	SSLMode      string `mapstructure:"ssl_mode"`
+	MaxConns      int           `mapstructure:"max_conns"`
+	BatchSize     int           `mapstructure:"batch_size"`
+	CopyThreshold int           `mapstructure:"copy_threshold"`
+	MaxRetries    int           `mapstructure:"max_retries"`
+	RetryBackoff  time.Duration `mapstructure:"retry_backoff"`
+	Host          string        `mapstructure:"host"`
+	Port          int           `mapstructure:"port"`
+	Username      string        `mapstructure:"username"`
+	Password      string        `mapstructure:"password,omitempty"`
+	DatabaseName  string        `mapstructure:"database"`
+	SSLMode       string        `mapstructure:"ssl_mode"`
+
+	// CacheSize caps the FQDN -> root domain cache; 0 disables it. The cache
+	// is halved whenever the heap exceeds CacheMemoryLimit bytes, if set.
+	CacheSize        int    `mapstructure:"cache_size"`
+	CacheMemoryLimit uint64 `mapstructure:"cache_memory_limit"`
 }
 
 type ServerConfig struct {
@@ -27,18 +35,42 @@ type ServerConfig struct {
 }
 
 type ProcessingConfig struct {
-	InboxDir          string        `mapstructure:"inbox_dir"`
-	InboxPatterns     string        `mapstructure:"inbox_patterns"`
-	InboxPollInterval time.Duration `mapstructure:"inbox_poll"`
-	EnableWatcher     bool          `mapstructure:"enable_watcher"`
-	DoneDir           string        `mapstructure:"done_dir"`
-	FlushInterval     time.Duration `mapstructure:"flush_interval"`
-	FlushThreshold    int64         `mapstructure:"flush_thresh"`
-	FlushLimit        int64         `mapstructure:"flush_limit"`
+	InboxDir           string        `mapstructure:"inbox_dir"`
+	InboxPatterns      string        `mapstructure:"inbox_patterns"`
+	InboxPollInterval  time.Duration `mapstructure:"inbox_poll"`
+	InboxWatch         string        `mapstructure:"inbox_watch"`
+	InboxSettle        time.Duration `mapstructure:"inbox_settle"`
+	EnableWatcher      bool          `mapstructure:"enable_watcher"`
+	DoneDir            string        `mapstructure:"done_dir"`
+	DeadLetterDir      string        `mapstructure:"deadletter_dir"`
+	SkipDuplicateFiles bool          `mapstructure:"skip_duplicate_files"`
+	DedupTTL           time.Duration `mapstructure:"dedup_ttl"`
+	DedupSize          int           `mapstructure:"dedup_size"`
+	FlushInterval      time.Duration `mapstructure:"flush_interval"`
+	FlushThreshold     int64         `mapstructure:"flush_thresh"`
+	FlushLimit         int64         `mapstructure:"flush_limit"`
+	NoopFlushes        string        `mapstructure:"noop_flushes"`
 }
 
+// How flushes that find nothing staged are recorded in etl_flush_metrics.
+const (
+	NoopFlushRecord   = "record"   // one row per flush (default)
+	NoopFlushSkip     = "skip"     // no row at all
+	NoopFlushCoalesce = "coalesce" // consecutive noops share one row, counted in flush_count
+)
+
 type MetricsConfig struct {
-	LogStatEvery int64 `mapstructure:"log_stat_every"`
+	LogStatEvery            int64         `mapstructure:"log_stat_every"`
+	DistinctDomains         bool          `mapstructure:"distinct_domains"`
+	DistinctPersistInterval time.Duration `mapstructure:"distinct_persist_interval"`
+}
+
+type PartitionConfig struct {
+	Interval     string `mapstructure:"interval"` // "yearly" or "monthly"
+	FromYear     int    `mapstructure:"from_year"`
+	ToYear       int    `mapstructure:"to_year"`
+	CheckOnStart bool   `mapstructure:"check_on_start"`
+	Repair       bool   `mapstructure:"repair"`
 }
 
 type SlurploadConfig struct {
@@ -46,6 +78,7 @@ type SlurploadConfig struct {
 	Server     ServerConfig     `mapstructure:"server"`
 	Processing ProcessingConfig `mapstructure:"processing"`
 	Metrics    MetricsConfig    `mapstructure:"metrics"`
+	Partitions PartitionConfig  `mapstructure:"partitions"`
 }
 
 func loadConfig(cfgFile string) (*SlurploadConfig, error) {
@@ -63,14 +96,37 @@ func loadConfig(cfgFile string) (*SlurploadConfig, error) {
 
 	viper.SetDefault("database.max_conns", 8)
 	viper.SetDefault("database.batch_size", 100)
+	viper.SetDefault("database.copy_threshold", 500)
+	viper.SetDefault("database.max_retries", 3)
+	viper.SetDefault("database.retry_backoff", 200*time.Millisecond)
+	viper.SetDefault("database.cache_size", DefaultFQDNCacheSize)
+	viper.SetDefault("database.cache_memory_limit", 0)
 	viper.SetDefault("metrics.log_stat_every", 1000)
+	viper.SetDefault("metrics.distinct_domains", false)
+	viper.SetDefault("metrics.distinct_persist_interval", time.Minute)
 	viper.SetDefault("processing.inbox_poll", 2*time.Second)
+	viper.SetDefault("processing.inbox_watch", InboxWatchPoll)
+	viper.SetDefault("processing.inbox_settle", DefaultInboxSettle)
 	viper.SetDefault("processing.flush_interval", 10*time.Second)
 	viper.SetDefault("processing.flush_thresh", 100_000)
 	viper.SetDefault("processing.flush_limit", 10_000_000)
+	viper.SetDefault("processing.noop_flushes", NoopFlushRecord)
+	viper.SetDefault("processing.skip_duplicate_files", false)
+	viper.SetDefault("processing.dedup_ttl", 0)
+	viper.SetDefault("processing.dedup_size", DefaultDedupSize)
+	viper.SetDefault("partitions.interval", PartitionYearly)
+	viper.SetDefault("partitions.from_year", DefaultPartitionFromYear)
+	viper.SetDefault("partitions.to_year", DefaultPartitionToYear)
+	viper.SetDefault("partitions.check_on_start", false)
+	viper.SetDefault("partitions.repair", false)
 
 	viper.BindEnv("database.max_conns")
 	viper.BindEnv("database.batch_size")
+	viper.BindEnv("database.copy_threshold")
+	viper.BindEnv("database.max_retries")
+	viper.BindEnv("database.retry_backoff")
+	viper.BindEnv("database.cache_size")
+	viper.BindEnv("database.cache_memory_limit")
 	viper.BindEnv("database.host")
 	viper.BindEnv("database.port")
 	viper.BindEnv("database.username")
@@ -83,10 +139,25 @@ func loadConfig(cfgFile string) (*SlurploadConfig, error) {
 	viper.BindEnv("processing.inbox_dir")
 	viper.BindEnv("processing.inbox_patterns")
 	viper.BindEnv("processing.inbox_poll")
+	viper.BindEnv("processing.inbox_watch")
+	viper.BindEnv("processing.inbox_settle")
 	viper.BindEnv("processing.enable_watcher")
 	viper.BindEnv("processing.done_dir")
+	viper.BindEnv("processing.deadletter_dir")
+	viper.BindEnv("processing.skip_duplicate_files")
+	viper.BindEnv("processing.dedup_ttl")
+	viper.BindEnv("processing.dedup_size")
+	viper.BindEnv("processing.noop_flushes")
 
 	viper.BindEnv("metrics.log_stat_every")
+	viper.BindEnv("metrics.distinct_domains")
+	viper.BindEnv("metrics.distinct_persist_interval")
+
+	viper.BindEnv("partitions.interval")
+	viper.BindEnv("partitions.from_year")
+	viper.BindEnv("partitions.to_year")
+	viper.BindEnv("partitions.check_on_start")
+	viper.BindEnv("partitions.repair")
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -107,9 +178,46 @@ func loadConfig(cfgFile string) (*SlurploadConfig, error) {
 		return nil, errors.New("database.host and database.database must be set (check config/env/flags)")
 	}
 
+	switch cfg.Processing.InboxWatch {
+	case InboxWatchPoll, InboxWatchNotify:
+	default:
+		return nil, fmt.Errorf("processing.inbox_watch must be %q or %q", InboxWatchPoll, InboxWatchNotify)
+	}
+
+	switch cfg.Processing.NoopFlushes {
+	case NoopFlushRecord, NoopFlushSkip, NoopFlushCoalesce:
+	default:
+		return nil, fmt.Errorf("processing.noop_flushes must be one of %q, %q or %q", NoopFlushRecord, NoopFlushSkip, NoopFlushCoalesce)
+	}
+
+	switch cfg.Partitions.Interval {
+	case "", PartitionYearly, PartitionMonthly:
+	default:
+		return nil, fmt.Errorf("partitions.interval must be %q or %q", PartitionYearly, PartitionMonthly)
+	}
+
+	if cfg.Database.CacheSize < 0 {
+		return nil, errors.New("database.cache_size must not be negative")
+	}
+
+	if cfg.Processing.DedupTTL < 0 || cfg.Processing.DedupSize < 0 {
+		return nil, errors.New("processing.dedup_ttl and processing.dedup_size must not be negative")
+	}
+
+	if cfg.Partitions.FromYear > cfg.Partitions.ToYear {
+		return nil, errors.New("partitions.from_year must not be after partitions.to_year")
+	}
+
 	return &cfg, nil
 }
 
+func noopFlushMode(cfg *SlurploadConfig) string {
+	if cfg.Processing.NoopFlushes == "" {
+		return NoopFlushRecord
+	}
+	return cfg.Processing.NoopFlushes
+}
+
 func openDatabase(cfg *SlurploadConfig) (*sql.DB, error) {
 	db, err := sql.Open("postgres", buildDSN(cfg))
 	if err != nil {
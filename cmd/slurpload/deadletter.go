@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// deadLetterSuffix is appended to the source file's name for its dead-letter
+// sidecar. It deliberately doesn't end in .jsonl, so a dead-letter dir shared
+// with the inbox isn't re-ingested by the watcher.
+const deadLetterSuffix = ".deadletter"
+
+// deadLetter is one unparseable input line, as written to the sidecar.
+type deadLetter struct {
+	Source string `json:"source"`
+	Line   int    `json:"line"`
+	Error  string `json:"error"`
+	Raw    string `json:"raw"`
+}
+
+// deadLetterWriter appends a file job's malformed lines to a sidecar in dir.
+// The sidecar is only created once the first line is written.
+type deadLetterWriter struct {
+	dir    string
+	source string
+	f      *os.File
+	enc    *json.Encoder
+}
+
+func newDeadLetterWriter(dir, source string) *deadLetterWriter {
+	return &deadLetterWriter{dir: dir, source: source}
+}
+
+func deadLetterPath(dir, source string) string {
+	return filepath.Join(dir, filepath.Base(source)+deadLetterSuffix)
+}
+
+func (d *deadLetterWriter) Write(lineNum int, line string, parseErr error) error {
+	if d.f == nil {
+		f, err := os.OpenFile(deadLetterPath(d.dir, d.source), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("open dead-letter file: %w", err)
+		}
+		d.f = f
+		d.enc = json.NewEncoder(f)
+	}
+	return d.enc.Encode(deadLetter{Source: d.source, Line: lineNum, Error: parseErr.Error(), Raw: line})
+}
+
+func (d *deadLetterWriter) Close() error {
+	if d.f == nil {
+		return nil
+	}
+	return d.f.Close()
+}
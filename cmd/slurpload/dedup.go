@@ -0,0 +1,113 @@
+package main
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/extractor"
+)
+
+// DefaultDedupSize is the default processing.dedup_size.
+const DefaultDedupSize = 500_000
+
+// SeenSet remembers the certificates loaded in the last ttl, by a fingerprint
+// of the (subject, not_before, not_after) tuple certificates is unique on, so
+// that re-ingesting overlapping archives can skip records before they're
+// staged, rather than staging them only for the flush to discard them. At
+// most max fingerprints are kept, oldest first out. A nil *SeenSet is valid
+// and filters nothing.
+type SeenSet struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	order   *list.List // front is most recently loaded
+	items   map[uint64]*list.Element
+	skipped int64
+	now     func() time.Time
+}
+
+type seenEntry struct {
+	key uint64
+	at  time.Time
+}
+
+// SeenSetStats is a snapshot of a SeenSet's counters.
+type SeenSetStats struct {
+	Size    int   `json:"size"`
+	Max     int   `json:"max"`
+	Skipped int64 `json:"skipped"`
+}
+
+func NewSeenSet(max int, ttl time.Duration) *SeenSet {
+	return &SeenSet{ttl: ttl, max: max, order: list.New(), items: make(map[uint64]*list.Element), now: time.Now}
+}
+
+func certFingerprint(cert extractor.CertFieldsExtractorOutput) uint64 {
+	return hllHash(cert.Subject + "\x00" +
+		strconv.FormatInt(cert.NotBefore.UnixNano(), 10) + "\x00" +
+		strconv.FormatInt(cert.NotAfter.UnixNano(), 10))
+}
+
+// Filter returns the certificates in batch not loaded within the TTL, dropping
+// repeats within batch too. batch itself is left untouched.
+func (s *SeenSet) Filter(batch []extractor.CertFieldsExtractorOutput) []extractor.CertFieldsExtractorOutput {
+	if s == nil {
+		return batch
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := s.now().Add(-s.ttl)
+	out := make([]extractor.CertFieldsExtractorOutput, 0, len(batch))
+	inBatch := make(map[uint64]struct{}, len(batch))
+	for _, cert := range batch {
+		key := certFingerprint(cert)
+		if el, ok := s.items[key]; ok && el.Value.(*seenEntry).at.After(cutoff) {
+			s.skipped++
+			continue
+		}
+		if _, ok := inBatch[key]; ok {
+			s.skipped++
+			continue
+		}
+		inBatch[key] = struct{}{}
+		out = append(out, cert)
+	}
+	return out
+}
+
+// Add records batch as loaded. Call it only once batch is committed, so a
+// failed insert is retried in full.
+func (s *SeenSet) Add(batch []extractor.CertFieldsExtractorOutput) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for _, cert := range batch {
+		key := certFingerprint(cert)
+		if el, ok := s.items[key]; ok {
+			el.Value.(*seenEntry).at = now
+			s.order.MoveToFront(el)
+			continue
+		}
+		s.items[key] = s.order.PushFront(&seenEntry{key: key, at: now})
+	}
+	cutoff := now.Add(-s.ttl)
+	for s.order.Len() > 0 {
+		el := s.order.Back()
+		if s.order.Len() <= s.max && el.Value.(*seenEntry).at.After(cutoff) {
+			break
+		}
+		s.order.Remove(el)
+		delete(s.items, el.Value.(*seenEntry).key)
+	}
+}
+
+func (s *SeenSet) Stats() SeenSetStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SeenSetStats{Size: s.order.Len(), Max: s.max, Skipped: s.skipped}
+}
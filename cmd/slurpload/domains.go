@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chtzvt/certslurp/internal/extractor"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// rootDomainFor returns the registrable domain (eTLD+1, per the public suffix
+// list) for cert, taken from its CommonName or, failing that, the first DNS SAN
+// that yields one. Certs without any usable hostname fall back to their
+// CommonName, or first SAN, as-is. Lookups go through cache, which may be nil.
+func rootDomainFor(cert extractor.CertFieldsExtractorOutput, cache *FQDNCache) string {
+	if d, ok := cache.registrableDomain(cert.CommonName); ok {
+		return d
+	}
+	for _, name := range cert.DNSNames {
+		if d, ok := cache.registrableDomain(name); ok {
+			return d
+		}
+	}
+	if cert.CommonName != "" || len(cert.DNSNames) == 0 {
+		return cert.CommonName
+	}
+	return cert.DNSNames[0]
+}
+
+// registrableDomain normalizes a certificate name (case, trailing dot, wildcard
+// labels, IDNs to punycode) and returns its eTLD+1. It reports false for names
+// that aren't hostnames, such as IP addresses or bare public suffixes.
+func registrableDomain(name string) (string, bool) {
+	name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+	for strings.HasPrefix(name, "*.") {
+		name = name[2:]
+	}
+	if !strings.Contains(name, ".") || net.ParseIP(name) != nil {
+		return "", false
+	}
+	if !isASCII(name) {
+		ascii, err := idna.Lookup.ToASCII(name)
+		if err != nil {
+			return "", false
+		}
+		name = ascii
+	}
+	d, err := publicsuffix.EffectiveTLDPlusOne(name)
+	if err != nil {
+		return "", false
+	}
+	return d, true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultFQDNCacheSize is the default database.cache_size.
+const DefaultFQDNCacheSize = 250_000
+
+// FQDNCache memoizes registrableDomain lookups, which are costly for IDNs and
+// deep names, in a least-recently-used cache of at most max names. A nil
+// *FQDNCache is valid and computes every lookup.
+type FQDNCache struct {
+	mu        sync.Mutex
+	max       int
+	order     *list.List // front is most recently used
+	items     map[string]*list.Element
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type fqdnCacheEntry struct {
+	name   string
+	domain string
+	ok     bool
+}
+
+// FQDNCacheStats is a snapshot of an FQDNCache's counters.
+type FQDNCacheStats struct {
+	Size      int   `json:"size"`
+	Max       int   `json:"max"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+func NewFQDNCache(max int) *FQDNCache {
+	return &FQDNCache{max: max, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// registrableDomain is registrableDomain(name), served from the cache when
+// possible.
+func (c *FQDNCache) registrableDomain(name string) (string, bool) {
+	if c == nil {
+		return registrableDomain(name)
+	}
+	c.mu.Lock()
+	if el, ok := c.items[name]; ok {
+		c.order.MoveToFront(el)
+		c.hits++
+		e := el.Value.(*fqdnCacheEntry)
+		c.mu.Unlock()
+		return e.domain, e.ok
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	domain, ok := registrableDomain(name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.items[name]; !exists {
+		c.items[name] = c.order.PushFront(&fqdnCacheEntry{name: name, domain: domain, ok: ok})
+		c.evictTo(c.max)
+	}
+	return domain, ok
+}
+
+// Shrink evicts the least recently used names until at most size remain.
+func (c *FQDNCache) Shrink(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictTo(size)
+}
+
+func (c *FQDNCache) evictTo(size int) {
+	if size < 0 {
+		size = 0
+	}
+	for c.order.Len() > size {
+		el := c.order.Back()
+		c.order.Remove(el)
+		delete(c.items, el.Value.(*fqdnCacheEntry).name)
+		c.evictions++
+	}
+}
+
+func (c *FQDNCache) Stats() FQDNCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return FQDNCacheStats{Size: c.order.Len(), Max: c.max, Hits: c.hits, Misses: c.misses, Evictions: c.evictions}
+}
+
+// RunFQDNCacheShrinker halves the cache whenever the Go heap exceeds
+// heapLimit bytes, checking every interval, so that the cache gives way
+// under memory pressure rather than the process.
+func RunFQDNCacheShrinker(ctx context.Context, cache *FQDNCache, heapLimit uint64, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var ms runtime.MemStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runtime.ReadMemStats(&ms)
+			if ms.HeapAlloc <= heapLimit {
+				continue
+			}
+			before := cache.Stats().Size
+			cache.Shrink(before / 2)
+			log.Printf("[warn] heap at %d bytes exceeds %d; shrank FQDN cache from %d to %d names", ms.HeapAlloc, heapLimit, before, before/2)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// HyperLogLog precision: 2^14 registers gives ~0.8% standard error in 16KiB.
+const (
+	hllPrecision = 14
+	hllRegisters = 1 << hllPrecision
+)
+
+// hyperLogLog is an approximate distinct counter. Registers are stored as raw
+// bytes so they can be persisted and merged across slurpload instances.
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, hllRegisters)}
+}
+
+func hllHash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	// FNV alone avalanches poorly; finish with the murmur3 fmix64 mixer.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func (h *hyperLogLog) Add(s string) {
+	x := hllHash(s)
+	idx := x >> (64 - hllPrecision)
+	w := x<<hllPrecision | 1<<(hllPrecision-1)
+	rho := uint8(bits.LeadingZeros64(w) + 1)
+	if rho > h.registers[idx] {
+		h.registers[idx] = rho
+	}
+}
+
+func (h *hyperLogLog) Estimate() uint64 {
+	m := float64(hllRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	var sum float64
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	est := alpha * m * m / sum
+
+	// Small-range correction (linear counting)
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// Merge folds other into h, taking the max of each register.
+func (h *hyperLogLog) Merge(other []uint8) error {
+	if len(other) != hllRegisters {
+		return fmt.Errorf("hll: register count mismatch (got %d, want %d)", len(other), hllRegisters)
+	}
+	for i, r := range other {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// DomainCounter tracks an approximate count of distinct root domains seen
+// during ingestion.
+type DomainCounter struct {
+	mu  sync.Mutex
+	hll *hyperLogLog
+}
+
+func NewDomainCounter() *DomainCounter {
+	return &DomainCounter{hll: newHyperLogLog()}
+}
+
+func (c *DomainCounter) Add(domain string) {
+	if domain == "" {
+		return
+	}
+	c.mu.Lock()
+	c.hll.Add(domain)
+	c.mu.Unlock()
+}
+
+func (c *DomainCounter) Estimate() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hll.Estimate()
+}
+
+// Load merges the persisted counter state into c.
+func (c *DomainCounter) Load(db *sql.DB) error {
+	var regs []byte
+	err := db.QueryRow("SELECT registers FROM distinct_root_domains WHERE id=1").Scan(&regs)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("load distinct_root_domains: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hll.Merge(regs)
+}
+
+// Persist merges c with the stored state and writes the result back, so that
+// several slurpload instances can share one counter.
+func (c *DomainCounter) Persist(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var stored []byte
+	err = tx.QueryRow("SELECT registers FROM distinct_root_domains WHERE id=1 FOR UPDATE").Scan(&stored)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("read distinct_root_domains: %w", err)
+	}
+
+	c.mu.Lock()
+	if stored != nil {
+		if err := c.hll.Merge(stored); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+	}
+	regs := make([]byte, len(c.hll.registers))
+	copy(regs, c.hll.registers)
+	c.mu.Unlock()
+
+	_, err = tx.Exec(`
+		INSERT INTO distinct_root_domains (id, registers, updated_at) VALUES (1, $1, now())
+		ON CONFLICT (id) DO UPDATE SET registers = EXCLUDED.registers, updated_at = EXCLUDED.updated_at`,
+		regs,
+	)
+	if err != nil {
+		return fmt.Errorf("write distinct_root_domains: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ReadDistinctRootDomains returns the persisted estimate and when it was last updated.
+func ReadDistinctRootDomains(db *sql.DB) (uint64, time.Time, error) {
+	var regs []byte
+	var updated time.Time
+	err := db.QueryRow("SELECT registers, updated_at FROM distinct_root_domains WHERE id=1").Scan(&regs, &updated)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, nil
+	} else if err != nil {
+		return 0, time.Time{}, fmt.Errorf("read distinct_root_domains: %w", err)
+	}
+	h := newHyperLogLog()
+	if err := h.Merge(regs); err != nil {
+		return 0, time.Time{}, err
+	}
+	return h.Estimate(), updated, nil
+}
+
+// Persist the distinct domain counter every PersistInterval.
+func RunDomainCounterPersister(ctx context.Context, db *sql.DB, cfg *SlurploadConfig, counter *DomainCounter) {
+	ticker := time.NewTicker(cfg.Metrics.DistinctPersistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := counter.Persist(db); err != nil {
+				log.Printf("error persisting distinct root domains: %v", err)
+			}
+		}
+	}
+}
@@ -5,11 +5,11 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/chtzvt/certslurp/internal/extractor"
 	"github.com/lib/pq"
-	"golang.org/x/net/publicsuffix"
 )
 
 type InsertJob struct {
@@ -17,21 +17,92 @@ type InsertJob struct {
 	Path string // Full path to file
 }
 
+// rawCertColumns are the raw_certificates columns written by insertBatch, in
+// the order produced by rawCertRow.
+var rawCertColumns = []string{
+	"cert_type", "common_name", "email_addresses", "organizational_unit", "organization",
+	"locality", "province", "country", "street_address", "postal_code",
+	"dns_names", "root_domain", "ip_addresses", "uris", "subject", "issuer", "serial_number",
+	"not_before", "not_after", "log_index", "log_timestamp",
+}
+
+// rawCertInsertSQL is the per-row INSERT used for batches below the COPY threshold.
+var rawCertInsertSQL = func() string {
+	params := make([]string, len(rawCertColumns))
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	return fmt.Sprintf("INSERT INTO raw_certificates (%s) VALUES (%s)",
+		strings.Join(rawCertColumns, ", "), strings.Join(params, ", "))
+}()
+
+// rawCertRow returns cert's values for rawCertColumns. Empty arrays become NULL
+// on both the COPY and INSERT paths.
+func rawCertRow(cert extractor.CertFieldsExtractorOutput, rootDomain string) []interface{} {
+	return []interface{}{
+		cert.Type, cert.CommonName, pqStringArray(cert.EmailAddresses), pqStringArray(cert.OrganizationalUnit),
+		pqStringArray(cert.Organization), pqStringArray(cert.Locality), pqStringArray(cert.Province),
+		pqStringArray(cert.Country), pqStringArray(cert.StreetAddress), pqStringArray(cert.PostalCode),
+		pqStringArray(cert.DNSNames), rootDomain,
+		pqStringArray(cert.IPAddresses), pqStringArray(cert.URIs),
+		cert.Subject, cert.Issuer, cert.SerialNumber,
+		cert.NotBefore, cert.NotAfter, cert.LogIndex, cert.LogTimestamp,
+	}
+}
+
+// insertBatch stages batch into raw_certificates. Batches of at least
+// copyThreshold rows are streamed with COPY; smaller ones use per-row INSERTs,
+// which avoid COPY's setup cost. A copyThreshold <= 0 always uses COPY.
+// Transient failures are retried according to retry. Certificates
+// metrics.Seen already loaded recently are skipped.
 func insertBatch(
 	ctx context.Context,
 	db *sql.DB,
 	batch []extractor.CertFieldsExtractorOutput,
+	copyThreshold int,
+	retry RetryPolicy,
 	logStatEvery int64,
 	metrics *SlurploadMetrics,
 ) error {
 	if len(batch) == 0 {
 		return nil
 	}
+	if batch = metrics.Seen.Filter(batch); len(batch) > 0 {
+		err := withRetry(ctx, retry, metrics, "insert batch", func() error {
+			return insertBatchTx(ctx, db, batch, copyThreshold, metrics)
+		})
+		if err != nil {
+			metrics.IncFailed()
+			return err
+		}
+		metrics.Seen.Add(batch)
+	}
+
+	if logStatEvery > 0 {
+		processed, _, _ := metrics.Snapshot()
+		if processed%logStatEvery == 0 {
+			log.Printf("[progress] %s", metrics)
+		}
+	}
+
+	metrics.IncProcessed()
+	return nil
+}
+
+// insertBatchTx writes batch in a single transaction, so a failed attempt
+// leaves nothing behind and can be repeated.
+func insertBatchTx(
+	ctx context.Context,
+	db *sql.DB,
+	batch []extractor.CertFieldsExtractorOutput,
+	copyThreshold int,
+	metrics *SlurploadMetrics,
+) error {
+	useCopy := copyThreshold <= 0 || len(batch) >= copyThreshold
 
-	// 1. Start a transaction for COPY and flush
+	// 1. Start a transaction for the batch
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		metrics.IncFailed()
 		return fmt.Errorf("begin tx: %w", err)
 	}
 	defer func() {
@@ -40,60 +111,51 @@ func insertBatch(
 		}
 	}()
 
-	// 2. Prepare COPY statement
-	stmt, err := tx.Prepare(pq.CopyIn(
-		"raw_certificates",
-		"cert_type", "common_name", "email_addresses", "organizational_unit", "organization",
-		"locality", "province", "country", "street_address", "postal_code",
-		"dns_names", "root_domain", "ip_addresses", "uris", "subject", "issuer", "serial_number",
-		"not_before", "not_after", "log_index", "log_timestamp",
-	))
-	if err != nil {
-		return fmt.Errorf("prepare COPY: %w", err)
+	// 2. Prepare COPY or INSERT statement
+	var stmt *sql.Stmt
+	if useCopy {
+		stmt, err = tx.Prepare(pq.CopyIn("raw_certificates", rawCertColumns...))
+		if err != nil {
+			return fmt.Errorf("prepare COPY: %w", err)
+		}
+	} else {
+		stmt, err = tx.Prepare(rawCertInsertSQL)
+		if err != nil {
+			return fmt.Errorf("prepare INSERT: %w", err)
+		}
 	}
 
 	// 3. Write all batch rows
 	for _, cert := range batch {
-		rootDomain, err := publicsuffix.EffectiveTLDPlusOne(cert.CommonName)
-		if err != nil {
-			rootDomain = cert.CommonName
+		rootDomain := rootDomainFor(cert, metrics.Domains)
+		if metrics.RootDomains != nil {
+			metrics.RootDomains.Add(rootDomain)
 		}
 
-		_, err = stmt.Exec(
-			cert.Type, cert.CommonName, pqStringArray(cert.EmailAddresses), pqStringArray(cert.OrganizationalUnit),
-			pqStringArray(cert.Organization), pqStringArray(cert.Locality), pqStringArray(cert.Province),
-			pqStringArray(cert.Country), pqStringArray(cert.StreetAddress), pqStringArray(cert.PostalCode),
-			pqStringArray(cert.DNSNames), rootDomain,
-			pqStringArray(cert.IPAddresses), pqStringArray(cert.URIs),
-			cert.Subject, cert.Issuer, cert.SerialNumber,
-			cert.NotBefore, cert.NotAfter, cert.LogIndex, cert.LogTimestamp,
-		)
+		_, err = stmt.Exec(rawCertRow(cert, rootDomain)...)
 		if err != nil {
-			return fmt.Errorf("COPY exec: %w", err)
+			if useCopy {
+				return fmt.Errorf("COPY exec: %w", err)
+			}
+			return fmt.Errorf("INSERT exec: %w", err)
 		}
 	}
-	_, err = stmt.Exec()
-	if err != nil {
-		return fmt.Errorf("COPY exec flush: %w", err)
-	}
-	if err := stmt.Close(); err != nil {
-		return fmt.Errorf("COPY close: %w", err)
+	if useCopy {
+		_, err = stmt.Exec()
+		if err != nil {
+			return fmt.Errorf("COPY exec flush: %w", err)
+		}
+		if err := stmt.Close(); err != nil {
+			return fmt.Errorf("COPY close: %w", err)
+		}
+	} else if err := stmt.Close(); err != nil {
+		return fmt.Errorf("INSERT close: %w", err)
 	}
 
 	// Commit
 	if err := tx.Commit(); err != nil {
-		metrics.IncFailed()
 		return fmt.Errorf("commit: %w", err)
 	}
-
-	if logStatEvery > 0 {
-		processed, _, _ := metrics.Snapshot()
-		if processed%logStatEvery == 0 {
-			log.Printf("[progress] %s", metrics)
-		}
-	}
-
-	metrics.IncProcessed()
 	return nil
 }
 
@@ -134,12 +196,16 @@ func FlushIfNeeded(db *sql.DB, cfg *SlurploadConfig, metrics *SlurploadMetrics)
 		return
 	}
 
-	_, err = db.Exec(
-		"SELECT flush_raw_certificates($1, $2, $3)",
-		"batch",
-		cfg.Processing.FlushLimit,
-		lastProcessedID,
-	)
+	err = withRetry(context.Background(), retryPolicy(cfg), metrics, "flush", func() error {
+		_, err := db.Exec(
+			"SELECT flush_raw_certificates($1, $2, $3, $4)",
+			"batch",
+			cfg.Processing.FlushLimit,
+			lastProcessedID,
+			noopFlushMode(cfg),
+		)
+		return err
+	})
 	if err != nil {
 		log.Printf("error calling flush_raw_certificates: %v", err)
 		return
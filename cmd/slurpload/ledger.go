@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// hashFile returns the hex sha256 of f's contents and rewinds it.
+func hashFile(f *os.File) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fileAlreadyIngested reports whether a file with this hash has been loaded.
+func fileAlreadyIngested(ctx context.Context, db *sql.DB, sum string) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM ingested_files WHERE sha256 = $1)`, sum).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("check ingested_files: %w", err)
+	}
+	return exists, nil
+}
+
+// recordIngestedFile adds a fully loaded file to the ingested_files ledger.
+func recordIngestedFile(ctx context.Context, db *sql.DB, path, sum string, rows int64) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO ingested_files (sha256, path, row_count, completed_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (sha256) DO NOTHING`, sum, path, rows)
+	if err != nil {
+		return fmt.Errorf("record ingested file: %w", err)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"os"
@@ -59,7 +60,7 @@ func main() {
 				return err
 			}
 			defer db.Close()
-			if err := runInitDB(db); err != nil {
+			if err := runInitDB(db, partitionInterval(cfg)); err != nil {
 				return err
 			}
 			fmt.Println("Database schema created.")
@@ -69,7 +70,7 @@ func main() {
 
 	// ----- load command -----
 	var archivePath string
-	var useGzip, useBzip2 bool
+	var useGzip, useBzip2, useZstd, useLZ4 bool
 
 	loadCmd := &cobra.Command{
 		Use:   "load",
@@ -81,7 +82,7 @@ func main() {
 			}
 			defer db.Close()
 
-			reader, err := getReader(archivePath, useGzip, useBzip2)
+			reader, err := getReader(archivePath, useGzip, useBzip2, useZstd, useLZ4)
 			if err != nil {
 				return err
 			}
@@ -91,12 +92,18 @@ func main() {
 
 			metrics := NewSlurploadMetrics()
 			metrics.Start()
+			if err := enableDomainCounter(ctx, db, cfg, metrics); err != nil {
+				return err
+			}
+			enableFQDNCache(ctx, cfg, metrics)
+			enableDedup(cfg, metrics)
+			checkPartitionsOnStart(db, cfg)
 
 			watcherCfg := NewWatcherConfig("", "", []string{}, 0*time.Second)
 
 			for i := 0; i < cfg.Database.MaxConns; i++ {
 				wg.Add(1)
-				go fileWorker(ctx, db, jobs, cfg.Database.BatchSize, &wg, cfg.Metrics.LogStatEvery, metrics, "", watcherCfg)
+				go fileWorker(ctx, db, jobs, cfg.Database.BatchSize, cfg.Database.CopyThreshold, retryPolicy(cfg), &wg, cfg.Metrics.LogStatEvery, metrics, "", cfg.Processing.DeadLetterDir, cfg.Processing.SkipDuplicateFiles, watcherCfg)
 			}
 
 			go RunFlusher(ctx, db, cfg, metrics)
@@ -116,6 +123,7 @@ func main() {
 			jobs <- InsertJob{Name: filepath.Base(tmp.Name()), Path: tmp.Name()}
 			close(jobs)
 			wg.Wait()
+			persistDomainCounter(db, metrics)
 			log.Printf("Done. %s", metrics)
 			return nil
 		},
@@ -123,6 +131,8 @@ func main() {
 	loadCmd.Flags().StringVar(&archivePath, "archive", "", "Input archive file (or '-' for stdin)")
 	loadCmd.Flags().BoolVar(&useGzip, "gzip", false, "Decompress gzip input")
 	loadCmd.Flags().BoolVar(&useBzip2, "bzip2", false, "Decompress bzip2 input")
+	loadCmd.Flags().BoolVar(&useZstd, "zstd", false, "Decompress zstd input")
+	loadCmd.Flags().BoolVar(&useLZ4, "lz4", false, "Decompress lz4 input")
 	loadCmd.MarkFlagRequired("archive")
 
 	// ----- serve command -----
@@ -143,14 +153,21 @@ func main() {
 
 			metrics := NewSlurploadMetrics()
 			metrics.Start()
+			if err := enableDomainCounter(ctx, db, cfg, metrics); err != nil {
+				return err
+			}
+			enableFQDNCache(ctx, cfg, metrics)
+			enableDedup(cfg, metrics)
+			checkPartitionsOnStart(db, cfg)
 
 			patterns := strings.Split(cfg.Processing.InboxPatterns, ",")
 			watcherCfg := NewWatcherConfig(cfg.Processing.InboxDir, cfg.Processing.DoneDir, patterns, cfg.Processing.InboxPollInterval)
+			watcherCfg.Mode, watcherCfg.SettleDelay = cfg.Processing.InboxWatch, cfg.Processing.InboxSettle
 
 			// Start workers
 			for i := 0; i < cfg.Database.MaxConns; i++ {
 				wg.Add(1)
-				go fileWorker(ctx, db, jobs, cfg.Database.BatchSize, &wg, cfg.Metrics.LogStatEvery, metrics, cfg.Processing.DoneDir, watcherCfg)
+				go fileWorker(ctx, db, jobs, cfg.Database.BatchSize, cfg.Database.CopyThreshold, retryPolicy(cfg), &wg, cfg.Metrics.LogStatEvery, metrics, cfg.Processing.DoneDir, cfg.Processing.DeadLetterDir, cfg.Processing.SkipDuplicateFiles, watcherCfg)
 			}
 
 			go RunFlusher(ctx, db, cfg, metrics)
@@ -159,11 +176,11 @@ func main() {
 
 			if cfg.Processing.EnableWatcher && cfg.Processing.InboxDir != "" {
 				go StartInboxWatcher(watcherCfg, jobs, stop)
-				log.Printf("Inbox watcher started on %s", cfg.Processing.InboxDir)
+				log.Printf("Inbox watcher started on %s (%s)", cfg.Processing.InboxDir, cfg.Processing.InboxWatch)
 			}
 
 			if cfg.Server.ListenAddr != "" && cfg.Processing.InboxDir != "" {
-				go StartHTTPServer(ctx, cfg, metrics)
+				go StartHTTPServer(ctx, db, cfg, metrics)
 			}
 
 			// Graceful shutdown on SIGINT/SIGTERM
@@ -177,6 +194,7 @@ func main() {
 			close(jobs)
 			wg.Wait()
 			FlushIfNeeded(db, cfg, metrics)
+			persistDomainCounter(db, metrics)
 			log.Printf("Done. %s", metrics)
 			return nil
 		},
@@ -191,15 +209,188 @@ func main() {
 	serveCmd.Flags().String("done", "", "Directory to move processed files to")
 	viper.BindPFlag("processing.done_dir", serveCmd.Flags().Lookup("done"))
 
+	serveCmd.Flags().String("deadletter", "", "Directory to write malformed input lines to")
+	viper.BindPFlag("processing.deadletter_dir", serveCmd.Flags().Lookup("deadletter"))
+
 	serveCmd.Flags().Duration("poll", 2*time.Second, "Inbox watcher poll interval")
 	viper.BindPFlag("processing.inbox_poll", serveCmd.Flags().Lookup("poll"))
 
-	serveCmd.Flags().String("patterns", "*.jsonl,*.jsonl.gz,*.jsonl.bz2", "Inbox file patterns")
+	serveCmd.Flags().String("patterns", "*.jsonl,*.jsonl.gz,*.jsonl.bz2,*.jsonl.zst,*.jsonl.lz4,*.jsonl.xz,*.jsonl.br", "Inbox file patterns")
 	viper.BindPFlag("processing.inbox_patterns", serveCmd.Flags().Lookup("patterns"))
 
 	serveCmd.Flags().Bool("watch-inbox", true, "Enable inbox directory watcher")
 	viper.BindPFlag("processing.enable_watcher", serveCmd.Flags().Lookup("watch-inbox"))
 
+	// ----- status command -----
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show ingestion statistics stored in the database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			est, updated, err := ReadDistinctRootDomains(db)
+			if err != nil {
+				return err
+			}
+			if updated.IsZero() {
+				fmt.Println("Distinct root domains: not tracked (enable metrics.distinct_domains)")
+				return nil
+			}
+			fmt.Printf("Distinct root domains (approx.): %d (updated %s)\n", est, updated.Format(time.RFC3339))
+			return nil
+		},
+	}
+	rootCmd.AddCommand(statusCmd)
+
+	// ----- validity command -----
+	validityCmd := &cobra.Command{
+		Use:   "validity",
+		Short: "Histogram of certificate validity periods for certs issued in a time range",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fromStr, _ := cmd.Flags().GetString("from")
+			toStr, _ := cmd.Flags().GetString("to")
+			from, err := parseTimeArg(fromStr)
+			if err != nil {
+				return fmt.Errorf("invalid --from: %w", err)
+			}
+			to := time.Now()
+			if toStr != "" {
+				if to, err = parseTimeArg(toStr); err != nil {
+					return fmt.Errorf("invalid --to: %w", err)
+				}
+			}
+
+			db, err := openDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			buckets, err := ValidityHistogram(db, from, to)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Certificates by validity period (not_before %s to %s):\n", from.Format(time.RFC3339), to.Format(time.RFC3339))
+			for _, b := range buckets {
+				fmt.Printf("  %-8s %d\n", b.Bucket, b.Count)
+			}
+			return nil
+		},
+	}
+	validityCmd.Flags().String("from", "", "Start of not_before range (YYYY-MM-DD or RFC 3339)")
+	validityCmd.Flags().String("to", "", "End of not_before range, exclusive (default now)")
+	validityCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(validityCmd)
+
+	// ----- check-partitions command -----
+	checkPartitionsCmd := &cobra.Command{
+		Use:   "check-partitions",
+		Short: "Verify certificates partitions exist for a range of years",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fromYear, toYear := cfg.Partitions.FromYear, cfg.Partitions.ToYear
+			if cmd.Flags().Changed("from-year") {
+				fromYear, _ = cmd.Flags().GetInt("from-year")
+			}
+			if cmd.Flags().Changed("to-year") {
+				toYear, _ = cmd.Flags().GetInt("to-year")
+			}
+			if fromYear > toYear {
+				return fmt.Errorf("--from-year %d is after --to-year %d", fromYear, toYear)
+			}
+			repair, _ := cmd.Flags().GetBool("repair")
+
+			db, err := openDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			missing, err := CheckPartitions(db, partitionInterval(cfg), fromYear, toYear, repair)
+			if err != nil {
+				return err
+			}
+			switch {
+			case len(missing) == 0:
+				fmt.Printf("All certificates partitions present for %d-%d.\n", fromYear, toYear)
+			case repair:
+				fmt.Printf("Created %d missing partitions: %v\n", len(missing), missing)
+			default:
+				return fmt.Errorf("%d certificates partitions missing: %v (rerun with --repair to create them)", len(missing), missing)
+			}
+			return nil
+		},
+	}
+	checkPartitionsCmd.Flags().Int("from-year", DefaultPartitionFromYear, "First year to check (overrides partitions.from_year)")
+	checkPartitionsCmd.Flags().Int("to-year", DefaultPartitionToYear, "Last year to check, inclusive (overrides partitions.to_year)")
+	checkPartitionsCmd.Flags().Bool("repair", false, "Create any missing partitions")
+	rootCmd.AddCommand(checkPartitionsCmd)
+
+	// ----- stage-partition / attach-partition commands -----
+	stagePartitionCmd := &cobra.Command{
+		Use:   "stage-partition <partition>",
+		Short: "Route flushed certs for one partition (YYYY or YYYY-MM) into a staging table for a backfill",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := parsePartition(args[0], partitionInterval(cfg))
+			if err != nil {
+				return err
+			}
+			db, err := openDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if err := StagePartition(db, p); err != nil {
+				return err
+			}
+			fmt.Printf("Certs for %s now flush into %s; run attach-partition %s once the backfill is loaded.\n", p, p.stagingTable(), p)
+			return nil
+		},
+	}
+	rootCmd.AddCommand(stagePartitionCmd)
+
+	attachPartitionCmd := &cobra.Command{
+		Use:   "attach-partition [partition]",
+		Short: "Swap a staged partition's backfill into certificates (lists staged partitions if none is given)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openDatabase(cfg)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			if len(args) == 0 {
+				staged, err := StagedPartitions(db)
+				if err != nil {
+					return err
+				}
+				if len(staged) == 0 {
+					fmt.Println("No partitions are staged.")
+				} else {
+					fmt.Printf("Staged partitions: %v\n", staged)
+				}
+				return nil
+			}
+
+			p, err := parsePartition(args[0], partitionInterval(cfg))
+			if err != nil {
+				return err
+			}
+			if err := AttachStagedPartition(db, p); err != nil {
+				return err
+			}
+			fmt.Printf("Attached %s to certificates.\n", p.table())
+			return nil
+		},
+	}
+	rootCmd.AddCommand(attachPartitionCmd)
+
 	configCmd := &cobra.Command{
 		Use:   "config",
 		Short: "Print effective configuration",
@@ -222,3 +413,51 @@ func main() {
 		log.Fatalf("slurpload error: %v", err)
 	}
 }
+
+// enableDomainCounter attaches a distinct root domain counter to metrics, seeded
+// from the persisted state, when metrics.distinct_domains is set.
+func enableDomainCounter(ctx context.Context, db *sql.DB, cfg *SlurploadConfig, metrics *SlurploadMetrics) error {
+	if !cfg.Metrics.DistinctDomains {
+		return nil
+	}
+	counter := NewDomainCounter()
+	if err := counter.Load(db); err != nil {
+		return err
+	}
+	metrics.RootDomains = counter
+	if cfg.Metrics.DistinctPersistInterval > 0 {
+		go RunDomainCounterPersister(ctx, db, cfg, counter)
+	}
+	return nil
+}
+
+// enableFQDNCache attaches a root domain lookup cache to metrics unless
+// database.cache_size is 0, shrinking it under memory pressure if
+// database.cache_memory_limit is set.
+func enableFQDNCache(ctx context.Context, cfg *SlurploadConfig, metrics *SlurploadMetrics) {
+	if cfg.Database.CacheSize <= 0 {
+		return
+	}
+	metrics.Domains = NewFQDNCache(cfg.Database.CacheSize)
+	if cfg.Database.CacheMemoryLimit > 0 {
+		go RunFQDNCacheShrinker(ctx, metrics.Domains, cfg.Database.CacheMemoryLimit, 10*time.Second)
+	}
+}
+
+func persistDomainCounter(db *sql.DB, metrics *SlurploadMetrics) {
+	if metrics.RootDomains == nil {
+		return
+	}
+	if err := metrics.RootDomains.Persist(db); err != nil {
+		log.Printf("error persisting distinct root domains: %v", err)
+	}
+}
+
+// enableDedup attaches a recently-seen set to metrics if processing.dedup_ttl
+// is set, so overlapping inputs aren't staged twice.
+func enableDedup(cfg *SlurploadConfig, metrics *SlurploadMetrics) {
+	if cfg.Processing.DedupTTL <= 0 || cfg.Processing.DedupSize <= 0 {
+		return
+	}
+	metrics.Seen = NewSeenSet(cfg.Processing.DedupSize, cfg.Processing.DedupTTL)
+}
@@ -9,7 +9,17 @@ import (
 type SlurploadMetrics struct {
 	ShardsProcessed int64 // atomic
 	ShardsFailed    int64 // atomic
+	Malformed       int64 // atomic; input lines that couldn't be parsed
+	Retries         int64 // atomic; transient database errors that were retried
 	processingStart int64 // stores UnixNano, atomic
+
+	// RootDomains is nil unless metrics.distinct_domains is enabled.
+	RootDomains *DomainCounter
+	// Domains caches root domain lookups; nil when database.cache_size is 0.
+	Domains *FQDNCache
+	// Seen skips recently loaded certificates; nil unless
+	// processing.dedup_ttl is set.
+	Seen *SeenSet
 }
 
 func NewSlurploadMetrics() *SlurploadMetrics {
@@ -20,6 +30,8 @@ func (m *SlurploadMetrics) Start() {
 	atomic.StoreInt64(&m.processingStart, time.Now().UnixNano())
 	atomic.StoreInt64(&m.ShardsProcessed, 0)
 	atomic.StoreInt64(&m.ShardsFailed, 0)
+	atomic.StoreInt64(&m.Malformed, 0)
+	atomic.StoreInt64(&m.Retries, 0)
 }
 
 func (m *SlurploadMetrics) Snapshot() (processed, failed int64, elapsed time.Duration) {
@@ -34,7 +46,7 @@ func (m *SlurploadMetrics) Snapshot() (processed, failed int64, elapsed time.Dur
 
 func (m *SlurploadMetrics) String() string {
 	processed, failed, elapsed := m.Snapshot()
-	return fmt.Sprintf("batches processed=%d / batches failed=%d / time elapsed=%v", processed, failed, elapsed)
+	return fmt.Sprintf("batches processed=%d / batches failed=%d / malformed lines=%d / retries=%d / time elapsed=%v", processed, failed, m.MalformedLines(), m.RetryCount(), elapsed)
 }
 
 // Helpers for atomic increments
@@ -46,6 +58,22 @@ func (m *SlurploadMetrics) IncFailed() int64 {
 	return atomic.AddInt64(&m.ShardsFailed, 1)
 }
 
+func (m *SlurploadMetrics) IncMalformed() int64 {
+	return atomic.AddInt64(&m.Malformed, 1)
+}
+
+func (m *SlurploadMetrics) MalformedLines() int64 {
+	return atomic.LoadInt64(&m.Malformed)
+}
+
+func (m *SlurploadMetrics) IncRetries() int64 {
+	return atomic.AddInt64(&m.Retries, 1)
+}
+
+func (m *SlurploadMetrics) RetryCount() int64 {
+	return atomic.LoadInt64(&m.Retries)
+}
+
 func (m *SlurploadMetrics) Elapsed() time.Duration {
 	start := atomic.LoadInt64(&m.processingStart)
 	if start == 0 {
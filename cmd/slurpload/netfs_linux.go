@@ -0,0 +1,26 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// Filesystem magic numbers from statfs(2) for filesystems where inotify only
+// sees changes made through the local mount.
+var networkFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x01021997: "9p",
+}
+
+// networkFilesystem reports whether dir is on a network filesystem, and which.
+func networkFilesystem(dir string) (string, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return "", false
+	}
+	name, ok := networkFilesystems[uint32(st.Type)]
+	return name, ok
+}
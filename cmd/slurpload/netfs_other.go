@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// networkFilesystem reports whether dir is on a network filesystem. Only
+// Linux is checked; elsewhere event watching is always attempted.
+func networkFilesystem(dir string) (string, bool) {
+	return "", false
+}
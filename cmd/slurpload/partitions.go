@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+)
+
+// Year range of the certificates partitions created by init-db.
+const (
+	DefaultPartitionFromYear = 2000
+	DefaultPartitionToYear   = 2070
+)
+
+// Span of time covered by each certificates partition, keyed on not_before.
+const (
+	PartitionYearly  = "yearly"
+	PartitionMonthly = "monthly"
+)
+
+// Partition identifies one certificates partition. Month is zero for a yearly
+// partition.
+type Partition struct {
+	Year  int
+	Month int
+}
+
+func (p Partition) String() string {
+	if p.Month == 0 {
+		return strconv.Itoa(p.Year)
+	}
+	return fmt.Sprintf("%04d-%02d", p.Year, p.Month)
+}
+
+// table returns the partition's table name, e.g. certificates_2024 or
+// certificates_2024_03.
+func (p Partition) table() string {
+	if p.Month == 0 {
+		return fmt.Sprintf("certificates_%d", p.Year)
+	}
+	return fmt.Sprintf("certificates_%04d_%02d", p.Year, p.Month)
+}
+
+// bounds returns the partition's not_before range as dates, upper bound exclusive.
+func (p Partition) bounds() (string, string) {
+	if p.Month == 0 {
+		return fmt.Sprintf("%04d-01-01", p.Year), fmt.Sprintf("%04d-01-01", p.Year+1)
+	}
+	next := Partition{Year: p.Year, Month: p.Month + 1}
+	if next.Month > 12 {
+		next = Partition{Year: p.Year + 1, Month: 1}
+	}
+	return fmt.Sprintf("%04d-%02d-01", p.Year, p.Month), fmt.Sprintf("%04d-%02d-01", next.Year, next.Month)
+}
+
+var partitionTableRe = regexp.MustCompile(`^certificates_(\d{4})(?:_(\d{2}))?$`)
+
+// parsePartitionTable is the inverse of Partition.table.
+func parsePartitionTable(name string) (Partition, bool) {
+	m := partitionTableRe.FindStringSubmatch(name)
+	if m == nil {
+		return Partition{}, false
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2]) // zero when absent
+	return Partition{Year: year, Month: month}, true
+}
+
+// partitionsInRange lists the partitions of the given interval covering the
+// years [fromYear, toYear].
+func partitionsInRange(interval string, fromYear, toYear int) []Partition {
+	var parts []Partition
+	for year := fromYear; year <= toYear; year++ {
+		if interval != PartitionMonthly {
+			parts = append(parts, Partition{Year: year})
+			continue
+		}
+		for month := 1; month <= 12; month++ {
+			parts = append(parts, Partition{Year: year, Month: month})
+		}
+	}
+	return parts
+}
+
+// partitionInterval returns the configured partition interval, defaulting to yearly.
+func partitionInterval(cfg *SlurploadConfig) string {
+	if cfg.Partitions.Interval == "" {
+		return PartitionYearly
+	}
+	return cfg.Partitions.Interval
+}
+
+// createPartition creates the certificates partition p.
+func createPartition(db *sql.DB, p Partition) error {
+	from, to := p.bounds()
+	_, err := db.Exec(fmt.Sprintf(certificatesPartitionTemplate, p.table(), from, to))
+	return err
+}
+
+// MissingPartitions returns the partitions of the given interval covering
+// [fromYear, toYear] that don't exist. Certificates in those ranges can't be
+// flushed.
+func MissingPartitions(db *sql.DB, interval string, fromYear, toYear int) ([]Partition, error) {
+	rows, err := db.Query(`
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'certificates'`)
+	if err != nil {
+		return nil, fmt.Errorf("list partitions: %w", err)
+	}
+	defer rows.Close()
+
+	have := make(map[Partition]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if p, ok := parsePartitionTable(name); ok {
+			have[p] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []Partition
+	for _, p := range partitionsInRange(interval, fromYear, toYear) {
+		if !have[p] {
+			missing = append(missing, p)
+		}
+	}
+	return missing, nil
+}
+
+// CheckPartitions reports the partitions covering [fromYear, toYear] that are
+// missing. With repair set, it creates them; the returned partitions are those
+// that were missing when the check ran.
+func CheckPartitions(db *sql.DB, interval string, fromYear, toYear int, repair bool) ([]Partition, error) {
+	missing, err := MissingPartitions(db, interval, fromYear, toYear)
+	if err != nil || !repair {
+		return missing, err
+	}
+	for _, p := range missing {
+		if err := createPartition(db, p); err != nil {
+			return missing, fmt.Errorf("create partition for %s: %w", p, err)
+		}
+		log.Printf("Created missing certificates partition for %s", p)
+	}
+	return missing, nil
+}
+
+// checkPartitionsOnStart runs the partition check configured under partitions,
+// logging any gaps rather than failing startup.
+func checkPartitionsOnStart(db *sql.DB, cfg *SlurploadConfig) {
+	if !cfg.Partitions.CheckOnStart {
+		return
+	}
+	missing, err := CheckPartitions(db, partitionInterval(cfg), cfg.Partitions.FromYear, cfg.Partitions.ToYear, cfg.Partitions.Repair)
+	if err != nil {
+		log.Printf("[warn] partition check failed: %v", err)
+		return
+	}
+	if len(missing) > 0 && !cfg.Partitions.Repair {
+		log.Printf("[warn] certificates partitions missing for %v; certs in those ranges will fail to flush (run check-partitions --repair)", missing)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// flushStats aggregates etl_flush_metrics for the Prometheus endpoint.
+type flushStats struct {
+	RowsInserted    int64
+	DurationSeconds float64 // total time spent in completed flushes
+	Count           int64   // completed flushes
+	LastSeconds     float64 // duration of the most recent completed flush
+	Noops           int64   // flushes that found nothing staged
+}
+
+// readFlushStats aggregates completed flushes. Noop flushes are only counted:
+// a row of coalesced noops spans from the first to the last of them, which
+// says nothing about how long a flush takes.
+func readFlushStats(db *sql.DB) (flushStats, error) {
+	var s flushStats
+	err := db.QueryRow(`
+		SELECT
+			COALESCE(SUM(rows_inserted), 0),
+			COALESCE(SUM(EXTRACT(EPOCH FROM ended_at - started_at)) FILTER (WHERE status IS DISTINCT FROM 'noop'), 0),
+			COUNT(*) FILTER (WHERE status IS DISTINCT FROM 'noop'),
+			COALESCE((
+				SELECT EXTRACT(EPOCH FROM ended_at - started_at)
+				FROM etl_flush_metrics
+				WHERE ended_at IS NOT NULL AND status IS DISTINCT FROM 'noop'
+				ORDER BY ended_at DESC
+				LIMIT 1
+			), 0),
+			COALESCE(SUM(flush_count) FILTER (WHERE status = 'noop'), 0)
+		FROM etl_flush_metrics
+		WHERE ended_at IS NOT NULL`,
+	).Scan(&s.RowsInserted, &s.DurationSeconds, &s.Count, &s.LastSeconds, &s.Noops)
+	if err != nil {
+		return flushStats{}, fmt.Errorf("read etl_flush_metrics: %w", err)
+	}
+	return s, nil
+}
+
+// prometheusHandler serves SlurploadMetrics and flush statistics from
+// etl_flush_metrics in the Prometheus text exposition format. If the flush
+// statistics can't be read, only the in-process metrics are reported.
+func prometheusHandler(db *sql.DB, metrics *SlurploadMetrics) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		out := bufio.NewWriter(w)
+		defer out.Flush()
+
+		processed, failed, elapsed := metrics.Snapshot()
+		writePromMetric(out, "certslurp_processed_total", "counter", "Batches loaded into raw_certificates.", float64(processed))
+		writePromMetric(out, "certslurp_failed_total", "counter", "Batches or lines that failed to load.", float64(failed))
+		writePromMetric(out, "certslurp_malformed_lines_total", "counter", "Input lines that could not be parsed.", float64(metrics.MalformedLines()))
+		writePromMetric(out, "certslurp_db_retries_total", "counter", "Transient database errors that were retried.", float64(metrics.RetryCount()))
+		writePromMetric(out, "certslurp_uptime_seconds", "gauge", "Time since ingestion started.", elapsed.Seconds())
+		if metrics.RootDomains != nil {
+			writePromMetric(out, "certslurp_distinct_root_domains", "gauge", "Approximate number of distinct root domains ingested.", float64(metrics.RootDomains.Estimate()))
+		}
+		if metrics.Domains != nil {
+			cs := metrics.Domains.Stats()
+			writePromMetric(out, "certslurp_fqdn_cache_size", "gauge", "Names held in the root domain lookup cache.", float64(cs.Size))
+			writePromMetric(out, "certslurp_fqdn_cache_max_size", "gauge", "Configured capacity of the root domain lookup cache.", float64(cs.Max))
+			writePromMetric(out, "certslurp_fqdn_cache_hits_total", "counter", "Root domain lookups served from the cache.", float64(cs.Hits))
+			writePromMetric(out, "certslurp_fqdn_cache_misses_total", "counter", "Root domain lookups computed and added to the cache.", float64(cs.Misses))
+			writePromMetric(out, "certslurp_fqdn_cache_evictions_total", "counter", "Names evicted from the root domain lookup cache.", float64(cs.Evictions))
+		}
+		if metrics.Seen != nil {
+			ss := metrics.Seen.Stats()
+			writePromMetric(out, "certslurp_dedup_size", "gauge", "Certificate fingerprints held in the recently-seen set.", float64(ss.Size))
+			writePromMetric(out, "certslurp_dedup_skipped_total", "counter", "Certificates skipped as already loaded within processing.dedup_ttl.", float64(ss.Skipped))
+		}
+
+		if db == nil {
+			return
+		}
+		stats, err := readFlushStats(db)
+		if err != nil {
+			log.Printf("[warn] prometheus metrics: %v", err)
+			return
+		}
+		writePromMetric(out, "certslurp_flush_rows_inserted_total", "counter", "Rows inserted into certificates by ETL flushes.", float64(stats.RowsInserted))
+		fmt.Fprintf(out, "# HELP certslurp_flush_duration_seconds Time spent in completed ETL flushes.\n")
+		fmt.Fprintf(out, "# TYPE certslurp_flush_duration_seconds summary\n")
+		fmt.Fprintf(out, "certslurp_flush_duration_seconds_sum %g\n", stats.DurationSeconds)
+		fmt.Fprintf(out, "certslurp_flush_duration_seconds_count %d\n", stats.Count)
+		writePromMetric(out, "certslurp_flush_last_duration_seconds", "gauge", "Duration of the most recent completed ETL flush.", stats.LastSeconds)
+		writePromMetric(out, "certslurp_flush_noops_total", "counter", "ETL flushes that found nothing staged.", float64(stats.Noops))
+	}
+}
+
+func writePromMetric(w *bufio.Writer, name, typ, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, typ, name, value)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const maxRetryBackoff = 30 * time.Second
+
+// RetryPolicy bounds how transient database errors are retried. The delay
+// before retry n (starting at 0) is Backoff*2^n with jitter, capped at
+// maxRetryBackoff. A zero MaxRetries disables retries.
+type RetryPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+func retryPolicy(cfg *SlurploadConfig) RetryPolicy {
+	return RetryPolicy{MaxRetries: cfg.Database.MaxRetries, Backoff: cfg.Database.RetryBackoff}
+}
+
+// withRetry runs fn, retrying it while it fails with a retryable database
+// error. fn must be safe to repeat, e.g. a whole transaction.
+func withRetry(ctx context.Context, p RetryPolicy, metrics *SlurploadMetrics, op string, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxRetries || !isRetryableDBError(err) {
+			return err
+		}
+
+		delay := p.delay(attempt)
+		log.Printf("[warn] %s failed (attempt %d/%d), retrying in %s: %v", op, attempt+1, p.MaxRetries+1, delay, err)
+		metrics.IncRetries()
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 0; i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// Jittering over the upper half keeps concurrent workers from retrying
+	// in lockstep.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// isRetryableDBError reports whether err is worth retrying: serialization
+// failures, deadlocks and lost connections. Constraint violations and other
+// statement errors are not.
+func isRetryableDBError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "40001", // serialization_failure
+			pqErr.Code == "40P01",      // deadlock_detected
+			pqErr.Code.Class() == "08", // connection_exception
+			pqErr.Code == "57P01",      // admin_shutdown
+			pqErr.Code == "57P03":      // cannot_connect_now
+			return true
+		}
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
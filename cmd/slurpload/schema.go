@@ -46,7 +46,14 @@ CREATE TABLE IF NOT EXISTS etl_flush_metrics (
     error_count     BIGINT,
     flush_type      TEXT,
     status          TEXT,
-    notes           TEXT
+    notes           TEXT,
+    flush_count     BIGINT NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS distinct_root_domains (
+    id          INT PRIMARY KEY,
+    registers   BYTEA NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
 CREATE TABLE IF NOT EXISTS etl_progress (
@@ -54,6 +61,13 @@ CREATE TABLE IF NOT EXISTS etl_progress (
     last_processed_id BIGINT NOT NULL DEFAULT 0
 );
 
+CREATE TABLE IF NOT EXISTS ingested_files (
+    sha256       TEXT PRIMARY KEY,
+    path         TEXT NOT NULL,
+    row_count    BIGINT NOT NULL,
+    completed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
 -- Enable pg_cron
 -- CREATE EXTENSION IF NOT EXISTS pg_cron;
 -- SELECT cron.schedule('flush_raw_certificates', '*/5 * * * *', $$SELECT flush_raw_certificates()$$);
@@ -61,7 +75,7 @@ CREATE TABLE IF NOT EXISTS etl_progress (
 -- Enable pg_trgm
 CREATE EXTENSION IF NOT EXISTS pg_trgm;
 
-CREATE TABLE certificates (
+CREATE TABLE IF NOT EXISTS certificates (
     id BIGSERIAL,
     common_name TEXT,
     issuer TEXT,
@@ -95,32 +109,68 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql STABLE;
 
+DROP TRIGGER IF EXISTS sync_dns_names_text_before_insert ON certificates;
 CREATE TRIGGER sync_dns_names_text_before_insert
 BEFORE INSERT OR UPDATE ON certificates
 FOR EACH ROW EXECUTE FUNCTION sync_dns_names_text();`
 
+// schemaMigrations bring a database initialized by an earlier slurpload up to
+// date. installFlushFunc applies them before replacing the flush function;
+// runInitDB calls it after schemaSQL, whose CREATE ... IF NOT EXISTS
+// statements leave existing tables alone.
+var schemaMigrations = []string{
+	`ALTER TABLE etl_flush_metrics ADD COLUMN IF NOT EXISTS flush_count BIGINT NOT NULL DEFAULT 1`,
+	// flush_raw_certificates gained noop_mode; CREATE OR REPLACE would add
+	// an overload beside the old signature rather than replace it
+	`DROP FUNCTION IF EXISTS flush_raw_certificates(TEXT, BIGINT, BIGINT)`,
+}
+
 // Indexes are run outside transaction because "CONCURRENTLY" is not allowed inside a transaction block.
 var indexes = []string{
 	`CREATE INDEX IF NOT EXISTS etl_flush_metrics_ended_at_idx ON etl_flush_metrics (ended_at DESC);`,
 	`CREATE INDEX IF NOT EXISTS idx_certificates_not_before ON certificates (not_before);`,
-	`CREATE INDEX idx_icdn_common_name_trgm ON certificates USING gin (common_name gin_trgm_ops);`,
-	`CREATE INDEX idx_cert_dns_names_gin ON certificates USING gin (dns_names);`,
+	`CREATE INDEX IF NOT EXISTS idx_icdn_common_name_trgm ON certificates USING gin (common_name gin_trgm_ops);`,
+	`CREATE INDEX IF NOT EXISTS idx_cert_dns_names_gin ON certificates USING gin (dns_names);`,
 	`CREATE INDEX IF NOT EXISTS idx_cert_dns_names_text_trgm ON certificates USING gin (dns_names_text gin_trgm_ops);`,
-	`CREATE INDEX idx_icdn_country_notbefore ON certificates(country, not_before);`,
-	`CREATE INDEX idx_icdn_organization_notbefore ON certificates(organization, not_before);`,
+	`CREATE INDEX IF NOT EXISTS idx_icdn_country_notbefore ON certificates(country, not_before);`,
+	`CREATE INDEX IF NOT EXISTS idx_icdn_organization_notbefore ON certificates(organization, not_before);`,
 }
 
 const certificatesPartitionTemplate = `
-CREATE TABLE IF NOT EXISTS certificates_%d PARTITION OF certificates
-    FOR VALUES FROM ('%04d-01-01') TO ('%04d-01-01');
-ALTER TABLE certificates_%d
-ADD CONSTRAINT certificates_%d_unique_subject_notbefore_notafter UNIQUE (subject, not_before, not_after);
+CREATE TABLE IF NOT EXISTS %[1]s PARTITION OF certificates
+    FOR VALUES FROM ('%[2]s') TO ('%[3]s');
+ALTER TABLE %[1]s
+ADD CONSTRAINT %[1]s_unique_subject_notbefore_notafter UNIQUE (subject, not_before, not_after);
 `
 
+// flushInsertColumns and flushSelectColumns are the certificates columns
+// written by flush_raw_certificates and the tmp_batch expressions that fill
+// them, shared by the live and staging inserts.
+const flushInsertColumns = `common_name, issuer, subject, organizational_unit, organization,
+        locality, province, country, street_address, postal_code,
+        email_addresses, ip_addresses, uris, dns_names, dns_names_text,
+        root_domain, not_before, not_after`
+
+const flushSelectColumns = `common_name, issuer, subject,
+        array_to_string(organizational_unit, ','),
+        array_to_string(organization, ','),
+        array_to_string(locality, ','),
+        array_to_string(province, ','),
+        array_to_string(country, ','),
+        array_to_string(street_address, ','),
+        array_to_string(postal_code, ','),
+        array_to_string(email_addresses, ','),
+        array_to_string(ip_addresses, ','),
+        array_to_string(uris, ','),
+        dns_names,
+        array_to_string(dns_names, ','),
+        root_domain, not_before, not_after`
+
 const flushCertsFunc = `CREATE OR REPLACE FUNCTION flush_raw_certificates(
     flush_type TEXT DEFAULT 'manual',
     limit_rows BIGINT DEFAULT NULL,
-    last_processed_id BIGINT DEFAULT 0
+    last_processed_id BIGINT DEFAULT 0,
+    noop_mode TEXT DEFAULT 'record'
 ) RETURNS VOID AS $$
 DECLARE
     v_started_at      TIMESTAMPTZ := now();
@@ -132,6 +182,8 @@ DECLARE
     v_status          TEXT := 'success';
     v_notes           TEXT := '';
     v_last_id         BIGINT := 0;
+    v_inserted        BIGINT := 0;
+    v_stage           RECORD;
 BEGIN
     SET LOCAL synchronous_commit = off;
     
@@ -148,8 +200,26 @@ BEGIN
     -- Row counts, last id
     SELECT count(*), COALESCE(max(id),0) INTO v_rows_loaded, v_last_id FROM tmp_batch;
     IF v_rows_loaded = 0 THEN
+        DROP TABLE IF EXISTS tmp_batch;
+        IF noop_mode = 'skip' THEN
+            RETURN;
+        END IF;
+
         v_status := 'noop';
         v_ended_at := now();
+
+        -- Fold consecutive noops into the latest row rather than adding another
+        IF noop_mode = 'coalesce' THEN
+            UPDATE etl_flush_metrics
+               SET ended_at = v_ended_at, flush_count = flush_count + 1
+             WHERE id = (SELECT max(id) FROM etl_flush_metrics)
+               AND status = 'noop'
+               AND etl_flush_metrics.flush_type = flush_raw_certificates.flush_type;
+            IF FOUND THEN
+                RETURN;
+            END IF;
+        END IF;
+
         INSERT INTO etl_flush_metrics (
             started_at, ended_at, rows_loaded, rows_inserted, rows_deduped, error_count,
             flush_type, status, notes
@@ -160,50 +230,28 @@ BEGIN
         RETURN;
     END IF;
 
+    -- Route rows for partitions being backfilled into their staging tables
+    FOR v_stage IN SELECT staging_table, range_from, range_to FROM backfill_staging LOOP
+        EXECUTE format($stage$
+            INSERT INTO %I (` + flushInsertColumns + `)
+            SELECT ` + flushSelectColumns + `
+            FROM tmp_batch
+            WHERE not_before >= $1 AND not_before < $2
+            ON CONFLICT (subject, not_before, not_after) DO NOTHING
+        $stage$, v_stage.staging_table) USING v_stage.range_from, v_stage.range_to;
+        GET DIAGNOSTICS v_inserted = ROW_COUNT;
+        v_rows_inserted := v_rows_inserted + v_inserted;
+        DELETE FROM tmp_batch WHERE not_before >= v_stage.range_from AND not_before < v_stage.range_to;
+    END LOOP;
+
     -- Insert certificates
-    INSERT INTO certificates (
-        common_name,
-        issuer,
-        subject,
-        organizational_unit,
-        organization,
-        locality,
-        province,
-        country,
-        street_address,
-        postal_code,
-        email_addresses,
-        ip_addresses,
-        uris,
-        dns_names,
-        dns_names_text,
-        root_domain,
-        not_before,
-        not_after
-    )
-    SELECT
-        common_name,
-        issuer,
-        subject,
-        array_to_string(organizational_unit, ','),
-        array_to_string(organization, ','),
-        array_to_string(locality, ','),
-        array_to_string(province, ','),
-        array_to_string(country, ','),
-        array_to_string(street_address, ','),
-        array_to_string(postal_code, ','),
-        array_to_string(email_addresses, ','),
-        array_to_string(ip_addresses, ','),
-        array_to_string(uris, ','),
-        dns_names,
-        array_to_string(dns_names, ','),
-        root_domain,
-        not_before,
-        not_after
+    INSERT INTO certificates (` + flushInsertColumns + `)
+    SELECT ` + flushSelectColumns + `
     FROM tmp_batch
     ON CONFLICT (subject, not_before, not_after) DO NOTHING;
 
-    GET DIAGNOSTICS v_rows_inserted = ROW_COUNT;
+    GET DIAGNOSTICS v_inserted = ROW_COUNT;
+    v_rows_inserted := v_rows_inserted + v_inserted;
 
     -- Metrics & cleanup
     v_rows_deduped  := v_rows_loaded - v_rows_inserted;
@@ -243,7 +291,51 @@ EXCEPTION WHEN OTHERS THEN
 END
 $$ LANGUAGE plpgsql;`
 
-func runInitDB(db *sql.DB) error {
+// Buckets certificates by validity period (not_after - not_before), for checking
+// CA compliance with maximum lifetime rules. Filtering on not_before lets the
+// query use its index and prune partitions.
+const validityHistogramFunc = `CREATE OR REPLACE FUNCTION cert_validity_histogram(
+    from_ts TIMESTAMPTZ,
+    to_ts   TIMESTAMPTZ
+) RETURNS TABLE (bucket TEXT, cert_count BIGINT) AS $$
+    SELECT b.label, COUNT(c.ord)
+    FROM (VALUES (1, '<=90d'), (2, '<=398d'), (3, '>398d')) AS b(ord, label)
+    LEFT JOIN (
+        SELECT CASE
+            WHEN not_after - not_before <= interval '90 days'  THEN 1
+            WHEN not_after - not_before <= interval '398 days' THEN 2
+            ELSE 3
+        END AS ord
+        FROM certificates
+        WHERE not_before >= from_ts AND not_before < to_ts
+    ) c ON c.ord = b.ord
+    GROUP BY b.ord, b.label
+    ORDER BY b.ord;
+$$ LANGUAGE sql STABLE;`
+
+// installFlushFunc applies schemaMigrations, then creates or replaces the
+// flush function along with the backfill_staging table it consults. The
+// function is never installed without the migrations it depends on.
+func installFlushFunc(db *sql.DB) error {
+	for _, m := range schemaMigrations {
+		if _, err := db.Exec(m); err != nil {
+			return fmt.Errorf("schema migration: %w\nSQL: %s", err, m)
+		}
+	}
+	if _, err := db.Exec(backfillStagingTableSQL); err != nil {
+		return fmt.Errorf("create backfill_staging: %w", err)
+	}
+	if _, err := db.Exec(flushCertsFunc); err != nil {
+		return fmt.Errorf("create flush function: %w", err)
+	}
+	return nil
+}
+
+// runInitDB creates the schema, with certificates partitioned by not_before
+// at the given interval (PartitionYearly or PartitionMonthly). It can be run
+// again on an existing database to upgrade it: tables and partitions that
+// exist are kept, schemaMigrations are applied, and the functions replaced.
+func runInitDB(db *sql.DB, interval string) error {
 	log.Printf("Initializing schema...")
 	for _, stmt := range strings.Split(schemaSQL, ";") {
 		s := strings.TrimSpace(stmt)
@@ -257,27 +349,35 @@ func runInitDB(db *sql.DB) error {
 		}
 	}
 
-	for year := 2000; year <= 2070; year++ {
-		certPartitionStmt := fmt.Sprintf(certificatesPartitionTemplate, year, year, year+1, year, year)
-		_, err := db.Exec(certPartitionStmt)
-		if err != nil {
+	missing, err := MissingPartitions(db, interval, DefaultPartitionFromYear, DefaultPartitionToYear)
+	if err != nil {
+		log.Printf("cert partition check failed: %s", err)
+		return err
+	}
+	for _, p := range missing {
+		if err := createPartition(db, p); err != nil {
 			log.Printf("cert partition init failed: %s", err)
 			return err
 		}
 	}
 
-	_, err := db.Exec(syncDnsNamesTrigger)
+	_, err = db.Exec(syncDnsNamesTrigger)
 	if err != nil {
 		log.Printf("sync dns names trigger init failed: %s", err)
 		return err
 	}
 
-	_, err = db.Exec(flushCertsFunc)
-	if err != nil {
+	if err := installFlushFunc(db); err != nil {
 		log.Printf("flush certs function init failed: %s", err)
 		return err
 	}
 
+	_, err = db.Exec(validityHistogramFunc)
+	if err != nil {
+		log.Printf("validity histogram function init failed: %s", err)
+		return err
+	}
+
 	for _, idx := range indexes {
 		_, err := db.Exec(idx)
 		if err != nil {
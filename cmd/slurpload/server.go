@@ -1,8 +1,8 @@
 package main
 
 import (
-	"compress/gzip"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,13 +13,14 @@ import (
 	"strings"
 	"time"
 
-	"github.com/dsnet/compress/bzip2"
+	"github.com/chtzvt/certslurp/internal/compression"
 )
 
-func StartHTTPServer(ctx context.Context, cfg *SlurploadConfig, metrics *SlurploadMetrics) {
+func StartHTTPServer(ctx context.Context, db *sql.DB, cfg *SlurploadConfig, metrics *SlurploadMetrics) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/upload", uploadHandler(cfg.Processing.InboxDir))
 	mux.HandleFunc("/metrics", metricsHandler(metrics))
+	mux.HandleFunc("/metrics/prometheus", prometheusHandler(db, metrics))
 
 	server := &http.Server{
 		Addr:    cfg.Server.ListenAddr,
@@ -48,11 +49,28 @@ func metricsHandler(metrics *SlurploadMetrics) http.HandlerFunc {
 		w.Header().Set("Content-Type", "application/json")
 		processed, failed, elapsed := metrics.Snapshot()
 		type status struct {
-			Processed int64         `json:"processed"`
-			Failed    int64         `json:"failed"`
-			Elapsed   time.Duration `json:"elapsed"`
+			Processed           int64           `json:"processed"`
+			Failed              int64           `json:"failed"`
+			Malformed           int64           `json:"malformed"`
+			Retries             int64           `json:"retries"`
+			Elapsed             time.Duration   `json:"elapsed"`
+			DistinctRootDomains *uint64         `json:"distinct_root_domains,omitempty"`
+			FQDNCache           *FQDNCacheStats `json:"fqdn_cache,omitempty"`
+			Dedup               *SeenSetStats   `json:"dedup,omitempty"`
+		}
+		s := status{Processed: processed, Failed: failed, Malformed: metrics.MalformedLines(), Retries: metrics.RetryCount(), Elapsed: elapsed}
+		if metrics.RootDomains != nil {
+			est := metrics.RootDomains.Estimate()
+			s.DistinctRootDomains = &est
+		}
+		if metrics.Domains != nil {
+			cs := metrics.Domains.Stats()
+			s.FQDNCache = &cs
+		}
+		if metrics.Seen != nil {
+			ss := metrics.Seen.Stats()
+			s.Dedup = &ss
 		}
-		s := status{Processed: processed, Failed: failed, Elapsed: elapsed}
 		_ = json.NewEncoder(w).Encode(s)
 	}
 }
@@ -86,6 +104,12 @@ func handleUpload(w http.ResponseWriter, r *http.Request, inboxDir string) error
 		ext = ".jsonl.gz"
 	case strings.Contains(cenc, "bzip2") || strings.Contains(ctype, "bzip2"):
 		ext = ".jsonl.bz2"
+	case strings.Contains(cenc, "zstd") || strings.Contains(ctype, "zstd"):
+		ext = ".jsonl.zst"
+	case strings.Contains(cenc, "lz4") || strings.Contains(ctype, "lz4"):
+		ext = ".jsonl.lz4"
+	case cenc == "br" || strings.Contains(ctype, "brotli"):
+		ext = ".jsonl.br"
 	}
 
 	// Create temp file in inboxDir with no extension to avoid triggering watcher
@@ -125,19 +149,17 @@ func getBodyReader(r *http.Request) (io.Reader, error) {
 	cenc := strings.ToLower(r.Header.Get("Content-Encoding"))
 
 	body := r.Body
-	if strings.Contains(cenc, "gzip") || strings.Contains(ctype, "gzip") {
-		gr, err := gzip.NewReader(body)
-		if err != nil {
-			return nil, err
-		}
-		return gr, nil
-	}
-	if strings.Contains(cenc, "bzip2") || strings.Contains(ctype, "bzip2") {
-		br, err := bzip2.NewReader(body, nil)
-		if err != nil {
-			return nil, err
-		}
-		return br, nil
+	switch {
+	case strings.Contains(cenc, "gzip") || strings.Contains(ctype, "gzip"):
+		return compression.NewReader(body, "gzip")
+	case strings.Contains(cenc, "bzip2") || strings.Contains(ctype, "bzip2"):
+		return compression.NewReader(body, "bzip2")
+	case strings.Contains(cenc, "zstd") || strings.Contains(ctype, "zstd"):
+		return compression.NewReader(body, "zstd")
+	case strings.Contains(cenc, "lz4") || strings.Contains(ctype, "lz4"):
+		return compression.NewReader(body, "lz4")
+	case cenc == "br" || strings.Contains(ctype, "brotli"):
+		return compression.NewReader(body, "brotli")
 	}
 
 	return body, nil
@@ -5,20 +5,29 @@ import (
 	"compress/gzip"
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/chtzvt/certslurp/internal/compression"
 	"github.com/chtzvt/certslurp/internal/extractor"
 	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 	"github.com/stretchr/testify/require"
 )
 
@@ -51,7 +60,7 @@ Now just run your tests as usual:
 Note: Adjust the port if 5433 is taken, but make sure it matches in your DSN.
 */
 
-func setupTestDB(t *testing.T) *sql.DB {
+func setupTestDB(t testing.TB) *sql.DB {
 	dsn := os.Getenv("TEST_DATABASE_DSN")
 	if dsn == "" {
 		t.Fatal("TEST_DATABASE_DSN not set")
@@ -62,12 +71,12 @@ func setupTestDB(t *testing.T) *sql.DB {
 	_, err = db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public;")
 	require.NoError(t, err)
 
-	require.NoError(t, runInitDB(db))
+	require.NoError(t, runInitDB(db, PartitionYearly))
 
 	return db
 }
 
-func teardownTestDB(t *testing.T, db *sql.DB) {
+func teardownTestDB(t testing.TB, db *sql.DB) {
 	require.NoError(t, db.Close())
 }
 
@@ -87,6 +96,14 @@ func compressBzip2(data []byte) []byte {
 	return buf.Bytes()
 }
 
+func compressZstd(data []byte) []byte {
+	var buf bytes.Buffer
+	w, _ := zstd.NewWriter(&buf)
+	_, _ = w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
 func writeTestFile(t *testing.T, dir, ext, data string) string {
 	path := filepath.Join(dir, "test"+ext)
 	switch ext {
@@ -109,6 +126,16 @@ func writeTestFile(t *testing.T, dir, ext, data string) string {
 		require.NoError(t, err)
 		require.NoError(t, bz.Close())
 		require.NoError(t, f.Close())
+	case ".jsonl.zst":
+		require.NoError(t, os.WriteFile(path, compressZstd([]byte(data)), 0644))
+	case ".jsonl.lz4", ".jsonl.br":
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		w, err := compression.NewWriter(f, compression.CodecForName(path))
+		require.NoError(t, err)
+		_, err = w.Write([]byte(data))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
 	}
 	return path
 }
@@ -245,6 +272,69 @@ func TestDBBootstrap(t *testing.T) {
 	require.True(t, funcExists, "ETL flush function missing")
 }
 
+// rollBackToPreSeriesSchema returns db to what init-db created before
+// flush_count, the later tables and noop_mode existed, with some data to keep.
+func rollBackToPreSeriesSchema(t *testing.T, db *sql.DB) {
+	t.Helper()
+	for _, stmt := range []string{
+		`ALTER TABLE etl_flush_metrics DROP COLUMN flush_count`,
+		`DROP TABLE ingested_files, distinct_root_domains, backfill_staging`,
+		`DROP FUNCTION flush_raw_certificates(TEXT, BIGINT, BIGINT, TEXT)`,
+		`CREATE FUNCTION flush_raw_certificates(
+			flush_type TEXT DEFAULT 'manual',
+			limit_rows BIGINT DEFAULT NULL,
+			last_processed_id BIGINT DEFAULT 0
+		) RETURNS VOID AS $$ BEGIN END; $$ LANGUAGE plpgsql`,
+		`INSERT INTO etl_flush_metrics (flush_type, status) VALUES ('worker', 'success')`,
+	} {
+		_, err := db.Exec(stmt)
+		require.NoError(t, err, stmt)
+	}
+}
+
+func TestInitDB_UpgradesPreSeriesSchema(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+	rollBackToPreSeriesSchema(t, db)
+
+	require.NoError(t, runInitDB(db, PartitionYearly))
+
+	var rows int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM etl_flush_metrics`).Scan(&rows))
+	require.Equal(t, 1, rows, "existing flush metrics should be kept")
+
+	var overloads int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM pg_proc WHERE proname = 'flush_raw_certificates'`).Scan(&overloads))
+	require.Equal(t, 1, overloads, "the old flush function signature should be replaced")
+
+	// Both the worker's short call and a coalescing flush resolve and run
+	_, err := db.Exec(`SELECT flush_raw_certificates($1)`, "worker")
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err := db.Exec(`SELECT flush_raw_certificates($1, $2, $3, $4)`, "worker", nil, 0, NoopFlushCoalesce)
+		require.NoError(t, err)
+	}
+	var count int64
+	require.NoError(t, db.QueryRow(`SELECT flush_count FROM etl_flush_metrics ORDER BY id DESC LIMIT 1`).Scan(&count))
+	require.EqualValues(t, 3, count)
+}
+
+func TestStagePartition_UpgradesPreSeriesSchema(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+	rollBackToPreSeriesSchema(t, db)
+
+	// Staging installs the current flush function, so it has to bring the
+	// columns that function writes along with it
+	require.NoError(t, StagePartition(db, Partition{Year: 2024}))
+	require.NoError(t, FlushNow(db))
+	_, err := db.Exec(`SELECT flush_raw_certificates($1, $2, $3, $4)`, "worker", nil, 0, NoopFlushCoalesce)
+	require.NoError(t, err)
+	var count int64
+	require.NoError(t, db.QueryRow(`SELECT flush_count FROM etl_flush_metrics ORDER BY id DESC LIMIT 1`).Scan(&count))
+	require.EqualValues(t, 2, count)
+}
+
 func TestPartitionTables(t *testing.T) {
 	db := setupTestDB(t)
 	defer teardownTestDB(t, db)
@@ -263,6 +353,182 @@ func TestPartitionTables(t *testing.T) {
 	require.True(t, found, "at least one certificates_* partition should exist")
 }
 
+func TestCheckPartitions_DetectsAndRepairsGap(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	missing, err := CheckPartitions(db, PartitionYearly, DefaultPartitionFromYear, DefaultPartitionToYear, false)
+	require.NoError(t, err)
+	require.Empty(t, missing)
+
+	_, err = db.Exec(`DROP TABLE certificates_2024`)
+	require.NoError(t, err)
+
+	// Without repair, the gap is only reported
+	missing, err = CheckPartitions(db, PartitionYearly, DefaultPartitionFromYear, DefaultPartitionToYear, false)
+	require.NoError(t, err)
+	require.Equal(t, []Partition{{Year: 2024}}, missing)
+	missing, err = CheckPartitions(db, PartitionYearly, 2025, 2030, false)
+	require.NoError(t, err)
+	require.Empty(t, missing)
+
+	// With repair, the partition is recreated and certs from that year flush again
+	missing, err = CheckPartitions(db, PartitionYearly, DefaultPartitionFromYear, DefaultPartitionToYear, true)
+	require.NoError(t, err)
+	require.Equal(t, []Partition{{Year: 2024}}, missing)
+	missing, err = MissingPartitions(db, PartitionYearly, DefaultPartitionFromYear, DefaultPartitionToYear)
+	require.NoError(t, err)
+	require.Empty(t, missing)
+
+	metrics := NewSlurploadMetrics()
+	metrics.Start()
+	require.NoError(t, insertBatch(context.Background(), db, copyTestCerts(1), 0, RetryPolicy{}, 0, metrics))
+	require.NoError(t, FlushNow(db))
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM certificates_2024`).Scan(&count))
+	require.Equal(t, 1, count)
+}
+
+func TestPartition_Bounds(t *testing.T) {
+	from, to := Partition{Year: 2024}.bounds()
+	require.Equal(t, "2024-01-01", from)
+	require.Equal(t, "2025-01-01", to)
+	from, to = Partition{Year: 2024, Month: 12}.bounds()
+	require.Equal(t, "2024-12-01", from)
+	require.Equal(t, "2025-01-01", to)
+
+	for _, p := range []Partition{{Year: 2024}, {Year: 2024, Month: 3}} {
+		got, ok := parsePartitionTable(p.table())
+		require.True(t, ok)
+		require.Equal(t, p, got)
+	}
+	_, ok := parsePartitionTable("certificates_default")
+	require.False(t, ok)
+
+	require.Len(t, partitionsInRange(PartitionYearly, 2024, 2025), 2)
+	require.Len(t, partitionsInRange(PartitionMonthly, 2024, 2025), 24)
+}
+
+func TestMonthlyPartitions_RouteByNotBefore(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	_, err := db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public;")
+	require.NoError(t, err)
+	require.NoError(t, runInitDB(db, PartitionMonthly))
+
+	missing, err := CheckPartitions(db, PartitionMonthly, DefaultPartitionFromYear, DefaultPartitionToYear, false)
+	require.NoError(t, err)
+	require.Empty(t, missing)
+
+	// copyTestCerts starts in May 2024; move one cert into the next month
+	certs := copyTestCerts(2)
+	certs[1].NotBefore = time.Date(2024, 6, 30, 23, 59, 59, 0, time.UTC)
+
+	metrics := NewSlurploadMetrics()
+	metrics.Start()
+	require.NoError(t, insertBatch(context.Background(), db, certs, 0, RetryPolicy{}, 0, metrics))
+	require.NoError(t, FlushNow(db))
+
+	for table, want := range map[string]int{"certificates_2024_05": 1, "certificates_2024_06": 1, "certificates_2024_07": 0} {
+		var count int
+		require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM `+table).Scan(&count))
+		require.Equal(t, want, count, table)
+	}
+
+	// Replaying the batch is deduplicated within each month's partition
+	require.NoError(t, insertBatch(context.Background(), db, certs, 0, RetryPolicy{}, 0, metrics))
+	require.NoError(t, FlushNow(db))
+	var total int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM certificates`).Scan(&total))
+	require.Equal(t, 2, total)
+
+	_, err = db.Exec(`DROP TABLE certificates_2024_06`)
+	require.NoError(t, err)
+	missing, err = CheckPartitions(db, PartitionMonthly, 2024, 2024, true)
+	require.NoError(t, err)
+	require.Equal(t, []Partition{{Year: 2024, Month: 6}}, missing)
+}
+
+func TestStagedBackfill_AttachMakesRowsQueryable(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+	ctx := context.Background()
+	metrics := NewSlurploadMetrics()
+	metrics.Start()
+
+	countRows := func(query string) int {
+		var n int
+		require.NoError(t, db.QueryRow(query).Scan(&n))
+		return n
+	}
+
+	// copyTestCerts starts in May 2024; one cert is already live, and one
+	// belongs to 2023, which isn't being backfilled
+	certs := copyTestCerts(4)
+	certs[3].NotBefore = time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, insertBatch(ctx, db, certs[:1], 0, RetryPolicy{}, 0, metrics))
+	require.NoError(t, FlushNow(db))
+
+	p := Partition{Year: 2024}
+	require.NoError(t, StagePartition(db, p))
+	require.Error(t, StagePartition(db, p))
+	staged, err := StagedPartitions(db)
+	require.NoError(t, err)
+	require.Equal(t, []Partition{p}, staged)
+
+	// The backfill replays the live cert too
+	require.NoError(t, insertBatch(ctx, db, certs, 0, RetryPolicy{}, 0, metrics))
+	require.NoError(t, FlushNow(db))
+
+	require.Equal(t, 1, countRows(`SELECT COUNT(*) FROM certificates WHERE not_before >= '2024-01-01' AND not_before < '2025-01-01'`))
+	require.Equal(t, 3, countRows(`SELECT COUNT(*) FROM certificates_2024_staging`))
+	require.Equal(t, 1, countRows(`SELECT COUNT(*) FROM certificates_2023`))
+	require.Zero(t, countRows(`SELECT COUNT(*) FROM raw_certificates`))
+
+	require.NoError(t, AttachStagedPartition(db, p))
+	require.ErrorIs(t, AttachStagedPartition(db, p), errNotStaged)
+
+	// The whole year is queryable through certificates, deduplicated against
+	// what was already live
+	require.Equal(t, 3, countRows(`SELECT COUNT(*) FROM certificates WHERE not_before >= '2024-01-01' AND not_before < '2025-01-01'`))
+	require.Equal(t, 3, countRows(`SELECT COUNT(*) FROM certificates_2024`))
+	require.Equal(t, 1, countRows(`SELECT COUNT(*) FROM certificates WHERE common_name = 'copy-0.example.com'`))
+	require.Zero(t, countRows(`SELECT COUNT(*) FROM pg_class WHERE relname = 'certificates_2024_staging'`))
+	missing, err := MissingPartitions(db, PartitionYearly, DefaultPartitionFromYear, DefaultPartitionToYear)
+	require.NoError(t, err)
+	require.Empty(t, missing)
+	staged, err = StagedPartitions(db)
+	require.NoError(t, err)
+	require.Empty(t, staged)
+
+	// Later flushes land in the attached partition
+	more := copyTestCerts(5)[4:]
+	require.NoError(t, insertBatch(ctx, db, more, 0, RetryPolicy{}, 0, metrics))
+	require.NoError(t, FlushNow(db))
+	require.Equal(t, 4, countRows(`SELECT COUNT(*) FROM certificates_2024`))
+}
+
+func TestParsePartition(t *testing.T) {
+	p, err := parsePartition("2024", PartitionYearly)
+	require.NoError(t, err)
+	require.Equal(t, Partition{Year: 2024}, p)
+	p, err = parsePartition("2024-03", PartitionMonthly)
+	require.NoError(t, err)
+	require.Equal(t, Partition{Year: 2024, Month: 3}, p)
+
+	for _, tc := range []struct{ arg, interval string }{
+		{"2024-03", PartitionYearly},
+		{"2024", PartitionMonthly},
+		{"2024-13", PartitionMonthly},
+		{"24", PartitionYearly},
+		{"certificates_2024", PartitionYearly},
+	} {
+		_, err := parsePartition(tc.arg, tc.interval)
+		require.Error(t, err, tc.arg)
+	}
+}
+
 func TestInsertBatch(t *testing.T) {
 	db := setupTestDB(t)
 	defer teardownTestDB(t, db)
@@ -286,7 +552,7 @@ func TestInsertBatch(t *testing.T) {
 	err := insertBatch(
 		context.Background(), db,
 		[]extractor.CertFieldsExtractorOutput{cert},
-		0, metrics)
+		0, RetryPolicy{}, 0, metrics)
 	require.NoError(t, err)
 
 	require.NoError(t, FlushNow(db))
@@ -298,6 +564,248 @@ func TestInsertBatch(t *testing.T) {
 	require.Equal(t, "www.example.com", cn)
 }
 
+func copyTestCerts(n int) []extractor.CertFieldsExtractorOutput {
+	base := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	certs := make([]extractor.CertFieldsExtractorOutput, 0, n)
+	for i := 0; i < n; i++ {
+		cn := fmt.Sprintf("copy-%d.example.com", i)
+		cert := extractor.CertFieldsExtractorOutput{
+			Type:         "cert",
+			CommonName:   cn,
+			DNSNames:     []string{cn, "www." + cn},
+			Subject:      fmt.Sprintf("CN=%s,O=Example\\, \"Quoted\"\tCorp", cn),
+			Issuer:       "Test CA",
+			SerialNumber: strconv.Itoa(i),
+			NotBefore:    base.Add(time.Duration(i) * time.Minute),
+			NotAfter:     base.AddDate(0, 3, 0),
+			LogIndex:     int64(i),
+			LogTimestamp: base,
+		}
+		switch i % 3 {
+		case 0: // NULL arrays
+		case 1:
+			cert.Organization = []string{"Example, Inc.", `Back\slash`}
+			cert.IPAddresses = []string{"192.0.2.1"}
+		case 2:
+			cert.EmailAddresses = []string{}
+			cert.Country = []string{"US"}
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+func TestInsertBatch_CopyMatchesInsert(t *testing.T) {
+	certs := copyTestCerts(9)
+
+	load := func(copyThreshold int) []string {
+		db := setupTestDB(t)
+		defer teardownTestDB(t, db)
+
+		metrics := NewSlurploadMetrics()
+		metrics.Start()
+		require.NoError(t, insertBatch(context.Background(), db, certs, copyThreshold, RetryPolicy{}, 0, metrics))
+		processed, failed, _ := metrics.Snapshot()
+		require.EqualValues(t, 1, processed)
+		require.Zero(t, failed)
+
+		require.NoError(t, FlushNow(db))
+
+		rows, err := db.Query(`SELECT (to_jsonb(c) - 'id')::text FROM certificates c ORDER BY subject`)
+		require.NoError(t, err)
+		defer rows.Close()
+		var out []string
+		for rows.Next() {
+			var row string
+			require.NoError(t, rows.Scan(&row))
+			out = append(out, row)
+		}
+		require.NoError(t, rows.Err())
+		return out
+	}
+
+	viaCopy := load(1)
+	viaInsert := load(len(certs) + 1)
+	require.Len(t, viaCopy, len(certs))
+	require.Equal(t, viaCopy, viaInsert)
+}
+
+func BenchmarkInsertBatch(b *testing.B) {
+	db := setupTestDB(b)
+	defer teardownTestDB(b, db)
+	batch := copyTestCerts(1000)
+
+	for _, bc := range []struct {
+		name          string
+		copyThreshold int
+	}{
+		{"insert", len(batch) + 1},
+		{"copy", 1},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			metrics := NewSlurploadMetrics()
+			metrics.Start()
+			for i := 0; i < b.N; i++ {
+				if err := insertBatch(context.Background(), db, batch, bc.copyThreshold, RetryPolicy{}, 0, metrics); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			_, _ = db.Exec(`TRUNCATE raw_certificates`)
+			b.StartTimer()
+		})
+	}
+}
+
+func TestRootDomainFor(t *testing.T) {
+	cases := []struct {
+		name string
+		cert extractor.CertFieldsExtractorOutput
+		want string
+	}{
+		{"simple", extractor.CertFieldsExtractorOutput{CommonName: "www.example.com"}, "example.com"},
+		{"co.uk", extractor.CertFieldsExtractorOutput{CommonName: "shop.foo.co.uk"}, "foo.co.uk"},
+		{"com.cn", extractor.CertFieldsExtractorOutput{CommonName: "a.b.example.com.cn"}, "example.com.cn"},
+		{"wildcard", extractor.CertFieldsExtractorOutput{CommonName: "*.foo.co.uk"}, "foo.co.uk"},
+		{"case and trailing dot", extractor.CertFieldsExtractorOutput{CommonName: "WWW.Example.COM."}, "example.com"},
+		{"punycode", extractor.CertFieldsExtractorOutput{CommonName: "www.xn--bcher-kva.de"}, "xn--bcher-kva.de"},
+		{"unicode idn", extractor.CertFieldsExtractorOutput{CommonName: "www.bücher.de"}, "xn--bcher-kva.de"},
+		{"empty cn uses san", extractor.CertFieldsExtractorOutput{DNSNames: []string{"*.shop.com.cn"}}, "shop.com.cn"},
+		{"non-hostname cn uses san", extractor.CertFieldsExtractorOutput{CommonName: "Acme Server", DNSNames: []string{"192.0.2.1", "api.acme.co.uk"}}, "acme.co.uk"},
+		{"wildcard public suffix skipped", extractor.CertFieldsExtractorOutput{CommonName: "*.co.uk", DNSNames: []string{"www.example.org"}}, "example.org"},
+		{"ip only falls back to cn", extractor.CertFieldsExtractorOutput{CommonName: "192.0.2.1"}, "192.0.2.1"},
+		{"no names", extractor.CertFieldsExtractorOutput{}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, rootDomainFor(tc.cert, nil))
+			require.Equal(t, tc.want, rootDomainFor(tc.cert, NewFQDNCache(4)))
+		})
+	}
+}
+
+func TestFQDNCache_MaxSizeAndEvictions(t *testing.T) {
+	cache := NewFQDNCache(2)
+	lookup := func(name string) string {
+		return rootDomainFor(extractor.CertFieldsExtractorOutput{CommonName: name}, cache)
+	}
+
+	require.Equal(t, "example.com", lookup("www.example.com"))
+	require.Equal(t, "foo.co.uk", lookup("shop.foo.co.uk"))
+	require.Equal(t, "example.com", lookup("www.example.com")) // hit; now most recently used
+	require.Equal(t, FQDNCacheStats{Size: 2, Max: 2, Hits: 1, Misses: 2}, cache.Stats())
+
+	// A third name evicts the least recently used one
+	require.Equal(t, "example.org", lookup("a.example.org"))
+	stats := cache.Stats()
+	require.Equal(t, 2, stats.Size)
+	require.EqualValues(t, 1, stats.Evictions)
+	require.Equal(t, "foo.co.uk", lookup("shop.foo.co.uk"))
+	require.EqualValues(t, 4, cache.Stats().Misses, "evicted name should be looked up again")
+
+	for i := 0; i < 10; i++ {
+		lookup(fmt.Sprintf("host%d.example.net", i))
+	}
+	stats = cache.Stats()
+	require.Equal(t, 2, stats.Size)
+	require.EqualValues(t, 12, stats.Evictions)
+
+	// Shrinking under memory pressure counts as eviction too
+	cache.Shrink(0)
+	stats = cache.Stats()
+	require.Equal(t, 0, stats.Size)
+	require.EqualValues(t, 14, stats.Evictions)
+}
+
+func TestSeenSet_TTLAndMaxSize(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	seen := NewSeenSet(3, time.Hour)
+	seen.now = func() time.Time { return now }
+	certs := copyTestCerts(5)
+
+	// Repeats within a batch are dropped too
+	batch := seen.Filter(append(certs[:2:2], certs[0]))
+	require.Len(t, batch, 2)
+	seen.Add(batch)
+	require.Len(t, seen.Filter(certs[:3]), 1)
+
+	// Fingerprints expire after the TTL
+	now = now.Add(2 * time.Hour)
+	require.Len(t, seen.Filter(certs[:3]), 3)
+
+	// Only the most recent max fingerprints are kept
+	seen.Add(certs)
+	require.Equal(t, 3, seen.Stats().Size)
+	require.Len(t, seen.Filter(certs), 2)
+	require.EqualValues(t, 1+2+3, seen.Stats().Skipped)
+
+	var none *SeenSet
+	require.Len(t, none.Filter(certs), 5)
+}
+
+func TestInsertBatch_DedupSkipsOverlappingInput(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+	ctx := context.Background()
+
+	countRaw := func() int {
+		var n int
+		require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM raw_certificates`).Scan(&n))
+		return n
+	}
+
+	metrics := NewSlurploadMetrics()
+	metrics.Start()
+	metrics.Seen = NewSeenSet(DefaultDedupSize, time.Hour)
+
+	// The second archive overlaps the first; only its new records are staged
+	require.NoError(t, insertBatch(ctx, db, copyTestCerts(4), 0, RetryPolicy{}, 0, metrics))
+	require.Equal(t, 4, countRaw())
+	require.NoError(t, insertBatch(ctx, db, copyTestCerts(6), 0, RetryPolicy{}, 0, metrics))
+	require.Equal(t, 6, countRaw())
+	require.EqualValues(t, 4, metrics.Seen.Stats().Skipped)
+
+	// A fully duplicate archive stages nothing, but still counts as loaded
+	processed, _, _ := metrics.Snapshot()
+	require.NoError(t, insertBatch(ctx, db, copyTestCerts(6), 0, RetryPolicy{}, 0, metrics))
+	require.Equal(t, 6, countRaw())
+	after, _, _ := metrics.Snapshot()
+	require.Equal(t, processed+1, after)
+
+	require.NoError(t, FlushNow(db))
+	var total int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM certificates`).Scan(&total))
+	require.Equal(t, 6, total)
+}
+
+func TestInsertBatch_PopulatesRootDomain(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	certs := []extractor.CertFieldsExtractorOutput{
+		{CommonName: "www.foo.co.uk", Subject: "CN=www.foo.co.uk", NotBefore: base, NotAfter: base.AddDate(0, 3, 0)},
+		{DNSNames: []string{"*.shop.com.cn"}, Subject: "O=No CN", NotBefore: base, NotAfter: base.AddDate(0, 3, 0)},
+	}
+	metrics := NewSlurploadMetrics()
+	metrics.Start()
+	require.NoError(t, insertBatch(context.Background(), db, certs, 0, RetryPolicy{}, 0, metrics))
+	require.NoError(t, FlushNow(db))
+
+	rows, err := db.Query(`SELECT root_domain FROM certificates ORDER BY subject`)
+	require.NoError(t, err)
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var d string
+		require.NoError(t, rows.Scan(&d))
+		require.NotEmpty(t, d)
+		got = append(got, d)
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, []string{"foo.co.uk", "shop.com.cn"}, got)
+}
+
 func TestETLFlush_Basic(t *testing.T) {
 	db := setupTestDB(t)
 	defer teardownTestDB(t, db)
@@ -513,9 +1021,98 @@ func TestETLFlush_MetricsTable(t *testing.T) {
 	require.Equal(t, "success", status)
 }
 
-func TestProcessFileJob_Plain_Gz_Bz2(t *testing.T) {
+func TestETLFlush_NoopFlushes(t *testing.T) {
+	cases := []struct {
+		mode      string
+		wantRows  int
+		wantCount int64
+	}{
+		{NoopFlushRecord, 4, 1},
+		{NoopFlushSkip, 0, 0},
+		{NoopFlushCoalesce, 1, 4},
+	}
+	for _, tc := range cases {
+		t.Run(tc.mode, func(t *testing.T) {
+			db := setupTestDB(t)
+			defer teardownTestDB(t, db)
+
+			cfg := &SlurploadConfig{}
+			cfg.Processing.FlushThreshold = 0
+			cfg.Processing.NoopFlushes = tc.mode
+
+			metrics := NewSlurploadMetrics()
+			metrics.Start()
+
+			// Nothing is staged, so every flush is a noop
+			for i := 0; i < 4; i++ {
+				FlushIfNeeded(db, cfg, metrics)
+			}
+
+			var rows int
+			require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM etl_flush_metrics WHERE status = 'noop'`).Scan(&rows))
+			require.Equal(t, tc.wantRows, rows)
+
+			if rows > 0 {
+				var count int64
+				require.NoError(t, db.QueryRow(
+					`SELECT flush_count FROM etl_flush_metrics ORDER BY id DESC LIMIT 1`,
+				).Scan(&count))
+				require.Equal(t, tc.wantCount, count)
+			}
+		})
+	}
+}
+
+func TestValidityHistogram(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	certs := []struct {
+		notBefore time.Time
+		validity  time.Duration
+	}{
+		{base, 90 * 24 * time.Hour}, // boundary is inclusive
+		{base.Add(time.Hour), 47 * 24 * time.Hour},
+		{base.Add(2 * time.Hour), 200 * 24 * time.Hour},
+		{base.Add(3 * time.Hour), 398 * 24 * time.Hour},
+		{base.Add(4 * time.Hour), 399 * 24 * time.Hour},
+		{base.Add(5 * time.Hour), 825 * 24 * time.Hour},
+		{base.AddDate(0, 2, 0), 30 * 24 * time.Hour}, // outside the queried range
+	}
+	for i, c := range certs {
+		name := fmt.Sprintf("validity-%d.com", i)
+		_, err := db.Exec(`
+			INSERT INTO raw_certificates (
+				cert_type, common_name, dns_names, root_domain, not_before, not_after, subject, log_index
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			"cert", name, pq.Array([]string{name}), name,
+			c.notBefore, c.notBefore.Add(c.validity), "CN="+name, 500+i,
+		)
+		require.NoError(t, err)
+	}
+	require.NoError(t, FlushNow(db))
+
+	buckets, err := ValidityHistogram(db, base, base.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	require.Equal(t, []ValidityBucket{
+		{Bucket: "<=90d", Count: 2},
+		{Bucket: "<=398d", Count: 2},
+		{Bucket: ">398d", Count: 2},
+	}, buckets)
+
+	// Empty ranges still report every bucket
+	buckets, err = ValidityHistogram(db, base.AddDate(-1, 0, 0), base.AddDate(0, -1, 0))
+	require.NoError(t, err)
+	require.Len(t, buckets, 3)
+	for _, b := range buckets {
+		require.Zero(t, b.Count)
+	}
+}
+
+func TestProcessFileJob_Plain_Gz_Bz2_Zst_LZ4(t *testing.T) {
 	dir := t.TempDir()
-	for _, ext := range []string{".jsonl", ".jsonl.gz", ".jsonl.bz2"} {
+	for _, ext := range []string{".jsonl", ".jsonl.gz", ".jsonl.bz2", ".jsonl.zst", ".jsonl.lz4", ".jsonl.br"} {
 		t.Run(ext, func(t *testing.T) {
 			db := setupTestDB(t)
 			defer teardownTestDB(t, db)
@@ -523,7 +1120,7 @@ func TestProcessFileJob_Plain_Gz_Bz2(t *testing.T) {
 			metrics := NewSlurploadMetrics()
 			metrics.Start()
 			job := InsertJob{Name: filepath.Base(path), Path: path}
-			err := processFileJob(context.Background(), db, job, 10, 0, metrics)
+			err := processFileJob(context.Background(), db, job, 10, 0, RetryPolicy{}, 0, metrics, "", false)
 			require.NoError(t, err)
 
 			require.NoError(t, FlushNow(db))
@@ -535,6 +1132,211 @@ func TestProcessFileJob_Plain_Gz_Bz2(t *testing.T) {
 	}
 }
 
+func TestGetReader_Zstd(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), ".jsonl.zst", testJsonl)
+
+	r, err := getReader(path, false, false, true, false)
+	require.NoError(t, err)
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, testJsonl, string(out))
+}
+
+func TestGetReader_LZ4(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), ".jsonl.lz4", testJsonl)
+	require.Equal(t, "lz4", compression.CodecForName(path))
+
+	r, err := getReader(path, false, false, false, true)
+	require.NoError(t, err)
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, testJsonl, string(out))
+}
+
+func TestProcessFileJob_DeadLetter(t *testing.T) {
+	mixed := testData + "\n{not json\n\n" + testJsonlLine(2) + "\n" + `{"cn": 42}` + "\n"
+
+	t.Run("deadletter dir", func(t *testing.T) {
+		db := setupTestDB(t)
+		defer teardownTestDB(t, db)
+		dlDir := t.TempDir()
+		path := writeTestFile(t, t.TempDir(), ".jsonl", mixed)
+
+		metrics := NewSlurploadMetrics()
+		metrics.Start()
+		job := InsertJob{Name: filepath.Base(path), Path: path}
+		require.NoError(t, processFileJob(context.Background(), db, job, 10, 0, RetryPolicy{}, 0, metrics, dlDir, false))
+		require.NoError(t, FlushNow(db))
+
+		var count int
+		require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM certificates`).Scan(&count))
+		require.Equal(t, 2, count)
+		require.EqualValues(t, 2, metrics.MalformedLines())
+		_, failed, _ := metrics.Snapshot()
+		require.Zero(t, failed)
+		require.Contains(t, metrics.String(), "malformed lines=2")
+
+		data, err := os.ReadFile(deadLetterPath(dlDir, path))
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		require.Len(t, lines, 2)
+		var first, second deadLetter
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+		require.Equal(t, 2, first.Line)
+		require.Equal(t, "{not json", first.Raw)
+		require.NotEmpty(t, first.Error)
+		require.Equal(t, 5, second.Line)
+		require.Equal(t, path, second.Source)
+	})
+
+	t.Run("no deadletter dir", func(t *testing.T) {
+		db := setupTestDB(t)
+		defer teardownTestDB(t, db)
+		path := writeTestFile(t, t.TempDir(), ".jsonl", mixed)
+
+		metrics := NewSlurploadMetrics()
+		metrics.Start()
+		job := InsertJob{Name: filepath.Base(path), Path: path}
+		require.NoError(t, processFileJob(context.Background(), db, job, 10, 0, RetryPolicy{}, 0, metrics, "", false))
+
+		// Malformed lines are skipped and counted as failures, as before
+		_, failed, _ := metrics.Snapshot()
+		require.EqualValues(t, 2, failed)
+		require.EqualValues(t, 2, metrics.MalformedLines())
+	})
+}
+
+func TestProcessFileJob_SkipDuplicateFiles(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, ".jsonl", testJsonl)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	countRaw := func() int {
+		var n int
+		require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM raw_certificates`).Scan(&n))
+		return n
+	}
+
+	metrics := NewSlurploadMetrics()
+	metrics.Start()
+	job := InsertJob{Name: filepath.Base(path), Path: path}
+	require.NoError(t, processFileJob(context.Background(), db, job, 10, 0, RetryPolicy{}, 0, metrics, "", true))
+	first := countRaw()
+	require.Positive(t, first)
+
+	var rows int64
+	var ledgerPath string
+	require.NoError(t, db.QueryRow(`SELECT path, row_count FROM ingested_files`).Scan(&ledgerPath, &rows))
+	require.Equal(t, path, ledgerPath)
+	require.EqualValues(t, first, rows)
+
+	// The same contents reappearing under a different name are skipped.
+	again := filepath.Join(dir, "again.jsonl")
+	require.NoError(t, os.WriteFile(again, data, 0644))
+	require.NoError(t, processFileJob(context.Background(), db, job, 10, 0, RetryPolicy{}, 0, metrics, "", true))
+	require.NoError(t, processFileJob(context.Background(), db, InsertJob{Name: "again.jsonl", Path: again}, 10, 0, RetryPolicy{}, 0, metrics, "", true))
+	require.Equal(t, first, countRaw())
+
+	// With the toggle off the file is loaded again.
+	require.NoError(t, processFileJob(context.Background(), db, job, 10, 0, RetryPolicy{}, 0, metrics, "", false))
+	require.Equal(t, 2*first, countRaw())
+}
+
+// flakyDB is a fake database/sql driver whose Begin fails with err for the
+// first failures calls and succeeds afterwards.
+type flakyDB struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	begins   int
+}
+
+func (d *flakyDB) Connect(context.Context) (driver.Conn, error) { return flakyConn{d}, nil }
+func (d *flakyDB) Driver() driver.Driver                        { return nil }
+
+type flakyConn struct{ d *flakyDB }
+
+func (c flakyConn) Prepare(string) (driver.Stmt, error) { return flakyStmt{}, nil }
+func (c flakyConn) Close() error                        { return nil }
+func (c flakyConn) Begin() (driver.Tx, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.begins++
+	if c.d.failures > 0 {
+		c.d.failures--
+		return nil, c.d.err
+	}
+	return flakyTx{}, nil
+}
+
+type flakyTx struct{}
+
+func (flakyTx) Commit() error   { return nil }
+func (flakyTx) Rollback() error { return nil }
+
+type flakyStmt struct{}
+
+func (flakyStmt) Close() error  { return nil }
+func (flakyStmt) NumInput() int { return -1 }
+func (flakyStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (flakyStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func TestInsertBatch_RetriesTransientErrors(t *testing.T) {
+	retry := RetryPolicy{MaxRetries: 3, Backoff: time.Millisecond}
+	certs := copyTestCerts(3)
+
+	cases := []struct {
+		name        string
+		failures    int
+		err         error
+		wantErr     bool
+		wantRetries int64
+		wantBegins  int
+	}{
+		{"deadlock", 2, &pq.Error{Code: "40P01"}, false, 2, 3},
+		{"serialization failure", 1, &pq.Error{Code: "40001"}, false, 1, 2},
+		{"connection reset", 3, driver.ErrBadConn, false, 1, 4},
+		{"retries exhausted", 5, &pq.Error{Code: "40P01"}, true, 3, 4},
+		{"unique violation", 1, &pq.Error{Code: "23505"}, true, 0, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &flakyDB{failures: tc.failures, err: tc.err}
+			db := sql.OpenDB(fake)
+			defer db.Close()
+
+			metrics := NewSlurploadMetrics()
+			metrics.Start()
+			err := insertBatch(context.Background(), db, certs, 1000, retry, 0, metrics)
+			processed, failed, _ := metrics.Snapshot()
+			if tc.wantErr {
+				require.Error(t, err)
+				require.EqualValues(t, 1, failed)
+				require.Zero(t, processed)
+			} else {
+				require.NoError(t, err)
+				require.EqualValues(t, 1, processed)
+				require.Zero(t, failed)
+			}
+			require.Equal(t, tc.wantRetries, metrics.RetryCount())
+			require.Equal(t, tc.wantBegins, fake.begins)
+		})
+	}
+}
+
+func testJsonlLine(n int) string {
+	return strings.Split(strings.TrimSpace(testJsonl), "\n")[n]
+}
+
 const testData string = `{"cn":"www.example.com","dns":["www.example.com"],"ou":["IT"],"o":["ExampleCorp"],"l":["Mountain View"],"c":["US"],"sub":"CN=www.example.com,O=ExampleCorp","nbf":"2023-01-01T00:00:00Z","naf":"2024-01-01T00:00:00Z","en":1}`
 
 func TestHTTPEndpoint(t *testing.T) {
@@ -574,7 +1376,7 @@ func TestHTTPEndpoint(t *testing.T) {
 	// Process the file
 	metrics := NewSlurploadMetrics()
 	metrics.Start()
-	err = processFileJob(context.Background(), db, job, 10, 0, metrics)
+	err = processFileJob(context.Background(), db, job, 10, 0, RetryPolicy{}, 0, metrics, "", false)
 	require.NoError(t, FlushNow(db))
 	require.NoError(t, err)
 
@@ -631,7 +1433,7 @@ func TestInboxWatcher_Workers_E2E(t *testing.T) {
 		go func() {
 			defer wg.Done()
 			for job := range jobs {
-				_ = processFileJob(context.Background(), db, job, 10, 0, metrics)
+				_ = processFileJob(context.Background(), db, job, 10, 0, RetryPolicy{}, 0, metrics, "", false)
 			}
 		}()
 	}
@@ -654,7 +1456,7 @@ func TestHTTPEndpoint_Compressed(t *testing.T) {
 	inboxDir := t.TempDir()
 	stop := make(chan struct{})
 	jobs := make(chan InsertJob, 2)
-	cfg := NewWatcherConfig(inboxDir, "", []string{"*.jsonl", "*.jsonl.gz", "*.jsonl.bz2"}, 50*time.Millisecond)
+	cfg := NewWatcherConfig(inboxDir, "", []string{"*.jsonl", "*.jsonl.gz", "*.jsonl.bz2", "*.jsonl.zst"}, 50*time.Millisecond)
 	go StartInboxWatcher(cfg, jobs, stop)
 
 	srv := httptest.NewUnstartedServer(uploadHandler(inboxDir))
@@ -690,6 +1492,13 @@ func TestHTTPEndpoint_Compressed(t *testing.T) {
 			encoding: "bzip2",
 			ext:      ".jsonl.bz2",
 		},
+		{
+			name:     "zstd",
+			content:  compressZstd([]byte(testData)),
+			ct:       "application/json",
+			encoding: "zstd",
+			ext:      ".jsonl.zst",
+		},
 	}
 
 	for _, tc := range tests {
@@ -714,11 +1523,12 @@ func TestHTTPEndpoint_Compressed(t *testing.T) {
 				close(stop)
 				t.Fatalf("timed out waiting for watcher to enqueue job for %s", tc.name)
 			}
+			require.True(t, strings.HasSuffix(job.Path, tc.ext), "unexpected inbox file %s", job.Path)
 
 			metrics := NewSlurploadMetrics()
 			metrics.Start()
 
-			err = processFileJob(context.Background(), db, job, 10, 0, metrics)
+			err = processFileJob(context.Background(), db, job, 10, 0, RetryPolicy{}, 0, metrics, "", false)
 			require.NoError(t, err)
 
 			require.NoError(t, FlushNow(db))
@@ -732,6 +1542,66 @@ func TestHTTPEndpoint_Compressed(t *testing.T) {
 	close(stop)
 }
 
+func TestInboxWatcher_NotifyQueuesPromptly(t *testing.T) {
+	inboxDir := t.TempDir()
+	jobs := make(chan InsertJob, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// Poll far less often than the test waits, so only events can deliver the file
+	cfg := NewWatcherConfig(inboxDir, "", []string{"*.jsonl"}, time.Hour)
+	cfg.Mode, cfg.SettleDelay = InboxWatchNotify, 50*time.Millisecond
+	go StartInboxWatcher(cfg, jobs, stop)
+	time.Sleep(100 * time.Millisecond) // let the watch start
+
+	path := writeTestFile(t, inboxDir, ".jsonl", testData+"\n")
+	select {
+	case job := <-jobs:
+		require.Equal(t, path, job.Path)
+		require.Equal(t, "test.jsonl", job.Name)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for watcher to enqueue job from file event")
+	}
+}
+
+func TestInboxWatcher_NotifyWaitsForWritesToFinish(t *testing.T) {
+	inboxDir := t.TempDir()
+	jobs := make(chan InsertJob, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	cfg := NewWatcherConfig(inboxDir, "", []string{"*.jsonl"}, time.Hour)
+	cfg.Mode, cfg.SettleDelay = InboxWatchNotify, 150*time.Millisecond
+	go StartInboxWatcher(cfg, jobs, stop)
+	time.Sleep(100 * time.Millisecond)
+
+	path := filepath.Join(inboxDir, "slow.jsonl")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	// Each write lands well within the settle delay of the last
+	lines := strings.Split(strings.TrimSpace(testJsonl), "\n")[:6]
+	for _, line := range lines {
+		_, err := f.WriteString(line + "\n")
+		require.NoError(t, err)
+		select {
+		case job := <-jobs:
+			t.Fatalf("queued %s while it was still being written", job.Path)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	require.NoError(t, f.Close())
+
+	select {
+	case job := <-jobs:
+		require.Equal(t, path, job.Path)
+		data, err := os.ReadFile(job.Path)
+		require.NoError(t, err)
+		require.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), len(lines))
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for watcher to enqueue finished file")
+	}
+}
+
 func TestWatcherMovesToDoneDir(t *testing.T) {
 	db := setupTestDB(t)
 	defer teardownTestDB(t, db)
@@ -762,7 +1632,7 @@ func TestWatcherMovesToDoneDir(t *testing.T) {
 	// Run the worker
 	metrics := NewSlurploadMetrics()
 	metrics.Start()
-	err := processFileJob(context.Background(), db, job, 10, 0, metrics)
+	err := processFileJob(context.Background(), db, job, 10, 0, RetryPolicy{}, 0, metrics, "", false)
 	require.NoError(t, err)
 
 	// Move file (simulate worker cleanup)
@@ -866,4 +1736,144 @@ func TestMetricsHandler(t *testing.T) {
 	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
 	require.Contains(t, string(body), `"processed":1`)
 	require.Contains(t, string(body), `"failed":1`)
+	require.Contains(t, string(body), `"malformed":0`)
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, f := range []struct {
+		inserted int
+		duration time.Duration
+	}{{3, 2 * time.Second}, {4, 500 * time.Millisecond}} {
+		start := base.Add(time.Duration(i) * time.Minute)
+		_, err := db.Exec(`
+			INSERT INTO etl_flush_metrics (started_at, ended_at, rows_loaded, rows_inserted, rows_deduped, error_count, flush_type, status)
+			VALUES ($1, $2, $3, $3, 0, 0, 'batch', 'success')`,
+			start, start.Add(f.duration), f.inserted)
+		require.NoError(t, err)
+	}
+	// Five coalesced noops spanning an hour neither count as flushes nor
+	// add to their duration
+	_, err := db.Exec(`
+		INSERT INTO etl_flush_metrics (started_at, ended_at, rows_loaded, rows_inserted, rows_deduped, error_count, flush_type, status, flush_count)
+		VALUES ($1, $2, 0, 0, 0, 0, 'batch', 'noop', 5)`,
+		base.Add(time.Hour), base.Add(2*time.Hour))
+	require.NoError(t, err)
+
+	metrics := NewSlurploadMetrics()
+	metrics.Start()
+	metrics.IncProcessed()
+	metrics.IncProcessed()
+	metrics.IncFailed()
+
+	w := httptest.NewRecorder()
+	prometheusHandler(db, metrics)(w, httptest.NewRequest("GET", "/metrics/prometheus", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(w.Body)
+	require.NoError(t, err)
+
+	counter := func(name string) float64 {
+		mf, ok := families[name]
+		require.True(t, ok, "missing %s", name)
+		require.Equal(t, dto.MetricType_COUNTER, mf.GetType())
+		return mf.GetMetric()[0].GetCounter().GetValue()
+	}
+	require.Equal(t, 2.0, counter("certslurp_processed_total"))
+	require.Equal(t, 1.0, counter("certslurp_failed_total"))
+	require.Equal(t, 7.0, counter("certslurp_flush_rows_inserted_total"))
+
+	latency, ok := families["certslurp_flush_duration_seconds"]
+	require.True(t, ok)
+	require.Equal(t, dto.MetricType_SUMMARY, latency.GetType())
+	require.EqualValues(t, 2, latency.GetMetric()[0].GetSummary().GetSampleCount())
+	require.InDelta(t, 2.5, latency.GetMetric()[0].GetSummary().GetSampleSum(), 1e-6)
+	require.InDelta(t, 0.5, families["certslurp_flush_last_duration_seconds"].GetMetric()[0].GetGauge().GetValue(), 1e-6)
+	require.Equal(t, 5.0, counter("certslurp_flush_noops_total"))
+
+	// The JSON endpoint is unchanged
+	w = httptest.NewRecorder()
+	metricsHandler(metrics)(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), `"processed":2`)
+}
+
+func TestDomainCounter_EstimateWithinTolerance(t *testing.T) {
+	counter := NewDomainCounter()
+	const distinct = 50_000
+	for i := 0; i < distinct; i++ {
+		d := fmt.Sprintf("domain%d.example", i)
+		// Repeats must not inflate the estimate
+		counter.Add(d)
+		counter.Add(d)
+	}
+	counter.Add("")
+
+	est := counter.Estimate()
+	errPct := math.Abs(float64(est)-distinct) / distinct
+	require.Less(t, errPct, 0.03, "estimate %d too far from %d", est, distinct)
+}
+
+func TestDomainCounter_SmallCardinality(t *testing.T) {
+	counter := NewDomainCounter()
+	for _, d := range []string{"example.com", "example.org", "example.net", "example.com"} {
+		counter.Add(d)
+	}
+	require.Equal(t, uint64(3), counter.Estimate())
+}
+
+func TestDomainCounter_PersistAndLoad(t *testing.T) {
+	db := setupTestDB(t)
+	defer teardownTestDB(t, db)
+
+	a := NewDomainCounter()
+	for i := 0; i < 1000; i++ {
+		a.Add(fmt.Sprintf("a%d.com", i))
+	}
+	require.NoError(t, a.Persist(db))
+
+	// A second instance merges its view with the stored state
+	b := NewDomainCounter()
+	for i := 0; i < 1000; i++ {
+		b.Add(fmt.Sprintf("b%d.com", i))
+	}
+	require.NoError(t, b.Persist(db))
+
+	est, updated, err := ReadDistinctRootDomains(db)
+	require.NoError(t, err)
+	require.False(t, updated.IsZero())
+	require.InDelta(t, 2000, float64(est), 60)
+
+	c := NewDomainCounter()
+	require.NoError(t, c.Load(db))
+	require.Equal(t, est, c.Estimate())
+}
+
+func TestMetricsHandler_DistinctRootDomains(t *testing.T) {
+	metrics := NewSlurploadMetrics()
+	metrics.Start()
+	metrics.RootDomains = NewDomainCounter()
+	metrics.RootDomains.Add("example.com")
+	metrics.RootDomains.Add("example.org")
+
+	w := httptest.NewRecorder()
+	metricsHandler(metrics)(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Contains(t, w.Body.String(), `"distinct_root_domains":2`)
+}
+
+func TestGetReader_DetectsCodecFromExtension(t *testing.T) {
+	dir := t.TempDir()
+	for _, ext := range []string{".jsonl", ".jsonl.gz", ".jsonl.bz2", ".jsonl.zst", ".jsonl.lz4", ".jsonl.br"} {
+		path := writeTestFile(t, dir, ext, testJsonl)
+		r, err := getReader(path, false, false, false, false)
+		require.NoError(t, err, ext)
+		out, err := io.ReadAll(r)
+		require.NoError(t, err, ext)
+		require.Equal(t, testJsonl, string(out), ext)
+	}
 }
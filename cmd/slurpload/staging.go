@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+)
+
+// Backfill staging lets a bulk load for one partition's range be written to a
+// standalone table instead of the live certificates partition. While a
+// partition is staged, flush_raw_certificates routes rows in its range to the
+// staging table; everything else flushes as usual. Attaching swaps the staging
+// table in as the partition, carrying over rows that were already live.
+
+// stagingTable returns the name of p's backfill staging table, e.g.
+// certificates_2024_staging.
+func (p Partition) stagingTable() string {
+	return p.table() + "_staging"
+}
+
+// The staging table copies the certificates columns, defaults and indexes, so
+// attaching it only has to adopt them. The CHECK constraint matches the
+// partition bounds, which lets ATTACH PARTITION skip its validation scan.
+const stagingTableTemplate = `
+CREATE TABLE %[1]s (LIKE certificates INCLUDING ALL);
+ALTER TABLE %[1]s
+ADD CONSTRAINT %[1]s_bounds CHECK (not_before >= '%[2]s' AND not_before < '%[3]s');
+`
+
+const backfillStagingTableSQL = `
+CREATE TABLE IF NOT EXISTS backfill_staging (
+    partition_table TEXT PRIMARY KEY,
+    staging_table   TEXT NOT NULL UNIQUE,
+    range_from      TIMESTAMPTZ NOT NULL,
+    range_to        TIMESTAMPTZ NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+var partitionArgRe = regexp.MustCompile(`^(\d{4})(?:-(\d{2}))?$`)
+
+// parsePartition parses a partition as printed by Partition.String, e.g.
+// "2024" or "2024-03", checking it matches the configured interval.
+func parsePartition(s, interval string) (Partition, error) {
+	m := partitionArgRe.FindStringSubmatch(s)
+	if m == nil {
+		return Partition{}, fmt.Errorf("invalid partition %q (want YYYY or YYYY-MM)", s)
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2]) // zero when absent
+	switch {
+	case interval == PartitionMonthly && month == 0:
+		return Partition{}, fmt.Errorf("partitions are monthly; give the partition as YYYY-MM")
+	case interval != PartitionMonthly && month != 0:
+		return Partition{}, fmt.Errorf("partitions are yearly; give the partition as YYYY")
+	case month > 12:
+		return Partition{}, fmt.Errorf("invalid partition %q: month out of range", s)
+	}
+	return Partition{Year: year, Month: month}, nil
+}
+
+// StagedPartitions lists the partitions currently being backfilled into
+// staging tables.
+func StagedPartitions(db *sql.DB) ([]Partition, error) {
+	rows, err := db.Query(`SELECT partition_table FROM backfill_staging ORDER BY partition_table`)
+	if err != nil {
+		return nil, fmt.Errorf("list staged partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var staged []Partition
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if p, ok := parsePartitionTable(name); ok {
+			staged = append(staged, p)
+		}
+	}
+	return staged, rows.Err()
+}
+
+// StagePartition creates p's staging table and starts routing flushed rows in
+// p's range to it. The live partition is left as is until AttachStagedPartition.
+func StagePartition(db *sql.DB, p Partition) error {
+	// Databases initialized before staging existed need the registry table
+	// and a flush function that consults it, which in turn needs the
+	// columns added since
+	if err := installFlushFunc(db); err != nil {
+		return fmt.Errorf("update flush function: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var staged bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM backfill_staging WHERE partition_table = $1)`, p.table()).Scan(&staged); err != nil {
+		return err
+	}
+	if staged {
+		return fmt.Errorf("partition %s is already staged in %s", p, p.stagingTable())
+	}
+
+	from, to := p.bounds()
+	if _, err := tx.Exec(fmt.Sprintf(stagingTableTemplate, p.stagingTable(), from, to)); err != nil {
+		return fmt.Errorf("create staging table for %s: %w", p, err)
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO backfill_staging (partition_table, staging_table, range_from, range_to)
+		VALUES ($1, $2, $3, $4)`, p.table(), p.stagingTable(), from, to); err != nil {
+		return fmt.Errorf("register staging table for %s: %w", p, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	log.Printf("Staging backfill for certificates partition %s in %s", p, p.stagingTable())
+	return nil
+}
+
+var errNotStaged = errors.New("partition is not staged")
+
+// AttachStagedPartition swaps p's staging table in as the live partition.
+// Rows already in the live partition are copied into the staging table first
+// (duplicates are dropped), then the old partition is detached and dropped
+// and the staging table attached in its place, all in one transaction.
+// Readers of certificates only wait on the final swap, not the backfill.
+func AttachStagedPartition(db *sql.DB, p Partition) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Waits out in-flight flushes, which read the registry, and holds off
+	// new ones until the swap commits
+	if _, err := tx.Exec(`LOCK TABLE backfill_staging IN ACCESS EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("lock backfill_staging: %w", err)
+	}
+	var staging string
+	err = tx.QueryRow(`SELECT staging_table FROM backfill_staging WHERE partition_table = $1`, p.table()).Scan(&staging)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%s: %w", p, errNotStaged)
+	} else if err != nil {
+		return err
+	}
+
+	var exists, attached bool
+	if err := tx.QueryRow(`
+		SELECT to_regclass($1) IS NOT NULL,
+		       EXISTS (
+		           SELECT 1 FROM pg_inherits i
+		           JOIN pg_class c ON c.oid = i.inhrelid
+		           WHERE c.relname = $1 AND i.inhparent = 'certificates'::regclass)`,
+		p.table()).Scan(&exists, &attached); err != nil {
+		return fmt.Errorf("look up partition %s: %w", p, err)
+	}
+
+	if exists {
+		res, err := tx.Exec(fmt.Sprintf(`INSERT INTO %s SELECT * FROM %s ON CONFLICT DO NOTHING`, staging, p.table()))
+		if err != nil {
+			return fmt.Errorf("copy live rows for %s: %w", p, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("Carried %d existing rows from %s into the backfill", n, p.table())
+		}
+		if attached {
+			if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE certificates DETACH PARTITION %s`, p.table())); err != nil {
+				return fmt.Errorf("detach %s: %w", p.table(), err)
+			}
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`DROP TABLE %s`, p.table())); err != nil {
+			return fmt.Errorf("drop %s: %w", p.table(), err)
+		}
+	}
+
+	from, to := p.bounds()
+	for _, stmt := range []string{
+		fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, staging, p.table()),
+		fmt.Sprintf(`ALTER TABLE certificates ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')`, p.table(), from, to),
+		fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT %s_bounds`, p.table(), staging),
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("attach %s: %w", p, err)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM backfill_staging WHERE partition_table = $1`, p.table()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	log.Printf("Attached backfilled certificates partition %s", p)
+	return nil
+}
@@ -2,11 +2,10 @@ package main
 
 import (
 	"bufio"
-	"compress/gzip"
 	"io"
 	"os"
 
-	"github.com/dsnet/compress/bzip2"
+	"github.com/chtzvt/certslurp/internal/compression"
 	"github.com/lib/pq"
 )
 
@@ -17,7 +16,7 @@ func pqStringArray(ss []string) interface{} {
 	return pq.Array(ss)
 }
 
-func getReader(archivePath string, useGzip, useBzip2 bool) (*bufio.Reader, error) {
+func getReader(archivePath string, useGzip, useBzip2, useZstd, useLZ4 bool) (*bufio.Reader, error) {
 	var r io.Reader
 	if archivePath == "" || archivePath == "-" {
 		r = os.Stdin
@@ -28,19 +27,32 @@ func getReader(archivePath string, useGzip, useBzip2 bool) (*bufio.Reader, error
 		}
 		r = file
 	}
-	if useGzip {
-		gr, err := gzip.NewReader(r)
-		if err != nil {
-			return nil, err
-		}
-		return bufio.NewReader(gr), nil
+	// Flags override the codec the file's extension implies
+	codec := compression.CodecForName(archivePath)
+	switch {
+	case useGzip:
+		codec = "gzip"
+	case useBzip2:
+		codec = "bzip2"
+	case useZstd:
+		codec = "zstd"
+	case useLZ4:
+		codec = "lz4"
 	}
-	if useBzip2 {
-		br, err := bzip2.NewReader(r, nil)
-		if err != nil {
-			return nil, err
-		}
-		return bufio.NewReader(br), nil
+	dr, err := compression.NewReader(r, codec)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(dr), nil
+}
+
+// closeReader releases a decompressor returned by compression.NewReader. The
+// zstd decoder's Close has no error result, so it isn't an io.Closer.
+func closeReader(r io.Reader) {
+	switch c := r.(type) {
+	case io.Closer:
+		_ = c.Close()
+	case interface{ Close() }:
+		c.Close()
 	}
-	return bufio.NewReader(r), nil
 }
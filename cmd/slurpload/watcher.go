@@ -1,17 +1,34 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"os"
 	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// How the inbox is watched for new files, set with processing.inbox_watch.
+const (
+	InboxWatchPoll   = "poll"   // rescan the inbox every inbox_poll (default)
+	InboxWatchNotify = "notify" // react to filesystem events, polling where they aren't available
 )
 
+// DefaultInboxSettle is how long a file must go unchanged before the notify
+// watcher queues it, unless processing.inbox_settle says otherwise.
+const DefaultInboxSettle = 500 * time.Millisecond
+
 type WatcherConfig struct {
 	InboxDir     string
 	DoneDir      string // Optional: Where to move processed files, or "" to delete after processing
 	PollInterval time.Duration
-	FilePatterns []string // e.g. []string{"*.jsonl", "*.jsonl.gz", "*.jsonl.bz2"}
+	FilePatterns []string // e.g. []string{"*.jsonl", "*.jsonl.gz", "*.jsonl.bz2", "*.jsonl.zst", "*.jsonl.lz4"}
+	Mode         string   // InboxWatchPoll or InboxWatchNotify; "" polls
+	SettleDelay  time.Duration
 	seenFiles    map[string]time.Time
 	seenMu       sync.Mutex
 }
@@ -49,8 +66,21 @@ func (w *WatcherConfig) HasSeen(file string) bool {
 	return seen
 }
 
-// StartInboxWatcher polls the inbox directory and enqueues unprocessed files for loading.
+// StartInboxWatcher enqueues unprocessed inbox files for loading. In notify
+// mode it reacts to filesystem events, falling back to polling if they can't
+// be used; otherwise it polls the inbox directory.
 func StartInboxWatcher(cfg *WatcherConfig, jobs chan<- InsertJob, stop <-chan struct{}) {
+	if cfg.Mode == InboxWatchNotify {
+		err := watchInboxEvents(cfg, jobs, stop)
+		if err == nil {
+			return
+		}
+		log.Printf("Inbox watcher: file events unavailable (%v), falling back to polling every %s", err, cfg.PollInterval)
+	}
+	pollInbox(cfg, jobs, stop)
+}
+
+func pollInbox(cfg *WatcherConfig, jobs chan<- InsertJob, stop <-chan struct{}) {
 	for {
 		select {
 		case <-stop:
@@ -67,17 +97,133 @@ func StartInboxWatcher(cfg *WatcherConfig, jobs chan<- InsertJob, stop <-chan st
 				if cfg.HasSeen(file) {
 					continue
 				}
-
-				cfg.AddSeen(file)
-				log.Printf("Watcher: queueing file %s for loading", file)
-				jobs <- InsertJob{Name: filepath.Base(file), Path: file}
-				// File will be deleted/moved by batcher/worker after DB insert completes
+				queueFile(cfg, jobs, file)
 			}
 			time.Sleep(cfg.PollInterval)
 		}
 	}
 }
 
+func queueFile(cfg *WatcherConfig, jobs chan<- InsertJob, file string) {
+	cfg.AddSeen(file)
+	log.Printf("Watcher: queueing file %s for loading", file)
+	jobs <- InsertJob{Name: filepath.Base(file), Path: file}
+	// File will be deleted/moved by batcher/worker after DB insert completes
+}
+
+// pendingFile is an inbox file the notify watcher has seen change but not yet
+// queued, along with its size and modification time when last checked.
+type pendingFile struct {
+	changed time.Time
+	size    int64
+	modTime time.Time
+}
+
+// watchInboxEvents queues inbox files as filesystem events report them. Files
+// are only queued once they've gone SettleDelay without changing size or
+// modification time, so that files still being written aren't loaded half
+// finished. It returns nil when stopped, or an error if events can't be
+// watched (e.g. no inotify, or an inbox on a network filesystem, where writes
+// from other hosts raise no events), in which case the caller should poll.
+func watchInboxEvents(cfg *WatcherConfig, jobs chan<- InsertJob, stop <-chan struct{}) error {
+	if fs, ok := networkFilesystem(cfg.InboxDir); ok {
+		return fmt.Errorf("%s is on a network filesystem (%s)", cfg.InboxDir, fs)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := watcher.Add(cfg.InboxDir); err != nil {
+		return err
+	}
+
+	settle := cfg.SettleDelay
+	if settle <= 0 {
+		settle = DefaultInboxSettle
+	}
+	pending := make(map[string]*pendingFile)
+	touch := func(file string) {
+		if cfg.HasSeen(file) || !matchesPatterns(file, cfg.FilePatterns) {
+			return
+		}
+		fi, err := os.Stat(file)
+		if err != nil || !fi.Mode().IsRegular() {
+			return
+		}
+		pending[file] = &pendingFile{changed: time.Now(), size: fi.Size(), modTime: fi.ModTime()}
+	}
+	// Pick up anything that arrived before the watch was in place
+	rescan := func() {
+		files, err := listMatchingFiles(cfg.InboxDir, cfg.FilePatterns)
+		if err != nil {
+			log.Printf("Watcher error: %v", err)
+			return
+		}
+		for _, file := range files {
+			if _, ok := pending[file]; !ok {
+				touch(file)
+			}
+		}
+	}
+	rescan()
+
+	ticker := time.NewTicker(settle / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			log.Println("Inbox watcher: stopping")
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("event stream closed")
+			}
+			if ev.Has(fsnotify.Create) || ev.Has(fsnotify.Write) {
+				touch(ev.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return errors.New("event stream closed")
+			}
+			log.Printf("Watcher error: %v", err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				rescan()
+			}
+		case now := <-ticker.C:
+			for file, p := range pending {
+				if now.Sub(p.changed) < settle {
+					continue
+				}
+				fi, err := os.Stat(file)
+				if err != nil {
+					// Removed or renamed away before it settled
+					delete(pending, file)
+					continue
+				}
+				if fi.Size() != p.size || !fi.ModTime().Equal(p.modTime) {
+					p.changed, p.size, p.modTime = now, fi.Size(), fi.ModTime()
+					continue
+				}
+				delete(pending, file)
+				if !cfg.HasSeen(file) {
+					queueFile(cfg, jobs, file)
+				}
+			}
+		}
+	}
+}
+
+func matchesPatterns(file string, patterns []string) bool {
+	name := filepath.Base(file)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // Utility: List files in dir matching any of the provided patterns
 func listMatchingFiles(dir string, patterns []string) ([]string, error) {
 	var result []string
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bufio"
-	"compress/gzip"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -15,8 +14,8 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/chtzvt/certslurp/internal/compression"
 	"github.com/chtzvt/certslurp/internal/extractor"
-	"github.com/dsnet/compress/bzip2"
 )
 
 func fileWorker(
@@ -24,16 +23,20 @@ func fileWorker(
 	db *sql.DB,
 	jobs <-chan InsertJob,
 	batchSize int,
+	copyThreshold int,
+	retry RetryPolicy,
 	wg *sync.WaitGroup,
 	logStatEvery int64,
 	metrics *SlurploadMetrics,
 	doneDir string,
+	deadLetterDir string,
+	skipDuplicates bool,
 	watcherCfg *WatcherConfig,
 ) {
 	defer wg.Done()
 
 	for job := range jobs {
-		err := processFileJob(ctx, db, job, batchSize, logStatEvery, metrics)
+		err := processFileJob(ctx, db, job, batchSize, copyThreshold, retry, logStatEvery, metrics, deadLetterDir, skipDuplicates)
 		if err != nil {
 			log.Printf("[error] processing file %s: %v", job.Path, err)
 			cleanupFile(job.Path, watcherCfg)
@@ -69,8 +72,12 @@ func processFileJob(
 	db *sql.DB,
 	job InsertJob,
 	batchSize int,
+	copyThreshold int,
+	retry RetryPolicy,
 	logStatEvery int64,
 	metrics *SlurploadMetrics,
+	deadLetterDir string,
+	skipDuplicates bool,
 ) error {
 	f, err := os.Open(job.Path)
 	if err != nil {
@@ -82,36 +89,49 @@ func processFileJob(
 	}
 	defer f.Close()
 
-	var reader io.Reader = f
-	switch {
-	case strings.HasSuffix(job.Path, ".gz"):
-		gr, err := gzip.NewReader(f)
-		if err != nil {
-			// Soft-skip: log and return nil if file is empty/corrupt gzip
-			if errors.Is(err, io.EOF) || err.Error() == "unexpected EOF" {
-				log.Printf("[warn] Skipping empty/corrupt gzip file: %s (%v)", job.Path, err)
-				return nil // NOT counted as failure
-			}
-			return fmt.Errorf("gzip reader: %w", err)
+	// With skipDuplicates, a file whose contents were already loaded (e.g. one
+	// that reappears in the inbox after a crash) is skipped.
+	var sum string
+	if skipDuplicates {
+		if sum, err = hashFile(f); err != nil {
+			return fmt.Errorf("hash %s: %w", job.Path, err)
 		}
-		defer gr.Close()
-		reader = gr
-	case strings.HasSuffix(job.Path, ".bz2"):
-		br, err := bzip2.NewReader(f, nil)
+		done, err := fileAlreadyIngested(ctx, db, sum)
 		if err != nil {
-			// Soft-skip: log and return nil if file is empty/corrupt bzip2
-			if errors.Is(err, io.EOF) || err.Error() == "unexpected EOF" {
-				log.Printf("[warn] Skipping empty/corrupt bzip2 file: %s (%v)", job.Path, err)
-				return nil // NOT counted as failure
-			}
-			return fmt.Errorf("bzip2 reader: %w", err)
+			return err
+		}
+		if done {
+			log.Printf("[info] Skipping %s: already ingested (sha256 %s)", job.Path, sum)
+			return nil
 		}
-		reader = br
 	}
+
+	reader, err := compression.NewReaderForName(f, job.Path)
+	if err != nil {
+		codec := compression.CodecForName(job.Path)
+		// Soft-skip: log and return nil if file is empty/corrupt
+		if errors.Is(err, io.EOF) || err.Error() == "unexpected EOF" {
+			log.Printf("[warn] Skipping empty/corrupt %s file: %s (%v)", codec, job.Path, err)
+			return nil // NOT counted as failure
+		}
+		return fmt.Errorf("%s reader: %w", codec, err)
+	}
+	defer closeReader(reader)
+	// Malformed lines go to a dead-letter sidecar when configured, otherwise
+	// they're logged and counted as failures.
+	var deadLetters *deadLetterWriter
+	if deadLetterDir != "" {
+		deadLetters = newDeadLetterWriter(deadLetterDir, job.Path)
+		defer deadLetters.Close()
+	}
+
 	scanner := bufio.NewScanner(reader)
 	batch := make([]extractor.CertFieldsExtractorOutput, 0, batchSize)
+	lineNum := 0
+	var rows int64
 
 	for scanner.Scan() {
+		lineNum++
 		line := strings.TrimSpace(string(scanner.Bytes()))
 		if line == "" {
 			continue // skip blank lines
@@ -119,6 +139,13 @@ func processFileJob(
 
 		var cert extractor.CertFieldsExtractorOutput
 		if err := json.Unmarshal([]byte(line), &cert); err != nil {
+			metrics.IncMalformed()
+			if deadLetters != nil {
+				if err := deadLetters.Write(lineNum, line, err); err != nil {
+					return err
+				}
+				continue
+			}
 			log.Printf("[warn] bad json in %s: %v", job.Path, err)
 			metrics.IncFailed()
 			continue
@@ -127,9 +154,10 @@ func processFileJob(
 		batch = append(batch, cert)
 
 		if len(batch) >= batchSize {
-			if err := insertBatch(ctx, db, batch, logStatEvery, metrics); err != nil {
+			if err := insertBatch(ctx, db, batch, copyThreshold, retry, logStatEvery, metrics); err != nil {
 				return fmt.Errorf("insert batch: %w", err)
 			}
+			rows += int64(len(batch))
 			batch = batch[:0]
 		}
 	}
@@ -137,9 +165,13 @@ func processFileJob(
 		return fmt.Errorf("scanner error: %w", err)
 	}
 	if len(batch) > 0 {
-		if err := insertBatch(ctx, db, batch, logStatEvery, metrics); err != nil {
+		if err := insertBatch(ctx, db, batch, copyThreshold, retry, logStatEvery, metrics); err != nil {
 			return fmt.Errorf("insert batch: %w", err)
 		}
+		rows += int64(len(batch))
+	}
+	if skipDuplicates {
+		return recordIngestedFile(ctx, db, job.Path, sum, rows)
 	}
 	return nil
 }
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// DefaultAccessLogSkipPaths are left out of the access log when
+// AccessLogConfig.SkipPaths is unset, so health checks don't drown it out.
+var DefaultAccessLogSkipPaths = []string{"/healthz"}
+
+// AccessLogConfig controls logging of API requests.
+type AccessLogConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// SkipPaths are request paths that aren't logged. Unset means
+	// DefaultAccessLogSkipPaths; set it to an empty list to log everything.
+	SkipPaths []string `mapstructure:"skip_paths"`
+}
+
+// accessLogEntry is one line of the access log.
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMS float64   `json:"duration_ms"`
+	TokenID    string    `json:"token_id,omitempty"`
+	Remote     string    `json:"remote"`
+}
+
+// AccessLogMiddleware logs each request to next as a line of JSON giving its
+// method, path, status, duration, and which token it bore (by tokenID, never
+// the token itself). Requests for skipPaths aren't logged.
+func AccessLogMiddleware(logger *log.Logger, skipPaths []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(skipPaths, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		b, err := json.Marshal(accessLogEntry{
+			Time:       start.UTC(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     sw.status,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			TokenID:    tokenID(r),
+			Remote:     r.RemoteAddr,
+		})
+		if err != nil {
+			return
+		}
+		logger.Println(string(b))
+	})
+}
+
+// statusWriter records the status code a handler responds with.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers, like job events, flush through the log.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -3,9 +3,12 @@ package api
 import (
 	"context"
 	"errors"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/cluster"
 	"github.com/chtzvt/certslurp/internal/job"
@@ -39,6 +42,25 @@ func (s *stubCluster) ListJobs(ctx context.Context) ([]cluster.JobInfo, error) {
 	return out, nil
 }
 
+func (s *stubCluster) ListJobsFiltered(ctx context.Context, opts cluster.JobListOptions) (*cluster.JobPage, error) {
+	ids := make([]string, 0, len(s.jobs))
+	for id, j := range s.jobs {
+		if id > opts.Cursor && (opts.Status == "" || j.Status == opts.Status) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	page := &cluster.JobPage{Jobs: []cluster.JobInfo{}}
+	for _, id := range ids {
+		if opts.Limit > 0 && len(page.Jobs) == opts.Limit {
+			page.NextCursor = page.Jobs[len(page.Jobs)-1].ID
+			break
+		}
+		page.Jobs = append(page.Jobs, *s.jobs[id])
+	}
+	return page, nil
+}
+
 func (s *stubCluster) GetJob(ctx context.Context, jobID string) (*cluster.JobInfo, error) {
 	job, ok := s.jobs[jobID]
 	if !ok {
@@ -80,7 +102,7 @@ func setupSecretsTestServer(t *testing.T) (*httptest.Server, cluster.Cluster) {
 
 	t.Cleanup(cleanup)
 	mux := http.NewServeMux()
-	RegisterSecretHandlers(mux, cl)
+	RegisterSecretHandlers(mux, cl, log.Default())
 	server := httptest.NewServer(mux)
 	t.Cleanup(server.Close)
 	return server, cl
@@ -90,16 +112,31 @@ func setupSecretsTestServer(t *testing.T) (*httptest.Server, cluster.Cluster) {
 func (s *stubCluster) GetClusterStatus(context.Context) (*cluster.ClusterStatus, error) {
 	return nil, nil
 }
+func (s *stubCluster) DumpClusterState(context.Context) (*cluster.ClusterDump, error) {
+	return nil, nil
+}
 func (s *stubCluster) UpdateJobStatus(context.Context, string, cluster.JobState) error { return nil }
 func (s *stubCluster) MarkJobStarted(context.Context, string) error                    { return nil }
 func (s *stubCluster) MarkJobCompleted(context.Context, string) error                  { return nil }
-func (s *stubCluster) CancelJob(context.Context, string) error                         { return nil }
-func (s *stubCluster) IsJobCancelled(context.Context, string) (bool, error)            { return false, nil }
+func (s *stubCluster) GetJobManifest(context.Context, string) (*cluster.JobManifest, error) {
+	return nil, nil
+}
+func (s *stubCluster) PauseJob(context.Context, string) error               { return nil }
+func (s *stubCluster) ResumeJob(context.Context, string) error              { return nil }
+func (s *stubCluster) CancelJob(context.Context, string) error              { return nil }
+func (s *stubCluster) IsJobCancelled(context.Context, string) (bool, error) { return false, nil }
+func (s *stubCluster) PurgeJob(context.Context, string) error               { return nil }
+func (s *stubCluster) WatchJob(context.Context, string) (<-chan cluster.JobEvent, error) {
+	return nil, errors.New("not supported")
+}
 func (s *stubCluster) RegisterWorker(context.Context, cluster.WorkerInfo) (string, error) {
 	return "", nil
 }
+func (s *stubCluster) UnregisterWorker(context.Context, string) error            { return nil }
 func (s *stubCluster) ListWorkers(context.Context) ([]cluster.WorkerInfo, error) { return nil, nil }
-func (s *stubCluster) HeartbeatWorker(context.Context, string) error             { return nil }
+func (s *stubCluster) HeartbeatWorker(context.Context, string, ...cluster.ShardActivity) error {
+	return nil
+}
 func (s *stubCluster) BulkCreateShards(context.Context, string, []cluster.ShardRange) error {
 	return nil
 }
@@ -111,6 +148,9 @@ func (s *stubCluster) GetShardAssignments(context.Context, string) (map[int]clus
 func (s *stubCluster) GetShardAssignmentsWindow(context.Context, string, int, int) (map[int]cluster.ShardAssignmentStatus, error) {
 	return nil, nil
 }
+func (s *stubCluster) GetJobProgress(context.Context, string) (*cluster.JobProgress, error) {
+	return &cluster.JobProgress{}, nil
+}
 func (s *stubCluster) GetShardStatus(context.Context, string, int) (cluster.ShardStatus, error) {
 	return cluster.ShardStatus{}, nil
 }
@@ -118,6 +158,9 @@ func (s *stubCluster) ReportShardDone(context.Context, string, int, cluster.Shar
 	return nil
 }
 func (s *stubCluster) ReportShardFailed(context.Context, string, int) error { return nil }
+func (s *stubCluster) UpdateShardProgress(context.Context, string, int, string, cluster.ShardCheckpoint) error {
+	return nil
+}
 func (s *stubCluster) RequestShardSplit(context.Context, string, int, []cluster.ShardRange) error {
 	return nil
 }
@@ -149,6 +192,18 @@ func (s *stubCluster) ResetFailedShard(ctx context.Context, jobID string, shardI
 	return nil
 }
 
+func (s *stubCluster) SkipShard(ctx context.Context, jobID string, shardID int, reason string) error {
+	return nil
+}
+
+func (s *stubCluster) SetShardPreferredWorker(ctx context.Context, jobID string, shardID int, workerID string, grace time.Duration) error {
+	return nil
+}
+
+func (s *stubCluster) ListPreferredShards(ctx context.Context, workerID string) (map[string][]int, error) {
+	return nil, nil
+}
+
 func (s *stubCluster) ShardKey(string, int) string { return "" }
 func (s *stubCluster) Secrets() *secrets.Store     { return nil }
 func (s *stubCluster) Prefix() string              { return "" }
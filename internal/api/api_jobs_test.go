@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/cluster"
 	"github.com/chtzvt/certslurp/internal/job"
@@ -38,7 +41,7 @@ func setupTestServerWithCluster(cl cluster.Cluster) *httptest.Server {
 	mux := http.NewServeMux()
 	RegisterJobHandlers(mux, cl)
 	RegisterWorkerHandlers(mux, cl)
-	RegisterSecretHandlers(mux, cl)
+	RegisterSecretHandlers(mux, cl, log.Default())
 	server := httptest.NewServer(mux)
 	return server
 }
@@ -84,6 +87,31 @@ func TestAPI_MarkJobStartedCompletedCancelled(t *testing.T) {
 	require.Equal(t, cluster.JobState("cancelled"), info.Status)
 }
 
+func TestAPI_PauseResumeJob(t *testing.T) {
+	ts, cl, jobID := setupJobAPI(t)
+	post := func(action string) int {
+		resp, err := http.Post(ts.URL+"/api/jobs/"+jobID+"/"+action, "", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	status := func() cluster.JobState {
+		info, err := cl.GetJob(context.Background(), jobID)
+		require.NoError(t, err)
+		return info.Status
+	}
+
+	require.Equal(t, http.StatusNoContent, post("pause"))
+	require.Equal(t, cluster.JobStatePaused, status())
+	require.Equal(t, http.StatusNoContent, post("resume"))
+	require.Equal(t, cluster.JobStatePending, status())
+
+	// Cancelled jobs stay cancelled
+	require.Equal(t, http.StatusNoContent, post("cancel"))
+	require.Equal(t, http.StatusConflict, post("pause"))
+	require.Equal(t, cluster.JobStateCancelled, status())
+}
+
 func TestAPI_GetShardAssignmentsAndStatus(t *testing.T) {
 	ts, cl, jobID := setupJobAPI(t)
 
@@ -189,6 +217,31 @@ func TestAutoShardCreation(t *testing.T) {
 	}
 }
 
+func TestMakeShardRanges_Aligned(t *testing.T) {
+	const align = 256
+	start, end := int64(1000), int64(10_000)
+	ranges := makeShardRanges(start, end, 1000, align)
+	require.NotEmpty(t, ranges)
+	require.Equal(t, start, ranges[0].IndexFrom)
+	require.Equal(t, end, ranges[len(ranges)-1].IndexTo)
+	for i, r := range ranges {
+		require.Equal(t, i, r.ShardID)
+		require.Less(t, r.IndexFrom, r.IndexTo)
+		if i > 0 {
+			require.Equal(t, ranges[i-1].IndexTo, r.IndexFrom, "shards must be contiguous")
+			require.Zero(t, r.IndexFrom%align, "shard %d starts at %d", i, r.IndexFrom)
+		}
+		if i > 0 && i < len(ranges)-1 {
+			require.EqualValues(t, 1024, r.IndexTo-r.IndexFrom, "size rounds up to a multiple of the alignment")
+		}
+	}
+
+	// No alignment keeps the exact shard size
+	unaligned := makeShardRanges(start, end, 1000, 0)
+	require.Len(t, unaligned, 9)
+	require.EqualValues(t, 2000, unaligned[0].IndexTo)
+}
+
 func TestAutoShardCreation_IndexEndZero(t *testing.T) {
 	cl, cleanup := testcluster.SetupEtcdCluster(t)
 	defer cleanup()
@@ -230,6 +283,156 @@ func TestAutoShardCreation_IndexEndZero(t *testing.T) {
 	require.Equal(t, 5, shardCount, "shard count should match for auto tree size (2500, default 500)")
 }
 
+func TestAPI_SubmitJobs(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	server := setupTestServerWithCluster(cl)
+	defer server.Close()
+	client := NewClient(server.URL, "testtoken")
+	ctx := context.Background()
+
+	valid := func(end int64) *job.JobSpec {
+		return &job.JobSpec{
+			Version: "0.1.0",
+			LogURI:  "https://example.com",
+			Options: job.JobOptions{
+				Fetch:  job.FetchConfig{FetchSize: 10, FetchWorkers: 1, IndexEnd: end, ShardSize: 100},
+				Output: job.OutputOptions{Extractor: "raw", Transformer: "passthrough", Sink: "null"},
+			},
+		}
+	}
+	invalid := func() *job.JobSpec {
+		spec := valid(100)
+		spec.Options.Fetch.IndexStart = -1
+		return spec
+	}
+
+	t.Run("all valid", func(t *testing.T) {
+		results, err := client.SubmitJobs(ctx, []*job.JobSpec{valid(200), valid(300)})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		for i, want := range []int{2, 3} {
+			require.Empty(t, results[i].Error)
+			require.Equal(t, want, getShardCount(t, cl, results[i].JobID))
+		}
+		require.NotEqual(t, results[0].JobID, results[1].JobID)
+	})
+
+	t.Run("all invalid", func(t *testing.T) {
+		before, err := cl.ListJobs(ctx)
+		require.NoError(t, err)
+		results, err := client.SubmitJobs(ctx, []*job.JobSpec{invalid(), invalid()})
+		require.NoError(t, err)
+		for _, r := range results {
+			require.Empty(t, r.JobID)
+			require.Contains(t, r.Error, "job spec invalid")
+		}
+		after, err := cl.ListJobs(ctx)
+		require.NoError(t, err)
+		require.Len(t, after, len(before), "no jobs should be created")
+	})
+
+	t.Run("mixed", func(t *testing.T) {
+		body := `[` + mustMarshal(t, valid(100)) + `, {"version": 1, "options": "nope"}, ` + mustMarshal(t, invalid()) + `]`
+		resp, err := http.Post(server.URL+"/api/jobs/batch", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+		var results []JobSubmitResult
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&results))
+		require.Len(t, results, 3)
+		require.NotEmpty(t, results[0].JobID)
+		require.Equal(t, 1, getShardCount(t, cl, results[0].JobID))
+		require.Contains(t, results[1].Error, "invalid JSON")
+		require.Contains(t, results[2].Error, "job spec invalid")
+	})
+
+	t.Run("not a batch", func(t *testing.T) {
+		_, err := client.SubmitJobs(ctx, nil)
+		require.Error(t, err)
+		resp, err := http.Post(server.URL+"/api/jobs/batch", "application/json", strings.NewReader(mustMarshal(t, valid(100))))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestAPI_SubmitJobs_Deadline(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+
+	// Every log takes a while to answer, and one never does in time
+	ctlog := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/ct/v1/get-sth") {
+			http.NotFound(w, r)
+			return
+		}
+		delay := 300 * time.Millisecond
+		if strings.HasPrefix(r.URL.Path, "/stuck/") {
+			delay = 10 * time.Second
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = w.Write([]byte(`{"tree_size":250}`))
+	}))
+	defer ctlog.Close()
+
+	mux := http.NewServeMux()
+	RegisterJobHandlers(mux, cl)
+	server := httptest.NewServer(TimeoutMiddleware(2*time.Second, mux))
+	defer server.Close()
+	client := NewClient(server.URL, "testtoken")
+	ctx := context.Background()
+
+	spec := func(logURI string) *job.JobSpec {
+		return &job.JobSpec{
+			Version: "0.1.0",
+			LogURI:  logURI,
+			Options: job.JobOptions{
+				Fetch:  job.FetchConfig{FetchSize: 10, FetchWorkers: 1, ShardSize: 100},
+				Output: job.OutputOptions{Extractor: "raw", Transformer: "passthrough", Sink: "null"},
+			},
+		}
+	}
+
+	t.Run("tree sizes in parallel", func(t *testing.T) {
+		// One after another, these would take 3s and overrun the timeout
+		var specs []*job.JobSpec
+		for i := 0; i < 10; i++ {
+			specs = append(specs, spec(fmt.Sprintf("%s/log%d", ctlog.URL, i)))
+		}
+		results, err := client.SubmitJobs(ctx, specs)
+		require.NoError(t, err)
+		for _, r := range results {
+			require.Empty(t, r.Error)
+			require.Equal(t, 3, getShardCount(t, cl, r.JobID))
+		}
+	})
+
+	t.Run("answers before the deadline", func(t *testing.T) {
+		before, err := cl.ListJobs(ctx)
+		require.NoError(t, err)
+		results, err := client.SubmitJobs(ctx, []*job.JobSpec{spec(ctlog.URL + "/log"), spec(ctlog.URL + "/stuck")})
+		require.NoError(t, err, "the batch should be answered, not timed out")
+		require.NotEmpty(t, results[0].JobID)
+		require.Empty(t, results[1].JobID)
+		require.Contains(t, results[1].Error, "could not determine end index")
+		after, err := cl.ListJobs(ctx)
+		require.NoError(t, err)
+		require.Len(t, after, len(before)+1, "only the reported job should exist")
+	})
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(b)
+}
+
 func TestAPI_JobSubmission_BadInputs(t *testing.T) {
 	cl, cleanup := testcluster.SetupEtcdCluster(t)
 	defer cleanup()
@@ -375,3 +578,69 @@ func TestAPI_ResetFailedShards(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, http.StatusNoContent, resp.StatusCode)
 }
+
+func TestAPI_SkipShard(t *testing.T) {
+	ts, cl, jobID := setupJobAPI(t)
+	_ = cl.BulkCreateShards(context.Background(), jobID, []cluster.ShardRange{
+		{ShardID: 0, IndexFrom: 0, IndexTo: 10},
+	})
+
+	body := strings.NewReader(`{"reason":"pre-cutover"}`)
+	req, _ := http.NewRequest("POST", ts.URL+"/api/jobs/"+jobID+"/shards/0/skip", body)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	stat, err := cl.GetShardStatus(context.Background(), jobID, 0)
+	require.NoError(t, err)
+	require.True(t, stat.Skipped)
+	require.Equal(t, "pre-cutover", stat.SkipReason)
+
+	// Unknown shards can't be skipped
+	req, _ = http.NewRequest("POST", ts.URL+"/api/jobs/"+jobID+"/shards/7/skip", nil)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestAPI_JobEvents(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	mux := http.NewServeMux()
+	RegisterJobHandlers(mux, cl)
+	// Event streams must get past the buffering timeout middleware
+	server := httptest.NewServer(TimeoutMiddleware(time.Second, mux))
+	defer server.Close()
+	client := NewClient(server.URL, "testtoken")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	jobID := testcluster.SubmitTestJob(t, cl, "https://events.example", 2)
+
+	_, err := client.WatchJob(ctx, "nosuchjob")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, http.StatusNotFound, apiErr.Status)
+
+	events, err := client.WatchJob(ctx, jobID)
+	require.NoError(t, err)
+	first := <-events
+	require.Equal(t, cluster.JobStatePending, first.Status)
+
+	// Outlive the middleware's timeout, to show the stream isn't cut short
+	time.Sleep(1500 * time.Millisecond)
+	require.NoError(t, cl.AssignShard(ctx, jobID, 0, "w1"))
+	require.NoError(t, cl.ReportShardDone(ctx, jobID, 0, cluster.ShardManifest{OutputPath: "out"}))
+	for {
+		select {
+		case ev, ok := <-events:
+			require.True(t, ok, "event stream closed early")
+			if ev.ShardID != nil && *ev.ShardID == 0 && ev.Field == "done" {
+				cancel()
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the shard done event")
+		}
+	}
+}
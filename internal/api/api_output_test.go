@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chtzvt/certslurp/internal/etl"
+	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/sink"
+	"github.com/chtzvt/certslurp/internal/testcluster"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardOutputEndpoint_MemorySink(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+
+	opts := testcluster.DefaultTestJobOptions()
+	opts.Output = job.OutputOptions{
+		ChunkRecords: 2,
+		Extractor:    "raw",
+		Transformer:  "passthrough",
+		Sink:         "memory",
+		SinkOptions:  map[string]interface{}{"bucket": t.Name()},
+	}
+	jobID := testcluster.SubmitTestJob(t, cl, "https://ct.example.com/log", 2, opts)
+
+	// Write shard 1's first chunk the way its pipeline would
+	ctx := context.Background()
+	info, err := cl.GetJob(ctx, jobID)
+	require.NoError(t, err)
+	name := etl.ChunkName(etl.OutputBaseName(info.Spec, 100, 200, jobID, 1), 1, true)
+	w, err := sink.MemoryBucket(t.Name()).Open(ctx, name)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("chunk-one-bytes"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	serve := func(cfg OutputReadConfig, token string) (*Client, func()) {
+		mux := http.NewServeMux()
+		RegisterJobHandlers(mux, cl)
+		RegisterShardOutputHandler(mux, cl, cfg)
+		ts := httptest.NewServer(TokenAuthMiddleware([]string{"admin", "reader"}, mux))
+		return NewClient(ts.URL, token), ts.Close
+	}
+
+	client, done := serve(OutputReadConfig{Enabled: true}, "admin")
+	data, truncated, err := client.GetShardOutput(ctx, jobID, 1, 1)
+	require.NoError(t, err)
+	require.False(t, truncated)
+	require.Equal(t, "chunk-one-bytes", string(data))
+
+	// Chunks that were never written are reported as missing
+	_, _, err = client.GetShardOutput(ctx, jobID, 1, 2)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "chunk not found")
+	done()
+
+	// Size limit truncates the response
+	client, done = serve(OutputReadConfig{Enabled: true, MaxBytes: 5}, "admin")
+	data, truncated, err = client.GetShardOutput(ctx, jobID, 1, 1)
+	require.NoError(t, err)
+	require.True(t, truncated)
+	require.Equal(t, "chunk", string(data))
+	done()
+
+	// Disabled by default
+	client, done = serve(OutputReadConfig{}, "admin")
+	_, _, err = client.GetShardOutput(ctx, jobID, 1, 1)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "disabled")
+	done()
+
+	// Restricted to the configured tokens
+	client, done = serve(OutputReadConfig{Enabled: true, Tokens: []string{"reader"}}, "admin")
+	_, _, err = client.GetShardOutput(ctx, jobID, 1, 1)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not permitted")
+	done()
+}
@@ -5,15 +5,20 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/cluster"
 	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/secrets"
 	"github.com/chtzvt/certslurp/internal/testcluster"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/secretbox"
 )
 
 func TestAuthRequired_AllEndpoints(t *testing.T) {
@@ -23,7 +28,9 @@ func TestAuthRequired_AllEndpoints(t *testing.T) {
 	protected := http.NewServeMux()
 	RegisterJobHandlers(protected, cl)
 	RegisterWorkerHandlers(protected, cl)
-	RegisterSecretHandlers(protected, cl)
+	RegisterSecretHandlers(protected, cl, log.Default())
+	RegisterStatusHandler(protected, cl)
+	RegisterShardOutputHandler(protected, cl, OutputReadConfig{Enabled: true})
 
 	// Wrap with auth middleware using some fake tokens
 	tokens := []string{"testtoken"}
@@ -33,6 +40,8 @@ func TestAuthRequired_AllEndpoints(t *testing.T) {
 	requireUnauthorized(t, "GET", "/api/jobs", handler)
 	requireUnauthorized(t, "POST", "/api/jobs", handler)
 	requireUnauthorized(t, "GET", "/api/jobs/someid", handler)
+	requireUnauthorized(t, "GET", "/api/jobs/someid/summary", handler)
+	requireUnauthorized(t, "GET", "/api/jobs/someid/shards/0/output?chunk=0001", handler)
 	// Try worker endpoints
 	requireUnauthorized(t, "GET", "/api/workers", handler)
 	requireUnauthorized(t, "GET", "/api/workers/someworker", handler)
@@ -40,6 +49,11 @@ func TestAuthRequired_AllEndpoints(t *testing.T) {
 	requireUnauthorized(t, "GET", "/api/secrets/store", handler)
 	requireUnauthorized(t, "GET", "/api/secrets/store/somekey", handler)
 	requireUnauthorized(t, "POST", "/api/secrets/nodes/approve", handler)
+	requireUnauthorized(t, "POST", "/api/secrets/nodes/deny", handler)
+	requireUnauthorized(t, "POST", "/api/secrets/nodes/revoke", handler)
+	// Try cluster endpoints
+	requireUnauthorized(t, "GET", "/api/status", handler)
+	requireUnauthorized(t, "GET", "/api/cluster/dump", handler)
 }
 
 func TestAuthRequired_InvalidToken(t *testing.T) {
@@ -81,6 +95,33 @@ func TestSubmitJob(t *testing.T) {
 	}
 }
 
+func TestSubmitJob_StrictRejectsUnknownFields(t *testing.T) {
+	server, _ := setupAuthTestServer("testtoken")
+	defer server.Close()
+
+	// "fetch_wrokers" is a typo for fetch_workers
+	body := `{"version":"1.0.0","log_uri":"test","options":{"fetch":{"fetch_size":10,"fetch_workers":1,"fetch_wrokers":4,"index_start":0,"index_end":100},"match":{},"output":{"extractor":"raw","transformer":"passthrough","sink":"null"}}}`
+	submit := func(query string) (int, string) {
+		req, _ := http.NewRequest("POST", server.URL+"/api/jobs"+query, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer testtoken")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var out map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out["error"]
+	}
+
+	status, msg := submit("?strict=true")
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Contains(t, msg, `"fetch_wrokers"`)
+
+	// Lenient by default, for compatibility with existing clients
+	status, _ = submit("")
+	require.Equal(t, http.StatusCreated, status)
+}
+
 func TestGetJob(t *testing.T) {
 	server, stub := setupAuthTestServer("testtoken")
 	defer server.Close()
@@ -132,6 +173,41 @@ func TestListJobs(t *testing.T) {
 	}
 }
 
+func TestListJobs_Paged(t *testing.T) {
+	server, stub := setupAuthTestServer("testtoken")
+	defer server.Close()
+	for _, id := range []string{"a", "b", "c"} {
+		stub.jobs[id] = &cluster.JobInfo{ID: id, Status: cluster.JobStateRunning}
+	}
+	stub.jobs["d"] = &cluster.JobInfo{ID: "d", Status: cluster.JobStatePending}
+
+	list := func(query string) ([]cluster.JobInfo, string, int) {
+		req, _ := http.NewRequest("GET", server.URL+"/api/jobs?"+query, nil)
+		req.Header.Set("Authorization", "Bearer testtoken")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var jobs []cluster.JobInfo
+		_ = json.NewDecoder(resp.Body).Decode(&jobs)
+		return jobs, resp.Header.Get("X-Next-Cursor"), resp.StatusCode
+	}
+
+	jobs, next, code := list("status=running&limit=2")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, jobs, 2)
+	require.Equal(t, "b", next)
+
+	jobs, next, _ = list("status=running&limit=2&cursor=" + next)
+	require.Len(t, jobs, 1)
+	require.Equal(t, "c", jobs[0].ID)
+	require.Empty(t, next)
+
+	_, _, code = list("limit=-1")
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
 func TestWorkerMetricsEndpoints(t *testing.T) {
 	cl, cleanup := testcluster.SetupEtcdCluster(t)
 	defer cleanup()
@@ -173,6 +249,148 @@ func TestWorkerMetricsEndpoints(t *testing.T) {
 	require.Equal(t, workerID, wv.WorkerID)
 }
 
+func TestWorkersEndpoint_ReportsActivity(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	workerID, err := cl.RegisterWorker(ctx, cluster.WorkerInfo{Host: "testhost"})
+	require.NoError(t, err)
+	activity := cluster.ShardActivity{JobID: "job1", ShardID: 7, IndexFrom: 0, IndexTo: 1000, Processed: 250, StartedAt: time.Now().UTC().Truncate(time.Second)}
+	require.NoError(t, cl.HeartbeatWorker(ctx, workerID, activity))
+
+	mux := http.NewServeMux()
+	RegisterWorkerHandlers(mux, cl)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/workers")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	var workers []WorkerStatus
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&workers))
+	require.Len(t, workers, 1)
+	require.Equal(t, []cluster.ShardActivity{activity}, workers[0].Activity)
+}
+
+func TestJobSummaryEndpoint(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	jobID := testcluster.SubmitTestJob(t, cl, "https://ct.example", 2)
+	require.NoError(t, cl.MarkJobStarted(ctx, jobID))
+	require.NoError(t, cl.ReportShardDone(ctx, jobID, 0, cluster.ShardManifest{Records: 10, Bytes: 100, Chunks: 1}))
+	require.NoError(t, cl.ReportShardDone(ctx, jobID, 1, cluster.ShardManifest{Records: 20, Bytes: 300, Chunks: 2}))
+
+	mux := http.NewServeMux()
+	RegisterJobHandlers(mux, cl)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	client := &Client{BaseURL: srv.URL, Client: srv.Client()}
+
+	// Not available until the job completes
+	_, err := client.GetJobSummary(ctx, jobID)
+	require.Error(t, err)
+
+	require.NoError(t, cl.MarkJobCompleted(ctx, jobID))
+	summary, err := client.GetJobSummary(ctx, jobID)
+	require.NoError(t, err)
+	require.Equal(t, 2, summary.ShardsDone)
+	require.EqualValues(t, 30, summary.Records)
+	require.EqualValues(t, 400, summary.Bytes)
+	require.EqualValues(t, 3, summary.Chunks)
+
+	_, err = client.GetJobSummary(ctx, "no-such-job")
+	require.Error(t, err)
+}
+
+// slowCluster stalls ListJobs, either until the request's context ends or,
+// with ignoreCtx, for a fixed delay regardless of it.
+type slowCluster struct {
+	*stubCluster
+	ignoreCtx bool
+}
+
+func (s *slowCluster) ListJobs(ctx context.Context) ([]cluster.JobInfo, error) {
+	if s.ignoreCtx {
+		time.Sleep(300 * time.Millisecond)
+		return s.stubCluster.ListJobs(ctx)
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	for _, ignoreCtx := range []bool{false, true} {
+		stub := newStubCluster()
+		stub.jobs["fast"] = &cluster.JobInfo{ID: "fast"}
+		mux := http.NewServeMux()
+		RegisterJobHandlers(mux, &slowCluster{stubCluster: stub, ignoreCtx: ignoreCtx})
+		srv := httptest.NewServer(TimeoutMiddleware(50*time.Millisecond, mux))
+
+		start := time.Now()
+		resp, err := http.Get(srv.URL + "/api/jobs")
+		require.NoError(t, err)
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		resp.Body.Close()
+		require.Equal(t, http.StatusGatewayTimeout, resp.StatusCode, "ignoreCtx=%v", ignoreCtx)
+		require.Contains(t, body["error"], "timed out")
+		require.Less(t, time.Since(start), 250*time.Millisecond, "the 504 shouldn't wait for the handler")
+
+		// Requests that finish in time pass through untouched
+		resp, err = http.Get(srv.URL + "/api/jobs/fast")
+		require.NoError(t, err)
+		var info cluster.JobInfo
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		require.Equal(t, "fast", info.ID)
+
+		resp, err = http.Get(srv.URL + "/api/jobs/missing")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		srv.Close()
+	}
+}
+
+func TestClusterDumpEndpoint(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	jobID := testcluster.SubmitTestJob(t, cl, "https://ct.example.com/log", 3)
+	workerID, err := cl.RegisterWorker(ctx, cluster.WorkerInfo{Host: "testhost"})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	RegisterStatusHandler(mux, cl)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/cluster/dump")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+
+	var dump cluster.ClusterDump
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&dump))
+	require.False(t, dump.GeneratedAt.IsZero())
+
+	require.Len(t, dump.Jobs, 1)
+	require.Equal(t, jobID, dump.Jobs[0].Job.ID)
+	require.Equal(t, 3, dump.Jobs[0].Shards.Total)
+	require.Equal(t, 3, dump.Jobs[0].Shards.Pending)
+
+	require.Len(t, dump.Workers, 1)
+	require.Equal(t, workerID, dump.Workers[0].Worker.ID)
+	require.Equal(t, "testhost", dump.Workers[0].Worker.Host)
+}
+
 func TestAPI_ListPendingNodes(t *testing.T) {
 	server, cl := setupSecretsTestServer(t)
 	store := cl.Secrets()
@@ -313,3 +531,295 @@ func TestAPI_ListSecretsWithPrefix(t *testing.T) {
 	require.Contains(t, keys, "a/b/d")
 	require.NotContains(t, keys, "x/y/z")
 }
+
+func TestAPI_RotateClusterKey(t *testing.T) {
+	server, cl := setupSecretsTestServer(t)
+	store := cl.Secrets()
+	ctx := context.TODO()
+	require.NoError(t, store.Set(ctx, "foo", []byte("bar")))
+
+	client := NewClient(server.URL, "")
+	_, err := client.RotateClusterKey(ctx, [32]byte{})
+	require.Error(t, err, "an empty key should be refused")
+
+	newKey, _ := secrets.GenerateClusterKey()
+	result, err := client.RotateClusterKey(ctx, newKey)
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Secrets)
+
+	// The server's store now reads with the new key
+	got, err := store.Get(ctx, "foo")
+	require.NoError(t, err)
+	require.Equal(t, []byte("bar"), got)
+	sealed, err := client.GetSecret(ctx, "foo")
+	require.NoError(t, err)
+	var nonce [24]byte
+	copy(nonce[:], sealed[:24])
+	plain, ok := secretbox.Open(nil, sealed[24:], &nonce, &newKey)
+	require.True(t, ok)
+	require.Equal(t, []byte("bar"), plain)
+}
+
+func TestAPI_SecretHistory(t *testing.T) {
+	server, cl := setupSecretsTestServer(t)
+	store := cl.Secrets()
+	ctx := context.TODO()
+	require.NoError(t, store.Set(ctx, "a/b", []byte("first")))
+	require.NoError(t, store.Set(ctx, "a/b", []byte("second")))
+
+	client := NewClient(server.URL, "")
+	versions, err := client.ListSecretVersions(ctx, "a/b")
+	require.NoError(t, err)
+	require.Equal(t, []secrets.SecretVersion{{Version: 1}, {Version: 2, Current: true}}, versions)
+
+	sealed, err := client.GetSecretVersion(ctx, "a/b", 1)
+	require.NoError(t, err)
+	require.NotEmpty(t, sealed)
+	_, err = client.GetSecretVersion(ctx, "a/b", 3)
+	require.Error(t, err)
+
+	require.NoError(t, client.RollbackSecret(ctx, "a/b", 1))
+	got, err := store.Get(ctx, "a/b")
+	require.NoError(t, err)
+	require.Equal(t, []byte("first"), got)
+	require.Error(t, client.RollbackSecret(ctx, "a/b", 5))
+}
+
+func TestAPI_SecretAudit(t *testing.T) {
+	server, cl := setupSecretsTestServer(t)
+	ctx := context.TODO()
+	start := time.Now().Add(-time.Second)
+
+	client := NewClient(server.URL, "audit-token")
+	require.NoError(t, client.PutSecret(ctx, "db/password", []byte("sealed")))
+	_, err := client.GetSecret(ctx, "db/password")
+	require.NoError(t, err)
+	_, err = client.GetSecret(ctx, "missing")
+	require.Error(t, err)
+
+	// Entries are written in the background
+	var entries []secrets.AuditEntry
+	require.Eventually(t, func() bool {
+		entries, err = client.ListSecretAudit(ctx, "db/password", start, 0)
+		return err == nil && len(entries) == 2
+	}, 5*time.Second, 50*time.Millisecond)
+
+	ops := map[string]secrets.AuditEntry{}
+	for _, e := range entries {
+		ops[e.Operation] = e
+	}
+	for _, op := range []string{secrets.AuditSet, secrets.AuditGet} {
+		e, ok := ops[op]
+		require.True(t, ok, "missing %s entry", op)
+		require.Equal(t, "db/password", e.Key)
+		require.Equal(t, tokenID(&http.Request{Header: http.Header{"Authorization": {"Bearer audit-token"}}}), e.TokenID)
+		require.NotEmpty(t, e.TokenID)
+		require.NotContains(t, e.TokenID, "audit-token")
+		require.NotEmpty(t, e.Remote)
+		require.Equal(t, cl.Secrets().NodeId(), e.Node)
+		require.Empty(t, e.Error)
+		require.False(t, e.Time.Before(start))
+	}
+
+	// Failed operations are recorded too
+	require.Eventually(t, func() bool {
+		entries, err = client.ListSecretAudit(ctx, "missing", time.Time{}, 0)
+		return err == nil && len(entries) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Equal(t, "not found", entries[0].Error)
+
+	// Nothing is listed from a later time
+	entries, err = client.ListSecretAudit(ctx, "", time.Now().Add(time.Hour), 0)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// A limit returns the oldest entries
+	entries, err = client.ListSecretAudit(ctx, "", start, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, secrets.AuditSet, entries[0].Operation)
+	resp, err := http.Get(server.URL + "/api/secrets/audit?limit=0")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAPI_DenyAndRevokeNode(t *testing.T) {
+	server, cl := setupSecretsTestServer(t)
+	store := cl.Secrets()
+	ctx := context.TODO()
+	client := NewClient(server.URL, "")
+
+	pub := [32]byte{1, 2, 3}
+	pubB64 := base64.StdEncoding.EncodeToString(pub[:])
+	for _, nodeID := range []string{"denied", "revoked"} {
+		_, err := store.Client().Put(ctx, store.Prefix()+"/registration/pending/"+nodeID, pubB64)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, client.DenyNode(ctx, "denied"))
+	pending, err := client.ListPendingNodes(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, "revoked", pending[0].NodeID)
+	require.Error(t, client.DenyNode(ctx, "denied"))
+
+	require.Error(t, client.RevokeNode(ctx, "revoked"), "a pending node isn't approved yet")
+	require.NoError(t, client.ApproveNode(ctx, "revoked"))
+	require.NoError(t, client.RevokeNode(ctx, "revoked"))
+	kv, err := store.Client().Get(ctx, store.Prefix()+"/secrets/keys/revoked")
+	require.NoError(t, err)
+	require.Empty(t, kv.Kvs)
+}
+
+func TestScopedTokens(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+
+	srv := NewServer(cl, Config{
+		AuthTokens: []string{"admin"},
+		ScopedTokens: []ScopedToken{
+			{Token: "reader", Scopes: []string{ScopeJobsRead}},
+			{Token: "secrets-reader", Scopes: []string{ScopeSecretsRead}},
+		},
+	}, log.New(io.Discard, "", 0))
+	handler, err := srv.Handler()
+	require.NoError(t, err)
+
+	do := func(token, method, path string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A read-only token can list jobs, but not submit them or touch secrets
+	require.Equal(t, http.StatusOK, do("reader", "GET", "/api/jobs"))
+	require.Equal(t, http.StatusForbidden, do("reader", "POST", "/api/jobs"))
+	require.Equal(t, http.StatusForbidden, do("reader", "POST", "/api/jobs/someid/cancel"))
+	require.Equal(t, http.StatusForbidden, do("reader", "GET", "/api/secrets/store"))
+	require.Equal(t, http.StatusForbidden, do("reader", "PUT", "/api/secrets/store/k"))
+	require.Equal(t, http.StatusForbidden, do("reader", "GET", "/api/secrets/nodes/pending"))
+	require.Equal(t, http.StatusForbidden, do("reader", "GET", "/api/workers"))
+
+	// Secret scopes are split by what they allow
+	require.Equal(t, http.StatusOK, do("secrets-reader", "GET", "/api/secrets/store"))
+	require.Equal(t, http.StatusForbidden, do("secrets-reader", "DELETE", "/api/secrets/store/k"))
+	require.Equal(t, http.StatusForbidden, do("secrets-reader", "POST", "/api/secrets/rollback/k"))
+	require.Equal(t, http.StatusForbidden, do("secrets-reader", "GET", "/api/secrets/audit"))
+
+	// Legacy tokens may do anything; unknown tokens are unauthorized
+	require.Equal(t, http.StatusOK, do("admin", "GET", "/api/secrets/store"))
+	require.Equal(t, http.StatusOK, do("admin", "GET", "/api/workers"))
+	require.NotEqual(t, http.StatusForbidden, do("admin", "POST", "/api/jobs"))
+	require.Equal(t, http.StatusUnauthorized, do("nobody", "GET", "/api/jobs"))
+
+	// Unknown scopes are a configuration error
+	srv = NewServer(cl, Config{ScopedTokens: []ScopedToken{{Token: "t", Scopes: []string{"jobs:admin"}}}}, log.New(io.Discard, "", 0))
+	_, err = srv.Handler()
+	require.Error(t, err)
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	stub := newStubCluster()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	RegisterJobHandlers(mux, stub)
+	var buf bytes.Buffer
+	handler := AccessLogMiddleware(log.New(&buf, "", 0), DefaultAccessLogSkipPaths, TokenAuthMiddleware([]string{"testtoken"}, mux))
+
+	body := `{"version":"1.0.0","log_uri":"test","options":{"fetch":{"fetch_size":10,"fetch_workers":1,"index_start":0,"index_end":100},"match":{},"output":{"extractor":"raw","transformer":"passthrough","sink":"null"}}}`
+	req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer testtoken")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	req = httptest.NewRequest("GET", "/api/jobs", nil)
+	req.Header.Set("Authorization", "Bearer WRONGTOKEN")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Skipped
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var entries [2]map[string]any
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal([]byte(line), &entries[i]), "line %d isn't JSON: %s", i, line)
+	}
+
+	require.Equal(t, "POST", entries[0]["method"])
+	require.Equal(t, "/api/jobs", entries[0]["path"])
+	require.EqualValues(t, http.StatusCreated, entries[0]["status"])
+	require.Contains(t, entries[0], "duration_ms")
+	require.NotEmpty(t, entries[0]["token_id"])
+	require.Equal(t, "GET", entries[1]["method"])
+	require.EqualValues(t, http.StatusUnauthorized, entries[1]["status"])
+	require.NotEqual(t, entries[0]["token_id"], entries[1]["token_id"])
+	require.NotContains(t, buf.String(), "testtoken")
+	require.NotContains(t, buf.String(), "WRONGTOKEN")
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l, err := newRateLimiter(RateLimitConfig{
+		Rate:  1,
+		Burst: 3,
+		Paths: []PathRateLimit{{Path: "/api/jobs/*/shards", Rate: 0.5, Burst: 1}},
+	}, func() time.Time { return now })
+	require.NoError(t, err)
+	handler := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(token, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The burst is allowed, then requests are refused until the bucket refills
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusOK, do("a", "/api/status").Code, "request %d", i)
+	}
+	rec := do("a", "/api/status")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	// Other clients have buckets of their own, including those keyed by IP
+	require.Equal(t, http.StatusOK, do("b", "/api/status").Code)
+	require.Equal(t, http.StatusOK, do("", "/api/status").Code)
+
+	// Overridden paths draw on their own, smaller bucket
+	require.Equal(t, http.StatusOK, do("a", "/api/jobs/j1/shards").Code)
+	rec = do("a", "/api/jobs/j2/shards/4/reset")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	now = now.Add(time.Second)
+	require.Equal(t, http.StatusOK, do("a", "/api/status").Code)
+	require.Equal(t, http.StatusTooManyRequests, do("a", "/api/status").Code)
+	require.Equal(t, http.StatusTooManyRequests, do("a", "/api/jobs/j1/shards").Code)
+
+	// Refilling stops at the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusOK, do("a", "/api/status").Code, "request %d after refill", i)
+	}
+	require.Equal(t, http.StatusTooManyRequests, do("a", "/api/status").Code)
+	require.Equal(t, http.StatusOK, do("a", "/api/jobs/j1/shards").Code)
+
+	_, err = newRateLimiter(RateLimitConfig{Rate: 0}, time.Now)
+	require.Error(t, err)
+	_, err = newRateLimiter(RateLimitConfig{Rate: 1, Paths: []PathRateLimit{{Path: "/x", Rate: -1}}}, time.Now)
+	require.Error(t, err)
+}
@@ -70,3 +70,24 @@ func (c *Client) GetClusterStatus(ctx context.Context) (*cluster.ClusterStatus,
 	}
 	return &status, nil
 }
+
+func (c *Client) DumpClusterState(ctx context.Context) (*cluster.ClusterDump, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/cluster/dump", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseAPIError(resp)
+	}
+	var dump cluster.ClusterDump
+	if err := json.NewDecoder(resp.Body).Decode(&dump); err != nil {
+		return nil, err
+	}
+	return &dump, nil
+}
@@ -1,13 +1,17 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/cluster"
 	"github.com/chtzvt/certslurp/internal/job"
@@ -42,6 +46,42 @@ func (c *Client) SubmitJob(ctx context.Context, spec *job.JobSpec) (string, erro
 	return out.JobID, nil
 }
 
+// SubmitJobs posts several job specs at once. Each is created or rejected on
+// its own; the results line up with specs, so check each one's Error.
+func (c *Client) SubmitJobs(ctx context.Context, specs []*job.JobSpec) ([]JobSubmitResult, error) {
+	b, err := json.Marshal(specs)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/api/jobs/batch", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	req.Header.Set("Content-Type", "application/json")
+	// The server answers within its own request timeout, saying which specs
+	// it didn't get to. Giving up sooner would leave the caller not knowing
+	// which jobs were created.
+	hc := *c.Client
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMultiStatus {
+		return nil, parseAPIError(resp)
+	}
+	var results []JobSubmitResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, err
+	}
+	if len(results) != len(specs) {
+		return nil, fmt.Errorf("expected %d results, got %d", len(specs), len(results))
+	}
+	return results, nil
+}
+
 // GetJob fetches a job by ID.
 func (c *Client) GetJob(ctx context.Context, id string) (*cluster.JobInfo, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/jobs/"+id, nil)
@@ -64,6 +104,101 @@ func (c *Client) GetJob(ctx context.Context, id string) (*cluster.JobInfo, error
 	return &info, nil
 }
 
+// GetJobSummary fetches the rollup stored when a job completed.
+func (c *Client) GetJobSummary(ctx context.Context, id string) (*cluster.JobSummary, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/jobs/"+url.PathEscape(id)+"/summary", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseAPIError(resp)
+	}
+	var summary cluster.JobSummary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// GetJobProgress fetches the aggregate state of a job's shards.
+func (c *Client) GetJobProgress(ctx context.Context, id string) (*cluster.JobProgress, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/jobs/"+url.PathEscape(id)+"/progress", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseAPIError(resp)
+	}
+	var progress cluster.JobProgress
+	if err := json.NewDecoder(resp.Body).Decode(&progress); err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+// WatchJob GET /api/jobs/{id}/events
+// Streams changes to the job and its shards. The channel is closed once the
+// job finishes, ctx is done, or the connection drops.
+func (c *Client) WatchJob(ctx context.Context, id string) (<-chan cluster.JobEvent, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/jobs/"+url.PathEscape(id)+"/events", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	req.Header.Set("Accept", "text/event-stream")
+	// The stream lasts as long as the job, well past the client's timeout
+	hc := *c.Client
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, parseAPIError(resp)
+	}
+
+	events := make(chan cluster.JobEvent)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		var data []string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "" && len(data) > 0:
+				var ev cluster.JobEvent
+				err := json.Unmarshal([]byte(strings.Join(data, "\n")), &ev)
+				data = data[:0]
+				if err != nil {
+					continue
+				}
+				select {
+				case events <- ev:
+				case <-ctx.Done():
+					return
+				}
+			case strings.HasPrefix(line, "data:"):
+				data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			}
+		}
+	}()
+	return events, nil
+}
+
 // ListJobs returns all jobs.
 func (c *Client) ListJobs(ctx context.Context) ([]cluster.JobInfo, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/jobs", nil)
@@ -86,6 +221,38 @@ func (c *Client) ListJobs(ctx context.Context) ([]cluster.JobInfo, error) {
 	return jobs, nil
 }
 
+// ListJobsFiltered returns a page of jobs, optionally only those in
+// opts.Status. Pass the returned page's NextCursor as opts.Cursor to fetch
+// the next one; it's empty on the last page.
+func (c *Client) ListJobsFiltered(ctx context.Context, opts cluster.JobListOptions) (*cluster.JobPage, error) {
+	q := url.Values{}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	q.Set("cursor", opts.Cursor)
+	if opts.Status != "" {
+		q.Set("status", string(opts.Status))
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/jobs?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseAPIError(resp)
+	}
+	page := &cluster.JobPage{NextCursor: resp.Header.Get("X-Next-Cursor")}
+	if err := json.NewDecoder(resp.Body).Decode(&page.Jobs); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
 // UpdateJobStatus PATCH /api/jobs/{id}/status
 func (c *Client) UpdateJobStatus(ctx context.Context, jobID string, status cluster.JobState) error {
 	body := map[string]string{"status": string(status)}
@@ -161,6 +328,60 @@ func (c *Client) CancelJob(ctx context.Context, jobID string) error {
 	return nil
 }
 
+// PauseJob POST /api/jobs/{id}/pause
+func (c *Client) PauseJob(ctx context.Context, jobID string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/api/jobs/"+url.PathEscape(jobID)+"/pause", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return parseAPIError(resp)
+	}
+	return nil
+}
+
+// PurgeJob DELETE /api/jobs/{id}
+func (c *Client) PurgeJob(ctx context.Context, jobID string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", c.BaseURL+"/api/jobs/"+url.PathEscape(jobID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return parseAPIError(resp)
+	}
+	return nil
+}
+
+// ResumeJob POST /api/jobs/{id}/resume
+func (c *Client) ResumeJob(ctx context.Context, jobID string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/api/jobs/"+url.PathEscape(jobID)+"/resume", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return parseAPIError(resp)
+	}
+	return nil
+}
+
 // GetShardAssignments GET /api/jobs/{jobID}/shards?start=...&end=...
 func (c *Client) GetShardAssignments(ctx context.Context, jobID string, start, end *int) (map[int]cluster.ShardAssignmentStatus, error) {
 	urlStr := c.BaseURL + "/api/jobs/" + url.PathEscape(jobID) + "/shards"
@@ -260,3 +481,81 @@ func (c *Client) ResetFailedShard(ctx context.Context, jobID string, shardID int
 	}
 	return nil
 }
+
+// SkipShard excludes a shard from the job, recording the reason.
+func (c *Client) SkipShard(ctx context.Context, jobID string, shardID int, reason string) error {
+	urlStr := c.BaseURL + "/api/jobs/" + url.PathEscape(jobID) + "/shards/" + strconv.Itoa(shardID) + "/skip"
+	body, err := json.Marshal(map[string]string{"reason": reason})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return parseAPIError(resp)
+	}
+	return nil
+}
+
+// SetShardPreferredWorker POST /api/jobs/{id}/shards/{shardID}/prefer
+// Hints that workerID should claim the shard, holding other workers off for
+// grace. An empty workerID clears the hint.
+func (c *Client) SetShardPreferredWorker(ctx context.Context, jobID string, shardID int, workerID string, grace time.Duration) error {
+	urlStr := c.BaseURL + "/api/jobs/" + url.PathEscape(jobID) + "/shards/" + strconv.Itoa(shardID) + "/prefer"
+	body, err := json.Marshal(map[string]any{"worker_id": workerID, "grace_secs": int(grace / time.Second)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return parseAPIError(resp)
+	}
+	return nil
+}
+
+// GetShardOutput GET /api/jobs/{id}/shards/{shardID}/output?chunk=N
+// Returns the chunk's contents and whether the server truncated them. Pass
+// chunk 0 for unchunked output.
+func (c *Client) GetShardOutput(ctx context.Context, jobID string, shardID, chunk int) ([]byte, bool, error) {
+	u := fmt.Sprintf("%s/api/jobs/%s/shards/%d/output", c.BaseURL, url.PathEscape(jobID), shardID)
+	if chunk > 0 {
+		u += fmt.Sprintf("?chunk=%04d", chunk)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, parseAPIError(resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, resp.Header.Get("X-Certslurp-Truncated") == "true", nil
+}
@@ -32,7 +32,7 @@ func TestClient_UpdateJobStatus(t *testing.T) {
 
 func TestClient_MarkJobStartedCompletedCancelled(t *testing.T) {
 	jobID := "abc"
-	paths := []string{"/api/jobs/" + jobID + "/start", "/api/jobs/" + jobID + "/complete", "/api/jobs/" + jobID + "/cancel"}
+	paths := []string{"/api/jobs/" + jobID + "/start", "/api/jobs/" + jobID + "/complete", "/api/jobs/" + jobID + "/cancel", "/api/jobs/" + jobID + "/pause", "/api/jobs/" + jobID + "/resume"}
 	for _, p := range paths {
 		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			require.Equal(t, p, r.URL.Path)
@@ -48,12 +48,34 @@ func TestClient_MarkJobStartedCompletedCancelled(t *testing.T) {
 			err = client.MarkJobCompleted(context.Background(), jobID)
 		case strings.Contains(p, "/cancel"):
 			err = client.CancelJob(context.Background(), jobID)
+		case strings.Contains(p, "/pause"):
+			err = client.PauseJob(context.Background(), jobID)
+		case strings.Contains(p, "/resume"):
+			err = client.ResumeJob(context.Background(), jobID)
 		}
 		require.NoError(t, err)
 		srv.Close()
 	}
 }
 
+func TestClient_ListJobsFiltered(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/jobs", r.URL.Path)
+		require.Equal(t, "2", r.URL.Query().Get("limit"))
+		require.Equal(t, "a", r.URL.Query().Get("cursor"))
+		require.Equal(t, "running", r.URL.Query().Get("status"))
+		w.Header().Set("X-Next-Cursor", "c")
+		_ = json.NewEncoder(w).Encode([]cluster.JobInfo{{ID: "b"}, {ID: "c"}})
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, "tok")
+	page, err := client.ListJobsFiltered(context.Background(), cluster.JobListOptions{Limit: 2, Cursor: "a", Status: cluster.JobStateRunning})
+	require.NoError(t, err)
+	require.Len(t, page.Jobs, 2)
+	require.Equal(t, "c", page.NextCursor)
+}
+
 func TestClient_GetShardAssignments(t *testing.T) {
 	jobID := "abc"
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -139,3 +161,19 @@ func TestClient_ResetFailedShard(t *testing.T) {
 	err := client.ResetFailedShard(context.Background(), "jobid", 0)
 	require.NoError(t, err)
 }
+
+func TestClient_SkipShard(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "POST", r.Method)
+		require.Contains(t, r.URL.Path, "/shards/3/skip")
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, "pre-cutover", body["reason"])
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL, "tok")
+	err := client.SkipShard(context.Background(), "jobid", 3, "pre-cutover")
+	require.NoError(t, err)
+}
@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/secrets"
 )
@@ -67,6 +69,63 @@ func (c *Client) ApproveNode(ctx context.Context, nodeID string) error {
 	return nil
 }
 
+// DenyNode rejects a pending worker registration.
+func (c *Client) DenyNode(ctx context.Context, nodeID string) error {
+	return c.postNodeAction(ctx, "/api/secrets/nodes/deny", nodeID)
+}
+
+// RevokeNode removes an approved worker's sealed cluster key.
+func (c *Client) RevokeNode(ctx context.Context, nodeID string) error {
+	return c.postNodeAction(ctx, "/api/secrets/nodes/revoke", nodeID)
+}
+
+func (c *Client) postNodeAction(ctx context.Context, path, nodeID string) error {
+	b, _ := json.Marshal(map[string]string{"node_id": nodeID})
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return parseAPIError(resp)
+	}
+	return nil
+}
+
+// RotateClusterKey has the head node re-encrypt every secret under newKey
+// and seal it for each approved node. The new key is sent to the server.
+func (c *Client) RotateClusterKey(ctx context.Context, newKey [32]byte) (*secrets.RotationResult, error) {
+	body := map[string]string{
+		"cluster_key": base64.StdEncoding.EncodeToString(newKey[:]),
+	}
+	b, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/api/secrets/rotate", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseAPIError(resp)
+	}
+	var result secrets.RotationResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // ListSecrets lists all secret keys in the store (optionally with prefix).
 func (c *Client) ListSecrets(ctx context.Context, prefix string) ([]string, error) {
 	urlStr := c.BaseURL + "/api/secrets/store"
@@ -162,3 +221,109 @@ func (c *Client) DeleteSecret(ctx context.Context, key string) error {
 	}
 	return nil
 }
+
+// ListSecretVersions lists the stored versions of a secret, oldest first.
+func (c *Client) ListSecretVersions(ctx context.Context, key string) ([]secrets.SecretVersion, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/secrets/history/"+url.PathEscape(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseAPIError(resp)
+	}
+	var versions []secrets.SecretVersion
+	if err := json.NewDecoder(resp.Body).Decode(&versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// GetSecretVersion fetches the *encrypted* value of one version of a secret,
+// like GetSecret.
+func (c *Client) GetSecretVersion(ctx context.Context, key string, version int) ([]byte, error) {
+	urlStr := c.BaseURL + "/api/secrets/store/" + url.PathEscape(key) + "?version=" + strconv.Itoa(version)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseAPIError(resp)
+	}
+	var out struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out.Value)
+}
+
+// RollbackSecret makes an earlier version of a secret its current value.
+func (c *Client) RollbackSecret(ctx context.Context, key string, version int) error {
+	b, _ := json.Marshal(map[string]int{"version": version})
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/api/secrets/rollback/"+url.PathEscape(key), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return parseAPIError(resp)
+	}
+	return nil
+}
+
+// ListSecretAudit fetches the secret store's audit log from since on (all, if
+// zero), optionally only for one key, oldest first. At most limit entries are
+// returned, or the server's default number if it's zero.
+func (c *Client) ListSecretAudit(ctx context.Context, key string, since time.Time, limit int) ([]secrets.AuditEntry, error) {
+	q := url.Values{}
+	if key != "" {
+		q.Set("key", key)
+	}
+	if !since.IsZero() {
+		q.Set("since", since.UTC().Format(time.RFC3339Nano))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	urlStr := c.BaseURL + "/api/secrets/audit"
+	if len(q) > 0 {
+		urlStr += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AuthToken)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseAPIError(resp)
+	}
+	var entries []secrets.AuditEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -21,4 +21,18 @@ func RegisterStatusHandler(mux *http.ServeMux, cl cluster.Cluster) {
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(status)
 	})
+
+	mux.HandleFunc("/api/cluster/dump", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		dump, err := cl.DumpClusterState(r.Context())
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "unable to dump cluster state: "+err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(dump)
+	})
 }
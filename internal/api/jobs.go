@@ -1,12 +1,17 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/cluster"
 	"github.com/chtzvt/certslurp/internal/job"
@@ -36,13 +41,19 @@ func RegisterJobHandlers(mux *http.ServeMux, cl cluster.Cluster) {
 			return
 		}
 
+		// POST /api/jobs/batch
+		if len(parts) == 1 && id == "batch" && r.Method == "POST" {
+			handleSubmitJobs(w, r, cl)
+			return
+		}
+
 		// PATCH /api/jobs/{id}/status
 		if len(parts) == 2 && parts[1] == "status" && r.Method == "PATCH" {
 			handleUpdateJobStatus(w, r, cl, id)
 			return
 		}
 
-		// POST /api/jobs/{id}/start, /complete, /cancel
+		// POST /api/jobs/{id}/start, /complete, /cancel, /pause, /resume
 		if len(parts) == 2 && r.Method == "POST" {
 			switch parts[1] {
 			case "start":
@@ -54,9 +65,33 @@ func RegisterJobHandlers(mux *http.ServeMux, cl cluster.Cluster) {
 			case "cancel":
 				handleCancelJob(w, r, cl, id)
 				return
+			case "pause":
+				handlePauseJob(w, r, cl, id)
+				return
+			case "resume":
+				handleResumeJob(w, r, cl, id)
+				return
 			}
 		}
 
+		// GET /api/jobs/{id}/summary
+		if len(parts) == 2 && parts[1] == "summary" && r.Method == "GET" {
+			handleGetJobSummary(w, r, cl, id)
+			return
+		}
+
+		// GET /api/jobs/{id}/events
+		if len(parts) == 2 && parts[1] == "events" && r.Method == "GET" {
+			handleJobEvents(w, r, cl, id)
+			return
+		}
+
+		// GET /api/jobs/{id}/progress
+		if len(parts) == 2 && parts[1] == "progress" && r.Method == "GET" {
+			handleGetJobProgress(w, r, cl, id)
+			return
+		}
+
 		// SHARDS: /api/jobs/{id}/shards or /api/jobs/{id}/shards/{shardId}
 		if len(parts) >= 2 && parts[1] == "shards" {
 			if r.Method == "GET" {
@@ -79,6 +114,14 @@ func RegisterJobHandlers(mux *http.ServeMux, cl cluster.Cluster) {
 					handleResetFailedShard(w, r, cl, id, parts[2])
 					return
 				}
+				if len(parts) == 4 && parts[1] == "shards" && parts[3] == "skip" {
+					handleSkipShard(w, r, cl, id, parts[2])
+					return
+				}
+				if len(parts) == 4 && parts[1] == "shards" && parts[3] == "prefer" {
+					handlePreferShardWorker(w, r, cl, id, parts[2])
+					return
+				}
 			}
 
 			jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -91,6 +134,12 @@ func RegisterJobHandlers(mux *http.ServeMux, cl cluster.Cluster) {
 			return
 		}
 
+		// DELETE /api/jobs/{id} purges a finished job
+		if r.Method == "DELETE" && len(parts) == 1 {
+			handlePurgeJob(w, r, cl, id)
+			return
+		}
+
 		jsonError(w, http.StatusNotFound, "unknown endpoint")
 	})
 }
@@ -137,6 +186,30 @@ func handleCancelJob(w http.ResponseWriter, r *http.Request, cl cluster.Cluster,
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func handlePauseJob(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, id string) {
+	if err := cl.PauseJob(r.Context(), id); err != nil {
+		jsonError(w, http.StatusConflict, "failed to pause job: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleResumeJob(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, id string) {
+	if err := cl.ResumeJob(r.Context(), id); err != nil {
+		jsonError(w, http.StatusConflict, "failed to resume job: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handlePurgeJob(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, id string) {
+	if err := cl.PurgeJob(r.Context(), id); err != nil {
+		jsonError(w, http.StatusConflict, "failed to purge job: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func handleGetShardAssignments(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, jobID string) {
 	q := r.URL.Query()
 	var (
@@ -209,6 +282,56 @@ func handleResetFailedShard(w http.ResponseWriter, r *http.Request, cl cluster.C
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func handleSkipShard(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, jobID, shardIDStr string) {
+	shardID, err := strconv.Atoi(shardIDStr)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid shard id")
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			jsonError(w, http.StatusBadRequest, "invalid body")
+			return
+		}
+	}
+	if err := cl.SkipShard(r.Context(), jobID, shardID, req.Reason); err != nil {
+		jsonError(w, http.StatusConflict, "failed to skip shard: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePreferShardWorker sets or, given no worker_id, clears a shard's
+// preferred worker hint.
+func handlePreferShardWorker(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, jobID, shardIDStr string) {
+	shardID, err := strconv.Atoi(shardIDStr)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid shard id")
+		return
+	}
+	var req struct {
+		WorkerID  string `json:"worker_id"`
+		GraceSecs int    `json:"grace_secs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+	if req.GraceSecs < 0 {
+		jsonError(w, http.StatusBadRequest, "grace_secs must not be negative")
+		return
+	}
+	grace := time.Duration(req.GraceSecs) * time.Second
+	if err := cl.SetShardPreferredWorker(r.Context(), jobID, shardID, req.WorkerID, grace); err != nil {
+		jsonError(w, http.StatusConflict, "failed to set preferred worker: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func handleGetJob(w http.ResponseWriter, r *http.Request, cl cluster.Cluster) {
 	id := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
 	if id == "" {
@@ -224,35 +347,316 @@ func handleGetJob(w http.ResponseWriter, r *http.Request, cl cluster.Cluster) {
 	_ = json.NewEncoder(w).Encode(jobInfo)
 }
 
+// jobEventsKeepalive is how often an idle event stream gets a comment, so
+// proxies and clients can tell it from a dead connection.
+const jobEventsKeepalive = 15 * time.Second
+
+// handleJobEvents streams changes to the job and its shards as Server-Sent
+// Events, until the job finishes or the client goes away. Each event is named
+// "job" or "shard" and carries a cluster.JobEvent as JSON.
+func handleJobEvents(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, jobID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	// Cancelled with the request, which stops the watch when the client
+	// disconnects
+	events, err := cl.WatchJob(r.Context(), jobID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "not found: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(jobEventsKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			name := "job"
+			if ev.ShardID != nil {
+				name = "shard"
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Revision, name, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func handleGetJobSummary(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, id string) {
+	jobInfo, err := cl.GetJob(r.Context(), id)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "not found: "+err.Error())
+		return
+	}
+	if jobInfo.Summary == nil {
+		jsonError(w, http.StatusNotFound, "job has no summary until it completes")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(jobInfo.Summary)
+}
+
+func handleGetJobProgress(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, id string) {
+	progress, err := cl.GetJobProgress(r.Context(), id)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(progress)
+}
+
+// handleListJobs lists every job, or with any of ?limit=, ?cursor= and
+// ?status=, a page of them. The cursor for the next page is returned in the
+// X-Next-Cursor header.
 func handleListJobs(w http.ResponseWriter, r *http.Request, cl cluster.Cluster) {
-	jobs, err := cl.ListJobs(r.Context())
+	q := r.URL.Query()
+	if !q.Has("limit") && !q.Has("cursor") && !q.Has("status") {
+		jobs, err := cl.ListJobs(r.Context())
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to list jobs: "+err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(jobs)
+		return
+	}
+
+	opts := cluster.JobListOptions{Cursor: q.Get("cursor"), Status: cluster.JobState(q.Get("status"))}
+	if l := q.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			jsonError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		opts.Limit = limit
+	}
+	page, err := cl.ListJobsFiltered(r.Context(), opts)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to list jobs: "+err.Error())
 		return
 	}
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(jobs)
+	_ = json.NewEncoder(w).Encode(page.Jobs)
 }
 
 func handleSubmitJob(w http.ResponseWriter, r *http.Request, cl cluster.Cluster) {
 	var spec job.JobSpec
-	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+	dec := json.NewDecoder(r.Body)
+	// ?strict=true rejects fields that don't exist in the job spec
+	if strict, _ := strconv.ParseBool(r.URL.Query().Get("strict")); strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(&spec); err != nil {
 		jsonError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
 		return
 	}
-	if err := spec.Validate(); err != nil {
-		jsonError(w, http.StatusBadRequest, "job spec invalid: "+err.Error())
+	jobID, status, err := createJob(r.Context(), cl, &spec)
+	if err != nil {
+		jsonError(w, status, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]string{"job_id": jobID})
+}
+
+// maxBatchJobs is the most specs a single batch submission may carry.
+const maxBatchJobs = 500
+
+// JobSubmitResult is the outcome of one spec in a batch submission: the new
+// job's ID, or why it wasn't created.
+type JobSubmitResult struct {
+	JobID string `json:"job_id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// batchTreeSizeWorkers is how many CT logs a batch submission asks for their
+// tree size at once.
+const batchTreeSizeWorkers = 8
+
+// errBatchOutOfTime is the result for specs a batch submission had no time
+// left to create. None of their jobs exist, so they can be sent again.
+var errBatchOutOfTime = errors.New("not submitted: the batch ran out of time, resubmit this spec")
+
+// handleSubmitJobs creates a job for each spec in a JSON array. Specs are
+// handled independently, so one bad spec doesn't hold back the rest; the
+// response lists a JobSubmitResult per spec, in order, with 201 if every
+// job was created and 207 otherwise.
+//
+// The tree sizes of specs without an end index are all fetched, in parallel,
+// before any job is created. With a request deadline, fetching may use half
+// of the time left and creating jobs three quarters, so that the response,
+// naming any specs that weren't reached, goes out before the deadline does
+// and a client never has to guess which jobs exist.
+func handleSubmitJobs(w http.ResponseWriter, r *http.Request, cl cluster.Cluster) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid JSON: expected an array of job specs: "+err.Error())
+		return
+	}
+	if len(raw) == 0 {
+		jsonError(w, http.StatusBadRequest, "no job specs given")
+		return
+	}
+	if len(raw) > maxBatchJobs {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("too many job specs: %d (max %d)", len(raw), maxBatchJobs))
+		return
+	}
+	strict, _ := strconv.ParseBool(r.URL.Query().Get("strict"))
+
+	ctx := r.Context()
+	resolveCtx, createBy := ctx, time.Time{}
+	if deadline, ok := ctx.Deadline(); ok {
+		left := time.Until(deadline)
+		var cancel context.CancelFunc
+		resolveCtx, cancel = context.WithTimeout(ctx, left/2)
+		defer cancel()
+		createBy = time.Now().Add(left * 3 / 4)
+	}
+
+	results := make([]JobSubmitResult, len(raw))
+	specs := make([]*job.JobSpec, len(raw))
+	for i, item := range raw {
+		var spec job.JobSpec
+		dec := json.NewDecoder(bytes.NewReader(item))
+		if strict {
+			dec.DisallowUnknownFields()
+		}
+		if err := dec.Decode(&spec); err != nil {
+			results[i].Error = "invalid JSON: " + err.Error()
+			continue
+		}
+		if err := spec.Validate(); err != nil {
+			results[i].Error = fmt.Sprintf("job spec invalid: %v", err)
+			continue
+		}
+		specs[i] = &spec
+	}
+	resolveTreeSizes(resolveCtx, specs, results)
+
+	created := 0
+	for i, spec := range specs {
+		if spec == nil {
+			continue
+		}
+		if !createBy.IsZero() && time.Now().After(createBy) {
+			results[i].Error = errBatchOutOfTime.Error()
+			continue
+		}
+		jobID, _, err := createJob(ctx, cl, spec)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].JobID = jobID
+		created++
+	}
+
+	status := http.StatusCreated
+	if created < len(raw) {
+		status = http.StatusMultiStatus
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(results)
+}
+
+// resolveTreeSizes sets the end index of every spec that has none to its
+// log's tree size. Each log is asked once, however many specs name it, by up
+// to batchTreeSizeWorkers at a time. Specs whose log couldn't be asked are
+// set to nil, with the reason in their result.
+func resolveTreeSizes(ctx context.Context, specs []*job.JobSpec, results []JobSubmitResult) {
+	type treeSize struct {
+		size int64
+		err  error
+	}
+	sizes := map[string]*treeSize{}
+	for _, spec := range specs {
+		if spec != nil && spec.Options.Fetch.IndexEnd == 0 {
+			sizes[spec.LogURI] = &treeSize{}
+		}
+	}
+	if len(sizes) == 0 {
 		return
 	}
 
+	uris := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < min(batchTreeSizeWorkers, len(sizes)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for uri := range uris {
+				// Each worker writes only the entries it's handed
+				ts := sizes[uri]
+				ts.size, ts.err = fetchCTLogTreeSize(ctx, uri)
+			}
+		}()
+	}
+	for uri := range sizes {
+		uris <- uri
+	}
+	close(uris)
+	wg.Wait()
+
+	for i, spec := range specs {
+		if spec == nil || spec.Options.Fetch.IndexEnd != 0 {
+			continue
+		}
+		ts := sizes[spec.LogURI]
+		switch {
+		case ts.err != nil:
+			results[i].Error = fmt.Sprintf("could not determine end index: %v", ts.err)
+			specs[i] = nil
+		case ts.size <= spec.Options.Fetch.IndexStart:
+			results[i].Error = "no shards would be created with provided indices/shard size"
+			specs[i] = nil
+		default:
+			spec.Options.Fetch.IndexEnd = ts.size
+		}
+	}
+}
+
+// createJob validates spec, resolves its end index, and submits it with its
+// shards. On failure it returns the HTTP status the error maps to.
+func createJob(ctx context.Context, cl cluster.Cluster, spec *job.JobSpec) (string, int, error) {
+	if err := spec.Validate(); err != nil {
+		return "", http.StatusBadRequest, fmt.Errorf("job spec invalid: %w", err)
+	}
+
 	// If IndexEnd is zero, fetch from CT log (requires network)
 	start := spec.Options.Fetch.IndexStart
 	end := spec.Options.Fetch.IndexEnd
 	if end == 0 {
-		treeSize, err := fetchCTLogTreeSize(spec.LogURI)
+		treeSize, err := fetchCTLogTreeSize(ctx, spec.LogURI)
 		if err != nil {
-			jsonError(w, http.StatusBadRequest, "could not determine end index: "+err.Error())
-			return
+			return "", http.StatusBadRequest, fmt.Errorf("could not determine end index: %w", err)
 		}
 		end = treeSize
 		spec.Options.Fetch.IndexEnd = treeSize
@@ -264,35 +668,32 @@ func handleSubmitJob(w http.ResponseWriter, r *http.Request, cl cluster.Cluster)
 	}
 
 	// Create the shards
-	ranges := makeShardRanges(start, end, shardSize)
+	ranges := makeShardRanges(start, end, shardSize, spec.Options.Fetch.ShardAlignment)
 
-	ctx := r.Context()
-	jobID, err := cl.SubmitJob(ctx, &spec)
-	if err != nil {
-		jsonError(w, http.StatusInternalServerError, "failed to submit job: "+err.Error())
-		return
+	if len(ranges) == 0 {
+		return "", http.StatusBadRequest, errors.New("no shards would be created with provided indices/shard size")
 	}
 
-	if len(ranges) == 0 {
-		jsonError(w, http.StatusBadRequest, "no shards would be created with provided indices/shard size")
-		return
+	jobID, err := cl.SubmitJob(ctx, spec)
+	if err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("failed to submit job: %w", err)
 	}
 	if err := cl.BulkCreateShards(ctx, jobID, ranges); err != nil {
-		jsonError(w, http.StatusInternalServerError, "failed to create shards: "+err.Error())
-		return
+		return "", http.StatusInternalServerError, fmt.Errorf("failed to create shards: %w", err)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(map[string]string{"job_id": jobID})
+	return jobID, 0, nil
 }
 
 // --- Helpers ---
 
-func fetchCTLogTreeSize(logURI string) (int64, error) {
+func fetchCTLogTreeSize(ctx context.Context, logURI string) (int64, error) {
 	// Try to transform logURI if necessary (handle trailing slashes etc)
 	base := strings.TrimRight(logURI, "/")
-	resp, err := http.Get(base + "/ct/v1/get-sth")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/ct/v1/get-sth", nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return 0, err
 	}
@@ -332,10 +733,22 @@ func autoShardSize(start, end int64) int {
 	}
 }
 
-func makeShardRanges(start, end int64, shardSize int) []cluster.ShardRange {
+// makeShardRanges splits [start, end) into shards of shardSize entries. With
+// an alignment > 1, the size is rounded up to a multiple of it and every
+// boundary other than start and end falls on a multiple of it, so adjacent
+// shards never request the same log page.
+func makeShardRanges(start, end int64, shardSize, alignment int) []cluster.ShardRange {
+	align := int64(alignment)
+	size := int64(shardSize)
+	if align > 1 && size%align != 0 {
+		size += align - size%align
+	}
 	var ranges []cluster.ShardRange
 	for i, from := 0, start; from < end; i++ {
-		to := from + int64(shardSize)
+		to := from + size
+		if align > 1 {
+			to -= to % align
+		}
 		if to > end {
 			to = end
 		}
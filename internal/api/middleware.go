@@ -1,16 +1,31 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
+// TokenAuthMiddleware admits requests bearing one of tokens, each of which
+// has every scope.
 func TokenAuthMiddleware(tokens []string, next http.Handler) http.Handler {
-	allowed := make(map[string]struct{}, len(tokens))
+	grants := make(map[string][]string, len(tokens))
 	for _, t := range tokens {
-		allowed[t] = struct{}{}
+		grants[t] = []string{ScopeAll}
 	}
+	return ScopedTokenAuthMiddleware(grants, next)
+}
 
+// ScopedTokenAuthMiddleware admits requests bearing a token in grants,
+// answering 401 otherwise, and passes the token's scopes on for
+// RequireScopes to check.
+func ScopedTokenAuthMiddleware(grants map[string][]string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
 		if !strings.HasPrefix(auth, "Bearer ") {
@@ -20,10 +35,126 @@ func TokenAuthMiddleware(tokens []string, next http.Handler) http.Handler {
 		token := strings.TrimPrefix(auth, "Bearer ")
 		token = strings.TrimSpace(token)
 
-		if _, ok := allowed[token]; !ok {
+		scopes, ok := grants[token]
+		if !ok {
 			http.Error(w, "Unauthorized: invalid token", http.StatusUnauthorized)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(withTokenScopes(r.Context(), scopes)))
+	})
+}
+
+// tokenID identifies the request's bearer token by a prefix of its SHA-256,
+// so logs can tell tokens apart without revealing them.
+func tokenID(r *http.Request) string {
+	token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:6])
+}
+
+// DefaultRequestTimeout bounds API requests when Config.RequestTimeout is unset.
+const DefaultRequestTimeout = 30 * time.Second
+
+// TimeoutMiddleware gives each request a context that expires after timeout.
+// If the handler hasn't finished by then, the client gets a 504 and anything
+// the handler writes afterwards is discarded. Like http.TimeoutHandler,
+// responses are buffered until the handler returns, which is fine for the
+// API's small JSON bodies and size-capped output reads. Event streams run as
+// long as the job they follow, so they're passed through untouched.
+func TimeoutMiddleware(timeout time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isEventStream(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			// A handler that gave up because the deadline passed has overrun too
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				tw.flushTo(w)
+				return
+			}
+		case <-ctx.Done():
+		}
+
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.timedOut = true
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			jsonError(w, http.StatusGatewayTimeout, "request timed out after "+timeout.String())
+		}
 	})
 }
+
+// timeoutWriter buffers a handler's response so it can be dropped in favor
+// of a 504.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.header }
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.code == 0 {
+		tw.code = code
+	}
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) flushTo(w http.ResponseWriter) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	for k, v := range tw.header {
+		w.Header()[k] = v
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	w.WriteHeader(tw.code)
+	_, _ = w.Write(tw.buf.Bytes())
+}
+
+// isEventStream reports whether r is for a job's event stream,
+// GET /api/jobs/{id}/events.
+func isEventStream(r *http.Request) bool {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/"), "/")
+	return r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/api/jobs/") && len(parts) == 2 && parts[1] == "events"
+}
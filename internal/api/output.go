@@ -0,0 +1,140 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/etl"
+	"github.com/chtzvt/certslurp/internal/sink"
+)
+
+// DefaultOutputReadMaxBytes caps how much of a chunk is returned when no limit is configured.
+const DefaultOutputReadMaxBytes = 1 << 20
+
+// OutputReadConfig controls reading shard output back through the API. Reads
+// are disabled by default, since they expose the contents of the job's sink.
+type OutputReadConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Tokens, if set, restricts output reads to these API tokens.
+	Tokens []string `mapstructure:"tokens"`
+	// MaxBytes is the most that's returned for one chunk; larger chunks are truncated.
+	MaxBytes int64 `mapstructure:"max_bytes"`
+}
+
+// RegisterShardOutputHandler wires GET /api/jobs/{id}/shards/{shardID}/output?chunk=0001,
+// which returns a chunk of a shard's output read from the job's sink.
+func RegisterShardOutputHandler(mux *http.ServeMux, cl cluster.Cluster, cfg OutputReadConfig) {
+	mux.HandleFunc("GET /api/jobs/{id}/shards/{shardID}/output", func(w http.ResponseWriter, r *http.Request) {
+		handleGetShardOutput(w, r, cl, cfg)
+	})
+}
+
+func handleGetShardOutput(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, cfg OutputReadConfig) {
+	if !cfg.Enabled {
+		jsonError(w, http.StatusForbidden, "output reads are disabled")
+		return
+	}
+	if len(cfg.Tokens) > 0 {
+		token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		allowed := false
+		for _, t := range cfg.Tokens {
+			if t == token {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			jsonError(w, http.StatusForbidden, "token not permitted to read output")
+			return
+		}
+	}
+
+	jobID := r.PathValue("id")
+	shardID, err := strconv.Atoi(r.PathValue("shardID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid shard id")
+		return
+	}
+
+	info, err := cl.GetJob(r.Context(), jobID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	status, err := cl.GetShardStatus(r.Context(), jobID, shardID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "shard not found")
+		return
+	}
+
+	chunked := etl.Chunked(info.Spec)
+	chunk := 0
+	if c := r.URL.Query().Get("chunk"); c != "" {
+		chunk, err = strconv.Atoi(c)
+		if err != nil || chunk < 1 {
+			jsonError(w, http.StatusBadRequest, "invalid chunk")
+			return
+		}
+	} else if chunked {
+		jsonError(w, http.StatusBadRequest, "chunk is required for chunked output")
+		return
+	}
+
+	// Read from the first sink that supports it
+	var reader sink.ReadableSink
+	var names []string
+	for _, ss := range info.Spec.Options.Output.SinkSpecs() {
+		factory, ok := sink.ForName(ss.Name)
+		if !ok {
+			jsonError(w, http.StatusBadRequest, "unknown sink: "+ss.Name)
+			return
+		}
+		s, err := factory(ss.Options, cl.Secrets())
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "sink init: "+err.Error())
+			return
+		}
+		if rs, ok := s.(sink.ReadableSink); ok {
+			reader = rs
+			break
+		}
+		names = append(names, ss.Name)
+	}
+	if reader == nil {
+		jsonError(w, http.StatusNotImplemented, "sink does not support reads: "+strings.Join(names, ", "))
+		return
+	}
+
+	base := etl.OutputBaseName(info.Spec, status.IndexFrom, status.IndexTo, jobID, shardID)
+	rc, err := reader.OpenReader(r.Context(), etl.ChunkName(base, chunk, chunked))
+	if errors.Is(err, fs.ErrNotExist) {
+		jsonError(w, http.StatusNotFound, "chunk not found")
+		return
+	} else if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rc.Close()
+
+	maxBytes := cfg.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultOutputReadMaxBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, maxBytes+1))
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if int64(len(data)) > maxBytes {
+		data = data[:maxBytes]
+		w.Header().Set("X-Certslurp-Truncated", "true")
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig limits how fast each client may call the API: by token, or
+// by remote IP for requests without one. Each client gets a bucket of Burst
+// requests that refills at Rate per second.
+type RateLimitConfig struct {
+	Enabled bool    `mapstructure:"enabled"`
+	Rate    float64 `mapstructure:"rate"`
+	// Burst is how many requests may be made at once. Zero means Rate,
+	// rounded up.
+	Burst int `mapstructure:"burst"`
+	// Paths override the limits for some endpoints. The first that matches
+	// a request applies, and draws on a bucket of its own.
+	Paths []PathRateLimit `mapstructure:"paths"`
+}
+
+// PathRateLimit overrides the rate limit for requests whose path starts with
+// Path, where a "*" segment matches any one segment: "/api/jobs/*/shards"
+// covers every request about a job's shards.
+type PathRateLimit struct {
+	Path  string  `mapstructure:"path"`
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+}
+
+// rateLimitIdle is how often buckets that have refilled are forgotten; a
+// full bucket is the same as none.
+const rateLimitIdle = 10 * time.Minute
+
+type rateLimit struct {
+	rate  float64
+	burst float64
+}
+
+func newRateLimit(rate float64, burst int) (rateLimit, error) {
+	if rate <= 0 {
+		return rateLimit{}, errors.New("rate must be positive")
+	}
+	if burst < 0 {
+		return rateLimit{}, errors.New("burst must not be negative")
+	}
+	if burst == 0 {
+		burst = int(math.Ceil(rate))
+	}
+	return rateLimit{rate: rate, burst: float64(burst)}, nil
+}
+
+type bucketKey struct {
+	client string
+	rule   int // index into paths, or -1 for the default limit
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per client and rule.
+type rateLimiter struct {
+	def   rateLimit
+	paths []PathRateLimit
+	rules []rateLimit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(cfg RateLimitConfig, now func() time.Time) (*rateLimiter, error) {
+	def, err := newRateLimit(cfg.Rate, cfg.Burst)
+	if err != nil {
+		return nil, fmt.Errorf("rate_limit: %w", err)
+	}
+	l := &rateLimiter{def: def, paths: cfg.Paths, now: now, buckets: map[bucketKey]*bucket{}}
+	for i, p := range cfg.Paths {
+		if !strings.HasPrefix(p.Path, "/") {
+			return nil, fmt.Errorf("rate_limit.paths[%d]: path must start with /", i)
+		}
+		rule, err := newRateLimit(p.Rate, p.Burst)
+		if err != nil {
+			return nil, fmt.Errorf("rate_limit.paths[%d]: %w", i, err)
+		}
+		l.rules = append(l.rules, rule)
+	}
+	return l, nil
+}
+
+// RateLimitMiddleware answers requests beyond cfg's limits with 429 and a
+// Retry-After header instead of passing them to next. It belongs inside
+// token auth, so only valid tokens get buckets of their own.
+func RateLimitMiddleware(cfg RateLimitConfig, next http.Handler) (http.Handler, error) {
+	l, err := newRateLimiter(cfg, time.Now)
+	if err != nil {
+		return nil, err
+	}
+	return l.middleware(next), nil
+}
+
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, retryAfter := l.allow(rateLimitClient(r), r.URL.Path)
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			jsonError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitClient identifies who a request counts against.
+func rateLimitClient(r *http.Request) string {
+	if id := tokenID(r); id != "" {
+		return "token:" + id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// allow takes a token from the client's bucket for path, or reports how long
+// until one is available.
+func (l *rateLimiter) allow(client, path string) (bool, time.Duration) {
+	key := bucketKey{client: client, rule: -1}
+	limit := l.def
+	for i, p := range l.paths {
+		if pathHasPrefix(path, p.Path) {
+			key.rule = i
+			limit = l.rules[i]
+			break
+		}
+	}
+
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(limit.burst, b.tokens+now.Sub(b.last).Seconds()*limit.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / limit.rate * float64(time.Second))
+	return false, max(wait, time.Second)
+}
+
+// sweep forgets full buckets, at most once per rateLimitIdle.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitIdle {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		limit := l.def
+		if key.rule >= 0 {
+			limit = l.rules[key.rule]
+		}
+		if b.tokens+now.Sub(b.last).Seconds()*limit.rate >= limit.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// pathHasPrefix reports whether path starts with the segments of prefix, a
+// "*" segment matching any one.
+func pathHasPrefix(path, prefix string) bool {
+	want := strings.Split(strings.Trim(prefix, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(got) < len(want) {
+		return false
+	}
+	for i, seg := range want {
+		if seg != "*" && seg != got[i] {
+			return false
+		}
+	}
+	return true
+}
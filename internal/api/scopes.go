@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// Scopes limit what an API token may do. Each route group needs one scope to
+// read (GET and HEAD) and another to change things; scopes are independent,
+// so a token that both reads and submits jobs needs jobs:read and jobs:write.
+const (
+	ScopeAll          = "*"
+	ScopeJobsRead     = "jobs:read"
+	ScopeJobsWrite    = "jobs:write"
+	ScopeWorkersRead  = "workers:read"
+	ScopeClusterRead  = "cluster:read"
+	ScopeSecretsRead  = "secrets:read"
+	ScopeSecretsWrite = "secrets:write"
+	// ScopeSecretsAdmin covers node approval, key rotation and the audit log.
+	ScopeSecretsAdmin = "secrets:admin"
+)
+
+// Scopes lists every scope a token can be granted.
+var Scopes = []string{
+	ScopeAll,
+	ScopeJobsRead, ScopeJobsWrite,
+	ScopeWorkersRead,
+	ScopeClusterRead,
+	ScopeSecretsRead, ScopeSecretsWrite, ScopeSecretsAdmin,
+}
+
+// ScopedToken is an API token limited to some scopes.
+type ScopedToken struct {
+	Token  string   `mapstructure:"token"`
+	Scopes []string `mapstructure:"scopes"`
+}
+
+type tokenScopesKey struct{}
+
+// tokenScopes maps each configured token to its scopes. Tokens in
+// AuthTokens have every scope.
+func (c *Config) tokenScopes() (map[string][]string, error) {
+	grants := make(map[string][]string, len(c.AuthTokens)+len(c.ScopedTokens))
+	for _, t := range c.AuthTokens {
+		grants[t] = []string{ScopeAll}
+	}
+	for i, st := range c.ScopedTokens {
+		if st.Token == "" {
+			return nil, fmt.Errorf("scoped_tokens[%d]: missing token", i)
+		}
+		for _, scope := range st.Scopes {
+			if !slices.Contains(Scopes, scope) {
+				return nil, fmt.Errorf("scoped_tokens[%d]: unknown scope %q", i, scope)
+			}
+		}
+		if _, ok := grants[st.Token]; ok {
+			return nil, fmt.Errorf("scoped_tokens[%d]: token is configured more than once", i)
+		}
+		grants[st.Token] = st.Scopes
+	}
+	return grants, nil
+}
+
+// RequireScopes passes GET and HEAD requests on to next if the request's
+// token has read, and other requests if it has write, answering 403
+// otherwise. Tokens are checked by ScopedTokenAuthMiddleware, which must
+// wrap it.
+func RequireScopes(read, write string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		need := write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			need = read
+		}
+		scopes, _ := r.Context().Value(tokenScopesKey{}).([]string)
+		if !slices.Contains(scopes, ScopeAll) && !slices.Contains(scopes, need) {
+			jsonError(w, http.StatusForbidden, "token lacks the "+need+" scope")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func withTokenScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, tokenScopesKey{}, scopes)
+}
@@ -1,17 +1,25 @@
 package api
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/secrets"
 )
 
 // RegisterSecretHandlers wires secret & admin node endpoints into the given mux.
-func RegisterSecretHandlers(mux *http.ServeMux, cl cluster.Cluster) {
+// Failures to record an audit entry are logged to logger.
+func RegisterSecretHandlers(mux *http.ServeMux, cl cluster.Cluster, logger *log.Logger) {
 	// List pending nodes (admin)
 	mux.HandleFunc("/api/secrets/nodes/pending", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
@@ -26,7 +34,41 @@ func RegisterSecretHandlers(mux *http.ServeMux, cl cluster.Cluster) {
 			jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
 			return
 		}
-		handleApproveNode(w, r, cl)
+		handleApproveNode(w, r, cl, logger)
+	})
+	// Deny a pending node (admin)
+	mux.HandleFunc("/api/secrets/nodes/deny", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		handleDenyNode(w, r, cl, logger)
+	})
+	// Revoke an approved node (admin)
+	mux.HandleFunc("/api/secrets/nodes/revoke", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		handleRevokeNode(w, r, cl, logger)
+	})
+
+	// Rotate the cluster key (admin)
+	mux.HandleFunc("/api/secrets/rotate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		handleRotateClusterKey(w, r, cl, logger)
+	})
+
+	// /api/secrets/audit lists the audit log (admin)
+	mux.HandleFunc("/api/secrets/audit", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		handleListSecretAudit(w, r, cl)
 	})
 
 	// /api/secrets/store (list keys)
@@ -38,6 +80,34 @@ func RegisterSecretHandlers(mux *http.ServeMux, cl cluster.Cluster) {
 		handleListSecretKeys(w, r, cl)
 	})
 
+	// /api/secrets/history/{key} lists a secret's versions
+	mux.HandleFunc("/api/secrets/history/", func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/api/secrets/history/")
+		if key == "" {
+			jsonError(w, http.StatusBadRequest, "missing secret key")
+			return
+		}
+		if r.Method != "GET" {
+			jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		handleListSecretVersions(w, r, cl, key)
+	})
+
+	// /api/secrets/rollback/{key} makes an earlier version current
+	mux.HandleFunc("/api/secrets/rollback/", func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/api/secrets/rollback/")
+		if key == "" {
+			jsonError(w, http.StatusBadRequest, "missing secret key")
+			return
+		}
+		if r.Method != "POST" {
+			jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		handleRollbackSecret(w, r, cl, key, logger)
+	})
+
 	// /api/secrets/store/{key} for GET, PUT, DELETE
 	mux.HandleFunc("/api/secrets/store/", func(w http.ResponseWriter, r *http.Request) {
 		key := strings.TrimPrefix(r.URL.Path, "/api/secrets/store/")
@@ -47,11 +117,11 @@ func RegisterSecretHandlers(mux *http.ServeMux, cl cluster.Cluster) {
 		}
 		switch r.Method {
 		case "GET":
-			handleGetSecret(w, r, cl, key)
+			handleGetSecret(w, r, cl, key, logger)
 		case "PUT":
-			handlePutSecret(w, r, cl, key)
+			handlePutSecret(w, r, cl, key, logger)
 		case "DELETE":
-			handleDeleteSecret(w, r, cl, key)
+			handleDeleteSecret(w, r, cl, key, logger)
 		default:
 			jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
 		}
@@ -76,7 +146,7 @@ func handleListPendingNodes(w http.ResponseWriter, r *http.Request, cl cluster.C
 	_ = json.NewEncoder(w).Encode(result)
 }
 
-func handleApproveNode(w http.ResponseWriter, r *http.Request, cl cluster.Cluster) {
+func handleApproveNode(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, logger *log.Logger) {
 	var req struct {
 		NodeID string `json:"node_id"`
 	}
@@ -85,7 +155,9 @@ func handleApproveNode(w http.ResponseWriter, r *http.Request, cl cluster.Cluste
 		return
 	}
 
-	if err := cl.Secrets().ApproveNode(r.Context(), req.NodeID); err != nil {
+	err := cl.Secrets().ApproveNode(r.Context(), req.NodeID)
+	auditSecretOp(r, cl, logger, secrets.AuditEntry{Operation: secrets.AuditApprove, Key: req.NodeID}, err)
+	if err != nil {
 		jsonError(w, http.StatusBadRequest, "could not approve node: "+err.Error())
 		return
 	}
@@ -93,6 +165,70 @@ func handleApproveNode(w http.ResponseWriter, r *http.Request, cl cluster.Cluste
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func handleDenyNode(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, logger *log.Logger) {
+	var req struct {
+		NodeID string `json:"node_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+
+	err := cl.Secrets().DenyNode(r.Context(), req.NodeID)
+	auditSecretOp(r, cl, logger, secrets.AuditEntry{Operation: secrets.AuditDeny, Key: req.NodeID}, err)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "could not deny node: "+err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleRevokeNode(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, logger *log.Logger) {
+	var req struct {
+		NodeID string `json:"node_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+
+	err := cl.Secrets().RevokeNode(r.Context(), req.NodeID)
+	auditSecretOp(r, cl, logger, secrets.AuditEntry{Operation: secrets.AuditRevoke, Key: req.NodeID}, err)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "could not revoke node: "+err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleRotateClusterKey(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, logger *log.Logger) {
+	var req struct {
+		ClusterKey string `json:"cluster_key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	raw, err := base64.StdEncoding.DecodeString(req.ClusterKey)
+	if err != nil || len(raw) != 32 {
+		jsonError(w, http.StatusBadRequest, "cluster_key must be base64 of 32 bytes")
+		return
+	}
+	var newKey [32]byte
+	copy(newKey[:], raw)
+
+	result, err := cl.Secrets().RotateClusterKey(r.Context(), newKey)
+	auditSecretOp(r, cl, logger, secrets.AuditEntry{Operation: secrets.AuditRotate}, err)
+	if err != nil {
+		jsonError(w, http.StatusConflict, "could not rotate cluster key: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
 func handleListSecretKeys(w http.ResponseWriter, r *http.Request, cl cluster.Cluster) {
 	prefix := r.URL.Query().Get("prefix")
 	keys, err := cl.Secrets().List(r.Context(), prefix)
@@ -104,10 +240,31 @@ func handleListSecretKeys(w http.ResponseWriter, r *http.Request, cl cluster.Clu
 	_ = json.NewEncoder(w).Encode(keys)
 }
 
-func handleGetSecret(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, key string) {
+func handleGetSecret(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, key string, logger *log.Logger) {
+	if v := r.URL.Query().Get("version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid version")
+			return
+		}
+		value, err := cl.Secrets().GetSealedVersion(r.Context(), key, version)
+		auditSecretOp(r, cl, logger, secrets.AuditEntry{Operation: secrets.AuditGet, Key: key, Version: version}, err)
+		if err != nil {
+			jsonError(w, http.StatusNotFound, "not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"value": value})
+		return
+	}
+
 	etcdKey := cl.Secrets().Prefix() + "/secrets/store/" + key
 	resp, err := cl.Client().Get(r.Context(), etcdKey)
-	if err != nil || len(resp.Kvs) == 0 {
+	if err == nil && len(resp.Kvs) == 0 {
+		err = errors.New("not found")
+	}
+	auditSecretOp(r, cl, logger, secrets.AuditEntry{Operation: secrets.AuditGet, Key: key}, err)
+	if err != nil {
 		jsonError(w, http.StatusNotFound, "not found")
 		return
 	}
@@ -116,7 +273,7 @@ func handleGetSecret(w http.ResponseWriter, r *http.Request, cl cluster.Cluster,
 	_ = json.NewEncoder(w).Encode(map[string]string{"value": string(resp.Kvs[0].Value)})
 }
 
-func handlePutSecret(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, key string) {
+func handlePutSecret(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, key string, logger *log.Logger) {
 	var value []byte
 	ct := r.Header.Get("Content-Type")
 	if strings.HasPrefix(ct, "application/json") {
@@ -143,17 +300,106 @@ func handlePutSecret(w http.ResponseWriter, r *http.Request, cl cluster.Cluster,
 			return
 		}
 	}
-	if err := cl.Secrets().SetSealed(r.Context(), key, value); err != nil {
+	err := cl.Secrets().SetSealed(r.Context(), key, value)
+	auditSecretOp(r, cl, logger, secrets.AuditEntry{Operation: secrets.AuditSet, Key: key}, err)
+	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "set failed: "+err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func handleDeleteSecret(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, key string) {
-	if err := cl.Secrets().Delete(r.Context(), key); err != nil {
+func handleListSecretVersions(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, key string) {
+	versions, err := cl.Secrets().ListVersions(r.Context(), key)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "error listing versions: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(versions)
+}
+
+func handleRollbackSecret(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, key string, logger *log.Logger) {
+	var req struct {
+		Version int `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	err := cl.Secrets().Rollback(r.Context(), key, req.Version)
+	auditSecretOp(r, cl, logger, secrets.AuditEntry{Operation: secrets.AuditRollback, Key: key, Version: req.Version}, err)
+	if err != nil {
+		jsonError(w, http.StatusConflict, "rollback failed: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleDeleteSecret(w http.ResponseWriter, r *http.Request, cl cluster.Cluster, key string, logger *log.Logger) {
+	err := cl.Secrets().Delete(r.Context(), key)
+	auditSecretOp(r, cl, logger, secrets.AuditEntry{Operation: secrets.AuditDelete, Key: key}, err)
+	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "delete failed: "+err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// defaultAuditLimit and maxAuditLimit bound how many audit entries one
+// request returns, oldest first; pass the last one's time as ?since= to read on.
+const (
+	defaultAuditLimit = 1000
+	maxAuditLimit     = 10000
+)
+
+func handleListSecretAudit(w http.ResponseWriter, r *http.Request, cl cluster.Cluster) {
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid since: "+err.Error())
+			return
+		}
+		since = t
+	}
+	limit := defaultAuditLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > maxAuditLimit {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: must be 1 to %d", maxAuditLimit))
+			return
+		}
+		limit = n
+	}
+	entries, err := cl.Secrets().ListAudit(r.Context(), r.URL.Query().Get("key"), since, limit)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "error listing audit log: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+// secretAuditTimeout bounds how long recording an audit entry may take.
+const secretAuditTimeout = 5 * time.Second
+
+// auditSecretOp records entry, and the outcome err, in the secret store's
+// audit log. It's recorded in the background so a slow or failing write
+// can't hold up or fail the operation itself; failures are only logged, to
+// logger.
+func auditSecretOp(r *http.Request, cl cluster.Cluster, logger *log.Logger, entry secrets.AuditEntry, err error) {
+	entry.Time = time.Now().UTC()
+	entry.TokenID = tokenID(r)
+	entry.Remote = r.RemoteAddr
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), secretAuditTimeout)
+	go func() {
+		defer cancel()
+		if err := cl.Secrets().RecordAudit(ctx, entry); err != nil {
+			logger.Printf("secrets audit: could not record %s of %q: %v", entry.Operation, entry.Key, err)
+		}
+	}()
+}
@@ -14,13 +14,25 @@ type Server struct {
 	Cluster cluster.Cluster
 	Addr    string
 	Logger  *log.Logger
-	Config  *Config
-	server  *http.Server
+	// AccessLogger receives the access log, if it's enabled. Nil means
+	// Logger's output, without its prefix and flags, so each line is JSON.
+	AccessLogger *log.Logger
+	Config       *Config
+	server       *http.Server
 }
 
 type Config struct {
 	ListenAddr string   `mapstructure:"listen_addr"`
 	AuthTokens []string `mapstructure:"auth_tokens"`
+	// ScopedTokens are tokens limited to some scopes (see Scopes), unlike
+	// AuthTokens, which may do anything.
+	ScopedTokens []ScopedToken    `mapstructure:"scoped_tokens"`
+	OutputReads  OutputReadConfig `mapstructure:"output_reads"`
+	AccessLog    AccessLogConfig  `mapstructure:"access_log"`
+	RateLimit    RateLimitConfig  `mapstructure:"rate_limit"`
+	// RequestTimeout bounds how long an API request may run before it's
+	// answered with a 504. Zero means DefaultRequestTimeout.
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
 }
 
 func NewServer(cluster cluster.Cluster, config Config, logger *log.Logger) *Server {
@@ -32,7 +44,13 @@ func NewServer(cluster cluster.Cluster, config Config, logger *log.Logger) *Serv
 	}
 }
 
-func (s *Server) Start(ctx context.Context) error {
+// Handler returns the API's routes, each group behind the scopes it needs.
+func (s *Server) Handler() (http.Handler, error) {
+	grants, err := s.Config.tokenScopes()
+	if err != nil {
+		return nil, err
+	}
+
 	mux := http.NewServeMux()
 	// Health endpoint
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -41,15 +59,67 @@ func (s *Server) Start(ctx context.Context) error {
 	})
 
 	protected := http.NewServeMux()
-	RegisterJobHandlers(protected, s.Cluster)
-	RegisterWorkerHandlers(protected, s.Cluster)
-	RegisterSecretHandlers(protected, s.Cluster)
-	RegisterStatusHandler(protected, s.Cluster)
-	mux.Handle("/api/", TokenAuthMiddleware(s.Config.AuthTokens, protected))
+	jobs := http.NewServeMux()
+	RegisterJobHandlers(jobs, s.Cluster)
+	RegisterShardOutputHandler(jobs, s.Cluster, s.Config.OutputReads)
+	workers := http.NewServeMux()
+	RegisterWorkerHandlers(workers, s.Cluster)
+	status := http.NewServeMux()
+	RegisterStatusHandler(status, s.Cluster)
+	secretStore := http.NewServeMux()
+	RegisterSecretHandlers(secretStore, s.Cluster, s.Logger)
+
+	for pattern, h := range map[string]http.Handler{
+		"/api/jobs":              RequireScopes(ScopeJobsRead, ScopeJobsWrite, jobs),
+		"/api/jobs/":             RequireScopes(ScopeJobsRead, ScopeJobsWrite, jobs),
+		"/api/workers":           RequireScopes(ScopeWorkersRead, ScopeWorkersRead, workers),
+		"/api/workers/":          RequireScopes(ScopeWorkersRead, ScopeWorkersRead, workers),
+		"/api/status":            RequireScopes(ScopeClusterRead, ScopeClusterRead, status),
+		"/api/cluster/":          RequireScopes(ScopeClusterRead, ScopeClusterRead, status),
+		"/api/secrets/store":     RequireScopes(ScopeSecretsRead, ScopeSecretsWrite, secretStore),
+		"/api/secrets/store/":    RequireScopes(ScopeSecretsRead, ScopeSecretsWrite, secretStore),
+		"/api/secrets/history/":  RequireScopes(ScopeSecretsRead, ScopeSecretsWrite, secretStore),
+		"/api/secrets/rollback/": RequireScopes(ScopeSecretsWrite, ScopeSecretsWrite, secretStore),
+		// Node approval, key rotation and the audit log
+		"/api/secrets/": RequireScopes(ScopeSecretsAdmin, ScopeSecretsAdmin, secretStore),
+	} {
+		protected.Handle(pattern, h)
+	}
+
+	timeout := s.Config.RequestTimeout
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+	var apiHandler http.Handler = TimeoutMiddleware(timeout, protected)
+	if s.Config.RateLimit.Enabled {
+		if apiHandler, err = RateLimitMiddleware(s.Config.RateLimit, apiHandler); err != nil {
+			return nil, err
+		}
+	}
+	mux.Handle("/api/", ScopedTokenAuthMiddleware(grants, apiHandler))
 
+	if !s.Config.AccessLog.Enabled {
+		return mux, nil
+	}
+	logger := s.AccessLogger
+	if logger == nil {
+		logger = log.New(s.Logger.Writer(), "", 0)
+	}
+	skip := s.Config.AccessLog.SkipPaths
+	if skip == nil {
+		skip = DefaultAccessLogSkipPaths
+	}
+	return AccessLogMiddleware(logger, skip, mux), nil
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	handler, err := s.Handler()
+	if err != nil {
+		return err
+	}
 	s.server = &http.Server{
 		Addr:    s.Addr,
-		Handler: mux,
+		Handler: handler,
 	}
 	go func() {
 		<-ctx.Done()
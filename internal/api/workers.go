@@ -18,6 +18,10 @@ type WorkerStatus struct {
 	ShardsFailed     int64     `json:"shards_failed"`
 	ProcessingTimeNs int64     `json:"processing_time_ns"`
 	LastUpdated      time.Time `json:"last_updated"`
+	LogEndpoint      string    `json:"log_endpoint,omitempty"`
+
+	// Activity is the shard progress reported in the worker's last heartbeat.
+	Activity []cluster.ShardActivity `json:"activity,omitempty"`
 }
 
 func RegisterWorkerHandlers(mux *http.ServeMux, cl cluster.Cluster) {
@@ -36,9 +40,11 @@ func RegisterWorkerHandlers(mux *http.ServeMux, cl cluster.Cluster) {
 		statuses := make([]*WorkerStatus, 0, len(workers))
 		for _, wi := range workers {
 			ws := &WorkerStatus{
-				ID:       wi.ID,
-				Host:     wi.Host,
-				LastSeen: wi.LastSeen,
+				ID:          wi.ID,
+				Host:        wi.Host,
+				LastSeen:    wi.LastSeen,
+				LogEndpoint: wi.LogEndpoint,
+				Activity:    wi.Activity,
 			}
 			// Try to get metrics, but tolerate absence
 			if vm, err := cl.GetWorkerMetrics(r.Context(), wi.ID); err == nil && vm != nil {
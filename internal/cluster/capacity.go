@@ -0,0 +1,106 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ErrWorkerAtCapacity is returned by AssignShard when the worker already holds
+// as many shards as the Capacity it registered with.
+var ErrWorkerAtCapacity = errors.New("worker at capacity")
+
+// errCapacityConflict is returned by assignShard when another claim by the
+// same worker landed between counting its claims and recording this one.
+var errCapacityConflict = errors.New("worker claims changed")
+
+// capacityClaimAttempts bounds how often AssignShard recounts a worker's
+// claims after losing to one of its own concurrent claims.
+const capacityClaimAttempts = 16
+
+// workerClaimsPrefix holds a key per shard assigned to workerID, whose value
+// is the shard's key. Claims are only recorded for workers registered with a
+// Capacity, and are bound to the worker's lease.
+func (c *etcdCluster) workerClaimsPrefix(workerID string) string {
+	return path.Join(c.Prefix(), "workers", workerID, "claims") + "/"
+}
+
+// reserveWorkerCapacity checks that workerID has room for shardID. It returns
+// the comparisons and operations the assignment transaction must include to
+// record the claim without racing another assignment to the same worker. A
+// worker that isn't registered, or registered without a Capacity, is
+// unlimited, and nil is returned for both.
+//
+// Claims are validated against the shards' assignments as they're counted:
+// one whose shard finished, failed, was released, or was taken over by
+// another worker after its lease expired no longer counts and is removed.
+func (c *etcdCluster) reserveWorkerCapacity(ctx context.Context, workerID, jobID string, shardID int) ([]clientv3.Cmp, []clientv3.Op, error) {
+	workerKey := path.Join(c.Prefix(), "workers", workerID)
+	claimsPrefix := c.workerClaimsPrefix(workerID)
+	resp, err := c.client.Txn(ctx).Then(
+		clientv3.OpGet(workerKey),
+		clientv3.OpGet(claimsPrefix, clientv3.WithPrefix()),
+	).Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+	workerKvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(workerKvs) == 0 {
+		return nil, nil, nil
+	}
+	var info WorkerInfo
+	if err := decodeWorkerInfo(workerKvs[0].Value, &info); err != nil || info.Capacity <= 0 {
+		return nil, nil, nil
+	}
+
+	target := c.ShardKey(jobID, shardID)
+	claims := resp.Responses[1].GetResponseRange().Kvs
+	var gets []clientv3.Op
+	for _, kv := range claims {
+		gets = append(gets, clientv3.OpGet(string(kv.Value)+"/assignment"))
+	}
+	held, now := 0, time.Now()
+	var stale []clientv3.Op
+	if len(gets) > 0 {
+		shards, err := c.client.Txn(ctx).Then(gets...).Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, kv := range claims {
+			var assign ShardAssignment
+			kvs := shards.Responses[i].GetResponseRange().Kvs
+			live := len(kvs) > 0 && json.Unmarshal(kvs[0].Value, &assign) == nil &&
+				assign.WorkerID == workerID && assign.LeaseExpiry.After(now)
+			switch {
+			case string(kv.Value) == target:
+				// Reclaiming a shard the worker already holds the claim for
+			case live:
+				held++
+			default:
+				stale = append(stale, clientv3.OpDelete(string(kv.Key)))
+			}
+		}
+	}
+	if held >= info.Capacity {
+		return nil, nil, fmt.Errorf("%w: %s holds %d of %d shards", ErrWorkerAtCapacity, workerID, held, info.Capacity)
+	}
+	if len(stale) > 0 {
+		if _, err := c.client.Txn(ctx).Then(stale...).Commit(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// No claim may have been added since the claims were counted
+	cmps := []clientv3.Cmp{
+		clientv3.Compare(clientv3.ModRevision(claimsPrefix), "<", resp.Header.Revision+1).WithPrefix(),
+	}
+	ops := []clientv3.Op{
+		clientv3.OpPut(claimsPrefix+fmt.Sprintf("%s/%06d", jobID, shardID), target, clientv3.WithLease(clientv3.LeaseID(workerKvs[0].Lease))),
+	}
+	return cmps, ops, nil
+}
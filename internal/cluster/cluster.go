@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"context"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/job"
 	"github.com/chtzvt/certslurp/internal/secrets"
@@ -12,18 +13,26 @@ type Cluster interface {
 	// Job coordination
 	SubmitJob(ctx context.Context, spec *job.JobSpec) (jobID string, err error)
 	ListJobs(ctx context.Context) ([]JobInfo, error)
+	ListJobsFiltered(ctx context.Context, opts JobListOptions) (*JobPage, error)
 	GetJob(ctx context.Context, jobID string) (*JobInfo, error)
 	GetClusterStatus(ctx context.Context) (*ClusterStatus, error)
+	DumpClusterState(ctx context.Context) (*ClusterDump, error)
 	UpdateJobStatus(ctx context.Context, jobID string, status JobState) error
 	MarkJobStarted(ctx context.Context, jobID string) error
 	MarkJobCompleted(ctx context.Context, jobID string) error
+	GetJobManifest(ctx context.Context, jobID string) (*JobManifest, error)
 	CancelJob(ctx context.Context, jobID string) error
+	PauseJob(ctx context.Context, jobID string) error
+	ResumeJob(ctx context.Context, jobID string) error
 	IsJobCancelled(ctx context.Context, jobID string) (bool, error)
+	PurgeJob(ctx context.Context, jobID string) error
+	WatchJob(ctx context.Context, jobID string) (<-chan JobEvent, error)
 
 	// Worker management
 	RegisterWorker(ctx context.Context, info WorkerInfo) (workerID string, err error)
 	ListWorkers(ctx context.Context) ([]WorkerInfo, error)
-	HeartbeatWorker(ctx context.Context, workerID string) error
+	HeartbeatWorker(ctx context.Context, workerID string, activity ...ShardActivity) error
+	UnregisterWorker(ctx context.Context, workerID string) error
 	SendMetrics(ctx context.Context, workerID string, metrics *WorkerMetrics) error
 	GetWorkerMetrics(ctx context.Context, workerID string) (*WorkerMetricsView, error)
 
@@ -33,13 +42,18 @@ type Cluster interface {
 	AssignShard(ctx context.Context, jobID string, shardID int, workerID string) error
 	GetShardAssignments(ctx context.Context, jobID string) (map[int]ShardAssignmentStatus, error)
 	GetShardAssignmentsWindow(ctx context.Context, jobID string, start, end int) (map[int]ShardAssignmentStatus, error)
+	GetJobProgress(ctx context.Context, jobID string) (*JobProgress, error)
 	GetShardStatus(ctx context.Context, jobID string, shardID int) (ShardStatus, error)
 	RenewShardLease(ctx context.Context, jobID string, shardID int, workerID string) error
 	ReleaseShardLease(ctx context.Context, jobID string, shardID int, workerID string) error
+	UpdateShardProgress(ctx context.Context, jobID string, shardID int, workerID string, cp ShardCheckpoint) error
 	ReportShardDone(ctx context.Context, jobID string, shardID int, manifest ShardManifest) error
 	ReportShardFailed(ctx context.Context, jobID string, shardID int) error
 	ResetFailedShards(ctx context.Context, jobID string) ([]int, error)
 	ResetFailedShard(ctx context.Context, jobID string, shardID int) error
+	SkipShard(ctx context.Context, jobID string, shardID int, reason string) error
+	SetShardPreferredWorker(ctx context.Context, jobID string, shardID int, workerID string, grace time.Duration) error
+	ListPreferredShards(ctx context.Context, workerID string) (map[string][]int, error)
 	RequestShardSplit(ctx context.Context, jobID string, shardID int, newRanges []ShardRange) error
 	FindOrphanedShards(ctx context.Context, jobID string) ([]int, error)
 	ReassignOrphanedShards(ctx context.Context, jobID string, assignTo string) ([]int, error)
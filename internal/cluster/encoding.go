@@ -0,0 +1,74 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Every worker rewrites its record and metrics in etcd on each heartbeat, so
+// at scale those writes add up. By default they're stored as JSON and
+// decimal strings, which etcdctl shows readably; MetricsEncodingCBOR stores
+// them as compact CBOR instead. Readers accept either encoding, so workers
+// and the head can be switched over independently.
+const (
+	MetricsEncodingJSON = "json"
+	MetricsEncodingCBOR = "cbor"
+)
+
+// ValidateMetricsEncoding checks enc names a supported encoding. Empty means
+// MetricsEncodingJSON.
+func ValidateMetricsEncoding(enc string) error {
+	switch enc {
+	case "", MetricsEncodingJSON, MetricsEncodingCBOR:
+		return nil
+	}
+	return fmt.Errorf("unknown metrics encoding %q (want %q or %q)", enc, MetricsEncodingJSON, MetricsEncodingCBOR)
+}
+
+// Times in worker records keep microsecond precision, which is plenty for
+// heartbeats and shard start times.
+var cborRecordMode, _ = cbor.EncOptions{Time: cbor.TimeUnixMicro}.EncMode()
+
+// compactMetrics is the CBOR form of a worker's metrics, stored under a
+// single metrics key in place of one key per counter.
+type compactMetrics struct {
+	ShardsProcessed  int64 `cbor:"1,keyasint"`
+	ShardsFailed     int64 `cbor:"2,keyasint"`
+	ProcessingTimeNs int64 `cbor:"3,keyasint"`
+	ActiveUploads    int64 `cbor:"4,keyasint"`
+	LastUpdated      int64 `cbor:"5,keyasint"` // unix nanoseconds
+}
+
+func (c *etcdCluster) compactRecords() bool {
+	return c.cfg.MetricsEncoding == MetricsEncodingCBOR
+}
+
+func (c *etcdCluster) encodeWorkerInfo(info WorkerInfo) ([]byte, error) {
+	if c.compactRecords() {
+		return cborRecordMode.Marshal(info)
+	}
+	return json.Marshal(info)
+}
+
+// decodeWorkerInfo decodes a worker record in either encoding. A JSON object
+// always starts with '{', which can't begin a CBOR map.
+func decodeWorkerInfo(b []byte, info *WorkerInfo) error {
+	if len(b) > 0 && b[0] == '{' {
+		return json.Unmarshal(b, info)
+	}
+	return cbor.Unmarshal(b, info)
+}
+
+func (m compactMetrics) view(workerID string) *WorkerMetricsView {
+	return &WorkerMetricsView{
+		WorkerID:         workerID,
+		ShardsProcessed:  m.ShardsProcessed,
+		ShardsFailed:     m.ShardsFailed,
+		ProcessingTimeNs: m.ProcessingTimeNs,
+		ActiveUploads:    m.ActiveUploads,
+		LastUpdated:      time.Unix(0, m.LastUpdated).UTC(),
+	}
+}
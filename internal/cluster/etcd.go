@@ -14,6 +14,10 @@ type EtcdConfig struct {
 	DialTimeout  time.Duration
 	Prefix       string // default: "/certslurp"
 	KeychainFile string
+
+	// MetricsEncoding is how worker records and metrics are stored: "json"
+	// (default) or "cbor". See MetricsEncodingCBOR.
+	MetricsEncoding string
 }
 
 type etcdCluster struct {
@@ -23,6 +27,9 @@ type etcdCluster struct {
 }
 
 func NewEtcdCluster(cfg EtcdConfig) (Cluster, error) {
+	if err := ValidateMetricsEncoding(cfg.MetricsEncoding); err != nil {
+		return nil, err
+	}
 	cli, err := clientv3.New(clientv3.Config{
 		Endpoints:   cfg.Endpoints,
 		Username:    cfg.Username,
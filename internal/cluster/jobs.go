@@ -21,6 +21,7 @@ type JobInfo struct {
 	Completed time.Time    `json:"completed,omitempty"`
 	Status    JobState     `json:"status"`
 	Cancelled time.Time    `json:"cancelled,omitempty"`
+	Summary   *JobSummary  `json:"summary,omitempty"` // set once the job completes
 }
 
 type JobState string
@@ -31,6 +32,10 @@ const (
 	JobStateCompleted JobState = "completed"
 	JobStateCancelled JobState = "cancelled"
 	JobStateFailed    JobState = "failed"
+
+	// A paused job keeps its shards, but workers don't claim any more of
+	// them until it's resumed. Shards already being processed finish.
+	JobStatePaused JobState = "paused"
 )
 
 func (c *etcdCluster) SubmitJob(ctx context.Context, spec *job.JobSpec) (string, error) {
@@ -65,31 +70,7 @@ func (c *etcdCluster) ListJobs(ctx context.Context) ([]JobInfo, error) {
 		if jobMap[jobID] == nil {
 			jobMap[jobID] = &JobInfo{ID: jobID}
 		}
-		switch {
-		case strings.HasSuffix(string(kv.Key), "/spec"):
-			var spec job.JobSpec
-			if err := json.Unmarshal(kv.Value, &spec); err == nil {
-				jobMap[jobID].Spec = &spec
-			}
-		case strings.HasSuffix(string(kv.Key), "/submitted"):
-			if ts, err := time.Parse(time.RFC3339Nano, string(kv.Value)); err == nil {
-				jobMap[jobID].Submitted = ts
-			}
-		case strings.HasSuffix(string(kv.Key), "/started"):
-			if ts, err := time.Parse(time.RFC3339Nano, string(kv.Value)); err == nil {
-				jobMap[jobID].Started = ts
-			}
-		case strings.HasSuffix(string(kv.Key), "/completed"):
-			if ts, err := time.Parse(time.RFC3339Nano, string(kv.Value)); err == nil {
-				jobMap[jobID].Completed = ts
-			}
-		case strings.HasSuffix(string(kv.Key), "/cancelled"):
-			if ts, err := time.Parse(time.RFC3339Nano, string(kv.Value)); err == nil {
-				jobMap[jobID].Cancelled = ts
-			}
-		case strings.HasSuffix(string(kv.Key), "/status"):
-			jobMap[jobID].Status = JobState(kv.Value)
-		}
+		jobMap[jobID].setField(string(kv.Key), kv.Value)
 	}
 	jobs := make([]JobInfo, 0, len(jobMap))
 	for _, info := range jobMap {
@@ -98,6 +79,74 @@ func (c *etcdCluster) ListJobs(ctx context.Context) ([]JobInfo, error) {
 	return jobs, nil
 }
 
+// JobListOptions narrows and pages ListJobsFiltered. Jobs are returned in
+// order of ID, starting after Cursor, the last ID of the previous page.
+type JobListOptions struct {
+	Limit  int      // 0 = no limit
+	Cursor string   // "" = from the first job
+	Status JobState // "" = any status
+}
+
+// JobPage is one page of ListJobsFiltered. NextCursor is set when there may
+// be more jobs after it.
+type JobPage struct {
+	Jobs       []JobInfo `json:"jobs"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// jobFieldKeys are the keys holding a job's JobInfo, under the job's prefix.
+var jobFieldKeys = []string{"spec", "submitted", "started", "completed", "cancelled", "status", "summary"}
+
+// ListJobsFiltered lists jobs a page at a time. Unlike ListJobs, it reads each
+// job's own keys rather than everything under the jobs prefix, so shard keys
+// aren't loaded.
+func (c *etcdCluster) ListJobsFiltered(ctx context.Context, opts JobListOptions) (*JobPage, error) {
+	jobsPrefix := fmt.Sprintf("%s/jobs/", c.Prefix())
+	rangeEnd := clientv3.GetPrefixRangeEnd(jobsPrefix)
+	next := jobsPrefix
+	if opts.Cursor != "" {
+		next = clientv3.GetPrefixRangeEnd(jobsPrefix + opts.Cursor + "/")
+	}
+
+	page := &JobPage{Jobs: []JobInfo{}}
+	for {
+		// Find the next job, then skip past the rest of its keys
+		resp, err := c.client.Get(ctx, next, clientv3.WithRange(rangeEnd), clientv3.WithKeysOnly(), clientv3.WithLimit(1))
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Kvs) == 0 {
+			return page, nil
+		}
+		jobID, _, _ := strings.Cut(strings.TrimPrefix(string(resp.Kvs[0].Key), jobsPrefix), "/")
+		next = clientv3.GetPrefixRangeEnd(jobsPrefix + jobID + "/")
+
+		if opts.Limit > 0 && len(page.Jobs) == opts.Limit {
+			page.NextCursor = page.Jobs[len(page.Jobs)-1].ID
+			return page, nil
+		}
+
+		ops := make([]clientv3.Op, len(jobFieldKeys))
+		for i, field := range jobFieldKeys {
+			ops[i] = clientv3.OpGet(jobsPrefix + jobID + "/" + field)
+		}
+		txn, err := c.client.Txn(ctx).Then(ops...).Commit()
+		if err != nil {
+			return nil, err
+		}
+		info := JobInfo{ID: jobID}
+		for _, r := range txn.Responses {
+			for _, kv := range r.GetResponseRange().Kvs {
+				info.setField(string(kv.Key), kv.Value)
+			}
+		}
+		if opts.Status != "" && info.Status != opts.Status {
+			continue
+		}
+		page.Jobs = append(page.Jobs, info)
+	}
+}
+
 func (c *etcdCluster) GetJob(ctx context.Context, jobID string) (*JobInfo, error) {
 	prefix := fmt.Sprintf("%s/jobs/%s/", c.Prefix(), jobID)
 	resp, err := c.client.Get(ctx, prefix, clientv3.WithPrefix())
@@ -109,36 +158,45 @@ func (c *etcdCluster) GetJob(ctx context.Context, jobID string) (*JobInfo, error
 	}
 	info := &JobInfo{ID: jobID}
 	for _, kv := range resp.Kvs {
-		key := string(kv.Key)
-		switch {
-		case strings.HasSuffix(key, "/spec"):
-			var spec job.JobSpec
-			if err := json.Unmarshal(kv.Value, &spec); err == nil {
-				info.Spec = &spec
-			}
-		case strings.HasSuffix(key, "/submitted"):
-			if ts, err := time.Parse(time.RFC3339Nano, string(kv.Value)); err == nil {
-				info.Submitted = ts
-			}
-		case strings.HasSuffix(key, "/started"):
-			if ts, err := time.Parse(time.RFC3339Nano, string(kv.Value)); err == nil {
-				info.Started = ts
-			}
-		case strings.HasSuffix(key, "/completed"):
-			if ts, err := time.Parse(time.RFC3339Nano, string(kv.Value)); err == nil {
-				info.Completed = ts
-			}
-		case strings.HasSuffix(key, "/cancelled"):
-			if ts, err := time.Parse(time.RFC3339Nano, string(kv.Value)); err == nil {
-				info.Cancelled = ts
-			}
-		case strings.HasSuffix(key, "/status"):
-			info.Status = JobState(kv.Value)
-		}
+		info.setField(string(kv.Key), kv.Value)
 	}
 	return info, nil
 }
 
+// setField fills in the part of info stored under the job key key.
+func (info *JobInfo) setField(key string, value []byte) {
+	switch {
+	case strings.HasSuffix(key, "/spec"):
+		var spec job.JobSpec
+		if err := json.Unmarshal(value, &spec); err == nil {
+			info.Spec = &spec
+		}
+	case strings.HasSuffix(key, "/submitted"):
+		if ts, err := time.Parse(time.RFC3339Nano, string(value)); err == nil {
+			info.Submitted = ts
+		}
+	case strings.HasSuffix(key, "/started"):
+		if ts, err := time.Parse(time.RFC3339Nano, string(value)); err == nil {
+			info.Started = ts
+		}
+	case strings.HasSuffix(key, "/completed"):
+		if ts, err := time.Parse(time.RFC3339Nano, string(value)); err == nil {
+			info.Completed = ts
+		}
+	case strings.HasSuffix(key, "/cancelled"):
+		if ts, err := time.Parse(time.RFC3339Nano, string(value)); err == nil {
+			info.Cancelled = ts
+		}
+	case strings.HasSuffix(key, "/status"):
+		info.Status = JobState(value)
+	case strings.HasSuffix(key, "/summary"):
+		var summary JobSummary
+		if err := json.Unmarshal(value, &summary); err == nil {
+			info.Summary = &summary
+		}
+	}
+}
+
 func (c *etcdCluster) UpdateJobStatus(ctx context.Context, jobID string, status JobState) error {
 	key := fmt.Sprintf("%s/jobs/%s/status", c.Prefix(), jobID)
 	_, err := c.client.Put(ctx, key, string(status))
@@ -158,16 +216,23 @@ func (c *etcdCluster) MarkJobStarted(ctx context.Context, jobID string) error {
 	return err
 }
 
+// MarkJobCompleted marks the job completed and stores a JobSummary of its
+// shard manifests alongside it.
 func (c *etcdCluster) MarkJobCompleted(ctx context.Context, jobID string) error {
-	now := time.Now().UTC().Format(time.RFC3339Nano)
+	completed := time.Now().UTC()
+	summary, err := c.summarizeJob(ctx, jobID, completed)
+	if err != nil {
+		return fmt.Errorf("summarize job: %w", err)
+	}
 	statusKey := fmt.Sprintf("%s/jobs/%s/status", c.Prefix(), jobID)
 	completedKey := fmt.Sprintf("%s/jobs/%s/completed", c.Prefix(), jobID)
 
 	txn := c.client.Txn(ctx).Then(
-		clientv3.OpPut(completedKey, now),
+		clientv3.OpPut(completedKey, completed.Format(time.RFC3339Nano)),
 		clientv3.OpPut(statusKey, string(JobStateCompleted)),
+		clientv3.OpPut(c.jobSummaryKey(jobID), mustJSON(summary)),
 	)
-	_, err := txn.Commit()
+	_, err = txn.Commit()
 	return err
 }
 
@@ -188,6 +253,91 @@ func (c *etcdCluster) CancelJob(ctx context.Context, jobID string) error {
 	return err
 }
 
+// PauseJob stops workers claiming jobID's shards until ResumeJob is called.
+// Only pending and running jobs can be paused; pausing a paused job does
+// nothing. The status it replaces is kept under jobs/<id>/paused, for
+// ResumeJob to restore.
+func (c *etcdCluster) PauseJob(ctx context.Context, jobID string) error {
+	statusKey := fmt.Sprintf("%s/jobs/%s/status", c.Prefix(), jobID)
+	resp, err := c.client.Get(ctx, statusKey)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return fmt.Errorf("job %q not found", jobID)
+	}
+	status := JobState(resp.Kvs[0].Value)
+	switch status {
+	case JobStatePaused:
+		return nil
+	case JobStatePending, JobStateRunning:
+	default:
+		return fmt.Errorf("job %s is %s; only pending or running jobs can be paused", jobID, status)
+	}
+
+	// Fail rather than clobber a status that changed since it was read
+	txn, err := c.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(statusKey), "=", resp.Kvs[0].ModRevision)).
+		Then(
+			clientv3.OpPut(statusKey, string(JobStatePaused)),
+			clientv3.OpPut(c.jobPausedKey(jobID), string(status)),
+		).Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return fmt.Errorf("job %s status changed while pausing it; try again", jobID)
+	}
+	return nil
+}
+
+// ResumeJob lets workers claim a paused job's shards again, restoring the
+// status it had before it was paused. Resuming a pending or running job does
+// nothing.
+func (c *etcdCluster) ResumeJob(ctx context.Context, jobID string) error {
+	statusKey := fmt.Sprintf("%s/jobs/%s/status", c.Prefix(), jobID)
+	resp, err := c.client.Get(ctx, statusKey)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return fmt.Errorf("job %q not found", jobID)
+	}
+	switch status := JobState(resp.Kvs[0].Value); status {
+	case JobStatePaused:
+	case JobStatePending, JobStateRunning:
+		return nil
+	default:
+		return fmt.Errorf("job %s is %s, not paused", jobID, status)
+	}
+
+	restore := JobStateRunning
+	prev, err := c.client.Get(ctx, c.jobPausedKey(jobID))
+	if err != nil {
+		return err
+	}
+	if len(prev.Kvs) > 0 && JobState(prev.Kvs[0].Value) == JobStatePending {
+		restore = JobStatePending
+	}
+	txn, err := c.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(statusKey), "=", resp.Kvs[0].ModRevision)).
+		Then(
+			clientv3.OpPut(statusKey, string(restore)),
+			clientv3.OpDelete(c.jobPausedKey(jobID)),
+		).Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return fmt.Errorf("job %s status changed while resuming it; try again", jobID)
+	}
+	return nil
+}
+
+func (c *etcdCluster) jobPausedKey(jobID string) string {
+	return fmt.Sprintf("%s/jobs/%s/paused", c.Prefix(), jobID)
+}
+
 // Helper to check if job is cancelled
 func (c *etcdCluster) IsJobCancelled(ctx context.Context, jobID string) (bool, error) {
 	key := fmt.Sprintf("%s/jobs/%s/cancelled", c.Prefix(), jobID)
@@ -0,0 +1,76 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// JobManifest lists every chunk a job wrote, for consumers of its output.
+// Jobs that set the manifest output option have it written to their sink
+// as <job id>/MANIFEST.json when they complete.
+type JobManifest struct {
+	JobID       string             `json:"job_id"`
+	LogURI      string             `json:"log_uri"`
+	Compression string             `json:"compression,omitempty"`
+	Generated   time.Time          `json:"generated"`
+	Records     int64              `json:"records"`
+	Bytes       int64              `json:"bytes"`
+	Chunks      []JobManifestChunk `json:"chunks"`
+}
+
+// JobManifestChunk is one chunk of a job's output and the shard that wrote it.
+type JobManifestChunk struct {
+	Shard int `json:"shard"`
+	OutputChunk
+}
+
+// GetJobManifest builds jobID's manifest from the manifests of its finished
+// shards. Chunks are listed by shard, in the order each shard wrote them.
+func (c *etcdCluster) GetJobManifest(ctx context.Context, jobID string) (*JobManifest, error) {
+	info, err := c.GetJob(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	prefix := fmt.Sprintf("%s/jobs/%s/shards/", c.Prefix(), jobID)
+	resp, err := c.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	m := &JobManifest{
+		JobID:     jobID,
+		Generated: time.Now().UTC(),
+		Chunks:    []JobManifestChunk{},
+	}
+	if info.Spec != nil {
+		m.LogURI, m.Compression = info.Spec.LogURI, info.Spec.Options.Output.Compression()
+	}
+	for _, kv := range resp.Kvs {
+		parts := strings.Split(strings.TrimPrefix(string(kv.Key), prefix), "/")
+		if len(parts) != 2 || parts[1] != "done" {
+			continue
+		}
+		shardID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+		var man ShardManifest
+		if err := json.Unmarshal(kv.Value, &man); err != nil {
+			return nil, fmt.Errorf("shard %d manifest: %w", shardID, err)
+		}
+		m.Records += man.Records
+		m.Bytes += man.Bytes
+		for _, out := range man.Outputs {
+			m.Chunks = append(m.Chunks, JobManifestChunk{Shard: shardID, OutputChunk: out})
+		}
+	}
+	sort.SliceStable(m.Chunks, func(i, j int) bool { return m.Chunks[i].Shard < m.Chunks[j].Shard })
+	return m, nil
+}
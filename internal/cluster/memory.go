@@ -0,0 +1,78 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chtzvt/certslurp/internal/secrets"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// MemoryConfig configures a cluster held entirely in this process's memory,
+// for single-node development and testing. No etcd is required; nothing
+// survives Close.
+type MemoryConfig struct {
+	Prefix       string // default: "/certslurp"
+	KeychainFile string // default: inside a temporary directory
+}
+
+// memoryCluster serves the Cluster interface from a memStore, through a
+// clientv3.Client that talks to it instead of an etcd server. It is not HA
+// and does not persist anything across restarts.
+type memoryCluster struct {
+	*etcdCluster
+	store *memStore
+	dir   string // temporary keychain directory, if any
+}
+
+func NewMemoryCluster(cfg MemoryConfig) (Cluster, error) {
+	if cfg.Prefix == "" {
+		cfg.Prefix = "/certslurp"
+	}
+	var dir string
+	if cfg.KeychainFile == "" {
+		var err error
+		dir, err = os.MkdirTemp("", "certslurp-memory-*")
+		if err != nil {
+			return nil, fmt.Errorf("create keychain dir: %w", err)
+		}
+		cfg.KeychainFile = filepath.Join(dir, "keychain.bin")
+	}
+
+	store := newMemStore()
+	cli := clientv3.NewCtxClient(context.Background())
+	cli.KV = clientv3.NewKVFromKVClient(store, nil)
+	cli.Lease = memLeases{store}
+	cli.Watcher = memWatcher{store}
+
+	secretStore, err := secrets.NewStore(cli, cfg.KeychainFile, cfg.Prefix)
+	if err != nil {
+		store.Close()
+		if dir != "" {
+			os.RemoveAll(dir)
+		}
+		return nil, err
+	}
+
+	return &memoryCluster{
+		etcdCluster: &etcdCluster{
+			client:  cli,
+			cfg:     EtcdConfig{Prefix: cfg.Prefix, KeychainFile: cfg.KeychainFile},
+			secrets: secretStore,
+		},
+		store: store,
+		dir:   dir,
+	}, nil
+}
+
+func (m *memoryCluster) Close() error {
+	// The client has no connection to close; this only cancels its context
+	_ = m.client.Close()
+	m.store.Close()
+	if m.dir != "" {
+		os.RemoveAll(m.dir)
+	}
+	return nil
+}
@@ -0,0 +1,714 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+)
+
+const (
+	// memHistoryLimit is how many past events memStore keeps for watches
+	// that start from an earlier revision. Older ones are compacted away.
+	memHistoryLimit = 10000
+	// memMaxTxnOps matches etcd's default limit on operations per txn.
+	memMaxTxnOps = 128
+	// memLeaseCheckInterval is how often expired leases are revoked.
+	memLeaseCheckInterval = 250 * time.Millisecond
+)
+
+// memStore is an in-memory key-value store with the etcd v3 semantics the
+// cluster and secret store rely on: revisions, transactions, prefix ranges,
+// leases and watches. It implements etcd's KV API and, through memLeases and
+// memWatcher, the Lease and Watcher ones, so a clientv3.Client can be built
+// on it without an etcd server. Everything is lost when it's closed.
+type memStore struct {
+	mu        sync.Mutex
+	rev       int64
+	compacted int64 // history holds every event after this revision
+	kvs       map[string]*mvccpb.KeyValue
+	keys      []string // sorted keys of kvs
+	leases    map[clientv3.LeaseID]*memLease
+	lastLease clientv3.LeaseID
+	history   []*clientv3.Event
+	watches   map[*memWatch]struct{}
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type memLease struct {
+	ttl    int64
+	expiry time.Time
+	keys   map[string]struct{}
+}
+
+func newMemStore() *memStore {
+	s := &memStore{
+		rev:     1, // etcd starts at revision 1, too
+		kvs:     make(map[string]*mvccpb.KeyValue),
+		leases:  make(map[clientv3.LeaseID]*memLease),
+		watches: make(map[*memWatch]struct{}),
+		stop:    make(chan struct{}),
+	}
+	go s.expireLeases()
+	return s
+}
+
+// Close stops lease expiry and ends every watch.
+func (s *memStore) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+func (s *memStore) header() *pb.ResponseHeader {
+	return &pb.ResponseHeader{Revision: s.rev}
+}
+
+// rangeKeys returns the keys in [key, end) in order, following etcd: an
+// empty end is key alone, and "\x00" is every key from key on.
+func (s *memStore) rangeKeys(key, end []byte) []string {
+	if len(end) == 0 {
+		if _, ok := s.kvs[string(key)]; ok {
+			return []string{string(key)}
+		}
+		return nil
+	}
+	var out []string
+	for i := sort.SearchStrings(s.keys, string(key)); i < len(s.keys); i++ {
+		if !bytes.Equal(end, []byte{0}) && s.keys[i] >= string(end) {
+			break
+		}
+		out = append(out, s.keys[i])
+	}
+	return out
+}
+
+func (s *memStore) Range(ctx context.Context, req *pb.RangeRequest, _ ...grpc.CallOption) (*pb.RangeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rangeLocked(req)
+}
+
+func (s *memStore) rangeLocked(req *pb.RangeRequest) (*pb.RangeResponse, error) {
+	// Only the latest revision is kept
+	if req.Revision > s.rev {
+		return nil, rpctypes.ErrGRPCFutureRev
+	}
+	if req.Revision > 0 && req.Revision < s.rev {
+		return nil, rpctypes.ErrGRPCCompacted
+	}
+
+	var kvs []*mvccpb.KeyValue
+	for _, k := range s.rangeKeys(req.Key, req.RangeEnd) {
+		kv := s.kvs[k]
+		if (req.MinModRevision > 0 && kv.ModRevision < req.MinModRevision) ||
+			(req.MaxModRevision > 0 && kv.ModRevision > req.MaxModRevision) ||
+			(req.MinCreateRevision > 0 && kv.CreateRevision < req.MinCreateRevision) ||
+			(req.MaxCreateRevision > 0 && kv.CreateRevision > req.MaxCreateRevision) {
+			continue
+		}
+		kvs = append(kvs, kv)
+	}
+
+	if req.SortOrder != pb.RangeRequest_NONE {
+		slices.SortStableFunc(kvs, func(a, b *mvccpb.KeyValue) int {
+			var c int
+			switch req.SortTarget {
+			case pb.RangeRequest_VERSION:
+				c = cmpInt64(a.Version, b.Version)
+			case pb.RangeRequest_CREATE:
+				c = cmpInt64(a.CreateRevision, b.CreateRevision)
+			case pb.RangeRequest_MOD:
+				c = cmpInt64(a.ModRevision, b.ModRevision)
+			case pb.RangeRequest_VALUE:
+				c = bytes.Compare(a.Value, b.Value)
+			default:
+				c = bytes.Compare(a.Key, b.Key)
+			}
+			if req.SortOrder == pb.RangeRequest_DESCEND {
+				c = -c
+			}
+			return c
+		})
+	}
+
+	resp := &pb.RangeResponse{Header: s.header(), Count: int64(len(kvs))}
+	if req.CountOnly {
+		return resp, nil
+	}
+	if req.Limit > 0 && int64(len(kvs)) > req.Limit {
+		kvs, resp.More = kvs[:req.Limit], true
+	}
+	for _, kv := range kvs {
+		c := *kv
+		if req.KeysOnly {
+			c.Value = nil
+		}
+		resp.Kvs = append(resp.Kvs, &c)
+	}
+	return resp, nil
+}
+
+func (s *memStore) Put(ctx context.Context, req *pb.PutRequest, _ ...grpc.CallOption) (*pb.PutResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkPut(req); err != nil {
+		return nil, err
+	}
+	var events []*clientv3.Event
+	resp := s.applyPut(s.rev+1, req, &events)
+	s.commit(events)
+	resp.Header = s.header()
+	return resp, nil
+}
+
+// checkPut reports an error applyPut would otherwise run into partway
+// through a txn.
+func (s *memStore) checkPut(req *pb.PutRequest) error {
+	if (req.IgnoreValue || req.IgnoreLease) && s.kvs[string(req.Key)] == nil {
+		return rpctypes.ErrGRPCKeyNotFound
+	}
+	if lease := clientv3.LeaseID(req.Lease); lease != clientv3.NoLease && s.leases[lease] == nil {
+		return rpctypes.ErrGRPCLeaseNotFound
+	}
+	return nil
+}
+
+func (s *memStore) applyPut(rev int64, req *pb.PutRequest, events *[]*clientv3.Event) *pb.PutResponse {
+	key := string(req.Key)
+	prev := s.kvs[key]
+	kv := &mvccpb.KeyValue{
+		Key:            req.Key,
+		Value:          req.Value,
+		Lease:          req.Lease,
+		CreateRevision: rev,
+		ModRevision:    rev,
+		Version:        1,
+	}
+	if prev != nil {
+		kv.CreateRevision = prev.CreateRevision
+		kv.Version = prev.Version + 1
+		if req.IgnoreValue {
+			kv.Value = prev.Value
+		}
+		if req.IgnoreLease {
+			kv.Lease = prev.Lease
+		}
+		s.detachLease(prev)
+	} else {
+		i := sort.SearchStrings(s.keys, key)
+		s.keys = slices.Insert(s.keys, i, key)
+	}
+	if l := s.leases[clientv3.LeaseID(kv.Lease)]; l != nil {
+		l.keys[key] = struct{}{}
+	}
+	s.kvs[key] = kv
+
+	*events = append(*events, &clientv3.Event{Type: mvccpb.PUT, Kv: kv, PrevKv: prev})
+	resp := &pb.PutResponse{}
+	if req.PrevKv {
+		resp.PrevKv = prev
+	}
+	return resp
+}
+
+func (s *memStore) DeleteRange(ctx context.Context, req *pb.DeleteRangeRequest, _ ...grpc.CallOption) (*pb.DeleteRangeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []*clientv3.Event
+	resp := s.applyDelete(s.rev+1, req, &events)
+	s.commit(events)
+	resp.Header = s.header()
+	return resp, nil
+}
+
+func (s *memStore) applyDelete(rev int64, req *pb.DeleteRangeRequest, events *[]*clientv3.Event) *pb.DeleteRangeResponse {
+	resp := &pb.DeleteRangeResponse{}
+	for _, key := range s.rangeKeys(req.Key, req.RangeEnd) {
+		prev := s.deleteKey(key)
+		*events = append(*events, &clientv3.Event{
+			Type:   mvccpb.DELETE,
+			Kv:     &mvccpb.KeyValue{Key: prev.Key, ModRevision: rev},
+			PrevKv: prev,
+		})
+		resp.Deleted++
+		if req.PrevKv {
+			resp.PrevKvs = append(resp.PrevKvs, prev)
+		}
+	}
+	return resp
+}
+
+func (s *memStore) deleteKey(key string) *mvccpb.KeyValue {
+	prev := s.kvs[key]
+	s.detachLease(prev)
+	delete(s.kvs, key)
+	if i, ok := slices.BinarySearch(s.keys, key); ok {
+		s.keys = slices.Delete(s.keys, i, i+1)
+	}
+	return prev
+}
+
+func (s *memStore) detachLease(kv *mvccpb.KeyValue) {
+	if l := s.leases[clientv3.LeaseID(kv.Lease)]; l != nil {
+		delete(l.keys, string(kv.Key))
+	}
+}
+
+func (s *memStore) Txn(ctx context.Context, req *pb.TxnRequest, _ ...grpc.CallOption) (*pb.TxnResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(req.Compare) > memMaxTxnOps || len(req.Success) > memMaxTxnOps || len(req.Failure) > memMaxTxnOps {
+		return nil, rpctypes.ErrGRPCTooManyOps
+	}
+	for _, ops := range [][]*pb.RequestOp{req.Success, req.Failure} {
+		if err := checkTxnKeys(ops); err != nil {
+			return nil, err
+		}
+	}
+
+	succeeded := true
+	for _, cmp := range req.Compare {
+		if !s.compare(cmp) {
+			succeeded = false
+			break
+		}
+	}
+	ops := req.Success
+	if !succeeded {
+		ops = req.Failure
+	}
+	for _, op := range ops {
+		if put := op.GetRequestPut(); put != nil {
+			if err := s.checkPut(put); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	rev := s.rev + 1
+	var events []*clientv3.Event
+	resp := &pb.TxnResponse{Succeeded: succeeded}
+	for _, op := range ops {
+		switch r := op.Request.(type) {
+		case *pb.RequestOp_RequestRange:
+			rr, err := s.rangeLocked(r.RequestRange)
+			if err != nil {
+				return nil, err
+			}
+			resp.Responses = append(resp.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseRange{ResponseRange: rr}})
+		case *pb.RequestOp_RequestPut:
+			pr := s.applyPut(rev, r.RequestPut, &events)
+			resp.Responses = append(resp.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponsePut{ResponsePut: pr}})
+		case *pb.RequestOp_RequestDeleteRange:
+			dr := s.applyDelete(rev, r.RequestDeleteRange, &events)
+			resp.Responses = append(resp.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: dr}})
+		default:
+			return nil, fmt.Errorf("memory cluster: unsupported txn operation %T", r)
+		}
+	}
+	s.commit(events)
+	resp.Header = s.header()
+	return resp, nil
+}
+
+// checkTxnKeys rejects a txn branch that writes a key twice, as etcd does.
+func checkTxnKeys(ops []*pb.RequestOp) error {
+	puts := map[string]bool{}
+	for _, op := range ops {
+		if put := op.GetRequestPut(); put != nil {
+			if puts[string(put.Key)] {
+				return rpctypes.ErrGRPCDuplicateKey
+			}
+			puts[string(put.Key)] = true
+		}
+	}
+	for _, op := range ops {
+		del := op.GetRequestDeleteRange()
+		if del == nil {
+			continue
+		}
+		for key := range puts {
+			if keyInRange([]byte(key), del.Key, del.RangeEnd) {
+				return rpctypes.ErrGRPCDuplicateKey
+			}
+		}
+	}
+	return nil
+}
+
+func keyInRange(key, start, end []byte) bool {
+	if len(end) == 0 {
+		return bytes.Equal(key, start)
+	}
+	return bytes.Compare(key, start) >= 0 && (bytes.Equal(end, []byte{0}) || bytes.Compare(key, end) < 0)
+}
+
+// compare evaluates a txn comparison against every key in its range. A
+// missing key compares as zero, except by value, which always fails.
+func (s *memStore) compare(c *pb.Compare) bool {
+	keys := s.rangeKeys(c.Key, c.RangeEnd)
+	if len(keys) == 0 {
+		if _, ok := c.TargetUnion.(*pb.Compare_Value); ok {
+			return false
+		}
+		return compareKV(c, &mvccpb.KeyValue{})
+	}
+	for _, k := range keys {
+		if !compareKV(c, s.kvs[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+func compareKV(c *pb.Compare, kv *mvccpb.KeyValue) bool {
+	var r int
+	switch t := c.TargetUnion.(type) {
+	case *pb.Compare_Version:
+		r = cmpInt64(kv.Version, t.Version)
+	case *pb.Compare_CreateRevision:
+		r = cmpInt64(kv.CreateRevision, t.CreateRevision)
+	case *pb.Compare_ModRevision:
+		r = cmpInt64(kv.ModRevision, t.ModRevision)
+	case *pb.Compare_Value:
+		r = bytes.Compare(kv.Value, t.Value)
+	case *pb.Compare_Lease:
+		r = cmpInt64(kv.Lease, t.Lease)
+	default:
+		return false
+	}
+	switch c.Result {
+	case pb.Compare_EQUAL:
+		return r == 0
+	case pb.Compare_NOT_EQUAL:
+		return r != 0
+	case pb.Compare_GREATER:
+		return r > 0
+	case pb.Compare_LESS:
+		return r < 0
+	}
+	return false
+}
+
+func cmpInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (s *memStore) Compact(ctx context.Context, req *pb.CompactionRequest, _ ...grpc.CallOption) (*pb.CompactionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Revision > s.rev {
+		return nil, rpctypes.ErrGRPCFutureRev
+	}
+	// Nothing is compacted while s.compacted is 0, so compacting revision 0
+	// is a no-op, as it is on a fresh etcd
+	if req.Revision < s.compacted || (req.Revision == s.compacted && s.compacted > 0) {
+		return nil, rpctypes.ErrGRPCCompacted
+	}
+	i := sort.Search(len(s.history), func(i int) bool { return s.history[i].Kv.ModRevision > req.Revision })
+	s.history = s.history[i:]
+	s.compacted = req.Revision
+	return &pb.CompactionResponse{Header: s.header()}, nil
+}
+
+// commit moves to the next revision if events changed anything, and hands
+// them to watches.
+func (s *memStore) commit(events []*clientv3.Event) {
+	if len(events) == 0 {
+		return
+	}
+	s.rev++
+	s.history = append(s.history, events...)
+	if over := len(s.history) - memHistoryLimit; over > 0 {
+		s.compacted = s.history[over-1].Kv.ModRevision
+		// Don't split a revision's events
+		for over < len(s.history) && s.history[over].Kv.ModRevision == s.compacted {
+			over++
+		}
+		s.history = slices.Clone(s.history[over:])
+	}
+	for w := range s.watches {
+		w.send(events)
+	}
+}
+
+// revokeLocked deletes a lease and every key attached to it.
+func (s *memStore) revokeLocked(id clientv3.LeaseID) bool {
+	l := s.leases[id]
+	if l == nil {
+		return false
+	}
+	delete(s.leases, id)
+	keys := make([]string, 0, len(l.keys))
+	for k := range l.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var events []*clientv3.Event
+	for _, k := range keys {
+		prev := s.deleteKey(k)
+		events = append(events, &clientv3.Event{
+			Type:   mvccpb.DELETE,
+			Kv:     &mvccpb.KeyValue{Key: prev.Key, ModRevision: s.rev + 1},
+			PrevKv: prev,
+		})
+	}
+	s.commit(events)
+	return true
+}
+
+func (s *memStore) expireLeases() {
+	t := time.NewTicker(memLeaseCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-t.C:
+			s.mu.Lock()
+			for id, l := range s.leases {
+				if now.After(l.expiry) {
+					s.revokeLocked(id)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// memLeases implements clientv3.Lease on a memStore.
+type memLeases struct {
+	s *memStore
+}
+
+func (m memLeases) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	s := m.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastLease++
+	s.leases[s.lastLease] = &memLease{
+		ttl:    ttl,
+		expiry: time.Now().Add(time.Duration(ttl) * time.Second),
+		keys:   make(map[string]struct{}),
+	}
+	return &clientv3.LeaseGrantResponse{ResponseHeader: s.header(), ID: s.lastLease, TTL: ttl}, nil
+}
+
+func (m memLeases) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	s := m.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.revokeLocked(id) {
+		return nil, rpctypes.ErrLeaseNotFound
+	}
+	return &clientv3.LeaseRevokeResponse{Header: s.header()}, nil
+}
+
+func (m memLeases) TimeToLive(ctx context.Context, id clientv3.LeaseID, _ ...clientv3.LeaseOption) (*clientv3.LeaseTimeToLiveResponse, error) {
+	s := m.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := &clientv3.LeaseTimeToLiveResponse{ResponseHeader: s.header(), ID: id, TTL: -1}
+	if l := s.leases[id]; l != nil {
+		resp.TTL = int64(time.Until(l.expiry).Seconds())
+		resp.GrantedTTL = l.ttl
+		for k := range l.keys {
+			resp.Keys = append(resp.Keys, []byte(k))
+		}
+	}
+	return resp, nil
+}
+
+func (m memLeases) Leases(ctx context.Context) (*clientv3.LeaseLeasesResponse, error) {
+	s := m.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := &clientv3.LeaseLeasesResponse{ResponseHeader: s.header()}
+	for id := range s.leases {
+		resp.Leases = append(resp.Leases, clientv3.LeaseStatus{ID: id})
+	}
+	return resp, nil
+}
+
+func (m memLeases) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	first, err := m.KeepAliveOnce(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *clientv3.LeaseKeepAliveResponse, 16)
+	ch <- first
+	go func() {
+		defer close(ch)
+		t := time.NewTicker(max(time.Duration(first.TTL)*time.Second/3, memLeaseCheckInterval))
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.s.stop:
+				return
+			case <-t.C:
+			}
+			resp, err := m.KeepAliveOnce(ctx, id)
+			if err != nil {
+				return
+			}
+			select {
+			case ch <- resp:
+			default: // Dropped, like clientv3 does when the channel is full
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (m memLeases) KeepAliveOnce(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error) {
+	s := m.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.leases[id]
+	if l == nil {
+		return nil, rpctypes.ErrLeaseNotFound
+	}
+	l.expiry = time.Now().Add(time.Duration(l.ttl) * time.Second)
+	return &clientv3.LeaseKeepAliveResponse{ResponseHeader: s.header(), ID: id, TTL: l.ttl}, nil
+}
+
+func (m memLeases) Close() error {
+	return nil
+}
+
+// memWatcher implements clientv3.Watcher on a memStore.
+type memWatcher struct {
+	s *memStore
+}
+
+// memWatch is one watch. Events are queued by the store as they're
+// committed, so it never waits on a slow reader, and delivered in order by
+// run.
+type memWatch struct {
+	key, end []byte
+	start    int64 // first revision to deliver
+	out      chan clientv3.WatchResponse
+
+	mu      sync.Mutex
+	pending []*clientv3.Event
+	notify  chan struct{}
+}
+
+func (m memWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	op := clientv3.OpGet(key, opts...)
+	w := &memWatch{
+		key:    op.KeyBytes(),
+		end:    op.RangeBytes(),
+		out:    make(chan clientv3.WatchResponse),
+		notify: make(chan struct{}, 1),
+	}
+
+	s := m.s
+	s.mu.Lock()
+	start := op.Rev()
+	w.start = start
+	if start > 0 && start <= s.compacted {
+		s.mu.Unlock()
+		go func() {
+			defer close(w.out)
+			select {
+			case w.out <- clientv3.WatchResponse{CompactRevision: s.compacted + 1, Canceled: true}:
+			case <-ctx.Done():
+			}
+		}()
+		return w.out
+	}
+	if start > 0 {
+		i := sort.Search(len(s.history), func(i int) bool { return s.history[i].Kv.ModRevision >= start })
+		w.send(s.history[i:])
+	}
+	s.watches[w] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		w.run(ctx, s.stop)
+		s.mu.Lock()
+		delete(s.watches, w)
+		s.mu.Unlock()
+	}()
+	return w.out
+}
+
+// send queues the events in w's range. The store's lock is held.
+func (w *memWatch) send(events []*clientv3.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	queued := false
+	for _, ev := range events {
+		if ev.Kv.ModRevision >= w.start && keyInRange(ev.Kv.Key, w.key, w.end) {
+			w.pending = append(w.pending, ev)
+			queued = true
+		}
+	}
+	if queued {
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *memWatch) run(ctx context.Context, stop <-chan struct{}) {
+	defer close(w.out)
+	for {
+		w.mu.Lock()
+		events := w.pending
+		w.pending = nil
+		w.mu.Unlock()
+
+		if len(events) > 0 {
+			resp := clientv3.WatchResponse{
+				Header: pb.ResponseHeader{Revision: events[len(events)-1].Kv.ModRevision},
+				Events: events,
+			}
+			select {
+			case w.out <- resp:
+				continue
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+		select {
+		case <-w.notify:
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (m memWatcher) RequestProgress(ctx context.Context) error {
+	return nil
+}
+
+// Close is a no-op; watches end with their contexts or the store.
+func (m memWatcher) Close() error {
+	return nil
+}
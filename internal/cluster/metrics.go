@@ -9,6 +9,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/fxamacker/cbor/v2"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -16,6 +17,7 @@ type WorkerMetrics struct {
 	ShardsProcessed int64 // atomic
 	ShardsFailed    int64 // atomic
 	processingTime  int64 // nanoseconds, atomic
+	ActiveUploads   int64 // chunks being written or uploaded right now, atomic
 
 	mu sync.Mutex
 }
@@ -39,6 +41,9 @@ func (m *WorkerMetrics) AddProcessingTime(d time.Duration) {
 func (m *WorkerMetrics) ProcessingTime() time.Duration {
 	return time.Duration(atomic.LoadInt64(&m.processingTime))
 }
+func (m *WorkerMetrics) ActiveUploadCount() int64 {
+	return atomic.LoadInt64(&m.ActiveUploads)
+}
 
 func (c *etcdCluster) SendMetrics(ctx context.Context, workerID string, metrics *WorkerMetrics) error {
 	key := path.Join(c.Prefix(), "workers", workerID)
@@ -52,12 +57,27 @@ func (c *etcdCluster) SendMetrics(ctx context.Context, workerID string, metrics
 	leaseID := clientv3.LeaseID(resp.Kvs[0].Lease)
 
 	processed, failed, processingTime := metrics.Snapshot()
+	if c.compactRecords() {
+		rec, err := cbor.Marshal(compactMetrics{
+			ShardsProcessed:  processed,
+			ShardsFailed:     failed,
+			ProcessingTimeNs: processingTime.Nanoseconds(),
+			ActiveUploads:    metrics.ActiveUploadCount(),
+			LastUpdated:      time.Now().UnixNano(),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = c.client.Put(ctx, key+"/metrics", string(rec), clientv3.WithLease(leaseID))
+		return err
+	}
 	now := time.Now().UTC().Format(time.RFC3339Nano)
 
 	txn := c.client.Txn(ctx).Then(
 		clientv3.OpPut(key+"/shards_processed", fmt.Sprintf("%v", processed), clientv3.WithLease(leaseID)),
 		clientv3.OpPut(key+"/shards_failed", fmt.Sprintf("%v", failed), clientv3.WithLease(leaseID)),
 		clientv3.OpPut(key+"/processing_time_ns", fmt.Sprintf("%v", processingTime.Nanoseconds()), clientv3.WithLease(leaseID)),
+		clientv3.OpPut(key+"/active_uploads", fmt.Sprintf("%v", metrics.ActiveUploadCount()), clientv3.WithLease(leaseID)),
 		clientv3.OpPut(key+"/last_updated", now, clientv3.WithLease(leaseID)),
 	)
 	_, err = txn.Commit()
@@ -69,15 +89,31 @@ type WorkerMetricsView struct {
 	ShardsProcessed  int64     `json:"shards_processed"`
 	ShardsFailed     int64     `json:"shards_failed"`
 	ProcessingTimeNs int64     `json:"processing_time_ns"`
+	ActiveUploads    int64     `json:"active_uploads"`
 	LastUpdated      time.Time `json:"last_updated"`
 }
 
 func (c *etcdCluster) GetWorkerMetrics(ctx context.Context, workerID string) (*WorkerMetricsView, error) {
 	keyBase := path.Join(c.Prefix(), "workers", workerID)
+
+	// A compact metrics record takes precedence over the per-counter keys
+	resp, err := c.client.Get(ctx, keyBase+"/metrics")
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) > 0 {
+		var rec compactMetrics
+		if err := cbor.Unmarshal(resp.Kvs[0].Value, &rec); err != nil {
+			return nil, fmt.Errorf("worker %s: corrupt metrics: %w", workerID, err)
+		}
+		return rec.view(workerID), nil
+	}
+
 	keys := []string{
 		keyBase + "/shards_processed",
 		keyBase + "/shards_failed",
 		keyBase + "/processing_time_ns",
+		keyBase + "/active_uploads",
 		keyBase + "/last_updated",
 	}
 	out := WorkerMetricsView{WorkerID: workerID}
@@ -96,6 +132,8 @@ func (c *etcdCluster) GetWorkerMetrics(ctx context.Context, workerID string) (*W
 			out.ShardsFailed, _ = strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
 		case keyHasSuffix(key, "/processing_time_ns"):
 			out.ProcessingTimeNs, _ = strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+		case keyHasSuffix(key, "/active_uploads"):
+			out.ActiveUploads, _ = strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
 		case keyHasSuffix(key, "/last_updated"):
 			out.LastUpdated, _ = time.Parse(time.RFC3339Nano, string(resp.Kvs[0].Value))
 		}
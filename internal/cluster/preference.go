@@ -0,0 +1,110 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ShardPreference hints that a shard is best processed by WorkerID, e.g.
+// because the worker holds the shard's raw data from an earlier run. Workers
+// leave the shard to it until Until, after which any worker may claim it, so
+// a preferred worker that's gone or busy can't stall the job.
+type ShardPreference struct {
+	WorkerID string    `json:"worker_id"`
+	Until    time.Time `json:"until"`
+}
+
+// workerPreferredPrefix holds a key per shard hinted at workerID, named
+// <jobID>/<shardID>. Each lives only as long as its grace period, on a lease,
+// so the preferred worker can go straight to the shards held for it.
+func (c *etcdCluster) workerPreferredPrefix(workerID string) string {
+	return path.Join(c.Prefix(), "workers", workerID, "preferred") + "/"
+}
+
+// SetShardPreferredWorker hints that workerID should claim shardID, holding
+// other workers off for grace. An empty workerID removes the hint. The hint
+// is advisory: it's honored when workers look for shards to claim, not by
+// AssignShard.
+func (c *etcdCluster) SetShardPreferredWorker(ctx context.Context, jobID string, shardID int, workerID string, grace time.Duration) error {
+	shardPrefix := c.ShardKey(jobID, shardID)
+	rangeKey := shardPrefix + "/range"
+	preferredKey := shardPrefix + "/preferred"
+	indexName := fmt.Sprintf("%s/%d", jobID, shardID)
+	if workerID != "" && grace < 0 {
+		return fmt.Errorf("negative grace period %s", grace)
+	}
+
+	// The previous hint's worker, if any, no longer has the shard held for it
+	var ops []clientv3.Op
+	resp, err := c.client.Get(ctx, preferredKey)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) > 0 {
+		var old ShardPreference
+		if err := json.Unmarshal(resp.Kvs[0].Value, &old); err == nil && old.WorkerID != "" && old.WorkerID != workerID {
+			ops = append(ops, clientv3.OpDelete(c.workerPreferredPrefix(old.WorkerID)+indexName))
+		}
+	}
+
+	if workerID == "" {
+		_, err := c.client.Txn(ctx).Then(append(ops, clientv3.OpDelete(preferredKey))...).Commit()
+		return err
+	}
+	pref, err := json.Marshal(ShardPreference{WorkerID: workerID, Until: time.Now().UTC().Add(grace)})
+	if err != nil {
+		return err
+	}
+	ttl := int64((grace + time.Second - 1) / time.Second)
+	lease, err := c.client.Grant(ctx, max(ttl, 1))
+	if err != nil {
+		return err
+	}
+	ops = append(ops,
+		clientv3.OpPut(preferredKey, string(pref)),
+		clientv3.OpPut(c.workerPreferredPrefix(workerID)+indexName, shardPrefix, clientv3.WithLease(lease.ID)),
+	)
+	txn, err := c.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(rangeKey), ">", 0)).
+		Then(ops...).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		_, _ = c.client.Revoke(ctx, lease.ID)
+		return fmt.Errorf("shard %d not found", shardID)
+	}
+	return nil
+}
+
+// ListPreferredShards returns the shards hinted at workerID whose grace
+// period hasn't run out, as shard IDs by job ID. A hint may have been
+// replaced since it was listed, so check the shards before claiming them.
+func (c *etcdCluster) ListPreferredShards(ctx context.Context, workerID string) (map[string][]int, error) {
+	prefix := c.workerPreferredPrefix(workerID)
+	resp, err := c.client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+	shards := map[string][]int{}
+	for _, kv := range resp.Kvs {
+		jobID, id, ok := strings.Cut(strings.TrimPrefix(string(kv.Key), prefix), "/")
+		if !ok {
+			continue
+		}
+		shardID, err := strconv.Atoi(id)
+		if err != nil {
+			continue
+		}
+		shards[jobID] = append(shards[jobID], shardID)
+	}
+	return shards, nil
+}
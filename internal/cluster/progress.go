@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// progressWindow is how many shards GetJobProgress reads at a time.
+const progressWindow = 1000
+
+// JobProgress aggregates the state of a job's shards. Every shard is counted
+// in exactly one of Done, Failed, Skipped, Assigned, Backoff and Pending.
+type JobProgress struct {
+	Shards   int `json:"shards"`
+	Done     int `json:"done"` // completed successfully
+	Failed   int `json:"failed"`
+	Skipped  int `json:"skipped"`
+	Assigned int `json:"assigned"` // being processed by a worker
+	Backoff  int `json:"backoff"`  // waiting out a retry backoff
+	Pending  int `json:"pending"`
+
+	// IndexTotal is the number of log entries the shards cover. IndexProcessed
+	// counts the entries of done shards, plus those checkpointed by
+	// shards in progress.
+	IndexTotal     int64 `json:"index_total"`
+	IndexProcessed int64 `json:"index_processed"`
+}
+
+// Percent returns IndexProcessed as a percentage of IndexTotal.
+func (p JobProgress) Percent() float64 {
+	if p.IndexTotal <= 0 {
+		return 0
+	}
+	return float64(p.IndexProcessed) / float64(p.IndexTotal) * 100
+}
+
+func (p *JobProgress) add(s ShardAssignmentStatus, now time.Time) {
+	p.Shards++
+	if s.IndexTo > s.IndexFrom {
+		p.IndexTotal += s.IndexTo - s.IndexFrom
+	}
+	switch {
+	case s.Skipped:
+		p.Skipped++
+	case s.Failed:
+		p.Failed++
+	case s.Done:
+		p.Done++
+		p.IndexProcessed += s.IndexTo - s.IndexFrom
+	default:
+		switch {
+		case s.Assigned:
+			p.Assigned++
+		case s.BackoffUntil.After(now):
+			p.Backoff++
+		default:
+			p.Pending++
+		}
+		if s.LastIndex != nil {
+			p.IndexProcessed += max(0, min(*s.LastIndex+1, s.IndexTo)-s.IndexFrom)
+		}
+	}
+}
+
+// GetJobProgress aggregates jobID's shard states. Shards are read in windows
+// of progressWindow, so large jobs are never loaded all at once.
+func (c *etcdCluster) GetJobProgress(ctx context.Context, jobID string) (*JobProgress, error) {
+	resp, err := c.client.Get(ctx, fmt.Sprintf("%s/jobs/%s/status", c.Prefix(), jobID))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, fmt.Errorf("job %q not found", jobID)
+	}
+	count, err := c.GetShardCount(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	shardsEnd := clientv3.GetPrefixRangeEnd(fmt.Sprintf("%s/jobs/%s/shards/", c.Prefix(), jobID))
+
+	now := time.Now()
+	progress := &JobProgress{}
+	for start := 0; ; start += progressWindow {
+		end := start + progressWindow
+		window, err := c.GetShardAssignmentsWindow(ctx, jobID, start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range window {
+			progress.add(s, now)
+		}
+		if end < count {
+			continue
+		}
+		// Split shards may have IDs past the original count
+		more, err := c.client.Get(ctx, c.ShardKey(jobID, end), clientv3.WithRange(shardsEnd), clientv3.WithKeysOnly(), clientv3.WithLimit(1))
+		if err != nil {
+			return nil, err
+		}
+		if len(more.Kvs) == 0 {
+			break
+		}
+	}
+	return progress, nil
+}
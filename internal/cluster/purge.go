@@ -0,0 +1,107 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// FinishedAt returns when the job was completed or cancelled, or the zero
+// time if it's neither.
+func (j JobInfo) FinishedAt() time.Time {
+	switch j.Status {
+	case JobStateCompleted:
+		return j.Completed
+	case JobStateCancelled:
+		return j.Cancelled
+	}
+	return time.Time{}
+}
+
+// PurgeJob deletes jobID and all of its shard keys. Jobs that are pending,
+// running or paused can't be purged.
+//
+// Keys are deleted in batches, each guarded by the job's status, so a job
+// whose status changes mid-purge is left alone. Shard keys go first and the
+// job's own keys last, so an interrupted purge leaves a job that's still
+// listed and can be purged again.
+func (c *etcdCluster) PurgeJob(ctx context.Context, jobID string) error {
+	const batchSize = 128 // etcd transaction limit is 128 ops
+
+	statusKey := fmt.Sprintf("%s/jobs/%s/status", c.Prefix(), jobID)
+	resp, err := c.client.Get(ctx, statusKey)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return fmt.Errorf("job %q not found", jobID)
+	}
+	switch status := JobState(resp.Kvs[0].Value); status {
+	case JobStatePending, JobStateRunning, JobStatePaused:
+		return fmt.Errorf("job %s is %s; only completed, cancelled or failed jobs can be purged", jobID, status)
+	}
+	unchanged := clientv3.Compare(clientv3.ModRevision(statusKey), "=", resp.Kvs[0].ModRevision)
+
+	shardPrefix := fmt.Sprintf("%s/jobs/%s/shards/", c.Prefix(), jobID)
+	keys, err := c.client.Get(ctx, shardPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(keys.Kvs); start += batchSize {
+		end := start + batchSize
+		if end > len(keys.Kvs) {
+			end = len(keys.Kvs)
+		}
+		dels := make([]clientv3.Op, 0, end-start)
+		for _, kv := range keys.Kvs[start:end] {
+			dels = append(dels, clientv3.OpDelete(string(kv.Key)))
+		}
+		txn, err := c.client.Txn(ctx).If(unchanged).Then(dels...).Commit()
+		if err != nil {
+			return err
+		}
+		if !txn.Succeeded {
+			return fmt.Errorf("job %s status changed while purging it", jobID)
+		}
+	}
+
+	// Whatever's left is the job's own handful of keys, plus any shard keys
+	// written since they were listed
+	jobPrefix := fmt.Sprintf("%s/jobs/%s/", c.Prefix(), jobID)
+	txn, err := c.client.Txn(ctx).If(unchanged).Then(clientv3.OpDelete(jobPrefix, clientv3.WithPrefix())).Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return fmt.Errorf("job %s status changed while purging it", jobID)
+	}
+	return nil
+}
+
+// PurgeFinishedJobs purges every job that was completed or cancelled before
+// cutoff, returning the IDs of the jobs purged. It keeps going past jobs
+// that fail to purge and reports the first error.
+func PurgeFinishedJobs(ctx context.Context, cl Cluster, cutoff time.Time) ([]string, error) {
+	jobs, err := cl.ListJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var purged []string
+	var firstErr error
+	for _, j := range jobs {
+		finished := j.FinishedAt()
+		if finished.IsZero() || !finished.Before(cutoff) {
+			continue
+		}
+		if err := cl.PurgeJob(ctx, j.ID); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("purge job %s: %w", j.ID, err)
+			}
+			continue
+		}
+		purged = append(purged, j.ID)
+	}
+	return purged, firstErr
+}
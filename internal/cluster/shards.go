@@ -1,13 +1,17 @@
 package cluster
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/chtzvt/certslurp/internal/job"
+	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -15,6 +19,7 @@ const (
 	shardLeaseDuration = 10 * time.Minute
 	MaxShardRetries    = 3
 	shardRetryBackoff  = 30 * time.Second
+	MaxShardBackoff    = 24 * time.Hour
 )
 
 type ShardAssignment struct {
@@ -31,19 +36,48 @@ type ShardAssignmentStatus struct {
 	LeaseExpiry  time.Time
 	Done         bool
 	Failed       bool
+	Skipped      bool
+	SkipReason   string
 	Retries      int
 	BackoffUntil time.Time
 	OutputPath   string
 	IndexFrom    int64
 	IndexTo      int64
+	LastIndex    *int64 // from the latest checkpoint; nil until there is one
+
+	// PreferredWorker should be left to claim the shard until
+	// PreferredUntil; see SetShardPreferredWorker.
+	PreferredWorker string
+	PreferredUntil  time.Time
 }
 
 type ShardManifest struct {
 	OutputPath   string    `json:"output_path,omitempty"`
 	DoneAt       time.Time `json:"done_at"`
 	Failed       bool      `json:"failed,omitempty"`
+	Skipped      bool      `json:"skipped,omitempty"`
+	SkipReason   string    `json:"skip_reason,omitempty"`
 	Retries      int       `json:"retries,omitempty"`
 	BackoffUntil time.Time `json:"backoff_until,omitempty"`
+
+	// Output counts reported by the worker, rolled up into the JobSummary
+	Records          int64 `json:"records,omitempty"`
+	Bytes            int64 `json:"bytes,omitempty"`
+	Chunks           int   `json:"chunks,omitempty"`
+	DeadLettered     int64 `json:"dead_lettered,omitempty"`
+	ProcessingTimeNs int64 `json:"processing_time_ns,omitempty"`
+
+	// The chunks written, recorded for jobs that ask for a MANIFEST.json
+	Outputs []OutputChunk `json:"outputs,omitempty"`
+}
+
+// OutputChunk describes one chunk of a shard's output. Name is the stream
+// name the sink was given; sinks that add a compression extension add it
+// to this.
+type OutputChunk struct {
+	Name   string `json:"name"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
 }
 
 type ShardStatus struct {
@@ -52,11 +86,29 @@ type ShardStatus struct {
 	LeaseExpiry  time.Time
 	Done         bool
 	Failed       bool
+	Skipped      bool
+	SkipReason   string
 	Retries      int
 	BackoffUntil time.Time
 	OutputPath   string
 	IndexFrom    int64
 	IndexTo      int64
+	LastIndex    *int64           // from the latest checkpoint; nil until there is one
+	Checkpoint   *ShardCheckpoint // nil until the worker records one
+}
+
+// ShardCheckpoint records how far a worker has durably got through a shard:
+// every entry up to and including LastIndex has been handled, and written
+// to the first Chunks output chunks. A worker that takes the shard over
+// resumes after LastIndex and numbers its chunks on from Chunks. Generation
+// counts how many times the shard has been resumed.
+type ShardCheckpoint struct {
+	LastIndex  int64         `json:"last_index"`
+	Chunks     int           `json:"chunks"`
+	Records    int64         `json:"records"`
+	Bytes      int64         `json:"bytes"`
+	Generation int           `json:"generation,omitempty"`
+	Outputs    []OutputChunk `json:"outputs,omitempty"`
 }
 
 type ShardRange struct {
@@ -69,6 +121,51 @@ func (c *etcdCluster) ShardKey(jobID string, shardID int) string {
 	return fmt.Sprintf("%s/jobs/%s/shards/%06d", c.Prefix(), jobID, shardID)
 }
 
+// ShardRetryPolicy returns the retry limit and base backoff for shards of a job,
+// falling back to MaxShardRetries and the default backoff when the spec doesn't override them.
+func ShardRetryPolicy(spec *job.JobSpec) (maxRetries int, backoff time.Duration) {
+	maxRetries, backoff = MaxShardRetries, shardRetryBackoff
+	if spec == nil {
+		return maxRetries, backoff
+	}
+	if spec.Options.Fetch.MaxRetries > 0 {
+		maxRetries = spec.Options.Fetch.MaxRetries
+	}
+	if secs := spec.Options.Fetch.RetryBackoffSecs; secs > int(MaxShardBackoff/time.Second) {
+		backoff = MaxShardBackoff
+	} else if secs > 0 {
+		backoff = time.Duration(secs) * time.Second
+	}
+	return maxRetries, backoff
+}
+
+// ShardBackoff returns how long a shard waits after its retries'th failure:
+// base doubled for each failure after the first, capped at MaxShardBackoff.
+func ShardBackoff(base time.Duration, retries int) time.Duration {
+	shift := min(max(retries-1, 0), 32)
+	if base > MaxShardBackoff>>shift {
+		return MaxShardBackoff
+	}
+	return base << shift
+}
+
+// shardRetryPolicyFromSpec decodes a stored job spec value into its retry policy.
+// A missing or undecodable spec yields the defaults.
+func shardRetryPolicyFromSpec(kvs []*mvccpb.KeyValue) (int, time.Duration) {
+	if len(kvs) == 0 {
+		return ShardRetryPolicy(nil)
+	}
+	var spec job.JobSpec
+	if err := json.Unmarshal(kvs[0].Value, &spec); err != nil {
+		return ShardRetryPolicy(nil)
+	}
+	return ShardRetryPolicy(&spec)
+}
+
+func (c *etcdCluster) jobSpecKey(jobID string) string {
+	return fmt.Sprintf("%s/jobs/%s/spec", c.Prefix(), jobID)
+}
+
 // BulkCreateShards creates multiple shard manifests in a single atomic etcd operation.
 // If any already exist, they're skipped (idempotent).
 func (c *etcdCluster) BulkCreateShards(ctx context.Context, jobID string, ranges []ShardRange) error {
@@ -165,6 +262,8 @@ func (c *etcdCluster) GetShardAssignmentsWindow(ctx context.Context, jobID strin
 			_ = json.Unmarshal(kv.Value, &man)
 			stat.OutputPath = man.OutputPath
 			stat.Failed = man.Failed
+			stat.Skipped = man.Skipped
+			stat.SkipReason = man.SkipReason
 		case "failed":
 			stat.Failed = true
 		case "retries":
@@ -180,6 +279,16 @@ func (c *etcdCluster) GetShardAssignmentsWindow(ctx context.Context, jobID strin
 				stat.IndexFrom = rng.IndexFrom
 				stat.IndexTo = rng.IndexTo
 			}
+		case "progress":
+			if cp := parseShardCheckpoint(kv.Value); cp != nil {
+				stat.LastIndex = &cp.LastIndex
+			}
+		case "preferred":
+			var pref ShardPreference
+			if err := json.Unmarshal(kv.Value, &pref); err == nil {
+				stat.PreferredWorker = pref.WorkerID
+				stat.PreferredUntil = pref.Until
+			}
 		}
 		statusMap[shardID] = stat
 	}
@@ -223,6 +332,8 @@ func (c *etcdCluster) GetShardAssignments(ctx context.Context, jobID string) (ma
 			_ = json.Unmarshal(kv.Value, &man)
 			stat.OutputPath = man.OutputPath
 			stat.Failed = man.Failed
+			stat.Skipped = man.Skipped
+			stat.SkipReason = man.SkipReason
 		case "failed":
 			stat.Failed = true
 		case "retries":
@@ -238,6 +349,16 @@ func (c *etcdCluster) GetShardAssignments(ctx context.Context, jobID string) (ma
 				stat.IndexFrom = rng.IndexFrom
 				stat.IndexTo = rng.IndexTo
 			}
+		case "progress":
+			if cp := parseShardCheckpoint(kv.Value); cp != nil {
+				stat.LastIndex = &cp.LastIndex
+			}
+		case "preferred":
+			var pref ShardPreference
+			if err := json.Unmarshal(kv.Value, &pref); err == nil {
+				stat.PreferredWorker = pref.WorkerID
+				stat.PreferredUntil = pref.Until
+			}
 		}
 		statusMap[shardID] = stat
 	}
@@ -245,6 +366,20 @@ func (c *etcdCluster) GetShardAssignments(ctx context.Context, jobID string) (ma
 }
 
 func (c *etcdCluster) AssignShard(ctx context.Context, jobID string, shardID int, workerID string) error {
+	// A worker claiming several shards at once conflicts with itself over its
+	// capacity count; that's no race for the shard, so count again
+	for attempt := 1; ; attempt++ {
+		err := c.assignShard(ctx, jobID, shardID, workerID)
+		if !errors.Is(err, errCapacityConflict) {
+			return err
+		}
+		if attempt == capacityClaimAttempts {
+			return fmt.Errorf("shard %d assignment race", shardID)
+		}
+	}
+}
+
+func (c *etcdCluster) assignShard(ctx context.Context, jobID string, shardID int, workerID string) error {
 	shardPrefix := c.ShardKey(jobID, shardID)
 	assignmentKey := shardPrefix + "/assignment"
 	doneKey := shardPrefix + "/done"
@@ -260,6 +395,7 @@ func (c *etcdCluster) AssignShard(ctx context.Context, jobID string, shardID int
 		clientv3.OpGet(doneKey),
 		clientv3.OpGet(retriesKey),
 		clientv3.OpGet(backoffKey),
+		clientv3.OpGet(c.jobSpecKey(jobID)),
 	}
 	txn := c.client.Txn(ctx).Then(getOps...)
 	txnResp, err := txn.Commit()
@@ -278,16 +414,21 @@ func (c *etcdCluster) AssignShard(ctx context.Context, jobID string, shardID int
 	if len(txnResp.Responses[3].GetResponseRange().Kvs) > 0 {
 		backoffUntil.UnmarshalText(txnResp.Responses[3].GetResponseRange().Kvs[0].Value)
 	}
+	maxRetries, _ := shardRetryPolicyFromSpec(txnResp.Responses[4].GetResponseRange().Kvs)
 
 	if doneExists {
 		return fmt.Errorf("shard %d already completed", shardID)
 	}
-	if retries >= MaxShardRetries {
+	if retries >= maxRetries {
 		return fmt.Errorf("shard %d permanently failed (retries exceeded)", shardID)
 	}
 	if !backoffUntil.IsZero() && now.Before(backoffUntil) {
 		return fmt.Errorf("shard %d in backoff until %v", shardID, backoffUntil)
 	}
+	capacityCmps, claimOps, err := c.reserveWorkerCapacity(ctx, workerID, jobID, shardID)
+	if err != nil {
+		return err
+	}
 
 	assignment := ShardAssignment{
 		WorkerID:    workerID,
@@ -303,31 +444,38 @@ func (c *etcdCluster) AssignShard(ctx context.Context, jobID string, shardID int
 			return fmt.Errorf("shard %d already assigned", shardID)
 		}
 		// Assignment expired: try to claim via CAS
-		cmp := clientv3.Compare(clientv3.Value(assignmentKey), "=", string(txnResp.Responses[0].GetResponseRange().Kvs[0].Value))
-		txn2 := c.client.Txn(ctx).If(cmp).Then(
+		prev := txnResp.Responses[0].GetResponseRange().Kvs[0].Value
+		cmp := clientv3.Compare(clientv3.Value(assignmentKey), "=", string(prev))
+		txn2 := c.client.Txn(ctx).If(append(capacityCmps, cmp)...).Then(append(claimOps,
 			clientv3.OpPut(assignmentKey, string(assignmentBytes)),
 			clientv3.OpPut(shardPrefix+"/in_progress", now.Format(time.RFC3339Nano)),
-		)
+		)...).Else(clientv3.OpGet(assignmentKey))
 		txn2Resp, err := txn2.Commit()
 		if err != nil {
 			return err
 		}
 		if !txn2Resp.Succeeded {
+			if kvs := txn2Resp.Responses[0].GetResponseRange().Kvs; len(capacityCmps) > 0 && len(kvs) > 0 && bytes.Equal(kvs[0].Value, prev) {
+				return errCapacityConflict
+			}
 			return fmt.Errorf("shard %d work stealing failed (race)", shardID)
 		}
 		return nil
 	} else {
 		// No assignment: normal claim
 		cmp := clientv3.Compare(clientv3.Version(assignmentKey), "=", 0)
-		txn2 := c.client.Txn(ctx).If(cmp).Then(
+		txn2 := c.client.Txn(ctx).If(append(capacityCmps, cmp)...).Then(append(claimOps,
 			clientv3.OpPut(assignmentKey, string(assignmentBytes)),
 			clientv3.OpPut(shardPrefix+"/in_progress", now.Format(time.RFC3339Nano)),
-		)
+		)...).Else(clientv3.OpGet(assignmentKey))
 		txn2Resp, err := txn2.Commit()
 		if err != nil {
 			return err
 		}
 		if !txn2Resp.Succeeded {
+			if len(capacityCmps) > 0 && len(txn2Resp.Responses[0].GetResponseRange().Kvs) == 0 {
+				return errCapacityConflict
+			}
 			return fmt.Errorf("shard %d assignment race", shardID)
 		}
 		return nil
@@ -343,6 +491,7 @@ func (c *etcdCluster) GetShardStatus(ctx context.Context, jobID string, shardID
 		base + "/retries",
 		base + "/backoff_until",
 		base + "/range",
+		base + "/progress",
 	}
 	resps := make([]*clientv3.GetResponse, len(keys))
 
@@ -372,6 +521,8 @@ func (c *etcdCluster) GetShardStatus(ctx context.Context, jobID string, shardID
 		if err := json.Unmarshal(resps[1].Kvs[0].Value, &manifest); err == nil {
 			status.OutputPath = manifest.OutputPath
 			status.Failed = manifest.Failed
+			status.Skipped = manifest.Skipped
+			status.SkipReason = manifest.SkipReason
 		}
 	}
 	// failed
@@ -396,9 +547,64 @@ func (c *etcdCluster) GetShardStatus(ctx context.Context, jobID string, shardID
 		}
 	}
 
+	if len(resps[6].Kvs) > 0 {
+		if cp := parseShardCheckpoint(resps[6].Kvs[0].Value); cp != nil {
+			status.Checkpoint = cp
+			status.LastIndex = &cp.LastIndex
+		}
+	}
+
 	return status, nil
 }
 
+// UpdateShardProgress records a checkpoint for shardID on behalf of the
+// worker holding its lease, so clients can show how far along it is and a
+// worker taking the shard over can resume from it. The checkpoint survives
+// the lease being released, expiring or a retryable failure, and is cleared
+// when the shard finishes, is skipped or reset, or fails permanently.
+func (c *etcdCluster) UpdateShardProgress(ctx context.Context, jobID string, shardID int, workerID string, cp ShardCheckpoint) error {
+	shardPrefix := c.ShardKey(jobID, shardID)
+	assignmentKey := shardPrefix + "/assignment"
+
+	resp, err := c.client.Get(ctx, assignmentKey)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return fmt.Errorf("assignment not found for shard %d", shardID)
+	}
+	var assign ShardAssignment
+	if err := json.Unmarshal(resp.Kvs[0].Value, &assign); err != nil {
+		return err
+	}
+	if assign.WorkerID != workerID {
+		return fmt.Errorf("worker %s does not own shard %d", workerID, shardID)
+	}
+
+	// CAS on the assignment, so a worker that has lost the shard can't
+	// overwrite its new owner's checkpoint
+	val, _ := json.Marshal(cp)
+	txnResp, err := c.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(assignmentKey), "=", resp.Kvs[0].ModRevision)).
+		Then(clientv3.OpPut(shardPrefix+"/progress", string(val))).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !txnResp.Succeeded {
+		return fmt.Errorf("shard %d assignment changed while checkpointing", shardID)
+	}
+	return nil
+}
+
+func parseShardCheckpoint(val []byte) *ShardCheckpoint {
+	var cp ShardCheckpoint
+	if err := json.Unmarshal(val, &cp); err != nil {
+		return nil
+	}
+	return &cp
+}
+
 func (c *etcdCluster) RequestShardSplit(ctx context.Context, jobID string, shardID int, newRanges []ShardRange) error {
 	shardPrefix := c.ShardKey(jobID, shardID)
 	splitKey := shardPrefix + "/split"
@@ -428,15 +634,19 @@ func (c *etcdCluster) ReportShardFailed(ctx context.Context, jobID string, shard
 
 	// Get and increment retries
 	var retries int
-	resp, err := c.client.Get(ctx, retriesKey)
+	resp, err := c.client.Txn(ctx).Then(
+		clientv3.OpGet(retriesKey),
+		clientv3.OpGet(c.jobSpecKey(jobID)),
+	).Commit()
 	if err != nil {
 		return err
 	}
-	if len(resp.Kvs) > 0 {
-		retries, _ = strconv.Atoi(string(resp.Kvs[0].Value))
+	if kvs := resp.Responses[0].GetResponseRange().Kvs; len(kvs) > 0 {
+		retries, _ = strconv.Atoi(string(kvs[0].Value))
 	}
+	maxRetries, baseBackoff := shardRetryPolicyFromSpec(resp.Responses[1].GetResponseRange().Kvs)
 	retries++
-	if retries > MaxShardRetries {
+	if retries > maxRetries {
 		// Mark permanently failed
 		man := ShardManifest{
 			DoneAt:  time.Now().UTC(),
@@ -448,6 +658,7 @@ func (c *etcdCluster) ReportShardFailed(ctx context.Context, jobID string, shard
 			clientv3.OpPut(doneKey, string(manBytes)),
 			clientv3.OpDelete(assignmentKey),
 			clientv3.OpDelete(inProgressKey),
+			clientv3.OpDelete(shardPrefix+"/progress"),
 			clientv3.OpDelete(retriesKey),
 			clientv3.OpDelete(backoffKey),
 		).Commit()
@@ -455,8 +666,7 @@ func (c *etcdCluster) ReportShardFailed(ctx context.Context, jobID string, shard
 	}
 
 	// Calculate next backoff (exponential or fixed)
-	backoffDuration := shardRetryBackoff * time.Duration(1<<uint(retries-1)) // exponential: 30s, 60s, 120s, ...
-	backoffUntil := time.Now().Add(backoffDuration)
+	backoffUntil := time.Now().Add(ShardBackoff(baseBackoff, retries)) // exponential: 30s, 60s, 120s, ...
 
 	backoffBytes, _ := backoffUntil.MarshalText()
 	_, err = c.client.Txn(ctx).Then(
@@ -479,6 +689,7 @@ func (c *etcdCluster) ResetFailedShard(ctx context.Context, jobID string, shardI
 		clientv3.OpDelete(shardPrefix + "/assignment"),
 		clientv3.OpDelete(shardPrefix + "/failed"),
 		clientv3.OpDelete(shardPrefix + "/in_progress"),
+		clientv3.OpDelete(shardPrefix + "/progress"),
 	}
 	_, err := c.client.Txn(ctx).Then(ops...).Commit()
 	return err
@@ -491,10 +702,15 @@ func (c *etcdCluster) ResetFailedShards(ctx context.Context, jobID string) ([]in
 	if err != nil {
 		return nil, err
 	}
+	specResp, err := c.client.Get(ctx, c.jobSpecKey(jobID))
+	if err != nil {
+		return nil, err
+	}
+	maxRetries, _ := shardRetryPolicyFromSpec(specResp.Kvs)
 	var resetIDs []int
 
 	for shardID, status := range statuses {
-		if (status.Done && status.Failed) || (!status.Done && status.Retries >= MaxShardRetries) {
+		if (status.Done && status.Failed) || (!status.Done && status.Retries >= maxRetries) {
 			if err := c.ResetFailedShard(ctx, jobID, shardID); err != nil {
 				return resetIDs, fmt.Errorf("failed to reset shard %d: %w", shardID, err)
 			}
@@ -521,6 +737,7 @@ func (c *etcdCluster) ReportShardDone(ctx context.Context, jobID string, shardID
 			clientv3.OpPut(doneKey, string(manBytes)),
 			clientv3.OpDelete(assignmentKey),
 			clientv3.OpDelete(inProgressKey),
+			clientv3.OpDelete(shardPrefix+"/progress"),
 			clientv3.OpDelete(retriesKey),
 			clientv3.OpDelete(backoffKey),
 		)
@@ -535,6 +752,82 @@ func (c *etcdCluster) ReportShardDone(ctx context.Context, jobID string, shardID
 	return nil
 }
 
+// SkipShard marks a shard as intentionally excluded from the job. Skipped
+// shards are never claimed and count as finished for job completion, but are
+// reported separately from done and failed shards. A shard that already
+// completed successfully can't be skipped; a permanently failed one can.
+// Neither can a shard a worker holds an unexpired lease on, as the worker
+// would carry on processing it and report it done over the skip.
+func (c *etcdCluster) SkipShard(ctx context.Context, jobID string, shardID int, reason string) error {
+	shardPrefix := c.ShardKey(jobID, shardID)
+	rangeKey := shardPrefix + "/range"
+	doneKey := shardPrefix + "/done"
+	assignmentKey := shardPrefix + "/assignment"
+
+	resp, err := c.client.Txn(ctx).Then(
+		clientv3.OpGet(rangeKey),
+		clientv3.OpGet(doneKey),
+		clientv3.OpGet(assignmentKey),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if len(resp.Responses[0].GetResponseRange().Kvs) == 0 {
+		return fmt.Errorf("shard %d not found", shardID)
+	}
+	doneRev := int64(0)
+	if kvs := resp.Responses[1].GetResponseRange().Kvs; len(kvs) > 0 {
+		var existing ShardManifest
+		_ = json.Unmarshal(kvs[0].Value, &existing)
+		if existing.Skipped {
+			return nil
+		}
+		if !existing.Failed {
+			return fmt.Errorf("shard %d already completed", shardID)
+		}
+		doneRev = kvs[0].ModRevision
+	}
+	assignmentRev := int64(0)
+	if kvs := resp.Responses[2].GetResponseRange().Kvs; len(kvs) > 0 {
+		var assign ShardAssignment
+		if err := json.Unmarshal(kvs[0].Value, &assign); err == nil && assign.LeaseExpiry.After(time.Now()) {
+			return fmt.Errorf("shard %d is assigned to worker %s; skip it once the worker releases it", shardID, assign.WorkerID)
+		}
+		assignmentRev = kvs[0].ModRevision
+	}
+
+	man := ShardManifest{
+		DoneAt:     time.Now().UTC(),
+		Skipped:    true,
+		SkipReason: reason,
+	}
+	manBytes, _ := json.Marshal(man)
+
+	// CAS on the done and assignment keys so a shard finishing, or being
+	// claimed, concurrently isn't overwritten
+	txnResp, err := c.client.Txn(ctx).
+		If(
+			clientv3.Compare(clientv3.ModRevision(doneKey), "=", doneRev),
+			clientv3.Compare(clientv3.ModRevision(assignmentKey), "=", assignmentRev),
+		).
+		Then(
+			clientv3.OpPut(doneKey, string(manBytes)),
+			clientv3.OpDelete(shardPrefix+"/assignment"),
+			clientv3.OpDelete(shardPrefix+"/in_progress"),
+			clientv3.OpDelete(shardPrefix+"/progress"),
+			clientv3.OpDelete(shardPrefix+"/retries"),
+			clientv3.OpDelete(shardPrefix+"/backoff_until"),
+			clientv3.OpDelete(shardPrefix+"/failed"),
+		).Commit()
+	if err != nil {
+		return err
+	}
+	if !txnResp.Succeeded {
+		return fmt.Errorf("shard %d changed state while skipping", shardID)
+	}
+	return nil
+}
+
 func (c *etcdCluster) RenewShardLease(ctx context.Context, jobID string, shardID int, workerID string) error {
 	shardPrefix := c.ShardKey(jobID, shardID)
 	assignmentKey := shardPrefix + "/assignment"
@@ -590,7 +883,8 @@ func (c *etcdCluster) ReleaseShardLease(ctx context.Context, jobID string, shard
 		return fmt.Errorf("release denied: worker %q does not own shard %d (owned by %q)", workerID, shardID, assign.WorkerID)
 	}
 
-	// Remove assignment and in_progress atomically (CAS)
+	// Remove assignment and in_progress atomically (CAS). The checkpoint
+	// stays, so the next worker can resume from it
 	cmp := clientv3.Compare(clientv3.Value(assignmentKey), "=", string(resp.Kvs[0].Value))
 	txn := c.client.Txn(ctx).If(cmp).Then(
 		clientv3.OpDelete(assignmentKey),
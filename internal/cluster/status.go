@@ -1,6 +1,11 @@
 package cluster
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/secrets"
+)
 
 type ClusterStatus struct {
 	Jobs    []JobStatus
@@ -37,3 +42,102 @@ func (c *etcdCluster) GetClusterStatus(ctx context.Context) (*ClusterStatus, err
 		Workers: workers,
 	}, nil
 }
+
+// ClusterDump is a point-in-time snapshot of the full cluster state, intended
+// for offline inspection. It never includes secret values.
+type ClusterDump struct {
+	GeneratedAt          time.Time                     `json:"generated_at" yaml:"generated_at"`
+	Jobs                 []JobDump                     `json:"jobs" yaml:"jobs"`
+	Workers              []WorkerDump                  `json:"workers" yaml:"workers"`
+	PendingRegistrations []secrets.PendingRegistration `json:"pending_registrations" yaml:"pending_registrations"`
+}
+
+type JobDump struct {
+	Job    JobInfo      `json:"job" yaml:"job"`
+	Shards ShardSummary `json:"shards" yaml:"shards"`
+}
+
+// ShardSummary counts a job's shards by state.
+type ShardSummary struct {
+	Total    int `json:"total" yaml:"total"`
+	Done     int `json:"done" yaml:"done"`
+	Failed   int `json:"failed" yaml:"failed"`
+	Skipped  int `json:"skipped" yaml:"skipped"`
+	Assigned int `json:"assigned" yaml:"assigned"`
+	Backoff  int `json:"backoff" yaml:"backoff"`
+	Pending  int `json:"pending" yaml:"pending"`
+}
+
+type WorkerDump struct {
+	Worker  WorkerInfo         `json:"worker" yaml:"worker"`
+	Metrics *WorkerMetricsView `json:"metrics,omitempty" yaml:"metrics,omitempty"`
+}
+
+// SummarizeShards reduces a job's shard assignments to per-state counts.
+func SummarizeShards(shards map[int]ShardAssignmentStatus, now time.Time) ShardSummary {
+	sum := ShardSummary{Total: len(shards)}
+	for _, s := range shards {
+		switch {
+		case s.Skipped:
+			sum.Skipped++
+		case s.Failed:
+			sum.Failed++
+		case s.Done:
+			sum.Done++
+		case s.Assigned:
+			sum.Assigned++
+		case s.BackoffUntil.After(now):
+			sum.Backoff++
+		default:
+			sum.Pending++
+		}
+	}
+	return sum
+}
+
+// DumpClusterState serializes all jobs (with shard summaries), workers (with
+// metrics), and pending node registrations into a single snapshot.
+func (c *etcdCluster) DumpClusterState(ctx context.Context) (*ClusterDump, error) {
+	jobs, err := c.ListJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	workers, err := c.ListWorkers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := c.Secrets().ListPendingRegistrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	dump := &ClusterDump{
+		GeneratedAt:          now,
+		Jobs:                 make([]JobDump, 0, len(jobs)),
+		Workers:              make([]WorkerDump, 0, len(workers)),
+		PendingRegistrations: pending,
+	}
+	if dump.PendingRegistrations == nil {
+		dump.PendingRegistrations = []secrets.PendingRegistration{}
+	}
+
+	for _, job := range jobs {
+		shards, err := c.GetShardAssignments(ctx, job.ID)
+		if err != nil {
+			return nil, err
+		}
+		dump.Jobs = append(dump.Jobs, JobDump{
+			Job:    job,
+			Shards: SummarizeShards(shards, now),
+		})
+	}
+	for _, w := range workers {
+		wd := WorkerDump{Worker: w}
+		if m, err := c.GetWorkerMetrics(ctx, w.ID); err == nil {
+			wd.Metrics = m
+		}
+		dump.Workers = append(dump.Workers, wd)
+	}
+	return dump, nil
+}
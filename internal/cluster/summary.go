@@ -0,0 +1,93 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// JobSummary rolls up a job's shard manifests. It's computed and stored under
+// jobs/<id>/summary when the job is marked completed, and returned as
+// JobInfo.Summary from then on.
+type JobSummary struct {
+	Shards           int   `json:"shards"`
+	ShardsDone       int   `json:"shards_done"` // completed successfully
+	ShardsFailed     int   `json:"shards_failed"`
+	ShardsSkipped    int   `json:"shards_skipped"`
+	Records          int64 `json:"records"`
+	Bytes            int64 `json:"bytes"`
+	Chunks           int64 `json:"chunks"`
+	DeadLettered     int64 `json:"dead_lettered"`
+	ProcessingTimeNs int64 `json:"processing_time_ns"` // summed across shards
+	DurationNs       int64 `json:"duration_ns"`        // from job start to completion
+}
+
+func (c *etcdCluster) jobSummaryKey(jobID string) string {
+	return fmt.Sprintf("%s/jobs/%s/summary", c.Prefix(), jobID)
+}
+
+// summarizeJob totals the manifests of jobID's finished shards. Shards that
+// are still pending count toward Shards only.
+func (c *etcdCluster) summarizeJob(ctx context.Context, jobID string, completed time.Time) (*JobSummary, error) {
+	prefix := fmt.Sprintf("%s/jobs/%s/", c.Prefix(), jobID)
+	resp, err := c.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	type shardState struct{ done, failed bool }
+	shards := map[string]*shardState{}
+	sum := &JobSummary{}
+	var started time.Time
+	for _, kv := range resp.Kvs {
+		rest := strings.TrimPrefix(string(kv.Key), prefix)
+		if rest == "started" {
+			started, _ = time.Parse(time.RFC3339Nano, string(kv.Value))
+			continue
+		}
+		parts := strings.Split(rest, "/")
+		if len(parts) != 3 || parts[0] != "shards" {
+			continue
+		}
+		st := shards[parts[1]]
+		if st == nil {
+			st = &shardState{}
+			shards[parts[1]] = st
+		}
+		switch parts[2] {
+		case "failed":
+			st.failed = true
+		case "done":
+			var man ShardManifest
+			_ = json.Unmarshal(kv.Value, &man)
+			st.done = true
+			switch {
+			case man.Skipped:
+				sum.ShardsSkipped++
+			case man.Failed:
+				st.failed = true
+			default:
+				sum.ShardsDone++
+			}
+			sum.Records += man.Records
+			sum.Bytes += man.Bytes
+			sum.Chunks += int64(man.Chunks)
+			sum.DeadLettered += man.DeadLettered
+			sum.ProcessingTimeNs += man.ProcessingTimeNs
+		}
+	}
+	sum.Shards = len(shards)
+	for _, st := range shards {
+		if st.failed {
+			sum.ShardsFailed++
+		}
+	}
+	if !started.IsZero() {
+		sum.DurationNs = completed.Sub(started).Nanoseconds()
+	}
+	return sum, nil
+}
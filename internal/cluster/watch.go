@@ -0,0 +1,112 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// JobEvent is a change to a job or one of its shards, as reported by
+// WatchJob. Field names the key that changed: a job field such as "status"
+// or "completed" when ShardID is nil, otherwise a shard field such as
+// "assignment", "done", "failed" or "progress".
+type JobEvent struct {
+	JobID    string   `json:"job_id"`
+	ShardID  *int     `json:"shard_id,omitempty"`
+	Field    string   `json:"field"`
+	Deleted  bool     `json:"deleted,omitempty"`
+	Status   JobState `json:"status,omitempty"` // set for "status" events
+	Revision int64    `json:"revision"`
+}
+
+// Terminal reports whether the job can't change state any further.
+func (s JobState) Terminal() bool {
+	return s == JobStateCompleted || s == JobStateCancelled || s == JobStateFailed
+}
+
+// WatchJob streams changes to jobID and its shards until the job completes,
+// fails or is cancelled, or ctx is done, then closes the channel. The first
+// event always carries the job's current status, so a job that has already
+// finished yields it and nothing more.
+func (c *etcdCluster) WatchJob(ctx context.Context, jobID string) (<-chan JobEvent, error) {
+	prefix := fmt.Sprintf("%s/jobs/%s/", c.Prefix(), jobID)
+	resp, err := c.client.Get(ctx, prefix+"status")
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, fmt.Errorf("job %q not found", jobID)
+	}
+	status := JobState(resp.Kvs[0].Value)
+
+	ctx, cancel := context.WithCancel(ctx)
+	wch := c.client.Watch(clientv3.WithRequireLeader(ctx), prefix,
+		clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+	events := make(chan JobEvent, 64)
+	go func() {
+		defer close(events)
+		defer cancel()
+		send := func(ev JobEvent) bool {
+			select {
+			case events <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if !send(JobEvent{JobID: jobID, Field: "status", Status: status, Revision: resp.Header.Revision}) || status.Terminal() {
+			return
+		}
+		for wresp := range wch {
+			if wresp.Err() != nil {
+				return
+			}
+			finished := false
+			// The rest of a transaction that finished the job, like its
+			// summary, is still sent
+			for _, ev := range wresp.Events {
+				je, ok := parseJobEvent(jobID, strings.TrimPrefix(string(ev.Kv.Key), prefix), ev)
+				if !ok {
+					continue
+				}
+				if !send(je) {
+					return
+				}
+				if je.Status.Terminal() {
+					finished = true
+				}
+			}
+			if finished {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// parseJobEvent describes ev, a change to key relative to the job's prefix.
+func parseJobEvent(jobID, key string, ev *clientv3.Event) (JobEvent, bool) {
+	je := JobEvent{JobID: jobID, Deleted: ev.Type == clientv3.EventTypeDelete, Revision: ev.Kv.ModRevision}
+	parts := strings.Split(key, "/")
+	switch {
+	case len(parts) == 1:
+		je.Field = parts[0]
+		if je.Field == "status" && !je.Deleted {
+			je.Status = JobState(ev.Kv.Value)
+		}
+	case len(parts) == 3 && parts[0] == "shards":
+		shardID, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return JobEvent{}, false
+		}
+		je.ShardID = &shardID
+		je.Field = parts[2]
+	default:
+		return JobEvent{}, false
+	}
+	return je, true
+}
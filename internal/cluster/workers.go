@@ -2,7 +2,7 @@ package cluster
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"path"
 	"strings"
@@ -17,8 +17,40 @@ type WorkerInfo struct {
 	ID       string
 	Host     string
 	LastSeen time.Time
+
+	// LogEndpoint is the URL of the worker's recent-log endpoint, if it
+	// exposes one.
+	LogEndpoint string `json:",omitempty"`
+
+	// Capacity is the most shards the worker may hold at once; AssignShard
+	// refuses it more with ErrWorkerAtCapacity. 0 = unlimited.
+	Capacity int `json:",omitempty"`
+
+	// Activity lists the shards the worker reported processing in its last
+	// heartbeat. Empty means the worker was idle.
+	Activity []ShardActivity `json:",omitempty"`
+}
+
+// ShardActivity is a worker's progress through one shard, as of its last
+// heartbeat.
+type ShardActivity struct {
+	JobID     string    `json:"job_id"`
+	ShardID   int       `json:"shard_id"`
+	IndexFrom int64     `json:"index_from"`
+	IndexTo   int64     `json:"index_to"`  // exclusive
+	Processed int64     `json:"processed"` // entries handed to the pipeline so far
+	StartedAt time.Time `json:"started_at"`
 }
 
+// WorkerLiveWindow is how recently a worker must have heartbeated to be
+// considered live. Registering an ID whose last heartbeat falls within this
+// window fails with ErrWorkerIDInUse.
+const WorkerLiveWindow = 45 * time.Second
+
+// ErrWorkerIDInUse is returned by RegisterWorker when another live worker is
+// already registered under the requested ID.
+var ErrWorkerIDInUse = errors.New("worker id already in use by a live worker")
+
 func (c *etcdCluster) RegisterWorker(ctx context.Context, info WorkerInfo) (string, error) {
 	workerID := info.ID
 	if workerID == "" {
@@ -26,24 +58,77 @@ func (c *etcdCluster) RegisterWorker(ctx context.Context, info WorkerInfo) (stri
 		info.ID = workerID
 	}
 	key := path.Join(c.Prefix(), "workers", workerID)
-	val, _ := json.Marshal(info)
+	val, err := c.encodeWorkerInfo(info)
+	if err != nil {
+		return "", err
+	}
+
+	// Refuse to take over an ID that another process is still heartbeating
+	// under, otherwise both would silently clobber each other's liveness and
+	// metrics. A stale registration (e.g. left behind by a crashed worker) is
+	// replaced.
+	var lastSeenRev int64
+	resp, err := c.client.Get(ctx, key+"/last_seen")
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) > 0 {
+		kv := resp.Kvs[0]
+		if t, err := time.Parse(time.RFC3339Nano, string(kv.Value)); err == nil && time.Since(t) < WorkerLiveWindow {
+			return "", fmt.Errorf("%w: %s (last seen %s)", ErrWorkerIDInUse, workerID, t.Format(time.RFC3339))
+		}
+		lastSeenRev = kv.ModRevision
+	}
 
 	lease, err := c.client.Grant(ctx, 150)
 	if err != nil {
 		return "", err
 	}
 	now := time.Now().UTC().Format(time.RFC3339Nano)
-	txn := c.client.Txn(ctx).Then(
+	txn := c.client.Txn(ctx).If(
+		clientv3.Compare(clientv3.ModRevision(key+"/last_seen"), "=", lastSeenRev),
+	).Then(
 		clientv3.OpPut(key, string(val), clientv3.WithLease(lease.ID)),
 		clientv3.OpPut(key+"/last_seen", now, clientv3.WithLease(lease.ID)),
 	)
-	_, err = txn.Commit()
+	txnResp, err := txn.Commit()
 	if err != nil {
 		return "", err
 	}
+	if !txnResp.Succeeded {
+		_, _ = c.client.Revoke(ctx, lease.ID)
+		// Another process registered or heartbeated this ID since we checked.
+		return "", fmt.Errorf("%w: %s", ErrWorkerIDInUse, workerID)
+	}
 	return workerID, nil
 }
 
+// UnregisterWorker removes workerID's registration by revoking its lease, so
+// the ID can be registered again straight away, e.g. by the same worker
+// restarting, rather than only once WorkerLiveWindow has passed. Capacity
+// claims share the lease and go with it; stored metrics are kept.
+func (c *etcdCluster) UnregisterWorker(ctx context.Context, workerID string) error {
+	key := path.Join(c.Prefix(), "workers", workerID)
+	resp, err := c.client.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil
+	}
+	if lease := clientv3.LeaseID(resp.Kvs[0].Lease); lease != clientv3.NoLease {
+		if _, err := c.client.Revoke(ctx, lease); err == nil {
+			return nil
+		}
+		// The lease may have just expired; make sure the keys are gone
+	}
+	_, err = c.client.Txn(ctx).Then(
+		clientv3.OpDelete(key),
+		clientv3.OpDelete(key+"/last_seen"),
+	).Commit()
+	return err
+}
+
 func (c *etcdCluster) ListWorkers(ctx context.Context) ([]WorkerInfo, error) {
 	prefix := path.Join(c.Prefix(), "workers") + "/"
 	resp, err := c.client.Get(ctx, prefix, clientv3.WithPrefix())
@@ -79,7 +164,7 @@ func (c *etcdCluster) ListWorkers(ctx context.Context) ([]WorkerInfo, error) {
 		}
 
 		var info WorkerInfo
-		if err := json.Unmarshal(kv.Value, &info); err == nil {
+		if err := decodeWorkerInfo(kv.Value, &info); err == nil {
 			workers[info.ID] = &info
 		}
 	}
@@ -91,7 +176,10 @@ func (c *etcdCluster) ListWorkers(ctx context.Context) ([]WorkerInfo, error) {
 	return result, nil
 }
 
-func (c *etcdCluster) HeartbeatWorker(ctx context.Context, workerID string) error {
+// HeartbeatWorker refreshes the worker's liveness and records the shards it
+// is currently processing in its worker record, replacing whatever the
+// previous heartbeat reported. Passing no activity marks the worker idle.
+func (c *etcdCluster) HeartbeatWorker(ctx context.Context, workerID string, activity ...ShardActivity) error {
 	key := path.Join(c.Prefix(), "workers", workerID)
 	now := time.Now().UTC().Format(time.RFC3339Nano)
 	resp, err := c.client.Get(ctx, key)
@@ -102,7 +190,19 @@ func (c *etcdCluster) HeartbeatWorker(ctx context.Context, workerID string) erro
 		return fmt.Errorf("worker %s not found", workerID)
 	}
 	leaseID := clientv3.LeaseID(resp.Kvs[0].Lease)
+
+	var info WorkerInfo
+	if err := decodeWorkerInfo(resp.Kvs[0].Value, &info); err != nil {
+		return fmt.Errorf("worker %s: corrupt record: %w", workerID, err)
+	}
+	info.Activity = activity
+	val, err := c.encodeWorkerInfo(info)
+	if err != nil {
+		return err
+	}
+
 	txn := c.client.Txn(ctx).Then(
+		clientv3.OpPut(key, string(val), clientv3.WithLease(leaseID)),
 		clientv3.OpPut(key+"/last_seen", now, clientv3.WithLease(leaseID)),
 	)
 	_, err = txn.Commit()
@@ -4,39 +4,120 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
+	"strings"
 
 	_ "embed"
 
+	"github.com/andybalholm/brotli"
 	"github.com/dsnet/compress/bzip2"
 	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
 )
 
+// DefaultLevel asks NewWriterLevel for the codec's default level: gzip's and
+// brotli's defaults, lz4's fast mode, and the best compression for bzip2 and
+// zstd.
+const DefaultLevel = 0
+
 // NewWriter returns an io.WriteCloser that wraps w with the requested compression.
-// Supported: "gzip", "bzip2", or "" (no compression).
+// Supported: "gzip", "bzip2", "zstd", "lz4", "xz", "brotli", or "" (no
+// compression).
 func NewWriter(w io.WriteCloser, compression string) (io.WriteCloser, error) {
+	return NewWriterLevel(w, compression, DefaultLevel)
+}
+
+// NewWriterLevel is like NewWriter, but compresses at the given level, from
+// 1 (fastest) to 9 for gzip, bzip2 and lz4, 11 for brotli, or 22 for zstd.
+// xz takes no level.
+// See ValidateLevel.
+func NewWriterLevel(w io.WriteCloser, compression string, level int) (io.WriteCloser, error) {
+	if err := ValidateLevel(compression, level); err != nil {
+		return nil, err
+	}
+
 	var compressor io.WriteCloser
 	var err error
 
 	switch compression {
 	case "gzip":
-		compressor, err = gzip.NewWriter(w), nil
+		if level == DefaultLevel {
+			level = gzip.DefaultCompression
+		}
+		compressor, err = gzip.NewWriterLevel(w, level)
 	case "bzip2":
-		compressor, err = bzip2.NewWriter(w, &bzip2.WriterConfig{Level: bzip2.BestCompression})
+		if level == DefaultLevel {
+			level = bzip2.BestCompression
+		}
+		compressor, err = bzip2.NewWriter(w, &bzip2.WriterConfig{Level: level})
 	case "zstd":
-		compressor, err = zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		encLevel := zstd.SpeedBestCompression
+		if level != DefaultLevel {
+			encLevel = zstd.EncoderLevelFromZstd(level)
+		}
+		compressor, err = zstd.NewWriter(w, zstd.WithEncoderLevel(encLevel))
+	case "lz4":
+		lw := lz4.NewWriter(w)
+		if level != DefaultLevel {
+			err = lw.Apply(lz4.CompressionLevelOption(lz4Levels[level-1]))
+		}
+		compressor = lw
+	case "xz":
+		compressor, err = xz.NewWriter(w)
+	case "brotli":
+		if level == DefaultLevel {
+			level = brotli.DefaultCompression
+		}
+		compressor = brotli.NewWriterLevel(w, level)
 	case "", "none":
-		compressor, err = nopWriteCloser{w}, nil
+		compressor = nopWriteCloser{w}
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
 	}
 
-	if err != nil || compressor == nil {
-		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	if err != nil {
+		return nil, fmt.Errorf("%s compression: %w", compression, err)
 	}
 
 	return &cascadeWriteCloser{compressor, w}, nil
 }
 
+// ValidateLevel checks that level is DefaultLevel or within the range the
+// codec supports. No compression takes no level.
+func ValidateLevel(compression string, level int) error {
+	if level == DefaultLevel {
+		return nil
+	}
+	max := 0
+	switch compression {
+	case "gzip", "bzip2", "lz4":
+		max = 9
+	case "brotli":
+		max = brotli.BestCompression
+	case "zstd":
+		max = 22
+	case "xz":
+		return fmt.Errorf("%s compression doesn't take a level", compression)
+	case "", "none":
+		return fmt.Errorf("compression level %d given without a compression", level)
+	default:
+		return fmt.Errorf("unsupported compression: %s", compression)
+	}
+	if level < 1 || level > max {
+		return fmt.Errorf("%s compression level %d out of range (1-%d)", compression, level, max)
+	}
+	return nil
+}
+
+// lz4Levels maps levels 1-9 to lz4's.
+var lz4Levels = []lz4.CompressionLevel{
+	lz4.Level1, lz4.Level2, lz4.Level3, lz4.Level4, lz4.Level5,
+	lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9,
+}
+
 // NewReader returns an io.Reader that wraps w with the requested compression.
-// Supported: "gzip", "bzip2", or "" (no compression).
+// Supported: "gzip", "bzip2", "zstd", "lz4", "xz", "brotli", or "" (no
+// compression).
 func NewReader(r io.Reader, compression string) (io.Reader, error) {
 	switch compression {
 	case "gzip":
@@ -45,9 +126,56 @@ func NewReader(r io.Reader, compression string) (io.Reader, error) {
 		return bzip2.NewReader(r, &bzip2.ReaderConfig{})
 	case "zstd":
 		return zstd.NewReader(r)
+	case "lz4":
+		return lz4.NewReader(r), nil
+	case "xz":
+		return xz.NewReader(r)
+	case "brotli":
+		return brotli.NewReader(r), nil
 	case "", "none":
 		return r, nil
 	default:
 		return nil, fmt.Errorf("unsupported compression: %s", compression)
 	}
 }
+
+// codecs lists the supported codecs, for matching file extensions.
+var codecs = []string{"gzip", "bzip2", "zstd", "lz4", "xz", "brotli"}
+
+// CodecForName returns the codec a file name's extension implies, e.g. "zstd"
+// for "chunk.jsonl.zst" or "brotli" for "chunk.jsonl.br", or "" for no
+// compression.
+func CodecForName(name string) string {
+	for _, c := range codecs {
+		if strings.HasSuffix(name, Extension(c)) {
+			return c
+		}
+	}
+	return ""
+}
+
+// NewReaderForName is like NewReader, with the codec picked by
+// CodecForName(name). Unrecognized extensions are read as is.
+func NewReaderForName(r io.Reader, name string) (io.Reader, error) {
+	return NewReader(r, CodecForName(name))
+}
+
+// Extension returns the conventional file extension for the given compression,
+// including the leading dot, or "" for no compression.
+func Extension(compression string) string {
+	switch compression {
+	case "gzip":
+		return ".gz"
+	case "bzip2":
+		return ".bz2"
+	case "zstd":
+		return ".zst"
+	case "lz4":
+		return ".lz4"
+	case "xz":
+		return ".xz"
+	case "brotli":
+		return ".br"
+	}
+	return ""
+}
@@ -1,7 +1,12 @@
 package compression
 
 import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
 	"io"
+	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/chtzvt/certslurp/internal/testutil"
@@ -109,7 +114,232 @@ func TestNewWriter_None(t *testing.T) {
 func TestNewWriter_Unsupported(t *testing.T) {
 	var buf testutil.WriteCloserBuffer
 	_, err := NewWriter(&buf, "lzma")
-	if err == nil {
-		t.Error("Expected error for unsupported compression, got nil")
+	if err == nil || err.Error() != "unsupported compression: lzma" {
+		t.Errorf("Expected unsupported compression error, got %v", err)
+	}
+}
+
+func TestExtension(t *testing.T) {
+	for comp, want := range map[string]string{"": "", "none": "", "gzip": ".gz", "bzip2": ".bz2", "zstd": ".zst", "lz4": ".lz4", "xz": ".xz", "brotli": ".br"} {
+		if got := Extension(comp); got != want {
+			t.Errorf("Extension(%q) = %q, want %q", comp, got, want)
+		}
+	}
+}
+
+func compressedSize(t *testing.T, comp string, level int, data []byte) int {
+	t.Helper()
+	var buf testutil.WriteCloserBuffer
+	w, err := NewWriterLevel(&buf, comp, level)
+	if err != nil {
+		t.Fatalf("NewWriterLevel(%s, %d): %v", comp, level, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write %s level %d: %v", comp, level, err)
+	}
+	w.Close()
+	size := buf.Len()
+
+	r, err := NewReader(&buf, comp)
+	if err != nil {
+		t.Fatalf("NewReader %s: %v", comp, err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll %s level %d: %v", comp, level, err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("%s level %d: decompressed output doesn't match", comp, level)
+	}
+	return size
+}
+
+func TestNewWriterLevel(t *testing.T) {
+	// Compressible, but not trivially so: repeated hostnames in varying order
+	rng := rand.New(rand.NewSource(1))
+	var data bytes.Buffer
+	for data.Len() < 1<<20 {
+		fmt.Fprintf(&data, "host-%d.example.com,%d\n", rng.Intn(20000), rng.Intn(1000))
+	}
+
+	for comp, levels := range map[string][2]int{
+		"gzip":   {1, 9},
+		"bzip2":  {1, 9},
+		"zstd":   {1, 19},
+		"lz4":    {1, 9},
+		"brotli": {1, 11},
+	} {
+		fast := compressedSize(t, comp, levels[0], data.Bytes())
+		best := compressedSize(t, comp, levels[1], data.Bytes())
+		if best >= fast {
+			t.Errorf("%s: level %d gave %d bytes, level %d gave %d", comp, levels[1], best, levels[0], fast)
+		}
+		compressedSize(t, comp, DefaultLevel, data.Bytes())
+	}
+	for level := 1; level <= 22; level++ {
+		compressedSize(t, "zstd", level, []byte("every level decompresses"))
+	}
+}
+
+func TestValidateLevel(t *testing.T) {
+	for _, tc := range []struct {
+		comp  string
+		level int
+		ok    bool
+	}{
+		{"gzip", DefaultLevel, true},
+		{"gzip", 9, true},
+		{"gzip", 10, false},
+		{"bzip2", -1, false},
+		{"zstd", 22, true},
+		{"zstd", 23, false},
+		{"", DefaultLevel, true},
+		{"none", 3, false},
+		{"lzma", 3, false},
+		{"xz", DefaultLevel, true},
+		{"xz", 6, false},
+		{"lz4", 9, true},
+		{"lz4", 10, false},
+		{"brotli", 11, true},
+		{"brotli", 12, false},
+	} {
+		err := ValidateLevel(tc.comp, tc.level)
+		if (err == nil) != tc.ok {
+			t.Errorf("ValidateLevel(%q, %d) = %v", tc.comp, tc.level, err)
+		}
+	}
+	var buf testutil.WriteCloserBuffer
+	if _, err := NewWriterLevel(&buf, "gzip", 12); err == nil {
+		t.Error("expected an error for an out of range level")
+	}
+}
+
+func TestRoundTrip_AllCodecs(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	var text bytes.Buffer
+	for text.Len() < 3<<20 {
+		fmt.Fprintf(&text, "host-%d.example.com,%d\n", rng.Intn(20000), rng.Intn(1000))
+	}
+	random := make([]byte, 200<<10)
+	rng.Read(random)
+
+	payloads := map[string][]byte{
+		"empty":  {},
+		"short":  []byte("hello"),
+		"text":   text.Bytes(), // spans several lz4 blocks and brotli windows
+		"random": random,       // incompressible
+		"runs":   bytes.Repeat([]byte{'a'}, 100000),
+	}
+	for _, comp := range []string{"", "none", "gzip", "bzip2", "zstd", "lz4", "xz", "brotli"} {
+		for name, data := range payloads {
+			var buf testutil.WriteCloserBuffer
+			w, err := NewWriter(&buf, comp)
+			if err != nil {
+				t.Fatalf("NewWriter %q: %v", comp, err)
+			}
+			// Uneven writes exercise the writers' buffering
+			for p := data; len(p) > 0; {
+				n := min(len(p), 1+rng.Intn(70000))
+				if _, err := w.Write(p[:n]); err != nil {
+					t.Fatalf("%q/%s: Write: %v", comp, name, err)
+				}
+				p = p[n:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("%q/%s: Close: %v", comp, name, err)
+			}
+
+			r, err := NewReader(&buf, comp)
+			if err != nil {
+				t.Fatalf("NewReader %q: %v", comp, err)
+			}
+			out, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%q/%s: ReadAll: %v", comp, name, err)
+			}
+			if !bytes.Equal(out, data) {
+				t.Errorf("%q/%s: round trip mismatch (%d bytes in, %d out)", comp, name, len(data), len(out))
+			}
+		}
+	}
+}
+
+func TestNewReader_Unsupported(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader(nil), "lzma"); err == nil || !strings.Contains(err.Error(), "lzma") {
+		t.Errorf("expected an error naming the codec, got %v", err)
+	}
+}
+
+func TestNewReader_Brotli(t *testing.T) {
+	// "Hello, world! Hello, world!", compressed by the reference encoder
+	data, _ := hex.DecodeString("1b1a00008c946ed6540dc2825426d942de6a9668ea996c961e00")
+	r, err := NewReaderForName(bytes.NewReader(data), "chunk.jsonl.br")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "Hello, world! Hello, world!" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestCodecForName(t *testing.T) {
+	cases := map[string]string{
+		"chunk.jsonl.gz":        "gzip",
+		"chunk.jsonl.bz2":       "bzip2",
+		"chunk.jsonl.zst":       "zstd",
+		"chunk.jsonl.lz4":       "lz4",
+		"chunk.jsonl.br":        "brotli",
+		"chunk.jsonl.xz":        "xz",
+		"/data/out/chunk.jsonl": "",
+		"chunk.csv":             "",
+		"chunk.tar":             "",
+		"-":                     "",
+		"":                      "",
+	}
+	for name, want := range cases {
+		if got := CodecForName(name); got != want {
+			t.Errorf("CodecForName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNewReaderForName(t *testing.T) {
+	data := []byte("{\"a\":1}\n{\"a\":2}\n")
+	for _, comp := range []string{"", "gzip", "bzip2", "zstd", "lz4", "xz", "brotli"} {
+		var buf testutil.WriteCloserBuffer
+		w, err := NewWriter(&buf, comp)
+		if err != nil {
+			t.Fatalf("NewWriter %q: %v", comp, err)
+		}
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatalf("%q: Close: %v", comp, err)
+		}
+
+		name := "chunk.jsonl" + Extension(comp)
+		r, err := NewReaderForName(&buf, name)
+		if err != nil {
+			t.Fatalf("NewReaderForName %q: %v", name, err)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%q: ReadAll: %v", name, err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Errorf("%q: got %q, want %q", name, out, data)
+		}
+	}
+
+	// Unknown extensions pass through untouched
+	r, err := NewReaderForName(bytes.NewReader(data), "chunk.dat")
+	if err != nil {
+		t.Fatalf("NewReaderForName: %v", err)
+	}
+	if out, _ := io.ReadAll(r); !bytes.Equal(out, data) {
+		t.Errorf("chunk.dat: got %q, want %q", out, data)
 	}
 }
@@ -0,0 +1,133 @@
+package etl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/chtzvt/certslurp/internal/compression"
+	"github.com/chtzvt/certslurp/internal/sink"
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// DeadLetterRecord is a raw log entry that failed extraction or
+// transformation, written as one JSON line so it can be redriven once the
+// cause is fixed.
+type DeadLetterRecord struct {
+	Stage string          `json:"stage"` // "extract" or "transform"
+	Error string          `json:"error"`
+	Entry *ct.RawLogEntry `json:"entry"`
+}
+
+// DeadLetterName returns the dead-letter output name for a pipeline base name.
+func DeadLetterName(baseName string) string {
+	return baseName + ".deadletter"
+}
+
+// deadLetterName names the pipeline's dead-letter output. Resumed runs of a
+// shard append their generation, e.g. <base>.g1.deadletter.
+func (p *Pipeline) deadLetterName() string {
+	if p.Generation > 0 {
+		return DeadLetterName(fmt.Sprintf("%s.g%d", p.BaseName, p.Generation))
+	}
+	return DeadLetterName(p.BaseName)
+}
+
+// deadLetterWriter lazily opens the dead-letter output on the first failure,
+// so shards without failures don't produce empty files.
+type deadLetterWriter struct {
+	sink        sink.Sink
+	name        string
+	compression string
+	level       int
+	w           io.WriteCloser
+	count       int
+}
+
+func (d *deadLetterWriter) write(ctx context.Context, stage string, cause error, entry *ct.RawLogEntry) error {
+	if d.w == nil {
+		sw, err := d.sink.Open(ctx, d.name)
+		if err != nil {
+			return err
+		}
+		w, err := compression.NewWriterLevel(sw, d.compression, d.level)
+		if err != nil {
+			sw.Close()
+			return err
+		}
+		d.w = w
+	}
+	line, err := json.Marshal(DeadLetterRecord{Stage: stage, Error: cause.Error(), Entry: entry})
+	if err != nil {
+		return err
+	}
+	if _, err := d.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	d.count++
+	return nil
+}
+
+func (d *deadLetterWriter) close() error {
+	if d.w == nil {
+		return nil
+	}
+	err := d.w.Close()
+	d.w = nil
+	return err
+}
+
+// Redrive reads dead-letter records from r and runs their entries back through
+// the pipeline, returning the number of entries redriven. Entries that fail
+// again are dead-lettered anew if the pipeline has a dead-letter sink.
+func Redrive(ctx context.Context, p *Pipeline, r io.Reader) (int, error) {
+	return processRecords(ctx, p, r, "dead-letter record")
+}
+
+// Reprocess reads the output of a job that used the raw_entry extractor and
+// the jsonl transformer from r, and runs its entries through the pipeline
+// as if they had just been fetched from the log. It returns the number of
+// entries reprocessed.
+func Reprocess(ctx context.Context, p *Pipeline, r io.Reader) (int, error) {
+	return processRecords(ctx, p, r, "raw entry record")
+}
+
+// processRecords streams the entries of JSON records with an "entry" field,
+// such as dead-letter records or raw_entry output, through the pipeline.
+func processRecords(ctx context.Context, p *Pipeline, r io.Reader, kind string) (int, error) {
+	entries := make(chan *ct.RawLogEntry, 32)
+	done := make(chan error, 1)
+	go func() { done <- p.StreamProcess(ctx, entries) }()
+
+	var n int
+	var readErr error
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var rec DeadLetterRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			readErr = fmt.Errorf("%s %d: %w", kind, n+1, err)
+			break
+		}
+		if rec.Entry == nil {
+			readErr = fmt.Errorf("%s %d: missing entry", kind, n+1)
+			break
+		}
+		select {
+		case entries <- rec.Entry:
+			n++
+		case err := <-done:
+			// The pipeline stopped early; report its error
+			return n, err
+		}
+	}
+	close(entries)
+
+	if err := <-done; err != nil {
+		return n, err
+	}
+	return n, readErr
+}
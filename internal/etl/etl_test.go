@@ -3,10 +3,15 @@ package etl
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/compression"
 	"github.com/chtzvt/certslurp/internal/etl_core"
@@ -14,8 +19,10 @@ import (
 	"github.com/chtzvt/certslurp/internal/job"
 	"github.com/chtzvt/certslurp/internal/secrets"
 	"github.com/chtzvt/certslurp/internal/sink"
+	"github.com/chtzvt/certslurp/internal/testutil"
 	"github.com/chtzvt/certslurp/internal/transformer"
 	ct "github.com/google/certificate-transparency-go"
+	"github.com/parquet-go/parquet-go"
 	"github.com/stretchr/testify/require"
 )
 
@@ -61,6 +68,16 @@ func (w *mockWriter) Close() error {
 	return nil
 }
 
+// chunkInfos describes the chunks a mockSink received, as Stats.Outputs should.
+func chunkInfos(chunks []record) []ChunkInfo {
+	var infos []ChunkInfo
+	for _, c := range chunks {
+		sum := sha256.Sum256(c.Data)
+		infos = append(infos, ChunkInfo{Name: c.Name, Bytes: int64(len(c.Data)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	return infos
+}
+
 // --- Actual test ---
 
 func TestPipeline_ChunkingByRecordsAndBytes(t *testing.T) {
@@ -116,6 +133,364 @@ func TestPipeline_ChunkingByRecordsAndBytes(t *testing.T) {
 	require.Equal(t, "012", string(ms.Chunks[0].Data))
 	require.Equal(t, "345", string(ms.Chunks[1].Data))
 	require.Equal(t, "6", string(ms.Chunks[2].Data))
+	require.Equal(t, Stats{Records: 7, Bytes: 7, Chunks: 3, Outputs: chunkInfos(ms.Chunks)}, pipeline.Stats)
+}
+
+func TestPipeline_FanOutSinks(t *testing.T) {
+	extractor.Register("fake", &fakeExtractor{})
+	transformer.Register("fake", &fakeTransformer{})
+	primary, mirror := &mockSink{}, &mockSink{}
+	var mirrorOpts map[string]interface{}
+	sink.Register("mock-fan-primary", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return primary, nil
+	})
+	sink.Register("mock-fan-mirror", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		mirrorOpts = opts
+		return mirror, nil
+	})
+
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:    "fake",
+				Transformer:  "fake",
+				Sink:         "mock-fan-primary",
+				SinkOptions:  map[string]interface{}{"compression": "gzip"},
+				Sinks:        []job.SinkSpec{{Name: "mock-fan-mirror", Options: map[string]interface{}{"dir": "/verify"}}},
+				ChunkRecords: 3,
+			},
+		},
+	}
+	pipeline, err := NewPipeline(spec, &secrets.Store{}, "fanout")
+	require.NoError(t, err)
+	// The mirror is told about the compression its output will carry
+	require.Equal(t, map[string]interface{}{"dir": "/verify", "compression": "gzip"}, mirrorOpts)
+
+	entries := make(chan *ct.RawLogEntry, 5)
+	for i := 0; i < 5; i++ {
+		entries <- &ct.RawLogEntry{Index: int64(i), Cert: ct.ASN1Cert{Data: []byte(strconv.Itoa(i))}}
+	}
+	close(entries)
+	require.NoError(t, pipeline.StreamProcess(context.Background(), entries))
+
+	require.Len(t, primary.Chunks, 2)
+	require.Equal(t, primary.Chunks, mirror.Chunks)
+	r, err := compression.NewReader(bytes.NewReader(mirror.Chunks[0].Data), "gzip")
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "012", string(data))
+
+	// Sinks alone work too, and must agree on compression
+	spec.Options.Output.Sink, spec.Options.Output.SinkOptions = "", nil
+	spec.Options.Output.Sinks = []job.SinkSpec{{Name: "mock-fan-primary"}, {Name: "mock-fan-mirror", Options: map[string]interface{}{"compression": "zstd"}}}
+	_, err = NewPipeline(spec, &secrets.Store{}, "fanout")
+	require.ErrorContains(t, err, "compression")
+	spec.Options.Output.Sinks[1].Options["compression"] = "none"
+	_, err = NewPipeline(spec, &secrets.Store{}, "fanout")
+	require.NoError(t, err)
+
+	// Chunks are compressed once, so the level can't differ either
+	spec.Options.Output.Sinks[1].Options["compression_level"] = 3
+	_, err = NewPipeline(spec, &secrets.Store{}, "fanout")
+	require.ErrorContains(t, err, "compression_level")
+}
+
+func TestPipeline_SortByIndex(t *testing.T) {
+	extractor.Register("fake", &fakeExtractor{})
+	transformer.Register("fake", &fakeTransformer{})
+	ms := &mockSink{}
+	sink.Register("mock-sorted", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return ms, nil
+	})
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:    "fake",
+				Transformer:  "fake",
+				Sink:         "mock-sorted",
+				ChunkRecords: 3,
+				SortByIndex:  true,
+			},
+		},
+	}
+	pipeline, err := NewPipeline(spec, &secrets.Store{}, "sorted")
+	require.NoError(t, err)
+
+	// Out-of-order delivery, as from concurrent fetch workers
+	entries := make(chan *ct.RawLogEntry, 6)
+	for _, idx := range []int64{4, 1, 3, 0, 5, 2} {
+		entries <- &ct.RawLogEntry{Index: idx, Cert: ct.ASN1Cert{Data: []byte(strconv.FormatInt(idx, 10))}}
+	}
+	close(entries)
+	require.NoError(t, pipeline.StreamProcess(context.Background(), entries))
+
+	// Records are sorted within, not across, chunks
+	require.Len(t, ms.Chunks, 2)
+	require.Equal(t, "134", string(ms.Chunks[0].Data))
+	require.Equal(t, "025", string(ms.Chunks[1].Data))
+}
+
+type multiFieldExtractor struct{}
+
+func (m *multiFieldExtractor) Extract(ctx *etl_core.Context, raw *ct.RawLogEntry) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"cn":  string(raw.Cert.Data),
+		"dns": []string{string(raw.Cert.Data), "www." + string(raw.Cert.Data)},
+		"li":  raw.Index,
+		"nbf": time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func TestPipeline_MsgpackWithCompression(t *testing.T) {
+	extractor.Register("multi", &multiFieldExtractor{})
+	ms := &mockSink{}
+	sink.Register("mock-msgpack", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return ms, nil
+	})
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:          "multi",
+				Transformer:        "msgpack",
+				TransformerOptions: map[string]interface{}{"framing": "length"},
+				Sink:               "mock-msgpack",
+				SinkOptions:        map[string]interface{}{"compression": "zstd"},
+			},
+		},
+	}
+	pipeline, err := NewPipeline(spec, &secrets.Store{}, "msgpack")
+	require.NoError(t, err)
+
+	entries := make(chan *ct.RawLogEntry, 2)
+	entries <- &ct.RawLogEntry{Index: 10, Cert: ct.ASN1Cert{Data: []byte("a.example")}}
+	entries <- &ct.RawLogEntry{Index: 11, Cert: ct.ASN1Cert{Data: []byte("b.example")}}
+	close(entries)
+	require.NoError(t, pipeline.StreamProcess(context.Background(), entries))
+	require.Len(t, ms.Chunks, 1)
+
+	r, err := compression.NewReader(bytes.NewReader(ms.Chunks[0].Data), "zstd")
+	require.NoError(t, err)
+	raw, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	records, err := testutil.DecodeMsgpackRecords(raw, "length")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	for i, name := range []string{"a.example", "b.example"} {
+		require.Equal(t, map[string]interface{}{
+			"cn":  name,
+			"dns": []interface{}{name, "www." + name},
+			"li":  int64(10 + i),
+			"nbf": time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		}, records[i])
+	}
+}
+
+type subjectExtractor struct{}
+
+func (subjectExtractor) Extract(ctx *etl_core.Context, raw *ct.RawLogEntry) (map[string]interface{}, error) {
+	name := string(raw.Cert.Data)
+	return map[string]interface{}{
+		"cn":  name,
+		"sub": fmt.Sprintf(`CN=%s,O="Example, Inc."`, name),
+		"dns": []string{name, "www." + name},
+		"nbf": time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func TestPipeline_CSVHeaderAndRows(t *testing.T) {
+	extractor.Register("subject", subjectExtractor{})
+	ms := &mockSink{}
+	sink.Register("mock-csv", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return ms, nil
+	})
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:          "subject",
+				Transformer:        "csv",
+				TransformerOptions: map[string]interface{}{"columns": []interface{}{"cn", "sub", "dns", "nbf"}},
+				Sink:               "mock-csv",
+			},
+		},
+	}
+	pipeline, err := NewPipeline(spec, &secrets.Store{}, "csv")
+	require.NoError(t, err)
+
+	entries := make(chan *ct.RawLogEntry, 2)
+	entries <- &ct.RawLogEntry{Index: 0, Cert: ct.ASN1Cert{Data: []byte("a.example")}}
+	entries <- &ct.RawLogEntry{Index: 1, Cert: ct.ASN1Cert{Data: []byte("b.example")}}
+	close(entries)
+	require.NoError(t, pipeline.StreamProcess(context.Background(), entries))
+	require.Len(t, ms.Chunks, 1)
+
+	require.Equal(t, "cn,sub,dns,nbf\n"+
+		`a.example,"CN=a.example,O=""Example, Inc.""",a.example;www.a.example,2025-01-01T00:00:00Z`+"\n"+
+		`b.example,"CN=b.example,O=""Example, Inc.""",b.example;www.b.example,2025-01-01T00:00:00Z`+"\n",
+		string(ms.Chunks[0].Data))
+}
+
+func TestPipeline_JSONLRoundTripsCertFields(t *testing.T) {
+	ms := &mockSink{}
+	sink.Register("mock-jsonl", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return ms, nil
+	})
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:        "cert_fields",
+				ExtractorOptions: map[string]interface{}{"cert_fields": "*", "log_fields": "*"},
+				Transformer:      "jsonl",
+				Sink:             "mock-jsonl",
+			},
+		},
+	}
+	pipeline, err := NewPipeline(spec, &secrets.Store{}, "jsonl")
+	require.NoError(t, err)
+	pipeline.MaxChunkRecs = 3
+
+	raws := make([]*ct.RawLogEntry, 4)
+	for i := range raws {
+		raws[i] = testutil.RawLogEntryForTestCert(t, i)
+	}
+	entries := make(chan *ct.RawLogEntry, len(raws))
+	for _, raw := range raws {
+		entries <- raw
+	}
+	close(entries)
+	require.NoError(t, pipeline.StreamProcess(context.Background(), entries))
+	require.Len(t, ms.Chunks, 2)
+
+	var got []extractor.CertFieldsExtractorOutput
+	for _, chunk := range ms.Chunks {
+		require.True(t, bytes.HasSuffix(chunk.Data, []byte("\n")), "chunk %s must end in a newline", chunk.Name)
+		for _, line := range bytes.Split(bytes.TrimSuffix(chunk.Data, []byte("\n")), []byte("\n")) {
+			require.True(t, json.Valid(line), "invalid JSON line: %s", line)
+			var out extractor.CertFieldsExtractorOutput
+			require.NoError(t, json.Unmarshal(line, &out))
+			got = append(got, out)
+		}
+	}
+	require.Len(t, got, len(raws))
+
+	// Each record decodes to exactly what the extractor produced
+	for i, raw := range raws {
+		fields, err := pipeline.Extractor.Extract(pipeline.Ctx, raw)
+		require.NoError(t, err)
+		direct, err := json.Marshal(fields)
+		require.NoError(t, err)
+		var want extractor.CertFieldsExtractorOutput
+		require.NoError(t, json.Unmarshal(direct, &want))
+		require.Equal(t, want, got[i])
+		require.EqualValues(t, i, got[i].LogIndex)
+		require.False(t, got[i].LogTimestamp.IsZero())
+		require.NotEmpty(t, got[i].Subject)
+	}
+}
+
+func TestPipeline_ParquetChunks(t *testing.T) {
+	ms := &mockSink{}
+	sink.Register("mock-parquet", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return ms, nil
+	})
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:          "cert_fields",
+				ExtractorOptions:   map[string]interface{}{"cert_fields": "*", "log_fields": "*"},
+				Transformer:        "parquet",
+				TransformerOptions: map[string]interface{}{"codec": "gzip"},
+				Sink:               "mock-parquet",
+				ChunkRecords:       3,
+				SortByIndex:        true,
+			},
+		},
+	}
+	pipeline, err := NewPipeline(spec, &secrets.Store{}, "parquet")
+	require.NoError(t, err)
+
+	raws := make([]*ct.RawLogEntry, 4)
+	for i := range raws {
+		raws[i] = testutil.RawLogEntryForTestCert(t, i)
+	}
+	entries := make(chan *ct.RawLogEntry, len(raws))
+	for _, i := range []int{2, 0, 1, 3} {
+		entries <- raws[i]
+	}
+	close(entries)
+	require.NoError(t, pipeline.StreamProcess(context.Background(), entries))
+	require.Len(t, ms.Chunks, 2)
+	require.Equal(t, "parquet.0001", ms.Chunks[0].Name)
+
+	var rows []map[string]interface{}
+	for i, chunk := range ms.Chunks {
+		f, err := parquet.OpenFile(bytes.NewReader(chunk.Data), int64(len(chunk.Data)))
+		require.NoError(t, err)
+		require.True(t, parquet.EqualNodes(transformer.ParquetSchema, f.Schema()))
+		chunkRows, err := testutil.ReadParquetRows(chunk.Data)
+		require.NoError(t, err)
+		require.Len(t, chunkRows, []int{3, 1}[i])
+		rows = append(rows, chunkRows...)
+	}
+	require.Len(t, rows, len(raws))
+
+	for i, raw := range raws {
+		fields, err := pipeline.Extractor.Extract(pipeline.Ctx, raw)
+		require.NoError(t, err)
+		// Rows come out in log index order
+		require.EqualValues(t, i, rows[i]["li"])
+		require.Equal(t, fields["cn"], rows[i]["cn"])
+		require.Equal(t, fields["sn"], rows[i]["sn"])
+		require.Equal(t, fields["nbf"].(time.Time).UTC().Truncate(time.Microsecond), rows[i]["nbf"])
+		if dns, ok := fields["dns"].([]string); ok {
+			require.Equal(t, dns, rows[i]["dns"])
+		} else {
+			require.Nil(t, rows[i]["dns"])
+		}
+		require.Nil(t, rows[i]["err"])
+	}
+}
+
+func TestNewPipeline_ChunkTransformerRejectsChunkBytes(t *testing.T) {
+	sink.Register("mock-parquet-bytes", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return &mockSink{}, nil
+	})
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:   "cert_fields",
+				Transformer: "parquet",
+				Sink:        "mock-parquet-bytes",
+				ChunkBytes:  1 << 20,
+			},
+		},
+	}
+	_, err := NewPipeline(spec, &secrets.Store{}, "parquet")
+	require.ErrorContains(t, err, "chunk_bytes")
+
+	spec.Options.Output.ChunkBytes, spec.Options.Output.ChunkRecords = 0, 1000
+	_, err = NewPipeline(spec, &secrets.Store{}, "parquet")
+	require.NoError(t, err)
+}
+
+func TestNewPipeline_KafkaSinkRequiresJSONL(t *testing.T) {
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:   "cert_fields",
+				Transformer: "csv",
+				Sink:        "kafka",
+				SinkOptions: map[string]interface{}{"brokers": "localhost:9092", "topic": "certs"},
+			},
+		},
+	}
+	_, err := NewPipeline(spec, &secrets.Store{}, "kafka")
+	require.ErrorContains(t, err, "jsonl")
+
+	spec.Options.Output.Transformer = "jsonl"
+	_, err = NewPipeline(spec, &secrets.Store{}, "kafka")
+	require.NoError(t, err)
 }
 
 func TestPipeline_EmptyInput(t *testing.T) {
@@ -246,6 +621,45 @@ func TestPipeline_ChunkByRecordsOnly(t *testing.T) {
 	require.Equal(t, "4", string(ms.Chunks[2].Data))
 }
 
+func TestPipeline_ResumedChunkNumbering(t *testing.T) {
+	extractor.Register("fake-resume", &fakeExtractor{})
+	transformer.Register("fake-resume", &fakeTransformer{})
+	ms := &mockSink{}
+	sink.Register("mock-resume", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return ms, nil
+	})
+
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:    "fake-resume",
+				Transformer:  "fake-resume",
+				Sink:         "mock-resume",
+				ChunkRecords: 2,
+			},
+		},
+	}
+	pipeline, err := NewPipeline(spec, &secrets.Store{}, "resume")
+	require.NoError(t, err)
+	pipeline.ChunkOffset = 3
+	pipeline.Generation = 1
+	var closedAt []int64
+	pipeline.ChunkClosed = func(read int64) { closedAt = append(closedAt, read) }
+
+	entries := make(chan *ct.RawLogEntry, 3)
+	for i := 0; i < 3; i++ {
+		entries <- &ct.RawLogEntry{Cert: ct.ASN1Cert{Data: []byte(strconv.Itoa(i))}}
+	}
+	close(entries)
+
+	require.NoError(t, pipeline.StreamProcess(context.Background(), entries))
+	require.Len(t, ms.Chunks, 2)
+	require.Equal(t, "resume.0004", ms.Chunks[0].Name)
+	require.Equal(t, "resume.0005", ms.Chunks[1].Name)
+	require.Equal(t, []int64{2, 3}, closedAt)
+	require.Equal(t, "resume.g1.deadletter", pipeline.deadLetterName())
+}
+
 type errorExtractor struct{}
 
 func (e *errorExtractor) Extract(ctx *etl_core.Context, raw *ct.RawLogEntry) (map[string]interface{}, error) {
@@ -303,6 +717,70 @@ func TestPipeline_ExtractorError(t *testing.T) {
 	require.Contains(t, err.Error(), "extract fail")
 }
 
+type pickyExtractor struct{}
+
+func (p *pickyExtractor) Extract(ctx *etl_core.Context, raw *ct.RawLogEntry) (map[string]interface{}, error) {
+	if string(raw.Cert.Data) == "bad" {
+		return nil, fmt.Errorf("unparseable entry")
+	}
+	return map[string]interface{}{"val": "primary:" + string(raw.Cert.Data) + "\n"}, nil
+}
+
+type fallbackExtractor struct{}
+
+func (f *fallbackExtractor) Extract(ctx *etl_core.Context, raw *ct.RawLogEntry) (map[string]interface{}, error) {
+	return map[string]interface{}{"val": "fallback:" + string(raw.Cert.Data) + "\n"}, nil
+}
+
+func TestPipeline_FallbackExtractor(t *testing.T) {
+	extractor.Register("picky", &pickyExtractor{})
+	extractor.Register("fallback", &fallbackExtractor{})
+	transformer.Register("fake", &fakeTransformer{})
+	ms := &mockSink{}
+	sink.Register("mock-fallback", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return ms, nil
+	})
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:         "picky",
+				FallbackExtractor: "fallback",
+				Transformer:       "fake",
+				Sink:              "mock-fallback",
+			},
+		},
+	}
+	pipeline, err := NewPipeline(spec, &secrets.Store{}, "fallback")
+	require.NoError(t, err)
+
+	entries := make(chan *ct.RawLogEntry, 3)
+	for _, data := range []string{"a", "bad", "b"} {
+		entries <- &ct.RawLogEntry{Cert: ct.ASN1Cert{Data: []byte(data)}}
+	}
+	close(entries)
+	require.NoError(t, pipeline.StreamProcess(context.Background(), entries))
+
+	require.Len(t, ms.Chunks, 1)
+	require.Equal(t, "primary:a\nfallback:bad\nprimary:b\n", string(ms.Chunks[0].Data))
+}
+
+func TestPipeline_UnknownFallbackExtractor(t *testing.T) {
+	extractor.Register("fake", &fakeExtractor{})
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:         "fake",
+				FallbackExtractor: "does-not-exist",
+				Transformer:       "fake",
+				Sink:              "mock",
+			},
+		},
+	}
+	_, err := NewPipeline(spec, &secrets.Store{}, "x")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "fallback extractor")
+}
+
 func TestPipeline_TransformerError(t *testing.T) {
 	extractor.Register("fake", &fakeExtractor{})
 	transformer.Register("err-xform", &errorTransformer{})
@@ -368,6 +846,8 @@ func TestPipeline_StreamProcess_Compression(t *testing.T) {
 		{"gzip", "gzip"},
 		{"bzip2", "bzip2"},
 		{"zstd", "zstd"},
+		{"lz4", "lz4"},
+		{"brotli", "brotli"},
 	}
 
 	for _, tt := range tests {
@@ -422,3 +902,173 @@ func TestPipeline_StreamProcess_Compression(t *testing.T) {
 		})
 	}
 }
+
+func TestPipeline_DeadLetterAndRedrive(t *testing.T) {
+	extractor.Register("picky", &pickyExtractor{})
+	extractor.Register("fallback", &fallbackExtractor{})
+	transformer.Register("fake", &fakeTransformer{})
+	out := &mockSink{}
+	dead := &mockSink{}
+	sink.Register("mock-dl-out", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return out, nil
+	})
+	sink.Register("mock-dl-dead", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return dead, nil
+	})
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:             "picky",
+				Transformer:           "fake",
+				Sink:                  "mock-dl-out",
+				DeadLetterSink:        "mock-dl-dead",
+				DeadLetterSinkOptions: map[string]interface{}{"compression": "gzip"},
+			},
+		},
+	}
+	pipeline, err := NewPipeline(spec, &secrets.Store{}, "shard")
+	require.NoError(t, err)
+
+	entries := make(chan *ct.RawLogEntry, 4)
+	for i, data := range []string{"a", "bad", "b", "bad"} {
+		entries <- &ct.RawLogEntry{Index: int64(i), Cert: ct.ASN1Cert{Data: []byte(data)}}
+	}
+	close(entries)
+	require.NoError(t, pipeline.StreamProcess(context.Background(), entries))
+
+	// Failing entries are set aside rather than failing the stream
+	require.Len(t, out.Chunks, 1)
+	require.Equal(t, "primary:a\nprimary:b\n", string(out.Chunks[0].Data))
+	require.Len(t, dead.Chunks, 1)
+	require.Equal(t, DeadLetterName("shard"), dead.Chunks[0].Name)
+	require.Equal(t, Stats{Records: 2, Bytes: int64(len(out.Chunks[0].Data)), Chunks: 1, DeadLettered: 2, Outputs: chunkInfos(out.Chunks)}, pipeline.Stats)
+
+	// The dead-letter output is compressed like any sink output
+	r, err := compression.NewReader(bytes.NewReader(dead.Chunks[0].Data), "gzip")
+	require.NoError(t, err)
+	deadLetters, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Contains(t, string(deadLetters), `"stage":"extract"`)
+	require.Contains(t, string(deadLetters), `"error":"unparseable entry"`)
+
+	// After "fixing" the extractor, redrive lands the entries in the normal output
+	spec.Options.Output.Extractor = "fallback"
+	redrive, err := NewPipeline(spec, &secrets.Store{}, "shard.redrive")
+	require.NoError(t, err)
+	n, err := Redrive(context.Background(), redrive, bytes.NewReader(deadLetters))
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	require.Len(t, out.Chunks, 2)
+	require.Equal(t, "shard.redrive", out.Chunks[1].Name)
+	require.Equal(t, "fallback:bad\nfallback:bad\n", string(out.Chunks[1].Data))
+	require.Len(t, dead.Chunks, 1, "nothing should be dead-lettered again")
+}
+
+func TestPipeline_ReprocessRawEntries(t *testing.T) {
+	rawOut := &mockSink{}
+	certOut := &mockSink{}
+	sink.Register("mock-reprocess-raw", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return rawOut, nil
+	})
+	sink.Register("mock-reprocess-cert", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return certOut, nil
+	})
+	raws := make([]*ct.RawLogEntry, 4)
+	for i := range raws {
+		raws[i] = testutil.RawLogEntryForTestCert(t, i)
+	}
+	run := func(p *Pipeline) {
+		entries := make(chan *ct.RawLogEntry, len(raws))
+		for _, raw := range raws {
+			entries <- raw
+		}
+		close(entries)
+		require.NoError(t, p.StreamProcess(context.Background(), entries))
+	}
+
+	// The original job saves whole entries
+	rawSpec := &job.JobSpec{Options: job.JobOptions{Output: job.OutputOptions{
+		Extractor:   "raw_entry",
+		Transformer: "jsonl",
+		Sink:        "mock-reprocess-raw",
+	}}}
+	rawPipeline, err := NewPipeline(rawSpec, &secrets.Store{}, "raw")
+	require.NoError(t, err)
+	run(rawPipeline)
+	require.Len(t, rawOut.Chunks, 1)
+
+	// What a fresh fetch with the new extractor would produce
+	certSpec := &job.JobSpec{Options: job.JobOptions{Output: job.OutputOptions{
+		Extractor:        "cert_fields",
+		ExtractorOptions: map[string]interface{}{"cert_fields": "*", "log_fields": "*"},
+		Transformer:      "jsonl",
+		Sink:             "mock-reprocess-cert",
+	}}}
+	direct, err := NewPipeline(certSpec, &secrets.Store{}, "direct")
+	require.NoError(t, err)
+	run(direct)
+	require.Len(t, certOut.Chunks, 1)
+
+	// Reprocessing the saved entries matches it exactly
+	reprocess, err := NewPipeline(certSpec, &secrets.Store{}, "raw.reprocess")
+	require.NoError(t, err)
+	n, err := Reprocess(context.Background(), reprocess, bytes.NewReader(rawOut.Chunks[0].Data))
+	require.NoError(t, err)
+	require.Equal(t, len(raws), n)
+	require.Len(t, certOut.Chunks, 2)
+	require.Equal(t, "raw.reprocess", certOut.Chunks[1].Name)
+	require.Equal(t, string(certOut.Chunks[0].Data), string(certOut.Chunks[1].Data))
+	require.EqualValues(t, len(raws), reprocess.Stats.Records)
+
+	// Anything but raw entry records is rejected
+	_, err = Reprocess(context.Background(), reprocess, strings.NewReader(`{"cn":"example.com"}`+"\n"))
+	require.ErrorContains(t, err, "raw entry record 1: missing entry")
+}
+
+// Dead-letter records must round-trip the raw entry exactly, so a redriven
+// entry is indistinguishable from the one fetched from the log.
+func TestDeadLetterRecord_PreservesRawEntry(t *testing.T) {
+	entry := &ct.RawLogEntry{
+		Index: 42,
+		Leaf: ct.MerkleTreeLeaf{
+			LeafType: ct.TimestampedEntryLeafType,
+			TimestampedEntry: &ct.TimestampedEntry{
+				Timestamp: 1700000000000,
+				EntryType: ct.X509LogEntryType,
+				X509Entry: &ct.ASN1Cert{Data: []byte{0x30, 0x01, 0x02}},
+			},
+		},
+		Cert:  ct.ASN1Cert{Data: []byte{0x30, 0x01, 0x02}},
+		Chain: []ct.ASN1Cert{{Data: []byte{0x30, 0x03}}},
+	}
+	line, err := json.Marshal(DeadLetterRecord{Stage: "transform", Error: "boom", Entry: entry})
+	require.NoError(t, err)
+
+	var rec DeadLetterRecord
+	require.NoError(t, json.Unmarshal(line, &rec))
+	require.Equal(t, "transform", rec.Stage)
+	require.Equal(t, entry, rec.Entry)
+}
+
+func TestNewPipeline_ChunkTransformerRejectsSinkCompression(t *testing.T) {
+	sink.Register("mock-parquet-gzip", func(opts map[string]interface{}, secrets *secrets.Store) (sink.Sink, error) {
+		return &mockSink{}, nil
+	})
+	spec := &job.JobSpec{
+		Options: job.JobOptions{
+			Output: job.OutputOptions{
+				Extractor:   "cert_fields",
+				Transformer: "parquet",
+				Sink:        "mock-parquet-gzip",
+				SinkOptions: map[string]interface{}{"compression": "gzip"},
+			},
+		},
+	}
+	_, err := NewPipeline(spec, &secrets.Store{}, "parquet")
+	require.ErrorContains(t, err, "sink compression")
+
+	spec.Options.Output.SinkOptions["compression"] = "none"
+	_, err = NewPipeline(spec, &secrets.Store{}, "parquet")
+	require.NoError(t, err)
+}
@@ -0,0 +1,44 @@
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/chtzvt/certslurp/internal/compression"
+	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/secrets"
+)
+
+// JobManifestName returns the sink stream name of a job's manifest.
+func JobManifestName(jobID string) string {
+	return jobID + "/MANIFEST.json"
+}
+
+// WriteJobManifest writes manifest as indented JSON to the job's sinks,
+// compressed like its chunks so that sinks name it consistently with them.
+func WriteJobManifest(ctx context.Context, spec *job.JobSpec, secrets *secrets.Store, jobID string, manifest any) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	s, err := newOutputSink(spec, secrets)
+	if err != nil {
+		return err
+	}
+	sw, err := s.Open(ctx, JobManifestName(jobID))
+	if err != nil {
+		return fmt.Errorf("open sink: %w", err)
+	}
+	out := spec.Options.Output
+	w, err := compression.NewWriterLevel(sw, out.Compression(), out.CompressionLevel())
+	if err != nil {
+		sw.Close()
+		return err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
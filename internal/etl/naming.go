@@ -0,0 +1,60 @@
+package etl
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/chtzvt/certslurp/internal/job"
+)
+
+// OutputBaseName returns a normalized name for the data output by a shard's ETL pipeline, in
+// the format <log url>.<log index range>.<job uuid>.<shard id>
+// Example: mysite_domain_com__some__path.0_1000000.17E28132-8B25-4FB2-99C5-89938D4D3D24.1
+func OutputBaseName(spec *job.JobSpec, indexFrom, indexTo int64, jobID string, shardID int) string {
+	logUrl, err := NormalizeLogURL(spec.LogURI)
+	if err != nil {
+		logUrl = jobID
+	}
+
+	shardRange := fmt.Sprintf("%d_%d", indexFrom, indexTo)
+
+	return strings.ToLower(fmt.Sprintf("%s.%s.%s.%d", logUrl, shardRange, jobID, shardID))
+}
+
+// ChunkName returns the sink stream name for the given (1-based) chunk of a
+// pipeline's output. Unchunked output is written under the base name itself.
+func ChunkName(baseName string, chunk int, chunked bool) string {
+	if !chunked {
+		return baseName
+	}
+	return fmt.Sprintf("%s.%04d", baseName, chunk)
+}
+
+// Chunked reports whether the spec splits output into numbered chunks.
+func Chunked(spec *job.JobSpec) bool {
+	return spec.Options.Output.ChunkBytes > 0 || spec.Options.Output.ChunkRecords > 0
+}
+
+// NormalizeLogURL converts a CT log URL into a string that's safe to use in output names.
+func NormalizeLogURL(raw string) (string, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+
+	host := parsed.Hostname()
+	if host == "" {
+		return "", fmt.Errorf("invalid URL: no hostname found")
+	}
+
+	path := strings.Trim(parsed.EscapedPath(), "/")
+
+	host = strings.ReplaceAll(host, ".", "_")
+	path = strings.ReplaceAll(path, "/", "__")
+
+	if path != "" {
+		return host + "__" + path, nil
+	}
+	return host, nil
+}
@@ -3,6 +3,7 @@ package etl
 import (
 	"fmt"
 
+	"github.com/chtzvt/certslurp/internal/compression"
 	"github.com/chtzvt/certslurp/internal/etl_core"
 	"github.com/chtzvt/certslurp/internal/extractor"
 	"github.com/chtzvt/certslurp/internal/job"
@@ -14,12 +15,50 @@ import (
 // Pipeline orchestrates the ETL process for a stream of records, with chunking support.
 type Pipeline struct {
 	Extractor     extractor.Extractor
+	Fallback      extractor.Extractor // optional; nil means extraction errors fail the stream
 	Transformer   transformer.Transformer
 	Sink          sink.Sink
 	Ctx           *etl_core.Context
-	MaxChunkBytes int // 0 means unlimited
-	MaxChunkRecs  int // 0 means unlimited
+	MaxChunkBytes int  // 0 means unlimited
+	MaxChunkRecs  int  // 0 means unlimited
+	SortByIndex   bool // buffer each chunk and write its records in log index order
 	BaseName      string
+
+	// A resumed shard numbers its chunks on after the ChunkOffset chunks an
+	// earlier run already wrote, and writes dead letters under a name
+	// carrying its Generation so it doesn't replace the earlier run's.
+	ChunkOffset int
+	Generation  int
+
+	// ChunkClosed, if set, is called after each chunk is closed with the
+	// number of entries read from the stream so far. Every one of them has
+	// by then been written to a closed chunk, dead-lettered or dropped.
+	ChunkClosed func(read int64)
+
+	// DeadLetter, if set, receives entries that fail extraction or
+	// transformation instead of failing the stream. See Redrive.
+	DeadLetter                 sink.Sink
+	DeadLetterCompression      string
+	DeadLetterCompressionLevel int
+
+	// Stats counts what the last StreamProcess call wrote.
+	Stats Stats
+}
+
+// Stats summarizes a StreamProcess run.
+type Stats struct {
+	Records      int64 // records written to the sink
+	Bytes        int64 // bytes written to the sink, after compression
+	Chunks       int
+	DeadLettered int64
+	Outputs      []ChunkInfo // the chunks written, in order
+}
+
+// ChunkInfo describes one chunk written to the sink.
+type ChunkInfo struct {
+	Name   string // stream name passed to the sink
+	Bytes  int64  // after compression
+	SHA256 string // hex digest of the bytes written
 }
 
 func NewPipeline(spec *job.JobSpec, secrets *secrets.Store, baseName string) (*Pipeline, error) {
@@ -27,25 +66,137 @@ func NewPipeline(spec *job.JobSpec, secrets *secrets.Store, baseName string) (*P
 	if err != nil {
 		return nil, fmt.Errorf("extractor: %w", err)
 	}
+	var fallback extractor.Extractor
+	if name := spec.Options.Output.FallbackExtractor; name != "" {
+		fallback, err = extractor.ForName(name)
+		if err != nil {
+			return nil, fmt.Errorf("fallback extractor: %w", err)
+		}
+	}
 	tr, err := transformer.ForName(spec.Options.Output.Transformer)
 	if err != nil {
 		return nil, fmt.Errorf("transformer: %w", err)
 	}
-	sinkFactory, ok := sink.ForName(spec.Options.Output.Sink)
-	if !ok {
-		return nil, fmt.Errorf("sink: not found: %s", spec.Options.Output.Sink)
+	if _, ok := tr.(transformer.ChunkTransformer); ok {
+		if spec.Options.Output.ChunkBytes > 0 {
+			return nil, fmt.Errorf("transformer %q encodes whole chunks and can't honor chunk_bytes; limit chunks with chunk_records instead", spec.Options.Output.Transformer)
+		}
+		// Compressing the sink would wrap the file, and readers expect it bare
+		if c := spec.Options.Output.Compression(); c != "" && c != "none" {
+			return nil, fmt.Errorf("transformer %q writes complete files and can't be combined with sink compression %q; use its own codec option instead", spec.Options.Output.Transformer, c)
+		}
 	}
-	sinkInst, err := sinkFactory(spec.Options.Output.SinkOptions, secrets)
+	for _, ss := range spec.Options.Output.SinkSpecs() {
+		// The kafka sink splits output into messages on newlines
+		if ss.Name == "kafka" && spec.Options.Output.Transformer != "jsonl" {
+			return nil, fmt.Errorf("sink %q publishes one message per line and requires the jsonl transformer, not %q", ss.Name, spec.Options.Output.Transformer)
+		}
+	}
+	sinkInst, err := newOutputSink(spec, secrets)
 	if err != nil {
-		return nil, fmt.Errorf("sink init: %w", err)
+		return nil, err
+	}
+	var deadLetter sink.Sink
+	var deadLetterComp string
+	var deadLetterLevel int
+	if name := spec.Options.Output.DeadLetterSink; name != "" {
+		dlFactory, ok := sink.ForName(name)
+		if !ok {
+			return nil, fmt.Errorf("dead letter sink: not found: %s", name)
+		}
+		deadLetter, err = dlFactory(spec.Options.Output.DeadLetterSinkOptions, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("dead letter sink init: %w", err)
+		}
+		deadLetterComp, _ = spec.Options.Output.DeadLetterSinkOptions["compression"].(string)
+		if deadLetterLevel, err = job.SinkCompressionLevel(spec.Options.Output.DeadLetterSinkOptions); err == nil {
+			err = compression.ValidateLevel(deadLetterComp, deadLetterLevel)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("dead letter sink: %w", err)
+		}
 	}
 	return &Pipeline{
 		Extractor:     ext,
+		Fallback:      fallback,
 		Transformer:   tr,
 		Sink:          sinkInst,
 		Ctx:           &etl_core.Context{Spec: spec},
 		BaseName:      baseName,
 		MaxChunkBytes: spec.Options.Output.ChunkBytes,
 		MaxChunkRecs:  spec.Options.Output.ChunkRecords,
+		SortByIndex:   spec.Options.Output.SortByIndex,
+
+		DeadLetter:                 deadLetter,
+		DeadLetterCompression:      deadLetterComp,
+		DeadLetterCompressionLevel: deadLetterLevel,
 	}, nil
 }
+
+// newOutputSink constructs the sinks the job's output is written to,
+// combined into one if there are several.
+func newOutputSink(spec *job.JobSpec, secrets *secrets.Store) (sink.Sink, error) {
+	// Every sink receives the same bytes, compressed per the primary sink, so
+	// the others must agree with it to name and label their output correctly
+	var sinks []sink.Sink
+	comp, level := spec.Options.Output.Compression(), spec.Options.Output.CompressionLevel()
+	if err := compression.ValidateLevel(comp, level); err != nil {
+		return nil, fmt.Errorf("sink: %w", err)
+	}
+	for i, ss := range spec.Options.Output.SinkSpecs() {
+		c, _ := ss.Options["compression"].(string)
+		if c != "" && compressionName(c) != compressionName(comp) {
+			return nil, fmt.Errorf("sink %d (%s): compression %q differs from the primary sink's %q", i, ss.Name, c, comp)
+		}
+		if l, err := job.SinkCompressionLevel(ss.Options); err != nil || (l != compression.DefaultLevel && l != level) {
+			return nil, fmt.Errorf("sink %d (%s): compression_level %v differs from the primary sink's %d", i, ss.Name, ss.Options["compression_level"], level)
+		}
+		if c != comp {
+			opts := make(map[string]interface{}, len(ss.Options)+1)
+			for k, v := range ss.Options {
+				opts[k] = v
+			}
+			opts["compression"] = comp
+			ss.Options = opts
+		}
+		s, err := newSink(ss, secrets)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("sink: none configured")
+	}
+	if len(sinks) > 1 {
+		return sink.NewMultiSink(sinks...), nil
+	}
+	return sinks[0], nil
+}
+
+// newSink builds one of the job's output sinks from its spec.
+func newSink(ss job.SinkSpec, secrets *secrets.Store) (sink.Sink, error) {
+	sinkFactory, ok := sink.ForName(ss.Name)
+	if !ok {
+		return nil, fmt.Errorf("sink: not found: %s", ss.Name)
+	}
+	sinkInst, err := sinkFactory(ss.Options, secrets)
+	if err != nil {
+		return nil, fmt.Errorf("sink init: %w", err)
+	}
+	// Optionally bound concurrent chunk writes across all pipelines using this sink
+	sinkInst = sink.WithWriteLimit(ss.Name, ss.Options, sinkInst)
+	// Optionally sign each output chunk with a key held in the secrets store
+	if keyName, _ := ss.Options["signing_key_secret"].(string); keyName != "" {
+		sinkInst = sink.NewSigningSink(sinkInst, sink.SecretSigningKey(secrets, keyName))
+	}
+	return sinkInst, nil
+}
+
+// compressionName normalizes a compression option, treating "none" as unset.
+func compressionName(c string) string {
+	if c == "none" {
+		return ""
+	}
+	return c
+}
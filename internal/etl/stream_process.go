@@ -2,48 +2,137 @@ package etl
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"sort"
 
 	"github.com/chtzvt/certslurp/internal/compression"
 	"github.com/chtzvt/certslurp/internal/sink"
+	"github.com/chtzvt/certslurp/internal/transformer"
 	ct "github.com/google/certificate-transparency-go"
 )
 
+// indexedRecord is a record held back until its chunk is closed, when
+// SortByIndex is set. It holds the transformed bytes, or for a
+// ChunkTransformer the extracted fields and the entry they came from.
+type indexedRecord struct {
+	index  int64
+	data   []byte
+	entry  *ct.RawLogEntry
+	fields map[string]interface{}
+}
+
 // StreamProcess processes records from entries and writes to a single sink output.
 // The ctx parameter is passed down to all operations, including Sink.Open.
-func (p *Pipeline) StreamProcess(ctx context.Context, entries <-chan *ct.RawLogEntry) error {
+//
+// Fetch workers deliver entries out of order. With SortByIndex, each chunk's
+// records are buffered in memory (at most one chunk's worth, or the whole shard
+// if chunking is disabled) and written sorted by log index when it is closed.
+//
+// With a DeadLetter sink, entries that fail extraction or transformation are
+// written there and skipped rather than failing the stream.
+//
+// A transformer.ChunkTransformer encodes each chunk as a whole when it's
+// closed. Chunks are then only rotated by record count, never by bytes.
+func (p *Pipeline) StreamProcess(ctx context.Context, entries <-chan *ct.RawLogEntry) (err error) {
 	var (
 		writer     sink.SinkWriter
 		curBytes   int
 		curRecs    int
-		chunkNum   int = 1
+		chunkNum   int = p.ChunkOffset + 1
 		needHeader bool
+		pending    []indexedRecord
+		read       int64
+		current    ChunkInfo // the open chunk
+		digest     hash.Hash
 	)
-	openChunk := func() (sink.SinkWriter, error) {
-		name := p.BaseName
-		if p.MaxChunkBytes > 0 || p.MaxChunkRecs > 0 {
-			name = fmt.Sprintf("%s.%04d", p.BaseName, chunkNum)
+	p.Stats = Stats{}
+	chunkTr, _ := p.Transformer.(transformer.ChunkTransformer)
+	var encoder transformer.ChunkEncoder
+	var deadLetters *deadLetterWriter
+	if p.DeadLetter != nil {
+		deadLetters = &deadLetterWriter{sink: p.DeadLetter, name: p.deadLetterName(), compression: p.DeadLetterCompression, level: p.DeadLetterCompressionLevel}
+		defer func() {
+			p.Stats.DeadLettered = int64(deadLetters.count)
+			if cerr := deadLetters.close(); cerr != nil && err == nil {
+				err = fmt.Errorf("close dead letter sink: %w", cerr)
+			}
+		}()
+	}
+	// addRecord hands a record to the chunk encoder, dead-lettering it if it
+	// can't be encoded, and reports whether it was added.
+	addRecord := func(entry *ct.RawLogEntry, fields map[string]interface{}) (bool, error) {
+		err := encoder.Add(fields)
+		if err == nil {
+			p.Stats.Records++
+			return true, nil
+		}
+		if deadLetters == nil {
+			return false, fmt.Errorf("transform: %w", err)
 		}
+		if dlErr := deadLetters.write(ctx, "transform", err, entry); dlErr != nil {
+			return false, fmt.Errorf("dead letter: %w", dlErr)
+		}
+		return false, nil
+	}
+	openChunk := func() (sink.SinkWriter, error) {
+		name := ChunkName(p.BaseName, chunkNum, p.MaxChunkBytes > 0 || p.MaxChunkRecs > 0)
 		sinkWriter, err := p.Sink.Open(ctx, name)
 		if err != nil {
 			return nil, err
 		}
+		p.Stats.Chunks++
+		current, digest = ChunkInfo{Name: name}, sha256.New()
 
 		// Wrap sink.SinkWriter in compression if requested in job spec
 		// If compression flag is empty or default value, it'll no-op
-		compOpt, _ := p.Ctx.Spec.Options.Output.SinkOptions["compression"]
-		compressionType, _ := compOpt.(string)
-		w, err := compression.NewWriter(sinkWriter, compressionType)
+		out := p.Ctx.Spec.Options.Output
+		w, err := compression.NewWriterLevel(&countingWriter{SinkWriter: sinkWriter, n: &current.Bytes, h: digest}, out.Compression(), out.CompressionLevel())
 		if err != nil {
 			return nil, err
 		}
 
-		needHeader = true
+		if chunkTr != nil {
+			if encoder, err = chunkTr.NewChunk(p.Ctx); err != nil {
+				return nil, err
+			}
+		}
+		needHeader = chunkTr == nil
 		return w, nil
 	}
 	closeChunk := func() error {
-		// Write footer if needed
 		if writer != nil {
+			// Records held back for ordering are flushed in log index order
+			if len(pending) > 0 {
+				sort.SliceStable(pending, func(i, j int) bool { return pending[i].index < pending[j].index })
+			}
+			if encoder != nil {
+				for _, rec := range pending {
+					if _, err := addRecord(rec.entry, rec.fields); err != nil {
+						return err
+					}
+				}
+				pending = pending[:0]
+				data, err := encoder.Finish()
+				if err != nil {
+					return fmt.Errorf("encode chunk: %w", err)
+				}
+				encoder = nil
+				if _, err := writer.Write(data); err != nil {
+					return err
+				}
+				return writer.Close()
+			}
+			for _, rec := range pending {
+				if _, err := writer.Write(rec.data); err != nil {
+					return err
+				}
+				p.Stats.Records++
+			}
+			pending = pending[:0]
+			// Write footer if needed
 			if footer, _ := p.Transformer.Footer(p.Ctx); len(footer) > 0 {
 				if _, err := writer.Write(footer); err != nil {
 					return err
@@ -53,8 +142,14 @@ func (p *Pipeline) StreamProcess(ctx context.Context, entries <-chan *ct.RawLogE
 		}
 		return nil
 	}
+	chunkWritten := func() {
+		current.SHA256 = hex.EncodeToString(digest.Sum(nil))
+		p.Stats.Bytes += current.Bytes
+		p.Stats.Outputs = append(p.Stats.Outputs, current)
+	}
 
 	for entry := range entries {
+		read++
 		if writer == nil {
 			var err error
 			writer, err = openChunk()
@@ -77,29 +172,61 @@ func (p *Pipeline) StreamProcess(ctx context.Context, entries <-chan *ct.RawLogE
 
 		// Extract and transform
 		extracted, err := p.Extractor.Extract(p.Ctx, entry)
+		if err != nil && p.Fallback != nil {
+			extracted, err = p.Fallback.Extract(p.Ctx, entry)
+		}
 		if err != nil {
-			return fmt.Errorf("extract: %w", err)
+			if deadLetters == nil {
+				return fmt.Errorf("extract: %w", err)
+			}
+			if dlErr := deadLetters.write(ctx, "extract", err, entry); dlErr != nil {
+				return fmt.Errorf("dead letter: %w", dlErr)
+			}
+			continue
 		}
 
 		if len(extracted) == 0 || extracted == nil {
 			continue
 		}
 
-		data, err := p.Transformer.Transform(p.Ctx, extracted)
-		if err != nil {
-			return fmt.Errorf("transform: %w", err)
-		}
+		if chunkTr != nil {
+			if p.SortByIndex {
+				pending = append(pending, indexedRecord{index: entry.Index, entry: entry, fields: extracted})
+			} else if added, err := addRecord(entry, extracted); err != nil {
+				return err
+			} else if !added {
+				continue
+			}
+			curRecs++
+		} else {
+			data, err := p.Transformer.Transform(p.Ctx, extracted)
+			if err != nil {
+				if deadLetters == nil {
+					return fmt.Errorf("transform: %w", err)
+				}
+				if dlErr := deadLetters.write(ctx, "transform", err, entry); dlErr != nil {
+					return fmt.Errorf("dead letter: %w", dlErr)
+				}
+				continue
+			}
 
-		if len(data) == 0 || data == nil {
-			continue
-		}
+			if len(data) == 0 || data == nil {
+				continue
+			}
 
-		n, err := writer.Write(data)
-		if err != nil {
-			return fmt.Errorf("write: %w", err)
+			if p.SortByIndex {
+				pending = append(pending, indexedRecord{index: entry.Index, data: data})
+				curBytes += len(data)
+			} else {
+				n, err := writer.Write(data)
+				if err != nil {
+					return fmt.Errorf("write: %w", err)
+				}
+				curBytes += n
+				p.Stats.Records++
+			}
+			curRecs++
 		}
-		curBytes += n
-		curRecs++
 
 		// Should we rotate?
 		rotate := false
@@ -114,6 +241,10 @@ func (p *Pipeline) StreamProcess(ctx context.Context, entries <-chan *ct.RawLogE
 				return fmt.Errorf("close sink: %w", err)
 			}
 			writer = nil
+			chunkWritten()
+			if p.ChunkClosed != nil {
+				p.ChunkClosed(read)
+			}
 		}
 	}
 
@@ -121,6 +252,24 @@ func (p *Pipeline) StreamProcess(ctx context.Context, entries <-chan *ct.RawLogE
 		if err := closeChunk(); err != nil {
 			return fmt.Errorf("close sink: %w", err)
 		}
+		chunkWritten()
+		if p.ChunkClosed != nil {
+			p.ChunkClosed(read)
+		}
 	}
 	return nil
 }
+
+// countingWriter adds the bytes written through it to n and h.
+type countingWriter struct {
+	sink.SinkWriter
+	n *int64
+	h hash.Hash
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.SinkWriter.Write(b)
+	*w.n += int64(n)
+	w.h.Write(b[:n])
+	return n, err
+}
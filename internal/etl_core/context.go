@@ -4,4 +4,9 @@ import "github.com/chtzvt/certslurp/internal/job"
 
 type Context struct {
 	Spec *job.JobSpec
+
+	// JobID and ShardID identify the shard being processed. JobID is empty
+	// when the pipeline isn't running for a shard (e.g. in tests).
+	JobID   string
+	ShardID int
 }
@@ -1,8 +1,13 @@
 package extractor
 
 import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"strings"
 	"time"
@@ -32,7 +37,17 @@ It can be configured in a JobSpec via the following options:
 		// Specific field list:
 		"log_fields": "log_index"
 
-		"metadata_fields": "log_url"
+		// Metadata must be named explicitly; "*" doesn't apply here.
+		// One or more of log_url, fetch_timestamp, job_id, shard_id
+		"metadata_fields": "log_url,shard_id"
+
+		// Derived fields such as validity_days (days between not_before and
+		// not_after) are computed independently: excluding not_before or
+		// not_after doesn't suppress them, so use "!validity_days" for that.
+
+		// Emit {"li": <index>, "err": "<message>"} for entries that can't be
+		// parsed instead of failing them (default false)
+		"emit_parse_errors": true
 	}
 }
 */
@@ -54,11 +69,23 @@ type CertFieldsExtractorOutput struct {
 	DNSNames           []string  `json:"dns,omitempty"`
 	IPAddresses        []string  `json:"ips,omitempty"`
 	URIs               []string  `json:"uris,omitempty"`
+	OCSPServers        []string  `json:"ocsp,omitempty"`
+	CRLDistPoints      []string  `json:"crl,omitempty"`
 	Subject            string    `json:"sub,omitempty"`
 	Issuer             string    `json:"iss"`
 	SerialNumber       string    `json:"sn"`
 	NotBefore          time.Time `json:"nbf"`
 	NotAfter           time.Time `json:"naf"`
+	ValidityDays       int       `json:"vd,omitempty"`
+	PathLen            *int      `json:"pathlen,omitempty"`
+	KeyUsage           []string  `json:"ku,omitempty"`
+	PublicKeyAlgorithm string    `json:"pka,omitempty"`
+	PublicKeySize      int       `json:"pks,omitempty"`
+	SignatureAlgorithm string    `json:"sig,omitempty"`
+	IsCA               bool      `json:"ca"`
+	SelfSigned         bool      `json:"ss"`
+	ExtensionCount     int       `json:"nexts"`
+	CriticalExtensions []string  `json:"crit,omitempty"`
 
 	// Log Entry Fields
 	LogIndex     int64     `json:"li"`
@@ -67,6 +94,12 @@ type CertFieldsExtractorOutput struct {
 	// Metadata Fields
 	LogUrl           string    `json:"log"`
 	FetchedTimestamp time.Time `json:"fts"`
+	JobID            string    `json:"job,omitempty"`
+	ShardID          *int      `json:"shard,omitempty"`
+
+	// Err is set when the entry could not be parsed and emit_parse_errors is
+	// enabled. Such records carry little more than the log index.
+	Err string `json:"err,omitempty"`
 }
 
 type CertFieldsExtractor struct {
@@ -78,6 +111,9 @@ type CertFieldsExtractorOptions struct {
 	PrecertFields  string `json:"precert_fields"`
 	LogFields      string `json:"log_fields"`
 	MetadataFields string `json:"metadata_fields"`
+	// EmitParseErrors produces a minimal error record for unparseable entries
+	// rather than failing them.
+	EmitParseErrors bool `json:"emit_parse_errors"`
 }
 
 const (
@@ -91,11 +127,23 @@ type CertFieldsExtractorMetadataFunc func(ctx *etl_core.Context) (string, interf
 
 var metaFuncs = map[string]CertFieldsExtractorMetadataFunc{
 	"log_url": func(ctx *etl_core.Context) (string, interface{}, error) {
+		if ctx.Spec == nil {
+			return "log", nil, fmt.Errorf("no job spec")
+		}
 		return "log", ctx.Spec.LogURI, nil
 	},
 	"fetch_timestamp": func(ctx *etl_core.Context) (string, interface{}, error) {
 		return "fts", time.Now(), nil
 	},
+	"job_id": func(ctx *etl_core.Context) (string, interface{}, error) {
+		return "job", ctx.JobID, nil
+	},
+	"shard_id": func(ctx *etl_core.Context) (string, interface{}, error) {
+		if ctx.JobID == "" {
+			return "shard", nil, fmt.Errorf("not processing a shard")
+		}
+		return "shard", ctx.ShardID, nil
+	},
 }
 
 type CertFieldsExtractorCertFunc func(cert *x509.Certificate) (string, interface{}, error)
@@ -146,6 +194,18 @@ var certFuncs = map[string]CertFieldsExtractorCertFunc{
 		}
 		return "uris", cert.URIs, nil
 	},
+	"ocsp_servers": func(cert *x509.Certificate) (string, interface{}, error) {
+		if len(cert.OCSPServer) == 0 {
+			return "ocsp", []string{}, fmt.Errorf("no OCSP servers present")
+		}
+		return "ocsp", cert.OCSPServer, nil
+	},
+	"crl_distribution_points": func(cert *x509.Certificate) (string, interface{}, error) {
+		if len(cert.CRLDistributionPoints) == 0 {
+			return "crl", []string{}, fmt.Errorf("no CRL distribution points present")
+		}
+		return "crl", cert.CRLDistributionPoints, nil
+	},
 	"subject": func(cert *x509.Certificate) (string, interface{}, error) {
 		return "sub", cert.Subject.String(), nil
 	},
@@ -161,6 +221,36 @@ var certFuncs = map[string]CertFieldsExtractorCertFunc{
 	"not_after": func(cert *x509.Certificate) (string, interface{}, error) {
 		return "naf", cert.NotAfter, nil
 	},
+	"validity_days": func(cert *x509.Certificate) (string, interface{}, error) {
+		return validityDays(cert)
+	},
+	"path_len_constraint": func(cert *x509.Certificate) (string, interface{}, error) {
+		return pathLenConstraint(cert)
+	},
+	"key_usage": func(cert *x509.Certificate) (string, interface{}, error) {
+		return keyUsage(cert)
+	},
+	"public_key_algorithm": func(cert *x509.Certificate) (string, interface{}, error) {
+		return publicKeyAlgorithm(cert)
+	},
+	"public_key_size": func(cert *x509.Certificate) (string, interface{}, error) {
+		return publicKeySize(cert)
+	},
+	"signature_algorithm": func(cert *x509.Certificate) (string, interface{}, error) {
+		return signatureAlgorithm(cert)
+	},
+	"is_ca": func(cert *x509.Certificate) (string, interface{}, error) {
+		return "ca", cert.IsCA, nil
+	},
+	"self_signed": func(cert *x509.Certificate) (string, interface{}, error) {
+		return "ss", selfSigned(cert), nil
+	},
+	"extension_count": func(cert *x509.Certificate) (string, interface{}, error) {
+		return "nexts", len(cert.Extensions), nil
+	},
+	"critical_extensions": func(cert *x509.Certificate) (string, interface{}, error) {
+		return criticalExtensions(cert)
+	},
 }
 
 type CertFieldsExtractorPrecertFunc func(cert *ct.Precertificate) (string, interface{}, error)
@@ -211,6 +301,18 @@ var precertFuncs = map[string]CertFieldsExtractorPrecertFunc{
 		}
 		return "uris", cert.TBSCertificate.URIs, nil
 	},
+	"ocsp_servers": func(cert *ct.Precertificate) (string, interface{}, error) {
+		if len(cert.TBSCertificate.OCSPServer) == 0 {
+			return "ocsp", []string{}, fmt.Errorf("no OCSP servers present")
+		}
+		return "ocsp", cert.TBSCertificate.OCSPServer, nil
+	},
+	"crl_distribution_points": func(cert *ct.Precertificate) (string, interface{}, error) {
+		if len(cert.TBSCertificate.CRLDistributionPoints) == 0 {
+			return "crl", []string{}, fmt.Errorf("no CRL distribution points present")
+		}
+		return "crl", cert.TBSCertificate.CRLDistributionPoints, nil
+	},
 	"subject": func(cert *ct.Precertificate) (string, interface{}, error) {
 		return "sub", cert.TBSCertificate.Subject.String(), nil
 	},
@@ -226,6 +328,151 @@ var precertFuncs = map[string]CertFieldsExtractorPrecertFunc{
 	"not_after": func(cert *ct.Precertificate) (string, interface{}, error) {
 		return "naf", cert.TBSCertificate.NotAfter, nil
 	},
+	"validity_days": func(cert *ct.Precertificate) (string, interface{}, error) {
+		return validityDays(cert.TBSCertificate)
+	},
+	"path_len_constraint": func(cert *ct.Precertificate) (string, interface{}, error) {
+		return pathLenConstraint(cert.TBSCertificate)
+	},
+	"key_usage": func(cert *ct.Precertificate) (string, interface{}, error) {
+		return keyUsage(cert.TBSCertificate)
+	},
+	"public_key_algorithm": func(cert *ct.Precertificate) (string, interface{}, error) {
+		return publicKeyAlgorithm(cert.TBSCertificate)
+	},
+	"public_key_size": func(cert *ct.Precertificate) (string, interface{}, error) {
+		return publicKeySize(cert.TBSCertificate)
+	},
+	"signature_algorithm": func(cert *ct.Precertificate) (string, interface{}, error) {
+		return signatureAlgorithm(cert.TBSCertificate)
+	},
+	"is_ca": func(cert *ct.Precertificate) (string, interface{}, error) {
+		return "ca", cert.TBSCertificate.IsCA, nil
+	},
+	"self_signed": func(cert *ct.Precertificate) (string, interface{}, error) {
+		// The TBSCertificate carries no signature; check the submitted precert.
+		submitted, err := x509.ParseCertificate(cert.Submitted.Data)
+		if x509.IsFatal(err) {
+			return "ss", nil, err
+		}
+		return "ss", selfSigned(submitted), nil
+	},
+	"extension_count": func(cert *ct.Precertificate) (string, interface{}, error) {
+		return "nexts", len(cert.TBSCertificate.Extensions), nil
+	},
+	"critical_extensions": func(cert *ct.Precertificate) (string, interface{}, error) {
+		return criticalExtensions(cert.TBSCertificate)
+	},
+}
+
+// validityDays returns the certificate's validity period rounded to whole
+// days, e.g. for spotting certificates beyond the 398-day maximum.
+func validityDays(cert *x509.Certificate) (string, interface{}, error) {
+	return "vd", int(math.Round(cert.NotAfter.Sub(cert.NotBefore).Hours() / 24)), nil
+}
+
+// pathLenConstraint returns the basic constraints path length of a CA
+// certificate. It errors when the certificate is not a CA or the path length
+// is unconstrained.
+func pathLenConstraint(cert *x509.Certificate) (string, interface{}, error) {
+	if !cert.BasicConstraintsValid || !cert.IsCA {
+		return "pathlen", nil, fmt.Errorf("not a CA certificate")
+	}
+	if cert.MaxPathLen > 0 || (cert.MaxPathLen == 0 && cert.MaxPathLenZero) {
+		return "pathlen", cert.MaxPathLen, nil
+	}
+	return "pathlen", nil, fmt.Errorf("no path length constraint present")
+}
+
+var keyUsageNames = []struct {
+	bit  x509.KeyUsage
+	name string
+}{
+	{x509.KeyUsageDigitalSignature, "digitalSignature"},
+	{x509.KeyUsageContentCommitment, "contentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "keyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "dataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "keyAgreement"},
+	{x509.KeyUsageCertSign, "keyCertSign"},
+	{x509.KeyUsageCRLSign, "cRLSign"},
+	{x509.KeyUsageEncipherOnly, "encipherOnly"},
+	{x509.KeyUsageDecipherOnly, "decipherOnly"},
+}
+
+// keyUsage decodes the key usage bitmask into RFC 5280 usage names.
+func keyUsage(cert *x509.Certificate) (string, interface{}, error) {
+	var out []string
+	for _, ku := range keyUsageNames {
+		if cert.KeyUsage&ku.bit != 0 {
+			out = append(out, ku.name)
+		}
+	}
+	if len(out) == 0 {
+		return "ku", nil, fmt.Errorf("no key usage present")
+	}
+	return "ku", out, nil
+}
+
+// publicKeyAlgorithm returns the name of the subject public key algorithm,
+// e.g. "RSA" or "ECDSA". It errors for algorithms the parser doesn't know.
+func publicKeyAlgorithm(cert *x509.Certificate) (string, interface{}, error) {
+	if cert.PublicKeyAlgorithm == x509.UnknownPublicKeyAlgorithm {
+		return "pka", nil, fmt.Errorf("unknown public key algorithm")
+	}
+	return "pka", cert.PublicKeyAlgorithm.String(), nil
+}
+
+// publicKeySize returns the strength of the subject public key in bits: the
+// modulus size for RSA and DSA, and the curve size for ECDSA. Keys with a
+// fixed size (Ed25519) or of an unrecognized type have no size.
+func publicKeySize(cert *x509.Certificate) (string, interface{}, error) {
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if pub.N != nil {
+			return "pks", pub.N.BitLen(), nil
+		}
+	case *ecdsa.PublicKey:
+		if pub.Curve != nil {
+			return "pks", pub.Curve.Params().BitSize, nil
+		}
+	case *dsa.PublicKey:
+		if pub.P != nil {
+			return "pks", pub.P.BitLen(), nil
+		}
+	}
+	return "pks", nil, fmt.Errorf("no public key size for %v", cert.PublicKeyAlgorithm)
+}
+
+func signatureAlgorithm(cert *x509.Certificate) (string, interface{}, error) {
+	if cert.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+		return "sig", nil, fmt.Errorf("unknown signature algorithm")
+	}
+	return "sig", cert.SignatureAlgorithm.String(), nil
+}
+
+// selfSigned reports whether the certificate names itself as issuer and its
+// signature verifies with its own public key.
+func selfSigned(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+		return false
+	}
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// criticalExtensions returns the dotted OIDs of the extensions marked
+// critical, in certificate order. Unusual critical extensions are a useful
+// anomaly signal, since clients must reject certificates they can't process.
+func criticalExtensions(cert *x509.Certificate) (string, interface{}, error) {
+	var out []string
+	for _, ext := range cert.Extensions {
+		if ext.Critical {
+			out = append(out, ext.Id.String())
+		}
+	}
+	if len(out) == 0 {
+		return "crit", nil, fmt.Errorf("no critical extensions present")
+	}
+	return "crit", out, nil
 }
 
 type CertFieldsExtractorLogEntryFunc func(le *ct.RawLogEntry) (string, interface{}, error)
@@ -235,7 +482,8 @@ var logEntryFuncs = map[string]CertFieldsExtractorLogEntryFunc{
 		return "li", le.Index, nil
 	},
 	"log_timestamp": func(le *ct.RawLogEntry) (string, interface{}, error) {
-		return "lts", le.Leaf.TimestampedEntry.Timestamp, nil
+		// CT timestamps are milliseconds since the epoch
+		return "lts", time.UnixMilli(int64(le.Leaf.TimestampedEntry.Timestamp)).UTC(), nil
 	},
 }
 
@@ -256,7 +504,7 @@ func (e *CertFieldsExtractor) Extract(ctx *etl_core.Context, raw *ct.RawLogEntry
 	}
 
 	// Collect all known field keys for each type
-	var certKeys, precertKeys, logKeys, metaKeys []string
+	var certKeys, precertKeys, logKeys []string
 	for k := range certFuncs {
 		certKeys = append(certKeys, k)
 	}
@@ -266,19 +514,25 @@ func (e *CertFieldsExtractor) Extract(ctx *etl_core.Context, raw *ct.RawLogEntry
 	for k := range logEntryFuncs {
 		logKeys = append(logKeys, k)
 	}
-	for k := range metaFuncs {
-		metaKeys = append(metaKeys, k)
-	}
 
 	certFields := parseFieldSpec(certKeys, e.Options.CertFields)
 	precertFields := parseFieldSpec(precertKeys, e.Options.PrecertFields)
 	logFields := parseFieldSpec(logKeys, e.Options.LogFields)
-	metaFields := parseFieldSpec(metaKeys, e.Options.MetadataFields)
+	// Metadata isn't part of the certificate, so "*" doesn't pull it in
+	metaFields := parseFieldSpec(nil, e.Options.MetadataFields)
 
 	result := map[string]interface{}{}
 	parsed, err := raw.ToLogEntry()
 	if err != nil {
-		return nil, err
+		if !e.Options.EmitParseErrors {
+			return nil, err
+		}
+		if parsed == nil {
+			// Fatal: nothing beyond the index is trustworthy.
+			return map[string]interface{}{"li": raw.Index, "err": err.Error()}, nil
+		}
+		// Non-fatal: extract what we can and note the error alongside.
+		result["err"] = err.Error()
 	}
 
 	for key, use := range metaFields {
@@ -378,6 +632,8 @@ func parseOptions(opts map[string]interface{}) CertFieldsExtractorOptions {
 			o.LogFields, _ = v.(string)
 		case "metadata_fields":
 			o.MetadataFields, _ = v.(string)
+		case "emit_parse_errors":
+			o.EmitParseErrors, _ = v.(bool)
 		}
 	}
 
@@ -1,6 +1,17 @@
 package extractor
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	stdx509 "crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"math/big"
 	"testing"
 	"time"
 
@@ -293,3 +304,463 @@ func TestCertFieldsExtractor_Precert_EmptyOption(t *testing.T) {
 	require.NotContains(t, "t", got)
 	require.Len(t, got, 0)
 }
+
+func newTestCACert(t *testing.T, maxPathLen int, pathLenZero bool, ku stdx509.KeyUsage) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &stdx509.Certificate{
+		SerialNumber:          big.NewInt(42),
+		Subject:               pkix.Name{CommonName: "Test Intermediate CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            maxPathLen,
+		MaxPathLenZero:        pathLenZero,
+		KeyUsage:              ku,
+	}
+	der, err := stdx509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return der
+}
+
+func TestCertFieldsExtractor_CA_PathLenAndKeyUsage(t *testing.T) {
+	der := newTestCACert(t, 1, false, stdx509.KeyUsageDigitalSignature|stdx509.KeyUsageCertSign|stdx509.KeyUsageCRLSign)
+	raw := testutil.RawLogEntryForX509(t, der, 0)
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "*",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.Equal(t, "cert", got["t"])
+	require.Equal(t, 1, got["pathlen"])
+	require.Equal(t, []string{"digitalSignature", "keyCertSign", "cRLSign"}, got["ku"])
+}
+
+func TestCertFieldsExtractor_CA_PathLenZero(t *testing.T) {
+	der := newTestCACert(t, 0, true, stdx509.KeyUsageCertSign)
+	raw := testutil.RawLogEntryForX509(t, der, 0)
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "path_len_constraint,key_usage",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.Equal(t, 0, got["pathlen"])
+	require.Equal(t, []string{"keyCertSign"}, got["ku"])
+}
+
+func TestCertFieldsExtractor_CA_UnconstrainedAndExcluded(t *testing.T) {
+	der := newTestCACert(t, -1, false, stdx509.KeyUsageCertSign)
+	raw := testutil.RawLogEntryForX509(t, der, 0)
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "*,!key_usage",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.NotContains(t, got, "pathlen") // unconstrained
+	require.NotContains(t, got, "ku")      // excluded by glob
+}
+
+func newTestLeafCert(t *testing.T, pub crypto.PublicKey, priv crypto.Signer) []byte {
+	t.Helper()
+	tmpl := &stdx509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "key.example.com"},
+		DNSNames:     []string{"key.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := stdx509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	require.NoError(t, err)
+	return der
+}
+
+func TestCertFieldsExtractor_PublicKey_RSA2048(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	raw := testutil.RawLogEntryForX509(t, newTestLeafCert(t, &key.PublicKey, key), 0)
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "*",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.Equal(t, "RSA", got["pka"])
+	require.Equal(t, 2048, got["pks"])
+}
+
+func TestCertFieldsExtractor_PublicKey_P256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	raw := testutil.RawLogEntryForX509(t, newTestLeafCert(t, &key.PublicKey, key), 0)
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "public_key_algorithm,public_key_size",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.Equal(t, "ECDSA", got["pka"])
+	require.Equal(t, 256, got["pks"])
+}
+
+func TestCertFieldsExtractor_PublicKey_Ed25519OmitsSize(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	raw := testutil.RawLogEntryForX509(t, newTestLeafCert(t, pub, priv), 0)
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "*",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.Equal(t, "Ed25519", got["pka"])
+	require.NotContains(t, got, "pks")
+}
+
+func TestCertFieldsExtractor_SelfSignedRoot(t *testing.T) {
+	der := newTestCACert(t, -1, false, stdx509.KeyUsageCertSign)
+	raw := testutil.RawLogEntryForX509(t, der, 0)
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "*",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.Equal(t, "ECDSA-SHA256", got["sig"])
+	require.Equal(t, true, got["ca"])
+	require.Equal(t, true, got["ss"])
+}
+
+func TestCertFieldsExtractor_LeafSignedByRoot(t *testing.T) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	root := &stdx509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              stdx509.KeyUsageCertSign,
+	}
+	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	leaf := &stdx509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := stdx509.CreateCertificate(rand.Reader, leaf, root, &leafKey.PublicKey, rootKey)
+	require.NoError(t, err)
+
+	raw := testutil.RawLogEntryForX509(t, der, 0)
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "*",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.Equal(t, "ECDSA-SHA256", got["sig"])
+	// false flags are kept, not dropped as empty values
+	require.Equal(t, false, got["ca"])
+	require.Equal(t, false, got["ss"])
+
+	out, err := json.Marshal(got)
+	require.NoError(t, err)
+	var decoded CertFieldsExtractorOutput
+	require.NoError(t, json.Unmarshal(out, &decoded))
+	require.False(t, decoded.IsCA)
+	require.Contains(t, string(out), `"ss":false`)
+}
+
+func TestCertFieldsExtractor_SignatureAndFlagsExcluded(t *testing.T) {
+	der := newTestCACert(t, -1, false, stdx509.KeyUsageCertSign)
+	raw := testutil.RawLogEntryForX509(t, der, 0)
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "*,!is_ca,!self_signed,!signature_algorithm",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.NotContains(t, got, "ca")
+	require.NotContains(t, got, "ss")
+	require.NotContains(t, got, "sig")
+	require.Contains(t, got, "cn")
+}
+
+func TestCertFieldsExtractor_Precert_NotSelfSigned(t *testing.T) {
+	raw := testutil.RawLogEntryForTestPrecert(t, 0)
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			PrecertFields: "is_ca,self_signed",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.Equal(t, false, got["ca"])
+	require.Equal(t, false, got["ss"])
+}
+
+func TestCertFieldsExtractor_RevocationEndpoints(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &stdx509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: "revocation.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		OCSPServer:            []string{"http://ocsp.example.com"},
+		CRLDistributionPoints: []string{"http://crl.example.com/ca.crl", "http://crl2.example.com/ca.crl"},
+	}
+	der, err := stdx509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	raw := testutil.RawLogEntryForX509(t, der, 0)
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "*",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.Equal(t, []string{"http://ocsp.example.com"}, got["ocsp"])
+	require.Equal(t, []string{"http://crl.example.com/ca.crl", "http://crl2.example.com/ca.crl"}, got["crl"])
+
+	// Certificates without the extensions omit the fields
+	got, err = ex.Extract(&etl_core.Context{}, testutil.RawLogEntryForX509(t, newTestCACert(t, -1, false, stdx509.KeyUsageCertSign), 0))
+	require.NoError(t, err)
+	require.NotContains(t, got, "ocsp")
+	require.NotContains(t, got, "crl")
+}
+
+func newTestCertValidFor(t *testing.T, validity time.Duration) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	notBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tmpl := &stdx509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      pkix.Name{CommonName: "validity.example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(validity),
+	}
+	der, err := stdx509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return der
+}
+
+func TestCertFieldsExtractor_ValidityDays(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		validity time.Duration
+		want     int
+	}{
+		{"90 days", 90 * 24 * time.Hour, 90},
+		// Issuers commonly end validity a second short of the full period
+		{"397 days", 397*24*time.Hour - time.Second, 397},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			raw := testutil.RawLogEntryForX509(t, newTestCertValidFor(t, tc.validity), 0)
+			ex := &CertFieldsExtractor{
+				Options: CertFieldsExtractorOptions{
+					CertFields: "*",
+				},
+			}
+			got, err := ex.Extract(&etl_core.Context{}, raw)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got["vd"])
+		})
+	}
+}
+
+func TestCertFieldsExtractor_ValidityDaysExclusion(t *testing.T) {
+	raw := testutil.RawLogEntryForX509(t, newTestCertValidFor(t, 90*24*time.Hour), 0)
+
+	// Excluding the source fields doesn't suppress the derived one
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "*,!not_before,!not_after",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.NotContains(t, got, "nbf")
+	require.NotContains(t, got, "naf")
+	require.Equal(t, 90, got["vd"])
+
+	ex = &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "*,!validity_days",
+		},
+	}
+	got, err = ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.NotContains(t, got, "vd")
+	require.Contains(t, got, "naf")
+}
+
+func TestCertFieldsExtractor_NonCA_OmitsPathLen(t *testing.T) {
+	raw := testutil.RawLogEntryForTestCert(t, 0)
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "path_len_constraint",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, raw)
+	require.NoError(t, err)
+	require.NotContains(t, got, "pathlen")
+}
+
+func TestCertFieldsExtractor_Extensions(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &stdx509.Certificate{
+		SerialNumber:          big.NewInt(5),
+		Subject:               pkix.Name{CommonName: "Test Extensions CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              stdx509.KeyUsageCertSign,
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}, Critical: true, Value: []byte{0x05, 0x00}},
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}, Value: []byte{0x05, 0x00}},
+		},
+	}
+	der, err := stdx509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	parsed, err := stdx509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ex := &CertFieldsExtractor{
+		Options: CertFieldsExtractorOptions{
+			CertFields: "*",
+		},
+	}
+	got, err := ex.Extract(&etl_core.Context{}, testutil.RawLogEntryForX509(t, der, 0))
+	require.NoError(t, err)
+	require.Equal(t, len(parsed.Extensions), got["nexts"])
+	// Key usage and basic constraints are critical for CAs, plus our own
+	require.ElementsMatch(t, []string{"2.5.29.15", "2.5.29.19", "1.3.6.1.4.1.99999.1"}, got["crit"])
+
+	// A certificate with no critical extensions omits crit
+	leaf := newTestCertValidFor(t, 24*time.Hour)
+	got, err = ex.Extract(&etl_core.Context{}, testutil.RawLogEntryForX509(t, leaf, 0))
+	require.NoError(t, err)
+	require.NotContains(t, got, "crit")
+	require.Contains(t, got, "nexts")
+
+	// Both fields honor exclusions
+	ex.Options.CertFields = "*,!extension_count,!critical_extensions"
+	got, err = ex.Extract(&etl_core.Context{}, testutil.RawLogEntryForX509(t, der, 0))
+	require.NoError(t, err)
+	require.NotContains(t, got, "nexts")
+	require.NotContains(t, got, "crit")
+}
+
+func TestCertFieldsExtractor_EmitParseErrors(t *testing.T) {
+	raw := testutil.RawLogEntryForX509(t, []byte("not a certificate"), 42)
+	spec := func(emit bool) *etl_core.Context {
+		return &etl_core.Context{Spec: &job.JobSpec{
+			Options: job.JobOptions{
+				Output: job.OutputOptions{
+					ExtractorOptions: map[string]interface{}{
+						"cert_fields":       "*",
+						"log_fields":        "*",
+						"emit_parse_errors": emit,
+					},
+				},
+			},
+		}}
+	}
+
+	// Off by default: the entry fails
+	got, err := (&CertFieldsExtractor{}).Extract(spec(false), raw)
+	require.Error(t, err)
+	require.Nil(t, got)
+
+	got, err = (&CertFieldsExtractor{}).Extract(spec(true), raw)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, int64(42), got["li"])
+	require.Contains(t, got["err"], "failed to parse certificate")
+}
+
+func metadataCtx(fields string) *etl_core.Context {
+	return &etl_core.Context{
+		JobID:   "job-1",
+		ShardID: 7,
+		Spec: &job.JobSpec{
+			LogURI: "https://testlog.example.com",
+			Options: job.JobOptions{
+				Output: job.OutputOptions{
+					ExtractorOptions: map[string]interface{}{
+						"metadata_fields": fields,
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestCertFieldsExtractor_MetadataFields(t *testing.T) {
+	raw := testutil.RawLogEntryForTestCert(t, 0)
+
+	got, err := (&CertFieldsExtractor{}).Extract(metadataCtx("log_url,fetch_timestamp,job_id,shard_id,bogus"), raw)
+	require.NoError(t, err)
+	require.Len(t, got, 4) // the unknown field is ignored
+	require.Equal(t, "https://testlog.example.com", got["log"])
+	require.IsType(t, time.Time{}, got["fts"])
+	require.WithinDuration(t, time.Now(), got["fts"].(time.Time), time.Minute)
+	require.Equal(t, "job-1", got["job"])
+	require.Equal(t, 7, got["shard"])
+
+	got, err = (&CertFieldsExtractor{}).Extract(metadataCtx("shard_id"), raw)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"shard": 7}, got)
+}
+
+func TestCertFieldsExtractor_MetadataFields_NoShard(t *testing.T) {
+	raw := testutil.RawLogEntryForTestCert(t, 0)
+	ctx := metadataCtx("job_id,shard_id,log_url")
+	ctx.JobID = ""
+
+	// Outside of a shard only the spec-derived metadata is available
+	got, err := (&CertFieldsExtractor{}).Extract(ctx, raw)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"log": "https://testlog.example.com"}, got)
+}
+
+func TestCertFieldsExtractor_MetadataFields_GlobDoesNotApply(t *testing.T) {
+	raw := testutil.RawLogEntryForTestCert(t, 0)
+
+	got, err := (&CertFieldsExtractor{}).Extract(metadataCtx("*"), raw)
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	ctx := metadataCtx("")
+	ctx.Spec.Options.Output.ExtractorOptions = map[string]interface{}{
+		"cert_fields": "*",
+		"log_fields":  "*",
+	}
+	got, err = (&CertFieldsExtractor{}).Extract(ctx, raw)
+	require.NoError(t, err)
+	require.Contains(t, got, "cn")
+	for _, k := range []string{"log", "fts", "job", "shard"} {
+		require.NotContains(t, got, k)
+	}
+}
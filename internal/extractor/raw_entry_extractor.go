@@ -0,0 +1,20 @@
+package extractor
+
+import (
+	"github.com/chtzvt/certslurp/internal/etl_core"
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// RawEntryExtractor emits the whole log entry under "entry". Written with the
+// jsonl transformer, the output keeps everything fetched from the log, so it
+// can be reprocessed later with other extractors without fetching it again.
+// See etl.Reprocess.
+type RawEntryExtractor struct{}
+
+func (e *RawEntryExtractor) Extract(ctx *etl_core.Context, raw *ct.RawLogEntry) (map[string]interface{}, error) {
+	return map[string]interface{}{"entry": raw}, nil
+}
+
+func init() {
+	Register("raw_entry", &RawEntryExtractor{})
+}
@@ -0,0 +1,83 @@
+package job
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// FieldDiff is a single differing field between two job specs. Path uses the
+// spec's JSON field names (e.g. "options.fetch.index_end"); A and B hold the
+// JSON encoded values, or "" if the field is absent on that side.
+type FieldDiff struct {
+	Path string `json:"path"`
+	A    string `json:"a"`
+	B    string `json:"b"`
+}
+
+// Diff returns the fields that differ between a and b, sorted by path.
+// Nested option maps (extractor, transformer and sink options) are compared
+// key by key.
+func Diff(a, b *JobSpec) ([]FieldDiff, error) {
+	fa, err := flattenSpec(a)
+	if err != nil {
+		return nil, err
+	}
+	fb, err := flattenSpec(b)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]struct{}, len(fa))
+	for p := range fa {
+		paths[p] = struct{}{}
+	}
+	for p := range fb {
+		paths[p] = struct{}{}
+	}
+
+	var diffs []FieldDiff
+	for p := range paths {
+		if fa[p] != fb[p] {
+			diffs = append(diffs, FieldDiff{Path: p, A: fa[p], B: fb[p]})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs, nil
+}
+
+// flattenSpec maps each leaf of the spec's JSON form to its encoded value. Null
+// and empty maps produce no entries, so they compare equal to absent fields.
+func flattenSpec(spec *JobSpec) (map[string]string, error) {
+	out := make(map[string]string)
+	if spec == nil {
+		return out, nil
+	}
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		return nil, err
+	}
+	flattenInto(out, "", tree)
+	return out, nil
+}
+
+func flattenInto(out map[string]string, prefix string, v interface{}) {
+	if m, ok := v.(map[string]interface{}); ok {
+		for k, child := range m {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			flattenInto(out, path, child)
+		}
+		return
+	}
+	if v == nil {
+		return
+	}
+	b, _ := json.Marshal(v)
+	out[prefix] = string(b)
+}
@@ -0,0 +1,52 @@
+package job
+
+import "testing"
+
+func diffTestSpec() *JobSpec {
+	return &JobSpec{
+		Version: "1",
+		LogURI:  "https://ct.example.com/log",
+		Options: JobOptions{
+			Fetch: FetchConfig{FetchSize: 100, FetchWorkers: 2, IndexStart: 0, IndexEnd: 1000},
+			Output: OutputOptions{
+				Extractor:   "cert_fields",
+				Transformer: "jsonl",
+				Sink:        "disk",
+				SinkOptions: map[string]interface{}{"path": "/data/out"},
+			},
+		},
+	}
+}
+
+func TestDiff_ReportsSingleChangedField(t *testing.T) {
+	a, b := diffTestSpec(), diffTestSpec()
+	b.Options.Fetch.IndexEnd = 2000
+
+	diffs, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if len(diffs) != 1 {
+		t.Fatalf("expected exactly 1 diff, got %d: %+v", len(diffs), diffs)
+	}
+	want := FieldDiff{Path: "options.fetch.index_end", A: "1000", B: "2000"}
+	if diffs[0] != want {
+		t.Errorf("got %+v, want %+v", diffs[0], want)
+	}
+}
+
+func TestDiff_NestedOptionsAndIdentical(t *testing.T) {
+	a, b := diffTestSpec(), diffTestSpec()
+	if diffs, err := Diff(a, b); err != nil || len(diffs) != 0 {
+		t.Fatalf("expected no diffs for identical specs, got %+v (err %v)", diffs, err)
+	}
+
+	b.Options.Output.SinkOptions = map[string]interface{}{"path": "/data/out", "compression": "zstd"}
+	diffs, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if len(diffs) != 1 || diffs[0].Path != "options.output.sink_options.compression" || diffs[0].A != "" || diffs[0].B != `"zstd"` {
+		t.Errorf("unexpected diffs: %+v", diffs)
+	}
+}
@@ -1,19 +1,29 @@
 package job
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"reflect"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/compression"
+	"gopkg.in/yaml.v3"
 )
 
 type JobSpec struct {
-	Version string     `json:"version" yaml:"version"`
-	Note    string     `json:"note,omitempty" yaml:"note"`
-	LogURI  string     `json:"log_uri" yaml:"log_uri"`
-	Options JobOptions `json:"options" yaml:"options"`
+	Version  string     `json:"version" yaml:"version"`
+	Note     string     `json:"note,omitempty" yaml:"note"`
+	LogURI   string     `json:"log_uri" yaml:"log_uri"`
+	Priority int        `json:"priority,omitempty" yaml:"priority"` // Workers claim shards of higher priority jobs first
+	Options  JobOptions `json:"options" yaml:"options"`
 }
 
 type JobOptions struct {
@@ -32,9 +42,60 @@ type FetchConfig struct {
 	// Optional number of shards to create for the job
 	ShardSize int `json:"shard_size" yaml:"shard_size"`
 
+	// Optional page size to align shard boundaries to, typically the log's
+	// max get-entries batch. Aligned shards don't fetch the same page twice.
+	// The shard size is rounded up to a multiple of it. 0 = no alignment
+	ShardAlignment int `json:"shard_alignment,omitempty" yaml:"shard_alignment"`
+
 	// CT log index range to scan
 	IndexStart int64 `json:"index_start" yaml:"index_start"`
 	IndexEnd   int64 `json:"index_end" yaml:"index_end"` // Non-inclusive; 0 = end of log
+
+	// Optional shard retry policy. MaxRetries is the number of failures a shard may
+	// accumulate before it is marked permanently failed, and RetryBackoffSecs is the
+	// base of the exponential backoff applied between attempts. 0 = cluster default
+	MaxRetries       int `json:"max_retries,omitempty" yaml:"max_retries"`
+	RetryBackoffSecs int `json:"retry_backoff_secs,omitempty" yaml:"retry_backoff_secs"`
+
+	// Optional cap on how long a worker waits when the CT log answers 429 with
+	// a Retry-After header. Longer waits, and 429s without the header, fall
+	// back to the scanner's own backoff. 0 = default (60s), -1 = never wait
+	MaxRetryAfterSecs int `json:"max_retry_after_secs,omitempty" yaml:"max_retry_after_secs"`
+
+	// Optional adaptive fetch concurrency. With FetchWorkersMax set, a shard
+	// starts with FetchWorkers requests in flight and adjusts within
+	// [FetchWorkersMin, FetchWorkersMax] as it goes: halving on a run of
+	// errors or 429s, and adding one back after a run of successes.
+	// FetchWorkersMin defaults to 1. 0 = fixed at FetchWorkers
+	FetchWorkersMin int `json:"fetch_workers_min,omitempty" yaml:"fetch_workers_min"`
+	FetchWorkersMax int `json:"fetch_workers_max,omitempty" yaml:"fetch_workers_max"`
+
+	// Optional HTTP headers sent with every request to the CT log, e.g. an API
+	// key for a private log. Values of the form "secret:<name>" are resolved
+	// from the cluster secret store by the worker.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers"`
+}
+
+// SecretRefPrefix marks a job spec value as a reference to a stored secret.
+const SecretRefPrefix = "secret:"
+
+// MaxRetriesLimit is the largest FetchConfig.MaxRetries a job may set.
+const MaxRetriesLimit = 100
+
+// validHeaderName reports whether name is a valid HTTP header field name (an RFC 7230 token).
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 type MatchConfig struct {
@@ -49,17 +110,242 @@ type MatchConfig struct {
 	SkipPrecerts     bool   `json:"skip_precerts,omitempty" yaml:"skip_precerts"`
 	PrecertsOnly     bool   `json:"precerts_only,omitempty" yaml:"precerts_only"`
 	Workers          int    `json:"workers,omitempty" yaml:"workers"`
+
+	// DomainIncludes and DomainExcludes add patterns to DomainInclude and
+	// DomainExclude. A certificate matches when any of its names matches any
+	// include pattern, and none of them match an exclude pattern.
+	DomainIncludes []string `json:"domain_includes,omitempty" yaml:"domain_includes"`
+	DomainExcludes []string `json:"domain_excludes,omitempty" yaml:"domain_excludes"`
+
+	// LogTimestampFrom and LogTimestampTo select entries logged in
+	// [from, to), by CT log timestamp. Either may be left unset. The window
+	// narrows what the other criteria match.
+	LogTimestampFrom time.Time `json:"log_timestamp_from,omitzero" yaml:"log_timestamp_from,omitempty"`
+	LogTimestampTo   time.Time `json:"log_timestamp_to,omitzero" yaml:"log_timestamp_to,omitempty"`
+
+	// NotBeforeAfter and NotBeforeBefore select certificates whose validity
+	// starts in [after, before), and NotAfterAfter and NotAfterBefore those
+	// whose validity ends in it. Any may be left unset. Like the log
+	// timestamp window, they narrow what the other criteria match.
+	NotBeforeAfter  time.Time `json:"not_before_after,omitzero" yaml:"not_before_after,omitempty"`
+	NotBeforeBefore time.Time `json:"not_before_before,omitzero" yaml:"not_before_before,omitempty"`
+	NotAfterAfter   time.Time `json:"not_after_after,omitzero" yaml:"not_after_after,omitempty"`
+	NotAfterBefore  time.Time `json:"not_after_before,omitzero" yaml:"not_after_before,omitempty"`
+
+	// MinKeyBits and MaxKeyBits select certificates whose public key size
+	// (the modulus for RSA and DSA, the curve for ECDSA) is in [min, max],
+	// either bound optional, and KeyAlgorithm those with that type of key
+	// (see KeyAlgorithms). Keys without a size, like Ed25519, never match a
+	// size bound. These narrow what the other criteria match too.
+	MinKeyBits   int    `json:"min_key_bits,omitempty" yaml:"min_key_bits"`
+	MaxKeyBits   int    `json:"max_key_bits,omitempty" yaml:"max_key_bits"`
+	KeyAlgorithm string `json:"key_algorithm,omitempty" yaml:"key_algorithm"`
+
+	// ExcludeExpired and ExcludeNotYetValid leave out certificates that have
+	// expired, or whose validity hasn't started, as of when they're fetched,
+	// or as of ValidAt if it's set. Unlike the validity window above, this
+	// keeps only certificates valid "now".
+	ExcludeExpired     bool      `json:"exclude_expired,omitempty" yaml:"exclude_expired"`
+	ExcludeNotYetValid bool      `json:"exclude_not_yet_valid,omitempty" yaml:"exclude_not_yet_valid"`
+	ValidAt            time.Time `json:"valid_at,omitzero" yaml:"valid_at,omitempty"`
+
+	// WildcardOnly selects certificates with a wildcard ("*.") DNS name, and
+	// HasIPSAN those naming at least one IP address. Both narrow what the
+	// other criteria match.
+	WildcardOnly bool `json:"wildcard_only,omitempty" yaml:"wildcard_only"`
+	HasIPSAN     bool `json:"has_ip_san,omitempty" yaml:"has_ip_san"`
+
+	// Expr, when set, selects certificates with a boolean combination of
+	// conditions and takes precedence over the single-criterion fields above.
+	// skip_precerts, precerts_only and workers still apply.
+	Expr *MatchExpr `json:"expr,omitempty" yaml:"expr"`
+}
+
+// DomainIncludePatterns returns DomainInclude, if set, followed by
+// DomainIncludes.
+func (mc MatchConfig) DomainIncludePatterns() []string {
+	return domainPatterns(mc.DomainInclude, mc.DomainIncludes)
+}
+
+// DomainExcludePatterns returns DomainExclude, if set, followed by
+// DomainExcludes.
+func (mc MatchConfig) DomainExcludePatterns() []string {
+	return domainPatterns(mc.DomainExclude, mc.DomainExcludes)
+}
+
+func domainPatterns(single string, list []string) []string {
+	var out []string
+	if single != "" {
+		out = append(out, single)
+	}
+	for _, p := range list {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// KeyAlgorithms are the MatchConfig.KeyAlgorithm values, matched without
+// regard to case.
+var KeyAlgorithms = []string{"RSA", "DSA", "ECDSA", "Ed25519"}
+
+// MatchExpr is a node in a boolean match expression. A certificate matches a
+// node when it satisfies every condition set on it, every expression in All,
+// and at least one expression in Any (if Any is non-empty). A node with
+// nothing set matches everything.
+//
+// For example, "(issuer ~ Let's Encrypt AND domain ~ \.gov$) OR expired":
+//
+//	expr:
+//	  any:
+//	    - issuer_regex: "Let's Encrypt"
+//	      domain_include: "\\.gov$"
+//	    - expired: true
+type MatchExpr struct {
+	All []MatchExpr `json:"all,omitempty" yaml:"all"`
+	Any []MatchExpr `json:"any,omitempty" yaml:"any"`
+
+	SubjectRegex  string `json:"subject_regex,omitempty" yaml:"subject_regex"`
+	IssuerRegex   string `json:"issuer_regex,omitempty" yaml:"issuer_regex"`
+	Serial        string `json:"serial,omitempty" yaml:"serial"`
+	DomainInclude string `json:"domain_include,omitempty" yaml:"domain_include"`
+	DomainExclude string `json:"domain_exclude,omitempty" yaml:"domain_exclude"`
+	Expired       bool   `json:"expired,omitempty" yaml:"expired"` // not_after is in the past
+}
+
+// regexErrors returns a message for each invalid regex in the expression tree,
+// prefixed with its path.
+func (e MatchExpr) regexErrors(path string) []string {
+	var errs []string
+	for field, re := range map[string]string{
+		"subject_regex":  e.SubjectRegex,
+		"issuer_regex":   e.IssuerRegex,
+		"domain_include": e.DomainInclude,
+		"domain_exclude": e.DomainExclude,
+	} {
+		if re == "" {
+			continue
+		}
+		if _, err := regexp.Compile(re); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.%s: %v", path, field, err))
+		}
+	}
+	for i, sub := range e.All {
+		errs = append(errs, sub.regexErrors(fmt.Sprintf("%s.all[%d]", path, i))...)
+	}
+	for i, sub := range e.Any {
+		errs = append(errs, sub.regexErrors(fmt.Sprintf("%s.any[%d]", path, i))...)
+	}
+	sort.Strings(errs)
+	return errs
 }
 
 type OutputOptions struct {
 	ChunkRecords       int                    `json:"chunk_records" yaml:"chunk_records"`
 	ChunkBytes         int                    `json:"chunk_bytes" yaml:"chunk_bytes"`
+	SortByIndex        bool                   `json:"sort_by_index,omitempty" yaml:"sort_by_index"` // Buffer each chunk and write records in log index order
 	Extractor          string                 `json:"extractor" yaml:"extractor"`
 	ExtractorOptions   map[string]interface{} `json:"extractor_options" yaml:"extractor_options"`
+	FallbackExtractor  string                 `json:"fallback_extractor,omitempty" yaml:"fallback_extractor"` // Used for entries the primary extractor fails on
 	Transformer        string                 `json:"transformer" yaml:"transformer"`
 	TransformerOptions map[string]interface{} `json:"transformer_options" yaml:"transformer_options"`
 	Sink               string                 `json:"sink" yaml:"sink"`
 	SinkOptions        map[string]interface{} `json:"sink_options" yaml:"sink_options"`
+	Sinks              []SinkSpec             `json:"sinks,omitempty" yaml:"sinks"`       // Every chunk is also written to these, after Sink if set
+	Manifest           bool                   `json:"manifest,omitempty" yaml:"manifest"` // Write <job id>/MANIFEST.json listing every chunk when the job completes
+
+	// Entries that fail extraction or transformation are written to this sink
+	// for later redrive instead of failing the shard. Unset means fail.
+	DeadLetterSink        string                 `json:"dead_letter_sink,omitempty" yaml:"dead_letter_sink"`
+	DeadLetterSinkOptions map[string]interface{} `json:"dead_letter_sink_options,omitempty" yaml:"dead_letter_sink_options"`
+}
+
+// SinkSpec names a sink and its options, as one entry of OutputOptions.Sinks.
+type SinkSpec struct {
+	Name    string                 `json:"name" yaml:"name"`
+	Options map[string]interface{} `json:"options,omitempty" yaml:"options"`
+}
+
+// SinkSpecs returns every sink output is written to: Sink with SinkOptions,
+// if set, followed by Sinks. The first one is the primary sink, whose
+// compression option applies to all of them.
+func (o OutputOptions) SinkSpecs() []SinkSpec {
+	var specs []SinkSpec
+	if o.Sink != "" {
+		specs = append(specs, SinkSpec{Name: o.Sink, Options: o.SinkOptions})
+	}
+	return append(specs, o.Sinks...)
+}
+
+// Compression returns the compression option of the primary sink.
+func (o OutputOptions) Compression() string {
+	specs := o.SinkSpecs()
+	if len(specs) == 0 {
+		return ""
+	}
+	c, _ := specs[0].Options["compression"].(string)
+	return c
+}
+
+// CompressionLevel returns the compression_level option of the primary sink,
+// or compression.DefaultLevel if it's unset or invalid. Validate reports the
+// invalid case.
+func (o OutputOptions) CompressionLevel() int {
+	specs := o.SinkSpecs()
+	if len(specs) == 0 {
+		return compression.DefaultLevel
+	}
+	level, _ := SinkCompressionLevel(specs[0].Options)
+	return level
+}
+
+// SinkCompressionLevel parses the compression_level option from a set of sink
+// options. YAML and JSON decode numbers as int and float64 respectively, and
+// values substituted from the environment arrive as strings.
+func SinkCompressionLevel(opts map[string]interface{}) (int, error) {
+	switch v := opts["compression_level"].(type) {
+	case nil:
+		return compression.DefaultLevel, nil
+	case int:
+		return v, nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, nil
+		}
+	}
+	return compression.DefaultLevel, fmt.Errorf("compression_level %v is not an integer", opts["compression_level"])
+}
+
+// SinkSecretNames returns the sorted, de-duplicated names of the secrets the
+// sink and dead-letter sink options reference: the string values of options
+// ending in "_secret", such as access_key_secret or signing_key_secret.
+func (o OutputOptions) SinkSecretNames() []string {
+	seen := make(map[string]struct{})
+	var names []string
+	allOpts := []map[string]interface{}{o.SinkOptions, o.DeadLetterSinkOptions}
+	for _, s := range o.Sinks {
+		allOpts = append(allOpts, s.Options)
+	}
+	for _, opts := range allOpts {
+		for key, value := range opts {
+			name, ok := value.(string)
+			if !ok || name == "" || !strings.HasSuffix(key, "_secret") {
+				continue
+			}
+			if _, dup := seen[name]; dup {
+				continue
+			}
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 func LoadFromFile(path string) (*JobSpec, error) {
@@ -83,6 +369,101 @@ func Load(r io.Reader) (*JobSpec, error) {
 	return &js, nil
 }
 
+// Decode parses a YAML or JSON job spec without validating it. In strict mode,
+// fields that don't exist in JobSpec (e.g. a misspelled "fetch_wrokers") are
+// rejected rather than silently ignored.
+func Decode(data []byte, strict bool) (*JobSpec, error) {
+	var js JobSpec
+	ydec := yaml.NewDecoder(bytes.NewReader(data))
+	ydec.KnownFields(strict)
+	yerr := ydec.Decode(&js)
+	if yerr == nil {
+		return &js, nil
+	}
+
+	// JSON fallback
+	js = JobSpec{}
+	jdec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		jdec.DisallowUnknownFields()
+	}
+	if jerr := jdec.Decode(&js); jerr != nil {
+		return nil, fmt.Errorf("YAML error: %v; JSON error: %v", yerr, jerr)
+	}
+	return &js, nil
+}
+
+var envVarRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv replaces ${VAR} references in the spec's string values, including
+// those nested in sink and extractor options, with values from the
+// environment. It runs on the decoded spec, so a value can't change the
+// spec's structure, and non-string fields aren't expanded. Bare $VAR is left
+// alone so regexes in match options survive. Undefined variables expand to
+// the empty string, or produce an error when strict is set.
+func (j *JobSpec) ExpandEnv(strict bool) error {
+	var undefined []string
+	seen := map[string]bool{}
+	expand := func(s string) string {
+		return envVarRe.ReplaceAllStringFunc(s, func(m string) string {
+			name := envVarRe.FindStringSubmatch(m)[1]
+			val, ok := os.LookupEnv(name)
+			if !ok && !seen[name] {
+				seen[name] = true
+				undefined = append(undefined, name)
+			}
+			return val
+		})
+	}
+	expandEnvValue(reflect.ValueOf(j).Elem(), expand)
+	if strict && len(undefined) > 0 {
+		return fmt.Errorf("undefined environment variables: %s", strings.Join(undefined, ", "))
+	}
+	return nil
+}
+
+// expandEnvValue applies expand to every string reachable from v through
+// exported struct fields, pointers, slices, map values and interfaces. Map
+// keys are left as they are.
+func expandEnvValue(v reflect.Value, expand func(string) string) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(expand(v.String()))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				expandEnvValue(v.Field(i), expand)
+			}
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			expandEnvValue(v.Elem(), expand)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			expandEnvValue(v.Index(i), expand)
+		}
+	case reflect.Interface:
+		// The dynamic value isn't addressable, so expand a copy and put it back
+		if !v.IsNil() && v.CanSet() {
+			c := reflect.New(v.Elem().Type()).Elem()
+			c.Set(v.Elem())
+			expandEnvValue(c, expand)
+			v.Set(c)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			c := reflect.New(iter.Value().Type()).Elem()
+			c.Set(iter.Value())
+			expandEnvValue(c, expand)
+			v.SetMapIndex(iter.Key(), c)
+		}
+	}
+}
+
 func (j *JobSpec) Validate() error {
 	var missing []string
 	var regexErrs []string
@@ -99,15 +480,78 @@ func (j *JobSpec) Validate() error {
 	if j.Options.Fetch.FetchWorkers <= 0 {
 		missing = append(missing, "options.fetch.workers")
 	}
+	if j.Options.Fetch.IndexStart < 0 {
+		missing = append(missing, "options.fetch.index_start")
+	}
+	if j.Options.Fetch.IndexEnd < 0 {
+		missing = append(missing, "options.fetch.index_end")
+	}
+	if j.Options.Fetch.ShardAlignment < 0 {
+		missing = append(missing, "options.fetch.shard_alignment")
+	}
+	if j.Options.Fetch.MaxRetries < 0 {
+		missing = append(missing, "options.fetch.max_retries")
+	} else if j.Options.Fetch.MaxRetries > MaxRetriesLimit {
+		missing = append(missing, fmt.Sprintf("options.fetch.max_retries (at most %d)", MaxRetriesLimit))
+	}
+	if j.Options.Fetch.RetryBackoffSecs < 0 {
+		missing = append(missing, "options.fetch.retry_backoff_secs")
+	}
+	if j.Options.Fetch.MaxRetryAfterSecs < -1 {
+		missing = append(missing, "options.fetch.max_retry_after_secs")
+	}
+	if f := j.Options.Fetch; f.FetchWorkersMin < 0 || f.FetchWorkersMax < 0 {
+		missing = append(missing, "options.fetch.fetch_workers_min/fetch_workers_max")
+	} else if f.FetchWorkersMax > 0 && f.FetchWorkersMax < max(f.FetchWorkersMin, 1) {
+		missing = append(missing, "options.fetch.fetch_workers_max (must be at least fetch_workers_min)")
+	}
 	if j.Options.Output.Extractor == "" {
 		missing = append(missing, "options.output.extractor")
 	}
 	if j.Options.Output.Transformer == "" {
 		missing = append(missing, "options.output.transformer")
 	}
-	if j.Options.Output.Sink == "" {
+	if j.Options.Output.Sink == "" && len(j.Options.Output.Sinks) == 0 {
 		missing = append(missing, "options.output.sink")
 	}
+	for i, s := range j.Options.Output.Sinks {
+		if s.Name == "" {
+			missing = append(missing, fmt.Sprintf("options.output.sinks[%d].name", i))
+		}
+	}
+
+	sinkOpts := map[string]map[string]interface{}{
+		"options.output.sink_options":             j.Options.Output.SinkOptions,
+		"options.output.dead_letter_sink_options": j.Options.Output.DeadLetterSinkOptions,
+	}
+	for i, s := range j.Options.Output.Sinks {
+		sinkOpts[fmt.Sprintf("options.output.sinks[%d].options", i)] = s.Options
+	}
+	var levelErrs []string
+	for field, opts := range sinkOpts {
+		comp, _ := opts["compression"].(string)
+		level, err := SinkCompressionLevel(opts)
+		if err == nil {
+			err = compression.ValidateLevel(comp, level)
+		}
+		if err != nil {
+			levelErrs = append(levelErrs, fmt.Sprintf("%s: %v", field, err))
+		}
+	}
+	sort.Strings(levelErrs)
+
+	var headerErrs []string
+	for name, value := range j.Options.Fetch.Headers {
+		if !validHeaderName(name) {
+			headerErrs = append(headerErrs, fmt.Sprintf("invalid header name %q", name))
+		} else if strings.EqualFold(name, "Host") || strings.EqualFold(name, "Content-Length") {
+			headerErrs = append(headerErrs, fmt.Sprintf("header %q may not be overridden", name))
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			headerErrs = append(headerErrs, fmt.Sprintf("header %q: value contains a newline", name))
+		}
+	}
+	sort.Strings(headerErrs)
 
 	mc := j.Options.Match
 	if mc.SubjectRegex != "" {
@@ -130,6 +574,36 @@ func (j *JobSpec) Validate() error {
 			regexErrs = append(regexErrs, fmt.Sprintf("options.match.domain_exclude: %v", err))
 		}
 	}
+	for i, p := range mc.DomainIncludes {
+		if _, err := regexp.Compile(p); err != nil {
+			regexErrs = append(regexErrs, fmt.Sprintf("options.match.domain_includes[%d]: %v", i, err))
+		}
+	}
+	for i, p := range mc.DomainExcludes {
+		if _, err := regexp.Compile(p); err != nil {
+			regexErrs = append(regexErrs, fmt.Sprintf("options.match.domain_excludes[%d]: %v", i, err))
+		}
+	}
+	if !mc.LogTimestampFrom.IsZero() && !mc.LogTimestampTo.IsZero() && !mc.LogTimestampTo.After(mc.LogTimestampFrom) {
+		missing = append(missing, "options.match.log_timestamp_to (must be after log_timestamp_from)")
+	}
+	if !mc.NotBeforeAfter.IsZero() && !mc.NotBeforeBefore.IsZero() && !mc.NotBeforeBefore.After(mc.NotBeforeAfter) {
+		missing = append(missing, "options.match.not_before_before (must be after not_before_after)")
+	}
+	if !mc.NotAfterAfter.IsZero() && !mc.NotAfterBefore.IsZero() && !mc.NotAfterBefore.After(mc.NotAfterAfter) {
+		missing = append(missing, "options.match.not_after_before (must be after not_after_after)")
+	}
+	if mc.MinKeyBits < 0 || mc.MaxKeyBits < 0 {
+		missing = append(missing, "options.match.min_key_bits/max_key_bits")
+	} else if mc.MaxKeyBits > 0 && mc.MaxKeyBits < mc.MinKeyBits {
+		missing = append(missing, "options.match.max_key_bits (must be at least min_key_bits)")
+	}
+	if mc.KeyAlgorithm != "" && !slices.ContainsFunc(KeyAlgorithms, func(a string) bool { return strings.EqualFold(a, mc.KeyAlgorithm) }) {
+		missing = append(missing, fmt.Sprintf("options.match.key_algorithm (one of %s)", strings.Join(KeyAlgorithms, ", ")))
+	}
+	if mc.Expr != nil {
+		regexErrs = append(regexErrs, mc.Expr.regexErrors("options.match.expr")...)
+	}
 
 	if len(missing) > 0 {
 		return fmt.Errorf("missing/invalid job fields: %s", strings.Join(missing, ", "))
@@ -137,5 +611,11 @@ func (j *JobSpec) Validate() error {
 	if len(regexErrs) > 0 {
 		return fmt.Errorf("invalid regex in job spec:\n  - %s", strings.Join(regexErrs, "\n  - "))
 	}
+	if len(levelErrs) > 0 {
+		return fmt.Errorf("invalid compression level:\n  - %s", strings.Join(levelErrs, "\n  - "))
+	}
+	if len(headerErrs) > 0 {
+		return fmt.Errorf("invalid options.fetch.headers:\n  - %s", strings.Join(headerErrs, "\n  - "))
+	}
 	return nil
 }
@@ -1,8 +1,11 @@
 package job
 
 import (
+	"encoding/json"
+	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadJobSpecJSON(t *testing.T) {
@@ -93,3 +96,457 @@ func TestJobLoad_MissingFields(t *testing.T) {
 	}
 	t.Logf("got expected error: %v", err)
 }
+
+func TestExpandEnv_FromEnvironment(t *testing.T) {
+	t.Setenv("BUCKET", "ct-archive")
+	t.Setenv("CT_NOTE", "nightly run")
+
+	jobJSON := `{
+	"version": "1.0.0",
+	"note": "${CT_NOTE}",
+	"log_uri": "https://ct.googleapis.com/aviator",
+	"options": {
+		"fetch": {"fetch_size": 100, "fetch_workers": 1},
+		"match": {"subject_regex": "example\\.com$"},
+		"output": {
+			"extractor": "raw",
+			"transformer": "jsonl",
+			"sink": "s3",
+			"sink_options": {"bucket": "${BUCKET}", "prefix": "${BUCKET}/out"}
+		}
+	}
+}`
+
+	spec, err := Load(strings.NewReader(jobJSON))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := spec.ExpandEnv(true); err != nil {
+		t.Fatalf("ExpandEnv: %v", err)
+	}
+	if got := spec.Options.Output.SinkOptions["bucket"]; got != "ct-archive" {
+		t.Errorf("bucket not expanded: got %v", got)
+	}
+	if got := spec.Options.Output.SinkOptions["prefix"]; got != "ct-archive/out" {
+		t.Errorf("prefix not expanded: got %v", got)
+	}
+	if spec.Note != "nightly run" {
+		t.Errorf("note not expanded: got %q", spec.Note)
+	}
+	if spec.Options.Match.SubjectRegex != `example\.com$` {
+		t.Errorf("regex should be left intact: got %q", spec.Options.Match.SubjectRegex)
+	}
+}
+
+func TestExpandEnv_Undefined(t *testing.T) {
+	newSpec := func() *JobSpec {
+		return &JobSpec{Options: JobOptions{Output: OutputOptions{
+			SinkOptions: map[string]interface{}{"bucket": "${CERTSLURP_TEST_UNDEFINED_VAR}"},
+		}}}
+	}
+
+	spec := newSpec()
+	if err := spec.ExpandEnv(false); err != nil {
+		t.Fatalf("non-strict ExpandEnv should not fail: %v", err)
+	}
+	if got := spec.Options.Output.SinkOptions["bucket"]; got != "" {
+		t.Errorf("undefined var should expand to empty: got %q", got)
+	}
+
+	if err := newSpec().ExpandEnv(true); err == nil || !strings.Contains(err.Error(), "CERTSLURP_TEST_UNDEFINED_VAR") {
+		t.Errorf("strict ExpandEnv should report undefined var, got %v", err)
+	}
+}
+
+func TestExpandEnv_ValuesCannotChangeStructure(t *testing.T) {
+	t.Setenv("CT_NOTE", "x\"\n  \"log_uri\": \"https://evil.example")
+	t.Setenv("PART", "a")
+
+	jobYAML := `
+version: "1.0.0"
+note: "${CT_NOTE}"
+log_uri: https://ct.googleapis.com/aviator
+options:
+  fetch: {fetch_size: 100, fetch_workers: 1}
+  output:
+    extractor: raw
+    transformer: jsonl
+    sink: s3
+    sink_options:
+      bucket: ct
+      tags: ["${PART}-1", {nested: "${PART}-2"}]
+`
+	spec, err := Decode([]byte(jobYAML), true)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if err := spec.ExpandEnv(true); err != nil {
+		t.Fatalf("ExpandEnv: %v", err)
+	}
+	if spec.LogURI != "https://ct.googleapis.com/aviator" {
+		t.Errorf("a variable's value must not set other fields: log_uri %q", spec.LogURI)
+	}
+	if spec.Note != os.Getenv("CT_NOTE") {
+		t.Errorf("note should hold the value verbatim: got %q", spec.Note)
+	}
+	tags, _ := spec.Options.Output.SinkOptions["tags"].([]interface{})
+	if len(tags) != 2 || tags[0] != "a-1" {
+		t.Fatalf("list values not expanded: %#v", spec.Options.Output.SinkOptions["tags"])
+	}
+	if nested, _ := tags[1].(map[string]interface{}); nested["nested"] != "a-2" {
+		t.Errorf("nested map values not expanded: %#v", tags[1])
+	}
+}
+
+func TestValidate_FetchHeaders(t *testing.T) {
+	spec := func(headers map[string]string) *JobSpec {
+		return &JobSpec{
+			Version: "1",
+			LogURI:  "https://ct.example.com/log",
+			Options: JobOptions{
+				Fetch:  FetchConfig{FetchSize: 100, FetchWorkers: 1, Headers: headers},
+				Output: OutputOptions{Extractor: "raw", Transformer: "passthrough", Sink: "null"},
+			},
+		}
+	}
+
+	if err := spec(map[string]string{"X-Api-Key": "secret:ct/key", "Authorization": "Bearer abc"}).Validate(); err != nil {
+		t.Fatalf("expected valid headers, got %v", err)
+	}
+
+	for _, bad := range []map[string]string{
+		{"Bad Header": "x"},
+		{"": "x"},
+		{"X-Api-Key": "a\r\nInjected: 1"},
+		{"Host": "evil.example.com"},
+	} {
+		err := spec(bad).Validate()
+		if err == nil || !strings.Contains(err.Error(), "options.fetch.headers") {
+			t.Errorf("expected header validation error for %v, got %v", bad, err)
+		}
+	}
+}
+
+func TestOutputOptions_Sinks(t *testing.T) {
+	spec := &JobSpec{
+		Version: "1",
+		LogURI:  "https://ct.example.com/log",
+		Options: JobOptions{
+			Fetch: FetchConfig{FetchSize: 100, FetchWorkers: 1},
+			Output: OutputOptions{
+				Extractor:   "raw",
+				Transformer: "passthrough",
+				Sinks: []SinkSpec{
+					{Name: "s3", Options: map[string]interface{}{"access_key_secret": "s3/key", "compression": "zstd"}},
+					{Name: "file", Options: map[string]interface{}{"dir": "/verify"}},
+				},
+			},
+		},
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("sinks alone should be valid: %v", err)
+	}
+	out := spec.Options.Output
+	if got := out.SinkSpecs(); len(got) != 2 || got[0].Name != "s3" {
+		t.Errorf("unexpected sink specs: %+v", got)
+	}
+	if got := out.Compression(); got != "zstd" {
+		t.Errorf("compression should come from the first sink, got %q", got)
+	}
+	if got := out.SinkSecretNames(); len(got) != 1 || got[0] != "s3/key" {
+		t.Errorf("secrets of extra sinks should be prefetched, got %v", got)
+	}
+
+	// Sink is shorthand for a leading entry
+	out.Sink, out.SinkOptions = "null", map[string]interface{}{}
+	if got := out.SinkSpecs(); len(got) != 3 || got[0].Name != "null" || out.Compression() != "" {
+		t.Errorf("unexpected sink specs: %+v", got)
+	}
+
+	spec.Options.Output.Sinks[1].Name = ""
+	if err := spec.Validate(); err == nil || !strings.Contains(err.Error(), "options.output.sinks[1].name") {
+		t.Errorf("expected missing sink name error, got %v", err)
+	}
+}
+
+func TestValidate_CompressionLevel(t *testing.T) {
+	spec := &JobSpec{
+		Version: "1",
+		LogURI:  "https://ct.example.com/log",
+		Options: JobOptions{
+			Fetch: FetchConfig{FetchSize: 100, FetchWorkers: 1},
+			Output: OutputOptions{
+				Extractor:   "raw",
+				Transformer: "passthrough",
+				Sink:        "file",
+				SinkOptions: map[string]interface{}{"compression": "zstd", "compression_level": 19.0},
+			},
+		},
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("expected valid level: %v", err)
+	}
+	if got := spec.Options.Output.CompressionLevel(); got != 19 {
+		t.Errorf("CompressionLevel() = %d, want 19", got)
+	}
+
+	for _, bad := range []interface{}{23, "fast", 1.5} {
+		spec.Options.Output.SinkOptions["compression_level"] = bad
+		err := spec.Validate()
+		if err == nil || !strings.Contains(err.Error(), "options.output.sink_options") {
+			t.Errorf("compression_level %v: expected an error naming sink_options, got %v", bad, err)
+		}
+	}
+	spec.Options.Output.SinkOptions["compression_level"] = "3"
+	if err := spec.Validate(); err != nil {
+		t.Errorf("string levels should parse: %v", err)
+	}
+
+	spec.Options.Output.DeadLetterSink = "file"
+	spec.Options.Output.DeadLetterSinkOptions = map[string]interface{}{"compression_level": 6}
+	if err := spec.Validate(); err == nil || !strings.Contains(err.Error(), "without a compression") {
+		t.Errorf("expected a level without compression to be rejected, got %v", err)
+	}
+	spec.Options.Output.DeadLetterSinkOptions["compression"] = "gzip"
+
+	spec.Options.Output.Sinks = []SinkSpec{
+		{Name: "file", Options: map[string]interface{}{"compression": "gzip", "compression_level": 9}},
+		{Name: "file", Options: map[string]interface{}{"compression": "lz4", "compression_level": 12}},
+	}
+	if err := spec.Validate(); err == nil || !strings.Contains(err.Error(), "options.output.sinks[1].options") ||
+		strings.Contains(err.Error(), "options.output.sinks[0].options") {
+		t.Errorf("expected an error naming sinks[1].options only, got %v", err)
+	}
+}
+
+func TestValidate_MaxRetries(t *testing.T) {
+	spec := &JobSpec{
+		Version: "1",
+		LogURI:  "https://ct.example.com/log",
+		Options: JobOptions{
+			Fetch:  FetchConfig{FetchSize: 100, FetchWorkers: 1, MaxRetries: MaxRetriesLimit},
+			Output: OutputOptions{Extractor: "raw", Transformer: "passthrough", Sink: "null"},
+		},
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("expected max_retries %d to be valid: %v", MaxRetriesLimit, err)
+	}
+	for _, bad := range []int{-1, MaxRetriesLimit + 1, 1 << 40} {
+		spec.Options.Fetch.MaxRetries = bad
+		if err := spec.Validate(); err == nil || !strings.Contains(err.Error(), "options.fetch.max_retries") {
+			t.Errorf("max_retries %d: expected an error, got %v", bad, err)
+		}
+	}
+}
+
+func TestValidate_IndexRange(t *testing.T) {
+	spec := &JobSpec{
+		Version: "1",
+		LogURI:  "https://ct.example.com/log",
+		Options: JobOptions{
+			Fetch:  FetchConfig{FetchSize: 100, FetchWorkers: 1, IndexStart: 0, IndexEnd: 1000},
+			Output: OutputOptions{Extractor: "raw", Transformer: "passthrough", Sink: "null"},
+		},
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("expected index range to be valid: %v", err)
+	}
+	spec.Options.Fetch.IndexStart = -1
+	if err := spec.Validate(); err == nil || !strings.Contains(err.Error(), "options.fetch.index_start") {
+		t.Errorf("index_start -1: expected an error, got %v", err)
+	}
+	spec.Options.Fetch.IndexStart, spec.Options.Fetch.IndexEnd = 0, -1
+	if err := spec.Validate(); err == nil || !strings.Contains(err.Error(), "options.fetch.index_end") {
+		t.Errorf("index_end -1: expected an error, got %v", err)
+	}
+}
+
+func TestValidate_LogTimestampWindow(t *testing.T) {
+	data := []byte(`
+version: "1"
+log_uri: https://ct.example.com/log
+options:
+  fetch: {fetch_size: 100, fetch_workers: 1}
+  match:
+    log_timestamp_from: 2025-06-02T00:00:00Z
+    log_timestamp_to: 2025-06-09T00:00:00Z
+  output: {extractor: raw, transformer: passthrough, sink: stdout}
+`)
+	spec, err := Decode(data, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("expected a valid window: %v", err)
+	}
+	if want := time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC); !spec.Options.Match.LogTimestampTo.Equal(want) {
+		t.Errorf("log_timestamp_to = %v, want %v", spec.Options.Match.LogTimestampTo, want)
+	}
+
+	spec.Options.Match.LogTimestampTo = spec.Options.Match.LogTimestampFrom
+	if err := spec.Validate(); err == nil || !strings.Contains(err.Error(), "log_timestamp_to") {
+		t.Errorf("expected an empty window to be rejected, got %v", err)
+	}
+
+	// Unset bounds stay out of encoded specs
+	spec.Options.Match = MatchConfig{}
+	enc, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(enc), "log_timestamp") {
+		t.Errorf("unset window encoded: %s", enc)
+	}
+}
+
+func TestValidate_ValidityWindow(t *testing.T) {
+	data := []byte(`
+version: "1"
+log_uri: https://ct.example.com/log
+options:
+  fetch: {fetch_size: 100, fetch_workers: 1}
+  match:
+    not_before_after: 2025-06-01T00:00:00Z
+    not_after_before: 2025-09-01T00:00:00Z
+  output: {extractor: raw, transformer: passthrough, sink: stdout}
+`)
+	spec, err := Decode(data, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("expected a valid window: %v", err)
+	}
+
+	spec.Options.Match.NotBeforeBefore = spec.Options.Match.NotBeforeAfter.Add(-time.Hour)
+	if err := spec.Validate(); err == nil || !strings.Contains(err.Error(), "not_before_before") {
+		t.Errorf("expected an inverted not_before window to be rejected, got %v", err)
+	}
+	spec.Options.Match.NotBeforeBefore = time.Time{}
+	spec.Options.Match.NotAfterAfter = spec.Options.Match.NotAfterBefore
+	if err := spec.Validate(); err == nil || !strings.Contains(err.Error(), "not_after_before") {
+		t.Errorf("expected an empty not_after window to be rejected, got %v", err)
+	}
+}
+
+func TestValidate_KeyConstraints(t *testing.T) {
+	spec := &JobSpec{
+		Version: "1",
+		LogURI:  "https://ct.example.com/log",
+		Options: JobOptions{
+			Fetch:  FetchConfig{FetchSize: 100, FetchWorkers: 1},
+			Match:  MatchConfig{KeyAlgorithm: "rsa", MaxKeyBits: 1024},
+			Output: OutputOptions{Extractor: "raw", Transformer: "passthrough", Sink: "stdout"},
+		},
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("expected weak RSA constraints to be valid: %v", err)
+	}
+
+	spec.Options.Match.MinKeyBits = 2048
+	if err := spec.Validate(); err == nil || !strings.Contains(err.Error(), "max_key_bits") {
+		t.Errorf("expected max below min to be rejected, got %v", err)
+	}
+	spec.Options.Match = MatchConfig{KeyAlgorithm: "ElGamal"}
+	if err := spec.Validate(); err == nil || !strings.Contains(err.Error(), "key_algorithm") {
+		t.Errorf("expected an unknown key algorithm to be rejected, got %v", err)
+	}
+}
+
+func TestValidate_DomainPatterns(t *testing.T) {
+	spec := &JobSpec{
+		Version: "1",
+		LogURI:  "https://ct.example.com/log",
+		Options: JobOptions{
+			Fetch: FetchConfig{FetchSize: 100, FetchWorkers: 1},
+			Match: MatchConfig{
+				DomainInclude:  `\.gov$`,
+				DomainIncludes: []string{`\.mil$`, "(unclosed"},
+			},
+			Output: OutputOptions{Extractor: "raw", Transformer: "passthrough", Sink: "stdout"},
+		},
+	}
+	err := spec.Validate()
+	if err == nil || !strings.Contains(err.Error(), "options.match.domain_includes[1]") {
+		t.Errorf("expected the bad pattern to be named, got %v", err)
+	}
+
+	spec.Options.Match.DomainIncludes = spec.Options.Match.DomainIncludes[:1]
+	if err := spec.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := spec.Options.Match.DomainIncludePatterns(); len(got) != 2 || got[0] != `\.gov$` || got[1] != `\.mil$` {
+		t.Errorf("DomainIncludePatterns() = %q, want domain_include then domain_includes", got)
+	}
+}
+
+func TestDecode_StrictRejectsUnknownFields(t *testing.T) {
+	yamlSpec := `
+version: 1.0.0
+log_uri: https://ct.example.com/log
+options:
+  fetch:
+    fetch_size: 100
+    fetch_wrokers: 4
+  output:
+    extractor: raw
+    transformer: passthrough
+    sink: null
+`
+	jsonSpec := `{"version":"1.0.0","log_uri":"https://ct.example.com/log","options":{"fetch":{"fetch_size":100,"fetch_wrokers":4}}}`
+
+	for name, data := range map[string]string{"yaml": yamlSpec, "json": jsonSpec} {
+		if _, err := Decode([]byte(data), true); err == nil || !strings.Contains(err.Error(), "fetch_wrokers") {
+			t.Errorf("%s: expected strict decode to reject fetch_wrokers, got %v", name, err)
+		}
+
+		spec, err := Decode([]byte(data), false)
+		if err != nil {
+			t.Fatalf("%s: lenient decode failed: %v", name, err)
+		}
+		if spec.Options.Fetch.FetchSize != 100 || spec.Options.Fetch.FetchWorkers != 0 {
+			t.Errorf("%s: unexpected fetch config %+v", name, spec.Options.Fetch)
+		}
+	}
+}
+
+func TestMatchExpr_DecodeAndValidate(t *testing.T) {
+	yamlSpec := `
+version: 1.0.0
+log_uri: https://ct.example.com/log
+options:
+  fetch:
+    fetch_size: 100
+    fetch_workers: 1
+  match:
+    expr:
+      any:
+        - issuer_regex: "Let's Encrypt"
+          domain_include: "\\.gov$"
+        - expired: true
+  output:
+    extractor: raw
+    transformer: passthrough
+    sink: "null"
+`
+	spec, err := Decode([]byte(yamlSpec), true)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	expr := spec.Options.Match.Expr
+	if expr == nil || len(expr.Any) != 2 {
+		t.Fatalf("expected expr with two any branches, got %+v", expr)
+	}
+	if expr.Any[0].DomainInclude != `\.gov$` || !expr.Any[1].Expired {
+		t.Errorf("unexpected expr branches: %+v", expr.Any)
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	spec.Options.Match.Expr.Any[1].All = []MatchExpr{{SubjectRegex: "("}}
+	err = spec.Validate()
+	if err == nil || !strings.Contains(err.Error(), "options.match.expr.any[1].all[0].subject_regex") {
+		t.Errorf("expected nested regex error, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package job
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Merge overlays YAML or JSON job spec documents onto a base document and
+// returns the result as YAML, ready for Decode. Mappings are merged key by
+// key, recursively; any other value in an overlay, including lists and
+// explicit nulls, replaces the base's. Later overlays win. Merging happens
+// before decoding so that fields an overlay leaves out keep the base's
+// values rather than being reset to zero.
+func Merge(base []byte, overlays ...[]byte) ([]byte, error) {
+	merged, err := decodeMapping(base)
+	if err != nil {
+		return nil, fmt.Errorf("base: %w", err)
+	}
+	for i, data := range overlays {
+		overlay, err := decodeMapping(data)
+		if err != nil {
+			return nil, fmt.Errorf("overlay %d: %w", i+1, err)
+		}
+		merged = mergeMaps(merged, overlay)
+	}
+	return yaml.Marshal(merged)
+}
+
+func decodeMapping(data []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("spec must be a YAML or JSON mapping: %w", err)
+	}
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	return m, nil
+}
+
+func mergeMaps(base, overlay map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base)+len(overlay))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range overlay {
+		bm, baseIsMap := out[k].(map[string]interface{})
+		om, overlayIsMap := v.(map[string]interface{})
+		if baseIsMap && overlayIsMap {
+			out[k] = mergeMaps(bm, om)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// SplitDocuments splits a YAML stream of "---" separated job specs into one
+// document per spec, each ready for Merge or Decode. Empty documents are
+// dropped. A JSON spec, being valid YAML, comes back as one document.
+func SplitDocuments(data []byte) ([][]byte, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var docs [][]byte
+	for i := 1; ; i++ {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if len(node.Content) == 0 || node.Content[0].ShortTag() == "!!null" {
+			continue
+		}
+		doc, err := yaml.Marshal(&node)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
@@ -0,0 +1,130 @@
+package job
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const mergeBase = `
+version: "1"
+log_uri: https://ct.example.com/log
+options:
+  fetch:
+    fetch_size: 256
+    fetch_workers: 4
+  output:
+    extractor: cert_fields
+    transformer: jsonl
+    sink: s3
+    sink_options:
+      bucket: certs
+      compression: zstd
+      access_key_secret: s3/key
+    chunk_records: 10000
+`
+
+func TestMerge(t *testing.T) {
+	overlay := `
+note: nightly run
+log_uri: https://ct.example.com/other
+options:
+  fetch:
+    fetch_workers: 16
+  match:
+    domain_include: "example\\.com$"
+  output:
+    sink_options:
+      prefix: other/
+      compression: gzip
+`
+	// JSON overlays work too
+	second := `{"options": {"output": {"chunk_records": 500}}}`
+
+	data, err := Merge([]byte(mergeBase), []byte(overlay), []byte(second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := Decode(data, true)
+	if err != nil {
+		t.Fatalf("decode merged spec: %v\n%s", err, data)
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.Version != "1" || spec.Note != "nightly run" || spec.LogURI != "https://ct.example.com/other" {
+		t.Errorf("top-level fields not merged: %+v", spec)
+	}
+	if spec.Options.Fetch.FetchSize != 256 || spec.Options.Fetch.FetchWorkers != 16 {
+		t.Errorf("fetch options not merged: %+v", spec.Options.Fetch)
+	}
+	if spec.Options.Match.DomainInclude != `example\.com$` {
+		t.Errorf("match options from the overlay missing: %+v", spec.Options.Match)
+	}
+	out := spec.Options.Output
+	if out.Extractor != "cert_fields" || out.Transformer != "jsonl" || out.Sink != "s3" || out.ChunkRecords != 500 {
+		t.Errorf("output options not merged: %+v", out)
+	}
+	wantSinkOpts := map[string]interface{}{
+		"bucket":            "certs",
+		"prefix":            "other/",
+		"compression":       "gzip",
+		"access_key_secret": "s3/key",
+	}
+	if !reflect.DeepEqual(out.SinkOptions, wantSinkOpts) {
+		t.Errorf("sink options = %v, want %v", out.SinkOptions, wantSinkOpts)
+	}
+}
+
+func TestMerge_ReplacesListsAndNonMappings(t *testing.T) {
+	base := "options:\n  output:\n    sinks:\n      - name: file\n      - name: s3\n    sink_options:\n      dir: /out\n"
+	overlay := "options:\n  output:\n    sinks:\n      - name: gcs\n    sink_options: null\n"
+	data, err := Merge([]byte(base), []byte(overlay))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := Decode(data, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := spec.Options.Output.Sinks; len(got) != 1 || got[0].Name != "gcs" {
+		t.Errorf("lists should be replaced, got %+v", got)
+	}
+	if spec.Options.Output.SinkOptions != nil {
+		t.Errorf("an explicit null should clear the base's value, got %v", spec.Options.Output.SinkOptions)
+	}
+
+	if _, err := Merge([]byte(mergeBase), []byte("- not\n- a mapping\n")); err == nil || !strings.Contains(err.Error(), "overlay 1") {
+		t.Errorf("expected an error naming the overlay, got %v", err)
+	}
+}
+
+func TestSplitDocuments(t *testing.T) {
+	stream := mergeBase + "---\n# nothing here\n---\n" + `
+version: "2"
+log_uri: https://ct.example.com/second
+`
+	docs, err := SplitDocuments([]byte(stream))
+	if err != nil {
+		t.Fatalf("SplitDocuments: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 documents, got %d", len(docs))
+	}
+	var uris []string
+	for _, doc := range docs {
+		spec, err := Decode(doc, true)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		uris = append(uris, spec.LogURI)
+	}
+	if want := []string{"https://ct.example.com/log", "https://ct.example.com/second"}; !reflect.DeepEqual(uris, want) {
+		t.Errorf("got log URIs %v, want %v", uris, want)
+	}
+
+	if _, err := SplitDocuments([]byte("version: [\n---\n")); err == nil || !strings.Contains(err.Error(), "document 1") {
+		t.Errorf("expected an error naming the bad document, got %v", err)
+	}
+}
@@ -26,6 +26,8 @@ func GenerateClusterKey() ([32]byte, error) {
 // Encrypts the cluster key with the node's public key and stores it in etcd.
 // Removes the pending registration after approval.
 func (n *Store) ApproveNode(ctx context.Context, nodeID string) error {
+	n.clusterK.writes.RLock()
+	defer n.clusterK.writes.RUnlock()
 	if !n.HasClusterKey() {
 		return errors.New("cluster key not present")
 	}
@@ -41,16 +43,61 @@ func (n *Store) ApproveNode(ctx context.Context, nodeID string) error {
 	}
 	var pubKey [32]byte
 	copy(pubKey[:], pubBytes)
-	sealed, err := box.SealAnonymous(nil, n.clusterK[:], &pubKey, rand.Reader)
+	ck := n.key()
+	sealed, err := box.SealAnonymous(nil, ck[:], &pubKey, rand.Reader)
 	if err != nil {
 		return err
 	}
 	sealedB64 := base64.StdEncoding.EncodeToString(sealed)
-	_, err = n.etcd.Put(ctx, n.Prefix()+"/secrets/keys/"+nodeID, sealedB64)
+	// The public key is kept so RotateClusterKey can seal a new key for the node
+	_, err = n.etcd.Txn(ctx).Then(
+		clientv3.OpPut(n.Prefix()+"/secrets/keys/"+nodeID, sealedB64),
+		clientv3.OpPut(n.Prefix()+"/secrets/pubkeys/"+nodeID, pubKeyB64),
+	).Commit()
 	_, _ = n.etcd.Delete(ctx, n.Prefix()+"/registration/pending/"+nodeID)
 	return err
 }
 
+// DenyNode rejects a pending node registration by removing it. The node keeps
+// waiting, and can be approved if it registers again.
+func (n *Store) DenyNode(ctx context.Context, nodeID string) error {
+	pendingKey := n.Prefix() + "/registration/pending/" + nodeID
+	resp, err := n.etcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(pendingKey), ">", 0)).
+		Then(clientv3.OpDelete(pendingKey)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return errors.New("pending registration not found")
+	}
+	return nil
+}
+
+// RevokeNode withdraws an approved node's access by removing its sealed copy
+// of the cluster key, and its public key so a key rotation doesn't seal the
+// new key for it. A node that's running keeps the key it already has; rotate
+// the cluster key to lock it out. Once restarted, the node registers again
+// and waits for approval.
+func (n *Store) RevokeNode(ctx context.Context, nodeID string) error {
+	sealedKey := n.Prefix() + "/secrets/keys/" + nodeID
+	resp, err := n.etcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(sealedKey), ">", 0)).
+		Then(
+			clientv3.OpDelete(sealedKey),
+			clientv3.OpDelete(n.Prefix()+"/secrets/pubkeys/"+nodeID),
+		).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return errors.New("node not approved")
+	}
+	return nil
+}
+
 // PendingRegistration represents a node that has requested cluster access.
 type PendingRegistration struct {
 	NodeID    string
@@ -0,0 +1,129 @@
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Operations recorded in the audit log.
+const (
+	AuditGet      = "get"
+	AuditSet      = "set"
+	AuditDelete   = "delete"
+	AuditApprove  = "approve"
+	AuditDeny     = "deny"
+	AuditRevoke   = "revoke"
+	AuditRollback = "rollback"
+	AuditRotate   = "rotate"
+)
+
+// AuditEntry records one operation on the secret store.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	// Key is the secret operated on, or for node approvals, denials and
+	// revocations, the node.
+	Key     string `json:"key,omitempty"`
+	Version int    `json:"version,omitempty"`
+	// TokenID identifies the API token used, without revealing it.
+	TokenID string `json:"token_id,omitempty"`
+	Remote  string `json:"remote,omitempty"`
+	// Node is the node that carried out the operation.
+	Node  string `json:"node,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// DefaultAuditRetention is how long audit entries are kept when
+// Store.AuditRetention is zero.
+const DefaultAuditRetention = 90 * 24 * time.Hour
+
+// auditPageSize is how many entries ListAudit reads from etcd at a time.
+const auditPageSize = 500
+
+func (n *Store) auditPrefix() string {
+	return n.Prefix() + "/secrets/audit/"
+}
+
+// auditKey orders entries by time; the random suffix keeps entries made in
+// the same nanosecond apart.
+func (n *Store) auditKey(t time.Time) string {
+	var suffix [4]byte
+	_, _ = rand.Read(suffix[:])
+	return fmt.Sprintf("%s%020d-%s", n.auditPrefix(), t.UnixNano(), hex.EncodeToString(suffix[:]))
+}
+
+// RecordAudit appends entry to the audit log. Entries are never overwritten.
+// A zero Time is set to now, and an empty Node to this store's node. Entries
+// older than the store's AuditRetention are deleted as it goes.
+func (n *Store) RecordAudit(ctx context.Context, entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if entry.Node == "" {
+		entry.Node = n.NodeId()
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	key := n.auditKey(entry.Time)
+	ops := []clientv3.Op{clientv3.OpPut(key, string(b))}
+	retention := n.AuditRetention
+	if retention == 0 {
+		retention = DefaultAuditRetention
+	}
+	if retention > 0 {
+		// Once the backlog is gone this only ever finds the odd entry. An
+		// entry already past retention is left for the next call to prune,
+		// since etcd won't put and delete the same key in one txn.
+		cutoff := fmt.Sprintf("%s%020d", n.auditPrefix(), time.Now().Add(-retention).UnixNano())
+		ops = append(ops, clientv3.OpDelete(n.auditPrefix(), clientv3.WithRange(min(cutoff, key))))
+	}
+	_, err = n.etcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(ops...).
+		Commit()
+	return err
+}
+
+// ListAudit returns up to limit audit entries (all, if it's zero or less)
+// from since on (all, if zero), oldest first, limited to those for key if
+// it's set. The log is read a page at a time.
+func (n *Store) ListAudit(ctx context.Context, key string, since time.Time, limit int) ([]AuditEntry, error) {
+	prefix := n.auditPrefix()
+	start := prefix
+	if !since.IsZero() {
+		start = fmt.Sprintf("%s%020d", prefix, since.UnixNano())
+	}
+	end := clientv3.GetPrefixRangeEnd(prefix)
+	entries := []AuditEntry{}
+	for {
+		resp, err := n.etcd.Get(ctx, start, clientv3.WithRange(end), clientv3.WithLimit(auditPageSize))
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range resp.Kvs {
+			var entry AuditEntry
+			if err := json.Unmarshal(kv.Value, &entry); err != nil {
+				continue
+			}
+			if key != "" && entry.Key != key {
+				continue
+			}
+			entries = append(entries, entry)
+			if limit > 0 && len(entries) == limit {
+				return entries, nil
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return entries, nil
+		}
+		start = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
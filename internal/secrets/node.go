@@ -91,7 +91,7 @@ func (n *Store) RegisterAndWaitForClusterKey(ctx context.Context) error {
 			sealed, _ := base64.StdEncoding.DecodeString(string(resp.Kvs[0].Value))
 			cKey, ok := box.OpenAnonymous(nil, sealed, &n.keys.Public, &n.keys.Private)
 			if ok && len(cKey) == 32 {
-				copy(n.clusterK[:], cKey)
+				n.SetClusterKey([32]byte(cKey))
 				// Optional: clean up
 				_, _ = n.etcd.Delete(ctx, n.Prefix()+"/registration/pending/"+n.NodeId())
 				return nil
@@ -0,0 +1,198 @@
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// rotateBatchSize is how many keys a rotation writes per transaction, well
+// under etcd's default limit of 128 operations.
+const rotateBatchSize = 64
+
+// RotationResult describes what RotateClusterKey changed.
+type RotationResult struct {
+	// Secrets is how many stored secrets were re-encrypted, and Versions
+	// how many entries of their history.
+	Secrets  int `json:"secrets"`
+	Versions int `json:"versions"`
+	// Resealed lists the nodes given the new cluster key.
+	Resealed []string `json:"resealed"`
+	// Dropped lists nodes whose public key isn't on record (they were
+	// approved before keys were kept), so the new cluster key couldn't be
+	// sealed for them. Their old sealed key is removed; they must register
+	// and be approved again.
+	Dropped []string `json:"dropped"`
+}
+
+// rotateMaxPasses is how many times a rotation re-scans for values written
+// under the old key while it ran before giving up.
+const rotateMaxPasses = 5
+
+// RotateClusterKey replaces the cluster key with newKey: every stored secret,
+// and every version in its history, is re-encrypted under it, and it's sealed
+// for each approved node with the node's public key. Values already encrypted
+// under newKey are left as they are, so a rotation that fails part way can be
+// run again. Writes are batched, each batch failing if a key it rewrites
+// changed since it was read.
+//
+// The store's own writes wait for the rotation, while its reads accept either
+// key. Other nodes may still write under the old key, so the secrets are
+// scanned again until a scan finds nothing left to re-encrypt. On success the
+// store uses newKey from then on. Nodes already running keep the old key in
+// memory until they restart.
+func (n *Store) RotateClusterKey(ctx context.Context, newKey [32]byte) (*RotationResult, error) {
+	n.clusterK.writes.Lock()
+	defer n.clusterK.writes.Unlock()
+	if !n.HasClusterKey() {
+		return nil, errors.New("cluster key not present")
+	}
+	var zero [32]byte
+	if newKey == zero {
+		return nil, errors.New("new cluster key is empty")
+	}
+	oldKey := n.key()
+	if newKey == oldKey {
+		return nil, errors.New("new cluster key is the same as the current one")
+	}
+
+	n.clusterK.mu.Lock()
+	n.clusterK.next = newKey
+	n.clusterK.mu.Unlock()
+	defer func() {
+		n.clusterK.mu.Lock()
+		n.clusterK.next = zero
+		n.clusterK.mu.Unlock()
+	}()
+
+	result := &RotationResult{Resealed: []string{}, Dropped: []string{}}
+	for pass := 1; ; pass++ {
+		secrets, versions, err := n.reencrypt(ctx, &oldKey, &newKey)
+		if err != nil {
+			return nil, err
+		}
+		result.Secrets += secrets
+		result.Versions += versions
+		if secrets+versions == 0 {
+			break
+		}
+		if pass == rotateMaxPasses {
+			return nil, errors.New("secrets kept being written under the old key during rotation; run it again")
+		}
+	}
+
+	keysPrefix := n.Prefix() + "/secrets/keys/"
+	resp, err := n.etcd.Get(ctx, keysPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+	var ops []clientv3.Op
+	for _, kv := range resp.Kvs {
+		nodeID := strings.TrimPrefix(string(kv.Key), keysPrefix)
+		pubKey, ok, err := n.nodePublicKey(ctx, nodeID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			ops = append(ops, clientv3.OpDelete(string(kv.Key)))
+			result.Dropped = append(result.Dropped, nodeID)
+			continue
+		}
+		sealed, err := box.SealAnonymous(nil, newKey[:], &pubKey, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, clientv3.OpPut(string(kv.Key), base64.StdEncoding.EncodeToString(sealed)))
+		result.Resealed = append(result.Resealed, nodeID)
+	}
+	if err := n.commitBatches(ctx, nil, ops); err != nil {
+		return nil, err
+	}
+
+	n.SetClusterKey(newKey)
+	return result, nil
+}
+
+// reencrypt rewrites every stored secret and version still encrypted under
+// oldKey with newKey, and returns how many of each it rewrote.
+func (n *Store) reencrypt(ctx context.Context, oldKey, newKey *[32]byte) (secrets, versions int, err error) {
+	storePrefix := n.Prefix() + "/secrets/store/"
+	versionsPrefix := n.Prefix() + "/secrets/versions/"
+	var ops []clientv3.Op
+	var cmps []clientv3.Cmp
+	for _, prefix := range []string{storePrefix, versionsPrefix} {
+		resp, err := n.etcd.Get(ctx, prefix, clientv3.WithPrefix())
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, kv := range resp.Kvs {
+			key := strings.TrimPrefix(string(kv.Key), prefix)
+			if prefix == versionsPrefix && strings.HasSuffix(key, "/current") {
+				continue
+			}
+			plain, err := openValue(oldKey, kv.Value)
+			if err != nil {
+				if _, err := openValue(newKey, kv.Value); err == nil {
+					continue
+				}
+				return 0, 0, fmt.Errorf("secret %q: %w", key, err)
+			}
+			sealed := EncryptValue(*newKey, plain)
+			ops = append(ops, clientv3.OpPut(string(kv.Key), base64.StdEncoding.EncodeToString(sealed)))
+			cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(string(kv.Key)), "=", kv.ModRevision))
+			if prefix == storePrefix {
+				secrets++
+			} else {
+				versions++
+			}
+		}
+	}
+	if err := n.commitBatches(ctx, cmps, ops); err != nil {
+		return 0, 0, err
+	}
+	return secrets, versions, nil
+}
+
+// nodePublicKey returns the public key recorded when nodeID was approved.
+func (n *Store) nodePublicKey(ctx context.Context, nodeID string) ([32]byte, bool, error) {
+	var pubKey [32]byte
+	resp, err := n.etcd.Get(ctx, n.Prefix()+"/secrets/pubkeys/"+nodeID)
+	if err != nil {
+		return pubKey, false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return pubKey, false, nil
+	}
+	pubBytes, _ := base64.StdEncoding.DecodeString(string(resp.Kvs[0].Value))
+	if len(pubBytes) != 32 {
+		return pubKey, false, nil
+	}
+	copy(pubKey[:], pubBytes)
+	return pubKey, true, nil
+}
+
+// commitBatches commits ops in transactions of up to rotateBatchSize, each
+// guarded by the matching cmps (which may be empty).
+func (n *Store) commitBatches(ctx context.Context, cmps []clientv3.Cmp, ops []clientv3.Op) error {
+	for start := 0; start < len(ops); start += rotateBatchSize {
+		end := min(start+rotateBatchSize, len(ops))
+		txn := n.etcd.Txn(ctx)
+		if len(cmps) > 0 {
+			txn = txn.If(cmps[start:end]...)
+		}
+		resp, err := txn.Then(ops[start:end]...).Commit()
+		if err != nil {
+			return err
+		}
+		if !resp.Succeeded {
+			return errors.New("secrets changed during rotation; run it again")
+		}
+	}
+	return nil
+}
@@ -3,6 +3,9 @@
 package secrets
 
 import (
+	"sync"
+	"time"
+
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -15,11 +18,41 @@ type Store struct {
 	NodeID   string
 	prefix   string
 	keyPath  string
-	clusterK [32]byte
+	clusterK *clusterKey
+
+	// AuditRetention is how long audit entries are kept. Zero means
+	// DefaultAuditRetention, and a negative value keeps them for good.
+	AuditRetention time.Duration
+
+	// cache holds plaintext secrets preloaded by WithCache; Get consults it
+	// before etcd.
+	cache map[string][]byte
+}
+
+// clusterKey holds the cluster key. A Store and its WithCache copies share
+// it, so a rotation through one is seen by all of them.
+type clusterKey struct {
+	mu   sync.RWMutex
+	key  [32]byte
+	next [32]byte // the key being rotated to, while a rotation runs
+
+	// writes is held by Set, SetSealed, Rollback and ApproveNode while they
+	// write, and by RotateClusterKey while it runs, so nothing is written
+	// under the old key once a rotation has started.
+	writes sync.RWMutex
 }
 
 func (s *Store) SetClusterKey(key [32]byte) {
-	s.clusterK = key
+	s.clusterK.mu.Lock()
+	defer s.clusterK.mu.Unlock()
+	s.clusterK.key = key
+}
+
+// key returns the cluster key.
+func (s *Store) key() [32]byte {
+	s.clusterK.mu.RLock()
+	defer s.clusterK.mu.RUnlock()
+	return s.clusterK.key
 }
 
 func (s *Store) NodeId() string {
@@ -40,7 +73,7 @@ func (s *Store) PrivateKey() [32]byte {
 
 func (s *Store) HasClusterKey() bool {
 	var zero [32]byte
-	return s.clusterK != zero
+	return s.key() != zero
 }
 
 func (s *Store) Client() *clientv3.Client {
@@ -56,10 +89,11 @@ func NewStore(etcd *clientv3.Client, keyPath, prefix string) (*Store, error) {
 		return nil, err
 	}
 	return &Store{
-		etcd:    etcd,
-		keys:    keys,
-		NodeID:  nodeID,
-		prefix:  prefix,
-		keyPath: keyPath,
+		etcd:     etcd,
+		keys:     keys,
+		NodeID:   nodeID,
+		prefix:   prefix,
+		keyPath:  keyPath,
+		clusterK: &clusterKey{},
 	}, nil
 }
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"strings"
 
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -32,26 +33,28 @@ func (s *Store) List(ctx context.Context, prefix string) ([]string, error) {
 }
 
 // Set encrypts the provided value with the cluster key and stores it in etcd
-// under the given key. Overwrites any existing value. Returns an error on failure.
+// under the given key as a new version (see ListVersions), which becomes the
+// current value. Returns an error on failure.
 func (n *Store) Set(ctx context.Context, key string, value []byte) error {
+	n.clusterK.writes.RLock()
+	defer n.clusterK.writes.RUnlock()
 	if !n.HasClusterKey() {
 		return errors.New("cluster key not present")
 	}
 
+	ck := n.key()
 	var nonce [24]byte
 	_, _ = rand.Read(nonce[:])
-	sealed := secretbox.Seal(nonce[:], value, &nonce, &n.clusterK)
-	b64 := base64.StdEncoding.EncodeToString(sealed)
-	_, err := n.etcd.Put(ctx, n.Prefix()+"/secrets/store/"+key, b64)
-	return err
+	sealed := secretbox.Seal(nonce[:], value, &nonce, &ck)
+	return n.put(ctx, key, base64.StdEncoding.EncodeToString(sealed))
 }
 
-// SetSealed stores a pre-encryprted value in etcd
-// under the given key. Overwrites any existing value. Returns an error on failure.
+// SetSealed stores a pre-encryprted value in etcd under the given key as a
+// new version, like Set. Returns an error on failure.
 func (n *Store) SetSealed(ctx context.Context, key string, value []byte) error {
-	b64 := base64.StdEncoding.EncodeToString(value)
-	_, err := n.etcd.Put(ctx, n.Prefix()+"/secrets/store/"+key, b64)
-	return err
+	n.clusterK.writes.RLock()
+	defer n.clusterK.writes.RUnlock()
+	return n.put(ctx, key, base64.StdEncoding.EncodeToString(value))
 }
 
 // EncryptValue encrypts a given value with a provided cluster key
@@ -67,27 +70,103 @@ func (n *Store) Get(ctx context.Context, key string) ([]byte, error) {
 	if !n.HasClusterKey() {
 		return nil, errors.New("cluster key not present")
 	}
+	if plain, ok := n.cache[key]; ok {
+		return plain, nil
+	}
 
 	resp, err := n.etcd.Get(ctx, n.Prefix()+"/secrets/store/"+key)
 	if err != nil || len(resp.Kvs) == 0 {
 		return nil, errors.New("secret not found")
 	}
-	sealed, _ := base64.StdEncoding.DecodeString(string(resp.Kvs[0].Value))
+	return n.open(resp.Kvs[0].Value)
+}
+
+// GetMany retrieves and decrypts several secrets in a single etcd round trip.
+// Keys that do not exist are omitted from the result; an error is returned
+// if the read or any decryption fails.
+func (n *Store) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	if !n.HasClusterKey() {
+		return nil, errors.New("cluster key not present")
+	}
+	if len(keys) == 0 {
+		return map[string][]byte{}, nil
+	}
+
+	ops := make([]clientv3.Op, len(keys))
+	for i, key := range keys {
+		ops[i] = clientv3.OpGet(n.Prefix() + "/secrets/store/" + key)
+	}
+	resp, err := n.etcd.Txn(ctx).Then(ops...).Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte, len(keys))
+	for i, r := range resp.Responses {
+		kvs := r.GetResponseRange().GetKvs()
+		if len(kvs) == 0 {
+			continue
+		}
+		plain, err := n.open(kvs[0].Value)
+		if err != nil {
+			return nil, fmt.Errorf("secret %q: %w", keys[i], err)
+		}
+		values[keys[i]] = plain
+	}
+	return values, nil
+}
+
+// WithCache returns a copy of the store whose Get serves the given values from
+// memory, falling back to etcd for any other key. Writes are not cached.
+func (n *Store) WithCache(values map[string][]byte) *Store {
+	c := *n
+	c.cache = make(map[string][]byte, len(n.cache)+len(values))
+	for k, v := range n.cache {
+		c.cache[k] = v
+	}
+	for k, v := range values {
+		c.cache[k] = v
+	}
+	return &c
+}
+
+// open decodes and decrypts a stored secret value. While a rotation runs,
+// values it has already re-encrypted are opened with the key it rotates to.
+func (n *Store) open(value []byte) ([]byte, error) {
+	n.clusterK.mu.RLock()
+	key, next := n.clusterK.key, n.clusterK.next
+	n.clusterK.mu.RUnlock()
+	plain, err := openValue(&key, value)
+	var zero [32]byte
+	if err != nil && next != zero {
+		if plain, err := openValue(&next, value); err == nil {
+			return plain, nil
+		}
+	}
+	return plain, err
+}
+
+// openValue decodes a stored secret value and decrypts it with key.
+func openValue(key *[32]byte, value []byte) ([]byte, error) {
+	sealed, _ := base64.StdEncoding.DecodeString(string(value))
 	if len(sealed) < 24 {
 		return nil, errors.New("invalid secret data")
 	}
 	var nonce [24]byte
 	copy(nonce[:], sealed[:24])
-	plain, ok := secretbox.Open(nil, sealed[24:], &nonce, &n.clusterK)
+	plain, ok := secretbox.Open(nil, sealed[24:], &nonce, key)
 	if !ok {
 		return nil, errors.New("decryption failed")
 	}
 	return plain, nil
 }
 
-// Delete removes the secret stored under the given key from etcd.
-// Returns an error if the operation fails.
+// Delete removes the secret stored under the given key from etcd, along with
+// its history. Returns an error if the operation fails.
 func (s *Store) Delete(ctx context.Context, key string) error {
-	_, err := s.etcd.Delete(ctx, s.Prefix()+"/secrets/store/"+key)
+	_, err := s.etcd.Txn(ctx).Then(
+		clientv3.OpDelete(s.Prefix()+"/secrets/store/"+key),
+		clientv3.OpDelete(s.versionPrefix(key), clientv3.WithPrefix()),
+	).Commit()
 	return err
 }
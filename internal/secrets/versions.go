@@ -0,0 +1,175 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Every value written to a secret is kept as a numbered version under
+// /secrets/versions/<key>/v<n>, with /secrets/versions/<key>/current naming
+// the one in use. The current value is also kept at /secrets/store/<key>, so
+// Get, GetMany and List read it as they always have. Keys are query-escaped
+// in version paths so that a key like "a/v1" can't be confused with a
+// version of "a".
+
+// SecretVersion describes one stored version of a secret.
+type SecretVersion struct {
+	Version int  `json:"version"`
+	Current bool `json:"current"`
+}
+
+func (n *Store) versionPrefix(key string) string {
+	return n.Prefix() + "/secrets/versions/" + url.QueryEscape(key) + "/"
+}
+
+func (n *Store) versionKey(key string, version int) string {
+	return fmt.Sprintf("%sv%d", n.versionPrefix(key), version)
+}
+
+// put stores b64, an encoded sealed value, as a new version of key and makes
+// it current. A value stored before versioning existed is kept as version 1
+// the first time it's replaced.
+func (n *Store) put(ctx context.Context, key, b64 string) error {
+	storeKey := n.Prefix() + "/secrets/store/" + key
+	for {
+		versions, err := n.versions(ctx, key)
+		if err != nil {
+			return err
+		}
+		next := 1
+		if len(versions) > 0 {
+			next = versions[len(versions)-1] + 1
+		}
+
+		var ops []clientv3.Op
+		if next == 1 {
+			resp, err := n.etcd.Get(ctx, storeKey)
+			if err != nil {
+				return err
+			}
+			if len(resp.Kvs) > 0 {
+				ops = append(ops, clientv3.OpPut(n.versionKey(key, 1), string(resp.Kvs[0].Value)))
+				next = 2
+			}
+		}
+		vkey := n.versionKey(key, next)
+		ops = append(ops,
+			clientv3.OpPut(vkey, b64),
+			clientv3.OpPut(n.versionPrefix(key)+"current", strconv.Itoa(next)),
+			clientv3.OpPut(storeKey, b64),
+		)
+		resp, err := n.etcd.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(vkey), "=", 0)).
+			Then(ops...).
+			Commit()
+		if err != nil {
+			return err
+		}
+		if resp.Succeeded {
+			return nil
+		}
+		// Another writer took this version number; try the next
+	}
+}
+
+// versions returns the version numbers stored for key, in ascending order.
+func (n *Store) versions(ctx context.Context, key string) ([]int, error) {
+	prefix := n.versionPrefix(key) + "v"
+	resp, err := n.etcd.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		v, err := strconv.Atoi(strings.TrimPrefix(string(kv.Key), prefix))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// ListVersions returns the stored versions of key, oldest first. Secrets
+// last set before versioning existed have none.
+func (n *Store) ListVersions(ctx context.Context, key string) ([]SecretVersion, error) {
+	versions, err := n.versions(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	current := 0
+	resp, err := n.etcd.Get(ctx, n.versionPrefix(key)+"current")
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) > 0 {
+		current, _ = strconv.Atoi(string(resp.Kvs[0].Value))
+	}
+	out := make([]SecretVersion, len(versions))
+	for i, v := range versions {
+		out[i] = SecretVersion{Version: v, Current: v == current}
+	}
+	return out, nil
+}
+
+// GetSealedVersion returns version of key as it's stored: base64 of the
+// sealed value.
+func (n *Store) GetSealedVersion(ctx context.Context, key string, version int) (string, error) {
+	resp, err := n.etcd.Get(ctx, n.versionKey(key, version))
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return "", fmt.Errorf("version %d of secret %q not found", version, key)
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// GetVersion retrieves and decrypts version of key.
+func (n *Store) GetVersion(ctx context.Context, key string, version int) ([]byte, error) {
+	if !n.HasClusterKey() {
+		return nil, errors.New("cluster key not present")
+	}
+	value, err := n.GetSealedVersion(ctx, key, version)
+	if err != nil {
+		return nil, err
+	}
+	return n.open([]byte(value))
+}
+
+// Rollback makes version the current value of key. Later versions are kept,
+// and the next Set still adds a new version after the highest.
+func (n *Store) Rollback(ctx context.Context, key string, version int) error {
+	n.clusterK.writes.RLock()
+	defer n.clusterK.writes.RUnlock()
+	vkey := n.versionKey(key, version)
+	resp, err := n.etcd.Get(ctx, vkey)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return fmt.Errorf("version %d of secret %q not found", version, key)
+	}
+	txn, err := n.etcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(vkey), "=", resp.Kvs[0].ModRevision)).
+		Then(
+			clientv3.OpPut(n.Prefix()+"/secrets/store/"+key, string(resp.Kvs[0].Value)),
+			clientv3.OpPut(n.versionPrefix(key)+"current", strconv.Itoa(version)),
+		).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return fmt.Errorf("version %d of secret %q changed during rollback", version, key)
+	}
+	return nil
+}
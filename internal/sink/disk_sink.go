@@ -3,8 +3,10 @@ package sink
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/chtzvt/certslurp/internal/secrets"
 )
@@ -33,6 +35,14 @@ func (d *DiskSink) Open(ctx context.Context, name string) (SinkWriter, error) {
 	return &diskSinkWriter{f}, nil
 }
 
+func (d *DiskSink) OpenReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	fullPath := filepath.Join(d.baseDir, name)
+	if rel, err := filepath.Rel(d.baseDir, fullPath); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("invalid output name %q", name)
+	}
+	return os.Open(fullPath)
+}
+
 type diskSinkWriter struct {
 	f *os.File
 }
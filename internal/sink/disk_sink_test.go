@@ -3,6 +3,7 @@ package sink
 import (
 	"bytes"
 	"context"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -70,3 +71,35 @@ func TestDiskSinkMkdirAll(t *testing.T) {
 		t.Fatalf("Write failed: %v", err)
 	}
 }
+
+func TestDiskSinkOpenReader(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskSink(map[string]interface{}{"path": dir}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create DiskSink: %v", err)
+	}
+	w, err := s.Open(context.Background(), "out/chunk.0001")
+	if err != nil {
+		t.Fatalf("Failed to open sink writer: %v", err)
+	}
+	w.Write([]byte("readback"))
+	w.Close()
+
+	rs, ok := s.(ReadableSink)
+	if !ok {
+		t.Fatal("expected DiskSink to implement ReadableSink")
+	}
+	rc, err := rs.OpenReader(context.Background(), "out/chunk.0001")
+	if err != nil {
+		t.Fatalf("OpenReader failed: %v", err)
+	}
+	defer rc.Close()
+	b, _ := io.ReadAll(rc)
+	if string(b) != "readback" {
+		t.Errorf("got %q, want %q", b, "readback")
+	}
+
+	if _, err := rs.OpenReader(context.Background(), "../escape"); err == nil {
+		t.Error("expected OpenReader to reject names outside the sink directory")
+	}
+}
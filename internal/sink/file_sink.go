@@ -0,0 +1,146 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chtzvt/certslurp/internal/compression"
+	"github.com/chtzvt/certslurp/internal/secrets"
+)
+
+// FileSink writes each chunk to a file under a local directory. Chunks are
+// staged in a temp file beside their destination and renamed into place on
+// Close, so readers never observe a partially written chunk.
+type FileSink struct {
+	dir       string
+	ext       string
+	overwrite bool
+	fsync     bool
+}
+
+func NewFileSink(opts map[string]interface{}, _ *secrets.Store) (Sink, error) {
+	dir, _ := opts["dir"].(string)
+	comp, _ := opts["compression"].(string)
+	overwrite, _ := opts["overwrite"].(bool)
+	fsync, _ := opts["fsync"].(bool)
+
+	if dir == "" {
+		return nil, fmt.Errorf("file sink requires 'dir' option")
+	}
+	switch comp {
+	case "", "none", "gzip", "bzip2", "zstd", "lz4", "brotli":
+	default:
+		return nil, fmt.Errorf("file sink: unsupported compression: %s", comp)
+	}
+
+	return &FileSink{
+		dir:       dir,
+		ext:       compression.Extension(comp),
+		overwrite: overwrite,
+		fsync:     fsync,
+	}, nil
+}
+
+// path returns the destination of the named chunk. The pipeline has already
+// compressed the stream, so the sink only appends the matching extension.
+func (s *FileSink) path(name string) (string, error) {
+	fullPath := filepath.Join(s.dir, name+s.ext)
+	if rel, err := filepath.Rel(s.dir, fullPath); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid output name %q", name)
+	}
+	return fullPath, nil
+}
+
+func (s *FileSink) Open(ctx context.Context, name string) (SinkWriter, error) {
+	dest, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return nil, err
+	}
+	if !s.overwrite {
+		if _, err := os.Stat(dest); err == nil {
+			return nil, fmt.Errorf("file sink: %s: %w", dest, fs.ErrExist)
+		}
+	}
+	f, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	return &fileSinkWriter{f: f, dest: dest, overwrite: s.overwrite, fsync: s.fsync}, nil
+}
+
+func (s *FileSink) OpenReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	fullPath, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fullPath)
+}
+
+type fileSinkWriter struct {
+	f         *os.File
+	dest      string
+	overwrite bool
+	fsync     bool
+}
+
+func (w *fileSinkWriter) Write(p []byte) (int, error) {
+	return w.f.Write(p)
+}
+
+func (w *fileSinkWriter) Close() error {
+	tmp := w.f.Name()
+	defer os.Remove(tmp) // no-op once renamed or linked into place
+
+	if w.fsync {
+		if err := w.f.Sync(); err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+
+	if w.overwrite {
+		if err := os.Rename(tmp, w.dest); err != nil {
+			return err
+		}
+	} else {
+		// Link fails if the destination appeared since Open, where a rename
+		// would silently replace it.
+		if err := os.Link(tmp, w.dest); err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				return fmt.Errorf("file sink: %s: %w", w.dest, fs.ErrExist)
+			}
+			return err
+		}
+	}
+
+	if w.fsync {
+		return syncDir(filepath.Dir(w.dest))
+	}
+	return nil
+}
+
+// syncDir flushes a directory entry so a rename into it survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func init() {
+	Register("file", NewFileSink)
+}
@@ -0,0 +1,155 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chtzvt/certslurp/internal/compression"
+)
+
+func TestFileSinkCompressionExtension(t *testing.T) {
+	payload := []byte("file sink payload\nfile sink payload\n")
+	for comp, ext := range map[string]string{"": "", "none": "", "gzip": ".gz", "bzip2": ".bz2", "zstd": ".zst", "lz4": ".lz4", "brotli": ".br"} {
+		t.Run(comp, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := NewFileSink(map[string]interface{}{"dir": dir, "compression": comp, "fsync": true}, nil)
+			if err != nil {
+				t.Fatalf("NewFileSink: %v", err)
+			}
+
+			// Compress the way the pipeline does before handing bytes to the sink
+			sw, err := s.Open(context.Background(), "nested/chunk.0001")
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			w, err := compression.NewWriter(sw, comp)
+			if err != nil {
+				t.Fatalf("NewWriter: %v", err)
+			}
+			if _, err := w.Write(payload); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			f, err := os.Open(filepath.Join(dir, "nested", "chunk.0001"+ext))
+			if err != nil {
+				t.Fatalf("expected chunk with extension %q: %v", ext, err)
+			}
+			defer f.Close()
+			r, err := compression.NewReader(f, comp)
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if string(got) != string(payload) {
+				t.Errorf("got %q, want %q", got, payload)
+			}
+
+			entries, _ := os.ReadDir(filepath.Join(dir, "nested"))
+			if len(entries) != 1 {
+				t.Errorf("expected only the chunk in the directory, found %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestFileSinkAtomicClose(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileSink(map[string]interface{}{"dir": dir}, nil)
+	if err != nil {
+		t.Fatalf("NewFileSink: %v", err)
+	}
+	w, err := s.Open(context.Background(), "chunk")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	w.Write([]byte("partial"))
+
+	if _, err := os.Stat(filepath.Join(dir, "chunk")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("chunk visible before Close: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	rc, err := s.(ReadableSink).OpenReader(context.Background(), "chunk")
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	defer rc.Close()
+	b, _ := io.ReadAll(rc)
+	if string(b) != "partial" {
+		t.Errorf("got %q, want %q", b, "partial")
+	}
+}
+
+func TestFileSinkOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	write := func(s Sink, data string) error {
+		w, err := s.Open(context.Background(), "chunk")
+		if err != nil {
+			return err
+		}
+		w.Write([]byte(data))
+		return w.Close()
+	}
+
+	s, _ := NewFileSink(map[string]interface{}{"dir": dir}, nil)
+	if err := write(s, "first"); err != nil {
+		t.Fatalf("first write: %v", err)
+	}
+	if err := write(s, "second"); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected ErrExist without overwrite, got %v", err)
+	}
+
+	// A destination created after Open is not clobbered either
+	w, err := s.Open(context.Background(), "late")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "late"), []byte("other"), 0644)
+	w.Write([]byte("mine"))
+	if err := w.Close(); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected ErrExist for late destination, got %v", err)
+	}
+
+	s, _ = NewFileSink(map[string]interface{}{"dir": dir, "overwrite": true}, nil)
+	if err := write(s, "second"); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "chunk"))
+	if string(b) != "second" {
+		t.Errorf("got %q, want %q", b, "second")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("expected no leftover temp files, found %d entries", len(entries))
+	}
+}
+
+func TestFileSinkOptions(t *testing.T) {
+	if _, err := NewFileSink(map[string]interface{}{}, nil); err == nil {
+		t.Error("expected error without dir")
+	}
+	if _, err := NewFileSink(map[string]interface{}{"dir": "x", "compression": "lzma"}, nil); err == nil {
+		t.Error("expected error for unsupported compression")
+	}
+	s, _ := NewFileSink(map[string]interface{}{"dir": t.TempDir()}, nil)
+	if _, err := s.Open(context.Background(), "../escape"); err == nil {
+		t.Error("expected Open to reject names outside the sink directory")
+	}
+	if _, ok := ForName("file"); !ok {
+		t.Error("file sink not registered")
+	}
+}
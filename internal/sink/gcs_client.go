@@ -0,0 +1,70 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// gcsClient uploads objects with the Cloud Storage client library, which
+// handles authentication, token refresh and retries.
+type gcsClient struct {
+	client *storage.Client
+}
+
+// newGCSClient authenticates with a service account key, or not at all when
+// talking to an emulator at endpoint without one.
+func newGCSClient(ctx context.Context, credentialsJSON []byte, endpoint string) (*gcsClient, error) {
+	var opts []option.ClientOption
+	if len(credentialsJSON) > 0 {
+		// Other credential types can make the library read local files and
+		// URLs named in them
+		var creds struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(credentialsJSON, &creds); err != nil {
+			return nil, fmt.Errorf("parse GCS service account JSON: %w", err)
+		}
+		if creds.Type != "service_account" {
+			return nil, fmt.Errorf("GCS credentials are %q, not a service account key", creds.Type)
+		}
+		opts = append(opts, option.WithCredentialsJSON(credentialsJSON))
+	} else {
+		opts = append(opts, option.WithoutAuthentication())
+	}
+	if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(strings.TrimRight(endpoint, "/")+"/storage/v1/"))
+	}
+
+	// The client is kept for later Opens, so it mustn't end with this one
+	client, err := storage.NewClient(context.WithoutCancel(ctx), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("gcs client: %w", err)
+	}
+	return &gcsClient{client: client}, nil
+}
+
+func (c *gcsClient) Upload(ctx context.Context, bucket, object string, body io.Reader, attrs GCSObjectAttrs) error {
+	// Cancelling the writer's context is how an upload is abandoned
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := c.client.Bucket(bucket).Object(object).NewWriter(ctx)
+	w.ContentType = attrs.ContentType
+	// The body is already buffered in full, so send it in a single request
+	w.ChunkSize = 0
+	if _, err := io.Copy(w, body); err != nil {
+		cancel()
+		_ = w.Close()
+		return fmt.Errorf("gcs upload %s/%s: %w", bucket, object, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("gcs upload %s/%s: %w", bucket, object, err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/chtzvt/certslurp/internal/secrets"
+)
+
+type GCSSink struct {
+	bucket          string
+	prefix          string
+	compression     string
+	credentialsName string
+	secrets         *secrets.Store
+	endpoint        string
+	Client          GCSUploadAPI // test only; nil in prod, set by test
+	bufferType      string
+
+	clientMu sync.Mutex
+	client   *gcsClient // created on first Open and reused after
+}
+
+// GCSObjectAttrs are the object metadata set on upload.
+type GCSObjectAttrs struct {
+	ContentType string
+}
+
+type GCSUploadAPI interface {
+	Upload(ctx context.Context, bucket, object string, body io.Reader, attrs GCSObjectAttrs) error
+}
+
+type gcsSinkWriter struct {
+	ctx      context.Context
+	client   GCSUploadAPI
+	bucket   string
+	object   string
+	attrs    GCSObjectAttrs
+	buf      *bytes.Buffer // nil if disk
+	file     *os.File      // nil if memory
+	closer   io.Closer
+	diskMode bool
+}
+
+func (w *gcsSinkWriter) Write(p []byte) (int, error) {
+	if w.diskMode {
+		return w.file.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+func (w *gcsSinkWriter) Close() error {
+	defer w.closer.Close()
+	var reader io.Reader
+
+	if w.diskMode {
+		defer os.Remove(w.file.Name())
+		if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		reader = w.file
+	} else {
+		reader = bytes.NewReader(w.buf.Bytes())
+	}
+
+	return w.client.Upload(w.ctx, w.bucket, w.object, reader, w.attrs)
+}
+
+func NewGCSSink(opts map[string]interface{}, secrets *secrets.Store) (Sink, error) {
+	bucket, _ := opts["bucket"].(string)
+	prefix, _ := opts["prefix"].(string)
+	comp, _ := opts["compression"].(string)
+	credentialsName, _ := opts["credentials_secret"].(string)
+	endpoint, _ := opts["endpoint"].(string)
+
+	bufferType := "memory"
+	if v, ok := opts["buffer_type"].(string); ok && v == "disk" {
+		bufferType = "disk"
+	}
+
+	if bucket == "" {
+		return nil, fmt.Errorf("gcs sink requires 'bucket' option")
+	}
+	// An emulator endpoint may be used without credentials.
+	if credentialsName == "" && endpoint == "" {
+		return nil, fmt.Errorf("gcs sink requires 'credentials_secret' option")
+	}
+	switch comp {
+	case "", "none", "gzip", "bzip2", "zstd", "lz4", "brotli":
+	default:
+		return nil, fmt.Errorf("gcs sink: unsupported compression: %s", comp)
+	}
+
+	return &GCSSink{
+		bucket:          bucket,
+		prefix:          prefix,
+		compression:     comp,
+		credentialsName: credentialsName,
+		secrets:         secrets,
+		endpoint:        endpoint,
+		bufferType:      bufferType,
+	}, nil
+}
+
+func (s *GCSSink) Open(ctx context.Context, name string) (SinkWriter, error) {
+	var client GCSUploadAPI
+	if s.Client != nil {
+		client = s.Client // test: injected
+	} else {
+		c, err := s.defaultClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		client = c
+	}
+
+	var file *os.File
+	var buf *bytes.Buffer
+	var closer io.Closer
+
+	if s.bufferType == "disk" {
+		f, err := os.CreateTemp("", "certslurp-gcs-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp file: %w", err)
+		}
+		file = f
+		closer = file
+	} else {
+		buf = &bytes.Buffer{}
+		closer = nopCloser{}
+	}
+
+	return &gcsSinkWriter{
+		ctx:      ctx,
+		client:   client,
+		bucket:   s.bucket,
+		object:   BuildS3Key(s.prefix, name),
+		attrs:    GCSObjectAttrs{ContentType: gcsContentType(s.compression)},
+		buf:      buf,
+		file:     file,
+		closer:   closer,
+		diskMode: s.bufferType == "disk",
+	}, nil
+}
+
+func (s *GCSSink) defaultClient(ctx context.Context) (*gcsClient, error) {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	var creds []byte
+	if s.credentialsName != "" {
+		var err error
+		creds, err = s.secrets.Get(ctx, s.credentialsName)
+		if err != nil {
+			return nil, fmt.Errorf("missing GCS service account credential '%s': %w", s.credentialsName, err)
+		}
+	}
+	c, err := newGCSClient(ctx, creds, s.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	s.client = c
+	return c, nil
+}
+
+// gcsContentType labels objects by the compression the pipeline applied to
+// them (sink_options.compression). Content-Encoding is deliberately not set,
+// since GCS would then transparently decompress gzip objects on download.
+func gcsContentType(comp string) string {
+	switch comp {
+	case "gzip":
+		return "application/gzip"
+	case "bzip2":
+		return "application/x-bzip2"
+	case "zstd":
+		return "application/zstd"
+	case "lz4":
+		return "application/x-lz4"
+	case "brotli":
+		return "application/x-brotli"
+	}
+	return "application/octet-stream"
+}
+
+func init() {
+	Register("gcs", NewGCSSink)
+}
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/chtzvt/certslurp/internal/secrets"
@@ -15,6 +18,8 @@ type HTTPSink struct {
 	compression string
 	maxRetries  int
 	headers     map[string]string
+	tokenName   string
+	secrets     *secrets.Store
 	client      *http.Client
 }
 
@@ -28,9 +33,14 @@ func NewHTTPSink(opts map[string]interface{}, secrets *secrets.Store) (Sink, err
 		compression = "none"
 	}
 	maxRetries := 3
-	if v, ok := opts["max_retries"].(float64); ok && v > 0 {
-		maxRetries = int(v)
+	if v := toInt(opts["max_retries"]); v > 0 {
+		maxRetries = v
 	}
+	timeout := 120 * time.Second
+	if v := toInt(opts["timeout_secs"]); v > 0 {
+		timeout = time.Duration(v) * time.Second
+	}
+	tokenName, _ := opts["bearer_token_secret"].(string)
 	headers := map[string]string{}
 	if m, ok := opts["headers"].(map[string]interface{}); ok {
 		for k, v := range m {
@@ -44,7 +54,9 @@ func NewHTTPSink(opts map[string]interface{}, secrets *secrets.Store) (Sink, err
 		compression: compression,
 		maxRetries:  maxRetries,
 		headers:     headers,
-		client:      &http.Client{Timeout: 120 * time.Second},
+		tokenName:   tokenName,
+		secrets:     secrets,
+		client:      &http.Client{Timeout: timeout},
 	}, nil
 }
 
@@ -52,14 +64,27 @@ type httpSinkWriter struct {
 	sink   *HTTPSink
 	ctx    context.Context
 	buf    *bytes.Buffer
+	token  string
 	closed bool
 }
 
 func (s *HTTPSink) Open(ctx context.Context, name string) (SinkWriter, error) {
+	var token string
+	if s.tokenName != "" {
+		if s.secrets == nil {
+			return nil, errors.New("http sink: secrets store not available for 'bearer_token_secret'")
+		}
+		secret, err := s.secrets.Get(ctx, s.tokenName)
+		if err != nil {
+			return nil, fmt.Errorf("missing HTTP bearer token secret '%s': %w", s.tokenName, err)
+		}
+		token = strings.TrimSpace(string(secret))
+	}
 	return &httpSinkWriter{
-		sink: s,
-		ctx:  ctx,
-		buf:  &bytes.Buffer{},
+		sink:  s,
+		ctx:   ctx,
+		buf:   &bytes.Buffer{},
+		token: token,
 	}, nil
 }
 
@@ -77,6 +102,7 @@ func (w *httpSinkWriter) Close() error {
 	w.closed = true
 
 	// Retry logic
+	var lastErr error
 	for attempt := 1; attempt <= w.sink.maxRetries; attempt++ {
 		req, err := http.NewRequestWithContext(w.ctx, "POST", w.sink.endpoint, bytes.NewReader(w.buf.Bytes()))
 		if err != nil {
@@ -85,6 +111,9 @@ func (w *httpSinkWriter) Close() error {
 		for k, v := range w.sink.headers {
 			req.Header.Set(k, v)
 		}
+		if w.token != "" {
+			req.Header.Set("Authorization", "Bearer "+w.token)
+		}
 		// Set compression headers for already-compressed content
 		switch w.sink.compression {
 		case "gzip":
@@ -93,18 +122,41 @@ func (w *httpSinkWriter) Close() error {
 			req.Header.Set("Content-Encoding", "x-bzip2")
 		case "zstd":
 			req.Header.Set("Content-Encoding", "zstd")
+		case "lz4":
+			req.Header.Set("Content-Encoding", "x-lz4")
+		case "brotli":
+			req.Header.Set("Content-Encoding", "br")
 		}
 		resp, err := w.sink.client.Do(req)
-		if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if err != nil {
+			lastErr = err
+		} else {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
 			_ = resp.Body.Close()
-			return nil
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return nil
+			}
+			lastErr = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+			if !retryableHTTPStatus(resp.StatusCode) {
+				return fmt.Errorf("http sink: POST %s: %w", w.sink.endpoint, lastErr)
+			}
 		}
-		if resp != nil {
-			_ = resp.Body.Close()
+		if attempt == w.sink.maxRetries {
+			break
+		}
+		select {
+		case <-w.ctx.Done():
+			return w.ctx.Err()
+		case <-time.After(time.Duration(attempt*200) * time.Millisecond):
 		}
-		time.Sleep(time.Duration(attempt*200) * time.Millisecond)
 	}
-	return errors.New("all HTTP POST attempts failed")
+	return fmt.Errorf("http sink: all %d POST attempts to %s failed: %w", w.sink.maxRetries, w.sink.endpoint, lastErr)
+}
+
+// retryableHTTPStatus reports whether a failed upload may succeed if repeated.
+// Other client errors (bad request, unauthorized, ...) won't.
+func retryableHTTPStatus(code int) bool {
+	return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
 }
 
 func init() {
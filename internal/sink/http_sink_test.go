@@ -48,6 +48,8 @@ func TestHTTPSink_Compressions(t *testing.T) {
 		{"gzip", "gzip", "gzip"},
 		{"bzip2", "bzip2", "x-bzip2"},
 		{"zstd", "zstd", "zstd"},
+		{"lz4", "lz4", "x-lz4"},
+		{"brotli", "brotli", "br"},
 	}
 	for _, c := range compressions {
 		t.Run(c.name, func(t *testing.T) {
@@ -144,3 +146,46 @@ func TestHTTPSink_Retries(t *testing.T) {
 	require.NoError(t, w.Close())
 	require.GreaterOrEqual(t, count, 3) // At least 3 tries (2 fail, 1 success)
 }
+
+func TestHTTPSink_Non2xxReturnsError(t *testing.T) {
+	var count int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		http.Error(w, "upload error: bad chunk", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	sink, err := NewHTTPSink(map[string]interface{}{"endpoint": srv.URL, "max_retries": 3}, nil)
+	require.NoError(t, err)
+	w, err := sink.Open(context.Background(), "bad")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("abc"))
+	require.NoError(t, err)
+	err = w.Close()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "400")
+	require.Contains(t, err.Error(), "bad chunk")
+	require.Equal(t, 1, count, "client errors should not be retried")
+}
+
+func TestHTTPSink_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	sink, err := NewHTTPSink(map[string]interface{}{"endpoint": srv.URL, "max_retries": 1, "timeout_secs": 1}, nil)
+	require.NoError(t, err)
+	w, err := sink.Open(context.Background(), "slow")
+	require.NoError(t, err)
+	require.Error(t, w.Close())
+}
+
+func TestHTTPSink_BearerTokenRequiresStore(t *testing.T) {
+	sink, err := NewHTTPSink(map[string]interface{}{"endpoint": "http://localhost", "bearer_token_secret": "TOKEN"}, nil)
+	require.NoError(t, err)
+	_, err = sink.Open(context.Background(), "x")
+	require.Error(t, err)
+}
@@ -0,0 +1,376 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/secrets"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+)
+
+// KafkaSink publishes each record as a Kafka message, rather than each chunk
+// as an object. Records are split on newlines, so it needs the jsonl
+// transformer, and output can't be compressed. Chunk boundaries don't matter
+// to it: records are sent in batches of up to batchSize records and
+// batchBytes bytes as they're written, and whatever is left when a chunk is
+// closed.
+type KafkaSink struct {
+	brokers      []string
+	topic        string
+	clientID     string
+	useTLS       bool
+	usernameName string
+	passwordName string
+	secrets      *secrets.Store
+	batchSize    int
+	batchBytes   int
+	acks         int16
+	timeout      time.Duration
+	maxRetries   int
+	Producer     KafkaProducer // test only; nil in prod, set by test
+
+	producerMu sync.Mutex
+	producer   *kafkaProducer // looked up on first Open
+}
+
+// KafkaProducer publishes messages to a topic.
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, msgs [][]byte) error
+}
+
+const (
+	defaultKafkaBatchBytes = 1000000 // under Kafka's default max.message.bytes of 1000012
+	minKafkaBatchBytes     = 1024
+	maxKafkaBatchBytes     = 100 << 20 // Kafka's default socket.request.max.bytes
+	// kafkaRecordOverhead is an upper bound on what a record batch adds to a
+	// lone record: the batch header and the record's own length fields.
+	kafkaRecordOverhead = 128
+)
+
+type kafkaSinkWriter struct {
+	ctx          context.Context
+	sink         *KafkaSink
+	producer     KafkaProducer
+	partial      []byte   // the start of a record whose newline hasn't been written yet
+	pending      [][]byte // records waiting to be sent
+	pendingBytes int
+	err          error // sticky: records after a failed batch aren't sent
+	closed       bool
+}
+
+func (w *kafkaSinkWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	data := p
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			w.partial = append(w.partial, data...)
+			break
+		}
+		// Copy: p is the caller's to reuse once Write returns
+		record := append(w.partial, data[:i]...)
+		w.partial = nil
+		data = data[i+1:]
+		if len(record) > 0 {
+			if err := w.add(record); err != nil {
+				return len(p) - len(data), err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (w *kafkaSinkWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	// The last record needn't end in a newline
+	if len(w.partial) > 0 {
+		record := w.partial
+		w.partial = nil
+		if err := w.add(record); err != nil {
+			return err
+		}
+	}
+	return w.flush()
+}
+
+// add queues a record, sending the pending batch first if the record would
+// take it over batchBytes, or after if it fills it to batchSize. A record
+// too large to send on its own is an error: the broker would only refuse it.
+func (w *kafkaSinkWriter) add(record []byte) error {
+	if len(record)+kafkaRecordOverhead > w.sink.batchBytes {
+		w.err = fmt.Errorf("kafka sink: %d byte record doesn't fit in a batch of at most %d bytes; raise 'batch_bytes' along with the topic's max.message.bytes", len(record), w.sink.batchBytes)
+		return w.err
+	}
+	if w.pendingBytes+len(record) > w.sink.batchBytes {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	w.pending = append(w.pending, record)
+	w.pendingBytes += len(record)
+	if len(w.pending) >= w.sink.batchSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *kafkaSinkWriter) flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	msgs := w.pending
+	w.pending, w.pendingBytes = nil, 0
+	if err := w.producer.Produce(w.ctx, w.sink.topic, msgs); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+func NewKafkaSink(opts map[string]interface{}, secrets *secrets.Store) (Sink, error) {
+	brokers := kafkaBrokers(opts["brokers"])
+	topic, _ := opts["topic"].(string)
+	if len(brokers) == 0 || topic == "" {
+		return nil, errors.New("kafka sink requires 'brokers' and 'topic' options")
+	}
+	if c, _ := opts["compression"].(string); c != "" && c != "none" {
+		return nil, fmt.Errorf("kafka sink: compression %q isn't supported; records are published as they're written", c)
+	}
+	clientID, _ := opts["client_id"].(string)
+	if clientID == "" {
+		clientID = "certslurp"
+	}
+	usernameName, _ := opts["sasl_username_secret"].(string)
+	passwordName, _ := opts["sasl_password_secret"].(string)
+	if (usernameName == "") != (passwordName == "") {
+		return nil, errors.New("kafka sink: 'sasl_username_secret' and 'sasl_password_secret' must be set together")
+	}
+	if mech, _ := opts["sasl_mechanism"].(string); mech != "" && !strings.EqualFold(mech, "PLAIN") {
+		return nil, fmt.Errorf("kafka sink: unsupported sasl_mechanism %q (only PLAIN is)", mech)
+	}
+	batchSize := 500
+	if v := toInt(opts["batch_size"]); v > 0 {
+		batchSize = v
+	}
+	batchBytes := defaultKafkaBatchBytes
+	if v, ok := opts["batch_bytes"]; ok {
+		batchBytes = toInt(v)
+		if batchBytes < minKafkaBatchBytes || batchBytes > maxKafkaBatchBytes {
+			return nil, fmt.Errorf("kafka sink: 'batch_bytes' must be between %d and %d, not %v", minKafkaBatchBytes, maxKafkaBatchBytes, v)
+		}
+	}
+	var acks int16 = -1
+	if v, ok := opts["acks"]; ok {
+		switch a := fmt.Sprint(v); a {
+		case "all", "-1":
+			acks = -1
+		case "1":
+			acks = 1
+		default:
+			return nil, fmt.Errorf("kafka sink: 'acks' must be \"all\" or 1, not %v", v)
+		}
+	}
+	timeout := 30 * time.Second
+	if v := toInt(opts["timeout_secs"]); v > 0 {
+		timeout = time.Duration(v) * time.Second
+	}
+	maxRetries := 3
+	if v, ok := opts["max_retries"]; ok {
+		maxRetries = toInt(v)
+		if maxRetries < 0 {
+			return nil, errors.New("kafka sink: 'max_retries' must not be negative")
+		}
+	}
+	var useTLS bool
+	if v, ok := opts["tls"]; ok {
+		useTLS = toBool(v)
+	}
+
+	return &KafkaSink{
+		brokers:      brokers,
+		topic:        topic,
+		clientID:     clientID,
+		useTLS:       useTLS,
+		usernameName: usernameName,
+		passwordName: passwordName,
+		secrets:      secrets,
+		batchSize:    batchSize,
+		batchBytes:   batchBytes,
+		acks:         acks,
+		timeout:      timeout,
+		maxRetries:   maxRetries,
+	}, nil
+}
+
+func (s *KafkaSink) Open(ctx context.Context, name string) (SinkWriter, error) {
+	var producer KafkaProducer
+	if s.Producer != nil {
+		producer = s.Producer // test: injected
+	} else {
+		p, err := s.defaultProducer(ctx)
+		if err != nil {
+			return nil, err
+		}
+		producer = p
+	}
+	return &kafkaSinkWriter{ctx: ctx, sink: s, producer: producer}, nil
+}
+
+// defaultProducer returns the client for the sink's settings, looking it up
+// on first use.
+func (s *KafkaSink) defaultProducer(ctx context.Context) (*kafkaProducer, error) {
+	s.producerMu.Lock()
+	defer s.producerMu.Unlock()
+	if s.producer != nil {
+		return s.producer, nil
+	}
+	cfg := kafkaClientConfig{
+		brokers:    strings.Join(s.brokers, ","),
+		clientID:   s.clientID,
+		useTLS:     s.useTLS,
+		acks:       s.acks,
+		timeout:    s.timeout,
+		maxRetries: s.maxRetries,
+		batchBytes: s.batchBytes,
+	}
+	if s.usernameName != "" {
+		if s.secrets == nil {
+			return nil, errors.New("kafka sink: secrets store not available for SASL credentials")
+		}
+		user, err := s.secrets.Get(ctx, s.usernameName)
+		if err != nil {
+			return nil, fmt.Errorf("missing Kafka SASL username secret '%s': %w", s.usernameName, err)
+		}
+		pass, err := s.secrets.Get(ctx, s.passwordName)
+		if err != nil {
+			return nil, fmt.Errorf("missing Kafka SASL password secret '%s': %w", s.passwordName, err)
+		}
+		cfg.username, cfg.password = strings.TrimSpace(string(user)), strings.TrimSpace(string(pass))
+	}
+	p, err := sharedKafkaProducer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.producer = p
+	return p, nil
+}
+
+// kafkaClientConfig is everything a Kafka client is built from. Pipelines
+// build their sinks for each shard and never close them, so clients, which
+// keep connections and background goroutines, are shared by every sink with
+// the same settings for the life of the process.
+type kafkaClientConfig struct {
+	brokers            string
+	clientID           string
+	useTLS             bool
+	username, password string
+	acks               int16
+	timeout            time.Duration
+	maxRetries         int
+	batchBytes         int
+}
+
+var (
+	kafkaProducersMu sync.Mutex
+	kafkaProducers   = make(map[kafkaClientConfig]*kafkaProducer)
+)
+
+// sharedKafkaProducer returns the client for cfg, creating it if need be.
+func sharedKafkaProducer(cfg kafkaClientConfig) (*kafkaProducer, error) {
+	kafkaProducersMu.Lock()
+	defer kafkaProducersMu.Unlock()
+	if p, ok := kafkaProducers[cfg]; ok {
+		return p, nil
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(strings.Split(cfg.brokers, ",")...),
+		kgo.ClientID(cfg.clientID),
+		kgo.ProducerBatchMaxBytes(int32(cfg.batchBytes)),
+		kgo.ProducerBatchCompression(kgo.NoCompression()),
+		kgo.ProduceRequestTimeout(cfg.timeout),
+		// Tries, not retries; and a batch gets a timeout's worth of time for each
+		kgo.RecordRetries(cfg.maxRetries + 1),
+		kgo.RecordDeliveryTimeout(time.Duration(cfg.maxRetries+1) * cfg.timeout),
+	}
+	if cfg.acks == 1 {
+		// Idempotent writes need acks from all in-sync replicas
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	} else {
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	}
+	if cfg.useTLS {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+	if cfg.username != "" {
+		opts = append(opts, kgo.SASL(plain.Auth{User: cfg.username, Pass: cfg.password}.AsMechanism()))
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("kafka sink: %w", err)
+	}
+	p := &kafkaProducer{client: client}
+	kafkaProducers[cfg] = p
+	return p, nil
+}
+
+// kafkaProducer publishes through a franz-go client.
+type kafkaProducer struct {
+	client *kgo.Client
+}
+
+// Produce sends msgs and waits until the broker has acknowledged all of them
+// or the client has given up on one.
+func (p *kafkaProducer) Produce(ctx context.Context, topic string, msgs [][]byte) error {
+	records := make([]*kgo.Record, len(msgs))
+	for i, m := range msgs {
+		records[i] = &kgo.Record{Topic: topic, Value: m}
+	}
+	if err := p.client.ProduceSync(ctx, records...).FirstErr(); err != nil {
+		return fmt.Errorf("kafka produce to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// kafkaBrokers reads the brokers option: a list of host:port addresses, or
+// the same separated by commas.
+func kafkaBrokers(v interface{}) []string {
+	var raw []string
+	switch b := v.(type) {
+	case string:
+		raw = strings.Split(b, ",")
+	case []string:
+		raw = b
+	case []interface{}:
+		for _, item := range b {
+			if s, ok := item.(string); ok {
+				raw = append(raw, s)
+			}
+		}
+	}
+	var brokers []string
+	for _, b := range raw {
+		if b = strings.TrimSpace(b); b != "" {
+			brokers = append(brokers, b)
+		}
+	}
+	return brokers
+}
+
+func init() {
+	Register("kafka", NewKafkaSink)
+}
@@ -0,0 +1,106 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	semaphoresMu sync.Mutex
+	semaphores   = make(map[string]chan struct{})
+)
+
+// SharedSemaphore returns a process-wide semaphore of size n for the given key.
+// Pipelines are built per shard, so a limit only bounds concurrent writes to a
+// destination if every pipeline targeting it shares the same semaphore.
+func SharedSemaphore(key string, n int) chan struct{} {
+	semaphoresMu.Lock()
+	defer semaphoresMu.Unlock()
+	k := fmt.Sprintf("%s/%d", key, n)
+	sem, ok := semaphores[k]
+	if !ok {
+		sem = make(chan struct{}, n)
+		semaphores[k] = sem
+	}
+	return sem
+}
+
+// LimitedSink wraps another Sink, holding a semaphore slot from Open until the
+// returned writer is closed, which bounds how many streams (and uploads on
+// Close) are in flight at once.
+type LimitedSink struct {
+	inner Sink
+	sem   chan struct{}
+}
+
+func NewLimitedSink(inner Sink, sem chan struct{}) *LimitedSink {
+	return &LimitedSink{inner: inner, sem: sem}
+}
+
+func (s *LimitedSink) Open(ctx context.Context, name string) (SinkWriter, error) {
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	w, err := s.inner.Open(ctx, name)
+	if err != nil {
+		<-s.sem
+		return nil, err
+	}
+	return &limitedSinkWriter{SinkWriter: w, sem: s.sem}, nil
+}
+
+type limitedSinkWriter struct {
+	SinkWriter
+	sem  chan struct{}
+	once sync.Once
+}
+
+func (w *limitedSinkWriter) Close() error {
+	defer w.once.Do(func() { <-w.sem })
+	return w.SinkWriter.Close()
+}
+
+// WithWriteLimit wraps s in a LimitedSink when opts sets max_concurrent_writes.
+// The limit is shared by all pipelines in the process writing to sinkName.
+func WithWriteLimit(sinkName string, opts map[string]interface{}, s Sink) Sink {
+	n := toInt(opts["max_concurrent_writes"])
+	if n <= 0 {
+		return s
+	}
+	return NewLimitedSink(s, SharedSemaphore(sinkName, n))
+}
+
+// TrackedSink wraps another Sink, counting its open writers in active so
+// callers can report how many streams (and uploads) are in flight.
+type TrackedSink struct {
+	inner  Sink
+	active *int64
+}
+
+func NewTrackedSink(inner Sink, active *int64) *TrackedSink {
+	return &TrackedSink{inner: inner, active: active}
+}
+
+func (s *TrackedSink) Open(ctx context.Context, name string) (SinkWriter, error) {
+	w, err := s.inner.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(s.active, 1)
+	return &trackedSinkWriter{SinkWriter: w, active: s.active}, nil
+}
+
+type trackedSinkWriter struct {
+	SinkWriter
+	active *int64
+	once   sync.Once
+}
+
+func (w *trackedSinkWriter) Close() error {
+	defer w.once.Do(func() { atomic.AddInt64(w.active, -1) })
+	return w.SinkWriter.Close()
+}
@@ -0,0 +1,98 @@
+package sink
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// uploadTrackingSink simulates a sink whose Close performs a slow upload and
+// records the peak number of uploads in flight.
+type uploadTrackingSink struct {
+	active  int32
+	peak    int32
+	uploads int32
+}
+
+func (s *uploadTrackingSink) Open(ctx context.Context, name string) (SinkWriter, error) {
+	return &uploadTrackingWriter{sink: s}, nil
+}
+
+type uploadTrackingWriter struct {
+	sink *uploadTrackingSink
+}
+
+func (w *uploadTrackingWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func (w *uploadTrackingWriter) Close() error {
+	n := atomic.AddInt32(&w.sink.active, 1)
+	for {
+		peak := atomic.LoadInt32(&w.sink.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&w.sink.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	atomic.AddInt32(&w.sink.active, -1)
+	atomic.AddInt32(&w.sink.uploads, 1)
+	return nil
+}
+
+func TestLimitedSinkSerializesUploads(t *testing.T) {
+	mock := &uploadTrackingSink{}
+	limited := NewLimitedSink(mock, make(chan struct{}, 1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w, err := limited.Open(context.Background(), "chunk")
+			if err != nil {
+				t.Errorf("Open failed: %v", err)
+				return
+			}
+			w.Write([]byte("data"))
+			if err := w.Close(); err != nil {
+				t.Errorf("Close failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if mock.uploads != 8 {
+		t.Errorf("expected 8 uploads, got %d", mock.uploads)
+	}
+	if mock.peak != 1 {
+		t.Errorf("expected uploads to run serially, saw %d in flight", mock.peak)
+	}
+}
+
+func TestLimitedSinkOpenRespectsContext(t *testing.T) {
+	limited := NewLimitedSink(&uploadTrackingSink{}, make(chan struct{}, 1))
+	w, err := limited.Open(context.Background(), "held")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limited.Open(ctx, "blocked"); err == nil {
+		t.Fatal("expected Open to fail once the context expires while the slot is held")
+	}
+}
+
+func TestWithWriteLimitSharesSemaphore(t *testing.T) {
+	opts := map[string]interface{}{"max_concurrent_writes": float64(2)}
+	a := WithWriteLimit("mock", opts, &uploadTrackingSink{}).(*LimitedSink)
+	b := WithWriteLimit("mock", opts, &uploadTrackingSink{}).(*LimitedSink)
+	if a.sem != b.sem || cap(a.sem) != 2 {
+		t.Error("expected pipelines for the same sink to share one semaphore")
+	}
+	if _, ok := WithWriteLimit("mock", nil, &uploadTrackingSink{}).(*uploadTrackingSink); !ok {
+		t.Error("expected no wrapping without max_concurrent_writes")
+	}
+}
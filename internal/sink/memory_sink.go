@@ -0,0 +1,89 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/chtzvt/certslurp/internal/secrets"
+)
+
+var (
+	memoryBucketsMu sync.Mutex
+	memoryBuckets   = make(map[string]*MemorySink)
+)
+
+// MemorySink keeps output streams in process memory. Sinks sharing a "bucket"
+// option share storage, so output written by an in-process worker can be read
+// back by the API. Intended for the memory cluster backend and tests.
+type MemorySink struct {
+	mu      sync.RWMutex
+	streams map[string][]byte
+}
+
+func NewMemorySink(opts map[string]interface{}, _ *secrets.Store) (Sink, error) {
+	bucket, _ := opts["bucket"].(string)
+	return MemoryBucket(bucket), nil
+}
+
+// MemoryBucket returns the shared MemorySink for the named bucket.
+func MemoryBucket(bucket string) *MemorySink {
+	memoryBucketsMu.Lock()
+	defer memoryBucketsMu.Unlock()
+	m, ok := memoryBuckets[bucket]
+	if !ok {
+		m = &MemorySink{streams: make(map[string][]byte)}
+		memoryBuckets[bucket] = m
+	}
+	return m
+}
+
+func (m *MemorySink) Open(ctx context.Context, name string) (SinkWriter, error) {
+	return &memorySinkWriter{sink: m, name: name}, nil
+}
+
+func (m *MemorySink) OpenReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.streams[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Names returns the names of all streams written to the sink.
+func (m *MemorySink) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.streams))
+	for name := range m.streams {
+		names = append(names, name)
+	}
+	return names
+}
+
+type memorySinkWriter struct {
+	sink *MemorySink
+	name string
+	buf  bytes.Buffer
+}
+
+func (w *memorySinkWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+// Close publishes the stream; readers never observe a partially written one.
+func (w *memorySinkWriter) Close() error {
+	w.sink.mu.Lock()
+	defer w.sink.mu.Unlock()
+	w.sink.streams[w.name] = w.buf.Bytes()
+	return nil
+}
+
+func init() {
+	Register("memory", NewMemorySink)
+}
@@ -0,0 +1,64 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// MultiSink fans every stream out to several sinks, so each chunk lands in
+// all of them, e.g. S3 plus a local copy for verification.
+type MultiSink struct {
+	sinks []Sink
+}
+
+func NewMultiSink(sinks ...Sink) *MultiSink {
+	return &MultiSink{sinks: sinks}
+}
+
+// Open opens name on every sink. If any fails, the streams already opened
+// are closed and the error is returned.
+func (m *MultiSink) Open(ctx context.Context, name string) (SinkWriter, error) {
+	writers := make([]SinkWriter, 0, len(m.sinks))
+	for _, s := range m.sinks {
+		w, err := s.Open(ctx, name)
+		if err != nil {
+			for _, w := range writers {
+				_ = w.Close()
+			}
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+	return &multiSinkWriter{writers: writers}, nil
+}
+
+type multiSinkWriter struct {
+	writers []SinkWriter
+}
+
+// Write writes p to each stream in turn, stopping at the first failure.
+func (w *multiSinkWriter) Write(p []byte) (int, error) {
+	for _, sw := range w.writers {
+		n, err := sw.Write(p)
+		if err != nil {
+			return n, err
+		}
+		if n != len(p) {
+			return n, io.ErrShortWrite
+		}
+	}
+	return len(p), nil
+}
+
+// Close closes every stream, even if some fail, and returns their errors
+// joined.
+func (w *multiSinkWriter) Close() error {
+	var errs []error
+	for _, sw := range w.writers {
+		if err := sw.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
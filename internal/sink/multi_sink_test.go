@@ -0,0 +1,78 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+type recordingSink struct {
+	openErr  error
+	closeErr error
+	opened   int
+	closed   int
+	data     bytes.Buffer
+}
+
+func (s *recordingSink) Open(ctx context.Context, name string) (SinkWriter, error) {
+	if s.openErr != nil {
+		return nil, s.openErr
+	}
+	s.opened++
+	return &recordingWriter{s}, nil
+}
+
+type recordingWriter struct{ s *recordingSink }
+
+func (w *recordingWriter) Write(p []byte) (int, error) { return w.s.data.Write(p) }
+
+func (w *recordingWriter) Close() error {
+	w.s.closed++
+	return w.s.closeErr
+}
+
+func TestMultiSink_WritesToAll(t *testing.T) {
+	a, b := &recordingSink{}, &recordingSink{}
+	w, err := NewMultiSink(a, b).Open(context.Background(), "chunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write([]byte("hello")); err != nil || n != 5 {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*recordingSink{a, b} {
+		if s.data.String() != "hello" || s.closed != 1 {
+			t.Errorf("got %q closed %d times", s.data.String(), s.closed)
+		}
+	}
+}
+
+func TestMultiSink_CloseJoinsErrors(t *testing.T) {
+	errA, errB := errors.New("a failed"), errors.New("b failed")
+	a, b, c := &recordingSink{closeErr: errA}, &recordingSink{closeErr: errB}, &recordingSink{}
+	w, err := NewMultiSink(a, b, c).Open(context.Background(), "chunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Fatalf("expected both close errors, got %v", err)
+	}
+	if c.closed != 1 {
+		t.Error("a failing close should not stop the others")
+	}
+}
+
+func TestMultiSink_OpenFailureClosesOpened(t *testing.T) {
+	a, b := &recordingSink{}, &recordingSink{openErr: errors.New("no bucket")}
+	if _, err := NewMultiSink(a, b).Open(context.Background(), "chunk"); err == nil {
+		t.Fatal("expected open error")
+	}
+	if a.opened != 1 || a.closed != 1 {
+		t.Errorf("opened stream should be closed: opened %d closed %d", a.opened, a.closed)
+	}
+}
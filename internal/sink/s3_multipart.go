@@ -0,0 +1,156 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// S3 requires every part but the last to be at least 5 MiB.
+	s3MinPartSize = 5 << 20
+
+	defaultS3MultipartThreshold = 64 << 20
+	defaultS3PartSize           = 16 << 20
+)
+
+// MultipartAPI is the subset of the S3 client used for multipart uploads.
+// Injected test clients that don't implement it always upload with PutObject.
+type MultipartAPI interface {
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// Once a chunk has grown to the multipart threshold, the writer starts a
+// multipart upload and sends each part as soon as it's buffered, so a large
+// chunk never needs more than about one part's worth of memory or disk. Close
+// sends whatever is left as the last part and completes the upload. Chunks
+// that are closed before reaching the threshold (which, when chunk_bytes is
+// set below it, is all of them) are still sent with a single PutObject.
+
+// buffered returns the data written but not yet uploaded.
+func (w *s3SinkWriter) buffered() *io.SectionReader {
+	if w.diskMode {
+		return io.NewSectionReader(w.file, w.uploaded, w.written-w.uploaded)
+	}
+	return io.NewSectionReader(bytes.NewReader(w.buf.Bytes()), 0, int64(w.buf.Len()))
+}
+
+// consume drops n bytes that have been uploaded from the front of the buffer.
+func (w *s3SinkWriter) consume(n int64) {
+	w.uploaded += n
+	if !w.diskMode {
+		w.buf.Next(int(n))
+	}
+}
+
+// uploadParts sends each whole part that's buffered, starting the multipart
+// upload first if need be. With final set, a short last part is sent too.
+// The upload is aborted if a part fails for good.
+func (w *s3SinkWriter) uploadParts(final bool) error {
+	if w.uploadID == nil {
+		if err := w.createMultipartUpload(); err != nil {
+			return err
+		}
+	}
+	for {
+		pending := w.buffered()
+		n := pending.Size()
+		if n == 0 || (n < w.sink.partSize && !final) {
+			return nil
+		}
+		n = min(n, w.sink.partSize)
+		num := int32(len(w.parts) + 1)
+		etag, err := w.uploadPart(num, io.NewSectionReader(pending, 0, n))
+		if err != nil {
+			return w.abort(fmt.Errorf("s3 sink: upload part %d of %s: %w", num, w.key, err))
+		}
+		w.parts = append(w.parts, types.CompletedPart{ETag: etag, PartNumber: aws.Int32(num)})
+		w.consume(n)
+	}
+}
+
+func (w *s3SinkWriter) createMultipartUpload() error {
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:               &w.bucket,
+		Key:                  &w.key,
+		StorageClass:         w.sink.storageClass,
+		ServerSideEncryption: w.sink.sse,
+		ACL:                  w.sink.acl,
+		Metadata:             w.sink.metadata,
+	}
+	if w.sink.sseKMSKeyID != "" {
+		create.SSEKMSKeyId = &w.sink.sseKMSKeyID
+	}
+	out, err := w.multipart.CreateMultipartUpload(w.ctx, create)
+	if err != nil {
+		return fmt.Errorf("s3 sink: create multipart upload for %s: %w", w.key, err)
+	}
+	w.uploadID = out.UploadId
+	return nil
+}
+
+// completeMultipartUpload sends the last part and assembles the object.
+func (w *s3SinkWriter) completeMultipartUpload() error {
+	if err := w.uploadParts(true); err != nil {
+		return err
+	}
+	_, err := w.multipart.CompleteMultipartUpload(w.ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &w.bucket,
+		Key:             &w.key,
+		UploadId:        w.uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: w.parts},
+	})
+	if err != nil {
+		return w.abort(fmt.Errorf("s3 sink: complete multipart upload for %s: %w", w.key, err))
+	}
+	return nil
+}
+
+// abort abandons the multipart upload so S3 doesn't keep its parts, and
+// returns cause.
+func (w *s3SinkWriter) abort(cause error) error {
+	// Use a fresh context: the upload may be failing because ctx was cancelled
+	abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := w.multipart.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+		Bucket:   &w.bucket,
+		Key:      &w.key,
+		UploadId: w.uploadID,
+	}); err != nil {
+		return fmt.Errorf("%w (abort also failed: %v)", cause, err)
+	}
+	return cause
+}
+
+// uploadPart sends one part, retrying it on its own so a transient failure
+// only resends that part.
+func (w *s3SinkWriter) uploadPart(num int32, body *io.SectionReader) (*string, error) {
+	var etag *string
+	exhausted, err := retryS3(w.ctx, w.sink.partRetries, body, func() error {
+		out, err := w.multipart.UploadPart(w.ctx, &s3.UploadPartInput{
+			Bucket:        &w.bucket,
+			Key:           &w.key,
+			UploadId:      w.uploadID,
+			PartNumber:    aws.Int32(num),
+			Body:          body,
+			ContentLength: aws.Int64(body.Size()),
+		})
+		if err == nil {
+			etag = out.ETag
+		}
+		return err
+	})
+	if exhausted {
+		return nil, fmt.Errorf("all %d attempts failed: %w", w.sink.partRetries+1, err)
+	}
+	return etag, err
+}
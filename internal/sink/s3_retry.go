@@ -0,0 +1,120 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	defaultS3Retries = 3
+	s3RetryBaseDelay = 100 * time.Millisecond
+	s3RetryMaxDelay  = 5 * time.Second
+)
+
+// The SDK's API errors (smithy.APIError) and response errors implement these.
+type s3CodedError interface{ ErrorCode() string }
+type s3StatusError interface{ HTTPStatusCode() int }
+
+// retryableS3Codes are S3 error codes that may succeed if tried again.
+var retryableS3Codes = map[string]bool{
+	"InternalError":          true,
+	"ServiceUnavailable":     true,
+	"SlowDown":               true,
+	"Throttling":             true,
+	"ThrottlingException":    true,
+	"RequestLimitExceeded":   true,
+	"RequestTimeout":         true,
+	"BandwidthLimitExceeded": true,
+}
+
+// isRetryableS3Error reports whether an upload that failed with err is worth
+// retrying: throttling, server errors, and failures that never got a response.
+// Other client errors, like AccessDenied (403) or NoSuchBucket, won't go away
+// on their own.
+func isRetryableS3Error(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var coded s3CodedError
+	if errors.As(err, &coded) && retryableS3Codes[coded.ErrorCode()] {
+		return true
+	}
+	var status s3StatusError
+	if errors.As(err, &status) {
+		return retryableHTTPStatus(status.HTTPStatusCode())
+	}
+	// A service error without a status is a client error; anything else
+	// (a reset connection, say) failed before S3 answered
+	return coded == nil
+}
+
+// parseS3Retries reads the retry count option name: how many times a request
+// is tried again after it first fails, defaulting to defaultS3Retries. Zero
+// turns retries off.
+func parseS3Retries(opts map[string]interface{}, name string) (int, error) {
+	v, ok := opts[name]
+	if !ok {
+		return defaultS3Retries, nil
+	}
+	retries := toInt(v)
+	if retries < 0 {
+		return 0, fmt.Errorf("s3 sink: '%s' must not be negative", name)
+	}
+	return retries, nil
+}
+
+// s3RetryDelay is how long to wait after failed attempt number attempt
+// (from 1) before the next: doubling from s3RetryBaseDelay, up to
+// s3RetryMaxDelay.
+func s3RetryDelay(attempt int) time.Duration {
+	if attempt > 16 {
+		return s3RetryMaxDelay
+	}
+	return min(s3RetryBaseDelay<<(attempt-1), s3RetryMaxDelay)
+}
+
+// retryS3 rewinds body and calls do, then tries again up to retries more
+// times while it fails with a retryable error, waiting s3RetryDelay between
+// attempts. It returns do's last error, and whether that was after the last
+// retry.
+func retryS3(ctx context.Context, retries int, body io.Seeker, do func() error) (exhausted bool, err error) {
+	for attempt := 1; ; attempt++ {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		err = do()
+		if err == nil || !isRetryableS3Error(err) {
+			return false, err
+		}
+		if attempt > retries {
+			return true, err
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(s3RetryDelay(attempt)):
+		}
+	}
+}
+
+// putObject uploads input with body, retrying it up to the sink's max_retries
+// times while failures are retryable.
+func (w *s3SinkWriter) putObject(input *s3.PutObjectInput, body io.ReadSeeker) error {
+	input.Body = body
+	exhausted, err := retryS3(w.ctx, w.sink.maxRetries, body, func() error {
+		_, err := w.client.PutObject(w.ctx, input)
+		return err
+	})
+	switch {
+	case err == nil:
+		return nil
+	case exhausted:
+		return fmt.Errorf("s3 sink: all %d attempts to put %s failed: %w", w.sink.maxRetries+1, w.key, err)
+	}
+	return fmt.Errorf("s3 sink: put %s: %w", w.key, err)
+}
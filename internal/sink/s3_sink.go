@@ -9,9 +9,11 @@ import (
 	"path"
 	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/chtzvt/certslurp/internal/secrets"
 )
 
@@ -26,6 +28,23 @@ type S3Sink struct {
 	Client             PutObjectAPI // test only; nil in prod, set by test
 	disableChecksums   bool
 	bufferType         string
+	storageClass       types.StorageClass
+	sse                types.ServerSideEncryption
+	sseKMSKeyID        string
+	acl                types.ObjectCannedACL
+	metadata           map[string]string
+
+	// Chunks that grow to multipartThreshold bytes are streamed in parts of
+	// partSize as they're written, each retried up to partRetries times
+	// after its first attempt. Zero threshold disables.
+	multipartThreshold int64
+	partSize           int64
+	partRetries        int
+
+	// maxRetries is how many times a PutObject is retried after its first
+	// attempt. The SDK's own retries are turned off, so these are the only
+	// ones.
+	maxRetries int
 }
 
 type PutObjectAPI interface {
@@ -37,40 +56,77 @@ type s3SinkWriter struct {
 	client   PutObjectAPI
 	bucket   string
 	key      string
+	sink     *S3Sink
 	buf      *bytes.Buffer // nil if disk
 	file     *os.File      // nil if memory
 	closer   io.Closer
 	diskMode bool
+
+	// Multipart upload state; multipart is nil if the client can't do them
+	// or they're disabled.
+	multipart MultipartAPI
+	uploadID  *string // set once the upload has started
+	parts     []types.CompletedPart
+	written   int64 // bytes written to the writer
+	uploaded  int64 // bytes sent as parts
+	err       error // sticky: a failed upload can't be resumed
 }
 
 func (w *s3SinkWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	var n int
+	var err error
 	if w.diskMode {
-		return w.file.Write(p)
+		n, err = w.file.Write(p)
+	} else {
+		n, err = w.buf.Write(p)
+	}
+	w.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if w.multipart != nil && (w.uploadID != nil || w.written >= w.sink.multipartThreshold) {
+		if err := w.uploadParts(false); err != nil {
+			w.err = err
+			return n, err
+		}
 	}
-	return w.buf.Write(p)
+	return n, nil
 }
 
 func (w *s3SinkWriter) Close() error {
 	defer w.closer.Close()
-	var reader io.ReadSeeker
-
 	if w.diskMode {
 		defer os.Remove(w.file.Name())
-		if _, err := w.file.Seek(0, io.SeekStart); err != nil {
-			return err
-		}
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if w.uploadID != nil {
+		return w.completeMultipartUpload()
+	}
+
+	var reader io.ReadSeeker
+	if w.diskMode {
 		reader = w.file
 	} else {
 		reader = bytes.NewReader(w.buf.Bytes())
 	}
 
-	_, err := w.client.PutObject(w.ctx, &s3.PutObjectInput{
-		Bucket: &w.bucket,
-		Key:    &w.key,
-		Body:   reader,
-	})
-
-	return err
+	input := &s3.PutObjectInput{
+		Bucket:               &w.bucket,
+		Key:                  &w.key,
+		StorageClass:         w.sink.storageClass,
+		ServerSideEncryption: w.sink.sse,
+		ACL:                  w.sink.acl,
+		Metadata:             w.sink.metadata,
+	}
+	if w.sink.sseKMSKeyID != "" {
+		input.SSEKMSKeyId = &w.sink.sseKMSKeyID
+	}
+	return w.putObject(input, reader)
 }
 
 func NewS3Sink(opts map[string]interface{}, secrets *secrets.Store) (Sink, error) {
@@ -96,6 +152,47 @@ func NewS3Sink(opts map[string]interface{}, secrets *secrets.Store) (Sink, error
 		return nil, fmt.Errorf("s3 sink requires 'bucket' and 'region' options")
 	}
 
+	storageClass, err := parseS3StorageClass(opts["storage_class"])
+	if err != nil {
+		return nil, err
+	}
+	sse, err := parseS3ServerSideEncryption(firstS3Option(opts, "server_side_encryption", "sse"))
+	if err != nil {
+		return nil, err
+	}
+	sseKMSKeyID, _ := firstS3Option(opts, "sse_kms_key_id", "kms_key_id").(string)
+	if sseKMSKeyID != "" && sse != types.ServerSideEncryptionAwsKms {
+		return nil, fmt.Errorf("s3 sink: 'sse_kms_key_id' requires server_side_encryption SSE-KMS")
+	}
+	acl, err := parseS3ACL(opts["acl"])
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := parseS3Metadata(opts["metadata"])
+	if err != nil {
+		return nil, err
+	}
+
+	multipartThreshold := int64(defaultS3MultipartThreshold)
+	if v, ok := opts["multipart_threshold"]; ok {
+		multipartThreshold = int64(toInt(v))
+	}
+	partSize := int64(defaultS3PartSize)
+	if v, ok := opts["part_size"]; ok {
+		partSize = int64(toInt(v))
+	}
+	if partSize < s3MinPartSize {
+		return nil, fmt.Errorf("s3 sink: 'part_size' must be at least %d bytes", s3MinPartSize)
+	}
+	partRetries, err := parseS3Retries(opts, "part_retries")
+	if err != nil {
+		return nil, err
+	}
+	maxRetries, err := parseS3Retries(opts, "max_retries")
+	if err != nil {
+		return nil, err
+	}
+
 	return &S3Sink{
 		bucket:             bucket,
 		prefix:             prefix,
@@ -106,6 +203,15 @@ func NewS3Sink(opts map[string]interface{}, secrets *secrets.Store) (Sink, error
 		endpoint:           chooseS3Endpoint(endpoint, baseEndpoint),
 		disableChecksums:   disableChecksums,
 		bufferType:         bufferType,
+		storageClass:       storageClass,
+		sse:                sse,
+		sseKMSKeyID:        sseKMSKeyID,
+		acl:                acl,
+		metadata:           metadata,
+		multipartThreshold: multipartThreshold,
+		partSize:           partSize,
+		partRetries:        partRetries,
+		maxRetries:         maxRetries,
 	}, nil
 }
 
@@ -126,6 +232,9 @@ func (s *S3Sink) Open(ctx context.Context, name string) (SinkWriter, error) {
 		),
 	}
 
+	// Retries are left to putObject and uploadPart, which rewind the body
+	awsCfgOpts = append(awsCfgOpts, config.WithRetryer(func() aws.Retryer { return aws.NopRetryer{} }))
+
 	if s.disableChecksums {
 		awsCfgOpts = append(awsCfgOpts, config.WithRequestChecksumCalculation(0))
 		awsCfgOpts = append(awsCfgOpts, config.WithResponseChecksumValidation(0))
@@ -167,18 +276,107 @@ func (s *S3Sink) Open(ctx context.Context, name string) (SinkWriter, error) {
 		closer = nopCloser{}
 	}
 
+	var multipart MultipartAPI
+	if mp, ok := client.(MultipartAPI); ok && s.multipartThreshold > 0 {
+		multipart = mp
+	}
+
 	return &s3SinkWriter{
-		ctx:      ctx,
-		client:   client,
-		bucket:   s.bucket,
-		key:      key,
-		buf:      buf,
-		file:     file,
-		closer:   closer,
-		diskMode: s.bufferType == "disk",
+		ctx:       ctx,
+		client:    client,
+		bucket:    s.bucket,
+		key:       key,
+		sink:      s,
+		buf:       buf,
+		file:      file,
+		closer:    closer,
+		diskMode:  s.bufferType == "disk",
+		multipart: multipart,
 	}, nil
 }
 
+// parseS3StorageClass validates the storage_class option against the classes
+// S3 accepts for uploads. Empty leaves the bucket default (STANDARD).
+func parseS3StorageClass(v interface{}) (types.StorageClass, error) {
+	name, _ := v.(string)
+	if name == "" {
+		return "", nil
+	}
+	class := types.StorageClass(strings.ToUpper(name))
+	for _, allowed := range class.Values() {
+		if class == allowed {
+			return class, nil
+		}
+	}
+	return "", fmt.Errorf("s3 sink: unknown storage_class %q", name)
+}
+
+// parseS3ServerSideEncryption maps the server_side_encryption option to the
+// API's value. SSE-S3 and SSE-KMS are accepted alongside the raw AES256 and
+// aws:kms forms.
+func parseS3ServerSideEncryption(v interface{}) (types.ServerSideEncryption, error) {
+	name, _ := v.(string)
+	switch strings.ToUpper(name) {
+	case "":
+		return "", nil
+	case "SSE-S3", "AES256":
+		return types.ServerSideEncryptionAes256, nil
+	case "SSE-KMS", "AWS:KMS":
+		return types.ServerSideEncryptionAwsKms, nil
+	}
+	return "", fmt.Errorf("s3 sink: unknown server_side_encryption %q (want SSE-S3 or SSE-KMS)", name)
+}
+
+// parseS3ACL validates the acl option against S3's canned ACLs. Empty leaves
+// the bucket's default; buckets that enforce object ownership reject any other.
+func parseS3ACL(v interface{}) (types.ObjectCannedACL, error) {
+	name, _ := v.(string)
+	if name == "" {
+		return "", nil
+	}
+	acl := types.ObjectCannedACL(strings.ToLower(name))
+	for _, allowed := range acl.Values() {
+		if acl == allowed {
+			return acl, nil
+		}
+	}
+	return "", fmt.Errorf("s3 sink: unknown acl %q", name)
+}
+
+// parseS3Metadata reads the metadata option, a map of user-defined metadata
+// stored with each object. Scalar values are converted to strings.
+func parseS3Metadata(v interface{}) (map[string]string, error) {
+	switch m := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]string:
+		return m, nil
+	case map[string]interface{}:
+		metadata := make(map[string]string, len(m))
+		for k, val := range m {
+			switch val.(type) {
+			case string, bool, int, int64, float64:
+				metadata[k] = fmt.Sprint(val)
+			default:
+				return nil, fmt.Errorf("s3 sink: metadata %q must be a string, number or bool", k)
+			}
+		}
+		return metadata, nil
+	}
+	return nil, fmt.Errorf("s3 sink: 'metadata' must be a map of strings")
+}
+
+// firstS3Option returns the first of names set in opts, for options that may
+// be spelled more than one way.
+func firstS3Option(opts map[string]interface{}, names ...string) interface{} {
+	for _, name := range names {
+		if v, ok := opts[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
 func chooseS3Endpoint(a, b string) string {
 	if a != "" {
 		return a
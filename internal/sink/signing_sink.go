@@ -0,0 +1,155 @@
+package sink
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/chtzvt/certslurp/internal/secrets"
+)
+
+// SignatureSuffix is appended to a chunk's name to form its detached signature sidecar.
+const SignatureSuffix = ".sig"
+
+// Chunks are signed with Ed25519ph (SHA-512 prehash) so that the digest can be
+// computed incrementally as data is written, rather than buffering whole chunks.
+var signOpts = &ed25519.Options{Hash: crypto.SHA512}
+
+// SigningKeyFunc returns the Ed25519 private key used to sign output chunks.
+type SigningKeyFunc func(ctx context.Context) (ed25519.PrivateKey, error)
+
+// SigningSink wraps another Sink, writing a detached Ed25519 signature sidecar
+// (<name>.sig) for every stream once it has been closed.
+type SigningSink struct {
+	inner   Sink
+	keyFunc SigningKeyFunc
+
+	mu  sync.Mutex
+	key ed25519.PrivateKey
+}
+
+func NewSigningSink(inner Sink, keyFunc SigningKeyFunc) *SigningSink {
+	return &SigningSink{inner: inner, keyFunc: keyFunc}
+}
+
+// SecretSigningKey loads a signing key from the secrets store. The secret may
+// hold a raw or base64 encoded Ed25519 seed (32 bytes) or private key (64 bytes).
+func SecretSigningKey(store *secrets.Store, name string) SigningKeyFunc {
+	return func(ctx context.Context) (ed25519.PrivateKey, error) {
+		if store == nil {
+			return nil, errors.New("secrets store not available")
+		}
+		raw, err := store.Get(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("missing signing key secret '%s': %w", name, err)
+		}
+		return ParseSigningKey(raw)
+	}
+}
+
+// ParseSigningKey decodes an Ed25519 seed or private key, raw or base64 encoded.
+func ParseSigningKey(raw []byte) (ed25519.PrivateKey, error) {
+	if dec, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw))); err == nil &&
+		(len(dec) == ed25519.SeedSize || len(dec) == ed25519.PrivateKeySize) {
+		raw = dec
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("invalid ed25519 signing key length %d", len(raw))
+	}
+}
+
+func (s *SigningSink) signingKey(ctx context.Context) (ed25519.PrivateKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.key != nil {
+		return s.key, nil
+	}
+	key, err := s.keyFunc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.key = key
+	return key, nil
+}
+
+func (s *SigningSink) Open(ctx context.Context, name string) (SinkWriter, error) {
+	key, err := s.signingKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.inner.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &signingSinkWriter{
+		ctx:   ctx,
+		sink:  s.inner,
+		name:  name,
+		key:   key,
+		inner: w,
+		hash:  sha512.New(),
+	}, nil
+}
+
+type signingSinkWriter struct {
+	ctx   context.Context
+	sink  Sink
+	name  string
+	key   ed25519.PrivateKey
+	inner SinkWriter
+	hash  hash.Hash
+}
+
+func (w *signingSinkWriter) Write(p []byte) (int, error) {
+	n, err := w.inner.Write(p)
+	w.hash.Write(p[:n])
+	return n, err
+}
+
+// Close closes the underlying stream, then signs everything written to it and
+// stores the base64 encoded signature in a <name>.sig sidecar.
+func (w *signingSinkWriter) Close() error {
+	if err := w.inner.Close(); err != nil {
+		return err
+	}
+	sig, err := w.key.Sign(nil, w.hash.Sum(nil), signOpts)
+	if err != nil {
+		return fmt.Errorf("sign %s: %w", w.name, err)
+	}
+	sw, err := w.sink.Open(w.ctx, w.name+SignatureSuffix)
+	if err != nil {
+		return fmt.Errorf("open signature for %s: %w", w.name, err)
+	}
+	if _, err := io.WriteString(sw, base64.StdEncoding.EncodeToString(sig)+"\n"); err != nil {
+		sw.Close()
+		return fmt.Errorf("write signature for %s: %w", w.name, err)
+	}
+	return sw.Close()
+}
+
+// VerifySignature checks a chunk read from r against the contents of its
+// signature sidecar.
+func VerifySignature(pub ed25519.PublicKey, r io.Reader, sidecar []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sidecar)))
+	if err != nil {
+		return fmt.Errorf("decode signature: %w", err)
+	}
+	h := sha512.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	return ed25519.VerifyWithOptions(pub, h.Sum(nil), sig, signOpts)
+}
@@ -0,0 +1,92 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSigningSinkSignatureVerifies(t *testing.T) {
+	dir := t.TempDir()
+	disk, err := NewDiskSink(map[string]interface{}{"path": dir}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create DiskSink: %v", err)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	signing := NewSigningSink(disk, func(context.Context) (ed25519.PrivateKey, error) {
+		return priv, nil
+	})
+
+	// Signatures cover the bytes handed to the sink, i.e. after compression
+	w, err := signing.Open(context.Background(), "chunk.0001.gz")
+	if err != nil {
+		t.Fatalf("Failed to open sink writer: %v", err)
+	}
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write([]byte("{\"cn\":\"example.com\"}\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip close failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	chunk, err := os.ReadFile(filepath.Join(dir, "chunk.0001.gz"))
+	if err != nil {
+		t.Fatalf("Failed to read chunk: %v", err)
+	}
+	sig, err := os.ReadFile(filepath.Join(dir, "chunk.0001.gz"+SignatureSuffix))
+	if err != nil {
+		t.Fatalf("Failed to read signature sidecar: %v", err)
+	}
+
+	if err := VerifySignature(pub, bytes.NewReader(chunk), sig); err != nil {
+		t.Errorf("signature did not verify: %v", err)
+	}
+
+	tampered := append([]byte{}, chunk...)
+	tampered[len(tampered)-1] ^= 0xff
+	if err := VerifySignature(pub, bytes.NewReader(tampered), sig); err == nil {
+		t.Error("expected verification of tampered chunk to fail")
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	seed := priv.Seed()
+
+	for name, raw := range map[string][]byte{
+		"raw seed":    seed,
+		"raw key":     priv,
+		"b64 seed":    []byte(base64.StdEncoding.EncodeToString(seed) + "\n"),
+		"b64 private": []byte(base64.StdEncoding.EncodeToString(priv)),
+	} {
+		got, err := ParseSigningKey(raw)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if !got.Equal(priv) {
+			t.Errorf("%s: parsed key does not match", name)
+		}
+	}
+
+	if _, err := ParseSigningKey([]byte("short")); err == nil {
+		t.Error("expected error for invalid key length")
+	}
+}
@@ -20,6 +20,13 @@ type SinkWriter interface {
 	io.WriteCloser // Write(p []byte) (n int, err error); Close() error
 }
 
+// ReadableSink is implemented by sinks that can read back streams they've written,
+// e.g. for inspecting a shard's output through the API.
+type ReadableSink interface {
+	Sink
+	OpenReader(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
 // SinkFactory constructs a Sink given options and access to a secrets store.
 type SinkFactory func(opts map[string]interface{}, secrets *secrets.Store) (Sink, error)
 
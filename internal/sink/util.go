@@ -1,6 +1,9 @@
 package sink
 
-import "io"
+import (
+	"io"
+	"strconv"
+)
 
 type pipeSinkWriter struct {
 	io.Writer
@@ -23,3 +26,19 @@ func toBool(val interface{}) bool {
 		return false
 	}
 }
+
+func toInt(val interface{}) int {
+	switch v := val.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	default:
+		return 0
+	}
+}
@@ -15,8 +15,9 @@ import (
 	"go.etcd.io/etcd/server/v3/embed"
 )
 
-// Start an embedded etcd cluster for test, return cluster + cleanup
-func SetupEtcdCluster(t *testing.T) (cluster.Cluster, func()) {
+// Start an embedded etcd cluster for test, return cluster + cleanup. Options
+// adjust the cluster config before it's used.
+func SetupEtcdCluster(t *testing.T, opts ...func(*cluster.EtcdConfig)) (cluster.Cluster, func()) {
 	t.Helper()
 	cfg := embed.NewConfig()
 	cfg.Dir = t.TempDir()
@@ -31,12 +32,16 @@ func SetupEtcdCluster(t *testing.T) (cluster.Cluster, func()) {
 		t.Fatal("etcd server did not become ready in time")
 	}
 
-	cl, err := cluster.NewEtcdCluster(cluster.EtcdConfig{
+	clCfg := cluster.EtcdConfig{
 		Endpoints:    []string{e.Clients[0].Addr().String()},
 		DialTimeout:  2 * time.Second,
 		KeychainFile: cfg.Dir + "/certslurp_keychain",
 		Prefix:       "/certslurp_test_" + testutil.RandString(5),
-	})
+	}
+	for _, opt := range opts {
+		opt(&clCfg)
+	}
+	cl, err := cluster.NewEtcdCluster(clCfg)
 	require.NoError(t, err)
 
 	cleanup := func() {
@@ -46,6 +51,16 @@ func SetupEtcdCluster(t *testing.T) (cluster.Cluster, func()) {
 	return cl, cleanup
 }
 
+// Start an in-memory cluster for test, return cluster + cleanup
+func SetupMemoryCluster(t *testing.T) (cluster.Cluster, func()) {
+	t.Helper()
+	cl, err := cluster.NewMemoryCluster(cluster.MemoryConfig{
+		Prefix: "/certslurp_test_" + testutil.RandString(5),
+	})
+	require.NoError(t, err)
+	return cl, func() { _ = cl.Close() }
+}
+
 func DefaultTestJobOptions() job.JobOptions {
 	return job.JobOptions{
 		Output: job.OutputOptions{
@@ -1,8 +1,10 @@
 package testutil
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 )
 
@@ -20,3 +22,36 @@ func NewStubCTLogServer(t *testing.T, sth, entries string) *httptest.Server {
 		}
 	}))
 }
+
+// NewRangedStubCTLogServer is like NewStubCTLogServer, but serves only the
+// entries each get-entries request asks for, as a real log does. onFetch, if
+// set, is called with the start index of each request.
+func NewRangedStubCTLogServer(t *testing.T, sth, entries string, onFetch func(start int64)) *httptest.Server {
+	t.Helper()
+	var log struct {
+		Entries []json.RawMessage `json:"entries"`
+	}
+	if err := json.Unmarshal([]byte(entries), &log); err != nil {
+		t.Fatalf("parse stub CT log entries: %v", err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ct/v1/get-sth":
+			w.Write([]byte(sth))
+		case "/ct/v1/get-entries":
+			start, err1 := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+			end, err2 := strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+			if err1 != nil || err2 != nil || start < 0 || start >= int64(len(log.Entries)) || end < start {
+				http.Error(w, "bad range", http.StatusBadRequest)
+				return
+			}
+			if onFetch != nil {
+				onFetch(start)
+			}
+			end = min(end, int64(len(log.Entries)-1))
+			_ = json.NewEncoder(w).Encode(map[string]any{"entries": log.Entries[start : end+1]})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
@@ -0,0 +1,237 @@
+package testutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// DecodeMsgpackRecords decodes a stream of records written by the msgpack
+// transformer with the given framing ("length", the default, or "newline"),
+// so tests can check its output. Maps decode to map[string]interface{},
+// arrays to []interface{}, integers to int64 (uint64 above math.MaxInt64),
+// binary to []byte and timestamps to time.Time (UTC).
+func DecodeMsgpackRecords(data []byte, framing string) ([]map[string]interface{}, error) {
+	if framing == "" {
+		framing = "length"
+	}
+	var records []map[string]interface{}
+	for len(data) > 0 {
+		body := data
+		if framing == "length" {
+			if len(data) < 4 {
+				return nil, errMsgpackShort
+			}
+			n := binary.BigEndian.Uint32(data)
+			if uint64(len(data)-4) < uint64(n) {
+				return nil, errMsgpackShort
+			}
+			body, data = data[4:4+n], data[4+n:]
+		}
+		d := &msgpackDecoder{buf: body}
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		rec, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("msgpack: record is %T, not a map", v)
+		}
+		records = append(records, rec)
+		switch framing {
+		case "length":
+			if d.pos != len(body) {
+				return nil, errors.New("msgpack: trailing bytes in record")
+			}
+		case "newline":
+			if d.pos >= len(body) || body[d.pos] != '\n' {
+				return nil, errors.New("msgpack: record not followed by newline")
+			}
+			data = body[d.pos+1:]
+		default:
+			return nil, fmt.Errorf("msgpack: unknown framing %q", framing)
+		}
+	}
+	return records, nil
+}
+
+var errMsgpackShort = errors.New("msgpack: unexpected end of data")
+
+type msgpackDecoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.buf)-d.pos < n {
+		return nil, errMsgpackShort
+	}
+	p := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return p, nil
+}
+
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	p, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range p {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (d *msgpackDecoder) decode() (interface{}, error) {
+	p, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := p[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	case c&0xf0 == 0x90:
+		return d.array(int(c & 0x0f))
+	case c&0xf0 == 0x80:
+		return d.mapOf(int(c & 0x0f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil || u > math.MaxInt64 {
+			return u, err
+		}
+		return int64(u), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, nil
+	case 0xca:
+		u, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		p, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), p...), nil
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(int(n))
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(int(n))
+	case 0xd6:
+		return d.ext(4)
+	case 0xd7:
+		return d.ext(8)
+	case 0xc7:
+		n, err := d.uint(1)
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(int(n))
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type code 0x%02x", c)
+}
+
+func (d *msgpackDecoder) str(n int) (interface{}, error) {
+	p, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(p), nil
+}
+
+func (d *msgpackDecoder) array(n int) (interface{}, error) {
+	out := make([]interface{}, 0, min(n, len(d.buf)-d.pos))
+	for i := 0; i < n; i++ {
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (d *msgpackDecoder) mapOf(n int) (interface{}, error) {
+	out := make(map[string]interface{}, min(n, len(d.buf)-d.pos))
+	for i := 0; i < n; i++ {
+		k, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		out[fmt.Sprint(k)] = v
+	}
+	return out, nil
+}
+
+// ext decodes an extension value of n data bytes; only timestamps are supported.
+func (d *msgpackDecoder) ext(n int) (interface{}, error) {
+	p, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	if int8(p[0]) != -1 {
+		return nil, fmt.Errorf("msgpack: unsupported extension type %d", int8(p[0]))
+	}
+	switch n {
+	case 4:
+		sec, err := d.uint(4)
+		return time.Unix(int64(sec), 0).UTC(), err
+	case 8:
+		v, err := d.uint(8)
+		return time.Unix(int64(v&(1<<34-1)), int64(v>>34)).UTC(), err
+	case 12:
+		nsec, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		sec, err := d.uint(8)
+		return time.Unix(int64(sec), int64(nsec)).UTC(), err
+	}
+	return nil, fmt.Errorf("msgpack: invalid timestamp length %d", n)
+}
@@ -0,0 +1,47 @@
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// ReadParquetRows reads a Parquet file written by the parquet transformer,
+// so tests can check its output. Each row maps column names to values, nil
+// for nulls; TIMESTAMP_MICROS columns decode to time.Time (UTC) and string
+// LISTs to []string.
+func ReadParquetRows(data []byte) ([]map[string]interface{}, error) {
+	f, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := parquet.Read[any](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]map[string]interface{}, len(rows))
+	for i, r := range rows {
+		row, ok := r.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("parquet: row is %T, not a map", r)
+		}
+		for _, field := range f.Schema().Fields() {
+			switch v := row[field.Name()].(type) {
+			case int64:
+				if lt := field.Type().LogicalType(); lt != nil && lt.Timestamp != nil {
+					row[field.Name()] = time.UnixMicro(v).UTC()
+				}
+			case []interface{}:
+				list := make([]string, len(v))
+				for j, s := range v {
+					list[j], _ = s.(string)
+				}
+				row[field.Name()] = list
+			}
+		}
+		out[i] = row
+	}
+	return out, nil
+}
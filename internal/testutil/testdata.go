@@ -56,3 +56,23 @@ func RawLogEntryForTestPrecert(t *testing.T, idx int64) *ct.RawLogEntry {
 		Chain: []ct.ASN1Cert{caASN1},
 	}
 }
+
+// RawLogEntryForX509 wraps a DER-encoded certificate in an X509 log entry.
+func RawLogEntryForX509(t *testing.T, der []byte, idx int64) *ct.RawLogEntry {
+	t.Helper()
+	leaf := ct.MerkleTreeLeaf{
+		Version:  ct.V1,
+		LeafType: ct.TimestampedEntryLeafType,
+		TimestampedEntry: &ct.TimestampedEntry{
+			Timestamp:  uint64(time.Now().UnixNano() / 1e6),
+			EntryType:  ct.X509LogEntryType,
+			X509Entry:  &ct.ASN1Cert{Data: der},
+			Extensions: ct.CTExtensions{},
+		},
+	}
+	return &ct.RawLogEntry{
+		Index: idx,
+		Leaf:  leaf,
+		Cert:  ct.ASN1Cert{Data: der},
+	}
+}
@@ -52,6 +52,7 @@ func RunWorkers(ctx context.Context, t *testing.T, cl cluster.Cluster, jobID str
 				}
 
 				if unfinished == 0 {
+					_ = worker.FinalizeJob(ctx, cl, jobID)
 					_ = cl.MarkJobCompleted(ctx, jobID)
 					_ = cl.UpdateJobStatus(ctx, jobID, cluster.JobStateCompleted)
 					return
@@ -0,0 +1,250 @@
+package transformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/etl_core"
+)
+
+/*
+CertstreamTransformer writes each cert_fields record as one line of JSON in
+the shape of a certstream "certificate_update" message, so certslurp output
+can feed tooling built for CT monitoring streams. Fields the extractor didn't
+produce are left out of the message, so enable the ones below that downstream
+tools rely on.
+
+	message_type                         "certificate_update"
+	data.update_type                     "X509LogEntry", or "PrecertLogEntry" when t is "precert"
+	data.leaf_cert.subject.CN            cn
+	data.leaf_cert.subject.O/OU/L/ST/C   org/ou/loc/prv/co, multiple values joined with ", "
+	data.leaf_cert.subject.aggregated    the above as "/C=../ST=../L=../O=../OU=../CN=.."
+	data.leaf_cert.issuer.CN             iss, aggregated as "/CN=.."
+	data.leaf_cert.serial_number         sn, in upper case hex
+	data.leaf_cert.not_before/not_after  nbf/naf, in Unix seconds
+	data.leaf_cert.all_domains           cn followed by dns, without repeats
+	data.leaf_cert.signature_algorithm   sig
+	data.leaf_cert.is_ca                 ca
+	data.leaf_cert.extensions            keyUsage from ku, basicConstraints from ca
+	data.chain                           always empty; issuers aren't extracted
+	data.cert_index                      li
+	data.cert_link                       log's get-entries URL for li
+	data.seen                            fts, or else lts, in fractional Unix seconds
+	data.source.url                      log
+	data.source.name                     transformer_options.source_name, or else log
+
+There's no certificate fingerprint, as the extractor doesn't keep the DER.
+Records for entries that couldn't be parsed (see emit_parse_errors) have no
+certificate to describe and are left out.
+*/
+type CertstreamTransformer struct{}
+
+func (c *CertstreamTransformer) Transform(ctx *etl_core.Context, data map[string]interface{}) ([]byte, error) {
+	if _, ok := data["err"]; ok {
+		return nil, nil
+	}
+
+	msg := certstreamMessage{MessageType: "certificate_update"}
+	msg.Data.UpdateType = "X509LogEntry"
+	if t, _ := data["t"].(string); t == "precert" {
+		msg.Data.UpdateType = "PrecertLogEntry"
+	}
+	msg.Data.Chain = []certstreamCert{}
+
+	leaf := &msg.Data.LeafCert
+	leaf.Subject = certstreamName{
+		"C":  certstreamJoin(data["co"]),
+		"ST": certstreamJoin(data["prv"]),
+		"L":  certstreamJoin(data["loc"]),
+		"O":  certstreamJoin(data["org"]),
+		"OU": certstreamJoin(data["ou"]),
+		"CN": certstreamJoin(data["cn"]),
+	}.withAggregate()
+	leaf.Issuer = certstreamName{"CN": certstreamJoin(data["iss"])}.withAggregate()
+	if sn, ok := data["sn"].(string); ok {
+		leaf.SerialNumber = strings.ToUpper(sn)
+	}
+	if t, ok := certstreamTime(data["nbf"]); ok {
+		leaf.NotBefore = t.Unix()
+	}
+	if t, ok := certstreamTime(data["naf"]); ok {
+		leaf.NotAfter = t.Unix()
+	}
+	leaf.AllDomains = certstreamDomains(data["cn"], data["dns"])
+	leaf.SignatureAlgorithm, _ = data["sig"].(string)
+	leaf.Extensions = map[string]string{}
+	if ku := certstreamJoin(data["ku"]); ku != "" {
+		leaf.Extensions["keyUsage"] = ku
+	}
+	if ca, ok := data["ca"].(bool); ok {
+		leaf.IsCA = ca
+		leaf.Extensions["basicConstraints"] = "CA:FALSE"
+		if ca {
+			leaf.Extensions["basicConstraints"] = "CA:TRUE"
+		}
+	}
+
+	index, hasIndex := certstreamInt(data["li"])
+	msg.Data.CertIndex = index
+	logURL, _ := data["log"].(string)
+	if logURL == "" && ctx != nil && ctx.Spec != nil {
+		logURL = ctx.Spec.LogURI
+	}
+	if logURL != "" && hasIndex {
+		msg.Data.CertLink = fmt.Sprintf("%s/ct/v1/get-entries?start=%d&end=%d", strings.TrimRight(logURL, "/"), index, index)
+	}
+	if seen, ok := certstreamTime(data["fts"]); ok {
+		msg.Data.Seen = float64(seen.UnixMicro()) / 1e6
+	} else if seen, ok := certstreamTime(data["lts"]); ok {
+		msg.Data.Seen = float64(seen.UnixMicro()) / 1e6
+	}
+	msg.Data.Source.URL = logURL
+	msg.Data.Source.Name = logURL
+	if ctx != nil && ctx.Spec != nil {
+		if name, ok := ctx.Spec.Options.Output.TransformerOptions["source_name"].(string); ok && name != "" {
+			msg.Data.Source.Name = name
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *CertstreamTransformer) Header(ctx *etl_core.Context) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (c *CertstreamTransformer) Footer(ctx *etl_core.Context) ([]byte, error) {
+	return []byte{}, nil
+}
+
+type certstreamMessage struct {
+	MessageType string `json:"message_type"`
+	Data        struct {
+		UpdateType string           `json:"update_type"`
+		LeafCert   certstreamCert   `json:"leaf_cert"`
+		Chain      []certstreamCert `json:"chain"`
+		CertIndex  int64            `json:"cert_index"`
+		CertLink   string           `json:"cert_link,omitempty"`
+		Seen       float64          `json:"seen,omitempty"`
+		Source     struct {
+			URL  string `json:"url"`
+			Name string `json:"name"`
+		} `json:"source"`
+	} `json:"data"`
+}
+
+type certstreamCert struct {
+	Subject            certstreamName    `json:"subject"`
+	Issuer             certstreamName    `json:"issuer"`
+	Extensions         map[string]string `json:"extensions"`
+	NotBefore          int64             `json:"not_before,omitempty"`
+	NotAfter           int64             `json:"not_after,omitempty"`
+	SerialNumber       string            `json:"serial_number,omitempty"`
+	AllDomains         []string          `json:"all_domains"`
+	SignatureAlgorithm string            `json:"signature_algorithm,omitempty"`
+	IsCA               bool              `json:"is_ca"`
+}
+
+// certstreamName is a distinguished name keyed by attribute short name.
+type certstreamName map[string]string
+
+// certstreamNameOrder is the order attributes are aggregated in.
+var certstreamNameOrder = []string{"C", "ST", "L", "O", "OU", "CN"}
+
+// withAggregate drops empty attributes and adds the "aggregated" form.
+func (n certstreamName) withAggregate() certstreamName {
+	var agg strings.Builder
+	for _, attr := range certstreamNameOrder {
+		if n[attr] == "" {
+			delete(n, attr)
+			continue
+		}
+		agg.WriteString("/" + attr + "=" + n[attr])
+	}
+	n["aggregated"] = agg.String()
+	return n
+}
+
+func certstreamJoin(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ", ")
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, p := range v {
+			parts = append(parts, fmt.Sprint(p))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return ""
+}
+
+func certstreamDomains(cn, dns interface{}) []string {
+	domains := []string{}
+	seen := map[string]struct{}{}
+	add := func(d string) {
+		if _, ok := seen[d]; d == "" || ok {
+			return
+		}
+		seen[d] = struct{}{}
+		domains = append(domains, d)
+	}
+	if s, ok := cn.(string); ok {
+		add(s)
+	}
+	switch v := dns.(type) {
+	case []string:
+		for _, d := range v {
+			add(d)
+		}
+	case []interface{}:
+		for _, d := range v {
+			if s, ok := d.(string); ok {
+				add(s)
+			}
+		}
+	}
+	return domains
+}
+
+// certstreamTime accepts the time.Time the extractor produces, or the RFC
+// 3339 string it becomes after a JSON round trip.
+func certstreamTime(val interface{}) (time.Time, bool) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, !v.IsZero()
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+func certstreamInt(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func init() {
+	Register("certstream", &CertstreamTransformer{})
+}
@@ -0,0 +1,75 @@
+package transformer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCertstreamTransformer(t *testing.T) {
+	tr, err := ForName("certstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := makeCtx()
+	ctx.Spec.Options.Output.TransformerOptions["source_name"] = "Test Log"
+	record := map[string]interface{}{
+		"t":   "precert",
+		"cn":  "example.com",
+		"org": []string{"Example Inc"},
+		"co":  []string{"US"},
+		"dns": []string{"example.com", "www.example.com"},
+		"iss": "Test CA",
+		"sn":  "0a1b2c",
+		"nbf": time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		"naf": time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+		"sig": "SHA256-RSA",
+		"ku":  []string{"Digital Signature", "Key Encipherment"},
+		"ca":  false,
+		"li":  int64(42),
+		"lts": time.Date(2025, 1, 1, 0, 0, 1, 500_000_000, time.UTC),
+		"log": "https://ct.example.com/log/",
+	}
+
+	out, err := tr.Transform(ctx, record)
+	if err != nil {
+		t.Fatal("certstream.Transform error:", err)
+	}
+	var got interface{}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("certstream.Transform produced invalid JSON: %v", err)
+	}
+	var want interface{}
+	_ = json.Unmarshal([]byte(`{
+		"message_type": "certificate_update",
+		"data": {
+			"update_type": "PrecertLogEntry",
+			"leaf_cert": {
+				"subject": {"C": "US", "O": "Example Inc", "CN": "example.com", "aggregated": "/C=US/O=Example Inc/CN=example.com"},
+				"issuer": {"CN": "Test CA", "aggregated": "/CN=Test CA"},
+				"extensions": {"keyUsage": "Digital Signature, Key Encipherment", "basicConstraints": "CA:FALSE"},
+				"not_before": 1735689600,
+				"not_after": 1743465600,
+				"serial_number": "0A1B2C",
+				"all_domains": ["example.com", "www.example.com"],
+				"signature_algorithm": "SHA256-RSA",
+				"is_ca": false
+			},
+			"chain": [],
+			"cert_index": 42,
+			"cert_link": "https://ct.example.com/log/ct/v1/get-entries?start=42&end=42",
+			"seen": 1735689601.5,
+			"source": {"url": "https://ct.example.com/log/", "name": "Test Log"}
+		}
+	}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("certstream.Transform got:\n%s", out)
+	}
+
+	// Parse error records have no certificate to describe
+	out, err = tr.Transform(ctx, map[string]interface{}{"li": int64(7), "err": "malformed"})
+	if err != nil || len(out) != 0 {
+		t.Errorf("certstream.Transform of a parse error record = %q, %v; want nothing", out, err)
+	}
+}
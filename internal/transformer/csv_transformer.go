@@ -4,56 +4,116 @@ import (
 	"bytes"
 	"encoding/csv"
 	"fmt"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/etl_core"
 )
 
+// CSVDefaultSeparator joins the elements of slice-valued fields (e.g. dns)
+// within a single cell unless transformer_options.separator says otherwise.
+const CSVDefaultSeparator = ";"
+
+// CSVTransformer writes one RFC 4180 row per record, with a header row naming
+// the columns. transformer_options.columns (or its older name, fields) lists
+// the extractor keys to write, in order, either as a list or a comma-separated
+// string like "cn,iss,nbf". Missing keys produce empty cells, slices are
+// joined with the separator, and times are written as RFC 3339.
 type CSVTransformer struct{}
 
 func (c *CSVTransformer) Transform(ctx *etl_core.Context, data map[string]interface{}) ([]byte, error) {
-	fields, _ := ctx.Spec.Options.Output.TransformerOptions["fields"].([]interface{})
-	if len(fields) == 0 {
-		return nil, fmt.Errorf("CSV transformer requires fields option")
-	}
-	row := make([]string, len(fields))
-	for i, f := range fields {
-		key, _ := f.(string)
-		val, _ := data[key]
-		if val == nil {
-			row[i] = ""
-		} else {
-			row[i] = fmt.Sprintf("%v", val)
-		}
+	columns := csvColumns(ctx)
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("CSV transformer requires columns (or fields) option")
 	}
-	buf := &bytes.Buffer{}
-	w := csv.NewWriter(buf)
-	if err := w.Write(row); err != nil {
-		return nil, err
+	sep := csvSeparator(ctx)
+	row := make([]string, len(columns))
+	for i, key := range columns {
+		row[i] = csvCell(data[key], sep)
 	}
-	w.Flush()
-	return buf.Bytes(), w.Error()
+	return csvRow(row)
 }
 
 func (c *CSVTransformer) Header(ctx *etl_core.Context) ([]byte, error) {
-	fields, _ := ctx.Spec.Options.Output.TransformerOptions["fields"].([]interface{})
-	if len(fields) == 0 {
-		return nil, fmt.Errorf("CSV transformer requires fields option for header")
-	}
-	header := make([]string, len(fields))
-	for i, f := range fields {
-		header[i], _ = f.(string)
+	columns := csvColumns(ctx)
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("CSV transformer requires columns (or fields) option for header")
 	}
+	return csvRow(columns)
+}
+
+func (c *CSVTransformer) Footer(ctx *etl_core.Context) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func csvRow(cells []string) ([]byte, error) {
 	buf := &bytes.Buffer{}
 	w := csv.NewWriter(buf)
-	if err := w.Write(header); err != nil {
+	if err := w.Write(cells); err != nil {
 		return nil, err
 	}
 	w.Flush()
 	return buf.Bytes(), w.Error()
 }
 
-func (c *CSVTransformer) Footer(ctx *etl_core.Context) ([]byte, error) {
-	return []byte{}, nil
+func csvColumns(ctx *etl_core.Context) []string {
+	if ctx == nil || ctx.Spec == nil {
+		return nil
+	}
+	opts := ctx.Spec.Options.Output.TransformerOptions
+	v, ok := opts["columns"]
+	if !ok {
+		v = opts["fields"]
+	}
+	var columns []string
+	switch vv := v.(type) {
+	case string:
+		for _, col := range strings.Split(vv, ",") {
+			if col = strings.TrimSpace(col); col != "" {
+				columns = append(columns, col)
+			}
+		}
+	case []string:
+		columns = vv
+	case []interface{}:
+		for _, col := range vv {
+			if s, ok := col.(string); ok {
+				columns = append(columns, s)
+			}
+		}
+	}
+	return columns
+}
+
+func csvSeparator(ctx *etl_core.Context) string {
+	if sep, ok := ctx.Spec.Options.Output.TransformerOptions["separator"].(string); ok && sep != "" {
+		return sep
+	}
+	return CSVDefaultSeparator
+}
+
+func csvCell(val interface{}, sep string) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	}
+	if rv := reflect.ValueOf(val); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		parts := make([]string, rv.Len())
+		for i := range parts {
+			parts[i] = csvCell(rv.Index(i).Interface(), sep)
+		}
+		return strings.Join(parts, sep)
+	}
+	return fmt.Sprintf("%v", val)
 }
 
 func init() {
@@ -3,8 +3,10 @@ package transformer
 import (
 	"bytes"
 	"encoding/csv"
+	"net"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCSVTransformer(t *testing.T) {
@@ -62,3 +64,55 @@ func TestCSVTransformer_Errors(t *testing.T) {
 		t.Errorf("csv.Transform should error on missing fields, got: %v", err)
 	}
 }
+
+func TestCSVTransformer_ColumnsAndSeparator(t *testing.T) {
+	tr, _ := ForName("csv")
+	ctx := makeCtx()
+	ctx.Spec.Options.Output.TransformerOptions = map[string]interface{}{
+		"columns":   "cn, dns,ips,nbf,missing",
+		"separator": "|",
+	}
+
+	header, err := tr.Header(ctx)
+	if err != nil {
+		t.Fatal("csv.Header error:", err)
+	}
+	if string(header) != "cn,dns,ips,nbf,missing\n" {
+		t.Errorf("csv.Header got %q", header)
+	}
+
+	row, err := tr.Transform(ctx, map[string]interface{}{
+		"cn":  "example.com",
+		"dns": []string{"example.com", "www.example.com"},
+		"ips": []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")},
+		"nbf": time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal("csv.Transform error:", err)
+	}
+	want := "example.com,example.com|www.example.com,192.0.2.1|192.0.2.2,2025-01-02T03:04:05Z,\n"
+	if string(row) != want {
+		t.Errorf("csv.Transform got %q, want %q", row, want)
+	}
+}
+
+func TestCSVTransformer_Escaping(t *testing.T) {
+	tr, _ := ForName("csv")
+	ctx := makeCtx("sub", "cn")
+	subject := `CN=Acme, Inc.,O="Quoted" Org`
+
+	row, err := tr.Transform(ctx, map[string]interface{}{"sub": subject, "cn": "multi\nline"})
+	if err != nil {
+		t.Fatal("csv.Transform error:", err)
+	}
+	if want := "\"CN=Acme, Inc.,O=\"\"Quoted\"\" Org\",\"multi\nline\"\n"; string(row) != want {
+		t.Errorf("csv.Transform got %q, want %q", row, want)
+	}
+	cells, err := csv.NewReader(bytes.NewReader(row)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cells[0] != subject || cells[1] != "multi\nline" {
+		t.Errorf("round trip got %q", cells)
+	}
+}
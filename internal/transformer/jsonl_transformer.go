@@ -2,19 +2,56 @@ package transformer
 
 import (
 	"bytes"
+	"encoding"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/etl_core"
 )
 
+// BigQuery array handling, set with transformer_options.array_mode when
+// transformer_options.bigquery is enabled.
+const (
+	BigQueryArraysRepeated  = "repeated"  // arrays of scalars, loadable as REPEATED columns (default)
+	BigQueryArraysDelimited = "delimited" // arrays joined into one string with array_delimiter
+)
+
+// BigQueryTimestampFormat is RFC 3339 at the microsecond precision BigQuery
+// TIMESTAMP columns store.
+const BigQueryTimestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// JSONLTransformer writes each record as one line of compact JSON. Keys are
+// always written in sorted order, so output is deterministic. With
+// transformer_options.bigquery set, records are reshaped for BigQuery load
+// jobs: nested objects are flattened into parent_child columns, arrays are
+// handled per array_mode, and timestamps are written in UTC with microsecond
+// precision.
 type JSONLTransformer struct{}
 
 func (j *JSONLTransformer) Transform(ctx *etl_core.Context, data map[string]interface{}) ([]byte, error) {
+	bq, err := bigQueryOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var record interface{} = data
+	if bq != nil {
+		flat := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			bq.flatten(flat, bigQueryColumn(k), v)
+		}
+		record = flat
+	}
+
 	buf := &bytes.Buffer{}
 	enc := json.NewEncoder(buf)
 	enc.SetEscapeHTML(false)
 
-	if err := enc.Encode(data); err != nil {
+	if err := enc.Encode(record); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
@@ -28,6 +65,170 @@ func (c *JSONLTransformer) Footer(ctx *etl_core.Context) ([]byte, error) {
 	return []byte{}, nil
 }
 
+type bigQueryFlattener struct {
+	arrayMode string
+	delimiter string
+}
+
+// bigQueryOptions returns the BigQuery flattening settings, or nil when the
+// mode isn't enabled.
+func bigQueryOptions(ctx *etl_core.Context) (*bigQueryFlattener, error) {
+	if ctx == nil || ctx.Spec == nil {
+		return nil, nil
+	}
+	opts := ctx.Spec.Options.Output.TransformerOptions
+	if enabled, _ := opts["bigquery"].(bool); !enabled {
+		return nil, nil
+	}
+	f := &bigQueryFlattener{arrayMode: BigQueryArraysRepeated, delimiter: ","}
+	if mode, _ := opts["array_mode"].(string); mode != "" {
+		if mode != BigQueryArraysRepeated && mode != BigQueryArraysDelimited {
+			return nil, fmt.Errorf("jsonl transformer: unknown array_mode %q (want %q or %q)", mode, BigQueryArraysRepeated, BigQueryArraysDelimited)
+		}
+		f.arrayMode = mode
+	}
+	if delim, ok := opts["array_delimiter"].(string); ok && delim != "" {
+		f.delimiter = delim
+	}
+	return f, nil
+}
+
+// flatten stores v under key in out, descending into objects so that every
+// value written is a scalar or an array of scalars.
+func (f *bigQueryFlattener) flatten(out map[string]interface{}, key string, v interface{}) {
+	switch vv := bigQueryValue(v).(type) {
+	case map[string]interface{}:
+		for k, child := range vv {
+			f.flatten(out, key+"_"+bigQueryColumn(k), child)
+		}
+	case []interface{}:
+		elems := make([]interface{}, 0, len(vv))
+		for _, e := range vv {
+			e = bigQueryValue(e)
+			switch e.(type) {
+			case nil:
+				// BigQuery rejects NULL elements in repeated fields
+				continue
+			case map[string]interface{}, []interface{}:
+				// Arrays can't nest, so keep nested shapes as JSON strings
+				raw, _ := json.Marshal(e)
+				e = string(raw)
+			}
+			elems = append(elems, e)
+		}
+		if f.arrayMode == BigQueryArraysDelimited {
+			parts := make([]string, len(elems))
+			for i, e := range elems {
+				parts[i] = fmt.Sprint(e)
+			}
+			out[key] = strings.Join(parts, f.delimiter)
+		} else {
+			out[key] = elems
+		}
+	default:
+		out[key] = vv
+	}
+}
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// bigQueryValue reduces v to nil, a scalar, a map[string]interface{} or a
+// []interface{}. Times become BigQuery timestamps, byte slices base64 (as
+// BYTES columns expect), and types with a text form (IPs, URLs) strings.
+func bigQueryValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		if hasTextForm(rv.Type()) && !hasTextForm(rv.Type().Elem()) {
+			// Pointer-receiver methods, e.g. *url.URL
+			break
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+
+	switch t := rv.Type(); {
+	case t == timeType:
+		return rv.Interface().(time.Time).UTC().Format(BigQueryTimestampFormat)
+	case t.Implements(textMarshalerType):
+		if text, err := rv.Interface().(encoding.TextMarshaler).MarshalText(); err == nil {
+			return string(text)
+		}
+	case t.Implements(stringerType):
+		return rv.Interface().(fmt.Stringer).String()
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return base64.StdEncoding.EncodeToString(b)
+		}
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			out[i] = rv.Index(i).Interface()
+		}
+		return out
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+		out := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key().Interface())] = iter.Value().Interface()
+		}
+		return out
+	}
+
+	// Anything else (structs) goes through its JSON representation
+	raw, err := json.Marshal(rv.Interface())
+	if err != nil {
+		return fmt.Sprint(rv.Interface())
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return string(raw)
+	}
+	return bigQueryValue(generic)
+}
+
+func hasTextForm(t reflect.Type) bool {
+	return t == timeType || t.Implements(textMarshalerType) || t.Implements(stringerType)
+}
+
+// bigQueryColumn maps a key to a valid BigQuery column name, replacing
+// anything other than letters, digits and underscores.
+func bigQueryColumn(k string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, k)
+}
+
 func init() {
 	Register("jsonl", &JSONLTransformer{})
 }
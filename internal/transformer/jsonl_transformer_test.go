@@ -1,8 +1,16 @@
 package transformer
 
 import (
+	"bytes"
 	"encoding/json"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/etl_core"
 )
 
 func TestJSONLTransformer(t *testing.T) {
@@ -36,3 +44,145 @@ func TestJSONLTransformer(t *testing.T) {
 		t.Errorf("jsonl.Transform unexpected content: %v", parsed)
 	}
 }
+
+func bigQueryCtx(opts map[string]interface{}) *etl_core.Context {
+	ctx := makeCtx()
+	ctx.Spec.Options.Output.TransformerOptions = opts
+	return ctx
+}
+
+func bigQueryRecord() map[string]interface{} {
+	pathLen := 0
+	uri, _ := url.Parse("https://example.com/a")
+	return map[string]interface{}{
+		"cn":      "example.com",
+		"dns":     []string{"example.com", "www.example.com"},
+		"ips":     []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")},
+		"uris":    []*url.URL{uri},
+		"nbf":     time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.FixedZone("X", 3600)),
+		"pathlen": &pathLen,
+		"raw":     []byte{0xde, 0xad},
+		"meta":    map[string]interface{}{"log url": "https://log", "seen": map[string]interface{}{"count": 2}},
+		"exts":    []interface{}{map[string]interface{}{"oid": "1.2.3"}, nil},
+	}
+}
+
+// checkBigQuerySchema fails if a decoded record has nested objects, nested
+// arrays or column names BigQuery wouldn't accept.
+func checkBigQuerySchema(t *testing.T, rec map[string]interface{}) {
+	t.Helper()
+	for k, v := range rec {
+		if bigQueryColumn(k) != k {
+			t.Errorf("column %q is not a valid BigQuery column name", k)
+		}
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			t.Errorf("column %q is a nested object: %v", k, vv)
+		case []interface{}:
+			for _, e := range vv {
+				switch e.(type) {
+				case nil, map[string]interface{}, []interface{}:
+					t.Errorf("column %q has a non-scalar element: %#v", k, e)
+				}
+			}
+		}
+	}
+}
+
+func TestJSONLTransformer_CompactSortedOutput(t *testing.T) {
+	tr, err := ForName("jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := map[string]interface{}{"sub": "CN=a<b>&c", "cn": "a.example", "dns": []string{"a.example"}, "li": 7}
+	want := `{"cn":"a.example","dns":["a.example"],"li":7,"sub":"CN=a<b>&c"}` + "\n"
+	for i := 0; i < 10; i++ {
+		out, err := tr.Transform(makeCtx(), input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != want {
+			t.Fatalf("got %q, want %q", out, want)
+		}
+	}
+}
+
+func TestJSONLTransformer_BigQueryRepeated(t *testing.T) {
+	tr, _ := ForName("jsonl")
+	out, err := tr.Transform(bigQueryCtx(map[string]interface{}{"bigquery": true}), bigQueryRecord())
+	if err != nil {
+		t.Fatal("jsonl.Transform error:", err)
+	}
+	if !bytes.HasSuffix(out, []byte("\n")) || bytes.Count(out, []byte("\n")) != 1 {
+		t.Fatalf("expected a single newline-terminated line, got %q", out)
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal(out, &rec); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	checkBigQuerySchema(t, rec)
+
+	want := map[string]interface{}{
+		"cn":              "example.com",
+		"dns":             []interface{}{"example.com", "www.example.com"},
+		"ips":             []interface{}{"192.0.2.1", "2001:db8::1"},
+		"uris":            []interface{}{"https://example.com/a"},
+		"nbf":             "2024-03-01T11:30:00.123456Z",
+		"pathlen":         float64(0),
+		"raw":             "3q0=",
+		"meta_log_url":    "https://log",
+		"meta_seen_count": float64(2),
+		"exts":            []interface{}{`{"oid":"1.2.3"}`},
+	}
+	if !reflect.DeepEqual(rec, want) {
+		t.Errorf("bigquery record:\n got %#v\nwant %#v", rec, want)
+	}
+	if _, err := time.Parse(time.RFC3339, rec["nbf"].(string)); err != nil {
+		t.Errorf("timestamp is not RFC 3339: %v", err)
+	}
+}
+
+func TestJSONLTransformer_BigQueryDelimited(t *testing.T) {
+	tr, _ := ForName("jsonl")
+	ctx := bigQueryCtx(map[string]interface{}{
+		"bigquery":        true,
+		"array_mode":      "delimited",
+		"array_delimiter": "|",
+	})
+	out, err := tr.Transform(ctx, bigQueryRecord())
+	if err != nil {
+		t.Fatal("jsonl.Transform error:", err)
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal(out, &rec); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	checkBigQuerySchema(t, rec)
+	for _, k := range []string{"dns", "ips", "uris", "exts"} {
+		if _, ok := rec[k].(string); !ok {
+			t.Errorf("delimited column %q is %T, want string", k, rec[k])
+		}
+	}
+	if rec["dns"] != "example.com|www.example.com" {
+		t.Errorf("dns got %q", rec["dns"])
+	}
+}
+
+func TestJSONLTransformer_BigQueryOptions(t *testing.T) {
+	tr, _ := ForName("jsonl")
+	input := map[string]interface{}{"meta": map[string]interface{}{"a": 1}}
+
+	// Without the option, records are written unchanged
+	out, err := tr.Transform(makeCtx(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "{\"meta\":{\"a\":1}}\n" {
+		t.Errorf("plain jsonl got %q", out)
+	}
+
+	_, err = tr.Transform(bigQueryCtx(map[string]interface{}{"bigquery": true, "array_mode": "nested"}), input)
+	if err == nil || !strings.Contains(err.Error(), "array_mode") {
+		t.Errorf("expected an array_mode error, got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package transformer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/etl_core"
+)
+
+// MessagePack record framings, set with transformer_options.framing.
+const (
+	MsgpackFramingLength  = "length"  // 4-byte big-endian length before each record (default)
+	MsgpackFramingNewline = "newline" // "\n" after each record
+)
+
+// MsgpackTransformer serializes each record as a MessagePack map. Times are
+// encoded with the MessagePack timestamp extension; values of other types
+// (e.g. structs) are encoded via their JSON form.
+type MsgpackTransformer struct{}
+
+func (m *MsgpackTransformer) Transform(ctx *etl_core.Context, data map[string]interface{}) ([]byte, error) {
+	framing, err := msgpackFraming(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var buf []byte
+	if framing == MsgpackFramingLength {
+		buf = make([]byte, 4, 256)
+	}
+	buf, err = appendMsgpack(buf, reflect.ValueOf(data))
+	if err != nil {
+		return nil, err
+	}
+	switch framing {
+	case MsgpackFramingLength:
+		binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	case MsgpackFramingNewline:
+		buf = append(buf, '\n')
+	}
+	return buf, nil
+}
+
+func (m *MsgpackTransformer) Header(ctx *etl_core.Context) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (m *MsgpackTransformer) Footer(ctx *etl_core.Context) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func msgpackFraming(ctx *etl_core.Context) (string, error) {
+	if ctx == nil || ctx.Spec == nil {
+		return MsgpackFramingLength, nil
+	}
+	framing, _ := ctx.Spec.Options.Output.TransformerOptions["framing"].(string)
+	switch framing {
+	case "":
+		return MsgpackFramingLength, nil
+	case MsgpackFramingLength, MsgpackFramingNewline:
+		return framing, nil
+	default:
+		return "", fmt.Errorf("msgpack transformer: unknown framing %q (want %q or %q)", framing, MsgpackFramingLength, MsgpackFramingNewline)
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func appendMsgpack(b []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(b, 0xc0), nil
+	}
+	if v.Type() == timeType {
+		return appendMsgpackTime(b, v.Interface().(time.Time)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+		return appendMsgpack(b, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendMsgpackInt(b, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendMsgpackUint(b, v.Uint()), nil
+	case reflect.Float32:
+		b = append(b, 0xca)
+		return binary.BigEndian.AppendUint32(b, math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		return appendMsgpackString(b, v.String()), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendMsgpackBytes(b, v), nil
+		}
+		b = appendMsgpackHeader(b, v.Len(), 0x90, 0xdc, 0xdd)
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			if b, err = appendMsgpack(b, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+		// Sort keys so equal records encode identically
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		b = appendMsgpackHeader(b, len(keys), 0x80, 0xde, 0xdf)
+		var err error
+		for _, k := range keys {
+			if b, err = appendMsgpack(b, k); err != nil {
+				return nil, err
+			}
+			if b, err = appendMsgpack(b, v.MapIndex(k)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		// Fall back to the value's JSON representation
+		raw, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("msgpack: unsupported value of type %s: %w", v.Type(), err)
+		}
+		var generic interface{}
+		if err := json.Unmarshal(raw, &generic); err != nil {
+			return nil, err
+		}
+		return appendMsgpack(b, reflect.ValueOf(generic))
+	}
+}
+
+func appendMsgpackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0:
+		return appendMsgpackUint(b, uint64(n))
+	case n >= -32:
+		return append(b, byte(n))
+	case n >= math.MinInt8:
+		return append(b, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+	}
+}
+
+func appendMsgpackUint(b []byte, n uint64) []byte {
+	switch {
+	case n <= 0x7f:
+		return append(b, byte(n))
+	case n <= math.MaxUint8:
+		return append(b, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), n)
+	}
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackBytes(b []byte, v reflect.Value) []byte {
+	n := v.Len()
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+	for i := 0; i < n; i++ {
+		b = append(b, byte(v.Index(i).Uint()))
+	}
+	return b
+}
+
+// appendMsgpackHeader writes an array or map header: fix is the fixarray or
+// fixmap prefix, c16 and c32 the 16- and 32-bit length codes.
+func appendMsgpackHeader(b []byte, n int, fix, c16, c32 byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, c16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, c32), uint32(n))
+	}
+}
+
+// appendMsgpackTime encodes t with the timestamp extension (type -1), using the
+// smallest of the 32, 64 and 96-bit forms that fits.
+func appendMsgpackTime(b []byte, t time.Time) []byte {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec>>34 == 0 && nsec == 0 && sec <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd6, 0xff), uint32(sec))
+	case sec >= 0 && sec>>34 == 0:
+		return binary.BigEndian.AppendUint64(append(b, 0xd7, 0xff), uint64(nsec)<<34|uint64(sec))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc7, 12, 0xff), uint32(nsec))
+		return binary.BigEndian.AppendUint64(b, uint64(sec))
+	}
+}
+
+func init() {
+	Register("msgpack", &MsgpackTransformer{})
+}
@@ -0,0 +1,97 @@
+package transformer
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/etl_core"
+	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/testutil"
+)
+
+func msgpackCtx(framing string) *etl_core.Context {
+	return &etl_core.Context{Spec: &job.JobSpec{Options: job.JobOptions{Output: job.OutputOptions{
+		TransformerOptions: map[string]interface{}{"framing": framing},
+	}}}}
+}
+
+func TestMsgpackTransformer_RoundTrip(t *testing.T) {
+	tr, err := ForName("msgpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", 300)
+	many := make([]string, 20)
+	for i := range many {
+		many[i] = "san" + strings.Repeat("a", i)
+	}
+	input := map[string]interface{}{
+		"cn":     "example.com",
+		"long":   long,
+		"dns":    many,
+		"small":  7,
+		"neg":    -100000,
+		"big":    uint64(1 << 40),
+		"huge":   uint64(math.MaxUint64),
+		"float":  1.5,
+		"ok":     true,
+		"none":   nil,
+		"raw":    []byte{0x0a, 0x00, 0xff},
+		"nbf":    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"lts":    time.Date(2024, 1, 2, 3, 4, 5, 6789, time.UTC),
+		"old":    time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC),
+		"nested": map[string]interface{}{"k": []interface{}{"v", int64(-1)}},
+	}
+	want := map[string]interface{}{
+		"cn":     "example.com",
+		"long":   long,
+		"small":  int64(7),
+		"neg":    int64(-100000),
+		"big":    int64(1 << 40),
+		"huge":   uint64(math.MaxUint64),
+		"float":  1.5,
+		"ok":     true,
+		"none":   nil,
+		"raw":    []byte{0x0a, 0x00, 0xff},
+		"nbf":    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"lts":    time.Date(2024, 1, 2, 3, 4, 5, 6789, time.UTC),
+		"old":    time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC),
+		"nested": map[string]interface{}{"k": []interface{}{"v", int64(-1)}},
+	}
+	dns := make([]interface{}, len(many))
+	for i, s := range many {
+		dns[i] = s
+	}
+	want["dns"] = dns
+
+	for _, framing := range []string{MsgpackFramingLength, MsgpackFramingNewline} {
+		ctx := msgpackCtx(framing)
+		out, err := tr.Transform(ctx, input)
+		if err != nil {
+			t.Fatalf("%s: Transform error: %v", framing, err)
+		}
+		// Two records back to back, as they'd appear in a chunk
+		records, err := testutil.DecodeMsgpackRecords(append(out, out...), framing)
+		if err != nil {
+			t.Fatalf("%s: decode error: %v", framing, err)
+		}
+		if len(records) != 2 {
+			t.Fatalf("%s: got %d records, want 2", framing, len(records))
+		}
+		for _, rec := range records {
+			if !reflect.DeepEqual(rec, want) {
+				t.Errorf("%s: round trip mismatch:\n got: %#v\nwant: %#v", framing, rec, want)
+			}
+		}
+	}
+}
+
+func TestMsgpackTransformer_UnknownFraming(t *testing.T) {
+	tr, _ := ForName("msgpack")
+	if _, err := tr.Transform(msgpackCtx("xml"), map[string]interface{}{"a": 1}); err == nil {
+		t.Fatal("expected error for unknown framing")
+	}
+}
@@ -0,0 +1,233 @@
+package transformer
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/etl_core"
+	"github.com/chtzvt/certslurp/internal/extractor"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+// parquetKind is what a ParquetSchema column holds.
+type parquetKind int
+
+const (
+	parquetString parquetKind = iota
+	parquetInt64
+	parquetBool
+	parquetTimestamp
+	parquetStringList
+)
+
+func (k parquetKind) String() string {
+	return [...]string{"string", "int64", "bool", "timestamp", "string list"}[k]
+}
+
+// parquetColumn is one column of ParquetSchema.
+type parquetColumn struct {
+	name string
+	kind parquetKind
+}
+
+// parquetColumns has one column per field of CertFieldsExtractorOutput,
+// named by its JSON key.
+var parquetColumns = certFieldsParquetColumns()
+
+// ParquetSchema has one nullable column per field of
+// CertFieldsExtractorOutput, named by its JSON key: strings as UTF8, integers
+// as INT64, times as TIMESTAMP_MICROS, and string slices as LISTs.
+var ParquetSchema = certFieldsParquetSchema()
+
+// ParquetTransformer writes each chunk as one Parquet file with a fixed
+// schema (ParquetSchema), so it's meant to be paired with the cert_fields
+// extractor. Keys without a column are dropped, and missing keys are null.
+// The file can only be written once the whole chunk is buffered, so chunks
+// are limited by chunk_records alone; chunk_bytes is rejected. Pages are
+// uncompressed unless transformer_options.codec is "gzip". Sink compression
+// is rejected, since it would wrap the file itself.
+type ParquetTransformer struct{}
+
+// Transform encodes a single record as a complete one-row Parquet file. The
+// pipeline instead uses NewChunk to write whole chunks.
+func (p *ParquetTransformer) Transform(ctx *etl_core.Context, data map[string]interface{}) ([]byte, error) {
+	enc, err := p.NewChunk(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.Add(data); err != nil {
+		return nil, err
+	}
+	return enc.Finish()
+}
+
+func (p *ParquetTransformer) Header(ctx *etl_core.Context) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (p *ParquetTransformer) Footer(ctx *etl_core.Context) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (p *ParquetTransformer) NewChunk(ctx *etl_core.Context) (ChunkEncoder, error) {
+	var codec compress.Codec = &parquet.Uncompressed
+	if ctx != nil && ctx.Spec != nil {
+		switch name, _ := ctx.Spec.Options.Output.TransformerOptions["codec"].(string); name {
+		case "", "uncompressed":
+		case "gzip":
+			codec = &parquet.Gzip
+		default:
+			return nil, fmt.Errorf("parquet transformer: unknown codec %q (want \"uncompressed\" or \"gzip\")", name)
+		}
+	}
+	c := &parquetChunk{}
+	c.w = parquet.NewWriter(&c.buf, ParquetSchema, parquet.Compression(codec))
+	return c, nil
+}
+
+type parquetChunk struct {
+	buf bytes.Buffer
+	w   *parquet.Writer
+}
+
+func (c *parquetChunk) Add(data map[string]interface{}) error {
+	row := make(map[string]interface{}, len(parquetColumns))
+	for _, col := range parquetColumns {
+		v, err := parquetValue(col.kind, data[col.name])
+		if err != nil {
+			return fmt.Errorf("parquet transformer: column %s: %w", col.name, err)
+		}
+		if v != nil {
+			row[col.name] = v
+		}
+	}
+	return c.w.Write(row)
+}
+
+func (c *parquetChunk) Finish() ([]byte, error) {
+	if err := c.w.Close(); err != nil {
+		return nil, fmt.Errorf("parquet transformer: %w", err)
+	}
+	return c.buf.Bytes(), nil
+}
+
+func certFieldsParquetSchema() *parquet.Schema {
+	group := parquet.Group{}
+	for _, col := range parquetColumns {
+		var node parquet.Node
+		switch col.kind {
+		case parquetString:
+			node = parquet.String()
+		case parquetInt64:
+			node = parquet.Int(64)
+		case parquetBool:
+			node = parquet.Leaf(parquet.BooleanType)
+		case parquetTimestamp:
+			node = parquet.Timestamp(parquet.Microsecond)
+		case parquetStringList:
+			node = parquet.List(parquet.String())
+		}
+		group[col.name] = parquet.Optional(node)
+	}
+	return parquet.NewSchema("cert_fields", group)
+}
+
+func certFieldsParquetColumns() []parquetColumn {
+	t := reflect.TypeOf(extractor.CertFieldsExtractorOutput{})
+	columns := make([]parquetColumn, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		kind := parquetString
+		switch {
+		case ft == timeType:
+			kind = parquetTimestamp
+		case ft.Kind() == reflect.Bool:
+			kind = parquetBool
+		case ft.Kind() >= reflect.Int && ft.Kind() <= reflect.Uint64:
+			kind = parquetInt64
+		case ft.Kind() == reflect.Slice:
+			kind = parquetStringList
+		}
+		columns = append(columns, parquetColumn{name: name, kind: kind})
+	}
+	return columns
+}
+
+// parquetValue converts an extracted value to what the column holds, or nil
+// for null.
+func parquetValue(kind parquetKind, v interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		if hasTextForm(rv.Type()) {
+			// Pointer-receiver methods, e.g. *url.URL
+			break
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil, nil
+	}
+	v = rv.Interface()
+
+	switch kind {
+	case parquetString:
+		switch vv := v.(type) {
+		case string:
+			return vv, nil
+		case fmt.Stringer:
+			return vv.String(), nil
+		}
+		return fmt.Sprint(v), nil
+	case parquetInt64:
+		switch {
+		case rv.CanInt():
+			return rv.Int(), nil
+		case rv.CanUint() && rv.Uint() <= math.MaxInt64:
+			return int64(rv.Uint()), nil
+		}
+	case parquetBool:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case parquetTimestamp:
+		if ts, ok := v.(time.Time); ok {
+			return ts, nil
+		}
+	case parquetStringList:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil, nil
+		}
+		if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+			list := make([]string, rv.Len())
+			for i := range list {
+				s, err := parquetValue(parquetString, rv.Index(i).Interface())
+				if err != nil {
+					return nil, err
+				}
+				list[i], _ = s.(string)
+			}
+			return list, nil
+		}
+	}
+	return nil, fmt.Errorf("can't convert %T to %s", v, kind)
+}
+
+func init() {
+	Register("parquet", &ParquetTransformer{})
+}
@@ -0,0 +1,110 @@
+package transformer
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/extractor"
+	"github.com/chtzvt/certslurp/internal/testutil"
+)
+
+func TestParquetSchema_FollowsCertFieldsOutput(t *testing.T) {
+	n := reflect.TypeOf(extractor.CertFieldsExtractorOutput{}).NumField()
+	if got := len(ParquetSchema.Fields()); got != n {
+		t.Fatalf("schema has %d columns, CertFieldsExtractorOutput has %d fields", got, n)
+	}
+	kinds := map[string]parquetKind{}
+	for _, col := range parquetColumns {
+		kinds[col.name] = col.kind
+	}
+	for name, want := range map[string]parquetKind{
+		"cn":      parquetString,
+		"dns":     parquetStringList,
+		"ips":     parquetStringList,
+		"nbf":     parquetTimestamp,
+		"li":      parquetInt64,
+		"vd":      parquetInt64,
+		"pathlen": parquetInt64,
+		"shard":   parquetInt64,
+		"ca":      parquetBool,
+	} {
+		if kinds[name] != want {
+			t.Errorf("column %s: got %s, want %s", name, kinds[name], want)
+		}
+	}
+	for _, f := range ParquetSchema.Fields() {
+		if !f.Optional() {
+			t.Errorf("column %s should be nullable", f.Name())
+		}
+	}
+}
+
+func TestParquetTransformer_Transform(t *testing.T) {
+	tr, err := ForName("parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tr.(ChunkTransformer); !ok {
+		t.Fatal("parquet transformer should encode whole chunks")
+	}
+
+	nbf := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	uri, _ := url.Parse("https://a.example/x")
+	out, err := tr.Transform(makeCtx(), map[string]interface{}{
+		"cn":      "a.example",
+		"dns":     []string{"a.example", "www.a.example"},
+		"ips":     []net.IP{net.ParseIP("192.0.2.1")},
+		"uris":    []*url.URL{uri},
+		"nbf":     nbf,
+		"li":      int64(7),
+		"vd":      90,
+		"ca":      true,
+		"unknown": "dropped",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := testutil.ReadParquetRows(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(rows))
+	}
+	row := rows[0]
+	want := map[string]interface{}{
+		"cn":   "a.example",
+		"dns":  []string{"a.example", "www.a.example"},
+		"ips":  []string{"192.0.2.1"},
+		"uris": []string{"https://a.example/x"},
+		"nbf":  nbf,
+		"li":   int64(7),
+		"vd":   int64(90),
+		"ca":   true,
+		"sub":  nil,
+		"em":   nil,
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(row[k], v) {
+			t.Errorf("%s: got %#v, want %#v", k, row[k], v)
+		}
+	}
+}
+
+func TestParquetTransformer_Errors(t *testing.T) {
+	tr := &ParquetTransformer{}
+
+	if _, err := tr.Transform(makeCtx(), map[string]interface{}{"nbf": "not a time"}); err == nil {
+		t.Error("expected an error for a value that doesn't fit its column")
+	}
+
+	ctx := makeCtx()
+	ctx.Spec.Options.Output.TransformerOptions["codec"] = "lz77"
+	if _, err := tr.NewChunk(ctx); err == nil {
+		t.Error("expected an error for an unknown codec")
+	}
+}
@@ -18,6 +18,26 @@ type Transformer interface {
 	Footer(ctx *etl_core.Context) ([]byte, error)
 }
 
+// ChunkTransformer is implemented by transformers whose formats can only be
+// written once a chunk's records are all known, such as columnar files. The
+// pipeline gives each record to the chunk's encoder and writes what Finish
+// returns when the chunk closes; Transform, Header and Footer aren't used.
+// Since output size isn't known until then, chunks can only be limited by
+// record count.
+type ChunkTransformer interface {
+	Transformer
+	NewChunk(ctx *etl_core.Context) (ChunkEncoder, error)
+}
+
+// ChunkEncoder accumulates one chunk's records.
+type ChunkEncoder interface {
+	// Add buffers a record. A record that can't be encoded returns an error
+	// and is left out of the chunk.
+	Add(data map[string]interface{}) error
+	// Finish returns the encoded chunk.
+	Finish() ([]byte, error)
+}
+
 var registry = make(map[string]Transformer)
 
 func Register(name string, t Transformer) {
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/cluster"
+	ct "github.com/google/certificate-transparency-go"
+)
+
+// shardProgress tracks a shard the worker is processing, for reporting in
+// heartbeats. The index range is only known once the shard status has been
+// read, so it stays zero until then.
+type shardProgress struct {
+	started   time.Time
+	indexFrom atomic.Int64
+	indexTo   atomic.Int64
+	processed atomic.Int64
+}
+
+func (p *shardProgress) setRange(from, to int64) {
+	p.indexFrom.Store(from)
+	p.indexTo.Store(to)
+}
+
+// count forwards entries from in to out, counting each one, and closes out
+// once in is closed or ctx is done.
+func (p *shardProgress) count(ctx context.Context, in <-chan *ct.RawLogEntry, out chan<- *ct.RawLogEntry) {
+	defer close(out)
+	for entry := range in {
+		select {
+		case out <- entry:
+			p.processed.Add(1)
+		case <-ctx.Done():
+			// Keep draining so the scanner isn't left blocked on send
+			for range in {
+			}
+			return
+		}
+	}
+}
+
+func (w *Worker) startShard(ref ShardRef) *shardProgress {
+	w.activeMu.Lock()
+	defer w.activeMu.Unlock()
+	p := &shardProgress{started: time.Now().UTC()}
+	w.active[ref] = p
+	return p
+}
+
+func (w *Worker) finishShard(ref ShardRef) {
+	w.activeMu.Lock()
+	defer w.activeMu.Unlock()
+	delete(w.active, ref)
+}
+
+// Activity returns a snapshot of the shards the worker is currently
+// processing, ordered by job and shard ID.
+func (w *Worker) Activity() []cluster.ShardActivity {
+	w.activeMu.Lock()
+	activity := make([]cluster.ShardActivity, 0, len(w.active))
+	for ref, p := range w.active {
+		activity = append(activity, cluster.ShardActivity{
+			JobID:     ref.JobID,
+			ShardID:   ref.ShardID,
+			IndexFrom: p.indexFrom.Load(),
+			IndexTo:   p.indexTo.Load(),
+			Processed: p.processed.Load(),
+			StartedAt: p.started,
+		})
+	}
+	w.activeMu.Unlock()
+
+	sort.Slice(activity, func(i, j int) bool {
+		if activity[i].JobID != activity[j].JobID {
+			return activity[i].JobID < activity[j].JobID
+		}
+		return activity[i].ShardID < activity[j].ShardID
+	})
+	return activity
+}
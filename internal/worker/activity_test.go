@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"context"
+	"testing"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+func TestActivity_TracksShardProgress(t *testing.T) {
+	w := NewWorker(nil, "w1", nil)
+	if got := w.Activity(); len(got) != 0 {
+		t.Fatalf("expected no activity on an idle worker, got %+v", got)
+	}
+
+	ref := ShardRef{JobID: "job1", ShardID: 2}
+	p := w.startShard(ref)
+	p.setRange(10, 20)
+
+	in := make(chan *ct.RawLogEntry)
+	out := make(chan *ct.RawLogEntry, 8)
+	go p.count(context.Background(), in, out)
+	for i := 0; i < 3; i++ {
+		in <- &ct.RawLogEntry{Index: int64(10 + i)}
+	}
+	close(in)
+	n := 0
+	for range out {
+		n++
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 entries forwarded, got %d", n)
+	}
+
+	got := w.Activity()
+	if len(got) != 1 {
+		t.Fatalf("expected one active shard, got %+v", got)
+	}
+	a := got[0]
+	if a.JobID != "job1" || a.ShardID != 2 || a.IndexFrom != 10 || a.IndexTo != 20 || a.Processed != 3 || a.StartedAt.IsZero() {
+		t.Errorf("unexpected activity: %+v", a)
+	}
+
+	w.finishShard(ref)
+	if got := w.Activity(); len(got) != 0 {
+		t.Errorf("expected no activity after finishing the shard, got %+v", got)
+	}
+}
@@ -0,0 +1,151 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/chtzvt/certslurp/internal/job"
+)
+
+const (
+	// adaptiveWindow is how many of the latest requests the error rate is
+	// taken over, and how long a run of successes must be before
+	// concurrency is raised.
+	adaptiveWindow = 20
+	// adaptiveMinSamples is how many requests must complete after a change
+	// before concurrency is lowered again, so a burst of failures from
+	// requests already in flight only counts once.
+	adaptiveMinSamples = 5
+	// adaptiveMaxErrorRate is the error rate above which concurrency is
+	// halved.
+	adaptiveMaxErrorRate = 0.1
+)
+
+// adaptiveLimiter bounds how many CT log requests a shard has in flight,
+// halving the bound when too many recent requests failed and raising it by
+// one after a run of successes, within [min, max].
+type adaptiveLimiter struct {
+	mu       sync.Mutex
+	min, max int
+	limit    int
+	inFlight int
+	recent   []bool // outcomes since the last decrease, newest last
+	streak   int    // successes in a row since the last change
+	wake     chan struct{}
+	logf     func(format string, args ...interface{})
+}
+
+func newAdaptiveLimiter(start, lo, hi int, logf func(format string, args ...interface{})) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		min:   lo,
+		max:   hi,
+		limit: clamp(start, lo, hi),
+		wake:  make(chan struct{}),
+		logf:  logf,
+	}
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+// acquire waits for a free request slot.
+func (l *adaptiveLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees a request slot and records whether the request succeeded.
+func (l *adaptiveLimiter) release(ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.record(ok)
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+func (l *adaptiveLimiter) record(ok bool) {
+	l.recent = append(l.recent, ok)
+	if len(l.recent) > adaptiveWindow {
+		l.recent = l.recent[1:]
+	}
+	if ok {
+		l.streak++
+		if l.streak >= adaptiveWindow && l.limit < l.max {
+			l.logf("adaptive fetch: %d successful requests in a row, raising concurrency %d -> %d", l.streak, l.limit, l.limit+1)
+			l.limit++
+			l.streak = 0
+		}
+		return
+	}
+
+	l.streak = 0
+	if len(l.recent) < adaptiveMinSamples || l.limit <= l.min {
+		return
+	}
+	failed := 0
+	for _, ok := range l.recent {
+		if !ok {
+			failed++
+		}
+	}
+	if rate := float64(failed) / float64(len(l.recent)); rate > adaptiveMaxErrorRate {
+		next := max(l.min, l.limit/2)
+		l.logf("adaptive fetch: %.0f%% of recent requests failed, lowering concurrency %d -> %d", rate*100, l.limit, next)
+		l.limit = next
+		l.recent = l.recent[:0]
+	}
+}
+
+// current returns the concurrency the limiter allows.
+func (l *adaptiveLimiter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// adaptiveFetchTransport holds requests to the limit an adaptiveLimiter
+// sets, and reports their outcomes back to it. Transport errors, 429s and
+// server errors count as failures.
+type adaptiveFetchTransport struct {
+	base    http.RoundTripper
+	limiter *adaptiveLimiter
+}
+
+// adaptiveFetchTransport wraps base to adapt concurrency per the job's fetch
+// config. It returns base unchanged, and the fetch parallelism to run the
+// scanner with, unless the job opts in.
+func (w *Worker) adaptiveFetchTransport(base http.RoundTripper, cfg job.FetchConfig) (http.RoundTripper, int) {
+	if cfg.FetchWorkersMax <= 0 {
+		return base, cfg.FetchWorkers
+	}
+	lo := max(cfg.FetchWorkersMin, 1)
+	limiter := newAdaptiveLimiter(cfg.FetchWorkers, lo, max(cfg.FetchWorkersMax, lo), w.Logger.Printf)
+	// The scanner runs a fetcher per possible slot; the limiter decides how
+	// many of them get to make requests
+	return &adaptiveFetchTransport{base: base, limiter: limiter}, limiter.max
+}
+
+func (t *adaptiveFetchTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.acquire(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	t.limiter.release(err == nil && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500)
+	return resp, err
+}
@@ -0,0 +1,116 @@
+package worker
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/job"
+)
+
+func TestAdaptiveFetchTransport_BacksOffAndRecovers(t *testing.T) {
+	var failing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"entries":[]}`))
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	w := &Worker{Logger: log.New(&logs, "", 0)}
+	rt, parallel := w.adaptiveFetchTransport(http.DefaultTransport, job.FetchConfig{FetchWorkers: 8, FetchWorkersMin: 2, FetchWorkersMax: 8})
+	if parallel != 8 {
+		t.Fatalf("scanner parallelism = %d, want the max of 8", parallel)
+	}
+	limiter := rt.(*adaptiveFetchTransport).limiter
+	client := &http.Client{Transport: rt}
+	fetch := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			resp, err := client.Get(srv.URL + "/ct/v1/get-entries?start=0&end=9")
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			resp.Body.Close()
+		}
+	}
+
+	fetch(adaptiveWindow)
+	if got := limiter.current(); got != 8 {
+		t.Fatalf("concurrency = %d while healthy, want 8", got)
+	}
+
+	// Errors halve concurrency down to the minimum, but no further
+	failing.Store(true)
+	fetch(adaptiveMinSamples)
+	if got := limiter.current(); got != 4 {
+		t.Fatalf("concurrency = %d after errors, want 4", got)
+	}
+	fetch(3 * adaptiveMinSamples)
+	if got := limiter.current(); got != 2 {
+		t.Fatalf("concurrency = %d after sustained errors, want the min of 2", got)
+	}
+
+	// Once errors stop it climbs back, one step per run of successes
+	failing.Store(false)
+	fetch(adaptiveWindow)
+	if got := limiter.current(); got != 3 {
+		t.Fatalf("concurrency = %d after a run of successes, want 3", got)
+	}
+	fetch(10 * adaptiveWindow)
+	if got := limiter.current(); got != 8 {
+		t.Fatalf("concurrency = %d after recovering, want the max of 8", got)
+	}
+	if !bytes.Contains(logs.Bytes(), []byte("lowering concurrency 8 -> 4")) {
+		t.Errorf("expected the change to be logged, got %q", logs.String())
+	}
+}
+
+func TestAdaptiveFetchTransport_LimitsInFlight(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"entries":[]}`))
+	}))
+	defer srv.Close()
+
+	w := &Worker{Logger: log.New(&bytes.Buffer{}, "", 0)}
+	rt, _ := w.adaptiveFetchTransport(http.DefaultTransport, job.FetchConfig{FetchWorkers: 2, FetchWorkersMax: 8})
+	client := &http.Client{Transport: rt}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	if p := peak.Load(); p > 2 {
+		t.Errorf("%d requests were in flight at once, want at most 2", p)
+	}
+
+	// Without a max the job's fetch parallelism is used as is
+	if base, parallel := w.adaptiveFetchTransport(http.DefaultTransport, job.FetchConfig{FetchWorkers: 3}); base != http.DefaultTransport || parallel != 3 {
+		t.Errorf("got %T with parallelism %d, want the base transport and 3", base, parallel)
+	}
+}
@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/etl"
+)
+
+// checkpointer works out how far through a shard its output is durable. The
+// scanner reports how far it has dealt with every entry, along with the
+// number of entries it had sent by then; once the pipeline has closed a
+// chunk after reading that many, everything up to there is written and the
+// shard can resume after it.
+type checkpointer struct {
+	mu          sync.Mutex
+	base        cluster.ShardCheckpoint // carried over from earlier runs
+	listOutputs bool                    // record the chunks written, for the job manifest
+	pending     []scannedPrefix         // not yet known to be durable
+	latest      cluster.ShardCheckpoint
+	hasLatest   bool
+}
+
+type scannedPrefix struct {
+	end  int64 // exclusive
+	sent int64 // entries sent by then, counting from the start of this run
+}
+
+func newCheckpointer(base cluster.ShardCheckpoint, listOutputs bool) *checkpointer {
+	return &checkpointer{base: base, listOutputs: listOutputs}
+}
+
+// scanned records that every entry before end has been dealt with, and sent
+// of them sent on to the pipeline.
+func (c *checkpointer) scanned(end, sent int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Only the furthest point reached by each count matters
+	if n := len(c.pending); n > 0 && c.pending[n-1].sent == sent {
+		c.pending[n-1].end = end
+		return
+	}
+	c.pending = append(c.pending, scannedPrefix{end: end, sent: sent})
+}
+
+// chunkClosed is called by the pipeline after closing a chunk, with the
+// entries it has read and its stats so far this run.
+func (c *checkpointer) chunkClosed(read int64, stats etl.Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for n < len(c.pending) && c.pending[n].sent <= read {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	c.latest = cluster.ShardCheckpoint{
+		LastIndex:  c.pending[n-1].end - 1,
+		Chunks:     c.base.Chunks + stats.Chunks,
+		Records:    c.base.Records + stats.Records,
+		Bytes:      c.base.Bytes + stats.Bytes,
+		Generation: c.base.Generation,
+	}
+	if c.listOutputs {
+		c.latest.Outputs = append(slices.Clip(c.base.Outputs), outputChunks(stats.Outputs)...)
+	}
+	c.hasLatest = true
+	c.pending = c.pending[n:]
+}
+
+// current returns the latest checkpoint, or false if this run hasn't made
+// one yet.
+func (c *checkpointer) current() (cluster.ShardCheckpoint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.latest, c.hasLatest
+}
+
+// outputChunks converts the pipeline's record of the chunks it wrote for a
+// shard manifest.
+func outputChunks(chunks []etl.ChunkInfo) []cluster.OutputChunk {
+	out := make([]cluster.OutputChunk, len(chunks))
+	for i, c := range chunks {
+		out[i] = cluster.OutputChunk{Name: c.Name, Bytes: c.Bytes, SHA256: c.SHA256}
+	}
+	return out
+}
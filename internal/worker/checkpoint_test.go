@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/etl"
+)
+
+func TestCheckpointer_WaitsForDurableProgress(t *testing.T) {
+	earlier := []cluster.OutputChunk{{Name: "out.0001"}, {Name: "out.0002"}, {Name: "out.0003"}}
+	c := newCheckpointer(cluster.ShardCheckpoint{LastIndex: 99, Chunks: 3, Records: 30, Bytes: 300, Generation: 1, Outputs: earlier}, true)
+	if _, ok := c.current(); ok {
+		t.Fatal("expected no checkpoint before anything is scanned")
+	}
+
+	c.scanned(150, 10)
+	c.scanned(200, 10) // no more entries sent, so this supersedes 150
+	c.scanned(300, 25)
+
+	// A chunk closed before reading everything sent by 200 proves nothing
+	c.chunkClosed(8, etl.Stats{Chunks: 1, Records: 8, Bytes: 80})
+	if _, ok := c.current(); ok {
+		t.Fatal("checkpoint taken before the entries up to 200 were written")
+	}
+
+	written := []etl.ChunkInfo{{Name: "out.0004", Bytes: 80, SHA256: "aa"}, {Name: "out.0005", Bytes: 80, SHA256: "bb"}}
+	c.chunkClosed(16, etl.Stats{Chunks: 2, Records: 16, Bytes: 160, Outputs: written})
+	cp, ok := c.current()
+	if !ok {
+		t.Fatal("expected a checkpoint once the entries up to 200 were written")
+	}
+	want := cluster.ShardCheckpoint{LastIndex: 199, Chunks: 5, Records: 46, Bytes: 460, Generation: 1, Outputs: []cluster.OutputChunk{
+		{Name: "out.0001"}, {Name: "out.0002"}, {Name: "out.0003"},
+		{Name: "out.0004", Bytes: 80, SHA256: "aa"}, {Name: "out.0005", Bytes: 80, SHA256: "bb"},
+	}}
+	if !reflect.DeepEqual(cp, want) {
+		t.Fatalf("got checkpoint %+v, want %+v", cp, want)
+	}
+
+	c.chunkClosed(25, etl.Stats{Chunks: 3, Records: 25, Bytes: 250, Outputs: append(written, etl.ChunkInfo{Name: "out.0006"})})
+	if cp, _ := c.current(); cp.LastIndex != 299 || cp.Chunks != 6 || cp.Records != 55 || len(cp.Outputs) != 6 {
+		t.Fatalf("got checkpoint %+v after the entries up to 300", cp)
+	}
+
+	// Chunks are only listed when the job wants a manifest
+	c = newCheckpointer(cluster.ShardCheckpoint{}, false)
+	c.scanned(10, 1)
+	c.chunkClosed(1, etl.Stats{Chunks: 1, Records: 1, Outputs: written})
+	if cp, _ := c.current(); cp.Outputs != nil {
+		t.Fatalf("got outputs %+v without a manifest", cp.Outputs)
+	}
+}
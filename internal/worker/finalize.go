@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+
+	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/etl"
+)
+
+// FinalizeJob writes the manifest of a finished job to its sink, if the job
+// asks for one. The head runs it before marking the job completed, so a
+// failed write is retried on its next pass; a manifest already written by
+// an earlier pass is left alone.
+func FinalizeJob(ctx context.Context, cl cluster.Cluster, jobID string) error {
+	info, err := cl.GetJob(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	if info.Spec == nil || !info.Spec.Options.Output.Manifest {
+		return nil
+	}
+	manifest, err := cl.GetJobManifest(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	err = etl.WriteJobManifest(ctx, info.Spec, cl.Secrets(), jobID, manifest)
+	if errors.Is(err, fs.ErrExist) {
+		return nil
+	}
+	return err
+}
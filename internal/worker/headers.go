@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/chtzvt/certslurp/internal/job"
+)
+
+// fetchHeaders resolves the job's configured CT log request headers, looking up
+// any "secret:<name>" values in the cluster secret store.
+func (w *Worker) fetchHeaders(ctx context.Context, cfg job.FetchConfig) (http.Header, error) {
+	if len(cfg.Headers) == 0 {
+		return nil, nil
+	}
+	headers := make(http.Header, len(cfg.Headers))
+	for name, value := range cfg.Headers {
+		if ref, ok := strings.CutPrefix(value, job.SecretRefPrefix); ok {
+			store := w.Cluster.Secrets()
+			if store == nil {
+				return nil, fmt.Errorf("fetch header %q: secret store not available", name)
+			}
+			secret, err := store.Get(ctx, ref)
+			if err != nil {
+				return nil, fmt.Errorf("fetch header %q: secret %q: %w", name, ref, err)
+			}
+			value = strings.TrimSpace(string(secret))
+		}
+		headers.Set(name, value)
+	}
+	return headers, nil
+}
+
+// headerTransport adds a fixed set of headers to every request.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLogBufferLines is the number of recent log lines kept when no
+	// explicit size is configured.
+	DefaultLogBufferLines = 500
+	// MaxLogBufferLines caps the ring buffer regardless of configuration.
+	MaxLogBufferLines = 10_000
+)
+
+// LogLine is a single captured log line.
+type LogLine struct {
+	Time time.Time `json:"time"`
+	Line string    `json:"line"`
+}
+
+// LogBuffer is a bounded ring buffer of recent log lines. It implements
+// io.Writer so it can be attached to a *log.Logger alongside the usual output.
+type LogBuffer struct {
+	mu      sync.Mutex
+	lines   []LogLine
+	next    int
+	full    bool
+	partial []byte
+	now     func() time.Time
+}
+
+// NewLogBuffer returns a buffer holding up to size lines. Sizes outside
+// (0, MaxLogBufferLines] fall back to the default or the cap respectively.
+func NewLogBuffer(size int) *LogBuffer {
+	if size <= 0 {
+		size = DefaultLogBufferLines
+	}
+	if size > MaxLogBufferLines {
+		size = MaxLogBufferLines
+	}
+	return &LogBuffer{lines: make([]LogLine, size), now: time.Now}
+}
+
+// Write records each complete line in p. A trailing fragment without a newline
+// is held until the rest of the line arrives.
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data := p
+	if len(b.partial) > 0 {
+		data = append(b.partial, p...)
+		b.partial = nil
+	}
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		b.add(string(data[:i]))
+		data = data[i+1:]
+	}
+	if len(data) > 0 {
+		b.partial = append([]byte(nil), data...)
+	}
+	return len(p), nil
+}
+
+func (b *LogBuffer) add(line string) {
+	b.lines[b.next] = LogLine{Time: b.now().UTC(), Line: line}
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Lines returns up to n of the most recent lines, oldest first. n <= 0 returns
+// everything buffered.
+func (b *LogBuffer) Lines(n int) []LogLine {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := b.next
+	if b.full {
+		count = len(b.lines)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+	out := make([]LogLine, 0, n)
+	start := (b.next - n + len(b.lines)) % len(b.lines)
+	for i := 0; i < n; i++ {
+		out = append(out, b.lines[(start+i)%len(b.lines)])
+	}
+	return out
+}
+
+// Handler serves the buffered lines as JSON. The optional "n" query parameter
+// limits the response to the most recent n lines.
+func (b *LogBuffer) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		n := 0
+		if s := r.URL.Query().Get("n"); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v < 0 {
+				http.Error(w, "invalid n", http.StatusBadRequest)
+				return
+			}
+			n = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(b.Lines(n))
+	})
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLogBuffer_EndpointServesRecentLines(t *testing.T) {
+	buf := NewLogBuffer(3)
+	logger := log.New(buf, "[worker] ", 0)
+	for i := 1; i <= 5; i++ {
+		logger.Printf("shard %d done", i)
+	}
+
+	srv := httptest.NewServer(buf.Handler())
+	defer srv.Close()
+
+	fetch := func(query string) []LogLine {
+		t.Helper()
+		resp, err := http.Get(srv.URL + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d", resp.StatusCode)
+		}
+		var lines []LogLine
+		if err := json.NewDecoder(resp.Body).Decode(&lines); err != nil {
+			t.Fatal(err)
+		}
+		return lines
+	}
+
+	// Only the newest three survive, oldest first.
+	lines := fetch("")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 buffered lines, got %d: %+v", len(lines), lines)
+	}
+	for i, l := range lines {
+		want := fmt.Sprintf("[worker] shard %d done", i+3)
+		if l.Line != want {
+			t.Errorf("line %d: got %q, want %q", i, l.Line, want)
+		}
+		if l.Time.IsZero() {
+			t.Errorf("line %d has no timestamp", i)
+		}
+	}
+
+	lines = fetch("?n=1")
+	if len(lines) != 1 || lines[0].Line != "[worker] shard 5 done" {
+		t.Errorf("expected only the newest line, got %+v", lines)
+	}
+
+	resp, err := http.Get(srv.URL + "?n=bogus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid n, got %d", resp.StatusCode)
+	}
+}
+
+func TestLogBuffer_JoinsPartialWrites(t *testing.T) {
+	buf := NewLogBuffer(0)
+	_, _ = buf.Write([]byte("hello "))
+	if got := buf.Lines(0); len(got) != 0 {
+		t.Fatalf("partial line should not be buffered yet: %+v", got)
+	}
+	_, _ = buf.Write([]byte("world\nnext"))
+	got := buf.Lines(0)
+	if len(got) != 1 || got[0].Line != "hello world" {
+		t.Fatalf("unexpected lines: %+v", got)
+	}
+	if len(buf.lines) != DefaultLogBufferLines {
+		t.Errorf("expected default capacity %d, got %d", DefaultLogBufferLines, len(buf.lines))
+	}
+}
@@ -2,9 +2,14 @@ package worker
 
 import (
 	"context"
-
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"math/big"
 	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/job"
 	ct "github.com/google/certificate-transparency-go"
@@ -26,49 +31,393 @@ func (s SkipPrecerts) PrecertificateMatches(_ *ct.Precertificate) bool {
 	return false
 }
 
-// MatchDomainRegex matches DNS names in cert's SANs using a regex
+// MatchDomainRegex matches DNS names in cert's SANs (or its CN, if it has
+// none) using regexes. A cert matches when any of its names matches any
+// Include regex, and none of its names match any Exclude regex.
 type MatchDomainRegex struct {
-	Include *regexp.Regexp // Can be nil (means include all)
-	Exclude *regexp.Regexp // Can be nil (means exclude none)
+	Include []*regexp.Regexp // Can be empty (means include all)
+	Exclude []*regexp.Regexp // Can be empty (means exclude none)
+}
+
+// newMatchDomainRegex compiles a MatchDomainRegex from validated patterns.
+func newMatchDomainRegex(includes, excludes []string) MatchDomainRegex {
+	var m MatchDomainRegex
+	for _, p := range includes {
+		m.Include = append(m.Include, regexp.MustCompile(p))
+	}
+	for _, p := range excludes {
+		m.Exclude = append(m.Exclude, regexp.MustCompile(p))
+	}
+	return m
 }
 
 func (m MatchDomainRegex) CertificateMatches(cert *x509.Certificate) bool {
-	names := cert.DNSNames
+	return m.namesMatch(cert.DNSNames, cert.Subject.CommonName)
+}
+
+func (m MatchDomainRegex) PrecertificateMatches(p *ct.Precertificate) bool {
+	return m.namesMatch(p.TBSCertificate.DNSNames, p.TBSCertificate.Subject.CommonName)
+}
+
+func (m MatchDomainRegex) namesMatch(names []string, commonName string) bool {
 	if len(names) == 0 {
-		names = []string{cert.Subject.CommonName}
+		names = []string{commonName}
 	}
 	matched := false
 	for _, dns := range names {
-		if m.Exclude != nil && m.Exclude.MatchString(dns) {
-			return false // If any name matches the exclusion, exclude the cert
+		if anyRegexMatches(m.Exclude, dns) {
+			return false // If any name matches an exclusion, exclude the cert
 		}
-		if m.Include == nil || m.Include.MatchString(dns) {
-			matched = true // At least one name matches include (or include is nil)
+		if len(m.Include) == 0 || anyRegexMatches(m.Include, dns) {
+			matched = true // At least one name matches an include (or there are none)
 		}
 	}
 	return matched
 }
 
-func (m MatchDomainRegex) PrecertificateMatches(p *ct.Precertificate) bool {
-	names := p.TBSCertificate.DNSNames
-	if len(names) == 0 {
-		names = []string{p.TBSCertificate.Subject.CommonName}
+func anyRegexMatches(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
 	}
-	matched := false
-	for _, dns := range names {
-		if m.Exclude != nil && m.Exclude.MatchString(dns) {
-			return false // If any name matches the exclusion, exclude the cert
+	return false
+}
+
+// MatchAnd matches entries that every inner matcher matches.
+type MatchAnd []scanner.Matcher
+
+func (m MatchAnd) CertificateMatches(cert *x509.Certificate) bool {
+	for _, inner := range m {
+		if !inner.CertificateMatches(cert) {
+			return false
 		}
-		if m.Include == nil || m.Include.MatchString(dns) {
-			matched = true // At least one name matches include (or include is nil)
+	}
+	return true
+}
+
+func (m MatchAnd) PrecertificateMatches(p *ct.Precertificate) bool {
+	for _, inner := range m {
+		if !inner.PrecertificateMatches(p) {
+			return false
 		}
 	}
-	return matched
+	return true
+}
+
+// MatchOr matches entries that at least one inner matcher matches.
+type MatchOr []scanner.Matcher
+
+func (m MatchOr) CertificateMatches(cert *x509.Certificate) bool {
+	for _, inner := range m {
+		if inner.CertificateMatches(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m MatchOr) PrecertificateMatches(p *ct.Precertificate) bool {
+	for _, inner := range m {
+		if inner.PrecertificateMatches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchExpired matches certificates whose validity ended before Now.
+type MatchExpired struct {
+	Now func() time.Time // nil means time.Now
+}
+
+func (m MatchExpired) now() time.Time {
+	if m.Now == nil {
+		return time.Now()
+	}
+	return m.Now()
+}
+
+func (m MatchExpired) CertificateMatches(cert *x509.Certificate) bool {
+	return cert.NotAfter.Before(m.now())
+}
+
+func (m MatchExpired) PrecertificateMatches(p *ct.Precertificate) bool {
+	return p.TBSCertificate.NotAfter.Before(m.now())
+}
+
+// MatchValidityRange matches certificates whose NotBefore falls in
+// [NotBeforeAfter, NotBeforeBefore) and whose NotAfter falls in
+// [NotAfterAfter, NotAfterBefore). Zero bounds are open. Certificates in the
+// window must also match Inner.
+type MatchValidityRange struct {
+	NotBeforeAfter, NotBeforeBefore time.Time
+	NotAfterAfter, NotAfterBefore   time.Time
+	Inner                           scanner.Matcher
+}
+
+func (m MatchValidityRange) inRange(notBefore, notAfter time.Time) bool {
+	return inWindow(notBefore, m.NotBeforeAfter, m.NotBeforeBefore) &&
+		inWindow(notAfter, m.NotAfterAfter, m.NotAfterBefore)
+}
+
+// inWindow reports whether t is in [from, to), treating zero bounds as open.
+func inWindow(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+func (m MatchValidityRange) CertificateMatches(cert *x509.Certificate) bool {
+	return m.inRange(cert.NotBefore, cert.NotAfter) && m.Inner.CertificateMatches(cert)
+}
+
+func (m MatchValidityRange) PrecertificateMatches(p *ct.Precertificate) bool {
+	tbs := p.TBSCertificate
+	return tbs != nil && m.inRange(tbs.NotBefore, tbs.NotAfter) && m.Inner.PrecertificateMatches(p)
+}
+
+// MatchCurrentlyValid leaves out certificates that expired before, or (with
+// ExcludeNotYetValid) only become valid after, the reference time: At if set,
+// otherwise Now when the certificate is matched. The rest must also match
+// Inner.
+type MatchCurrentlyValid struct {
+	ExcludeExpired     bool
+	ExcludeNotYetValid bool
+	At                 time.Time
+	Now                func() time.Time // nil means time.Now
+	Inner              scanner.Matcher
+}
+
+func (m MatchCurrentlyValid) validAt(notBefore, notAfter time.Time) bool {
+	ref := m.At
+	if ref.IsZero() {
+		ref = MatchExpired{Now: m.Now}.now()
+	}
+	if m.ExcludeExpired && notAfter.Before(ref) {
+		return false
+	}
+	return !m.ExcludeNotYetValid || !notBefore.After(ref)
+}
+
+func (m MatchCurrentlyValid) CertificateMatches(cert *x509.Certificate) bool {
+	return m.validAt(cert.NotBefore, cert.NotAfter) && m.Inner.CertificateMatches(cert)
+}
+
+func (m MatchCurrentlyValid) PrecertificateMatches(p *ct.Precertificate) bool {
+	tbs := p.TBSCertificate
+	return tbs != nil && m.validAt(tbs.NotBefore, tbs.NotAfter) && m.Inner.PrecertificateMatches(p)
+}
+
+// MatchWildcardSAN matches certificates with a wildcard DNS name, like
+// "*.example.com", that also match Inner.
+type MatchWildcardSAN struct {
+	Inner scanner.Matcher
+}
+
+func hasWildcardName(cert *x509.Certificate) bool {
+	return slices.ContainsFunc(cert.DNSNames, func(name string) bool {
+		return strings.HasPrefix(name, "*.")
+	})
+}
+
+func (m MatchWildcardSAN) CertificateMatches(cert *x509.Certificate) bool {
+	return hasWildcardName(cert) && m.Inner.CertificateMatches(cert)
+}
+
+func (m MatchWildcardSAN) PrecertificateMatches(p *ct.Precertificate) bool {
+	return p.TBSCertificate != nil && hasWildcardName(p.TBSCertificate) && m.Inner.PrecertificateMatches(p)
+}
+
+// MatchIPSAN matches certificates with at least one IP address SAN that also
+// match Inner.
+type MatchIPSAN struct {
+	Inner scanner.Matcher
+}
+
+func (m MatchIPSAN) CertificateMatches(cert *x509.Certificate) bool {
+	return len(cert.IPAddresses) > 0 && m.Inner.CertificateMatches(cert)
+}
+
+func (m MatchIPSAN) PrecertificateMatches(p *ct.Precertificate) bool {
+	return p.TBSCertificate != nil && len(p.TBSCertificate.IPAddresses) > 0 && m.Inner.PrecertificateMatches(p)
+}
+
+// MatchKeyConstraints matches certificates whose public key is of Algorithm
+// (any, if empty) and whose size in bits is in [MinBits, MaxBits], where zero
+// bounds are open. Keys with no size, like Ed25519, or of a type that isn't
+// recognized, don't match when either bound is set. Matching certificates
+// must also match Inner.
+type MatchKeyConstraints struct {
+	MinBits, MaxBits int
+	Algorithm        string
+	Inner            scanner.Matcher
+}
+
+func (m MatchKeyConstraints) keyMatches(cert *x509.Certificate) bool {
+	if m.Algorithm != "" && !strings.EqualFold(cert.PublicKeyAlgorithm.String(), m.Algorithm) {
+		return false
+	}
+	if m.MinBits == 0 && m.MaxBits == 0 {
+		return true
+	}
+	bits := publicKeyBits(cert.PublicKey)
+	return bits > 0 && bits >= m.MinBits && (m.MaxBits == 0 || bits <= m.MaxBits)
+}
+
+// publicKeyBits returns the size of an RSA or DSA modulus or an ECDSA curve,
+// or 0 for keys without one.
+func publicKeyBits(pub interface{}) int {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if pub.N != nil {
+			return pub.N.BitLen()
+		}
+	case *ecdsa.PublicKey:
+		if pub.Curve != nil {
+			return pub.Curve.Params().BitSize
+		}
+	case *dsa.PublicKey:
+		if pub.P != nil {
+			return pub.P.BitLen()
+		}
+	}
+	return 0
+}
+
+func (m MatchKeyConstraints) CertificateMatches(cert *x509.Certificate) bool {
+	return m.keyMatches(cert) && m.Inner.CertificateMatches(cert)
+}
+
+func (m MatchKeyConstraints) PrecertificateMatches(p *ct.Precertificate) bool {
+	return p.TBSCertificate != nil && m.keyMatches(p.TBSCertificate) && m.Inner.PrecertificateMatches(p)
+}
+
+// MatchLogTimestamp is a scanner.LeafMatcher that matches entries whose CT
+// log timestamp (the MerkleTreeLeaf timestamp, in milliseconds) falls in
+// [From, To). Zero bounds are open. Entries in the window must also match
+// Inner, which may be a scanner.Matcher, a scanner.LeafMatcher, or nil to
+// match everything.
+type MatchLogTimestamp struct {
+	From, To uint64
+	Inner    interface{}
+}
+
+func (m MatchLogTimestamp) Matches(leaf *ct.LeafEntry) bool {
+	raw, err := ct.RawLogEntryFromLeaf(0, leaf)
+	if err != nil {
+		return false
+	}
+	ts := raw.Leaf.TimestampedEntry.Timestamp
+	if ts < m.From || (m.To != 0 && ts >= m.To) {
+		return false
+	}
+
+	switch inner := m.Inner.(type) {
+	case nil:
+		return true
+	case scanner.LeafMatcher:
+		return inner.Matches(leaf)
+	case scanner.Matcher:
+		// Inner needs the parsed [pre-]certificate; non-fatal parse errors
+		// are tolerated as the scanner does
+		entry, _ := raw.ToLogEntry()
+		switch {
+		case entry == nil:
+			return false
+		case entry.X509Cert != nil:
+			return inner.CertificateMatches(entry.X509Cert)
+		case entry.Precert != nil:
+			return inner.PrecertificateMatches(entry.Precert)
+		}
+	}
+	return false
+}
+
+// buildExprMatcher composes a matcher for a match expression tree. Conditions
+// set on a node, its All children and (as a group) its Any children are ANDed.
+func buildExprMatcher(e job.MatchExpr) scanner.Matcher {
+	var ms []scanner.Matcher
+
+	if e.DomainInclude != "" || e.DomainExclude != "" {
+		ms = append(ms, newMatchDomainRegex(nonEmpty(e.DomainInclude), nonEmpty(e.DomainExclude)))
+	}
+	if e.SubjectRegex != "" {
+		r := regexp.MustCompile(e.SubjectRegex)
+		ms = append(ms, &scanner.MatchSubjectRegex{
+			CertificateSubjectRegex:    r,
+			PrecertificateSubjectRegex: r,
+		})
+	}
+	if e.IssuerRegex != "" {
+		r := regexp.MustCompile(e.IssuerRegex)
+		ms = append(ms, &scanner.MatchIssuerRegex{
+			CertificateIssuerRegex:    r,
+			PrecertificateIssuerRegex: r,
+		})
+	}
+	if e.Serial != "" {
+		var sn big.Int
+		if _, ok := sn.SetString(e.Serial, 10); ok {
+			ms = append(ms, &scanner.MatchSerialNumber{SerialNumber: sn})
+		} else {
+			ms = append(ms, &scanner.MatchNone{})
+		}
+	}
+	if e.Expired {
+		ms = append(ms, MatchExpired{})
+	}
+	for _, sub := range e.All {
+		ms = append(ms, buildExprMatcher(sub))
+	}
+	if len(e.Any) > 0 {
+		or := make(MatchOr, 0, len(e.Any))
+		for _, sub := range e.Any {
+			or = append(or, buildExprMatcher(sub))
+		}
+		ms = append(ms, or)
+	}
+
+	switch len(ms) {
+	case 0:
+		return scanner.MatchAll{}
+	case 1:
+		return ms[0]
+	}
+	return MatchAnd(ms)
 }
 
 // buildMatcher creates a Matcher (or LeafMatcher) and optional initialization.
 // Returns (matcher, initFunc). initFunc may be nil unless matcher requires it.
+// A log timestamp window, if configured, narrows whatever the other options
+// select.
 func buildMatcher(cfg job.MatchConfig) (matcher interface{}, initFunc func(context.Context, *client.LogClient) error) {
+	matcher, initFunc = buildCriteriaMatcher(cfg)
+	if !cfg.LogTimestampFrom.IsZero() || !cfg.LogTimestampTo.IsZero() {
+		matcher = MatchLogTimestamp{
+			From:  logTimestamp(cfg.LogTimestampFrom),
+			To:    logTimestamp(cfg.LogTimestampTo),
+			Inner: matcher,
+		}
+	}
+	return matcher, initFunc
+}
+
+// logTimestamp converts t to a CT timestamp, or 0 for the zero time.
+func logTimestamp(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixMilli())
+}
+
+// nonEmpty returns s as a one-element list, or nil if it's empty.
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+func buildCriteriaMatcher(cfg job.MatchConfig) (matcher interface{}, initFunc func(context.Context, *client.LogClient) error) {
 
 	if cfg.ValidationErrors == true {
 		vm := &scanner.CertVerifyFailMatcher{}
@@ -82,21 +431,14 @@ func buildMatcher(cfg job.MatchConfig) (matcher interface{}, initFunc func(conte
 
 	var m scanner.Matcher
 
-	var useDomainMatcher bool
-	if cfg.DomainInclude != "" || cfg.DomainExclude != "" {
-		useDomainMatcher = true
-	}
+	domainIncludes, domainExcludes := cfg.DomainIncludePatterns(), cfg.DomainExcludePatterns()
+	useDomainMatcher := len(domainIncludes) > 0 || len(domainExcludes) > 0
 
 	switch {
+	case cfg.Expr != nil:
+		m = buildExprMatcher(*cfg.Expr)
 	case useDomainMatcher:
-		var inc, exc *regexp.Regexp
-		if cfg.DomainInclude != "" {
-			inc = regexp.MustCompile(cfg.DomainInclude)
-		}
-		if cfg.DomainExclude != "" {
-			exc = regexp.MustCompile(cfg.DomainExclude)
-		}
-		m = MatchDomainRegex{Include: inc, Exclude: exc}
+		m = newMatchDomainRegex(domainIncludes, domainExcludes)
 	case cfg.SubjectRegex != "":
 		r := regexp.MustCompile(cfg.SubjectRegex)
 		m = &scanner.MatchSubjectRegex{
@@ -125,6 +467,42 @@ func buildMatcher(cfg job.MatchConfig) (matcher interface{}, initFunc func(conte
 		m = scanner.MatchAll{}
 	}
 
+	if !cfg.NotBeforeAfter.IsZero() || !cfg.NotBeforeBefore.IsZero() ||
+		!cfg.NotAfterAfter.IsZero() || !cfg.NotAfterBefore.IsZero() {
+		m = MatchValidityRange{
+			NotBeforeAfter:  cfg.NotBeforeAfter,
+			NotBeforeBefore: cfg.NotBeforeBefore,
+			NotAfterAfter:   cfg.NotAfterAfter,
+			NotAfterBefore:  cfg.NotAfterBefore,
+			Inner:           m,
+		}
+	}
+
+	if cfg.MinKeyBits > 0 || cfg.MaxKeyBits > 0 || cfg.KeyAlgorithm != "" {
+		m = MatchKeyConstraints{
+			MinBits:   cfg.MinKeyBits,
+			MaxBits:   cfg.MaxKeyBits,
+			Algorithm: cfg.KeyAlgorithm,
+			Inner:     m,
+		}
+	}
+
+	if cfg.ExcludeExpired || cfg.ExcludeNotYetValid {
+		m = MatchCurrentlyValid{
+			ExcludeExpired:     cfg.ExcludeExpired,
+			ExcludeNotYetValid: cfg.ExcludeNotYetValid,
+			At:                 cfg.ValidAt,
+			Inner:              m,
+		}
+	}
+
+	if cfg.WildcardOnly {
+		m = MatchWildcardSAN{Inner: m}
+	}
+	if cfg.HasIPSAN {
+		m = MatchIPSAN{Inner: m}
+	}
+
 	if cfg.SkipPrecerts {
 		return SkipPrecerts{Inner: m}, initFunc
 	}
@@ -1,12 +1,21 @@
 package worker
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"math/big"
+	"net"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/testutil"
 	ct "github.com/google/certificate-transparency-go"
 	"github.com/google/certificate-transparency-go/scanner"
+	"github.com/google/certificate-transparency-go/tls"
 	x509 "github.com/google/certificate-transparency-go/x509"
 	"github.com/google/certificate-transparency-go/x509/pkix"
 )
@@ -111,13 +120,13 @@ func TestBuildMatcher_Domain(t *testing.T) {
 	if !ok {
 		t.Fatalf("Expected MatchDomainRegex, got %T", matcher)
 	}
-	if !m.Include.MatchString("foo.example.com") {
+	if len(m.Include) != 1 || !m.Include[0].MatchString("foo.example.com") {
 		t.Fatal("DomainRegex does not match foo.example.com")
 	}
 }
 
 func TestMatchDomainRegex_CertificateMatches(t *testing.T) {
-	m := MatchDomainRegex{Include: regexp.MustCompile(`\.example\.com$`)}
+	m := MatchDomainRegex{Include: []*regexp.Regexp{regexp.MustCompile(`\.example\.com$`)}}
 	cert := &x509.Certificate{
 		DNSNames: []string{"foo.example.com", "bar.notme.org"},
 		Subject:  pkix.Name{CommonName: "backup.example.com"},
@@ -146,7 +155,7 @@ func TestMatchDomainRegex_CertificateMatches(t *testing.T) {
 }
 
 func TestMatchDomainRegex_PrecertificateMatches(t *testing.T) {
-	m := MatchDomainRegex{Include: regexp.MustCompile(`\.example\.com$`)}
+	m := MatchDomainRegex{Include: []*regexp.Regexp{regexp.MustCompile(`\.example\.com$`)}}
 	pre := &ct.Precertificate{
 		TBSCertificate: &x509.Certificate{
 			DNSNames: []string{"foo.example.com", "other.org"},
@@ -180,8 +189,8 @@ func TestMatchDomainRegex_PrecertificateMatches(t *testing.T) {
 
 func TestMatchDomainRegex(t *testing.T) {
 	m := MatchDomainRegex{
-		Include: regexp.MustCompile(`\.example\.com$`),
-		Exclude: regexp.MustCompile(`^foo\.example\.com$`),
+		Include: []*regexp.Regexp{regexp.MustCompile(`\.example\.com$`)},
+		Exclude: []*regexp.Regexp{regexp.MustCompile(`^foo\.example\.com$`)},
 	}
 
 	// Should be excluded: contains a DNS name that matches Exclude, even though bar.example.com would match Include.
@@ -228,14 +237,14 @@ func TestBuildMatcher_DomainIncludeExclude(t *testing.T) {
 	if !ok {
 		t.Fatalf("Expected MatchDomainRegex, got %T", matcher)
 	}
-	if m.Include == nil || m.Exclude == nil {
+	if len(m.Include) != 1 || len(m.Exclude) != 1 {
 		t.Fatal("Expected both Include and Exclude regex to be set")
 	}
 }
 
 func TestMatchDomainRegex_ExcludeOnly(t *testing.T) {
 	m := MatchDomainRegex{
-		Exclude: regexp.MustCompile(`^bar\.example\.com$`),
+		Exclude: []*regexp.Regexp{regexp.MustCompile(`^bar\.example\.com$`)},
 	}
 
 	// Should NOT match: one SAN is excluded ("bar.example.com")
@@ -262,3 +271,441 @@ func TestMatchDomainRegex_ExcludeOnly(t *testing.T) {
 		t.Error("Expected CertificateMatches to match when no SANs are excluded")
 	}
 }
+
+func TestBuildMatcher_MultipleDomainPatterns(t *testing.T) {
+	cfg := job.MatchConfig{
+		DomainInclude:  `\.example\.com$`,
+		DomainIncludes: []string{`\.example\.org$`, `^mail\.`},
+		DomainExcludes: []string{`^internal\.`, `^staging\.`},
+	}
+	matcher, _ := buildMatcher(cfg)
+	m, ok := matcher.(MatchDomainRegex)
+	if !ok {
+		t.Fatalf("Expected MatchDomainRegex, got %T", matcher)
+	}
+	if len(m.Include) != 3 || len(m.Exclude) != 2 {
+		t.Fatalf("got %d include and %d exclude regexes, want 3 and 2", len(m.Include), len(m.Exclude))
+	}
+
+	for _, tc := range []struct {
+		name  string
+		names []string
+		want  bool
+	}{
+		{"first include", []string{"www.example.com"}, true},
+		{"second include", []string{"www.example.org"}, true},
+		{"third include", []string{"mail.other.net"}, true},
+		{"no include", []string{"www.other.net"}, false},
+		{"first exclude", []string{"internal.example.com"}, false},
+		{"second exclude", []string{"staging.example.org"}, false},
+		{"one SAN included, another excluded", []string{"www.example.com", "staging.other.net"}, false},
+		{"one SAN included, another unmatched", []string{"www.example.com", "www.other.net"}, true},
+	} {
+		cert := &x509.Certificate{DNSNames: tc.names}
+		if got := m.CertificateMatches(cert); got != tc.want {
+			t.Errorf("%s: CertificateMatches(%v) = %v, want %v", tc.name, tc.names, got, tc.want)
+		}
+		if got := m.PrecertificateMatches(&ct.Precertificate{TBSCertificate: cert}); got != tc.want {
+			t.Errorf("%s: PrecertificateMatches(%v) = %v, want %v", tc.name, tc.names, got, tc.want)
+		}
+	}
+
+	// Excludes alone keep everything else
+	matcher, _ = buildMatcher(job.MatchConfig{DomainExcludes: []string{`^internal\.`, `^staging\.`}})
+	if !matcher.(scanner.Matcher).CertificateMatches(&x509.Certificate{DNSNames: []string{"www.other.net"}}) {
+		t.Error("Expected a name matching no exclude to match")
+	}
+}
+
+func TestBuildMatcher_ExprAndOr(t *testing.T) {
+	// (issuer ~ Let's Encrypt AND domain ~ .gov) OR expired
+	cfg := job.MatchConfig{
+		SubjectRegex: "ignored when expr is set",
+		Expr: &job.MatchExpr{
+			Any: []job.MatchExpr{
+				{IssuerRegex: "Let's Encrypt", DomainInclude: `\.gov$`},
+				{Expired: true},
+			},
+		},
+	}
+	matcher, _ := buildMatcher(cfg)
+	m, ok := matcher.(scanner.Matcher)
+	if !ok {
+		t.Fatalf("Expected scanner.Matcher, got %T", matcher)
+	}
+
+	future := time.Now().Add(24 * time.Hour)
+	past := time.Now().Add(-24 * time.Hour)
+	cert := func(issuer, dns string, notAfter time.Time) *x509.Certificate {
+		return &x509.Certificate{
+			Issuer:   pkix.Name{CommonName: issuer},
+			DNSNames: []string{dns},
+			NotAfter: notAfter,
+		}
+	}
+
+	cases := []struct {
+		name string
+		cert *x509.Certificate
+		want bool
+	}{
+		{"issuer and domain", cert("Let's Encrypt R3", "www.example.gov", future), true},
+		{"issuer only", cert("Let's Encrypt R3", "www.example.com", future), false},
+		{"domain only", cert("Other CA", "www.example.gov", future), false},
+		{"expired", cert("Other CA", "www.example.com", past), true},
+	}
+	for _, tc := range cases {
+		if got := m.CertificateMatches(tc.cert); got != tc.want {
+			t.Errorf("%s: CertificateMatches = %v, want %v", tc.name, got, tc.want)
+		}
+		pre := &ct.Precertificate{TBSCertificate: tc.cert}
+		if got := m.PrecertificateMatches(pre); got != tc.want {
+			t.Errorf("%s: PrecertificateMatches = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBuildMatcher_ExprAllWithSkipPrecerts(t *testing.T) {
+	cfg := job.MatchConfig{
+		SkipPrecerts: true,
+		Expr: &job.MatchExpr{
+			All: []job.MatchExpr{
+				{SubjectRegex: "example"},
+				{DomainExclude: `^internal\.`},
+			},
+		},
+	}
+	matcher, _ := buildMatcher(cfg)
+	s, ok := matcher.(SkipPrecerts)
+	if !ok {
+		t.Fatalf("Expected SkipPrecerts, got %T", matcher)
+	}
+	if _, ok := s.Inner.(MatchAnd); !ok {
+		t.Fatalf("Expected inner to be MatchAnd, got %T", s.Inner)
+	}
+
+	if !s.CertificateMatches(&x509.Certificate{DNSNames: []string{"www.example.com"}}) {
+		t.Error("Expected www.example.com to match")
+	}
+	if s.CertificateMatches(&x509.Certificate{DNSNames: []string{"www.example.com", "internal.example.com"}}) {
+		t.Error("Did not expect a cert with an excluded name to match")
+	}
+	if s.CertificateMatches(&x509.Certificate{DNSNames: []string{"www.other.org"}}) {
+		t.Error("Did not expect www.other.org to match")
+	}
+}
+
+func TestBuildMatcher_ExprEmpty(t *testing.T) {
+	matcher, _ := buildMatcher(job.MatchConfig{Expr: &job.MatchExpr{}})
+	if _, ok := matcher.(scanner.MatchAll); !ok {
+		t.Fatalf("Expected MatchAll, got %T", matcher)
+	}
+}
+
+// leafLoggedAt returns a log entry for a test certificate, re-stamped as
+// logged at ts (milliseconds since the epoch).
+func leafLoggedAt(t *testing.T, ts uint64) *ct.LeafEntry {
+	t.Helper()
+	rle := testutil.RawLogEntryForTestCert(t, 0)
+	rle.Leaf.TimestampedEntry.Timestamp = ts
+	leafInput, err := tls.Marshal(rle.Leaf)
+	if err != nil {
+		t.Fatalf("marshal leaf: %v", err)
+	}
+	extra, err := tls.Marshal(ct.CertificateChain{Entries: rle.Chain})
+	if err != nil {
+		t.Fatalf("marshal chain: %v", err)
+	}
+	return &ct.LeafEntry{LeafInput: leafInput, ExtraData: extra}
+}
+
+func TestBuildMatcher_LogTimestampWindow(t *testing.T) {
+	from := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+	matcher, _ := buildMatcher(job.MatchConfig{LogTimestampFrom: from, LogTimestampTo: to})
+	m, ok := matcher.(MatchLogTimestamp)
+	if !ok {
+		t.Fatalf("Expected MatchLogTimestamp, got %T", matcher)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		at    time.Time
+		match bool
+	}{
+		{"before", from.Add(-time.Millisecond), false},
+		{"at start", from, true},
+		{"inside", from.Add(72 * time.Hour), true},
+		{"at end", to, false},
+		{"after", to.Add(time.Hour), false},
+	} {
+		if got := m.Matches(leafLoggedAt(t, uint64(tc.at.UnixMilli()))); got != tc.match {
+			t.Errorf("%s: Matches = %v, want %v", tc.name, got, tc.match)
+		}
+	}
+
+	// An open-ended window
+	matcher, _ = buildMatcher(job.MatchConfig{LogTimestampFrom: from})
+	if !matcher.(scanner.LeafMatcher).Matches(leafLoggedAt(t, uint64(to.Add(24*time.Hour).UnixMilli()))) {
+		t.Error("Expected entries after an unbounded window start to match")
+	}
+}
+
+func TestMatchLogTimestamp_Inner(t *testing.T) {
+	ts := uint64(time.Date(2025, 6, 3, 0, 0, 0, 0, time.UTC).UnixMilli())
+	leaf := leafLoggedAt(t, ts)
+	for _, tc := range []struct {
+		name  string
+		inner interface{}
+		match bool
+	}{
+		{"matcher matches", scanner.MatchAll{}, true},
+		{"matcher rejects", &scanner.MatchNone{}, false},
+		{"leaf matcher matches", scanner.MatchSCTTimestamp{Timestamp: ts}, true},
+		{"leaf matcher rejects", scanner.MatchSCTTimestamp{Timestamp: ts + 1}, false},
+	} {
+		m := MatchLogTimestamp{From: ts - 1000, To: ts + 1000, Inner: tc.inner}
+		if got := m.Matches(leaf); got != tc.match {
+			t.Errorf("%s: Matches = %v, want %v", tc.name, got, tc.match)
+		}
+	}
+
+	// Other criteria are still built, then narrowed by the window
+	matcher, _ := buildMatcher(job.MatchConfig{Serial: "not a number", LogTimestampFrom: time.UnixMilli(int64(ts - 1000))})
+	m := matcher.(MatchLogTimestamp)
+	if _, ok := m.Inner.(*scanner.MatchNone); !ok {
+		t.Fatalf("Expected the serial matcher inside the window, got %T", m.Inner)
+	}
+	if m.Matches(leaf) {
+		t.Error("Expected the inner matcher to reject the entry")
+	}
+}
+
+func TestBuildMatcher_ValidityRange(t *testing.T) {
+	after := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	before := after.AddDate(0, 1, 0)
+	cfg := job.MatchConfig{SubjectRegex: "example", NotBeforeAfter: after, NotBeforeBefore: before}
+	matcher, _ := buildMatcher(cfg)
+	m, ok := matcher.(MatchValidityRange)
+	if !ok {
+		t.Fatalf("Expected MatchValidityRange, got %T", matcher)
+	}
+	if _, ok := m.Inner.(*scanner.MatchSubjectRegex); !ok {
+		t.Fatalf("Expected inner to be MatchSubjectRegex, got %T", m.Inner)
+	}
+
+	cert := func(cn string, notBefore time.Time) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:   pkix.Name{CommonName: cn},
+			NotBefore: notBefore,
+			NotAfter:  notBefore.AddDate(0, 3, 0),
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		cert *x509.Certificate
+		want bool
+	}{
+		{"before window", cert("www.example.com", after.Add(-time.Second)), false},
+		{"at start", cert("www.example.com", after), true},
+		{"inside", cert("www.example.com", after.AddDate(0, 0, 10)), true},
+		{"at end", cert("www.example.com", before), false},
+		{"inside, other criteria fail", cert("www.other.org", after.AddDate(0, 0, 10)), false},
+	} {
+		if got := m.CertificateMatches(tc.cert); got != tc.want {
+			t.Errorf("%s: CertificateMatches = %v, want %v", tc.name, got, tc.want)
+		}
+		pre := &ct.Precertificate{TBSCertificate: tc.cert}
+		if got := m.PrecertificateMatches(pre); got != tc.want {
+			t.Errorf("%s: PrecertificateMatches = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// NotAfter bounds, open-ended, composed under SkipPrecerts
+	matcher, _ = buildMatcher(job.MatchConfig{SkipPrecerts: true, NotAfterBefore: before})
+	s, ok := matcher.(SkipPrecerts)
+	if !ok {
+		t.Fatalf("Expected SkipPrecerts, got %T", matcher)
+	}
+	if _, ok := s.Inner.(MatchValidityRange); !ok {
+		t.Fatalf("Expected inner to be MatchValidityRange, got %T", s.Inner)
+	}
+	expiring := &x509.Certificate{NotBefore: after.AddDate(-1, 0, 0), NotAfter: after}
+	if !s.CertificateMatches(expiring) {
+		t.Error("Expected a cert expiring before the bound to match")
+	}
+	if s.CertificateMatches(&x509.Certificate{NotBefore: after, NotAfter: before.AddDate(0, 0, 1)}) {
+		t.Error("Did not expect a cert expiring after the bound to match")
+	}
+}
+
+func TestBuildMatcher_CurrentlyValid(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	expired := &x509.Certificate{NotBefore: now.AddDate(-1, 0, 0), NotAfter: now.AddDate(0, 0, -1)}
+	future := &x509.Certificate{NotBefore: now.AddDate(0, 0, 1), NotAfter: now.AddDate(1, 0, 0)}
+	valid := &x509.Certificate{NotBefore: now.AddDate(0, -1, 0), NotAfter: now.AddDate(0, 2, 0)}
+
+	matcher, _ := buildMatcher(job.MatchConfig{ExcludeExpired: true, ExcludeNotYetValid: true})
+	m, ok := matcher.(MatchCurrentlyValid)
+	if !ok {
+		t.Fatalf("Expected MatchCurrentlyValid, got %T", matcher)
+	}
+	if _, ok := m.Inner.(scanner.MatchAll); !ok {
+		t.Fatalf("Expected inner to be MatchAll, got %T", m.Inner)
+	}
+	m.Now = func() time.Time { return now }
+
+	for _, tc := range []struct {
+		name                   string
+		expired, notYet, valid bool
+		cfg                    MatchCurrentlyValid
+	}{
+		{"both", false, false, true, m},
+		{"expired only", false, true, true, MatchCurrentlyValid{ExcludeExpired: true, Now: m.Now, Inner: m.Inner}},
+		{"not yet valid only", true, false, true, MatchCurrentlyValid{ExcludeNotYetValid: true, Now: m.Now, Inner: m.Inner}},
+		// A fixed reference time wins over the clock
+		{"fixed time", false, true, false, MatchCurrentlyValid{ExcludeExpired: true, ExcludeNotYetValid: true, At: now.AddDate(0, 3, 0), Now: m.Now, Inner: m.Inner}},
+	} {
+		for _, c := range []struct {
+			kind string
+			cert *x509.Certificate
+			want bool
+		}{{"expired", expired, tc.expired}, {"future", future, tc.notYet}, {"valid", valid, tc.valid}} {
+			if got := tc.cfg.CertificateMatches(c.cert); got != c.want {
+				t.Errorf("%s: CertificateMatches(%s) = %v, want %v", tc.name, c.kind, got, c.want)
+			}
+			pre := &ct.Precertificate{TBSCertificate: c.cert}
+			if got := tc.cfg.PrecertificateMatches(pre); got != c.want {
+				t.Errorf("%s: PrecertificateMatches(%s) = %v, want %v", tc.name, c.kind, got, c.want)
+			}
+		}
+	}
+
+	// Composed with other criteria
+	matcher, _ = buildMatcher(job.MatchConfig{SubjectRegex: "example", ExcludeExpired: true})
+	m, ok = matcher.(MatchCurrentlyValid)
+	if !ok {
+		t.Fatalf("Expected MatchCurrentlyValid, got %T", matcher)
+	}
+	if _, ok := m.Inner.(*scanner.MatchSubjectRegex); !ok {
+		t.Fatalf("Expected inner to be MatchSubjectRegex, got %T", m.Inner)
+	}
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "www.example.com"}, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	if !m.CertificateMatches(cert) {
+		t.Error("Expected a currently valid matching cert to match")
+	}
+	cert.Subject.CommonName = "www.other.org"
+	if m.CertificateMatches(cert) {
+		t.Error("Did not expect a currently valid cert failing other criteria to match")
+	}
+}
+
+func TestBuildMatcher_WildcardAndIPSAN(t *testing.T) {
+	wildcard := &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}, DNSNames: []string{"example.com", "*.example.com"}}
+	ipSAN := &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}, DNSNames: []string{"example.com"}, IPAddresses: []net.IP{net.ParseIP("192.0.2.1")}}
+	plain := &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}, DNSNames: []string{"example.com", "www.example.com"}}
+	// A wildcard in the middle of a name isn't a wildcard name
+	inner := &x509.Certificate{Subject: pkix.Name{CommonName: "example.com"}, DNSNames: []string{"a*.example.com"}}
+
+	for _, tc := range []struct {
+		cfg                           job.MatchConfig
+		wildcard, ipSAN, plain, inner bool
+	}{
+		{job.MatchConfig{WildcardOnly: true}, true, false, false, false},
+		{job.MatchConfig{HasIPSAN: true}, false, true, false, false},
+		{job.MatchConfig{WildcardOnly: true, HasIPSAN: true}, false, false, false, false},
+		{job.MatchConfig{}, true, true, true, true},
+	} {
+		m, _ := buildMatcher(tc.cfg)
+		matcher, ok := m.(scanner.Matcher)
+		if !ok {
+			t.Fatalf("%+v: expected a scanner.Matcher, got %T", tc.cfg, m)
+		}
+		for _, c := range []struct {
+			kind string
+			cert *x509.Certificate
+			want bool
+		}{{"wildcard", wildcard, tc.wildcard}, {"ip san", ipSAN, tc.ipSAN}, {"plain", plain, tc.plain}, {"inner wildcard", inner, tc.inner}} {
+			if got := matcher.CertificateMatches(c.cert); got != c.want {
+				t.Errorf("wildcard=%v ip=%v: CertificateMatches(%s) = %v, want %v", tc.cfg.WildcardOnly, tc.cfg.HasIPSAN, c.kind, got, c.want)
+			}
+			pre := &ct.Precertificate{TBSCertificate: c.cert}
+			if got := matcher.PrecertificateMatches(pre); got != c.want {
+				t.Errorf("wildcard=%v ip=%v: PrecertificateMatches(%s) = %v, want %v", tc.cfg.WildcardOnly, tc.cfg.HasIPSAN, c.kind, got, c.want)
+			}
+		}
+	}
+
+	// Composed with other criteria
+	m, _ := buildMatcher(job.MatchConfig{SubjectRegex: "other", WildcardOnly: true})
+	w, ok := m.(MatchWildcardSAN)
+	if !ok {
+		t.Fatalf("Expected MatchWildcardSAN, got %T", m)
+	}
+	if w.CertificateMatches(wildcard) {
+		t.Error("Did not expect a wildcard cert failing other criteria to match")
+	}
+}
+
+func TestBuildMatcher_KeyConstraints(t *testing.T) {
+	rsaKey := func(bits int) *x509.Certificate {
+		n := new(big.Int).Lsh(big.NewInt(1), uint(bits-1))
+		return &x509.Certificate{PublicKeyAlgorithm: x509.RSA, PublicKey: &rsa.PublicKey{N: n, E: 65537}}
+	}
+	rsa2048, rsa1024 := rsaKey(2048), rsaKey(1024)
+	p256 := &x509.Certificate{PublicKeyAlgorithm: x509.ECDSA, PublicKey: &ecdsa.PublicKey{Curve: elliptic.P256()}}
+	ed := &x509.Certificate{PublicKeyAlgorithm: x509.Ed25519, PublicKey: ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))}
+
+	for _, tc := range []struct {
+		name string
+		cfg  job.MatchConfig
+		want map[*x509.Certificate]bool
+	}{
+		{
+			"weak RSA",
+			job.MatchConfig{KeyAlgorithm: "rsa", MaxKeyBits: 1024},
+			map[*x509.Certificate]bool{rsa2048: false, rsa1024: true, p256: false, ed: false},
+		},
+		{
+			"at least 2048 bits",
+			job.MatchConfig{MinKeyBits: 2048},
+			map[*x509.Certificate]bool{rsa2048: true, rsa1024: false, p256: false, ed: false},
+		},
+		{
+			"small keys of any type",
+			job.MatchConfig{MaxKeyBits: 1024},
+			map[*x509.Certificate]bool{rsa2048: false, rsa1024: true, p256: true, ed: false},
+		},
+		{
+			"ECDSA",
+			job.MatchConfig{KeyAlgorithm: "ECDSA"},
+			map[*x509.Certificate]bool{rsa2048: false, rsa1024: false, p256: true, ed: false},
+		},
+		{
+			"Ed25519 without a size bound",
+			job.MatchConfig{KeyAlgorithm: "Ed25519"},
+			map[*x509.Certificate]bool{rsa2048: false, rsa1024: false, p256: false, ed: true},
+		},
+	} {
+		matcher, _ := buildMatcher(tc.cfg)
+		m, ok := matcher.(MatchKeyConstraints)
+		if !ok {
+			t.Fatalf("%s: Expected MatchKeyConstraints, got %T", tc.name, matcher)
+		}
+		for cert, want := range tc.want {
+			if got := m.CertificateMatches(cert); got != want {
+				t.Errorf("%s: CertificateMatches(%v) = %v, want %v", tc.name, cert.PublicKeyAlgorithm, got, want)
+			}
+			if got := m.PrecertificateMatches(&ct.Precertificate{TBSCertificate: cert}); got != want {
+				t.Errorf("%s: PrecertificateMatches(%v) = %v, want %v", tc.name, cert.PublicKeyAlgorithm, got, want)
+			}
+		}
+	}
+
+	// Other criteria still apply
+	matcher, _ := buildMatcher(job.MatchConfig{SubjectRegex: "example", MaxKeyBits: 1024})
+	rsa1024.Subject = pkix.Name{CommonName: "www.other.org"}
+	if matcher.(scanner.Matcher).CertificateMatches(rsa1024) {
+		t.Error("Did not expect a weak key with a non-matching subject to match")
+	}
+}
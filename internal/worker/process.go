@@ -7,10 +7,13 @@ import (
 
 	"github.com/chtzvt/certslurp/internal/cluster"
 	"github.com/chtzvt/certslurp/internal/etl"
+	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/secrets"
+	"github.com/chtzvt/certslurp/internal/sink"
 	ct "github.com/google/certificate-transparency-go"
 )
 
-func (w *Worker) processShardLoop(ctx context.Context, jobID string, shardID int) {
+func (w *Worker) processShardLoop(ctx context.Context, jobID string, shardID int, progress *shardProgress) {
 	start := time.Now()
 	var shardReported bool // track if we've reported Done/Failed
 	defer func() {
@@ -40,6 +43,7 @@ func (w *Worker) processShardLoop(ctx context.Context, jobID string, shardID int
 		w.Logger.Printf("get shard status failed: %v", err)
 		return
 	}
+	progress.setRange(status.IndexFrom, status.IndexTo)
 
 	w.maybeSleep()
 	jobInfo, err := w.Cluster.GetJob(ctx, jobID)
@@ -48,6 +52,14 @@ func (w *Worker) processShardLoop(ctx context.Context, jobID string, shardID int
 		return
 	}
 
+	if jobInfo.Status == cluster.JobStatePaused {
+		// Paused after the shard was claimed; hand it back untouched
+		_ = w.Cluster.ReleaseShardLease(ctx, jobID, shardID, w.ID)
+		w.Logger.Printf("job %s paused, released shard %d", jobID, shardID)
+		shardReported = true
+		return
+	}
+
 	w.maybeSleep()
 	cancelled, err := w.checkJobCancelled(ctx, jobID)
 	if err != nil {
@@ -59,11 +71,28 @@ func (w *Worker) processShardLoop(ctx context.Context, jobID string, shardID int
 		return
 	}
 
-	pipeline, err := etl.NewPipeline(jobInfo.Spec, w.Cluster.Secrets(), baseNameForPipeline(jobInfo.Spec, status, jobID, shardID))
+	pipeline, err := etl.NewPipeline(jobInfo.Spec, w.shardSecrets(ctx, jobInfo.Spec), baseNameForPipeline(jobInfo.Spec, status, jobID, shardID))
 	if err != nil {
 		w.Logger.Printf("etl pipeline init failed: %v", err)
 		return
 	}
+	pipeline.Ctx.JobID, pipeline.Ctx.ShardID = jobID, shardID
+	w.limitUploads(pipeline)
+
+	// Pick up after an earlier run's checkpoint, if there is one
+	from, resumed := status.IndexFrom, cluster.ShardCheckpoint{}
+	chunked := etl.Chunked(jobInfo.Spec)
+	if cp := status.Checkpoint; cp != nil && chunked && cp.LastIndex >= status.IndexFrom && cp.LastIndex < status.IndexTo {
+		from, resumed = cp.LastIndex+1, *cp
+		resumed.Generation++
+		pipeline.ChunkOffset, pipeline.Generation = resumed.Chunks, resumed.Generation
+		w.Logger.Printf("resuming shard %d (job %s) at index %d after %d chunks", shardID, jobID, from, resumed.Chunks)
+	}
+	listOutputs := jobInfo.Spec.Options.Output.Manifest
+	checkpoints := newCheckpointer(resumed, listOutputs)
+	pipeline.ChunkClosed = func(read int64) {
+		checkpoints.chunkClosed(read, pipeline.Stats)
+	}
 
 	ticker := time.NewTicker(w.jitterDuration() + time.Duration(w.LeaseSecs)*time.Second/2)
 	leaseRenewal := make(chan struct{})
@@ -76,7 +105,14 @@ func (w *Worker) processShardLoop(ctx context.Context, jobID string, shardID int
 				w.maybeSleep()
 				err := w.Cluster.RenewShardLease(ctx, jobID, shardID, w.ID)
 				if err != nil {
-					w.Logger.Printf("failed to renew lease for shard %d: %v", shardID, err)
+					w.errorLog().Logf("failed to renew lease", "failed to renew lease for shard %d: %v", shardID, err)
+				}
+				// Checkpoint on the same cadence, for resuming and for
+				// clients showing completion
+				if cp, ok := checkpoints.current(); ok {
+					if err := w.Cluster.UpdateShardProgress(ctx, jobID, shardID, w.ID, cp); err != nil {
+						w.errorLog().Logf("failed to checkpoint", "failed to checkpoint shard %d: %v", shardID, err)
+					}
 				}
 			case <-leaseRenewal:
 				ticker.Stop()
@@ -87,12 +123,20 @@ func (w *Worker) processShardLoop(ctx context.Context, jobID string, shardID int
 		}
 	}()
 
+	scanned := make(chan *ct.RawLogEntry, 32)
 	entries := make(chan *ct.RawLogEntry, 32)
+	go progress.count(ctx, scanned, entries)
 	etlErrCh := make(chan error, 1)
 	go func() {
 		etlErrCh <- pipeline.StreamProcess(ctx, entries)
 	}()
-	scanErr := w.StreamShard(ctx, *jobInfo.Spec, status.IndexFrom, status.IndexTo, entries)
+	// Unchunked output isn't durable until the whole shard is written, so
+	// there's nothing to checkpoint
+	var onScanned func(end, sent int64)
+	if chunked {
+		onScanned = checkpoints.scanned
+	}
+	scanErr := w.streamShard(ctx, *jobInfo.Spec, from, status.IndexTo, scanned, onScanned)
 	etlErr := <-etlErrCh
 
 	// Check if context was cancelled during work (e.g., test/shutdown/compaction)
@@ -102,7 +146,7 @@ func (w *Worker) processShardLoop(ctx context.Context, jobID string, shardID int
 	}
 
 	if scanErr != nil {
-		w.Logger.Printf("scanner failed: %v", scanErr)
+		w.errorLog().Logf("scanner failed", "scanner failed: %v", scanErr)
 		return
 	}
 	if etlErr != nil {
@@ -110,7 +154,19 @@ func (w *Worker) processShardLoop(ctx context.Context, jobID string, shardID int
 		return
 	}
 
-	manifest := cluster.ShardManifest{}
+	// Totals include what earlier runs wrote before the checkpoint resumed
+	// from; their dead letters aren't carried over
+	manifest := cluster.ShardManifest{
+		Records:          resumed.Records + pipeline.Stats.Records,
+		Bytes:            resumed.Bytes + pipeline.Stats.Bytes,
+		Chunks:           resumed.Chunks + pipeline.Stats.Chunks,
+		DeadLettered:     pipeline.Stats.DeadLettered,
+		ProcessingTimeNs: time.Since(start).Nanoseconds(),
+	}
+	// Chunks are only listed for the job manifest, to keep shard keys small
+	if listOutputs {
+		manifest.Outputs = append(resumed.Outputs, outputChunks(pipeline.Stats.Outputs)...)
+	}
 	w.maybeSleep()
 	if err := w.Cluster.ReportShardDone(ctx, jobID, shardID, manifest); err != nil {
 		w.Logger.Printf("report done failed: %v", err)
@@ -120,3 +176,36 @@ func (w *Worker) processShardLoop(ctx context.Context, jobID string, shardID int
 	w.Logger.Printf("shard %d (job %s) completed", shardID, jobID)
 	shardReported = true
 }
+
+// shardSecrets prefetches the sink credentials the job references in a single
+// etcd round trip and returns a store serving them from memory for the
+// lifetime of the shard. If the prefetch fails, sinks fall back to reading
+// each secret as they need it.
+func (w *Worker) shardSecrets(ctx context.Context, spec *job.JobSpec) *secrets.Store {
+	store := w.Cluster.Secrets()
+	names := spec.Options.Output.SinkSecretNames()
+	if store == nil || len(names) == 0 {
+		return store
+	}
+	values, err := store.GetMany(ctx, names)
+	if err != nil {
+		w.Logger.Printf("secret prefetch failed, reading secrets individually: %v", err)
+		return store
+	}
+	return store.WithCache(values)
+}
+
+// limitUploads routes the pipeline's output through the worker-wide upload
+// semaphore and counts its open chunks in the worker metrics. The dead-letter
+// sink is left alone: it is opened while a chunk is already held, so sharing
+// the semaphore could deadlock a shard.
+func (w *Worker) limitUploads(p *etl.Pipeline) {
+	var s sink.Sink = sink.NewTrackedSink(p.Sink, &w.Metrics.ActiveUploads)
+	if w.MaxConcurrentUploads > 0 {
+		w.uploadSemOnce.Do(func() {
+			w.uploadSem = make(chan struct{}, w.MaxConcurrentUploads)
+		})
+		s = sink.NewLimitedSink(s, w.uploadSem)
+	}
+	p.Sink = s
+}
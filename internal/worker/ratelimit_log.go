@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const errorLogWindow = time.Minute
+
+// logLimiter collapses repetitive log lines. The first occurrence of a key is
+// logged immediately; further occurrences within the window are counted and
+// reported as a single summary line once the window has elapsed.
+type logLimiter struct {
+	logger *log.Logger
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*limitedLogEntry
+}
+
+type limitedLogEntry struct {
+	windowStart time.Time
+	suppressed  int
+}
+
+func newLogLimiter(logger *log.Logger, window time.Duration) *logLimiter {
+	return &logLimiter{
+		logger:  logger,
+		window:  window,
+		now:     time.Now,
+		entries: make(map[string]*limitedLogEntry),
+	}
+}
+
+// Logf logs format/args unless a line with the same key was already logged in
+// the current window.
+func (l *logLimiter) Logf(key, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	e, ok := l.entries[key]
+	if ok && now.Sub(e.windowStart) < l.window {
+		e.suppressed++
+		return
+	}
+	if ok {
+		l.summarize(key, e)
+	}
+	l.entries[key] = &limitedLogEntry{windowStart: now}
+	l.logger.Printf(format, args...)
+}
+
+// Printf satisfies jsonclient.Logger, keying on the format string so that
+// messages differing only in their arguments are treated as similar.
+func (l *logLimiter) Printf(format string, args ...interface{}) {
+	l.Logf(format, format, args...)
+}
+
+// Flush emits summaries for any suppressed lines and resets all windows.
+func (l *logLimiter) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, e := range l.entries {
+		l.summarize(key, e)
+		delete(l.entries, key)
+	}
+}
+
+func (l *logLimiter) summarize(key string, e *limitedLogEntry) {
+	if e.suppressed == 0 {
+		return
+	}
+	l.logger.Printf("%d more similar errors in the last %s: %s", e.suppressed, l.window, key)
+}
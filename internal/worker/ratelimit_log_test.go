@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogLimiter_CollapsesRepeatedErrors(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogLimiter(log.New(&buf, "", 0), time.Minute)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	err := errors.New("connection refused")
+	for i := 0; i < 50; i++ {
+		l.Logf("heartbeat failed", "heartbeat failed: %v", err)
+		now = now.Add(time.Second)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line within the window, got %d: %q", len(lines), lines)
+	}
+	if lines[0] != "heartbeat failed: connection refused" {
+		t.Errorf("unexpected first line: %q", lines[0])
+	}
+
+	// Once the window elapses, the next occurrence emits a summary and is logged.
+	now = now.Add(time.Minute)
+	l.Logf("heartbeat failed", "heartbeat failed: %v", err)
+
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected summary and new line, got %d: %q", len(lines), lines)
+	}
+	if lines[1] != "49 more similar errors in the last 1m0s: heartbeat failed" {
+		t.Errorf("unexpected summary line: %q", lines[1])
+	}
+	if lines[2] != "heartbeat failed: connection refused" {
+		t.Errorf("unexpected line after window: %q", lines[2])
+	}
+}
+
+func TestLogLimiter_KeysAreIndependent(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogLimiter(log.New(&buf, "", 0), time.Minute)
+
+	l.Logf("heartbeat failed", "heartbeat failed: %v", "a")
+	l.Logf("SendMetrics failed", "SendMetrics failed: %v", "b")
+	l.Printf("fetch failed for %s: %v", "https://ct.example.com", "timeout")
+	l.Printf("fetch failed for %s: %v", "https://ct.example.com", "timeout")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d: %q", len(lines), lines)
+	}
+}
+
+func TestLogLimiter_FlushSummarizesSuppressed(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogLimiter(log.New(&buf, "", 0), time.Minute)
+
+	for i := 0; i < 3; i++ {
+		l.Logf("scanner failed", "scanner failed: %v", "boom")
+	}
+	l.Flush()
+
+	out := buf.String()
+	if !strings.Contains(out, "2 more similar errors in the last 1m0s: scanner failed") {
+		t.Errorf("expected flush summary, got %q", out)
+	}
+
+	// Windows reset after flush, so the next occurrence logs immediately.
+	buf.Reset()
+	l.Logf("scanner failed", "scanner failed: %v", "boom")
+	if strings.TrimSpace(buf.String()) != "scanner failed: boom" {
+		t.Errorf("expected line after flush, got %q", buf.String())
+	}
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/job"
+)
+
+const (
+	defaultMaxRetryAfter = 60 * time.Second
+	// maxRetryAfterAttempts bounds how many 429s in a row a single request
+	// waits out before the response is handed back to the scanner.
+	maxRetryAfterAttempts = 5
+)
+
+// parseRetryAfter parses a Retry-After header value, given either as a number
+// of seconds or as an HTTP date, into the duration to wait from now.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(0, at.Sub(now)), true
+}
+
+// retryAfterTransport waits out 429 responses that carry a Retry-After header
+// and retries the request, rather than leaving the scanner to retry on its
+// own schedule, which may be sooner than the log allows.
+type retryAfterTransport struct {
+	base    http.RoundTripper
+	maxWait time.Duration
+	logf    func(format string, args ...interface{})
+	now     func() time.Time
+}
+
+// retryAfterTransport wraps base to honor Retry-After per the job's fetch
+// config, or returns base unchanged if the job opts out.
+func (w *Worker) retryAfterTransport(base http.RoundTripper, cfg job.FetchConfig) http.RoundTripper {
+	maxWait := defaultMaxRetryAfter
+	switch {
+	case cfg.MaxRetryAfterSecs < 0:
+		return base
+	case cfg.MaxRetryAfterSecs > 0:
+		maxWait = time.Duration(cfg.MaxRetryAfterSecs) * time.Second
+	}
+	return &retryAfterTransport{base: base, maxWait: maxWait, logf: w.Logger.Printf, now: time.Now}
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt > maxRetryAfterAttempts {
+			return resp, err
+		}
+		// Only requests that can be replayed are retried here; CT log
+		// fetches are all body-less GETs
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, nil
+		}
+		wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), t.now())
+		if !ok || wait > t.maxWait {
+			return resp, nil
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+
+		t.logf("CT log %s rate limited request (429), retrying after %s as asked (attempt %d/%d)", req.URL.Host, wait, attempt, maxRetryAfterAttempts)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
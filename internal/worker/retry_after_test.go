@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/job"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"3", 3 * time.Second, true},
+		{" 0 ", 0, true},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %v; want %s, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// rateLimitedLog answers the first get-entries request with a 429 carrying
+// retryAfter, and serves an empty page afterwards.
+func rateLimitedLog(t *testing.T, retryAfter string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", retryAfter)
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"entries":[]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetryAfterTransport_WaitsIndicatedTime(t *testing.T) {
+	srv, calls := rateLimitedLog(t, "1")
+	var logs bytes.Buffer
+	w := &Worker{Logger: log.New(&logs, "", 0)}
+	client := &http.Client{Transport: w.retryAfterTransport(http.DefaultTransport, job.FetchConfig{})}
+
+	start := time.Now()
+	resp, err := client.Get(srv.URL + "/ct/v1/get-entries?start=0&end=9")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	elapsed := time.Since(start)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the retry to succeed, got %d", resp.StatusCode)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+	if elapsed < time.Second {
+		t.Errorf("retried after %s, before the 1s Retry-After", elapsed)
+	}
+	if !strings.Contains(logs.String(), "retrying after 1s") {
+		t.Errorf("expected the wait to be logged, got %q", logs.String())
+	}
+}
+
+func TestRetryAfterTransport_FallsBackPastCap(t *testing.T) {
+	w := &Worker{Logger: log.New(&bytes.Buffer{}, "", 0)}
+	for name, cfg := range map[string]job.FetchConfig{
+		"over cap": {MaxRetryAfterSecs: 5},
+		"disabled": {MaxRetryAfterSecs: -1},
+	} {
+		srv, calls := rateLimitedLog(t, "30")
+		client := &http.Client{Transport: w.retryAfterTransport(http.DefaultTransport, cfg)}
+		resp, err := client.Get(srv.URL + "/ct/v1/get-entries?start=0&end=9")
+		if err != nil {
+			t.Fatalf("%s: get: %v", name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests || calls.Load() != 1 {
+			t.Errorf("%s: expected the 429 to be returned untouched, got %d after %d requests", name, resp.StatusCode, calls.Load())
+		}
+	}
+}
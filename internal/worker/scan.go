@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/scanner"
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+// scanLog fetches [opts.StartIndex, opts.EndIndex) and passes each entry
+// opts.Matcher accepts to found. It does what scanner.Scanner does, except
+// that it knows which entries have been dealt with: each time the entries
+// before some index have all been matched, and those found passed on, it
+// calls onProgress, if set, with that index. Fetch and match workers finish
+// batches out of order, so the index trails the furthest batch fetched.
+func scanLog(ctx context.Context, client scanner.LogClient, opts scanner.ScannerOptions, found func(*ct.RawLogEntry), onProgress func(end int64), logf func(format string, args ...interface{})) error {
+	matcher := opts.Matcher
+	if matcher == nil {
+		matcher = scanner.MatchAll{}
+	}
+	fetcher := scanner.NewFetcher(client, &opts.FetcherOptions)
+	progress := newBatchTracker(opts.StartIndex, onProgress)
+
+	batches := make(chan scanner.EntryBatch, max(opts.NumWorkers, 1))
+	var wg sync.WaitGroup
+	for i := 0; i < max(opts.NumWorkers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				for j := range b.Entries {
+					index := b.Start + int64(j)
+					entry, err := matchEntry(matcher, opts.PrecertOnly, index, &b.Entries[j])
+					if err != nil {
+						logf("skipping entry %d: %v", index, err)
+					} else if entry != nil {
+						found(entry)
+					}
+				}
+				if ctx.Err() == nil {
+					// A cancelled scan may have dropped entries in found
+					progress.done(b.Start, b.Start+int64(len(b.Entries)))
+				}
+			}
+		}()
+	}
+	err := fetcher.Run(ctx, func(b scanner.EntryBatch) {
+		select {
+		case batches <- b:
+		case <-ctx.Done():
+		}
+	})
+	close(batches)
+	wg.Wait()
+	return err
+}
+
+// matchEntry returns the log entry at index if matcher, a scanner.Matcher or
+// scanner.LeafMatcher, accepts it, or nil if it doesn't. Entries that can't
+// be parsed are an error, as they are for scanner.Scanner.
+func matchEntry(matcher interface{}, precertOnly bool, index int64, leaf *ct.LeafEntry) (*ct.RawLogEntry, error) {
+	switch m := matcher.(type) {
+	case scanner.LeafMatcher:
+		if !m.Matches(leaf) {
+			return nil, nil
+		}
+		raw, err := ct.RawLogEntryFromLeaf(index, leaf)
+		if raw == nil {
+			return nil, fmt.Errorf("failed to build raw log entry: %v", err)
+		}
+		switch raw.Leaf.TimestampedEntry.EntryType {
+		case ct.X509LogEntryType:
+			if precertOnly {
+				return nil, nil
+			}
+		case ct.PrecertLogEntryType:
+		default:
+			return nil, fmt.Errorf("unknown entry type %v", raw.Leaf.TimestampedEntry.EntryType)
+		}
+		return raw, nil
+	case scanner.Matcher:
+		raw, err := ct.RawLogEntryFromLeaf(index, leaf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build raw log entry: %v", err)
+		}
+		entry, err := raw.ToLogEntry()
+		if err != nil && x509.IsFatal(err) {
+			return nil, fmt.Errorf("failed to parse [pre-]certificate: %v", err)
+		}
+		switch {
+		case entry.X509Cert != nil:
+			if precertOnly || !m.CertificateMatches(entry.X509Cert) {
+				return nil, nil
+			}
+		case entry.Precert != nil:
+			if !m.PrecertificateMatches(entry.Precert) {
+				return nil, nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown entry type %v", entry.Leaf.TimestampedEntry.EntryType)
+		}
+		return raw, nil
+	}
+	return nil, fmt.Errorf("unexpected matcher type %T", matcher)
+}
+
+// batchTracker follows which batches of a range are done and reports how far
+// the range is done without gaps.
+type batchTracker struct {
+	mu        sync.Mutex
+	next      int64           // everything before next is done
+	pending   map[int64]int64 // batches done past a gap: start -> end
+	onAdvance func(end int64)
+}
+
+func newBatchTracker(start int64, onAdvance func(end int64)) *batchTracker {
+	return &batchTracker{next: start, pending: map[int64]int64{}, onAdvance: onAdvance}
+}
+
+// done marks [start, end) done. onAdvance is called with the lock held, so
+// calls are never reordered.
+func (t *batchTracker) done(start, end int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if end <= start {
+		return
+	}
+	t.pending[start] = end
+	advanced := false
+	for {
+		end, ok := t.pending[t.next]
+		if !ok {
+			break
+		}
+		delete(t.pending, t.next)
+		t.next, advanced = end, true
+	}
+	if advanced && t.onAdvance != nil {
+		t.onAdvance(t.next)
+	}
+}
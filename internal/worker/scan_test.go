@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/chtzvt/certslurp/internal/testutil"
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/client"
+	"github.com/google/certificate-transparency-go/jsonclient"
+	"github.com/google/certificate-transparency-go/scanner"
+)
+
+func TestScanLog_ReportsProgressInOrder(t *testing.T) {
+	ts := testutil.NewRangedStubCTLogServer(t, testutil.CTLogFourEntrySTH, testutil.CTLogFourEntries, nil)
+	defer ts.Close()
+	logClient, err := client.New(ts.URL, http.DefaultClient, jsonclient.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var found []int64
+	var progress []int64
+	opts := scanner.ScannerOptions{
+		FetcherOptions: scanner.FetcherOptions{BatchSize: 1, ParallelFetch: 2, StartIndex: 1, EndIndex: 4},
+		Matcher:        scanner.MatchAll{},
+		NumWorkers:     3,
+	}
+	err = scanLog(context.Background(), logClient, opts, func(e *ct.RawLogEntry) {
+		mu.Lock()
+		defer mu.Unlock()
+		found = append(found, e.Index)
+	}, func(end int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		// Every entry before end has been passed on already
+		for i := opts.StartIndex; i < end; i++ {
+			if !slices.Contains(found, i) {
+				t.Errorf("progress reached %d before entry %d was found", end, i)
+			}
+		}
+		progress = append(progress, end)
+	}, t.Logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(found)
+	if !reflect.DeepEqual(found, []int64{1, 2, 3}) {
+		t.Fatalf("found %v, want [1 2 3]", found)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != 4 {
+		t.Fatalf("progress %v should end at 4", progress)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] <= progress[i-1] {
+			t.Fatalf("progress %v went backwards", progress)
+		}
+	}
+}
+
+func TestBatchTracker_WaitsForGaps(t *testing.T) {
+	var got []int64
+	tr := newBatchTracker(100, func(end int64) { got = append(got, end) })
+
+	tr.done(110, 120)
+	tr.done(130, 140)
+	if len(got) != 0 {
+		t.Fatalf("advanced to %v past the gap at 100", got)
+	}
+	tr.done(100, 110) // closes the first gap
+	tr.done(125, 125) // empty batches are ignored
+	tr.done(120, 130) // and the second
+	if want := []int64{120, 140}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/scanner"
+)
+
+const defaultSTHCacheTTL = 30 * time.Second
+
+// sthCache holds recently fetched STHs per log, so that processing many shards
+// of the same log doesn't re-fetch the tree head for every shard.
+type sthCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]sthCacheEntry
+}
+
+type sthCacheEntry struct {
+	sth     *ct.SignedTreeHead
+	fetched time.Time
+}
+
+func newSTHCache(ttl time.Duration) *sthCache {
+	return &sthCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]sthCacheEntry),
+	}
+}
+
+// Get returns the cached STH for logURI if it is within the TTL and covers at
+// least minSize entries, otherwise it calls fetch and caches the result.
+func (c *sthCache) Get(ctx context.Context, logURI string, minSize int64, fetch func(context.Context) (*ct.SignedTreeHead, error)) (*ct.SignedTreeHead, error) {
+	c.mu.Lock()
+	e, ok := c.entries[logURI]
+	c.mu.Unlock()
+	if ok && c.now().Sub(e.fetched) < c.ttl && int64(e.sth.TreeSize) >= minSize {
+		return e.sth, nil
+	}
+
+	sth, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[logURI] = sthCacheEntry{sth: sth, fetched: c.now()}
+	c.mu.Unlock()
+	return sth, nil
+}
+
+// sthCachingClient serves GetSTH from the worker's cache. The scanner uses the
+// STH to bound the fetch range, so a cached head is only reused when it covers
+// the shard's end index; a smaller one would truncate the shard.
+type sthCachingClient struct {
+	scanner.LogClient
+	cache    *sthCache
+	endIndex int64
+}
+
+func (c *sthCachingClient) GetSTH(ctx context.Context) (*ct.SignedTreeHead, error) {
+	return c.cache.Get(ctx, c.BaseURI(), c.endIndex, c.LogClient.GetSTH)
+}
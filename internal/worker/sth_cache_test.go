@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ct "github.com/google/certificate-transparency-go"
+)
+
+type countingLogClient struct {
+	treeSize uint64
+	sthCalls int
+}
+
+func (c *countingLogClient) BaseURI() string { return "https://ct.example.com/log" }
+
+func (c *countingLogClient) GetSTH(context.Context) (*ct.SignedTreeHead, error) {
+	c.sthCalls++
+	return &ct.SignedTreeHead{TreeSize: c.treeSize}, nil
+}
+
+func (c *countingLogClient) GetRawEntries(context.Context, int64, int64) (*ct.GetEntriesResponse, error) {
+	return &ct.GetEntriesResponse{}, nil
+}
+
+func TestSTHCache_RepeatedLookupsWithinTTLHitCache(t *testing.T) {
+	stub := &countingLogClient{treeSize: 1000}
+	cache := newSTHCache(time.Minute)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for shard := 0; shard < 10; shard++ {
+		c := &sthCachingClient{LogClient: stub, cache: cache, endIndex: int64(shard+1) * 100}
+		sth, err := c.GetSTH(ctx)
+		if err != nil {
+			t.Fatalf("GetSTH: %v", err)
+		}
+		if sth.TreeSize != 1000 {
+			t.Fatalf("unexpected tree size %d", sth.TreeSize)
+		}
+		now = now.Add(time.Second)
+	}
+	if stub.sthCalls != 1 {
+		t.Errorf("expected 1 get-sth call within TTL, got %d", stub.sthCalls)
+	}
+
+	// Once the TTL has elapsed, the STH is re-fetched.
+	now = now.Add(time.Minute)
+	c := &sthCachingClient{LogClient: stub, cache: cache, endIndex: 100}
+	if _, err := c.GetSTH(ctx); err != nil {
+		t.Fatalf("GetSTH: %v", err)
+	}
+	if stub.sthCalls != 2 {
+		t.Errorf("expected re-fetch after TTL, got %d calls", stub.sthCalls)
+	}
+}
+
+func TestSTHCache_RefetchesWhenCachedTreeTooSmall(t *testing.T) {
+	stub := &countingLogClient{treeSize: 1000}
+	cache := newSTHCache(time.Minute)
+	ctx := context.Background()
+
+	c := &sthCachingClient{LogClient: stub, cache: cache, endIndex: 500}
+	if _, err := c.GetSTH(ctx); err != nil {
+		t.Fatalf("GetSTH: %v", err)
+	}
+
+	// A shard past the cached tree size must not be truncated by a stale STH.
+	stub.treeSize = 2000
+	c = &sthCachingClient{LogClient: stub, cache: cache, endIndex: 1500}
+	sth, err := c.GetSTH(ctx)
+	if err != nil {
+		t.Fatalf("GetSTH: %v", err)
+	}
+	if stub.sthCalls != 2 || sth.TreeSize != 2000 {
+		t.Errorf("expected re-fetch for larger shard, got %d calls, tree size %d", stub.sthCalls, sth.TreeSize)
+	}
+}
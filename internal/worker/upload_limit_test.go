@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/etl"
+	"github.com/chtzvt/certslurp/internal/etl_core"
+	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/sink"
+	ct "github.com/google/certificate-transparency-go"
+)
+
+type passExtractor struct{}
+
+func (passExtractor) Extract(_ *etl_core.Context, raw *ct.RawLogEntry) (map[string]interface{}, error) {
+	return map[string]interface{}{"v": raw.Cert.Data}, nil
+}
+
+type passTransformer struct{}
+
+func (passTransformer) Transform(_ *etl_core.Context, data map[string]interface{}) ([]byte, error) {
+	return data["v"].([]byte), nil
+}
+func (passTransformer) Header(*etl_core.Context) ([]byte, error) { return nil, nil }
+func (passTransformer) Footer(*etl_core.Context) ([]byte, error) { return nil, nil }
+
+// slowUploadSink records the highest number of concurrent Close calls.
+type slowUploadSink struct {
+	inFlight, peak, closes int64
+}
+
+func (s *slowUploadSink) Open(ctx context.Context, name string) (sink.SinkWriter, error) {
+	return &slowUploadWriter{sink: s}, nil
+}
+
+type slowUploadWriter struct {
+	bytes.Buffer
+	sink *slowUploadSink
+}
+
+func (w *slowUploadWriter) Close() error {
+	n := atomic.AddInt64(&w.sink.inFlight, 1)
+	for {
+		peak := atomic.LoadInt64(&w.sink.peak)
+		if n <= peak || atomic.CompareAndSwapInt64(&w.sink.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	atomic.AddInt64(&w.sink.inFlight, -1)
+	atomic.AddInt64(&w.sink.closes, 1)
+	return nil
+}
+
+func TestLimitUploads_GlobalAcrossShards(t *testing.T) {
+	const limit = 2
+	w := &Worker{Metrics: &cluster.WorkerMetrics{}, MaxConcurrentUploads: limit}
+	out := &slowUploadSink{}
+
+	var peakActive int64
+	stop := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if n := w.Metrics.ActiveUploadCount(); n > atomic.LoadInt64(&peakActive) {
+				atomic.StoreInt64(&peakActive, n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	// Two shards, each with chunk-per-record output and several writers of
+	// their own, as a worker running shards in parallel would have.
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for shard := 0; shard < 2; shard++ {
+		spec := &job.JobSpec{}
+		p := &etl.Pipeline{
+			Extractor:    passExtractor{},
+			Transformer:  passTransformer{},
+			Sink:         out,
+			Ctx:          &etl_core.Context{Spec: spec},
+			MaxChunkRecs: 1,
+			BaseName:     "shard",
+		}
+		w.limitUploads(p)
+
+		for writer := 0; writer < 3; writer++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				entries := make(chan *ct.RawLogEntry, 5)
+				for i := 0; i < 5; i++ {
+					entries <- &ct.RawLogEntry{Index: int64(i), Cert: ct.ASN1Cert{Data: []byte("x")}}
+				}
+				close(entries)
+				if err := p.StreamProcess(context.Background(), entries); err != nil {
+					errs <- err
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(stop)
+	<-sampled
+	close(errs)
+	for err := range errs {
+		t.Fatalf("StreamProcess: %v", err)
+	}
+
+	if got := atomic.LoadInt64(&out.closes); got != 30 {
+		t.Fatalf("expected 30 chunks uploaded, got %d", got)
+	}
+	if out.peak > limit {
+		t.Fatalf("peak concurrent uploads %d exceeds limit %d", out.peak, limit)
+	}
+	if out.peak < limit {
+		t.Errorf("expected uploads to reach the limit of %d, peak was %d", limit, out.peak)
+	}
+	if peakActive > limit || peakActive == 0 {
+		t.Errorf("active upload metric peaked at %d, want 1..%d", peakActive, limit)
+	}
+	if n := w.Metrics.ActiveUploadCount(); n != 0 {
+		t.Errorf("expected no active uploads after completion, got %d", n)
+	}
+}
@@ -2,15 +2,17 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
 	"net/http"
-	"net/url"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/etl"
 	"github.com/chtzvt/certslurp/internal/job"
 )
 
@@ -101,8 +103,8 @@ func (w *Worker) heartbeatLoop(ctx context.Context) {
 			return
 		case <-time.After(base + w.jitterDuration()):
 			w.maybeSleep()
-			if err := w.Cluster.HeartbeatWorker(ctx, w.ID); err != nil {
-				w.Logger.Printf("heartbeat failed: %v", err)
+			if err := w.Cluster.HeartbeatWorker(ctx, w.ID, w.Activity()...); err != nil {
+				w.errorLog().Logf("heartbeat failed", "heartbeat failed: %v", err)
 			}
 		}
 	}
@@ -120,7 +122,7 @@ func (w *Worker) metricsLoop(ctx context.Context) {
 		case <-time.After(base + w.jitterDuration()):
 			w.maybeSleep()
 			if err := w.Cluster.SendMetrics(ctx, w.ID, w.Metrics); err != nil {
-				w.Logger.Printf("SendMetrics failed: %v", err)
+				w.errorLog().Logf("SendMetrics failed", "SendMetrics failed: %v", err)
 			}
 		}
 	}
@@ -135,7 +137,12 @@ func (w *Worker) checkJobCancelled(ctx context.Context, jobID string) (bool, err
 	return status, nil
 }
 
-// findAllClaimableShards returns up to batchSize claimable shards across all jobs.
+// findAllClaimableShards returns up to batchSize claimable shards across all
+// jobs. Jobs are scanned in descending order of priority, and each until the
+// batch is full or it has none left to offer, so a batch is filled from
+// higher priority jobs first. Shards hinted at this worker are looked up
+// directly, ahead of the scan. The batch is shuffled within each priority
+// level, with the hinted shards first.
 func (w *Worker) findAllClaimableShards(ctx context.Context, batchSize int) []ShardRef {
 	w.maybeSleep()
 	jobs, err := w.Cluster.ListJobs(ctx)
@@ -143,107 +150,138 @@ func (w *Worker) findAllClaimableShards(ctx context.Context, batchSize int) []Sh
 		w.Logger.Printf("error listing jobs: %v", err)
 		return nil
 	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobPriority(jobs[i]) > jobPriority(jobs[j])
+	})
+	hinted, err := w.Cluster.ListPreferredShards(ctx, w.ID)
+	if err != nil {
+		w.Logger.Printf("error listing preferred shards: %v", err)
+	}
 	now := time.Now()
 	claimable := make([]ShardRef, 0, batchSize)
+	priorities := make([]int, 0, batchSize) // of each claimable shard's job
+	preferred := map[ShardRef]struct{}{}
 	const windowSize = 128
 	const maxEmptyWindows = 8
 
-	randShuffle := func(refs []ShardRef) []ShardRef {
-		rand.Shuffle(len(refs), func(i, j int) {
-			refs[i], refs[j] = refs[j], refs[i]
-		})
-		return refs
-	}
-
 	for _, job := range jobs {
+		if len(claimable) >= batchSize {
+			break
+		}
+		if job.Status == cluster.JobStatePaused || job.Status == cluster.JobStateCancelled {
+			continue
+		}
 		w.maybeSleep()
 		shardCount, err := w.Cluster.GetShardCount(ctx, job.ID)
 		if err != nil || shardCount == 0 {
 			continue
 		}
-		emptyWindows := 0
-		checked := map[int]struct{}{}
-		lastWindowScanned := false
 
-		for {
-			// Fallback: scan ALL
-			if shardCount < windowSize || emptyWindows >= maxEmptyWindows {
-				w.maybeSleep()
-				window, err := w.Cluster.GetShardAssignmentsWindow(ctx, job.ID, 0, shardCount)
-				if len(claimable) < batchSize {
-					var stuck []int
-					for sID, stat := range window {
-						if !stat.Done && !stat.Failed && !stat.Assigned && (stat.BackoffUntil.IsZero() || now.After(stat.BackoffUntil)) {
-							stuck = append(stuck, sID)
-						}
-					}
-				}
-				if err != nil {
-					break
-				}
-				for sID, stat := range window {
-					if _, alreadyChecked := checked[sID]; !alreadyChecked && !stat.Assigned && !stat.Done && !stat.Failed &&
-						(stat.BackoffUntil.IsZero() || now.After(stat.BackoffUntil)) {
-						claimable = append(claimable, ShardRef{JobID: job.ID, ShardID: sID})
-						if len(claimable) >= batchSize {
-							return randShuffle(claimable)
-						}
-					}
-				}
-				break
-			}
-
-			// Standard random window
-			offset := rand.Intn(shardCount - windowSize + 1)
+		// scan adds the claimable shards in [from, to) that haven't been
+		// looked at yet, and reports whether there were any
+		checked := map[int]struct{}{}
+		scan := func(from, to int) (bool, error) {
 			w.maybeSleep()
-			window, err := w.Cluster.GetShardAssignmentsWindow(ctx, job.ID, offset, offset+windowSize)
+			window, err := w.Cluster.GetShardAssignmentsWindow(ctx, job.ID, from, to)
 			if err != nil {
-				break
+				return false, err
 			}
 			found := false
 			for sID, stat := range window {
+				if _, seen := checked[sID]; seen {
+					continue
+				}
 				checked[sID] = struct{}{}
-				if !stat.Assigned && !stat.Done && !stat.Failed &&
-					(stat.BackoffUntil.IsZero() || now.After(stat.BackoffUntil)) {
-					claimable = append(claimable, ShardRef{JobID: job.ID, ShardID: sID})
-					if len(claimable) >= batchSize {
-						return randShuffle(claimable)
+				if len(claimable) < batchSize && w.canClaim(stat, now) {
+					ref := ShardRef{JobID: job.ID, ShardID: sID}
+					if stat.PreferredWorker == w.ID {
+						preferred[ref] = struct{}{}
 					}
+					claimable = append(claimable, ref)
+					priorities = append(priorities, jobPriority(job))
 					found = true
 				}
 			}
-			if found {
-				break
+			return found, nil
+		}
+
+		// Shards held for this worker could be anywhere in a large job
+		for _, sID := range hinted[job.ID] {
+			if sID < shardCount && len(claimable) < batchSize {
+				scan(sID, sID+1)
 			}
-			emptyWindows++
+		}
 
-			// Ensure we always explicitly check the final window at least once
-			if !lastWindowScanned && shardCount > windowSize {
-				lastWindowScanned = true
-				offset := shardCount - windowSize
-				w.maybeSleep()
-				window, err := w.Cluster.GetShardAssignmentsWindow(ctx, job.ID, offset, shardCount)
-				if err == nil {
-					for sID, stat := range window {
-						checked[sID] = struct{}{}
-						if !stat.Assigned && !stat.Done && !stat.Failed &&
-							(stat.BackoffUntil.IsZero() || now.After(stat.BackoffUntil)) {
-							claimable = append(claimable, ShardRef{JobID: job.ID, ShardID: sID})
-							if len(claimable) >= batchSize {
-								return randShuffle(claimable)
-							}
-							found = true
-						}
-					}
-					if found {
-						break
-					}
-				}
+		if shardCount <= windowSize {
+			scan(0, shardCount)
+			continue
+		}
+		// Random windows spread workers over a large job. Keep going until
+		// the batch is full or they stop turning up new shards, then check
+		// the final window, which random offsets seldom cover, and last of
+		// all everything not seen yet.
+		emptyWindows := 0
+		for emptyWindows < maxEmptyWindows && len(claimable) < batchSize && len(checked) < shardCount {
+			offset := rand.Intn(shardCount - windowSize + 1)
+			found, err := scan(offset, offset+windowSize)
+			if err != nil {
+				break
 			}
+			if !found {
+				emptyWindows++
+			}
+		}
+		if len(claimable) < batchSize && len(checked) < shardCount {
+			if _, err := scan(shardCount-windowSize, shardCount); err != nil {
+				continue
+			}
+		}
+		if len(claimable) < batchSize && len(checked) < shardCount {
+			scan(0, shardCount)
 		}
 	}
 
-	return randShuffle(claimable)
+	// Shuffle within each priority level only, so that workers spread over
+	// a level's shards without taking a lower level's first
+	for start := 0; start < len(claimable); {
+		end := start + 1
+		for end < len(claimable) && priorities[end] == priorities[start] {
+			end++
+		}
+		level := claimable[start:end]
+		rand.Shuffle(len(level), func(i, j int) {
+			level[i], level[j] = level[j], level[i]
+		})
+		if len(preferred) > 0 {
+			sort.SliceStable(level, func(i, j int) bool {
+				_, pi := preferred[level[i]]
+				_, pj := preferred[level[j]]
+				return pi && !pj
+			})
+		}
+		start = end
+	}
+	return claimable
+}
+
+// canClaim reports whether stat describes a shard w may try to claim: one
+// that's unassigned, unfinished, out of backoff, and not being held for
+// another worker it's hinted at.
+func (w *Worker) canClaim(stat cluster.ShardAssignmentStatus, now time.Time) bool {
+	if stat.Assigned || stat.Done || stat.Failed {
+		return false
+	}
+	if !stat.BackoffUntil.IsZero() && !now.After(stat.BackoffUntil) {
+		return false
+	}
+	return stat.PreferredWorker == "" || stat.PreferredWorker == w.ID || !now.Before(stat.PreferredUntil)
+}
+
+func jobPriority(info cluster.JobInfo) int {
+	if info.Spec == nil {
+		return 0
+	}
+	return info.Spec.Priority
 }
 
 // tryAssignShardWithRetry tries to assign a shard with retries on race/assignment contention.
@@ -259,7 +297,8 @@ func (w *Worker) tryAssignShardWithRetry(ctx context.Context, jobID string, shar
 		msg := err.Error()
 		if strings.Contains(msg, "assignment race") ||
 			strings.Contains(msg, "already assigned") ||
-			strings.Contains(msg, "in backoff") {
+			strings.Contains(msg, "in backoff") ||
+			errors.Is(err, cluster.ErrWorkerAtCapacity) {
 			backoff := w.PollPeriod + w.jitterDuration()
 			time.Sleep(backoff)
 			lastErr = err
@@ -271,38 +310,12 @@ func (w *Worker) tryAssignShardWithRetry(ctx context.Context, jobID string, shar
 	return fmt.Errorf("failed to assign shard %d (job %s) after %d retries: last error: %v", shardID, jobID, maxAssignShardRetries, lastErr)
 }
 
-// baseNameForPipeline returns a normalized name for the data output by this shard's ETL pipeline, in
-// the format <log url>.<log index range>.<job uuid>.<shard id>
-// Example: mysite_domain_com__some__path.0_1000000.17E28132-8B25-4FB2-99C5-89938D4D3D24.1
+// baseNameForPipeline returns a normalized name for the data output by this shard's ETL pipeline.
+// See etl.OutputBaseName.
 func baseNameForPipeline(spec *job.JobSpec, shardStatus cluster.ShardStatus, jobID string, shardID int) string {
-	logUrl, err := normalizeURL(spec.LogURI)
-	if err != nil {
-		logUrl = jobID
-	}
-
-	shardRange := fmt.Sprintf("%d_%d", shardStatus.IndexFrom, shardStatus.IndexTo)
-
-	return strings.ToLower(fmt.Sprintf("%s.%s.%s.%d", logUrl, shardRange, jobID, shardID))
+	return etl.OutputBaseName(spec, shardStatus.IndexFrom, shardStatus.IndexTo, jobID, shardID)
 }
 
 func normalizeURL(raw string) (string, error) {
-	parsed, err := url.Parse(raw)
-	if err != nil {
-		return "", fmt.Errorf("invalid URL: %w", err)
-	}
-
-	host := parsed.Hostname()
-	if host == "" {
-		return "", fmt.Errorf("invalid URL: no hostname found")
-	}
-
-	path := strings.Trim(parsed.EscapedPath(), "/")
-
-	host = strings.ReplaceAll(host, ".", "_")
-	path = strings.ReplaceAll(path, "/", "__")
-
-	if path != "" {
-		return host + "__" + path, nil
-	}
-	return host, nil
+	return etl.NormalizeLogURL(raw)
 }
@@ -1,6 +1,14 @@
 package worker
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/testcluster"
+)
 
 func TestNormalizeURL(t *testing.T) {
 	tests := []struct {
@@ -27,3 +35,169 @@ func TestNormalizeURL(t *testing.T) {
 		}
 	}
 }
+
+func TestFindAllClaimableShards_PrefersHigherPriorityJobs(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	low := submitJobWithShards(t, cl, "http://low.example", 0, 4)
+	high := submitJobWithShards(t, cl, "http://high.example", 10, 4)
+
+	w := NewWorker(cl, "w1", nil)
+	w.DisableJitterAndSmoothingForTests = true
+	// Jobs used to be scanned in map order, so repeat to rule out luck
+	for i := 0; i < 10; i++ {
+		batch := w.findAllClaimableShards(ctx, 4)
+		if len(batch) != 4 {
+			t.Fatalf("got %d shards, want 4", len(batch))
+		}
+		for _, ref := range batch {
+			if ref.JobID != high {
+				t.Fatalf("claimed shard %d of low priority job %s before the high priority job's", ref.ShardID, low)
+			}
+		}
+	}
+
+	// With room to spare, the batch is filled from the lower priority job
+	jobs := map[string]int{}
+	for _, ref := range w.findAllClaimableShards(ctx, 6) {
+		jobs[ref.JobID]++
+	}
+	if jobs[high] != 4 || jobs[low] != 2 {
+		t.Fatalf("got shards per job %v, want 4 from %s and 2 from %s", jobs, high, low)
+	}
+}
+
+func TestFindAllClaimableShards_FillsFromLargeHighPriorityJob(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// More shards than fit in one scan window
+	high := submitJobWithShards(t, cl, "http://high.example", 10, 300)
+	low := submitJobWithShards(t, cl, "http://low.example", 0, 4)
+
+	w := NewWorker(cl, "w1", nil)
+	w.DisableJitterAndSmoothingForTests = true
+	batch := w.findAllClaimableShards(ctx, 200)
+	if len(batch) != 200 {
+		t.Fatalf("got %d shards, want 200", len(batch))
+	}
+	for _, ref := range batch {
+		if ref.JobID != high {
+			t.Fatalf("claimed shard %d of low priority job %s before the high priority job's", ref.ShardID, low)
+		}
+	}
+
+	// Shuffling stays within a priority level
+	batch = w.findAllClaimableShards(ctx, 302)
+	if len(batch) != 302 {
+		t.Fatalf("got %d shards, want 302", len(batch))
+	}
+	for i, ref := range batch {
+		if want := i < 300; (ref.JobID == high) != want {
+			t.Fatalf("shard %d of job %s at position %d, want all of %s first", ref.ShardID, ref.JobID, i, high)
+		}
+	}
+}
+
+func TestFindAllClaimableShards_SkipsPausedJobs(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+	jobID := submitJobWithShards(t, cl, "http://paused.example", 0, 4)
+
+	w := NewWorker(cl, "w1", nil)
+	w.DisableJitterAndSmoothingForTests = true
+	if err := cl.PauseJob(ctx, jobID); err != nil {
+		t.Fatal(err)
+	}
+	if batch := w.findAllClaimableShards(ctx, 4); len(batch) != 0 {
+		t.Fatalf("got %d claimable shards of a paused job, want none", len(batch))
+	}
+
+	if err := cl.ResumeJob(ctx, jobID); err != nil {
+		t.Fatal(err)
+	}
+	if batch := w.findAllClaimableShards(ctx, 4); len(batch) != 4 {
+		t.Fatalf("got %d claimable shards after resuming, want 4", len(batch))
+	}
+}
+
+func TestFindAllClaimableShards_HonorsPreferredWorker(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+	jobID := submitJobWithShards(t, cl, "http://preferred.example", 0, 4)
+
+	const grace = time.Second
+	if err := cl.SetShardPreferredWorker(ctx, jobID, 2, "w1", grace); err != nil {
+		t.Fatal(err)
+	}
+	hinted := ShardRef{JobID: jobID, ShardID: 2}
+
+	w1 := NewWorker(cl, "w1", nil)
+	w1.DisableJitterAndSmoothingForTests = true
+	w2 := NewWorker(cl, "w2", nil)
+	w2.DisableJitterAndSmoothingForTests = true
+
+	// Only the hinted worker sees the shard, and picks it ahead of the others
+	for i := 0; i < 10; i++ {
+		for _, ref := range w2.findAllClaimableShards(ctx, 4) {
+			if ref == hinted {
+				t.Fatalf("w2 found shard %d claimable within w1's grace period", ref.ShardID)
+			}
+		}
+		if batch := w1.findAllClaimableShards(ctx, 4); len(batch) != 4 || batch[0] != hinted {
+			t.Fatalf("w1 got %v, want all 4 shards starting with its hinted shard", batch)
+		}
+	}
+
+	// Once the grace period is over, any worker may claim it
+	time.Sleep(grace + 100*time.Millisecond)
+	if batch := w2.findAllClaimableShards(ctx, 4); len(batch) != 4 {
+		t.Fatalf("w2 got %d claimable shards after the grace period, want 4", len(batch))
+	}
+}
+
+func TestFindAllClaimableShards_FindsHintedShardInLargeJob(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+	jobID := submitJobWithShards(t, cl, "http://preferred.example", 0, 2000)
+
+	if err := cl.SetShardPreferredWorker(ctx, jobID, 1500, "w1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	hinted := ShardRef{JobID: jobID, ShardID: 1500}
+
+	w := NewWorker(cl, "w1", nil)
+	w.DisableJitterAndSmoothingForTests = true
+	// A random window would seldom cover the shard
+	for i := 0; i < 10; i++ {
+		if batch := w.findAllClaimableShards(ctx, 1); len(batch) != 1 || batch[0] != hinted {
+			t.Fatalf("got %v, want the hinted shard", batch)
+		}
+	}
+}
+
+// submitJobWithShards submits a job at the given priority, split into
+// shards of 100 entries.
+func submitJobWithShards(t *testing.T, cl cluster.Cluster, logURI string, priority, shards int) string {
+	t.Helper()
+	ctx := context.Background()
+	spec := &job.JobSpec{Version: "0.1.0", LogURI: logURI, Priority: priority, Options: testcluster.DefaultTestJobOptions()}
+	jobID, err := cl.SubmitJob(ctx, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ranges []cluster.ShardRange
+	for i := 0; i < shards; i++ {
+		ranges = append(ranges, cluster.ShardRange{ShardID: i, IndexFrom: int64(i * 100), IndexTo: int64((i + 1) * 100)})
+	}
+	if err := cl.BulkCreateShards(ctx, jobID, ranges); err != nil {
+		t.Fatal(err)
+	}
+	return jobID
+}
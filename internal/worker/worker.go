@@ -2,12 +2,14 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chtzvt/certslurp/internal/cluster"
@@ -29,10 +31,38 @@ type Worker struct {
 	Logger      *log.Logger
 	Metrics     *cluster.WorkerMetrics
 
+	// ShutdownTimeout bounds how long the worker waits for in-flight shards to
+	// drain on stop. Zero waits indefinitely.
+	ShutdownTimeout time.Duration
+
+	// STHCacheTTL is how long a log's signed tree head is reused across shards
+	// before being re-fetched. Zero disables caching.
+	STHCacheTTL time.Duration
+
+	// MaxConcurrentUploads bounds how many chunks may be written or uploaded
+	// at once across all of the worker's shards. Zero means unlimited.
+	MaxConcurrentUploads int
+
+	// LogEndpoint, if set, is registered in the cluster so operators can fetch
+	// the worker's recent log lines (see LogBuffer).
+	LogEndpoint string
+
 	stopCh  chan struct{}
 	stopped chan struct{}
 	wg      sync.WaitGroup
 
+	activeMu sync.Mutex
+	active   map[ShardRef]*shardProgress
+
+	errLog     *logLimiter
+	errLogOnce sync.Once
+
+	sths     *sthCache
+	sthsOnce sync.Once
+
+	uploadSem     chan struct{}
+	uploadSemOnce sync.Once
+
 	mainLoopErrorCount                int64
 	mainLoopBackoff                   time.Duration
 	DisableJitterAndSmoothingForTests bool
@@ -49,6 +79,10 @@ const (
 	maxAssignShardRetries  = 5
 )
 
+// ErrShutdownTimeout is returned by Run when in-flight shards did not finish
+// within ShutdownTimeout and the worker exited without them.
+var ErrShutdownTimeout = errors.New("worker: shutdown timeout exceeded")
+
 func NewWorker(cl cluster.Cluster, id string, logger *log.Logger) *Worker {
 	return &Worker{
 		ID:          id,
@@ -61,12 +95,15 @@ func NewWorker(cl cluster.Cluster, id string, logger *log.Logger) *Worker {
 		stopCh:      make(chan struct{}),
 		stopped:     make(chan struct{}),
 		Metrics:     &cluster.WorkerMetrics{},
+		STHCacheTTL: defaultSTHCacheTTL,
+		active:      make(map[ShardRef]*shardProgress),
 	}
 }
 
 // Run is the worker's main supervisory loop. Returns on stop/cancel.
 func (w *Worker) Run(ctx context.Context) error {
 	defer close(w.stopped)
+	defer w.errorLog().Flush()
 
 	hostName, err := os.Hostname()
 	if err != nil {
@@ -75,10 +112,18 @@ func (w *Worker) Run(ctx context.Context) error {
 
 	w.maybeSleep()
 	time.Sleep(w.jitterDuration())
-	_, err = w.Cluster.RegisterWorker(ctx, cluster.WorkerInfo{ID: w.ID, Host: hostName})
+	_, err = w.Cluster.RegisterWorker(ctx, cluster.WorkerInfo{ID: w.ID, Host: hostName, LogEndpoint: w.LogEndpoint, Capacity: w.MaxParallel})
 	if err != nil {
 		return err
 	}
+	// Free the ID on the way out, so a restart can register it again at once
+	defer func() {
+		uctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := w.Cluster.UnregisterWorker(uctx, w.ID); err != nil {
+			w.Logger.Printf("worker: failed to unregister: %v", err)
+		}
+	}()
 
 	var lastErr error
 
@@ -92,12 +137,13 @@ func (w *Worker) Run(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			w.Logger.Println("worker: context cancelled")
-			w.wg.Wait()
+			if err := w.drain(); err != nil {
+				return err
+			}
 			return ctx.Err()
 		case <-w.stopCh:
 			w.Logger.Println("worker: stop requested")
-			w.wg.Wait()
-			return nil
+			return w.drain()
 		default:
 			// --- Main Loop Error Handling ---
 			if lastErr != nil {
@@ -135,7 +181,10 @@ func (w *Worker) Run(ctx context.Context) error {
 						w.Logger.Printf("assign failed: shard %d (job %s): %v", shardID, jobID, err)
 						return
 					}
-					w.processShardLoop(ctx, jobID, shardID)
+					ref := ShardRef{JobID: jobID, ShardID: shardID}
+					progress := w.startShard(ref)
+					defer w.finishShard(ref)
+					w.processShardLoop(ctx, jobID, shardID, progress)
 				}(ref.JobID, ref.ShardID)
 			}
 			// Only wait poll period after all launches, to avoid hammering etcd
@@ -154,9 +203,76 @@ func (w *Worker) Stop() {
 	<-w.stopped
 }
 
+// drain waits for in-flight shards to finish. If ShutdownTimeout elapses first,
+// the leases of shards still processing are released so that other workers can
+// reclaim them, and ErrShutdownTimeout is returned.
+func (w *Worker) drain() error {
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	if w.ShutdownTimeout <= 0 {
+		<-done
+		return nil
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(w.ShutdownTimeout):
+	}
+
+	w.activeMu.Lock()
+	refs := make([]ShardRef, 0, len(w.active))
+	for ref := range w.active {
+		refs = append(refs, ref)
+	}
+	w.activeMu.Unlock()
+
+	w.Logger.Printf("worker: shutdown timeout (%s) exceeded with %d shard(s) still processing, forcing exit", w.ShutdownTimeout, len(refs))
+	for _, ref := range refs {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := w.Cluster.ReleaseShardLease(ctx, ref.JobID, ref.ShardID, w.ID); err != nil {
+			w.Logger.Printf("worker: failed to release shard %d (job %s) on forced exit: %v", ref.ShardID, ref.JobID, err)
+		} else {
+			w.Logger.Printf("worker: released shard %d (job %s) on forced exit", ref.ShardID, ref.JobID)
+		}
+		cancel()
+	}
+	return ErrShutdownTimeout
+}
+
+// errorLog returns the worker's rate-limited logger for repetitive errors.
+func (w *Worker) errorLog() *logLimiter {
+	w.errLogOnce.Do(func() {
+		w.errLog = newLogLimiter(w.Logger, errorLogWindow)
+	})
+	return w.errLog
+}
+
+// sthCache returns the worker's shared STH cache, or nil if caching is disabled.
+func (w *Worker) sthCache() *sthCache {
+	if w.STHCacheTTL <= 0 {
+		return nil
+	}
+	w.sthsOnce.Do(func() {
+		w.sths = newSTHCache(w.STHCacheTTL)
+	})
+	return w.sths
+}
+
 // StreamShard streams log entries for the given shard range directly into the provided channel.
 // Closes the channel when done or on error.
 func (w *Worker) StreamShard(ctx context.Context, jobSpec job.JobSpec, from, to int64, ch chan<- *ct.RawLogEntry) error {
+	return w.streamShard(ctx, jobSpec, from, to, ch, nil)
+}
+
+// streamShard is StreamShard, calling onScanned, if set, as the scan
+// progresses: with an index every entry before which has been dealt with,
+// and the number of entries sent to ch by then.
+func (w *Worker) streamShard(ctx context.Context, jobSpec job.JobSpec, from, to int64, ch chan<- *ct.RawLogEntry, onScanned func(end, sent int64)) error {
 	matchCfg := jobSpec.Options.Match
 	fetchCfg := jobSpec.Options.Fetch
 
@@ -177,11 +293,23 @@ func (w *Worker) StreamShard(ctx context.Context, jobSpec job.JobSpec, from, to
 	}
 
 	transport, timeout := httpTransportForShard(fetchCfg)
+	var roundTripper http.RoundTripper = transport
+
+	headers, err := w.fetchHeaders(ctx, fetchCfg)
+	if err != nil {
+		close(ch)
+		return err
+	}
+	if len(headers) > 0 {
+		roundTripper = &headerTransport{base: transport, headers: headers}
+	}
+	roundTripper, opts.ParallelFetch = w.adaptiveFetchTransport(roundTripper, fetchCfg)
+	roundTripper = w.retryAfterTransport(roundTripper, fetchCfg)
 
 	logClient, err := client.New(jobSpec.LogURI, &http.Client{
 		Timeout:   timeout,
-		Transport: transport,
-	}, jsonclient.Options{UserAgent: "certslurp/1.0", Logger: w.Logger})
+		Transport: roundTripper,
+	}, jsonclient.Options{UserAgent: "certslurp/1.0", Logger: w.errorLog()})
 
 	if err != nil {
 		close(ch)
@@ -194,15 +322,25 @@ func (w *Worker) StreamShard(ctx context.Context, jobSpec job.JobSpec, from, to
 		}
 	}
 
-	s := scanner.NewScanner(logClient, opts)
+	var scanClient scanner.LogClient = logClient
+	if cache := w.sthCache(); cache != nil {
+		scanClient = &sthCachingClient{LogClient: logClient, cache: cache, endIndex: to}
+	}
+
 	// Send entries to channel as they are found
+	var sent atomic.Int64
 	collect := func(entry *ct.RawLogEntry) {
 		select {
 		case ch <- entry:
+			sent.Add(1)
 		case <-ctx.Done():
 		}
 	}
-	err = s.Scan(ctx, collect, collect)
+	var onProgress func(end int64)
+	if onScanned != nil {
+		onProgress = func(end int64) { onScanned(end, sent.Load()) }
+	}
+	err = scanLog(ctx, scanClient, opts, collect, onProgress, w.errorLog().Printf)
 	close(ch)
 	return err
 }
@@ -80,6 +80,44 @@ func TestCancelJobErrors(t *testing.T) {
 	require.NoError(t, cl.CancelJob(ctx, jobID)) // Should not error if idempotent
 }
 
+func TestPauseResumeJob(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+	require.Error(t, cl.PauseJob(ctx, "doesnotexist"))
+	require.Error(t, cl.ResumeJob(ctx, "doesnotexist"))
+
+	spec := &job.JobSpec{Version: "x", LogURI: "u", Options: job.JobOptions{}}
+	jobID, err := cl.SubmitJob(ctx, spec)
+	require.NoError(t, err)
+	status := func() cluster.JobState {
+		info, err := cl.GetJob(ctx, jobID)
+		require.NoError(t, err)
+		return info.Status
+	}
+
+	// A pending job resumes as pending
+	require.NoError(t, cl.PauseJob(ctx, jobID))
+	require.Equal(t, cluster.JobStatePaused, status())
+	require.NoError(t, cl.PauseJob(ctx, jobID)) // idempotent
+	require.NoError(t, cl.ResumeJob(ctx, jobID))
+	require.Equal(t, cluster.JobStatePending, status())
+	require.NoError(t, cl.ResumeJob(ctx, jobID)) // idempotent
+
+	// And a running one as running
+	require.NoError(t, cl.UpdateJobStatus(ctx, jobID, cluster.JobStateRunning))
+	require.NoError(t, cl.PauseJob(ctx, jobID))
+	require.Equal(t, cluster.JobStatePaused, status())
+	require.NoError(t, cl.ResumeJob(ctx, jobID))
+	require.Equal(t, cluster.JobStateRunning, status())
+
+	// Finished jobs can't be paused, nor resumed
+	require.NoError(t, cl.CancelJob(ctx, jobID))
+	require.ErrorContains(t, cl.PauseJob(ctx, jobID), "only pending or running")
+	require.ErrorContains(t, cl.ResumeJob(ctx, jobID), "not paused")
+	require.Equal(t, cluster.JobStateCancelled, status())
+}
+
 func TestListJobs_AllFields(t *testing.T) {
 	cl, cleanup := testcluster.SetupEtcdCluster(t)
 	defer cleanup()
@@ -131,6 +169,71 @@ func TestListJobs_AllFields(t *testing.T) {
 	require.True(t, found2.Cancelled.IsZero())
 }
 
+func TestListJobsFiltered(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	submitted := map[string]bool{}
+	running := map[string]bool{}
+	for i := 0; i < 7; i++ {
+		// Shards sit under the job prefix, and must not be mistaken for jobs
+		jobID := testcluster.SubmitTestJob(t, cl, "http://example.com", 3)
+		submitted[jobID] = true
+		if i%3 == 0 {
+			require.NoError(t, cl.MarkJobStarted(ctx, jobID))
+			running[jobID] = true
+		}
+	}
+
+	page, err := cl.ListJobsFiltered(ctx, cluster.JobListOptions{Status: cluster.JobStateRunning})
+	require.NoError(t, err)
+	require.Len(t, page.Jobs, len(running))
+	require.Empty(t, page.NextCursor)
+	for _, j := range page.Jobs {
+		require.True(t, running[j.ID])
+		require.Equal(t, cluster.JobStateRunning, j.Status)
+		require.NotNil(t, j.Spec)
+		require.False(t, j.Started.IsZero())
+	}
+
+	// Paging through returns every job exactly once, in order
+	seen := map[string]int{}
+	var last string
+	opts := cluster.JobListOptions{Limit: 3}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 10, "pagination did not terminate")
+		page, err := cl.ListJobsFiltered(ctx, opts)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page.Jobs), 3)
+		for _, j := range page.Jobs {
+			require.Greater(t, j.ID, last)
+			last = j.ID
+			seen[j.ID]++
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		require.Equal(t, last, page.NextCursor)
+		opts.Cursor = page.NextCursor
+	}
+	require.Len(t, seen, len(submitted))
+	for id, n := range seen {
+		require.True(t, submitted[id])
+		require.Equal(t, 1, n, "job %s listed %d times", id, n)
+	}
+
+	// Status filtering and paging combine
+	page, err = cl.ListJobsFiltered(ctx, cluster.JobListOptions{Limit: 2, Status: cluster.JobStateRunning})
+	require.NoError(t, err)
+	require.Len(t, page.Jobs, 2)
+	require.NotEmpty(t, page.NextCursor)
+	page, err = cl.ListJobsFiltered(ctx, cluster.JobListOptions{Limit: 2, Status: cluster.JobStateRunning, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Jobs, 1)
+	require.True(t, running[page.Jobs[0].ID])
+}
+
 func TestJobInfo_JSONRoundtrip(t *testing.T) {
 	now := time.Now().UTC().Truncate(time.Millisecond)
 	info := cluster.JobInfo{
@@ -184,6 +287,55 @@ func TestCluster_JobStatusTransitions(t *testing.T) {
 	}
 }
 
+func TestMarkJobCompleted_WritesSummary(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	jobID := testcluster.SubmitTestJob(t, cl, "https://ct.example", 5)
+	require.NoError(t, cl.MarkJobStarted(ctx, jobID))
+	for shardID, man := range []cluster.ShardManifest{
+		{Records: 100, Bytes: 4096, Chunks: 2, ProcessingTimeNs: int64(time.Second)},
+		{Records: 90, Bytes: 3000, Chunks: 1, DeadLettered: 10, ProcessingTimeNs: int64(2 * time.Second)},
+		{Records: 5, Bytes: 200, Chunks: 1, ProcessingTimeNs: int64(time.Second)},
+	} {
+		require.NoError(t, cl.ReportShardDone(ctx, jobID, shardID, man))
+	}
+	for i := 0; i <= cluster.MaxShardRetries; i++ {
+		require.NoError(t, cl.ReportShardFailed(ctx, jobID, 3))
+	}
+	require.NoError(t, cl.SkipShard(ctx, jobID, 4, "log gap"))
+
+	info, err := cl.GetJob(ctx, jobID)
+	require.NoError(t, err)
+	require.Nil(t, info.Summary, "no summary before completion")
+
+	require.NoError(t, cl.MarkJobCompleted(ctx, jobID))
+	info, err = cl.GetJob(ctx, jobID)
+	require.NoError(t, err)
+	require.NotNil(t, info.Summary)
+	require.Positive(t, info.Summary.DurationNs)
+	require.LessOrEqual(t, info.Summary.DurationNs, info.Completed.Sub(info.Started).Nanoseconds())
+	info.Summary.DurationNs = 0
+	require.Equal(t, cluster.JobSummary{
+		Shards:           5,
+		ShardsDone:       3,
+		ShardsFailed:     1,
+		ShardsSkipped:    1,
+		Records:          195,
+		Bytes:            7296,
+		Chunks:           4,
+		DeadLettered:     10,
+		ProcessingTimeNs: int64(4 * time.Second),
+	}, *info.Summary)
+
+	jobs, err := cl.ListJobs(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.NotNil(t, jobs[0].Summary)
+	require.EqualValues(t, 195, jobs[0].Summary.Records)
+}
+
 func TestCluster_DoubleCompletion(t *testing.T) {
 	cl, cleanup := testcluster.SetupEtcdCluster(t)
 	defer cleanup()
@@ -244,3 +396,139 @@ func TestCluster_BackoffAndPermanentFailure(t *testing.T) {
 	err = cl.AssignShard(context.Background(), jobID, shardID, "workerX")
 	require.Error(t, err, "should not be assignable after permanent failure")
 }
+
+func TestPurgeJob(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	spec := &job.JobSpec{Version: "x", LogURI: "u", Options: job.JobOptions{}}
+	jobID, err := cl.SubmitJob(ctx, spec)
+	require.NoError(t, err)
+
+	// More shards than fit in one etcd transaction
+	const numShards = 300
+	ranges := make([]cluster.ShardRange, numShards)
+	for i := range ranges {
+		ranges[i] = cluster.ShardRange{ShardID: i, IndexFrom: int64(i * 10), IndexTo: int64(i*10 + 10)}
+	}
+	require.NoError(t, cl.BulkCreateShards(ctx, jobID, ranges))
+	require.NoError(t, cl.AssignShard(ctx, jobID, 0, "worker-1"))
+	require.NoError(t, cl.ReportShardDone(ctx, jobID, 0, cluster.ShardManifest{OutputPath: "out"}))
+
+	// Unfinished jobs are refused
+	require.ErrorContains(t, cl.PurgeJob(ctx, jobID), "only completed, cancelled or failed jobs can be purged")
+	require.NoError(t, cl.PauseJob(ctx, jobID))
+	require.Error(t, cl.PurgeJob(ctx, jobID))
+	require.NoError(t, cl.ResumeJob(ctx, jobID))
+
+	require.NoError(t, cl.MarkJobCompleted(ctx, jobID))
+	require.NoError(t, cl.PurgeJob(ctx, jobID))
+
+	jobs, err := cl.ListJobs(ctx)
+	require.NoError(t, err)
+	require.Empty(t, jobs)
+	assignments, err := cl.GetShardAssignments(ctx, jobID)
+	require.NoError(t, err)
+	require.Empty(t, assignments)
+	_, err = cl.GetJob(ctx, jobID)
+	require.Error(t, err)
+
+	require.Error(t, cl.PurgeJob(ctx, jobID), "purging a purged job should fail")
+}
+
+func TestPurgeFinishedJobs(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	spec := &job.JobSpec{Version: "x", LogURI: "u", Options: job.JobOptions{}}
+	completed, err := cl.SubmitJob(ctx, spec)
+	require.NoError(t, err)
+	require.NoError(t, cl.MarkJobCompleted(ctx, completed))
+	cancelled, err := cl.SubmitJob(ctx, spec)
+	require.NoError(t, err)
+	require.NoError(t, cl.CancelJob(ctx, cancelled))
+	running, err := cl.SubmitJob(ctx, spec)
+	require.NoError(t, err)
+	require.NoError(t, cl.MarkJobStarted(ctx, running))
+
+	// Nothing finished before the cutoff yet
+	purged, err := cluster.PurgeFinishedJobs(ctx, cl, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, purged)
+
+	purged, err = cluster.PurgeFinishedJobs(ctx, cl, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{completed, cancelled}, purged)
+
+	jobs, err := cl.ListJobs(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.Equal(t, running, jobs[0].ID)
+}
+
+func TestWatchJob(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	jobID := testcluster.SubmitTestJob(t, cl, "https://watch.example", 2)
+	_, err := cl.WatchJob(ctx, "nosuchjob")
+	require.ErrorContains(t, err, "not found")
+
+	events, err := cl.WatchJob(ctx, jobID)
+	require.NoError(t, err)
+	next := func() cluster.JobEvent {
+		t.Helper()
+		select {
+		case ev, ok := <-events:
+			require.True(t, ok, "event stream closed early")
+			return ev
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for an event")
+		}
+		return cluster.JobEvent{}
+	}
+
+	ev := next()
+	require.Nil(t, ev.ShardID)
+	require.Equal(t, "status", ev.Field)
+	require.Equal(t, cluster.JobStatePending, ev.Status)
+
+	require.NoError(t, cl.AssignShard(ctx, jobID, 1, "w1"))
+	ev = next()
+	require.NotNil(t, ev.ShardID)
+	require.Equal(t, 1, *ev.ShardID)
+	require.Equal(t, "assignment", ev.Field)
+
+	require.NoError(t, cl.ReportShardDone(ctx, jobID, 1, cluster.ShardManifest{OutputPath: "out"}))
+	fields := map[string]bool{}
+	for !fields["done"] {
+		ev = next()
+		require.Equal(t, 1, *ev.ShardID)
+		fields[ev.Field] = true
+	}
+
+	// The stream ends once the job is finished
+	require.NoError(t, cl.MarkJobCompleted(ctx, jobID))
+	var final cluster.JobState
+	for ev := range events {
+		if ev.Field == "status" {
+			final = ev.Status
+		}
+	}
+	require.NoError(t, ctx.Err(), "stream didn't end with the job")
+	require.Equal(t, cluster.JobStateCompleted, final)
+
+	// Watching a finished job yields its status alone
+	events, err = cl.WatchJob(ctx, jobID)
+	require.NoError(t, err)
+	var got []cluster.JobEvent
+	for ev := range events {
+		got = append(got, ev)
+	}
+	require.Len(t, got, 1)
+	require.Equal(t, cluster.JobStateCompleted, got[0].Status)
+}
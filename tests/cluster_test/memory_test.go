@@ -0,0 +1,284 @@
+package cluster_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/secrets"
+	"github.com/chtzvt/certslurp/internal/testcluster"
+	"github.com/chtzvt/certslurp/internal/testutil"
+	"github.com/chtzvt/certslurp/internal/testworkers"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestMemoryCluster_JobLifecycle(t *testing.T) {
+	cl, cleanup := testcluster.SetupMemoryCluster(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	spec := &job.JobSpec{
+		Version: "0.1.0",
+		LogURI:  "https://ct.googleapis.com/aviator",
+		Options: job.JobOptions{},
+	}
+	jobID, err := cl.SubmitJob(ctx, spec)
+	require.NoError(t, err)
+	require.NotEmpty(t, jobID)
+
+	j, err := cl.GetJob(ctx, jobID)
+	require.NoError(t, err)
+	require.Equal(t, cluster.JobStatePending, j.Status)
+
+	require.NoError(t, cl.MarkJobStarted(ctx, jobID))
+	require.NoError(t, cl.UpdateJobStatus(ctx, jobID, cluster.JobStateRunning))
+	j, err = cl.GetJob(ctx, jobID)
+	require.NoError(t, err)
+	require.Equal(t, cluster.JobStateRunning, j.Status)
+	require.False(t, j.Started.IsZero())
+
+	require.NoError(t, cl.MarkJobCompleted(ctx, jobID))
+	j, err = cl.GetJob(ctx, jobID)
+	require.NoError(t, err)
+	require.False(t, j.Completed.IsZero())
+
+	jobs, err := cl.ListJobs(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+}
+
+func TestMemoryCluster_ShardAssignmentLifecycle(t *testing.T) {
+	cl, cleanup := testcluster.SetupMemoryCluster(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	jobID := "testjob"
+	shards := []cluster.ShardRange{
+		{ShardID: 0, IndexFrom: 0, IndexTo: 1000},
+		{ShardID: 1, IndexFrom: 1000, IndexTo: 2000},
+	}
+	require.NoError(t, cl.BulkCreateShards(ctx, jobID, shards))
+
+	count, err := cl.GetShardCount(ctx, jobID)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	require.NoError(t, cl.AssignShard(ctx, jobID, 0, "worker1"))
+	require.Error(t, cl.AssignShard(ctx, jobID, 0, "worker2"), "shard already assigned")
+	require.NoError(t, cl.RenewShardLease(ctx, jobID, 0, "worker1"))
+
+	require.NoError(t, cl.ReportShardDone(ctx, jobID, 0, cluster.ShardManifest{OutputPath: "/tmp/shard0.jsonl"}))
+	stat, err := cl.GetShardStatus(ctx, jobID, 0)
+	require.NoError(t, err)
+	require.True(t, stat.Done)
+	require.Equal(t, "/tmp/shard0.jsonl", stat.OutputPath)
+
+	require.NoError(t, cl.AssignShard(ctx, jobID, 1, "worker2"))
+	for i := 0; i <= cluster.MaxShardRetries; i++ {
+		require.NoError(t, cl.ReportShardFailed(ctx, jobID, 1))
+	}
+	stat, err = cl.GetShardStatus(ctx, jobID, 1)
+	require.NoError(t, err)
+	require.True(t, stat.Failed)
+
+	reset, err := cl.ResetFailedShards(ctx, jobID)
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, reset)
+}
+
+func TestMemoryCluster_WorkersAndSecrets(t *testing.T) {
+	cl, cleanup := testcluster.SetupMemoryCluster(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	workerID, err := cl.RegisterWorker(ctx, cluster.WorkerInfo{Host: "testhost"})
+	require.NoError(t, err)
+	require.NoError(t, cl.HeartbeatWorker(ctx, workerID))
+
+	workers, err := cl.ListWorkers(ctx)
+	require.NoError(t, err)
+	require.Len(t, workers, 1)
+	require.Equal(t, workerID, workers[0].ID)
+
+	key, err := secrets.GenerateClusterKey()
+	require.NoError(t, err)
+	cl.Secrets().SetClusterKey(key)
+	require.NoError(t, cl.Secrets().Set(ctx, "sink/token", []byte("hunter2")))
+	val, err := cl.Secrets().Get(ctx, "sink/token")
+	require.NoError(t, err)
+	require.Equal(t, []byte("hunter2"), val)
+}
+
+func TestMemoryCluster_WorkersCompleteJob(t *testing.T) {
+	ts := testutil.NewStubCTLogServer(t, testutil.CTLogFourEntrySTH, testutil.CTLogFourEntries)
+	defer ts.Close()
+	cl, cleanup := testcluster.SetupMemoryCluster(t)
+	defer cleanup()
+
+	jobID := testcluster.SubmitTestJob(t, cl, ts.URL, 2)
+	logger := testutil.NewTestLogger(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	workers := testworkers.RunWorkers(ctx, t, cl, jobID, 2, logger)
+
+	testutil.WaitFor(t, func() bool {
+		return testcluster.AllShardsDone(t, cl, jobID)
+	}, 60*time.Second, 100*time.Millisecond, "job should complete on the memory backend")
+
+	for _, w := range workers {
+		w.Stop()
+	}
+}
+
+func TestMemoryCluster_SkippedShardDoesNotBlockCompletion(t *testing.T) {
+	ts := testutil.NewStubCTLogServer(t, testutil.CTLogFourEntrySTH, testutil.CTLogFourEntries)
+	defer ts.Close()
+	cl, cleanup := testcluster.SetupMemoryCluster(t)
+	defer cleanup()
+
+	jobID := testcluster.SubmitTestJob(t, cl, ts.URL, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	require.NoError(t, cl.SkipShard(ctx, jobID, 1, "pre-cutover"))
+
+	workers := testworkers.RunWorkers(ctx, t, cl, jobID, 1, testutil.NewTestLogger(true))
+	defer func() {
+		for _, w := range workers {
+			w.Stop()
+		}
+	}()
+
+	testutil.WaitFor(t, func() bool {
+		info, err := cl.GetJob(ctx, jobID)
+		return err == nil && info.Status == cluster.JobStateCompleted
+	}, 30*time.Second, 100*time.Millisecond, "job should complete with a skipped shard")
+
+	processed, err := cl.GetShardStatus(ctx, jobID, 0)
+	require.NoError(t, err)
+	require.True(t, processed.Done)
+	require.False(t, processed.Skipped)
+
+	skipped, err := cl.GetShardStatus(ctx, jobID, 1)
+	require.NoError(t, err)
+	require.True(t, skipped.Skipped)
+	require.Equal(t, "pre-cutover", skipped.SkipReason)
+	require.Empty(t, skipped.OutputPath)
+}
+
+func TestMemoryCluster_WatchJob(t *testing.T) {
+	cl, cleanup := testcluster.SetupMemoryCluster(t)
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	jobID := testcluster.SubmitTestJob(t, cl, "https://watch.example", 2)
+	events, err := cl.WatchJob(ctx, jobID)
+	require.NoError(t, err)
+	next := func() cluster.JobEvent {
+		t.Helper()
+		select {
+		case ev, ok := <-events:
+			require.True(t, ok, "event stream closed early")
+			return ev
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for an event")
+		}
+		return cluster.JobEvent{}
+	}
+
+	ev := next()
+	require.Equal(t, "status", ev.Field)
+	require.Equal(t, cluster.JobStatePending, ev.Status)
+
+	require.NoError(t, cl.AssignShard(ctx, jobID, 1, "w1"))
+	ev = next()
+	require.NotNil(t, ev.ShardID)
+	require.Equal(t, 1, *ev.ShardID)
+	require.Equal(t, "assignment", ev.Field)
+}
+
+// The memory store follows etcd's semantics for what the cluster relies on.
+func TestMemoryCluster_KV(t *testing.T) {
+	cl, cleanup := testcluster.SetupMemoryCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+	kv := cl.Client()
+	p := cl.Prefix() + "/kvtest/"
+
+	for _, k := range []string{"b", "a", "c"} {
+		_, err := kv.Put(ctx, p+k, "v"+k)
+		require.NoError(t, err)
+	}
+	resp, err := kv.Get(ctx, p, clientv3.WithPrefix(), clientv3.WithLimit(2))
+	require.NoError(t, err)
+	require.EqualValues(t, 3, resp.Count)
+	require.True(t, resp.More)
+	require.Len(t, resp.Kvs, 2)
+	require.Equal(t, p+"a", string(resp.Kvs[0].Key))
+	require.Equal(t, p+"b", string(resp.Kvs[1].Key))
+
+	// Revisions and versions
+	a := resp.Kvs[0]
+	put, err := kv.Put(ctx, p+"a", "va2")
+	require.NoError(t, err)
+	got, err := kv.Get(ctx, p+"a")
+	require.NoError(t, err)
+	require.Equal(t, put.Header.Revision, got.Kvs[0].ModRevision)
+	require.Equal(t, a.CreateRevision, got.Kvs[0].CreateRevision)
+	require.EqualValues(t, 2, got.Kvs[0].Version)
+
+	// Transactions
+	txn, err := kv.Txn(ctx).If(
+		clientv3.Compare(clientv3.ModRevision(p+"a"), "=", a.ModRevision),
+	).Then(clientv3.OpPut(p+"a", "stale")).Else(clientv3.OpGet(p+"a")).Commit()
+	require.NoError(t, err)
+	require.False(t, txn.Succeeded)
+	require.Equal(t, "va2", string(txn.Responses[0].GetResponseRange().Kvs[0].Value))
+	txn, err = kv.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(p+"missing"), "=", 0),
+	).Then(clientv3.OpPut(p+"missing", "x"), clientv3.OpDelete(p+"c")).Commit()
+	require.NoError(t, err)
+	require.True(t, txn.Succeeded)
+	_, err = kv.Txn(ctx).Then(clientv3.OpPut(p+"d", "1"), clientv3.OpDelete(p, clientv3.WithPrefix())).Commit()
+	require.ErrorIs(t, err, rpctypes.ErrDuplicateKey)
+
+	// Leases take their keys with them
+	lease, err := kv.Grant(ctx, 1)
+	require.NoError(t, err)
+	_, err = kv.Put(ctx, p+"leased", "x", clientv3.WithLease(lease.ID))
+	require.NoError(t, err)
+	_, err = kv.Put(ctx, p+"nolease", "x", clientv3.WithLease(lease.ID+100))
+	require.ErrorIs(t, err, rpctypes.ErrLeaseNotFound)
+	testutil.WaitFor(t, func() bool {
+		resp, err := kv.Get(ctx, p+"leased")
+		return err == nil && len(resp.Kvs) == 0
+	}, 5*time.Second, 100*time.Millisecond, "leased key should expire")
+	_, err = kv.KeepAliveOnce(ctx, lease.ID)
+	require.ErrorIs(t, err, rpctypes.ErrLeaseNotFound)
+
+	// Watches can start from a past revision
+	start, err := kv.Put(ctx, p+"w", "1")
+	require.NoError(t, err)
+	_, err = kv.Delete(ctx, p+"w")
+	require.NoError(t, err)
+	wctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	wch := kv.Watch(wctx, p+"w", clientv3.WithRev(start.Header.Revision))
+	var evs []*clientv3.Event
+	for len(evs) < 2 {
+		wr, ok := <-wch
+		require.True(t, ok, "watch closed early")
+		require.NoError(t, wr.Err())
+		evs = append(evs, wr.Events...)
+	}
+	require.Equal(t, mvccpb.PUT, evs[0].Type)
+	require.Equal(t, mvccpb.DELETE, evs[1].Type)
+	cancel()
+	for range wch {
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/job"
 	"github.com/chtzvt/certslurp/internal/testcluster"
 	"github.com/chtzvt/certslurp/internal/testutil"
 	"github.com/stretchr/testify/require"
@@ -146,6 +147,51 @@ func TestBulkCreateAndShardAssignmentLifecycle(t *testing.T) {
 	}
 }
 
+func TestShardBackoff(t *testing.T) {
+	require.Equal(t, 30*time.Second, cluster.ShardBackoff(30*time.Second, 1))
+	require.Equal(t, 120*time.Second, cluster.ShardBackoff(30*time.Second, 3))
+	// Large retry counts and bases are capped rather than overflowing
+	for _, retries := range []int{20, 64, 65, 1000} {
+		require.Equal(t, cluster.MaxShardBackoff, cluster.ShardBackoff(30*time.Second, retries), "retries %d", retries)
+	}
+	require.Equal(t, cluster.MaxShardBackoff, cluster.ShardBackoff(time.Duration(1<<62), 1))
+
+	spec := &job.JobSpec{}
+	spec.Options.Fetch.RetryBackoffSecs = 1 << 40
+	_, backoff := cluster.ShardRetryPolicy(spec)
+	require.Equal(t, cluster.MaxShardBackoff, backoff)
+}
+
+func TestReportShardFailed_PerJobRetryPolicy(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	opts := testcluster.DefaultTestJobOptions()
+	opts.Fetch.MaxRetries = cluster.MaxShardRetries + 2
+	opts.Fetch.RetryBackoffSecs = 1
+	jobID := testcluster.SubmitTestJob(t, cl, "http://example.com", 1, opts)
+	maxRetries := opts.Fetch.MaxRetries
+
+	require.NoError(t, cl.AssignShard(ctx, jobID, 0, "worker1"))
+	for i := 0; i < maxRetries; i++ {
+		require.NoError(t, cl.ReportShardFailed(ctx, jobID, 0))
+		s, err := cl.GetShardStatus(ctx, jobID, 0)
+		require.NoError(t, err)
+		require.Equal(t, i+1, s.Retries)
+		require.False(t, s.Failed, "shard should survive failure %d of %d", i+1, maxRetries)
+		require.False(t, s.Done)
+		// Backoff is derived from the job's base, not the 30s default
+		require.WithinDuration(t, time.Now().Add(time.Duration(1<<uint(i))*time.Second), s.BackoffUntil, 2*time.Second)
+	}
+
+	require.NoError(t, cl.ReportShardFailed(ctx, jobID, 0))
+	s, err := cl.GetShardStatus(ctx, jobID, 0)
+	require.NoError(t, err)
+	require.True(t, s.Failed, "should be permanently failed after the job's max retries")
+	require.True(t, s.Done)
+}
+
 func TestRequestShardSplit(t *testing.T) {
 	cl, cleanup := testcluster.SetupEtcdCluster(t)
 	defer cleanup()
@@ -334,6 +380,65 @@ func TestRenewShardLease(t *testing.T) {
 	require.Contains(t, err.Error(), "assignment not found", "should fail to renew if not assigned")
 }
 
+func TestUpdateShardProgress(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+	jobID := "progressjob"
+
+	shards := []cluster.ShardRange{{ShardID: 0, IndexFrom: 100, IndexTo: 200}, {ShardID: 1, IndexFrom: 200, IndexTo: 300}}
+	require.NoError(t, cl.BulkCreateShards(ctx, jobID, shards))
+	require.NoError(t, cl.AssignShard(ctx, jobID, 0, "w1"))
+	require.NoError(t, cl.AssignShard(ctx, jobID, 1, "w1"))
+
+	// No progress until the worker checkpoints
+	stat, err := cl.GetShardStatus(ctx, jobID, 0)
+	require.NoError(t, err)
+	require.Nil(t, stat.LastIndex)
+	require.Nil(t, stat.Checkpoint)
+
+	cp := cluster.ShardCheckpoint{LastIndex: 149, Chunks: 3, Records: 50, Bytes: 4096}
+	require.NoError(t, cl.UpdateShardProgress(ctx, jobID, 0, "w1", cp))
+	require.NoError(t, cl.UpdateShardProgress(ctx, jobID, 1, "w1", cluster.ShardCheckpoint{LastIndex: 210}))
+	stat, err = cl.GetShardStatus(ctx, jobID, 0)
+	require.NoError(t, err)
+	require.NotNil(t, stat.LastIndex)
+	require.Equal(t, int64(149), *stat.LastIndex)
+	require.Equal(t, &cp, stat.Checkpoint)
+
+	assignments, err := cl.GetShardAssignments(ctx, jobID)
+	require.NoError(t, err)
+	require.NotNil(t, assignments[1].LastIndex)
+	require.Equal(t, int64(210), *assignments[1].LastIndex)
+	window, err := cl.GetShardAssignmentsWindow(ctx, jobID, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(149), *window[0].LastIndex)
+
+	// Only the lease holder can checkpoint
+	require.ErrorContains(t, cl.UpdateShardProgress(ctx, jobID, 0, "w2", cluster.ShardCheckpoint{LastIndex: 199}), "does not own")
+
+	// Finishing the shard clears its checkpoint, and late ones are refused
+	require.NoError(t, cl.ReportShardDone(ctx, jobID, 0, cluster.ShardManifest{}))
+	require.Error(t, cl.UpdateShardProgress(ctx, jobID, 0, "w1", cluster.ShardCheckpoint{LastIndex: 199}))
+	stat, err = cl.GetShardStatus(ctx, jobID, 0)
+	require.NoError(t, err)
+	require.True(t, stat.Done)
+	require.Nil(t, stat.LastIndex)
+
+	// Releasing the shard keeps it, for the next worker to resume from
+	require.NoError(t, cl.ReleaseShardLease(ctx, jobID, 1, "w1"))
+	stat, err = cl.GetShardStatus(ctx, jobID, 1)
+	require.NoError(t, err)
+	require.NotNil(t, stat.Checkpoint)
+	require.Equal(t, int64(210), stat.Checkpoint.LastIndex)
+
+	// Resetting the shard starts it over
+	require.NoError(t, cl.ResetFailedShard(ctx, jobID, 1))
+	stat, err = cl.GetShardStatus(ctx, jobID, 1)
+	require.NoError(t, err)
+	require.Nil(t, stat.Checkpoint)
+}
+
 func TestResetFailedShard(t *testing.T) {
 	cl, cleanup := testcluster.SetupEtcdCluster(t)
 	defer cleanup()
@@ -411,6 +516,79 @@ func TestResetFailedShards(t *testing.T) {
 	require.False(t, stat.Assigned)
 }
 
+func TestSkipShard(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	jobID := "skipshard"
+	shards := []cluster.ShardRange{
+		{ShardID: 0, IndexFrom: 0, IndexTo: 100},
+		{ShardID: 1, IndexFrom: 100, IndexTo: 200},
+		{ShardID: 2, IndexFrom: 200, IndexTo: 300},
+	}
+	require.NoError(t, cl.BulkCreateShards(ctx, jobID, shards))
+
+	require.NoError(t, cl.SkipShard(ctx, jobID, 0, "pre-cutover"))
+	stat, err := cl.GetShardStatus(ctx, jobID, 0)
+	require.NoError(t, err)
+	require.True(t, stat.Done)
+	require.True(t, stat.Skipped)
+	require.False(t, stat.Failed)
+	require.Equal(t, "pre-cutover", stat.SkipReason)
+
+	// Skipped shards are never claimed
+	require.Error(t, cl.AssignShard(ctx, jobID, 0, "w"))
+
+	// A completed shard can't be skipped, nor can one that doesn't exist
+	require.NoError(t, cl.AssignShard(ctx, jobID, 1, "w"))
+	require.NoError(t, cl.ReportShardDone(ctx, jobID, 1, cluster.ShardManifest{OutputPath: "out"}))
+	require.ErrorContains(t, cl.SkipShard(ctx, jobID, 1, ""), "already completed")
+	require.ErrorContains(t, cl.SkipShard(ctx, jobID, 99, ""), "not found")
+
+	// A shard a worker is processing can't be skipped out from under it
+	require.NoError(t, cl.AssignShard(ctx, jobID, 2, "w"))
+	require.ErrorContains(t, cl.SkipShard(ctx, jobID, 2, ""), "assigned to worker w")
+	require.NoError(t, cl.ReleaseShardLease(ctx, jobID, 2, "w"))
+
+	// Skipping is idempotent and doesn't disturb the reason
+	require.NoError(t, cl.SkipShard(ctx, jobID, 0, "again"))
+	stat, err = cl.GetShardStatus(ctx, jobID, 0)
+	require.NoError(t, err)
+	require.Equal(t, "pre-cutover", stat.SkipReason)
+
+	// Skipped shards are reported separately and aren't reset as failures
+	assignments, err := cl.GetShardAssignments(ctx, jobID)
+	require.NoError(t, err)
+	require.True(t, assignments[0].Skipped)
+	require.False(t, assignments[1].Skipped)
+	sum := cluster.SummarizeShards(assignments, time.Now())
+	require.Equal(t, cluster.ShardSummary{Total: 3, Done: 1, Skipped: 1, Pending: 1}, sum)
+
+	reset, err := cl.ResetFailedShards(ctx, jobID)
+	require.NoError(t, err)
+	require.Empty(t, reset)
+}
+
+func TestSkipShard_PermanentlyFailed(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	jobID := "skipfailed"
+	require.NoError(t, cl.BulkCreateShards(ctx, jobID, []cluster.ShardRange{{ShardID: 0, IndexFrom: 0, IndexTo: 100}}))
+	require.NoError(t, cl.AssignShard(ctx, jobID, 0, "w"))
+	for i := 0; i < cluster.MaxShardRetries+1; i++ {
+		require.NoError(t, cl.ReportShardFailed(ctx, jobID, 0))
+	}
+
+	require.NoError(t, cl.SkipShard(ctx, jobID, 0, "log entries unrecoverable"))
+	stat, err := cl.GetShardStatus(ctx, jobID, 0)
+	require.NoError(t, err)
+	require.True(t, stat.Skipped)
+	require.False(t, stat.Failed)
+}
+
 func TestReleaseShardLease(t *testing.T) {
 	cl, cleanup := testcluster.SetupEtcdCluster(t)
 	defer cleanup()
@@ -445,3 +623,110 @@ func TestReleaseShardLease(t *testing.T) {
 	// Already unassigned: should be idempotent/no error
 	require.NoError(t, cl.ReleaseShardLease(ctx, jobID, 0, workerID))
 }
+
+func TestGetJobProgress(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// More shards than fit in one window, so the scan has to page
+	jobID := testcluster.SubmitTestJob(t, cl, "http://example.com", 1200)
+
+	for _, id := range []int{0, 1, 1100} {
+		require.NoError(t, cl.ReportShardDone(ctx, jobID, id, cluster.ShardManifest{}))
+	}
+	require.NoError(t, cl.SkipShard(ctx, jobID, 2, "pre-cutover"))
+
+	require.NoError(t, cl.AssignShard(ctx, jobID, 1150, "w1"))
+	require.NoError(t, cl.UpdateShardProgress(ctx, jobID, 1150, "w1", cluster.ShardCheckpoint{LastIndex: 115049}))
+
+	require.NoError(t, cl.AssignShard(ctx, jobID, 3, "w1"))
+	require.NoError(t, cl.ReportShardFailed(ctx, jobID, 3))
+
+	for i := 0; i < 64; i++ {
+		require.NoError(t, cl.ReportShardFailed(ctx, jobID, 4))
+		s, err := cl.GetShardStatus(ctx, jobID, 4)
+		require.NoError(t, err)
+		if s.Failed {
+			break
+		}
+	}
+
+	p, err := cl.GetJobProgress(ctx, jobID)
+	require.NoError(t, err)
+	require.Equal(t, 1200, p.Shards)
+	require.Equal(t, 3, p.Done)
+	require.Equal(t, 1, p.Skipped)
+	require.Equal(t, 1, p.Failed)
+	require.Equal(t, 1, p.Assigned)
+	require.Equal(t, 1, p.Backoff)
+	require.Equal(t, 1200-7, p.Pending)
+	require.Equal(t, int64(120000), p.IndexTotal)
+	require.Equal(t, int64(3*100+50), p.IndexProcessed)
+
+	_, err = cl.GetJobProgress(ctx, "nosuchjob")
+	require.Error(t, err)
+}
+
+func TestSetShardPreferredWorker(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	jobID := "preferred"
+	require.NoError(t, cl.BulkCreateShards(ctx, jobID, []cluster.ShardRange{{ShardID: 0, IndexFrom: 0, IndexTo: 100}}))
+
+	before := time.Now()
+	require.NoError(t, cl.SetShardPreferredWorker(ctx, jobID, 0, "w1", time.Minute))
+	window, err := cl.GetShardAssignmentsWindow(ctx, jobID, 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, "w1", window[0].PreferredWorker)
+	require.WithinDuration(t, before.Add(time.Minute), window[0].PreferredUntil, 5*time.Second)
+
+	// Clearing the hint removes it
+	require.NoError(t, cl.SetShardPreferredWorker(ctx, jobID, 0, "", 0))
+	window, err = cl.GetShardAssignmentsWindow(ctx, jobID, 0, 1)
+	require.NoError(t, err)
+	require.Empty(t, window[0].PreferredWorker)
+	require.True(t, window[0].PreferredUntil.IsZero())
+
+	require.ErrorContains(t, cl.SetShardPreferredWorker(ctx, jobID, 99, "w1", time.Minute), "not found")
+	require.Error(t, cl.SetShardPreferredWorker(ctx, jobID, 0, "w1", -time.Second))
+}
+
+func TestListPreferredShards(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	jobID := "preferred"
+	require.NoError(t, cl.BulkCreateShards(ctx, jobID, []cluster.ShardRange{
+		{ShardID: 0, IndexFrom: 0, IndexTo: 100},
+		{ShardID: 1, IndexFrom: 100, IndexTo: 200},
+		{ShardID: 2, IndexFrom: 200, IndexTo: 300},
+	}))
+	require.NoError(t, cl.SetShardPreferredWorker(ctx, jobID, 0, "w1", time.Minute))
+	require.NoError(t, cl.SetShardPreferredWorker(ctx, jobID, 2, "w1", time.Minute))
+	require.NoError(t, cl.SetShardPreferredWorker(ctx, jobID, 1, "w2", time.Minute))
+
+	shards, err := cl.ListPreferredShards(ctx, "w1")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int{0, 2}, shards[jobID])
+
+	// Moving or clearing a hint takes it off the old worker's list
+	require.NoError(t, cl.SetShardPreferredWorker(ctx, jobID, 2, "w2", time.Minute))
+	require.NoError(t, cl.SetShardPreferredWorker(ctx, jobID, 1, "", 0))
+	shards, err = cl.ListPreferredShards(ctx, "w1")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]int{jobID: {0}}, shards)
+	shards, err = cl.ListPreferredShards(ctx, "w2")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]int{jobID: {2}}, shards)
+
+	// Hints drop off once their grace period is over
+	require.NoError(t, cl.SetShardPreferredWorker(ctx, jobID, 0, "w3", time.Second))
+	require.Eventually(t, func() bool {
+		shards, err := cl.ListPreferredShards(ctx, "w3")
+		return err == nil && len(shards) == 0
+	}, 10*time.Second, 200*time.Millisecond)
+}
@@ -2,8 +2,11 @@ package cluster_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,6 +15,7 @@ import (
 	"github.com/chtzvt/certslurp/internal/testutil"
 	"github.com/chtzvt/certslurp/internal/worker"
 	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
 func TestWorkerLifecycle(t *testing.T) {
@@ -73,6 +77,72 @@ func TestCluster_RapidWorkerChurn(t *testing.T) {
 	persistCancel()
 }
 
+func TestAssignShard_WorkerCapacity(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	jobID := testcluster.SubmitTestJob(t, cl, "http://example.com", 4)
+	busy, err := cl.RegisterWorker(ctx, cluster.WorkerInfo{Host: "busy", Capacity: 2})
+	require.NoError(t, err)
+	other, err := cl.RegisterWorker(ctx, cluster.WorkerInfo{Host: "other"})
+	require.NoError(t, err)
+
+	require.NoError(t, cl.AssignShard(ctx, jobID, 0, busy))
+	require.NoError(t, cl.AssignShard(ctx, jobID, 1, busy))
+	err = cl.AssignShard(ctx, jobID, 2, busy)
+	require.ErrorIs(t, err, cluster.ErrWorkerAtCapacity)
+	stat, err := cl.GetShardStatus(ctx, jobID, 2)
+	require.NoError(t, err)
+	require.False(t, stat.Assigned, "refused shard must stay claimable")
+
+	// Other workers aren't held back, and an unlimited one takes the rest
+	require.NoError(t, cl.AssignShard(ctx, jobID, 2, other))
+
+	// Finishing a shard frees a slot
+	require.NoError(t, cl.ReportShardDone(ctx, jobID, 0, cluster.ShardManifest{}))
+	require.NoError(t, cl.AssignShard(ctx, jobID, 3, busy))
+	require.ErrorIs(t, cl.AssignShard(ctx, jobID, 2, busy), cluster.ErrWorkerAtCapacity)
+
+	// So do failures and released leases
+	require.NoError(t, cl.ReportShardFailed(ctx, jobID, 1))
+	require.NoError(t, cl.ReleaseShardLease(ctx, jobID, 2, other))
+	require.NoError(t, cl.AssignShard(ctx, jobID, 2, busy))
+}
+
+// A worker claiming several shards at once only races itself for its
+// capacity, so every claim within it succeeds
+func TestAssignShard_WorkerCapacityConcurrentClaims(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	jobID := testcluster.SubmitTestJob(t, cl, "http://example.com", 6)
+	workerID, err := cl.RegisterWorker(ctx, cluster.WorkerInfo{Host: "busy", Capacity: 4})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var assigned, atCapacity atomic.Int32
+	for shardID := 0; shardID < 6; shardID++ {
+		wg.Add(1)
+		go func(shardID int) {
+			defer wg.Done()
+			err := cl.AssignShard(ctx, jobID, shardID, workerID)
+			switch {
+			case err == nil:
+				assigned.Add(1)
+			case errors.Is(err, cluster.ErrWorkerAtCapacity):
+				atCapacity.Add(1)
+			default:
+				t.Errorf("shard %d: %v", shardID, err)
+			}
+		}(shardID)
+	}
+	wg.Wait()
+	require.Equal(t, int32(4), assigned.Load())
+	require.Equal(t, int32(2), atCapacity.Load())
+}
+
 func TestSendMetrics(t *testing.T) {
 	cl, cleanup := testcluster.SetupEtcdCluster(t)
 	defer cleanup()
@@ -141,3 +211,176 @@ func TestGetWorkerMetrics(t *testing.T) {
 	require.GreaterOrEqual(t, vm.ProcessingTimeNs, int64(42*time.Second))
 	require.False(t, vm.LastUpdated.IsZero())
 }
+
+func TestRegisterWorker_DuplicateLiveIDRejected(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	workerID, err := cl.RegisterWorker(ctx, cluster.WorkerInfo{ID: "stable-1", Host: "host-a"})
+	require.NoError(t, err)
+	require.Equal(t, "stable-1", workerID)
+
+	// A second process with the same stable ID must not take over the live registration.
+	_, err = cl.RegisterWorker(ctx, cluster.WorkerInfo{ID: "stable-1", Host: "host-b"})
+	require.ErrorIs(t, err, cluster.ErrWorkerIDInUse)
+
+	workers, err := cl.ListWorkers(ctx)
+	require.NoError(t, err)
+	require.Len(t, workers, 1)
+	require.Equal(t, "host-a", workers[0].Host)
+
+	// Once the previous registration goes stale (e.g. after a crash), the ID can be reused.
+	stale := time.Now().Add(-2 * cluster.WorkerLiveWindow).UTC().Format(time.RFC3339Nano)
+	_, err = cl.Client().Put(ctx, cl.Prefix()+"/workers/stable-1/last_seen", stale)
+	require.NoError(t, err)
+
+	_, err = cl.RegisterWorker(ctx, cluster.WorkerInfo{ID: "stable-1", Host: "host-b"})
+	require.NoError(t, err)
+}
+
+func TestUnregisterWorker_FreesIDForReuse(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	_, err := cl.RegisterWorker(ctx, cluster.WorkerInfo{ID: "stable-1", Host: "host-a", Capacity: 1})
+	require.NoError(t, err)
+	jobID := testcluster.SubmitTestJob(t, cl, "https://ct.example.com/log", 1)
+	require.NoError(t, cl.AssignShard(ctx, jobID, 0, "stable-1"))
+
+	require.NoError(t, cl.UnregisterWorker(ctx, "stable-1"))
+	workers, err := cl.ListWorkers(ctx)
+	require.NoError(t, err)
+	require.Empty(t, workers)
+
+	// A restart under the same ID is let in at once, without its old claims
+	_, err = cl.RegisterWorker(ctx, cluster.WorkerInfo{ID: "stable-1", Host: "host-a", Capacity: 1})
+	require.NoError(t, err)
+	resp, err := cl.Client().Get(ctx, cl.Prefix()+"/workers/stable-1/claims/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+	require.NoError(t, err)
+	require.Zero(t, resp.Count)
+
+	// Unregistering an unknown worker is a no-op
+	require.NoError(t, cl.UnregisterWorker(ctx, "never-registered"))
+}
+
+func TestWorkerStop_Unregisters(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	w := worker.NewWorker(cl, "restarting-1", testutil.NewTestLogger(true))
+	w.DisableJitterAndSmoothingForTests = true
+	w.PollPeriod = 50 * time.Millisecond
+	go func() { _ = w.Run(ctx) }()
+	testutil.WaitFor(t, func() bool {
+		workers, err := cl.ListWorkers(ctx)
+		return err == nil && len(workers) == 1
+	}, 10*time.Second, 50*time.Millisecond, "worker should register")
+
+	w.Stop()
+
+	_, err := cl.RegisterWorker(ctx, cluster.WorkerInfo{ID: "restarting-1", Host: "testhost"})
+	require.NoError(t, err, "a stopped worker's ID should be free to register again")
+}
+
+func TestHeartbeatWorker_ReportsActivity(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	workerID, err := cl.RegisterWorker(ctx, cluster.WorkerInfo{Host: "testhost", LogEndpoint: "http://testhost:9090/logs"})
+	require.NoError(t, err)
+
+	started := time.Now().UTC().Truncate(time.Second)
+	activity := cluster.ShardActivity{JobID: "job1", ShardID: 3, IndexFrom: 100, IndexTo: 200, Processed: 42, StartedAt: started}
+	require.NoError(t, cl.HeartbeatWorker(ctx, workerID, activity))
+
+	workers, err := cl.ListWorkers(ctx)
+	require.NoError(t, err)
+	require.Len(t, workers, 1)
+	require.Equal(t, []cluster.ShardActivity{activity}, workers[0].Activity)
+	// The rest of the registration survives the rewrite
+	require.Equal(t, "testhost", workers[0].Host)
+	require.Equal(t, "http://testhost:9090/logs", workers[0].LogEndpoint)
+
+	// A later heartbeat replaces the activity, and an empty one marks the worker idle
+	activity.Processed = 99
+	require.NoError(t, cl.HeartbeatWorker(ctx, workerID, activity))
+	workers, err = cl.ListWorkers(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 99, workers[0].Activity[0].Processed)
+
+	require.NoError(t, cl.HeartbeatWorker(ctx, workerID))
+	workers, err = cl.ListWorkers(ctx)
+	require.NoError(t, err)
+	require.Empty(t, workers[0].Activity)
+}
+
+func TestWorkerMetrics_CompactEncoding(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t, func(cfg *cluster.EtcdConfig) {
+		cfg.MetricsEncoding = cluster.MetricsEncodingCBOR
+	})
+	defer cleanup()
+	ctx := context.Background()
+
+	workerID, err := cl.RegisterWorker(ctx, cluster.WorkerInfo{Host: "compact-host"})
+	require.NoError(t, err)
+	started := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	activity := cluster.ShardActivity{JobID: "job1", ShardID: 3, IndexFrom: 100, IndexTo: 200, Processed: 42, StartedAt: started}
+	require.NoError(t, cl.HeartbeatWorker(ctx, workerID, activity))
+
+	metrics := &cluster.WorkerMetrics{}
+	metrics.IncProcessed()
+	metrics.IncProcessed()
+	metrics.IncFailed()
+	metrics.AddProcessingTime(42 * time.Second)
+	atomic.AddInt64(&metrics.ActiveUploads, 3)
+	before := time.Now()
+	require.NoError(t, cl.SendMetrics(ctx, workerID, metrics))
+
+	// Metrics are stored as one CBOR record rather than a key per counter
+	base := cl.Prefix() + "/workers/" + workerID
+	resp, err := cl.Client().Get(ctx, base+"/shards_processed")
+	require.NoError(t, err)
+	require.Empty(t, resp.Kvs)
+	resp, err = cl.Client().Get(ctx, base)
+	require.NoError(t, err)
+	require.NotEqual(t, byte('{'), resp.Kvs[0].Value[0], "worker record should not be JSON")
+
+	// A head reading with the default encoding decodes both transparently
+	reader, err := cluster.NewEtcdCluster(cluster.EtcdConfig{
+		Endpoints:    cl.Client().Endpoints(),
+		DialTimeout:  2 * time.Second,
+		KeychainFile: t.TempDir() + "/keychain",
+		Prefix:       cl.Prefix(),
+	})
+	require.NoError(t, err)
+	defer reader.Close()
+	for _, c := range []cluster.Cluster{cl, reader} {
+		vm, err := c.GetWorkerMetrics(ctx, workerID)
+		require.NoError(t, err)
+		require.Equal(t, workerID, vm.WorkerID)
+		require.EqualValues(t, 2, vm.ShardsProcessed)
+		require.EqualValues(t, 1, vm.ShardsFailed)
+		require.EqualValues(t, 42*time.Second, vm.ProcessingTimeNs)
+		require.EqualValues(t, 3, vm.ActiveUploads)
+		require.False(t, vm.LastUpdated.Before(before.Truncate(time.Second)))
+
+		workers, err := c.ListWorkers(ctx)
+		require.NoError(t, err)
+		require.Len(t, workers, 1)
+		require.Equal(t, "compact-host", workers[0].Host)
+		require.Len(t, workers[0].Activity, 1)
+		got := workers[0].Activity[0]
+		require.True(t, got.StartedAt.Equal(started))
+		got.StartedAt = started
+		require.Equal(t, activity, got)
+	}
+}
+
+func TestNewEtcdCluster_UnknownMetricsEncoding(t *testing.T) {
+	_, err := cluster.NewEtcdCluster(cluster.EtcdConfig{MetricsEncoding: "msgpack"})
+	require.ErrorContains(t, err, "msgpack")
+}
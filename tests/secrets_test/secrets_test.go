@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -326,3 +327,306 @@ func TestEncryptValue_DifferentCiphertexts(t *testing.T) {
 	c2 := secrets.EncryptValue(key, val)
 	assert.NotEqual(t, c1, c2, "nonce should make ciphertexts different each time")
 }
+
+func TestSecretVersions(t *testing.T) {
+	cluster, cleanup := testcluster.SetupEtcdCluster(t)
+	t.Cleanup(cleanup)
+	tempDir, cleanup2 := testutil.SetupTempDir(t)
+	t.Cleanup(cleanup2)
+	ctx := context.TODO()
+
+	store, err := secrets.NewStore(cluster.Client(), tempDir+"/node_key", cluster.Prefix())
+	require.NoError(t, err)
+	clusterKey, err := secrets.GenerateClusterKey()
+	require.NoError(t, err)
+	store.SetClusterKey(clusterKey)
+
+	for _, v := range []string{"one", "two", "three"} {
+		require.NoError(t, store.Set(ctx, "api/token", []byte(v)))
+	}
+	versions, err := store.ListVersions(ctx, "api/token")
+	require.NoError(t, err)
+	require.Equal(t, []secrets.SecretVersion{{Version: 1}, {Version: 2}, {Version: 3, Current: true}}, versions)
+	got, err := store.GetVersion(ctx, "api/token", 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("one"), got)
+	_, err = store.GetVersion(ctx, "api/token", 4)
+	require.Error(t, err)
+
+	// Rolling back changes what Get returns, and the next Set adds a new
+	// version after the highest
+	require.NoError(t, store.Rollback(ctx, "api/token", 1))
+	got, err = store.Get(ctx, "api/token")
+	require.NoError(t, err)
+	require.Equal(t, []byte("one"), got)
+	require.Error(t, store.Rollback(ctx, "api/token", 7))
+	require.NoError(t, store.Set(ctx, "api/token", []byte("four")))
+	versions, err = store.ListVersions(ctx, "api/token")
+	require.NoError(t, err)
+	require.Len(t, versions, 4)
+	require.Equal(t, secrets.SecretVersion{Version: 4, Current: true}, versions[3])
+	require.False(t, versions[0].Current)
+
+	// A key that looks like a version of another is its own secret
+	require.NoError(t, store.Set(ctx, "api/token/v1", []byte("other")))
+	versions, err = store.ListVersions(ctx, "api/token")
+	require.NoError(t, err)
+	require.Len(t, versions, 4)
+
+	// A value stored before versioning becomes version 1 when replaced
+	_, err = store.Client().Put(ctx, store.Prefix()+"/secrets/store/legacy", base64.StdEncoding.EncodeToString(secrets.EncryptValue(clusterKey, []byte("old"))))
+	require.NoError(t, err)
+	versions, err = store.ListVersions(ctx, "legacy")
+	require.NoError(t, err)
+	require.Empty(t, versions)
+	require.NoError(t, store.Set(ctx, "legacy", []byte("new")))
+	got, err = store.GetVersion(ctx, "legacy", 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("old"), got)
+
+	// Deleting a secret removes its history too
+	require.NoError(t, store.Delete(ctx, "api/token"))
+	versions, err = store.ListVersions(ctx, "api/token")
+	require.NoError(t, err)
+	require.Empty(t, versions)
+	got, err = store.Get(ctx, "api/token/v1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("other"), got)
+}
+
+func TestRotateClusterKey(t *testing.T) {
+	cluster, cleanup := testcluster.SetupEtcdCluster(t)
+	t.Cleanup(cleanup)
+	tempDir, cleanup2 := testutil.SetupTempDir(t)
+	t.Cleanup(cleanup2)
+	ctx := context.Background()
+
+	admin, err := secrets.NewStore(cluster.Client(), tempDir+"/admin_key", cluster.Prefix())
+	require.NoError(t, err)
+	oldKey, err := secrets.GenerateClusterKey()
+	require.NoError(t, err)
+	admin.SetClusterKey(oldKey)
+
+	values := map[string][]byte{
+		"s3/access_key": []byte("AKIA..."),
+		"s3/secret_key": []byte("topsecret"),
+		"webhook/token": []byte("abc123"),
+	}
+	for k, v := range values {
+		require.NoError(t, admin.Set(ctx, k, v))
+	}
+
+	// A node approved through ApproveNode, and one approved before public
+	// keys were kept
+	node, err := secrets.NewStore(cluster.Client(), tempDir+"/node_key", cluster.Prefix())
+	require.NoError(t, err)
+	nodePub := node.PublicKey()
+	_, err = cluster.Client().Put(ctx, cluster.Prefix()+"/registration/pending/"+node.NodeId(), base64.StdEncoding.EncodeToString(nodePub[:]))
+	require.NoError(t, err)
+	require.NoError(t, admin.ApproveNode(ctx, node.NodeId()))
+	_, err = cluster.Client().Put(ctx, cluster.Prefix()+"/secrets/keys/legacy", "c2VhbGVk")
+	require.NoError(t, err)
+
+	newKey, err := secrets.GenerateClusterKey()
+	require.NoError(t, err)
+	result, err := admin.RotateClusterKey(ctx, newKey)
+	require.NoError(t, err)
+	require.Equal(t, len(values), result.Secrets)
+	require.Equal(t, len(values), result.Versions)
+	require.Equal(t, []string{node.NodeId()}, result.Resealed)
+	require.Equal(t, []string{"legacy"}, result.Dropped)
+
+	// The old key no longer decrypts anything; the new one decrypts it all
+	stale, err := secrets.NewStore(cluster.Client(), tempDir+"/stale_key", cluster.Prefix())
+	require.NoError(t, err)
+	stale.SetClusterKey(oldKey)
+	for k, v := range values {
+		_, err := stale.Get(ctx, k)
+		require.Error(t, err, "old key should not decrypt %q", k)
+		got, err := admin.Get(ctx, k)
+		require.NoError(t, err)
+		require.Equal(t, v, got)
+	}
+
+	// The approved node picks up the new key when it next starts
+	require.NoError(t, node.RegisterAndWaitForClusterKey(ctx))
+	got, err := node.Get(ctx, "webhook/token")
+	require.NoError(t, err)
+	require.Equal(t, values["webhook/token"], got)
+	resp, err := cluster.Client().Get(ctx, cluster.Prefix()+"/secrets/keys/legacy")
+	require.NoError(t, err)
+	require.Empty(t, resp.Kvs)
+
+	// Secrets already under the new key are skipped, so a rotation that was
+	// interrupted can be run again
+	_, err = admin.RotateClusterKey(ctx, newKey)
+	require.Error(t, err, "rotating to the current key should fail")
+	third, err := secrets.GenerateClusterKey()
+	require.NoError(t, err)
+	require.NoError(t, admin.SetSealed(ctx, "late", secrets.EncryptValue(third, []byte("late"))))
+	result, err = admin.RotateClusterKey(ctx, third)
+	require.NoError(t, err)
+	require.Equal(t, len(values), result.Secrets)
+	got, err = admin.Get(ctx, "late")
+	require.NoError(t, err)
+	require.Equal(t, []byte("late"), got)
+}
+
+func TestRotateClusterKey_ConcurrentUse(t *testing.T) {
+	cluster, cleanup := testcluster.SetupEtcdCluster(t)
+	t.Cleanup(cleanup)
+	tempDir, cleanup2 := testutil.SetupTempDir(t)
+	t.Cleanup(cleanup2)
+	ctx := context.Background()
+
+	admin, err := secrets.NewStore(cluster.Client(), tempDir+"/admin_key", cluster.Prefix())
+	require.NoError(t, err)
+	oldKey, err := secrets.GenerateClusterKey()
+	require.NoError(t, err)
+	admin.SetClusterKey(oldKey)
+	cached := admin.WithCache(nil)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, admin.Set(ctx, fmt.Sprintf("secret/%d", i), []byte("v")))
+	}
+
+	// Writes and reads carry on through the store and a copy of it while
+	// the key is rotated
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w, store := range []*secrets.Store{admin, cached} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := fmt.Sprintf("secret/%d", (w*7+i)%20)
+				assert.NoError(t, store.Set(ctx, key, []byte("v")))
+				_, err := store.Get(ctx, key)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	newKey, err := secrets.GenerateClusterKey()
+	require.NoError(t, err)
+	_, err = admin.RotateClusterKey(ctx, newKey)
+	close(stop)
+	wg.Wait()
+	require.NoError(t, err)
+
+	// Nothing was left under the old key, so the next rotation goes through
+	third, err := secrets.GenerateClusterKey()
+	require.NoError(t, err)
+	_, err = cached.RotateClusterKey(ctx, third)
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		got, err := admin.Get(ctx, fmt.Sprintf("secret/%d", i))
+		require.NoError(t, err)
+		require.Equal(t, []byte("v"), got)
+	}
+}
+
+func TestDenyAndRevokeNode(t *testing.T) {
+	cluster, cleanup := testcluster.SetupEtcdCluster(t)
+	t.Cleanup(cleanup)
+	tempDir, cleanup2 := testutil.SetupTempDir(t)
+	t.Cleanup(cleanup2)
+	ctx := context.Background()
+
+	admin, err := secrets.NewStore(cluster.Client(), tempDir+"/admin_key", cluster.Prefix())
+	require.NoError(t, err)
+	clusterKey, err := secrets.GenerateClusterKey()
+	require.NoError(t, err)
+	admin.SetClusterKey(clusterKey)
+	node, err := secrets.NewStore(cluster.Client(), tempDir+"/node_key", cluster.Prefix())
+	require.NoError(t, err)
+
+	isPending := func() bool {
+		pending, err := admin.ListPendingRegistrations(ctx)
+		require.NoError(t, err)
+		for _, reg := range pending {
+			if reg.NodeID == node.NodeId() {
+				return true
+			}
+		}
+		return false
+	}
+	register := func(wait time.Duration) error {
+		regCtx, cancel := context.WithTimeout(ctx, wait)
+		defer cancel()
+		return node.RegisterAndWaitForClusterKey(regCtx)
+	}
+
+	// Denying removes the pending registration
+	require.Error(t, register(200*time.Millisecond))
+	require.True(t, isPending())
+	require.NoError(t, admin.DenyNode(ctx, node.NodeId()))
+	require.False(t, isPending())
+	require.Error(t, admin.DenyNode(ctx, node.NodeId()), "nothing left to deny")
+	require.Error(t, admin.ApproveNode(ctx, node.NodeId()), "a denied node can't be approved")
+
+	// Once approved, the node gets the key when it starts
+	require.Error(t, register(200*time.Millisecond))
+	require.NoError(t, admin.ApproveNode(ctx, node.NodeId()))
+	require.NoError(t, register(5*time.Second))
+
+	// Revoking removes the sealed key, so when the node restarts it's
+	// pending again rather than approved
+	require.NoError(t, admin.RevokeNode(ctx, node.NodeId()))
+	resp, err := cluster.Client().Get(ctx, cluster.Prefix()+"/secrets/keys/"+node.NodeId())
+	require.NoError(t, err)
+	require.Empty(t, resp.Kvs)
+	require.Error(t, admin.RevokeNode(ctx, node.NodeId()), "nothing left to revoke")
+
+	restarted, err := secrets.NewStore(cluster.Client(), tempDir+"/node_key", cluster.Prefix())
+	require.NoError(t, err)
+	regCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	require.Error(t, restarted.RegisterAndWaitForClusterKey(regCtx))
+	require.False(t, restarted.HasClusterKey())
+	require.True(t, isPending())
+
+	// A revoked node isn't given the key on rotation
+	newKey, err := secrets.GenerateClusterKey()
+	require.NoError(t, err)
+	result, err := admin.RotateClusterKey(ctx, newKey)
+	require.NoError(t, err)
+	require.Empty(t, result.Resealed)
+}
+
+func TestAuditRetentionAndLimit(t *testing.T) {
+	store := SetupTestStore(t)
+	ctx := context.Background()
+	store.AuditRetention = time.Hour
+
+	old := time.Now().Add(-2 * time.Hour)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.RecordAudit(ctx, secrets.AuditEntry{Time: old, Operation: secrets.AuditGet, Key: "old"}))
+	}
+	// More entries than ListAudit reads at a time, only some of them for
+	// the key asked for
+	for i := 0; i < 1200; i++ {
+		key := "other"
+		if i%2 == 0 {
+			key = "wanted"
+		}
+		require.NoError(t, store.RecordAudit(ctx, secrets.AuditEntry{Operation: secrets.AuditSet, Key: key, Version: i}))
+	}
+
+	entries, err := store.ListAudit(ctx, "old", time.Time{}, 0)
+	require.NoError(t, err)
+	require.Empty(t, entries, "entries past the retention period should be gone")
+
+	entries, err = store.ListAudit(ctx, "wanted", time.Time{}, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 600)
+	entries, err = store.ListAudit(ctx, "wanted", time.Time{}, 400)
+	require.NoError(t, err)
+	require.Len(t, entries, 400)
+	for i, e := range entries {
+		require.Equal(t, 2*i, e.Version, "entries should be oldest first")
+	}
+}
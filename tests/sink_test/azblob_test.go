@@ -103,6 +103,8 @@ func TestAzureBlobSink_CompressionVariants(t *testing.T) {
 		{"gzip", "gzip"},
 		{"bzip2", "bzip2"},
 		{"zstd", "zstd"},
+		{"lz4", "lz4"},
+		{"brotli", "brotli"},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,248 @@
+package sink_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chtzvt/certslurp/internal/compression"
+	"github.com/chtzvt/certslurp/internal/sink"
+	"github.com/chtzvt/certslurp/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type mockGCSUploadAPI struct {
+	called     bool
+	lastBucket string
+	lastObject string
+	lastBody   []byte
+	lastAttrs  sink.GCSObjectAttrs
+	returnErr  error
+	wg         *sync.WaitGroup
+}
+
+func (m *mockGCSUploadAPI) Upload(ctx context.Context, bucket, object string, body io.Reader, attrs sink.GCSObjectAttrs) error {
+	defer m.wg.Done()
+	m.called = true
+	m.lastBucket = bucket
+	m.lastObject = object
+	m.lastBody, _ = io.ReadAll(body)
+	m.lastAttrs = attrs
+	return m.returnErr
+}
+
+func TestGCSSink_Upload_BufferTypesAndCompression(t *testing.T) {
+	store := setupTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "TEST_GCS_CREDENTIALS", []byte(`{}`)))
+
+	payload := []byte("gcs test payload gcs test payload gcs test payload")
+	for _, bufferType := range []string{"memory", "disk"} {
+		for _, comp := range []string{"none", "gzip", "bzip2", "zstd", "lz4", "brotli"} {
+			t.Run(bufferType+"/"+comp, func(t *testing.T) {
+				wg := &sync.WaitGroup{}
+				wg.Add(1)
+				mock := &mockGCSUploadAPI{wg: wg}
+
+				opts := map[string]interface{}{
+					"bucket":             "mybucket",
+					"prefix":             "prefix/",
+					"compression":        comp,
+					"credentials_secret": "TEST_GCS_CREDENTIALS",
+					"buffer_type":        bufferType,
+				}
+				sinkIface, err := sink.NewGCSSink(opts, store)
+				require.NoError(t, err)
+				gcsSink := sinkIface.(*sink.GCSSink)
+				gcsSink.Client = mock
+
+				// The pipeline compresses before the sink; the sink uploads as-is
+				var buf testutil.WriteCloserBuffer
+				compWriter, err := compression.NewWriter(&buf, comp)
+				require.NoError(t, err)
+				_, err = compWriter.Write(payload)
+				require.NoError(t, err)
+				require.NoError(t, compWriter.Close())
+
+				w, err := gcsSink.Open(ctx, "testfile.jsonl")
+				require.NoError(t, err)
+				n, err := w.Write(buf.Bytes())
+				require.NoError(t, err)
+				require.Equal(t, buf.Len(), n)
+				require.NoError(t, w.Close())
+				wg.Wait()
+
+				require.True(t, mock.called)
+				require.Equal(t, "mybucket", mock.lastBucket)
+				require.Equal(t, "prefix/testfile.jsonl", mock.lastObject)
+				require.Equal(t, buf.Bytes(), mock.lastBody)
+
+				r, err := compression.NewReader(bytes.NewReader(mock.lastBody), comp)
+				require.NoError(t, err)
+				got, err := io.ReadAll(r)
+				require.NoError(t, err)
+				require.Equal(t, payload, got)
+
+				wantType := map[string]string{
+					"none":   "application/octet-stream",
+					"gzip":   "application/gzip",
+					"bzip2":  "application/x-bzip2",
+					"zstd":   "application/zstd",
+					"lz4":    "application/x-lz4",
+					"brotli": "application/x-brotli",
+				}[comp]
+				require.Equal(t, wantType, mock.lastAttrs.ContentType)
+			})
+		}
+	}
+}
+
+func TestGCSSink_OptionValidation(t *testing.T) {
+	_, err := sink.NewGCSSink(map[string]interface{}{"credentials_secret": "x"}, nil)
+	require.Error(t, err)
+	_, err = sink.NewGCSSink(map[string]interface{}{"bucket": "b"}, nil)
+	require.Error(t, err)
+	_, err = sink.NewGCSSink(map[string]interface{}{"bucket": "b", "credentials_secret": "x", "compression": "lzma"}, nil)
+	require.Error(t, err)
+
+	factory, ok := sink.ForName("gcs")
+	require.True(t, ok)
+	s, err := factory(map[string]interface{}{"bucket": "b", "endpoint": "http://localhost:4443"}, nil)
+	require.NoError(t, err)
+	require.IsType(t, &sink.GCSSink{}, s)
+}
+
+// The default client exchanges a signed JWT for an access token and uploads
+// through the Cloud Storage client library.
+func TestGCSSink_ServiceAccountUpload(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var tokenRequests int
+	var uploaded []byte
+	var uploadedName, contentType string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"))
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		require.Len(t, parts, 3)
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		require.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig))
+
+		claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		var claims map[string]interface{}
+		require.NoError(t, json.Unmarshal(claimsJSON, &claims))
+		require.Equal(t, "loader@example.iam.gserviceaccount.com", claims["iss"])
+
+		mu.Lock()
+		tokenRequests++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"test-token","expires_in":3600,"token_type":"Bearer"}`))
+	})
+	mux.HandleFunc("/upload/storage/v1/b/mybucket/o", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// A multipart upload: the object's metadata, then its contents
+		require.Equal(t, "multipart", r.URL.Query().Get("uploadType"))
+		mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		require.Equal(t, "multipart/related", mediaType)
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		part, err := mr.NextPart()
+		require.NoError(t, err)
+		var meta struct {
+			Name        string `json:"name"`
+			ContentType string `json:"contentType"`
+		}
+		require.NoError(t, json.NewDecoder(part).Decode(&meta))
+		part, err = mr.NextPart()
+		require.NoError(t, err)
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+
+		mu.Lock()
+		uploaded = body
+		uploadedName = meta.Name
+		contentType = meta.ContentType
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"bucket": "mybucket", "name": meta.Name})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	creds, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "loader@example.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    srv.URL + "/token",
+	})
+	require.NoError(t, err)
+
+	store := setupTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "TEST_GCS_CREDENTIALS", creds))
+
+	s, err := sink.NewGCSSink(map[string]interface{}{
+		"bucket":             "mybucket",
+		"prefix":             "exports",
+		"compression":        "gzip",
+		"credentials_secret": "TEST_GCS_CREDENTIALS",
+		"endpoint":           srv.URL,
+	}, store)
+	require.NoError(t, err)
+
+	for _, name := range []string{"a.jsonl", "b.jsonl"} {
+		w, err := s.Open(ctx, name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("hello " + name))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		mu.Lock()
+		require.Equal(t, "exports/"+name, uploadedName)
+		require.Equal(t, "application/gzip", contentType)
+		require.Equal(t, "hello "+name, string(uploaded))
+		mu.Unlock()
+	}
+
+	// The access token is reused across objects
+	require.Equal(t, 1, tokenRequests)
+
+	// Only service account keys are accepted
+	require.NoError(t, store.Set(ctx, "TEST_GCS_EXTERNAL", []byte(`{"type":"external_account"}`)))
+	s, err = sink.NewGCSSink(map[string]interface{}{
+		"bucket":             "mybucket",
+		"credentials_secret": "TEST_GCS_EXTERNAL",
+		"endpoint":           srv.URL,
+	}, store)
+	require.NoError(t, err)
+	_, err = s.Open(ctx, "c.jsonl")
+	require.ErrorContains(t, err, "not a service account key")
+}
@@ -0,0 +1,66 @@
+package sink_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chtzvt/certslurp/internal/compression"
+	"github.com/chtzvt/certslurp/internal/sink"
+	"github.com/chtzvt/certslurp/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// A gzip chunk is POSTed as-is with its Content-Encoding and a bearer token
+// read from the secrets store, as slurpload's upload endpoint expects.
+func TestHTTPSink_BearerTokenAndGzip(t *testing.T) {
+	store := setupTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "TEST_UPLOAD_TOKEN", []byte("s3cret-token\n")))
+
+	var gotBody []byte
+	var gotAuth, gotEncoding, gotMethod string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotAuth = r.Header.Get("Authorization")
+		gotEncoding = r.Header.Get("Content-Encoding")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	s, err := sink.NewHTTPSink(map[string]interface{}{
+		"endpoint":            srv.URL + "/upload",
+		"compression":         "gzip",
+		"bearer_token_secret": "TEST_UPLOAD_TOKEN",
+		"timeout_secs":        5,
+	}, store)
+	require.NoError(t, err)
+
+	payload := []byte("{\"cn\":\"example.com\"}\n")
+	var compressed testutil.WriteCloserBuffer
+	cw, err := compression.NewWriter(&compressed, "gzip")
+	require.NoError(t, err)
+	_, err = cw.Write(payload)
+	require.NoError(t, err)
+	require.NoError(t, cw.Close())
+
+	w, err := s.Open(ctx, "chunk.0001")
+	require.NoError(t, err)
+	_, err = w.Write(compressed.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.Equal(t, http.MethodPost, gotMethod)
+	require.Equal(t, "Bearer s3cret-token", gotAuth)
+	require.Equal(t, "gzip", gotEncoding)
+	require.Equal(t, compressed.Bytes(), gotBody)
+	r, err := compression.NewReader(bytes.NewReader(gotBody), "gzip")
+	require.NoError(t, err)
+	plain, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, payload, plain)
+}
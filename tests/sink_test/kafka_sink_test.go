@@ -0,0 +1,245 @@
+package sink_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/sink"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+)
+
+type mockKafkaProducer struct {
+	mu        sync.Mutex
+	topics    []string
+	batches   [][][]byte
+	returnErr error
+}
+
+func (m *mockKafkaProducer) Produce(ctx context.Context, topic string, msgs [][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.topics = append(m.topics, topic)
+	m.batches = append(m.batches, msgs)
+	return m.returnErr
+}
+
+func (m *mockKafkaProducer) messages() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	for _, batch := range m.batches {
+		for _, msg := range batch {
+			out = append(out, string(msg))
+		}
+	}
+	return out
+}
+
+func newMockKafkaSink(t *testing.T, mock *mockKafkaProducer, extra map[string]interface{}) *sink.KafkaSink {
+	t.Helper()
+	opts := map[string]interface{}{
+		"brokers": []interface{}{"kafka-1:9092", "kafka-2:9092"},
+		"topic":   "certs",
+	}
+	for k, v := range extra {
+		opts[k] = v
+	}
+	s, err := sink.NewKafkaSink(opts, nil)
+	require.NoError(t, err)
+	ks := s.(*sink.KafkaSink)
+	ks.Producer = mock
+	return ks
+}
+
+func TestKafkaSink_PublishesEachRecord(t *testing.T) {
+	mock := &mockKafkaProducer{}
+	s := newMockKafkaSink(t, mock, map[string]interface{}{"batch_size": 2})
+
+	w, err := s.Open(context.Background(), "chunk-0001.jsonl")
+	require.NoError(t, err)
+
+	// Records split across writes, and several in one write
+	for _, part := range []string{`{"cn":"a.exa`, "mple\"}\n{\"cn\":\"b\"}\n", "\n", `{"cn":"c"}` + "\n" + `{"cn":"d"}`} {
+		_, err := w.Write([]byte(part))
+		require.NoError(t, err)
+	}
+	require.Len(t, mock.batches, 1, "a full batch is sent while writing")
+	require.Len(t, mock.batches[0], 2)
+
+	require.NoError(t, w.Close())
+	require.Equal(t, []string{`{"cn":"a.example"}`, `{"cn":"b"}`, `{"cn":"c"}`, `{"cn":"d"}`}, mock.messages())
+	require.Equal(t, []string{"certs", "certs"}, mock.topics)
+}
+
+func TestKafkaSink_ProduceErrorIsSticky(t *testing.T) {
+	mock := &mockKafkaProducer{returnErr: errors.New("broker unavailable")}
+	s := newMockKafkaSink(t, mock, map[string]interface{}{"batch_size": 1})
+
+	w, err := s.Open(context.Background(), "chunk.jsonl")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("{}\n"))
+	require.ErrorContains(t, err, "broker unavailable")
+	_, err = w.Write([]byte("{}\n"))
+	require.ErrorContains(t, err, "broker unavailable")
+	require.ErrorContains(t, w.Close(), "broker unavailable")
+	require.Len(t, mock.batches, 1)
+}
+
+func TestKafkaSink_BatchesCappedByBytes(t *testing.T) {
+	mock := &mockKafkaProducer{}
+	s := newMockKafkaSink(t, mock, map[string]interface{}{"batch_bytes": 2048})
+
+	w, err := s.Open(context.Background(), "chunk.jsonl")
+	require.NoError(t, err)
+	record := strings.Repeat("x", 700)
+	for range 5 {
+		_, err := w.Write([]byte(record + "\n"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	// Two 700 byte records fit in 2048 bytes, a third doesn't
+	require.Len(t, mock.batches, 3)
+	require.Len(t, mock.batches[0], 2)
+	require.Len(t, mock.batches[1], 2)
+	require.Len(t, mock.batches[2], 1)
+	require.Len(t, mock.messages(), 5)
+}
+
+func TestKafkaSink_OversizedRecordFails(t *testing.T) {
+	mock := &mockKafkaProducer{}
+	s := newMockKafkaSink(t, mock, map[string]interface{}{"batch_bytes": 2048})
+
+	w, err := s.Open(context.Background(), "chunk.jsonl")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("{}\n" + strings.Repeat("x", 4096) + "\n"))
+	require.ErrorContains(t, err, "batch_bytes")
+	_, err = w.Write([]byte("{}\n"))
+	require.ErrorContains(t, err, "batch_bytes", "the chunk fails rather than skipping the record")
+	require.ErrorContains(t, w.Close(), "batch_bytes")
+	require.Empty(t, mock.batches, "nothing is sent once the chunk has failed")
+}
+
+func TestKafkaSink_OptionValidation(t *testing.T) {
+	cases := []struct {
+		name string
+		opts map[string]interface{}
+		want string
+	}{
+		{"no brokers", map[string]interface{}{"topic": "certs"}, "brokers"},
+		{"no topic", map[string]interface{}{"brokers": "localhost:9092"}, "topic"},
+		{"compressed", map[string]interface{}{"brokers": "localhost:9092", "topic": "certs", "compression": "gzip"}, "compression"},
+		{"half sasl", map[string]interface{}{"brokers": "localhost:9092", "topic": "certs", "sasl_username_secret": "KAFKA_USER"}, "sasl_password_secret"},
+		{"scram", map[string]interface{}{"brokers": "localhost:9092", "topic": "certs", "sasl_mechanism": "SCRAM-SHA-512"}, "sasl_mechanism"},
+		{"acks 0", map[string]interface{}{"brokers": "localhost:9092", "topic": "certs", "acks": 0}, "acks"},
+		{"negative retries", map[string]interface{}{"brokers": "localhost:9092", "topic": "certs", "max_retries": -1}, "max_retries"},
+		{"tiny batches", map[string]interface{}{"brokers": "localhost:9092", "topic": "certs", "batch_bytes": 100}, "batch_bytes"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := sink.NewKafkaSink(tc.opts, nil)
+			require.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+func TestKafkaSink_ProducesToBroker(t *testing.T) {
+	cluster, err := kfake.NewCluster(
+		kfake.NumBrokers(1),
+		kfake.SeedTopics(2, "certs"),
+		kfake.EnableSASL(),
+		kfake.Superuser("PLAIN", "slurper", "hunter2"),
+	)
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	store := setupTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "TEST_KAFKA_USER", []byte("slurper")))
+	require.NoError(t, store.Set(ctx, "TEST_KAFKA_PASSWORD", []byte("hunter2\n")))
+
+	s, err := sink.NewKafkaSink(map[string]interface{}{
+		"brokers":              strings.Join(cluster.ListenAddrs(), ","),
+		"topic":                "certs",
+		"sasl_username_secret": "TEST_KAFKA_USER",
+		"sasl_password_secret": "TEST_KAFKA_PASSWORD",
+		"batch_size":           2,
+	}, store)
+	require.NoError(t, err)
+
+	var want []string
+	for chunk := range 2 {
+		w, err := s.Open(ctx, "chunk-"+strconv.Itoa(chunk)+".jsonl")
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		for i := range 3 {
+			rec := `{"chunk":` + strconv.Itoa(chunk) + `,"i":` + strconv.Itoa(i) + `}`
+			want = append(want, rec)
+			buf.WriteString(rec + "\n")
+		}
+		_, err = w.Write(buf.Bytes())
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.SASL(plain.Auth{User: "slurper", Pass: "hunter2"}.AsMechanism()),
+		kgo.ConsumeTopics("certs"),
+	)
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	pollCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var got []string
+	for len(got) < len(want) {
+		fetches := consumer.PollFetches(pollCtx)
+		require.NoError(t, pollCtx.Err(), "only consumed %d of %d records", len(got), len(want))
+		fetches.EachRecord(func(r *kgo.Record) {
+			got = append(got, string(r.Value))
+		})
+	}
+	require.ElementsMatch(t, want, got)
+}
+
+func TestKafkaSink_WrongPasswordFails(t *testing.T) {
+	cluster, err := kfake.NewCluster(
+		kfake.NumBrokers(1),
+		kfake.SeedTopics(1, "certs"),
+		kfake.EnableSASL(),
+		kfake.Superuser("PLAIN", "slurper", "hunter2"),
+	)
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	store := setupTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "TEST_KAFKA_USER", []byte("slurper")))
+	require.NoError(t, store.Set(ctx, "TEST_KAFKA_PASSWORD", []byte("wrong")))
+
+	s, err := sink.NewKafkaSink(map[string]interface{}{
+		"brokers":              cluster.ListenAddrs(),
+		"topic":                "certs",
+		"sasl_username_secret": "TEST_KAFKA_USER",
+		"sasl_password_secret": "TEST_KAFKA_PASSWORD",
+		"max_retries":          0,
+		"timeout_secs":         2,
+	}, store)
+	require.NoError(t, err)
+
+	w, err := s.Open(ctx, "chunk.jsonl")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("{}\n"))
+	require.NoError(t, err)
+	require.Error(t, w.Close())
+}
@@ -1,12 +1,17 @@
 package sink_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"sync"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/chtzvt/certslurp/internal/compression"
 	"github.com/chtzvt/certslurp/internal/sink"
 	"github.com/chtzvt/certslurp/internal/testutil"
@@ -17,6 +22,7 @@ type mockPutObjectAPI struct {
 	called    bool
 	lastKey   string
 	lastBody  []byte
+	lastInput *s3.PutObjectInput
 	returnErr error
 	wg        *sync.WaitGroup
 }
@@ -25,6 +31,7 @@ func (m *mockPutObjectAPI) PutObject(ctx context.Context, params *s3.PutObjectIn
 	defer m.wg.Done() // signal done
 	m.called = true
 	m.lastKey = *params.Key
+	m.lastInput = params
 	body, _ := io.ReadAll(params.Body)
 	m.lastBody = body
 	return &s3.PutObjectOutput{}, m.returnErr
@@ -126,6 +133,8 @@ func TestS3Sink_CompressedPayloads(t *testing.T) {
 		{"gzip", "gzip"},
 		{"bzip2", "bzip2"},
 		{"zstd", "zstd"},
+		{"lz4", "lz4"},
+		{"brotli", "brotli"},
 	} {
 		t.Run(cc.name, func(t *testing.T) {
 			wg := &sync.WaitGroup{}
@@ -171,6 +180,472 @@ func TestS3Sink_CompressedPayloads(t *testing.T) {
 	}
 }
 
+func TestS3Sink_StorageClassAndEncryption(t *testing.T) {
+	store := setupTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "TEST_AWS_ACCESS_KEY_ID", []byte("fake-access")))
+	require.NoError(t, store.Set(ctx, "TEST_AWS_SECRET_ACCESS_KEY", []byte("fake-secret")))
+
+	const keyARN = "arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+	cases := []struct {
+		name      string
+		extra     map[string]interface{}
+		wantClass types.StorageClass
+		wantSSE   types.ServerSideEncryption
+		wantKey   string
+	}{
+		{"defaults", nil, "", "", ""},
+		{"standard_ia sse-s3", map[string]interface{}{"storage_class": "STANDARD_IA", "server_side_encryption": "SSE-S3"},
+			types.StorageClassStandardIa, types.ServerSideEncryptionAes256, ""},
+		{"glacier_ir sse-kms", map[string]interface{}{"storage_class": "glacier_ir", "server_side_encryption": "SSE-KMS", "sse_kms_key_id": keyARN},
+			types.StorageClassGlacierIr, types.ServerSideEncryptionAwsKms, keyARN},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+			mock := &mockPutObjectAPI{wg: wg}
+			opts := map[string]interface{}{
+				"bucket":               "mybucket",
+				"region":               "us-west-2",
+				"access_key_id_secret": "TEST_AWS_ACCESS_KEY_ID",
+				"access_key_secret":    "TEST_AWS_SECRET_ACCESS_KEY",
+			}
+			for k, v := range tc.extra {
+				opts[k] = v
+			}
+
+			sinkIface, err := sink.NewS3Sink(opts, store)
+			require.NoError(t, err)
+			sink := sinkIface.(*sink.S3Sink)
+			sink.Client = mock
+
+			w, err := sink.Open(ctx, "testfile.txt")
+			require.NoError(t, err)
+			_, err = w.Write([]byte("payload"))
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+			wg.Wait()
+
+			require.Equal(t, tc.wantClass, mock.lastInput.StorageClass)
+			require.Equal(t, tc.wantSSE, mock.lastInput.ServerSideEncryption)
+			if tc.wantKey == "" {
+				require.Nil(t, mock.lastInput.SSEKMSKeyId)
+			} else {
+				require.Equal(t, tc.wantKey, *mock.lastInput.SSEKMSKeyId)
+			}
+		})
+	}
+}
+
+func TestS3Sink_ACLAndMetadata(t *testing.T) {
+	store := setupTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "TEST_AWS_ACCESS_KEY_ID", []byte("fake-access")))
+	require.NoError(t, store.Set(ctx, "TEST_AWS_SECRET_ACCESS_KEY", []byte("fake-secret")))
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	mock := &mockPutObjectAPI{wg: wg}
+	opts := map[string]interface{}{
+		"bucket":               "mybucket",
+		"region":               "us-west-2",
+		"access_key_id_secret": "TEST_AWS_ACCESS_KEY_ID",
+		"access_key_secret":    "TEST_AWS_SECRET_ACCESS_KEY",
+		"storage_class":        "GLACIER",
+		"acl":                  "bucket-owner-full-control",
+		"sse":                  "aws:kms",
+		"kms_key_id":           "alias/certslurp",
+		"metadata":             map[string]interface{}{"owner": "ops", "retention-days": 30},
+	}
+
+	sinkIface, err := sink.NewS3Sink(opts, store)
+	require.NoError(t, err)
+	sink := sinkIface.(*sink.S3Sink)
+	sink.Client = mock
+
+	w, err := sink.Open(ctx, "testfile.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	wg.Wait()
+
+	in := mock.lastInput
+	require.Equal(t, types.StorageClassGlacier, in.StorageClass)
+	require.Equal(t, types.ObjectCannedACLBucketOwnerFullControl, in.ACL)
+	require.Equal(t, types.ServerSideEncryptionAwsKms, in.ServerSideEncryption)
+	require.Equal(t, "alias/certslurp", *in.SSEKMSKeyId)
+	require.Equal(t, map[string]string{"owner": "ops", "retention-days": "30"}, in.Metadata)
+}
+
+func TestS3Sink_MultipartCarriesObjectOptions(t *testing.T) {
+	mock := newMockMultipartAPI()
+	s := newMultipartTestSink(t, mock, map[string]interface{}{
+		"storage_class": "STANDARD_IA",
+		"acl":           "private",
+		"sse":           "AES256",
+		"metadata":      map[string]interface{}{"owner": "ops"},
+	})
+
+	w, err := s.Open(context.Background(), "big.jsonl")
+	require.NoError(t, err)
+	_, err = w.Write(make([]byte, 7<<20))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	in := mock.lastCreate
+	require.NotNil(t, in)
+	require.Equal(t, types.StorageClassStandardIa, in.StorageClass)
+	require.Equal(t, types.ObjectCannedACLPrivate, in.ACL)
+	require.Equal(t, types.ServerSideEncryptionAes256, in.ServerSideEncryption)
+	require.Equal(t, map[string]string{"owner": "ops"}, in.Metadata)
+}
+
+func TestS3Sink_InvalidStorageOptions(t *testing.T) {
+	base := func(extra map[string]interface{}) map[string]interface{} {
+		opts := map[string]interface{}{"bucket": "mybucket", "region": "us-west-2"}
+		for k, v := range extra {
+			opts[k] = v
+		}
+		return opts
+	}
+
+	_, err := sink.NewS3Sink(base(map[string]interface{}{"storage_class": "COLD_STORAGE"}), nil)
+	require.ErrorContains(t, err, "storage_class")
+
+	_, err = sink.NewS3Sink(base(map[string]interface{}{"server_side_encryption": "SSE-C"}), nil)
+	require.ErrorContains(t, err, "server_side_encryption")
+
+	_, err = sink.NewS3Sink(base(map[string]interface{}{"server_side_encryption": "SSE-S3", "sse_kms_key_id": "arn:aws:kms:key"}), nil)
+	require.ErrorContains(t, err, "sse_kms_key_id")
+
+	_, err = sink.NewS3Sink(base(map[string]interface{}{"acl": "world-writable"}), nil)
+	require.ErrorContains(t, err, "acl")
+
+	_, err = sink.NewS3Sink(base(map[string]interface{}{"metadata": "owner=ops"}), nil)
+	require.ErrorContains(t, err, "metadata")
+
+	_, err = sink.NewS3Sink(base(map[string]interface{}{"metadata": map[string]interface{}{"tags": []interface{}{"a"}}}), nil)
+	require.ErrorContains(t, err, "metadata")
+}
+
+// fakeS3Error looks like the SDK's API errors, which carry both an S3 error
+// code and the response's status.
+type fakeS3Error struct {
+	code   string
+	status int
+}
+
+func (e *fakeS3Error) Error() string {
+	return fmt.Sprintf("api error %s (status %d)", e.code, e.status)
+}
+
+func (e *fakeS3Error) ErrorCode() string   { return e.code }
+func (e *fakeS3Error) HTTPStatusCode() int { return e.status }
+
+// flakyPutObjectAPI fails the first failures calls with err, recording the
+// body sent on every call.
+type flakyPutObjectAPI struct {
+	failures int
+	err      error
+	bodies   [][]byte
+}
+
+func (m *flakyPutObjectAPI) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.bodies = append(m.bodies, body)
+	if len(m.bodies) <= m.failures {
+		return nil, m.err
+	}
+	return &s3.PutObjectOutput{}, nil
+}
+
+func newRetryTestSink(t *testing.T, client sink.PutObjectAPI, extra map[string]interface{}) *sink.S3Sink {
+	t.Helper()
+	store := setupTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "TEST_AWS_ACCESS_KEY_ID", []byte("fake-access")))
+	require.NoError(t, store.Set(ctx, "TEST_AWS_SECRET_ACCESS_KEY", []byte("fake-secret")))
+	opts := map[string]interface{}{
+		"bucket":               "mybucket",
+		"region":               "us-west-2",
+		"access_key_id_secret": "TEST_AWS_ACCESS_KEY_ID",
+		"access_key_secret":    "TEST_AWS_SECRET_ACCESS_KEY",
+	}
+	for k, v := range extra {
+		opts[k] = v
+	}
+	s, err := sink.NewS3Sink(opts, store)
+	require.NoError(t, err)
+	s3s := s.(*sink.S3Sink)
+	s3s.Client = client
+	return s3s
+}
+
+func TestS3Sink_RetriesTransientErrors(t *testing.T) {
+	for _, bufferType := range []string{"memory", "disk"} {
+		t.Run(bufferType, func(t *testing.T) {
+			mock := &flakyPutObjectAPI{failures: 2, err: &fakeS3Error{code: "SlowDown", status: 503}}
+			s := newRetryTestSink(t, mock, map[string]interface{}{"buffer_type": bufferType})
+
+			w, err := s.Open(context.Background(), "testfile.txt")
+			require.NoError(t, err)
+			payload := []byte("s3 retry payload")
+			_, err = w.Write(payload)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			require.Len(t, mock.bodies, 3)
+			for _, body := range mock.bodies {
+				require.Equal(t, payload, body, "each attempt sends the whole chunk")
+			}
+		})
+	}
+}
+
+func TestS3Sink_RetriesAreBounded(t *testing.T) {
+	mock := &flakyPutObjectAPI{failures: 100, err: &fakeS3Error{code: "InternalError", status: 500}}
+	s := newRetryTestSink(t, mock, map[string]interface{}{"max_retries": 2})
+
+	w, err := s.Open(context.Background(), "testfile.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("payload"))
+	require.NoError(t, err)
+	err = w.Close()
+	require.ErrorContains(t, err, "all 3 attempts")
+	require.Len(t, mock.bodies, 3, "the first attempt and 2 retries")
+}
+
+func TestS3Sink_ZeroRetries(t *testing.T) {
+	mock := &flakyPutObjectAPI{failures: 100, err: &fakeS3Error{code: "InternalError", status: 500}}
+	s := newRetryTestSink(t, mock, map[string]interface{}{"max_retries": 0})
+
+	w, err := s.Open(context.Background(), "testfile.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.ErrorContains(t, w.Close(), "all 1 attempts")
+	require.Len(t, mock.bodies, 1)
+
+	for _, opt := range []string{"max_retries", "part_retries"} {
+		_, err := sink.NewS3Sink(map[string]interface{}{"bucket": "b", "region": "r", opt: -1}, nil)
+		require.ErrorContains(t, err, opt)
+	}
+}
+
+func TestS3Sink_NonRetryableErrorFailsFast(t *testing.T) {
+	denied := &fakeS3Error{code: "AccessDenied", status: 403}
+	mock := &flakyPutObjectAPI{failures: 100, err: denied}
+	s := newRetryTestSink(t, mock, nil)
+
+	w, err := s.Open(context.Background(), "testfile.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("payload"))
+	require.NoError(t, err)
+	err = w.Close()
+	require.ErrorIs(t, err, denied)
+	require.Len(t, mock.bodies, 1)
+}
+
+// mockMultipartAPI records multipart uploads. failPart fails the first
+// failTimes attempts at that part number.
+type mockMultipartAPI struct {
+	mu         sync.Mutex
+	puts       int
+	creates    int
+	lastCreate *s3.CreateMultipartUploadInput
+	parts      map[int32][]byte
+	attempts   map[int32]int
+	completed  []types.CompletedPart
+	aborted    bool
+	failPart   int32
+	failTimes  int
+}
+
+func newMockMultipartAPI() *mockMultipartAPI {
+	return &mockMultipartAPI{parts: map[int32][]byte{}, attempts: map[int32]int{}}
+}
+
+func (m *mockMultipartAPI) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.puts++
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *mockMultipartAPI) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.creates++
+	m.lastCreate = params
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+}
+
+func (m *mockMultipartAPI) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	num := *params.PartNumber
+	m.attempts[num]++
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	if num == m.failPart && m.attempts[num] <= m.failTimes {
+		return nil, errors.New("connection reset by peer")
+	}
+	m.parts[num] = body
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", num))}, nil
+}
+
+func (m *mockMultipartAPI) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.completed = params.MultipartUpload.Parts
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (m *mockMultipartAPI) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.aborted = true
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func newMultipartTestSink(t *testing.T, mock *mockMultipartAPI, extra map[string]interface{}) *sink.S3Sink {
+	t.Helper()
+	store := setupTestStore(t)
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "TEST_AWS_ACCESS_KEY_ID", []byte("fake-access")))
+	require.NoError(t, store.Set(ctx, "TEST_AWS_SECRET_ACCESS_KEY", []byte("fake-secret")))
+	opts := map[string]interface{}{
+		"bucket":               "mybucket",
+		"region":               "us-west-2",
+		"access_key_id_secret": "TEST_AWS_ACCESS_KEY_ID",
+		"access_key_secret":    "TEST_AWS_SECRET_ACCESS_KEY",
+		"multipart_threshold":  6 << 20,
+		"part_size":            5 << 20,
+	}
+	for k, v := range extra {
+		opts[k] = v
+	}
+	s, err := sink.NewS3Sink(opts, store)
+	require.NoError(t, err)
+	s3s := s.(*sink.S3Sink)
+	s3s.Client = mock
+	return s3s
+}
+
+func TestS3Sink_MultipartUpload(t *testing.T) {
+	for _, bufferType := range []string{"memory", "disk"} {
+		t.Run(bufferType, func(t *testing.T) {
+			mock := newMockMultipartAPI()
+			mock.failPart, mock.failTimes = 2, 1
+			s := newMultipartTestSink(t, mock, map[string]interface{}{"buffer_type": bufferType})
+
+			payload := bytes.Repeat([]byte("0123456789abcdef"), (12<<20)/16) // 12 MiB
+			w, err := s.Open(context.Background(), "big.jsonl")
+			require.NoError(t, err)
+			_, err = w.Write(payload)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			require.Zero(t, mock.puts, "large chunks shouldn't use PutObject")
+			require.Len(t, mock.completed, 3)
+			require.Equal(t, 2, mock.attempts[2], "failed part should be retried")
+			require.Equal(t, 1, mock.attempts[1], "other parts are sent once")
+			require.False(t, mock.aborted)
+
+			var got []byte
+			for i, p := range mock.completed {
+				require.Equal(t, int32(i+1), *p.PartNumber)
+				require.Equal(t, fmt.Sprintf("etag-%d", i+1), *p.ETag)
+				got = append(got, mock.parts[*p.PartNumber]...)
+			}
+			require.Len(t, mock.parts[1], 5<<20)
+			require.Equal(t, payload, got)
+		})
+	}
+}
+
+func TestS3Sink_MultipartStreamsParts(t *testing.T) {
+	for _, bufferType := range []string{"memory", "disk"} {
+		t.Run(bufferType, func(t *testing.T) {
+			mock := newMockMultipartAPI()
+			s := newMultipartTestSink(t, mock, map[string]interface{}{"buffer_type": bufferType})
+
+			w, err := s.Open(context.Background(), "big.jsonl")
+			require.NoError(t, err)
+			var payload []byte
+			for i := range 11 {
+				block := bytes.Repeat([]byte{byte('a' + i)}, 1<<20)
+				payload = append(payload, block...)
+				_, err = w.Write(block)
+				require.NoError(t, err)
+				switch {
+				case i < 5: // 6 MiB threshold not yet reached
+					require.Zero(t, mock.creates)
+				case i < 9:
+					require.Len(t, mock.parts, 1)
+				default:
+					require.Len(t, mock.parts, 2)
+				}
+			}
+			require.Equal(t, 1, mock.creates)
+			require.Nil(t, mock.completed, "upload completes on Close")
+
+			require.NoError(t, w.Close())
+			require.Zero(t, mock.puts)
+			require.Len(t, mock.completed, 3)
+			require.Len(t, mock.parts[3], 1<<20, "last part holds the remainder")
+			var got []byte
+			for _, p := range mock.completed {
+				got = append(got, mock.parts[*p.PartNumber]...)
+			}
+			require.Equal(t, payload, got)
+		})
+	}
+}
+
+func TestS3Sink_MultipartAbortsOnPersistentFailure(t *testing.T) {
+	mock := newMockMultipartAPI()
+	mock.failPart, mock.failTimes = 1, 100
+	s := newMultipartTestSink(t, mock, map[string]interface{}{"part_retries": 2})
+
+	w, err := s.Open(context.Background(), "big.jsonl")
+	require.NoError(t, err)
+	// Crossing the threshold sends the first part, so the write fails
+	_, err = w.Write(make([]byte, 7<<20))
+	require.ErrorContains(t, err, "upload part 1")
+	_, err = w.Write([]byte("more"))
+	require.ErrorContains(t, err, "upload part 1", "a failed upload can't be written to")
+	require.ErrorContains(t, w.Close(), "upload part 1")
+	require.Equal(t, 3, mock.attempts[1], "the first attempt and 2 retries")
+	require.True(t, mock.aborted)
+	require.Nil(t, mock.completed)
+}
+
+func TestS3Sink_SmallChunkUsesPutObject(t *testing.T) {
+	mock := newMockMultipartAPI()
+	s := newMultipartTestSink(t, mock, nil)
+
+	w, err := s.Open(context.Background(), "small.jsonl")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("small"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, 1, mock.puts)
+	require.Empty(t, mock.attempts)
+}
+
+func TestS3Sink_PartSizeMinimum(t *testing.T) {
+	_, err := sink.NewS3Sink(map[string]interface{}{"bucket": "b", "region": "r", "part_size": 1 << 20}, nil)
+	require.ErrorContains(t, err, "part_size")
+}
+
 func TestBuildS3Key(t *testing.T) {
 	cases := []struct {
 		prefix, name, want string
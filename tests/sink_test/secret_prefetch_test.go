@@ -0,0 +1,84 @@
+package sink_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/sink"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// countingKV counts the etcd reads issued through a client.
+type countingKV struct {
+	clientv3.KV
+	gets atomic.Int32
+	txns atomic.Int32
+}
+
+func (c *countingKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	c.gets.Add(1)
+	return c.KV.Get(ctx, key, opts...)
+}
+
+func (c *countingKV) Txn(ctx context.Context) clientv3.Txn {
+	c.txns.Add(1)
+	return c.KV.Txn(ctx)
+}
+
+func TestSinkSecrets_PrefetchedInSingleFetch(t *testing.T) {
+	store := setupTestStore(t)
+	ctx := context.Background()
+
+	_, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx, "TEST_AWS_ACCESS_KEY_ID", []byte("fake-access")))
+	require.NoError(t, store.Set(ctx, "TEST_AWS_SECRET_ACCESS_KEY", []byte("fake-secret")))
+	require.NoError(t, store.Set(ctx, "TEST_SIGNING_KEY", signingKey.Seed()))
+
+	opts := map[string]interface{}{
+		"bucket":               "mybucket",
+		"region":               "us-east-1",
+		"access_key_id_secret": "TEST_AWS_ACCESS_KEY_ID",
+		"access_key_secret":    "TEST_AWS_SECRET_ACCESS_KEY",
+		"signing_key_secret":   "TEST_SIGNING_KEY",
+	}
+	names := job.OutputOptions{SinkOptions: opts}.SinkSecretNames()
+	require.Equal(t, []string{"TEST_AWS_ACCESS_KEY_ID", "TEST_AWS_SECRET_ACCESS_KEY", "TEST_SIGNING_KEY"}, names)
+
+	kv := &countingKV{KV: store.Client().KV}
+	store.Client().KV = kv
+
+	values, err := store.GetMany(ctx, append(names, "TEST_MISSING"))
+	require.NoError(t, err)
+	require.Len(t, values, 3)
+	require.Equal(t, []byte("fake-access"), values["TEST_AWS_ACCESS_KEY_ID"])
+	cached := store.WithCache(values)
+
+	s3Sink, err := sink.NewS3Sink(opts, cached)
+	require.NoError(t, err)
+	wg := &sync.WaitGroup{}
+	wg.Add(2) // the chunk and its signature
+	s3Sink.(*sink.S3Sink).Client = &mockPutObjectAPI{wg: wg}
+	signed := sink.NewSigningSink(s3Sink, sink.SecretSigningKey(cached, "TEST_SIGNING_KEY"))
+
+	w, err := signed.Open(ctx, "chunk.jsonl")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("payload"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	wg.Wait()
+
+	require.EqualValues(t, 1, kv.txns.Load(), "credentials should be fetched in one batch")
+	require.EqualValues(t, 0, kv.gets.Load(), "sink should not read secrets individually")
+
+	// Keys outside the cache still fall through to etcd.
+	_, err = cached.Get(ctx, "TEST_MISSING")
+	require.Error(t, err)
+	require.EqualValues(t, 1, kv.gets.Load())
+}
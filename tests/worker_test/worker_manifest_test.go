@@ -0,0 +1,81 @@
+package worker_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/etl"
+	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/sink"
+	"github.com/chtzvt/certslurp/internal/testcluster"
+	"github.com/chtzvt/certslurp/internal/testutil"
+	"github.com/chtzvt/certslurp/internal/testworkers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestE2E_JobManifestListsChunks(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+	ts := testutil.NewRangedStubCTLogServer(t, testutil.CTLogFourEntrySTH, testutil.CTLogFourEntries, nil)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	bucket := "manifest-" + testutil.RandString(5)
+	opts := testcluster.DefaultTestJobOptions()
+	opts.Fetch = job.FetchConfig{FetchSize: 2, FetchWorkers: 1}
+	opts.Output.Sink, opts.Output.SinkOptions = "memory", map[string]interface{}{"bucket": bucket}
+	opts.Output.ChunkRecords = 1
+	opts.Output.Manifest = true
+	jobID, err := cl.SubmitJob(ctx, &job.JobSpec{Version: "0.1.0", LogURI: ts.URL, Options: opts})
+	require.NoError(t, err)
+	require.NoError(t, cl.BulkCreateShards(ctx, jobID, []cluster.ShardRange{
+		{ShardID: 0, IndexFrom: 0, IndexTo: 2},
+		{ShardID: 1, IndexFrom: 2, IndexTo: 4},
+	}))
+
+	workers := testworkers.RunWorkers(ctx, t, cl, jobID, 2, testutil.NewTestLogger(true))
+	defer func() {
+		for _, w := range workers {
+			w.Stop()
+		}
+	}()
+	testutil.WaitFor(t, func() bool {
+		info, err := cl.GetJob(ctx, jobID)
+		return err == nil && info.Status == cluster.JobStateCompleted
+	}, 15*time.Second, 50*time.Millisecond, "job should complete")
+
+	out := sink.MemoryBucket(bucket)
+	rc, err := out.OpenReader(ctx, etl.JobManifestName(jobID))
+	require.NoError(t, err, "manifest should be written when the job completes")
+	var man cluster.JobManifest
+	require.NoError(t, json.NewDecoder(rc).Decode(&man))
+	rc.Close()
+
+	require.Equal(t, jobID, man.JobID)
+	require.Equal(t, ts.URL, man.LogURI)
+	require.EqualValues(t, 4, man.Records)
+	require.Len(t, man.Chunks, 4)
+	var total int64
+	for i, chunk := range man.Chunks {
+		require.Equal(t, i/2, chunk.Shard, "chunks should be listed by shard")
+
+		// Every listed chunk is in the sink, with the listed size and checksum
+		rc, err := out.OpenReader(ctx, chunk.Name)
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		sum := sha256.Sum256(data)
+		require.EqualValues(t, len(data), chunk.Bytes)
+		require.Equal(t, hex.EncodeToString(sum[:]), chunk.SHA256)
+		total += chunk.Bytes
+	}
+	require.Equal(t, man.Bytes, total)
+}
@@ -0,0 +1,74 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chtzvt/certslurp/internal/cluster"
+	"github.com/chtzvt/certslurp/internal/job"
+	"github.com/chtzvt/certslurp/internal/testcluster"
+	"github.com/chtzvt/certslurp/internal/testutil"
+	"github.com/chtzvt/certslurp/internal/testworkers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorker_ResumesShardFromCheckpoint(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+
+	// Record where each fetch starts
+	var mu sync.Mutex
+	var starts []int64
+	ts := testutil.NewRangedStubCTLogServer(t, testutil.CTLogFourEntrySTH, testutil.CTLogFourEntries, func(start int64) {
+		mu.Lock()
+		starts = append(starts, start)
+		mu.Unlock()
+	})
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	opts := testcluster.DefaultTestJobOptions()
+	opts.Fetch = job.FetchConfig{FetchSize: 1, FetchWorkers: 1}
+	opts.Output.ChunkRecords = 1
+	jobID, err := cl.SubmitJob(ctx, &job.JobSpec{Version: "0.1.0", LogURI: ts.URL, Options: opts})
+	require.NoError(t, err)
+	require.NoError(t, cl.BulkCreateShards(ctx, jobID, []cluster.ShardRange{{ShardID: 0, IndexFrom: 0, IndexTo: 4}}))
+
+	// Another worker got through the first two entries, then gave the shard up
+	require.NoError(t, cl.AssignShard(ctx, jobID, 0, "gone"))
+	require.NoError(t, cl.UpdateShardProgress(ctx, jobID, 0, "gone", cluster.ShardCheckpoint{LastIndex: 1, Chunks: 2, Records: 2}))
+	require.NoError(t, cl.ReleaseShardLease(ctx, jobID, 0, "gone"))
+
+	workers := testworkers.RunWorkers(ctx, t, cl, jobID, 1, testutil.NewTestLogger(true))
+	defer func() {
+		for _, w := range workers {
+			w.Stop()
+		}
+	}()
+	testutil.WaitFor(t, func() bool {
+		return testcluster.AllShardsDone(t, cl, jobID)
+	}, 15*time.Second, 50*time.Millisecond, "resumed shard should finish")
+
+	mu.Lock()
+	require.NotEmpty(t, starts)
+	for _, start := range starts {
+		require.GreaterOrEqual(t, start, int64(2), "refetched entries before the checkpoint")
+	}
+	mu.Unlock()
+
+	// The manifest counts the earlier run's output as well as this one's
+	var man cluster.ShardManifest
+	require.NoError(t, json.Unmarshal([]byte(testcluster.MustGetEtcdKey(t, cl.Client(), cl.ShardKey(jobID, 0)+"/done")), &man))
+	require.False(t, man.Failed)
+	require.EqualValues(t, 4, man.Records)
+	require.Equal(t, 4, man.Chunks)
+
+	status, err := cl.GetShardStatus(ctx, jobID, 0)
+	require.NoError(t, err)
+	require.Nil(t, status.Checkpoint, "checkpoint should be cleared once the shard is done")
+}
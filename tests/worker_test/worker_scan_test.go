@@ -2,6 +2,8 @@ package worker_test
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"sync"
@@ -74,6 +76,84 @@ func TestWorker_StreamShard_StubbedCTLog(t *testing.T) {
 	require.True(t, found, "Expected to find mail.google.com cert, did not")
 }
 
+func TestWorker_StreamShard_CustomHeaders(t *testing.T) {
+	// Stub log that only serves requests carrying the expected API key
+	var mu sync.Mutex
+	var seen []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Get("X-Api-Key")+"|"+r.Header.Get("X-Tenant"))
+		mu.Unlock()
+		if r.Header.Get("X-Api-Key") != "hunter2" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/ct/v1/get-sth":
+			w.Write([]byte(testutil.CTLogFourEntrySTH))
+		case "/ct/v1/get-entries":
+			w.Write([]byte(testutil.CTLogFourEntries))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+
+	var key [32]byte
+	copy(key[:], "0123456789abcdef0123456789abcdef")
+	cl.Secrets().SetClusterKey(key)
+	require.NoError(t, cl.Secrets().Set(context.Background(), "ct/api-key", []byte("hunter2\n")))
+
+	stream := func(headers map[string]string) ([]*ct.RawLogEntry, error) {
+		spec := job.JobSpec{
+			LogURI: ts.URL,
+			Options: job.JobOptions{
+				Fetch: job.FetchConfig{
+					FetchSize:    2,
+					FetchWorkers: 1,
+					IndexStart:   0,
+					IndexEnd:     4,
+					Headers:      headers,
+				},
+			},
+		}
+		w := worker.NewWorker(cl, "worker-1", nil)
+		w.DisableJitterAndSmoothingForTests = true
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		entriesCh := make(chan *ct.RawLogEntry, 10)
+		var results []*ct.RawLogEntry
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for entry := range entriesCh {
+				results = append(results, entry)
+			}
+		}()
+		err := w.StreamShard(ctx, spec, 0, 4, entriesCh)
+		<-done
+		return results, err
+	}
+
+	// Without the header the log rejects the request
+	_, err := stream(map[string]string{"X-Tenant": "acme"})
+	require.Error(t, err)
+
+	// With the header (resolved from the secret store) fetching succeeds
+	results, err := stream(map[string]string{"X-Api-Key": "secret:ct/api-key", "X-Tenant": "acme"})
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Contains(t, seen, "|acme")
+	require.Contains(t, seen, "hunter2|acme")
+}
+
 func TestWorkerE2E_ExtractsExpectedCerts(t *testing.T) {
 	cl, cleanup := testcluster.SetupEtcdCluster(t)
 	defer cleanup()
@@ -3,11 +3,14 @@ package worker_test
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/chtzvt/certslurp/internal/job"
 	"github.com/chtzvt/certslurp/internal/testcluster"
 	"github.com/chtzvt/certslurp/internal/testutil"
 	"github.com/chtzvt/certslurp/internal/testworkers"
@@ -160,3 +163,67 @@ func TestCluster_LargeScaleStress(t *testing.T) {
 	}
 	require.Equal(t, numShards, doneCount, "all shards done")
 }
+
+// A shard whose fetch never returns must not keep a stopping worker alive past
+// its shutdown timeout, and the shard must become claimable again.
+func TestWorker_ShutdownTimeoutReleasesHungShard(t *testing.T) {
+	cl, cleanup := testcluster.SetupEtcdCluster(t)
+	defer cleanup()
+
+	release := make(chan struct{})
+	fetching := make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ct/v1/get-sth":
+			w.Write([]byte(testutil.CTLogFourEntrySTH))
+		case "/ct/v1/get-entries":
+			select {
+			case fetching <- struct{}{}:
+			default:
+			}
+			<-release // hang until the test is over
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	opts := testcluster.DefaultTestJobOptions()
+	opts.Fetch = job.FetchConfig{FetchSize: 4, FetchWorkers: 1}
+	jobID := testcluster.SubmitTestJob(t, cl, ts.URL, 1, opts)
+	logger := testutil.NewTestLogger(true)
+
+	w := worker.NewWorker(cl, "hang-0", logger)
+	w.DisableJitterAndSmoothingForTests = true
+	w.PollPeriod = 100 * time.Millisecond
+	w.ShutdownTimeout = 1 * time.Second
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- w.Run(context.Background()) }()
+
+	select {
+	case <-fetching:
+	case <-time.After(30 * time.Second):
+		t.Fatal("worker never started fetching the shard")
+	}
+	status, err := cl.GetShardStatus(context.Background(), jobID, 0)
+	require.NoError(t, err)
+	require.True(t, status.Assigned)
+	require.Equal(t, "hang-0", status.WorkerID)
+
+	start := time.Now()
+	go w.Stop()
+	select {
+	case err := <-errCh:
+		require.ErrorIs(t, err, worker.ErrShutdownTimeout)
+	case <-time.After(10 * time.Second):
+		t.Fatal("worker did not exit after shutdown timeout")
+	}
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	status, err = cl.GetShardStatus(context.Background(), jobID, 0)
+	require.NoError(t, err)
+	require.False(t, status.Assigned, "hung shard lease should be released")
+	require.False(t, status.Done)
+	require.False(t, status.Failed)
+	require.NoError(t, cl.AssignShard(context.Background(), jobID, 0, "other-worker"))
+}